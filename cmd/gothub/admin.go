@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/config"
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+	"github.com/odvcencio/gothub/internal/service"
+)
+
+const adminUsage = `Usage: gothub admin [-config path] <command> [args]
+
+Commands:
+  users [query]                       List users, optionally by username or email prefix
+  promote <user>                      Make a user a site admin
+  demote <user>                       Revoke site admin rights
+  suspend <user>                      Suspend a user and end their sessions
+  unsuspend <user>                    Lift a suspension
+  reset-credentials <user>            Revoke a user's sessions, tokens, keys, passkeys and 2FA
+  delete-user <user>                  Delete a user who owns no repositories
+  grant [-expires time] <user> <feature>
+                                      Grant an entitlement (expires is RFC 3339)
+  revoke <user> <feature>             Withdraw an entitlement
+  transfer <owner/repo> <new-owner>   Move a repository to another user or org
+  delete-repo <owner/repo>            Delete a repository
+  queues                              Show background queue depth
+`
+
+// cmdAdmin administers the site straight from the database, so it works
+// before any account has admin rights.
+func cmdAdmin(args []string) {
+	fs := flag.NewFlagSet("admin", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config file")
+	fs.Usage = func() { fmt.Fprint(os.Stderr, adminUsage) }
+	fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load config: %v\n", err)
+		os.Exit(1)
+	}
+	db, err := openDB(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := db.Migrate(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		os.Exit(1)
+	}
+	if err := runAdmin(ctx, db, cfg.Storage.Path, os.Stdout, fs.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "gothub admin: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runAdmin(ctx context.Context, db database.DB, storagePath string, out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing command; run gothub admin -h for usage")
+	}
+	audit := service.NewAuditService(db)
+	adminSvc := service.NewAdminService(db)
+	adminSvc.SetAuditService(audit)
+	repoSvc := service.NewRepoService(db, storagePath)
+	repoSvc.SetAuditService(audit)
+
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "users":
+		query := ""
+		if len(args) > 0 {
+			query = args[0]
+		}
+		users, err := adminSvc.ListUsers(ctx, query, 1, 200)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tUSERNAME\tEMAIL\tADMIN\tSUSPENDED")
+		for _, u := range users {
+			suspended := ""
+			if u.SuspendedAt != nil {
+				suspended = u.SuspendedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%t\t%s\n", u.ID, u.Username, u.Email, u.IsAdmin, suspended)
+		}
+		return tw.Flush()
+	case "promote", "demote":
+		user, err := adminUser(ctx, db, args)
+		if err != nil {
+			return err
+		}
+		if err := adminSvc.SetAdmin(ctx, user, cmd == "promote"); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s admin: %t\n", user.Username, user.IsAdmin)
+	case "suspend":
+		user, err := adminUser(ctx, db, args)
+		if err != nil {
+			return err
+		}
+		if err := adminSvc.Suspend(ctx, user); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "suspended %s\n", user.Username)
+	case "unsuspend":
+		user, err := adminUser(ctx, db, args)
+		if err != nil {
+			return err
+		}
+		if err := adminSvc.Unsuspend(ctx, user); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "unsuspended %s\n", user.Username)
+	case "reset-credentials":
+		user, err := adminUser(ctx, db, args)
+		if err != nil {
+			return err
+		}
+		reset, err := adminSvc.ResetCredentials(ctx, user)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "reset %s: %d access tokens, %d oauth apps, %d ssh keys, %d passkeys, two-factor removed: %t\n",
+			user.Username, reset.AccessTokens, reset.OAuthApps, reset.SSHKeys, reset.Passkeys, reset.TwoFactor)
+	case "delete-user":
+		user, err := adminUser(ctx, db, args)
+		if err != nil {
+			return err
+		}
+		if err := adminSvc.DeleteUser(ctx, user); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "deleted %s\n", user.Username)
+	case "grant", "revoke":
+		grantFlags := flag.NewFlagSet(cmd, flag.ContinueOnError)
+		grantFlags.SetOutput(io.Discard)
+		expires := grantFlags.String("expires", "", "expiry time (RFC 3339)")
+		if cmd == "grant" {
+			if err := grantFlags.Parse(args); err != nil {
+				return err
+			}
+			args = grantFlags.Args()
+		}
+		if len(args) != 2 {
+			return fmt.Errorf("usage: gothub admin %s <user> <feature>", cmd)
+		}
+		var expiresAt *time.Time
+		if *expires != "" {
+			t, err := time.Parse(time.RFC3339, *expires)
+			if err != nil {
+				return fmt.Errorf("invalid -expires: %w", err)
+			}
+			expiresAt = &t
+		}
+		user, err := adminUser(ctx, db, args[:1])
+		if err != nil {
+			return err
+		}
+		if _, err := adminSvc.SetEntitlement(ctx, user, args[1], cmd == "grant", expiresAt); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s %s: %s\n", cmd, args[1], user.Username)
+	case "transfer":
+		if len(args) != 2 {
+			return errors.New("usage: gothub admin transfer <owner/repo> <new-owner>")
+		}
+		repo, err := adminRepo(ctx, repoSvc, args[0])
+		if err != nil {
+			return err
+		}
+		moved, err := repoSvc.Transfer(ctx, repo, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "transferred %s/%s to %s\n", repo.OwnerName, repo.Name, moved.OwnerName)
+	case "delete-repo":
+		if len(args) != 1 {
+			return errors.New("usage: gothub admin delete-repo <owner/repo>")
+		}
+		repo, err := adminRepo(ctx, repoSvc, args[0])
+		if err != nil {
+			return err
+		}
+		if err := repoSvc.Delete(ctx, repo.ID); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "deleted %s/%s\n", repo.OwnerName, repo.Name)
+	case "queues":
+		stats, err := adminSvc.QueueStats(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "QUEUE\tQUEUED\tIN PROGRESS\tFAILED\tOLDEST QUEUED")
+		for _, q := range stats {
+			oldest := ""
+			if q.OldestQueuedAt != nil {
+				oldest = q.OldestQueuedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", q.Queue, q.Queued, q.InProgress, q.Failed, oldest)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown admin command: %s", cmd)
+	}
+	return nil
+}
+
+func adminUser(ctx context.Context, db database.DB, args []string) (*models.User, error) {
+	if len(args) != 1 {
+		return nil, errors.New("expected exactly one username")
+	}
+	user, err := db.GetUserByUsername(ctx, args[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user not found: %s", args[0])
+	}
+	return user, err
+}
+
+func adminRepo(ctx context.Context, repoSvc *service.RepoService, fullName string) (*models.Repository, error) {
+	owner, name, ok := strings.Cut(fullName, "/")
+	if !ok || owner == "" || name == "" {
+		return nil, fmt.Errorf("repository must be owner/name: %s", fullName)
+	}
+	repo, err := repoSvc.Get(ctx, owner, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("repository not found: %s", fullName)
+	}
+	return repo, err
+}
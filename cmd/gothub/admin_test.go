@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+func TestRunAdminBootstrapsAdminAndSuspendsUsers(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "gothub.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"alice", "mallory"} {
+		if err := db.CreateUser(ctx, &models.User{Username: name, Email: name + "@example.com", PasswordHash: "!"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(args ...string) string {
+		t.Helper()
+		var out bytes.Buffer
+		if err := runAdmin(ctx, db, t.TempDir(), &out, args); err != nil {
+			t.Fatalf("gothub admin %s: %v", strings.Join(args, " "), err)
+		}
+		return out.String()
+	}
+	run("promote", "alice")
+	run("suspend", "mallory")
+
+	alice, err := db.GetUserByUsername(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !alice.IsAdmin {
+		t.Fatal("alice should be a site admin after promote")
+	}
+	mallory, err := db.GetUserByUsername(ctx, "mallory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mallory.SuspendedAt == nil {
+		t.Fatal("mallory should be suspended")
+	}
+
+	listing := run("users", "mal")
+	if !strings.Contains(listing, "mallory") || strings.Contains(listing, "alice") {
+		t.Fatalf("users mal listed:\n%s", listing)
+	}
+
+	var out bytes.Buffer
+	if err := runAdmin(ctx, db, t.TempDir(), &out, []string{"promote", "nobody"}); err == nil {
+		t.Fatal("promoting an unknown user should fail")
+	}
+	if err := runAdmin(ctx, db, t.TempDir(), &out, []string{"grant", "alice", "unlimited-everything"}); err == nil {
+		t.Fatal("granting an unknown entitlement should fail")
+	}
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,7 +18,10 @@ import (
 	"github.com/odvcencio/gothub/internal/auth"
 	"github.com/odvcencio/gothub/internal/config"
 	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/mail"
+	"github.com/odvcencio/gothub/internal/oidc"
 	"github.com/odvcencio/gothub/internal/service"
+	"golang.org/x/crypto/ssh"
 )
 
 var legacyTrustAllProxyCIDRs = []string{
@@ -26,7 +31,7 @@ var legacyTrustAllProxyCIDRs = []string{
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: gothub <command>\n\nCommands:\n  serve    Start the server\n  migrate  Run database migrations\n")
+		fmt.Fprintf(os.Stderr, "Usage: gothub <command>\n\nCommands:\n  serve    Start the server\n  migrate  Run database migrations\n  admin    Administer users and repositories\n")
 		os.Exit(1)
 	}
 
@@ -35,6 +40,8 @@ func main() {
 		cmdServe(os.Args[2:])
 	case "migrate":
 		cmdMigrate(os.Args[2:])
+	case "admin":
+		cmdAdmin(os.Args[2:])
 	default:
 		fmt.Fprintf(os.Stderr, "unknown command: %s\n", os.Args[1])
 		os.Exit(1)
@@ -46,6 +53,7 @@ func cmdServe(args []string) {
 
 	fs := flag.NewFlagSet("serve", flag.ExitOnError)
 	configPath := fs.String("config", "", "path to config file")
+	sshPort := fs.Int("ssh-port", -1, "port for git over SSH (0 disables; overrides config)")
 	fs.Parse(args)
 
 	cfg, err := config.Load(*configPath)
@@ -53,6 +61,9 @@ func cmdServe(args []string) {
 		slog.Error("load config", "error", err)
 		os.Exit(1)
 	}
+	if *sshPort >= 0 {
+		cfg.Server.SSHPort = *sshPort
+	}
 	if err := validateServeConfig(cfg); err != nil {
 		slog.Error("invalid config", "error", err)
 		os.Exit(1)
@@ -90,36 +101,71 @@ func cmdServe(args []string) {
 	}
 	authSvc := auth.NewService(cfg.Auth.JWTSecret, dur)
 	repoSvc := service.NewRepoService(db, cfg.Storage.Path)
+	if cfg.Signing.SSHKeyPath != "" {
+		signer, err := service.LoadServerSigner(cfg.Signing.SSHKeyPath)
+		if err != nil {
+			slog.Error("load commit signing key", "error", err)
+			os.Exit(1)
+		}
+		repoSvc.SetServerSigner(signer)
+	}
+	mailer, err := mail.NewSender(mail.Config{
+		Driver:       cfg.Mail.Driver,
+		SMTPHost:     cfg.Mail.SMTPHost,
+		SMTPPort:     cfg.Mail.SMTPPort,
+		SMTPUsername: cfg.Mail.SMTPUsername,
+		SMTPPassword: cfg.Mail.SMTPPassword,
+		FileDir:      cfg.Mail.FileDir,
+	})
+	if err != nil {
+		slog.Error("configure mail", "error", err)
+		os.Exit(1)
+	}
+	ssoProviders, err := buildSSOProviders(cfg.Auth.OIDCProviders)
+	if err != nil {
+		slog.Error("configure single sign-on", "error", err)
+		os.Exit(1)
+	}
 	serverOpts := api.ServerOptions{
-		EnableAsyncIndexing: envBool("GOTHUB_ENABLE_ASYNC_INDEXING"),
-		IndexWorkerCount:    envInt("GOTHUB_INDEX_WORKER_COUNT", 2),
-		IndexWorkerPoll:     envDuration("GOTHUB_INDEX_WORKER_POLL_INTERVAL", 250*time.Millisecond),
-		EnableAdminHealth:   envBool("GOTHUB_ENABLE_ADMIN_HEALTH"),
-		EnablePprof:         envBool("GOTHUB_ENABLE_PPROF"),
-		AdminAllowedCIDRs:   parseAdminCIDRs("GOTHUB_ADMIN_ALLOWED_CIDRS"),
-		CORSAllowedOrigins:  parseCSVEnv("GOTHUB_CORS_ALLOW_ORIGINS"),
-		TrustedProxyCIDRs:   trustedProxyCIDRs(cfg),
-		EnableTenantContext: cfg.Tenancy.Enabled,
-		TenantHeader:        cfg.Tenancy.Header,
-		DefaultTenantID:     cfg.Tenancy.DefaultTenantID,
-		RestrictToPublic:    cfg.Launch.RestrictToPublicRepos,
-		MaxPublicRepos:      cfg.Launch.MaxPublicReposPerUser,
-		RequirePrivatePlan:  cfg.Launch.RequirePrivateRepoPlan,
-		MaxPrivateRepos:     cfg.Launch.MaxPrivateReposPerUser,
-		PrivateRepoAllowed:  cfg.Launch.PrivateRepoAllowedUsers,
-		PolarWebhookSecret:  strings.TrimSpace(os.Getenv("GOTHUB_POLAR_WEBHOOK_SECRET")),
-		PolarProductIDs:     parseCSVEnv("GOTHUB_POLAR_PRIVATE_REPO_PRODUCT_IDS"),
+		EnableAsyncIndexing:     envBool("GOTHUB_ENABLE_ASYNC_INDEXING"),
+		IndexWorkerCount:        envInt("GOTHUB_INDEX_WORKER_COUNT", 2),
+		IndexWorkerPoll:         envDuration("GOTHUB_INDEX_WORKER_POLL_INTERVAL", 250*time.Millisecond),
+		WebhookWorkerCount:      envInt("GOTHUB_WEBHOOK_WORKER_COUNT", 2),
+		WebhookWorkerPoll:       envDuration("GOTHUB_WEBHOOK_WORKER_POLL_INTERVAL", time.Second),
+		WebhookAutoDisableAfter: envDuration("GOTHUB_WEBHOOK_AUTO_DISABLE_AFTER", 72*time.Hour),
+		EnableAdminHealth:       envBool("GOTHUB_ENABLE_ADMIN_HEALTH"),
+		EnablePprof:             envBool("GOTHUB_ENABLE_PPROF"),
+		AdminAllowedCIDRs:       parseAdminCIDRs("GOTHUB_ADMIN_ALLOWED_CIDRS"),
+		CORSAllowedOrigins:      parseCSVEnv("GOTHUB_CORS_ALLOW_ORIGINS"),
+		TrustedProxyCIDRs:       trustedProxyCIDRs(cfg),
+		EnableTenantContext:     cfg.Tenancy.Enabled,
+		TenantHeader:            cfg.Tenancy.Header,
+		DefaultTenantID:         cfg.Tenancy.DefaultTenantID,
+		RestrictToPublic:        cfg.Launch.RestrictToPublicRepos,
+		MaxPublicRepos:          cfg.Launch.MaxPublicReposPerUser,
+		RequirePrivatePlan:      cfg.Launch.RequirePrivateRepoPlan,
+		MaxPrivateRepos:         cfg.Launch.MaxPrivateReposPerUser,
+		PrivateRepoAllowed:      cfg.Launch.PrivateRepoAllowedUsers,
+		PolarWebhookSecret:      strings.TrimSpace(os.Getenv("GOTHUB_POLAR_WEBHOOK_SECRET")),
+		PolarProductIDs:         parseCSVEnv("GOTHUB_POLAR_PRIVATE_REPO_PRODUCT_IDS"),
+		Mailer:                  mailer,
+		MailWorkerPoll:          envDuration("GOTHUB_MAIL_WORKER_POLL_INTERVAL", time.Second),
+		DigestWorkerPoll:        envDuration("GOTHUB_DIGEST_WORKER_POLL_INTERVAL", 15*time.Minute),
+		MailFrom:                cfg.Mail.From,
+		PublicURL:               cfg.Mail.PublicURL,
+		MailReplyDomain:         cfg.Mail.ReplyDomain,
+		MailReplySecret:         cfg.Mail.ReplySecret,
+		MailInboundSecret:       cfg.Mail.InboundSecret,
+		SSOProviders:            ssoProviders,
 	}
 	server := api.NewServerWithOptions(db, authSvc, repoSvc, serverOpts)
 	workerCtx, workerCancel := context.WithCancel(context.Background())
 	defer workerCancel()
-	if serverOpts.EnableAsyncIndexing {
-		if err := server.StartBackgroundWorkers(workerCtx); err != nil {
-			slog.Error("start background workers", "error", err)
-			os.Exit(1)
-		}
-		defer server.StopBackgroundWorkersNow()
+	if err := server.StartBackgroundWorkers(workerCtx); err != nil {
+		slog.Error("start background workers", "error", err)
+		os.Exit(1)
 	}
+	defer server.StopBackgroundWorkersNow()
 
 	httpServer := &http.Server{
 		Addr:         cfg.Addr(),
@@ -141,6 +187,23 @@ func cmdServe(args []string) {
 		}
 	}()
 
+	if cfg.Server.SSHPort > 0 {
+		hostKey, err := loadSSHHostKey(sshHostKeyPath(cfg))
+		if err != nil {
+			slog.Error("load ssh host key", "error", err)
+			os.Exit(1)
+		}
+		sshServer := server.NewGitSSHServer(hostKey)
+		defer sshServer.Close()
+		go func() {
+			slog.Info("gothub ssh listening", "addr", cfg.SSHAddr(), "host_key", ssh.FingerprintSHA256(hostKey.PublicKey()))
+			if err := sshServer.ListenAndServe(cfg.SSHAddr()); err != nil && !errors.Is(err, net.ErrClosed) {
+				slog.Error("ssh listen", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	<-done
 	slog.Info("shutting down")
 	workerCancel()
@@ -198,7 +261,35 @@ func validateServeConfig(cfg *config.Config) error {
 	if cfg.Storage.Path == "" {
 		return fmt.Errorf("storage.path must be configured")
 	}
-	return nil
+	return cfg.ValidateMail()
+}
+
+func buildSSOProviders(configs []config.OIDCProviderConfig) ([]*service.SSOProvider, error) {
+	providers := make([]*service.SSOProvider, 0, len(configs))
+	for _, c := range configs {
+		p, err := oidc.NewProvider(oidc.Config{
+			Name:         c.Name,
+			DisplayName:  c.DisplayName,
+			Issuer:       c.Issuer,
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			Scopes:       c.Scopes,
+			GroupsClaim:  c.GroupsClaim,
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		mappings := make([]service.SSOGroupMapping, 0, len(c.GroupMappings))
+		for _, m := range c.GroupMappings {
+			role := m.Role
+			if role == "" {
+				role = "member"
+			}
+			mappings = append(mappings, service.SSOGroupMapping{Group: m.Group, Org: m.Org, Role: role})
+		}
+		providers = append(providers, &service.SSOProvider{Provider: p, GroupMappings: mappings})
+	}
+	return providers, nil
 }
 
 func parseAdminCIDRs(name string) []string {
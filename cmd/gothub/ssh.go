@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/odvcencio/gothub/internal/config"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshHostKeyPath returns the configured host key path, defaulting to a file
+// under the repository storage directory.
+func sshHostKeyPath(cfg *config.Config) string {
+	if cfg.Server.SSHHostKeyPath != "" {
+		return cfg.Server.SSHHostKeyPath
+	}
+	return filepath.Join(cfg.Storage.Path, ".ssh_host_ed25519_key")
+}
+
+// loadSSHHostKey reads the SSH host key at path, generating and saving an
+// Ed25519 key on first start so the host fingerprint stays stable.
+func loadSSHHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("generate ssh host key: %w", err)
+		}
+		block, err := ssh.MarshalPrivateKey(priv, "gothub host key")
+		if err != nil {
+			return nil, fmt.Errorf("encode ssh host key: %w", err)
+		}
+		data = pem.EncodeToMemory(block)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("create ssh host key dir: %w", err)
+		}
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return nil, fmt.Errorf("write ssh host key: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("read ssh host key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse ssh host key: %w", err)
+	}
+	return signer, nil
+}
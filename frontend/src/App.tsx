@@ -21,6 +21,8 @@ import { NotFoundView } from './views/NotFound';
 import { LoginView } from './views/Login';
 import { SignupView } from './views/Signup';
 import { NewRepoView } from './views/NewRepo';
+import { OAuthAuthorizeView } from './views/OAuthAuthorize';
+import { InvitationsView } from './views/Invitations';
 
 export function App() {
   return (
@@ -30,9 +32,14 @@ export function App() {
         <Router>
           <Home path="/" />
           <LoginView path="/login" />
+          <LoginView path="/login/oidc/callback" />
           <SignupView path="/signup" />
           <NotificationsView path="/notifications" />
           <SettingsView path="/settings" />
+          <OAuthAuthorizeView path="/oauth/authorize" />
+          <InvitationsView path="/invitations" />
+          <InvitationsView path="/invitations/accept" />
+          <InvitationsView path="/invitations/:id" />
           <NewRepoView path="/new" />
           <RepoSettingsView path="/:owner/:repo/settings" />
           <CodeView path="/:owner/:repo/tree/:ref/:path*" />
@@ -62,7 +62,9 @@ async function request<T>(method: string, path: string, body?: unknown): Promise
 
   if (!resp.ok) {
     const err = await resp.json().catch(() => ({ error: resp.statusText }));
-    throw new Error(err.error || resp.statusText);
+    // Keep the body: some errors carry data the caller needs, such as the
+    // replacement challenge after a wrong two-factor code.
+    throw Object.assign(new Error(err.error || resp.statusText), { data: err });
   }
 
   if (resp.status === 204) return undefined as T;
@@ -84,6 +86,9 @@ export interface AuthResponse {
   magic_link_sent?: boolean;
   magic_token?: string;
   magic_expires_at?: string;
+  two_factor_required?: boolean;
+  challenge?: string;
+  methods?: string[];
 }
 
 export interface AuthCapabilities {
@@ -93,6 +98,12 @@ export interface AuthCapabilities {
   organizations_enabled?: boolean;
   require_verified_email?: boolean;
   require_passkey_enrollment?: boolean;
+  oidc_providers?: OIDCProvider[];
+}
+
+export interface OIDCProvider {
+  name: string;
+  display_name: string;
 }
 
 export interface Notification {
@@ -102,6 +113,56 @@ export interface Notification {
   [key: string]: unknown;
 }
 
+export interface TwoFactorStatus {
+  totp_enabled: boolean;
+  passkey_enabled: boolean;
+  recovery_codes_remaining: number;
+}
+
+export interface OAuthApp {
+  id: number;
+  name: string;
+  homepage_url?: string;
+  client_id: string;
+  client_secret?: string;
+  redirect_uris: string[];
+  created_at: string;
+}
+
+export interface OAuthAuthorization {
+  app_id: number;
+  app_name: string;
+  client_id: string;
+  homepage_url?: string;
+  scopes: string[];
+  created_at: string;
+  last_used_at?: string;
+}
+
+export interface OAuthConsent {
+  app: { name: string; homepage_url?: string; client_id: string };
+  redirect_uri: string;
+  scopes: string[];
+}
+
+export interface TOTPEnrollment {
+  secret: string;
+  provisioning_uri: string;
+}
+
+export interface OrgSecurity {
+  require_two_factor: boolean;
+  non_compliant_members: string[];
+}
+
+export type EmailFrequency = 'instant' | 'daily' | 'weekly';
+
+export interface NotificationSettings {
+  user_id: number;
+  email_frequency: EmailFrequency;
+  last_digest_at?: string;
+}
+
 export interface Repository {
   id: number;
   name: string;
@@ -365,13 +426,69 @@ export interface Collaborator {
   [key: string]: unknown;
 }
 
+export interface Invitation {
+  id: number;
+  repo_id?: number;
+  org_id?: number;
+  target: string;
+  inviter_name: string;
+  invitee_name?: string;
+  email?: string;
+  role: string;
+  expires_at: string;
+  created_at: string;
+}
+
+export interface AuditEvent {
+  id: number;
+  actor_id?: number;
+  actor_name?: string;
+  action: string;
+  target: string;
+  repo_id?: number;
+  org_id?: number;
+  ip?: string;
+  request_id?: string;
+  before?: Record<string, unknown>;
+  after?: Record<string, unknown>;
+  created_at: string;
+}
+
+export interface InvitationPreview {
+  invitation: Invitation;
+  account_exists: boolean;
+}
+
 export interface Organization {
   id?: number;
   name: string;
   display_name?: string;
+  default_repo_permission?: string;
   [key: string]: unknown;
 }
 
+export interface Team {
+  id: number;
+  org_id: number;
+  parent_id?: number;
+  name: string;
+  description: string;
+  created_at: string;
+}
+
+export interface TeamMember {
+  team_id: number;
+  user_id: number;
+  username: string;
+}
+
+export interface TeamRepo {
+  team_id: number;
+  repo_id: number;
+  repo_name: string;
+  permission: 'read' | 'write' | 'admin';
+}
+
 export interface SymbolResult {
   id?: string;
   name: string;
@@ -474,9 +591,15 @@ interface RepoEventStreamHandlers {
 export const register = (username: string, email: string) =>
   request<AuthResponse>('POST', '/auth/register', { username, email });
 export const requestMagicLink = (email: string) =>
-  request<{ sent: boolean; token?: string; expires_at?: string }>('POST', '/auth/magic/request', { email });
+  request<{ sent: boolean }>('POST', '/auth/magic/request', { email });
 export const verifyMagicLink = (token: string) =>
   request<AuthResponse>('POST', '/auth/magic/verify', { token });
+export const verifyTwoFactor = (challenge: string, code: string) =>
+  request<AuthResponse>('POST', '/auth/2fa/verify', { challenge, code });
+export const beginOIDCLogin = (provider: string) =>
+  request<{ authorization_url: string }>('POST', `/auth/oidc/${encodeURIComponent(provider)}/begin`);
+export const completeOIDCLogin = (state: string, code: string) =>
+  request<AuthResponse>('POST', '/auth/oidc/callback', { state, code });
 export const beginSSHLogin = (username: string, fingerprint?: string) =>
   request<{ challenge_id: string; challenge: string; fingerprint: string; expires_at: string }>('POST', '/auth/ssh/challenge', { username, fingerprint });
 export const finishSSHLogin = (challengeId: string, signature: string, signatureFormat: string) =>
@@ -507,6 +630,9 @@ export const listNotifications = (unread?: boolean, page?: number, perPage?: num
 export const getUnreadNotificationsCount = () => request<{ count: number }>('GET', '/notifications/unread-count');
 export const markNotificationRead = (id: number) => request<void>('POST', `/notifications/${id}/read`);
 export const markAllNotificationsRead = () => request<void>('POST', '/notifications/read-all');
+export const getNotificationSettings = () => request<NotificationSettings>('GET', '/user/notification-settings');
+export const updateNotificationSettings = (emailFrequency: EmailFrequency) =>
+  request<NotificationSettings>('PUT', '/user/notification-settings', { email_frequency: emailFrequency });
 
 // Explore
 export const listExploreRepos = (page = 1, perPage = 10, sort = 'updated') =>
@@ -661,15 +787,56 @@ export const listSSHKeys = () => request<SSHKey[]>('GET', '/user/ssh-keys');
 export const createSSHKey = (name: string, publicKey: string) =>
   request<SSHKey>('POST', '/user/ssh-keys', { name, public_key: publicKey });
 export const deleteSSHKey = (id: number) => request<void>('DELETE', `/user/ssh-keys/${id}`);
+export const listOAuthApps = () => request<OAuthApp[]>('GET', '/user/oauth-apps');
+export const createOAuthApp = (data: { name: string; homepage_url?: string; redirect_uris: string[] }) =>
+  request<OAuthApp>('POST', '/user/oauth-apps', data);
+export const deleteOAuthApp = (id: number) => request<void>('DELETE', `/user/oauth-apps/${id}`);
+export const resetOAuthAppSecret = (id: number) => request<OAuthApp>('POST', `/user/oauth-apps/${id}/secret`);
+export const listOAuthAuthorizations = () => request<OAuthAuthorization[]>('GET', '/user/oauth-authorizations');
+export const revokeOAuthAuthorization = (appId: number) =>
+  request<void>('DELETE', `/user/oauth-authorizations/${appId}`);
+export const getOAuthConsent = (query: string) => request<OAuthConsent>('GET', `/oauth/authorize?${query}`);
+export const decideOAuthConsent = (params: Record<string, string>, approve: boolean) =>
+  request<{ redirect_url: string }>('POST', '/oauth/authorize', { ...params, approve });
+export const getTwoFactorStatus = () => request<TwoFactorStatus>('GET', '/user/2fa');
+export const beginTOTPEnrollment = () => request<TOTPEnrollment>('POST', '/user/2fa/totp');
+export const confirmTOTPEnrollment = (code: string) =>
+  request<{ recovery_codes: string[] }>('POST', '/user/2fa/totp/confirm', { code });
+export const disableTOTP = (code: string) => request<void>('POST', '/user/2fa/totp/disable', { code });
+export const regenerateRecoveryCodes = (code: string) =>
+  request<{ recovery_codes: string[] }>('POST', '/user/2fa/recovery-codes', { code });
 export const listPasskeys = () => request<PasskeyCredential[]>('GET', '/user/passkeys');
 
 // Collaborators
 export const listCollaborators = (owner: string, repo: string) =>
   request<Collaborator[]>('GET', `/repos/${owner}/${repo}/collaborators`);
 export const addCollaborator = (owner: string, repo: string, username: string, role: string) =>
-  request<Collaborator>('POST', `/repos/${owner}/${repo}/collaborators`, { username, role });
+  request<Invitation>('POST', `/repos/${owner}/${repo}/collaborators`, { username, role });
+export const inviteCollaboratorByEmail = (owner: string, repo: string, email: string, role: string) =>
+  request<Invitation>('POST', `/repos/${owner}/${repo}/collaborators`, { email, role });
 export const removeCollaborator = (owner: string, repo: string, username: string) =>
   request<void>('DELETE', `/repos/${owner}/${repo}/collaborators/${username}`);
+export const listRepoInvitations = (owner: string, repo: string) =>
+  request<Invitation[]>('GET', `/repos/${owner}/${repo}/invitations`);
+export const revokeRepoInvitation = (owner: string, repo: string, id: number) =>
+  request<void>('DELETE', `/repos/${owner}/${repo}/invitations/${id}`);
+
+// Invitations
+export const listMyInvitations = () => request<Invitation[]>('GET', '/user/invitations');
+export const acceptInvitation = (id: number) => request<void>('POST', `/user/invitations/${id}/accept`);
+export const declineInvitation = (id: number) => request<void>('POST', `/user/invitations/${id}/decline`);
+export const previewInvitationToken = (token: string) =>
+  request<InvitationPreview>('POST', '/invitations/preview', { token });
+export const acceptInvitationToken = (token: string, username?: string) =>
+  request<AuthResponse | void>('POST', '/invitations/accept', { token, username });
+export const declineInvitationToken = (token: string) =>
+  request<void>('POST', '/invitations/decline', { token });
+
+// Audit log
+export const listRepoAuditEvents = (owner: string, repo: string, before?: number) =>
+  request<AuditEvent[]>('GET', `/repos/${owner}/${repo}/audit${before ? `?before=${before}` : ''}`);
+export const listOrgAuditEvents = (org: string, before?: number) =>
+  request<AuditEvent[]>('GET', `/orgs/${org}/audit${before ? `?before=${before}` : ''}`);
 
 // Repo management
 export const deleteRepo = (owner: string, repo: string) =>
@@ -681,11 +848,36 @@ export const createOrg = (name: string, displayName: string) =>
 export const getOrg = (org: string) => request<Organization>('GET', `/orgs/${org}`);
 export const deleteOrg = (org: string) => request<void>('DELETE', `/orgs/${org}`);
 export const listOrgMembers = (org: string) => request<Collaborator[]>('GET', `/orgs/${org}/members`);
+export const getOrgSecurity = (org: string) => request<OrgSecurity>('GET', `/orgs/${org}/security`);
+export const updateOrgSecurity = (org: string, requireTwoFactor: boolean) =>
+  request<OrgSecurity>('PUT', `/orgs/${org}/security`, { require_two_factor: requireTwoFactor });
 export const addOrgMember = (org: string, username: string, role: string) =>
-  request<void>('POST', `/orgs/${org}/members`, { username, role });
+  request<Invitation>('POST', `/orgs/${org}/members`, { username, role });
+export const inviteOrgMemberByEmail = (org: string, email: string, role: string) =>
+  request<Invitation>('POST', `/orgs/${org}/members`, { email, role });
+export const listOrgInvitations = (org: string) => request<Invitation[]>('GET', `/orgs/${org}/invitations`);
+export const revokeOrgInvitation = (org: string, id: number) =>
+  request<void>('DELETE', `/orgs/${org}/invitations/${id}`);
 export const removeOrgMember = (org: string, username: string) =>
   request<void>('DELETE', `/orgs/${org}/members/${username}`);
 export const listOrgRepos = (org: string) => request<Repository[]>('GET', `/orgs/${org}/repos`);
+export const updateOrgDefaultRepoPermission = (org: string, permission: string) =>
+  request<Organization>('PATCH', `/orgs/${org}`, { default_repo_permission: permission });
+export const listTeams = (org: string) => request<Team[]>('GET', `/orgs/${org}/teams`);
+export const createTeam = (org: string, data: { name: string; description?: string; parent?: string }) =>
+  request<Team>('POST', `/orgs/${org}/teams`, data);
+export const deleteTeam = (org: string, team: string) => request<void>('DELETE', `/orgs/${org}/teams/${team}`);
+export const listTeamMembers = (org: string, team: string) =>
+  request<TeamMember[]>('GET', `/orgs/${org}/teams/${team}/members`);
+export const addTeamMember = (org: string, team: string, username: string) =>
+  request<void>('PUT', `/orgs/${org}/teams/${team}/members/${username}`);
+export const removeTeamMember = (org: string, team: string, username: string) =>
+  request<void>('DELETE', `/orgs/${org}/teams/${team}/members/${username}`);
+export const listTeamRepos = (org: string, team: string) => request<TeamRepo[]>('GET', `/orgs/${org}/teams/${team}/repos`);
+export const setTeamRepo = (org: string, team: string, repo: string, permission: string) =>
+  request<void>('PUT', `/orgs/${org}/teams/${team}/repos/${repo}`, { permission });
+export const removeTeamRepo = (org: string, team: string, repo: string) =>
+  request<void>('DELETE', `/orgs/${org}/teams/${team}/repos/${repo}`);
 export const listUserOrgs = () => request<Organization[]>('GET', '/user/orgs');
 
 // Code intelligence
@@ -0,0 +1,218 @@
+import { useEffect, useState } from 'preact/hooks';
+import {
+  listMyInvitations,
+  acceptInvitation,
+  declineInvitation,
+  previewInvitationToken,
+  acceptInvitationToken,
+  declineInvitationToken,
+  getToken,
+  setToken,
+  type Invitation,
+  type InvitationPreview,
+} from '../api/client';
+
+interface Props {
+  path?: string;
+  id?: string;
+}
+
+const buttonStyle = {
+  border: 'none',
+  borderRadius: '6px',
+  padding: '6px 12px',
+  cursor: 'pointer',
+  fontSize: '13px',
+};
+
+function targetHref(inv: Invitation) {
+  return inv.org_id ? `/orgs/${inv.target}` : `/${inv.target}`;
+}
+
+function describe(inv: Invitation) {
+  const kind = inv.org_id ? 'organization' : 'repository';
+  return `${inv.inviter_name} invited you to the ${kind} ${inv.target} as ${inv.role}`;
+}
+
+export function InvitationsView({ path, id }: Props) {
+  const token = typeof window !== 'undefined' ? new URLSearchParams(window.location.search).get('token') : null;
+  if (path === '/invitations/accept' || token) {
+    return <AcceptInvitationToken token={token || ''} />;
+  }
+  return <PendingInvitations highlight={id ? Number(id) : undefined} />;
+}
+
+function PendingInvitations({ highlight }: { highlight?: number }) {
+  const [invitations, setInvitations] = useState<Invitation[]>([]);
+  const [loading, setLoading] = useState(true);
+  const [error, setError] = useState('');
+  const loggedIn = !!getToken();
+
+  useEffect(() => {
+    if (!loggedIn) return;
+    listMyInvitations()
+      .then(setInvitations)
+      .catch((e) => setError(e.message))
+      .finally(() => setLoading(false));
+  }, []);
+
+  const respond = async (inv: Invitation, accept: boolean) => {
+    setError('');
+    try {
+      if (accept) {
+        await acceptInvitation(inv.id);
+        window.location.assign(targetHref(inv));
+        return;
+      }
+      await declineInvitation(inv.id);
+      setInvitations(invitations.filter((i) => i.id !== inv.id));
+    } catch (err: any) {
+      setError(err.message || 'failed to respond to invitation');
+    }
+  };
+
+  if (!loggedIn) {
+    return (
+      <div style={{ color: '#8b949e', padding: '40px', textAlign: 'center', border: '1px solid #30363d', borderRadius: '6px' }}>
+        Sign in to view invitations
+      </div>
+    );
+  }
+
+  return (
+    <div>
+      <h1 style={{ fontSize: '20px', color: '#f0f6fc', marginBottom: '16px' }}>Invitations</h1>
+      {error && <div style={{ color: '#f85149', marginBottom: '12px' }}>{error}</div>}
+      {loading ? (
+        <div style={{ color: '#8b949e' }}>Loading...</div>
+      ) : invitations.length === 0 ? (
+        <div style={{ border: '1px solid #30363d', borderRadius: '6px', padding: '16px', color: '#8b949e' }}>No pending invitations</div>
+      ) : (
+        <div style={{ border: '1px solid #30363d', borderRadius: '6px' }}>
+          {invitations.map((inv, idx) => (
+            <div
+              key={inv.id}
+              style={{
+                display: 'flex',
+                alignItems: 'center',
+                justifyContent: 'space-between',
+                gap: '12px',
+                padding: '12px 14px',
+                borderTop: idx === 0 ? 'none' : '1px solid #30363d',
+                borderLeft: inv.id === highlight ? '3px solid #58a6ff' : '3px solid transparent',
+              }}
+            >
+              <div style={{ minWidth: 0 }}>
+                <div style={{ color: '#f0f6fc', fontSize: '14px', marginBottom: '4px' }}>{describe(inv)}</div>
+                <div style={{ color: '#8b949e', fontSize: '12px' }}>
+                  Expires {new Date(inv.expires_at).toLocaleDateString()}
+                </div>
+              </div>
+              <div style={{ display: 'flex', gap: '8px' }}>
+                <button onClick={() => respond(inv, true)} style={{ ...buttonStyle, background: '#238636', color: '#fff' }}>
+                  Accept
+                </button>
+                <button onClick={() => respond(inv, false)} style={{ ...buttonStyle, background: '#21262d', color: '#c9d1d9', border: '1px solid #30363d' }}>
+                  Decline
+                </button>
+              </div>
+            </div>
+          ))}
+        </div>
+      )}
+    </div>
+  );
+}
+
+// AcceptInvitationToken handles the link in an emailed invitation. Without
+// an account for the invited address it asks for a username and signs up.
+function AcceptInvitationToken({ token }: { token: string }) {
+  const [preview, setPreview] = useState<InvitationPreview | null>(null);
+  const [username, setUsername] = useState('');
+  const [error, setError] = useState('');
+  const [info, setInfo] = useState('');
+  const [loginHref, setLoginHref] = useState('/login');
+  const [submitting, setSubmitting] = useState(false);
+  const loggedIn = !!getToken();
+
+  useEffect(() => {
+    if (!token) {
+      setError('Invitation link is missing its token');
+      return;
+    }
+    previewInvitationToken(token)
+      .then(setPreview)
+      .catch((err: any) => setError(err.message || 'Invitation is invalid or expired'));
+  }, [token]);
+
+  const accept = async (e: Event) => {
+    e.preventDefault();
+    if (!preview) return;
+    setError(''); setSubmitting(true);
+    try {
+      const res = await acceptInvitationToken(token, preview.account_exists || loggedIn ? undefined : username);
+      if (res && res.token) {
+        setToken(res.token);
+      } else if (res && res.two_factor_required) {
+        // Nothing is accepted until the second factor is verified; signing
+        // in returns here to accept the invitation as a signed-in user.
+        setInfo('Your account uses two-factor authentication. Sign in to accept the invitation.');
+        setLoginHref(`/login?returnTo=${encodeURIComponent(window.location.pathname + window.location.search)}`);
+        setPreview(null);
+        return;
+      }
+      window.location.assign(targetHref(preview.invitation));
+    } catch (err: any) {
+      setError(err.message || 'failed to accept invitation');
+    } finally { setSubmitting(false); }
+  };
+
+  const decline = async () => {
+    setError(''); setSubmitting(true);
+    try {
+      await declineInvitationToken(token);
+      setPreview(null);
+      setInfo('Invitation declined.');
+    } catch (err: any) {
+      setError(err.message || 'failed to decline invitation');
+    } finally { setSubmitting(false); }
+  };
+
+  const needsUsername = !!preview && !preview.account_exists && !loggedIn;
+
+  return (
+    <div style={{ maxWidth: '420px', margin: '40px auto' }}>
+      <h1 style={{ fontSize: '20px', color: '#f0f6fc', marginBottom: '16px' }}>Invitation</h1>
+      {error && <div style={{ color: '#f85149', marginBottom: '12px' }}>{error}</div>}
+      {info && (
+        <div style={{ color: '#8b949e', marginBottom: '12px' }}>
+          {info} <a href={loginHref} style={{ color: '#58a6ff' }}>Sign in</a>
+        </div>
+      )}
+      {preview && (
+        <form onSubmit={accept} style={{ border: '1px solid #30363d', borderRadius: '6px', padding: '16px' }}>
+          <p style={{ color: '#c9d1d9', fontSize: '14px', marginTop: 0 }}>{describe(preview.invitation)}.</p>
+          {needsUsername && (
+            <label style={{ display: 'block', color: '#8b949e', fontSize: '13px', marginBottom: '12px' }}>
+              Choose a username for {preview.invitation.email}
+              <input
+                value={username}
+                onInput={(e: any) => setUsername(e.currentTarget.value)}
+                required
+                style={{ display: 'block', width: '100%', marginTop: '6px', padding: '8px', background: '#0d1117', color: '#c9d1d9', border: '1px solid #30363d', borderRadius: '6px', boxSizing: 'border-box' }}
+              />
+            </label>
+          )}
+          <div style={{ display: 'flex', gap: '8px' }}>
+            <button type="submit" disabled={submitting} style={{ ...buttonStyle, background: '#238636', color: '#fff' }}>
+              {needsUsername ? 'Create account and accept' : 'Accept'}
+            </button>
+            <button type="button" disabled={submitting} onClick={decline} style={{ ...buttonStyle, background: '#21262d', color: '#c9d1d9', border: '1px solid #30363d' }}>
+              Decline
+            </button>
+          </div>
+        </form>
+      )}
+    </div>
+  );
+}
@@ -2,13 +2,21 @@ import { useState, useEffect } from 'preact/hooks';
 import {
   requestMagicLink,
   verifyMagicLink,
+  verifyTwoFactor,
   beginWebAuthnLogin,
+  beginOIDCLogin,
+  completeOIDCLogin,
   finishWebAuthnLogin,
   getAuthCapabilities,
   setToken,
+  type AuthResponse,
+  type OIDCProvider,
 } from '../api/client';
 import { browserSupportsPasskeys, getPasskeyAssertion } from '../lib/webauthn';
 
+// Where to go after a provider sign-in, kept across the redirect.
+const oidcReturnKey = 'gothub_oidc_return_to';
+
 interface Props {
   path?: string;
 }
@@ -19,6 +27,9 @@ export function LoginView({ path }: Props) {
   const [magicToken, setMagicToken] = useState('');
   const [magicSent, setMagicSent] = useState(false);
   const [passkeyEnabled, setPasskeyEnabled] = useState(true);
+  const [oidcProviders, setOIDCProviders] = useState<OIDCProvider[]>([]);
+  const [twoFactorChallenge, setTwoFactorChallenge] = useState('');
+  const [twoFactorCode, setTwoFactorCode] = useState('');
   const [error, setError] = useState('');
   const [info, setInfo] = useState('');
   const [submitting, setSubmitting] = useState(false);
@@ -27,20 +38,86 @@ export function LoginView({ path }: Props) {
 
   useEffect(() => {
     getAuthCapabilities()
-      .then((caps) => setPasskeyEnabled(!!caps.passkey_enabled))
+      .then((caps) => {
+        setPasskeyEnabled(!!caps.passkey_enabled);
+        setOIDCProviders(caps.oidc_providers || []);
+      })
       .catch(() => setPasskeyEnabled(true));
   }, []);
 
+  // Links in sign-in emails land here with ?magic_token=...
+  useEffect(() => {
+    const linkToken = new URLSearchParams(window.location.search).get('magic_token');
+    if (!linkToken) return;
+    setSubmitting(true);
+    verifyMagicLink(linkToken)
+      .then(handleFirstFactor)
+      .catch((err: any) => {
+        setMagicSent(true);
+        setError(err.message || 'Magic link is invalid or expired');
+      })
+      .finally(() => setSubmitting(false));
+  }, []);
+
+  // Providers redirect back to /login/oidc/callback?code=...&state=...
+  useEffect(() => {
+    if (window.location.pathname !== '/login/oidc/callback') return;
+    const params = new URLSearchParams(window.location.search);
+    const providerError = params.get('error_description') || params.get('error');
+    if (providerError) {
+      setError(providerError);
+      return;
+    }
+    const state = params.get('state');
+    const code = params.get('code');
+    if (!state || !code) return;
+    setSubmitting(true);
+    completeOIDCLogin(state, code)
+      .then(handleFirstFactor)
+      .catch((err: any) => setError(err.message || 'Single sign-on failed'))
+      .finally(() => setSubmitting(false));
+  }, []);
+
   const sessionExpired = typeof window !== 'undefined' &&
     new URLSearchParams(window.location.search).get('session') === 'expired';
 
   const completeAuth = (token: string) => {
     setToken(token);
     const params = new URLSearchParams(window.location.search);
-    const returnTo = params.get('returnTo') || '/';
+    const returnTo = params.get('returnTo') || sessionStorage.getItem(oidcReturnKey) || '/';
+    sessionStorage.removeItem(oidcReturnKey);
     window.location.assign(returnTo.startsWith('/') && !returnTo.startsWith('//') ? returnTo : '/');
   };
 
+  // Accounts with an authenticator app answer a challenge before getting a
+  // token.
+  const handleFirstFactor = (res: AuthResponse) => {
+    if (res.two_factor_required && res.challenge) {
+      setTwoFactorChallenge(res.challenge);
+      setInfo('Enter the code from your authenticator app, or a recovery code.');
+      return;
+    }
+    if (res.token) completeAuth(res.token);
+  };
+
+  const submitTwoFactor = async (e: Event) => {
+    e.preventDefault();
+    setError(''); setInfo(''); setSubmitting(true);
+    try {
+      const res = await verifyTwoFactor(twoFactorChallenge, twoFactorCode);
+      if (res.token) completeAuth(res.token);
+    } catch (err: any) {
+      setTwoFactorCode('');
+      if (err.data?.challenge) {
+        setTwoFactorChallenge(err.data.challenge);
+      } else {
+        setTwoFactorChallenge('');
+        setMagicSent(false);
+      }
+      setError(err.message || 'Invalid code');
+    } finally { setSubmitting(false); }
+  };
+
   const submitPasskey = async (e: Event) => {
     e.preventDefault();
     setError(''); setInfo(''); setSubmitting(true);
@@ -54,14 +131,26 @@ export function LoginView({ path }: Props) {
     } finally { setSubmitting(false); }
   };
 
+  const startOIDC = async (provider: string) => {
+    setError(''); setInfo(''); setSubmitting(true);
+    try {
+      const returnTo = new URLSearchParams(window.location.search).get('returnTo');
+      if (returnTo) sessionStorage.setItem(oidcReturnKey, returnTo);
+      const res = await beginOIDCLogin(provider);
+      window.location.assign(res.authorization_url);
+    } catch (err: any) {
+      setError(err.message || 'Single sign-on is unavailable');
+      setSubmitting(false);
+    }
+  };
+
   const submitMagicRequest = async (e: Event) => {
     e.preventDefault();
     setError(''); setInfo(''); setSubmitting(true);
     try {
-      const res = await requestMagicLink(email);
+      await requestMagicLink(email);
       setMagicSent(true);
-      if (res.token) setMagicToken(res.token);
-      setInfo(res.token ? 'Magic link token generated (dev mode). Verify below.' : 'Check your inbox for the magic link.');
+      setInfo('Check your inbox for the magic link, or paste the code from the email below.');
     } catch (err: any) {
       setError(err.message);
     } finally { setSubmitting(false); }
@@ -72,7 +161,7 @@ export function LoginView({ path }: Props) {
     setError(''); setInfo(''); setSubmitting(true);
     try {
       const res = await verifyMagicLink(magicToken);
-      completeAuth(res.token);
+      handleFirstFactor(res);
     } catch (err: any) {
       setError(err.message);
     } finally { setSubmitting(false); }
@@ -90,6 +179,28 @@ export function LoginView({ path }: Props) {
       {info && <div style={{ color: '#3fb950', marginBottom: '16px', padding: '12px', background: '#132a1d', border: '1px solid #3fb950', borderRadius: '6px' }}>{info}</div>}
       {error && <div style={{ color: '#f85149', marginBottom: '16px', padding: '12px', background: '#1c1214', border: '1px solid #f85149', borderRadius: '6px' }}>{error}</div>}
 
+      {twoFactorChallenge && (
+        <form onSubmit={submitTwoFactor} style={{ display: 'flex', flexDirection: 'column', gap: '10px', marginBottom: '14px' }}>
+          <input value={twoFactorCode} onInput={(e: any) => setTwoFactorCode(e.target.value)} placeholder="Authentication code"
+            autoComplete="one-time-code" autoFocus style={inputStyle} />
+          <button type="submit" disabled={submitting || !twoFactorCode}
+            style={{ ...btnPrimary, opacity: submitting || !twoFactorCode ? 0.6 : 1 }}>
+            Verify code
+          </button>
+        </form>
+      )}
+
+      {oidcProviders.length > 0 && (
+        <div style={{ display: 'flex', flexDirection: 'column', gap: '10px', marginBottom: '14px', paddingBottom: '14px', borderBottom: '1px solid #30363d' }}>
+          {oidcProviders.map((p) => (
+            <button key={p.name} type="button" disabled={submitting} onClick={() => startOIDC(p.name)}
+              style={{ ...btnSecondary, opacity: submitting ? 0.6 : 1 }}>
+              Sign in with {p.display_name}
+            </button>
+          ))}
+        </div>
+      )}
+
       <form onSubmit={submitPasskey} style={{ display: 'flex', flexDirection: 'column', gap: '10px' }}>
         <input value={username} onInput={(e: any) => setUsername(e.target.value)} placeholder="Username" style={inputStyle} />
         <button type="submit" disabled={submitting || !username || !passkeysAvailable}
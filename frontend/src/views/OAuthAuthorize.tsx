@@ -0,0 +1,126 @@
+import { useState, useEffect } from 'preact/hooks';
+import { getToken, getOAuthConsent, decideOAuthConsent, type OAuthConsent } from '../api/client';
+
+interface Props {
+  path?: string;
+}
+
+const scopeDescriptions: Record<string, string> = {
+  'repo:read': 'Read your repositories',
+  'repo:write': 'Push to and manage your repositories',
+  issues: 'Read and write issues and pull requests',
+  'admin:repo': 'Administer your repositories',
+  'admin:org': 'Administer your organizations',
+};
+
+// The authorization request parameters forwarded to the API unchanged.
+const forwardedParams = ['client_id', 'redirect_uri', 'scope', 'state', 'code_challenge', 'code_challenge_method'];
+
+export function OAuthAuthorizeView({ path }: Props) {
+  const [consent, setConsent] = useState<OAuthConsent | null>(null);
+  const [error, setError] = useState('');
+  const [submitting, setSubmitting] = useState(false);
+
+  useEffect(() => {
+    if (!getToken()) {
+      const returnTo = `${window.location.pathname}${window.location.search}`;
+      window.location.assign(`/login?returnTo=${encodeURIComponent(returnTo)}`);
+      return;
+    }
+    getOAuthConsent(window.location.search.replace(/^\?/, ''))
+      .then(setConsent)
+      .catch((e: any) => setError(e.message || 'Invalid authorization request'));
+  }, []);
+
+  const decide = async (approve: boolean) => {
+    const query = new URLSearchParams(window.location.search);
+    const params: Record<string, string> = {};
+    for (const key of forwardedParams) {
+      const value = query.get(key);
+      if (value) params[key] = value;
+    }
+    setSubmitting(true);
+    setError('');
+    try {
+      const { redirect_url } = await decideOAuthConsent(params, approve);
+      window.location.assign(redirect_url);
+    } catch (err: any) {
+      setError(err.message || 'Failed to authorize app');
+      setSubmitting(false);
+    }
+  };
+
+  if (error && !consent) {
+    return (
+      <div style={{ maxWidth: '480px', margin: '60px auto', textAlign: 'center' }}>
+        <h1 style={{ fontSize: '20px', color: '#f0f6fc', marginBottom: '12px' }}>Authorization failed</h1>
+        <p style={{ color: '#f85149', fontSize: '14px' }}>{error}</p>
+      </div>
+    );
+  }
+
+  if (!consent) {
+    return <div style={{ color: '#8b949e', textAlign: 'center', marginTop: '60px' }}>Loading...</div>;
+  }
+
+  return (
+    <div style={{ maxWidth: '480px', margin: '60px auto' }}>
+      <div style={{ border: '1px solid #30363d', borderRadius: '6px', padding: '24px', background: '#161b22' }}>
+        <h1 style={{ fontSize: '20px', color: '#f0f6fc', margin: '0 0 8px 0' }}>
+          Authorize {consent.app.name}
+        </h1>
+        {consent.app.homepage_url && (
+          <a href={consent.app.homepage_url} style={{ color: '#58a6ff', fontSize: '13px', textDecoration: 'none' }}>
+            {consent.app.homepage_url}
+          </a>
+        )}
+        <p style={{ color: '#c9d1d9', fontSize: '14px', margin: '16px 0 8px 0' }}>This app will be able to:</p>
+        <ul style={{ color: '#c9d1d9', fontSize: '14px', margin: '0 0 16px 0', paddingLeft: '20px' }}>
+          {consent.scopes.map((scope) => (
+            <li key={scope} style={{ marginBottom: '4px' }}>
+              {scopeDescriptions[scope] || scope}
+            </li>
+          ))}
+        </ul>
+        <p style={{ color: '#8b949e', fontSize: '12px', margin: '0 0 16px 0' }}>
+          You will be sent to {new URL(consent.redirect_uri).host}. You can revoke access at any time from your settings.
+        </p>
+        {error && <div style={{ color: '#f85149', marginBottom: '12px', fontSize: '13px' }}>{error}</div>}
+        <div style={{ display: 'flex', gap: '8px' }}>
+          <button
+            onClick={() => decide(true)}
+            disabled={submitting}
+            style={{
+              background: '#238636',
+              color: '#fff',
+              border: 'none',
+              padding: '8px 16px',
+              borderRadius: '6px',
+              cursor: submitting ? 'not-allowed' : 'pointer',
+              fontWeight: 'bold',
+              fontSize: '13px',
+              opacity: submitting ? 0.6 : 1,
+            }}
+          >
+            Authorize
+          </button>
+          <button
+            onClick={() => decide(false)}
+            disabled={submitting}
+            style={{
+              background: '#21262d',
+              color: '#c9d1d9',
+              border: '1px solid #30363d',
+              padding: '8px 16px',
+              borderRadius: '6px',
+              cursor: submitting ? 'not-allowed' : 'pointer',
+              fontSize: '13px',
+            }}
+          >
+            Cancel
+          </button>
+        </div>
+      </div>
+    </div>
+  );
+}
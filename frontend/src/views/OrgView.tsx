@@ -1,5 +1,33 @@
 import { useState, useEffect } from 'preact/hooks';
-import { getOrg, listOrgMembers, listOrgRepos, addOrgMember, removeOrgMember, deleteOrg, getToken } from '../api/client';
+import {
+  getOrg,
+  listOrgMembers,
+  listOrgRepos,
+  addOrgMember,
+  inviteOrgMemberByEmail,
+  listOrgInvitations,
+  revokeOrgInvitation,
+  removeOrgMember,
+  deleteOrg,
+  getOrgSecurity,
+  updateOrgSecurity,
+  updateOrgDefaultRepoPermission,
+  listTeams,
+  createTeam,
+  deleteTeam,
+  listTeamMembers,
+  addTeamMember,
+  removeTeamMember,
+  listTeamRepos,
+  setTeamRepo,
+  removeTeamRepo,
+  getToken,
+  type Invitation,
+  type OrgSecurity,
+  type Team,
+  type TeamMember,
+  type TeamRepo,
+} from '../api/client';
 
 interface Props {
   org?: string;
@@ -17,6 +45,11 @@ export function OrgDetailView({ org }: Props) {
   const [newRole, setNewRole] = useState('member');
   const [addingMember, setAddingMember] = useState(false);
   const [memberError, setMemberError] = useState('');
+  const [invitations, setInvitations] = useState<Invitation[] | null>(null);
+
+  // Security settings; only owners can load them
+  const [security, setSecurity] = useState<OrgSecurity | null>(null);
+  const [securityError, setSecurityError] = useState('');
 
   // Delete org state
   const [confirmName, setConfirmName] = useState('');
@@ -29,26 +62,64 @@ export function OrgDetailView({ org }: Props) {
     getOrg(org).then(setOrgInfo).catch(e => setError(e.message));
     listOrgRepos(org).then(setRepos).catch(e => setError(e.message || 'failed to load repositories'));
     listOrgMembers(org).then(setMembers).catch(e => setError(e.message || 'failed to load members'));
+    if (loggedIn) getOrgSecurity(org).then(setSecurity).catch(() => setSecurity(null));
+    if (loggedIn) listOrgInvitations(org).then(setInvitations).catch(() => setInvitations(null));
   }, [org]);
 
+  const handleToggleTwoFactor = async (requireTwoFactor: boolean) => {
+    if (!org) return;
+    setSecurityError('');
+    try {
+      setSecurity(await updateOrgSecurity(org, requireTwoFactor));
+    } catch (err: any) {
+      setSecurityError(err.message || 'Failed to update security settings');
+    }
+  };
+
+  const handleDefaultPermission = async (permission: string) => {
+    if (!org) return;
+    setSecurityError('');
+    try {
+      setOrgInfo(await updateOrgDefaultRepoPermission(org, permission));
+    } catch (err: any) {
+      setSecurityError(err.message || 'Failed to update member permission');
+    }
+  };
+
+  // Members join once they accept; addresses without an account get an
+  // emailed invitation.
   const handleAddMember = async (e: Event) => {
     e.preventDefault();
-    if (!org || !newUsername.trim()) return;
+    const invitee = newUsername.trim();
+    if (!org || !invitee) return;
     setAddingMember(true);
     setMemberError('');
     try {
-      await addOrgMember(org, newUsername.trim(), newRole);
-      const updated = await listOrgMembers(org);
-      setMembers(updated);
+      if (invitee.includes('@')) {
+        await inviteOrgMemberByEmail(org, invitee, newRole);
+      } else {
+        await addOrgMember(org, invitee, newRole);
+      }
+      setInvitations(await listOrgInvitations(org));
       setNewUsername('');
       setNewRole('member');
     } catch (err: any) {
-      setMemberError(err.message || 'Failed to add member');
+      setMemberError(err.message || 'Failed to invite member');
     } finally {
       setAddingMember(false);
     }
   };
 
+  const handleRevokeInvitation = async (id: number) => {
+    if (!org) return;
+    try {
+      await revokeOrgInvitation(org, id);
+      setInvitations((invitations || []).filter(i => i.id !== id));
+    } catch (err: any) {
+      setMemberError(err.message || 'Failed to revoke invitation');
+    }
+  };
+
   const handleRemoveMember = async (username: string) => {
     if (!org) return;
     if (!confirm(`Remove member "${username}" from ${org}?`)) return;
@@ -213,7 +284,7 @@ export function OrgDetailView({ org }: Props) {
             <input
               value={newUsername}
               onInput={(e: any) => setNewUsername(e.target.value)}
-              placeholder="Username"
+              placeholder="Username or email"
               style={inputStyle}
             />
             <select
@@ -245,12 +316,95 @@ export function OrgDetailView({ org }: Props) {
                 fontSize: '14px',
               }}
             >
-              Add
+              Invite
             </button>
           </form>
         )}
+
+        {invitations && invitations.length > 0 && (
+          <div style={{ marginTop: '16px' }}>
+            <h3 style={{ fontSize: '14px', color: '#8b949e', marginBottom: '8px' }}>Pending invitations</h3>
+            <div style={{ border: '1px solid #30363d', borderRadius: '6px' }}>
+              {invitations.map((inv, idx) => (
+                <div
+                  key={inv.id}
+                  style={{
+                    display: 'flex',
+                    alignItems: 'center',
+                    justifyContent: 'space-between',
+                    padding: '10px 16px',
+                    borderTop: idx === 0 ? 'none' : '1px solid #21262d',
+                  }}
+                >
+                  <span style={{ color: '#c9d1d9', fontSize: '14px' }}>
+                    {inv.invitee_name || inv.email} &middot; {inv.role}
+                    <span style={{ color: '#8b949e', fontSize: '12px' }}> &middot; expires {new Date(inv.expires_at).toLocaleDateString()}</span>
+                  </span>
+                  <button
+                    onClick={() => handleRevokeInvitation(inv.id)}
+                    style={{
+                      background: 'transparent',
+                      color: '#f85149',
+                      border: '1px solid #f85149',
+                      borderRadius: '6px',
+                      padding: '4px 10px',
+                      cursor: 'pointer',
+                      fontSize: '12px',
+                    }}
+                  >
+                    Revoke
+                  </button>
+                </div>
+              ))}
+            </div>
+          </div>
+        )}
       </div>
 
+      {/* Security */}
+      {security && (
+        <div style={{ border: '1px solid #30363d', borderRadius: '6px', padding: '16px', marginTop: '32px' }}>
+          <h3 style={{ color: '#f0f6fc', fontSize: '16px', marginBottom: '12px' }}>Security</h3>
+          {securityError && <div style={{ color: '#f85149', marginBottom: '12px' }}>{securityError}</div>}
+          <label style={{ display: 'block', color: '#c9d1d9', fontSize: '14px' }}>
+            <input
+              type="checkbox"
+              checked={security.require_two_factor}
+              onChange={(e: any) => handleToggleTwoFactor(e.target.checked)}
+              style={{ marginRight: '8px' }}
+            />
+            Require two-factor authentication for all members
+          </label>
+          <p style={{ color: '#8b949e', fontSize: '13px', marginBottom: 0 }}>
+            Members need an authenticator app or a passkey. Until they add one they cannot access this organization's repositories.
+          </p>
+          {security.non_compliant_members.length > 0 && (
+            <p style={{ color: '#d29922', fontSize: '13px', marginBottom: 0 }}>
+              Without two-factor: {security.non_compliant_members.join(', ')}
+            </p>
+          )}
+          {orgInfo && (
+            <label style={{ display: 'block', color: '#c9d1d9', fontSize: '14px', marginTop: '16px' }}>
+              Base repository permission for members{' '}
+              <select
+                value={orgInfo.default_repo_permission || 'write'}
+                onChange={(e: any) => handleDefaultPermission(e.target.value)}
+                style={{ ...inputStyle, padding: '4px 8px', marginLeft: '8px' }}
+              >
+                <option value="none">None</option>
+                <option value="read">Read</option>
+                <option value="write">Write</option>
+              </select>
+            </label>
+          )}
+          <p style={{ color: '#8b949e', fontSize: '13px', marginBottom: 0 }}>
+            Teams can grant more on individual repositories. Owners always have full access.
+          </p>
+        </div>
+      )}
+
+      {loggedIn && org && <TeamsSection org={org} isOwner={!!security} />}
+
       {/* Danger zone */}
       {loggedIn && (
         <div style={{ border: '1px solid #f85149', borderRadius: '6px', padding: '16px', marginTop: '32px' }}>
@@ -288,6 +442,229 @@ export function OrgDetailView({ org }: Props) {
   );
 }
 
+function TeamsSection({ org, isOwner }: { org: string; isOwner: boolean }) {
+  const [teams, setTeams] = useState<Team[] | null>(null);
+  const [error, setError] = useState('');
+  const [name, setName] = useState('');
+  const [parent, setParent] = useState('');
+  const [selected, setSelected] = useState<string | null>(null);
+
+  const load = () => {
+    listTeams(org)
+      .then(setTeams)
+      .catch(() => setTeams(null));
+  };
+
+  useEffect(() => {
+    load();
+  }, [org]);
+
+  // Non-members cannot list teams; the section stays hidden for them.
+  if (!teams) return null;
+
+  const handleCreate = async (e: Event) => {
+    e.preventDefault();
+    if (!name.trim()) return;
+    setError('');
+    try {
+      await createTeam(org, { name: name.trim(), parent: parent || undefined });
+      setName('');
+      setParent('');
+      load();
+    } catch (err: any) {
+      setError(err.message || 'Failed to create team');
+    }
+  };
+
+  const handleDelete = async (team: string) => {
+    if (!confirm(`Delete team "${team}"? Its child teams move up to its parent.`)) return;
+    setError('');
+    try {
+      await deleteTeam(org, team);
+      if (selected === team) setSelected(null);
+      load();
+    } catch (err: any) {
+      setError(err.message || 'Failed to delete team');
+    }
+  };
+
+  const parentName = (team: Team) => teams.find((t) => t.id === team.parent_id)?.name;
+
+  return (
+    <div style={{ border: '1px solid #30363d', borderRadius: '6px', padding: '16px', marginTop: '32px' }}>
+      <h3 style={{ color: '#f0f6fc', fontSize: '16px', marginBottom: '12px' }}>Teams</h3>
+      {error && <div style={{ color: '#f85149', marginBottom: '12px' }}>{error}</div>}
+      {teams.length === 0 ? (
+        <p style={{ color: '#8b949e', fontSize: '14px' }}>No teams yet</p>
+      ) : (
+        teams.map((team) => (
+          <div key={team.id} style={{ borderBottom: '1px solid #21262d', padding: '8px 0' }}>
+            <div style={{ display: 'flex', justifyContent: 'space-between', alignItems: 'center' }}>
+              <button
+                onClick={() => setSelected(selected === team.name ? null : team.name)}
+                style={{ background: 'none', border: 'none', color: '#58a6ff', cursor: 'pointer', fontSize: '14px', padding: 0 }}
+              >
+                @{org}/{team.name}
+              </button>
+              <span style={{ color: '#8b949e', fontSize: '12px' }}>
+                {parentName(team) && <>in {parentName(team)} </>}
+                {isOwner && (
+                  <button
+                    onClick={() => handleDelete(team.name)}
+                    style={{ background: 'none', border: 'none', color: '#f85149', cursor: 'pointer', fontSize: '12px' }}
+                  >
+                    Delete
+                  </button>
+                )}
+              </span>
+            </div>
+            {selected === team.name && <TeamDetail org={org} team={team.name} isOwner={isOwner} />}
+          </div>
+        ))
+      )}
+      {isOwner && (
+        <form onSubmit={handleCreate} style={{ display: 'flex', gap: '8px', marginTop: '12px', flexWrap: 'wrap' }}>
+          <input value={name} onInput={(e: any) => setName(e.target.value)} placeholder="Team name" style={inputStyle} />
+          <select value={parent} onChange={(e: any) => setParent(e.target.value)} style={inputStyle}>
+            <option value="">No parent team</option>
+            {teams.map((t) => (
+              <option key={t.id} value={t.name}>
+                {t.name}
+              </option>
+            ))}
+          </select>
+          <button type="submit" disabled={!name.trim()} style={{ ...smallButtonStyle, opacity: name.trim() ? 1 : 0.6 }}>
+            Create team
+          </button>
+        </form>
+      )}
+    </div>
+  );
+}
+
+function TeamDetail({ org, team, isOwner }: { org: string; team: string; isOwner: boolean }) {
+  const [members, setMembers] = useState<TeamMember[]>([]);
+  const [repos, setRepos] = useState<TeamRepo[]>([]);
+  const [error, setError] = useState('');
+  const [username, setUsername] = useState('');
+  const [repoName, setRepoName] = useState('');
+  const [permission, setPermission] = useState('read');
+
+  const load = () => {
+    listTeamMembers(org, team).then(setMembers).catch((e: any) => setError(e.message));
+    listTeamRepos(org, team).then(setRepos).catch((e: any) => setError(e.message));
+  };
+
+  useEffect(() => {
+    load();
+  }, [org, team]);
+
+  const run = async (action: () => Promise<void>, fallback: string) => {
+    setError('');
+    try {
+      await action();
+      load();
+    } catch (err: any) {
+      setError(err.message || fallback);
+    }
+  };
+
+  return (
+    <div style={{ padding: '8px 0 0 16px', fontSize: '13px', color: '#c9d1d9' }}>
+      {error && <div style={{ color: '#f85149', marginBottom: '8px' }}>{error}</div>}
+      <div style={{ color: '#8b949e', marginBottom: '4px' }}>Members</div>
+      {members.length === 0 && <div style={{ color: '#8b949e' }}>No direct members</div>}
+      {members.map((m) => (
+        <div key={m.user_id} style={{ display: 'flex', justifyContent: 'space-between' }}>
+          <a href={`/${m.username}`} style={{ color: '#58a6ff', textDecoration: 'none' }}>
+            {m.username}
+          </a>
+          {isOwner && (
+            <button
+              onClick={() => run(() => removeTeamMember(org, team, m.username), 'Failed to remove member')}
+              style={{ background: 'none', border: 'none', color: '#f85149', cursor: 'pointer', fontSize: '12px' }}
+            >
+              Remove
+            </button>
+          )}
+        </div>
+      ))}
+      {isOwner && (
+        <form
+          onSubmit={(e: Event) => {
+            e.preventDefault();
+            if (!username.trim()) return;
+            run(async () => {
+              await addTeamMember(org, team, username.trim());
+              setUsername('');
+            }, 'Failed to add member');
+          }}
+          style={{ display: 'flex', gap: '8px', margin: '8px 0' }}
+        >
+          <input value={username} onInput={(e: any) => setUsername(e.target.value)} placeholder="Username" style={inputStyle} />
+          <button type="submit" style={smallButtonStyle}>
+            Add
+          </button>
+        </form>
+      )}
+      <div style={{ color: '#8b949e', margin: '12px 0 4px' }}>Repositories</div>
+      {repos.length === 0 && <div style={{ color: '#8b949e' }}>No repositories</div>}
+      {repos.map((r) => (
+        <div key={r.repo_id} style={{ display: 'flex', justifyContent: 'space-between' }}>
+          <a href={`/${org}/${r.repo_name}`} style={{ color: '#58a6ff', textDecoration: 'none' }}>
+            {r.repo_name}
+          </a>
+          <span>
+            {r.permission}
+            {isOwner && (
+              <button
+                onClick={() => run(() => removeTeamRepo(org, team, r.repo_name), 'Failed to remove repository')}
+                style={{ background: 'none', border: 'none', color: '#f85149', cursor: 'pointer', fontSize: '12px' }}
+              >
+                Remove
+              </button>
+            )}
+          </span>
+        </div>
+      ))}
+      {isOwner && (
+        <form
+          onSubmit={(e: Event) => {
+            e.preventDefault();
+            if (!repoName.trim()) return;
+            run(async () => {
+              await setTeamRepo(org, team, repoName.trim(), permission);
+              setRepoName('');
+            }, 'Failed to grant repository');
+          }}
+          style={{ display: 'flex', gap: '8px', margin: '8px 0' }}
+        >
+          <input value={repoName} onInput={(e: any) => setRepoName(e.target.value)} placeholder="Repository" style={inputStyle} />
+          <select value={permission} onChange={(e: any) => setPermission(e.target.value)} style={inputStyle}>
+            <option value="read">Read</option>
+            <option value="write">Write</option>
+            <option value="admin">Admin</option>
+          </select>
+          <button type="submit" style={smallButtonStyle}>
+            Grant
+          </button>
+        </form>
+      )}
+    </div>
+  );
+}
+
+const smallButtonStyle = {
+  background: '#238636',
+  color: '#fff',
+  border: 'none',
+  borderRadius: '6px',
+  padding: '8px 12px',
+  cursor: 'pointer',
+  fontWeight: 'bold',
+  fontSize: '13px',
+};
+
 const inputStyle = {
   background: '#0d1117',
   border: '1px solid #30363d',
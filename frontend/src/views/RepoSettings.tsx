@@ -2,9 +2,11 @@ import { useState, useEffect } from 'preact/hooks';
 import {
   getToken, getRepo, deleteRepo, listBranches,
   listCollaborators, addCollaborator, removeCollaborator,
+  inviteCollaboratorByEmail, listRepoInvitations, revokeRepoInvitation, type Invitation,
   listWebhooks, createWebhook, deleteWebhook, listWebhookDeliveries, pingWebhook, redeliverWebhookDelivery,
   getBranchProtection, setBranchProtection, deleteBranchProtection,
   listRepoRunnerTokens, createRepoRunnerToken, deleteRepoRunnerToken,
+  listRepoAuditEvents, type AuditEvent,
 } from '../api/client';
 
 interface Props {
@@ -13,7 +15,7 @@ interface Props {
   path?: string;
 }
 
-type Tab = 'general' | 'collaborators' | 'webhooks' | 'runners' | 'branch-protection';
+type Tab = 'general' | 'collaborators' | 'webhooks' | 'runners' | 'branch-protection' | 'audit';
 
 const TABS: { key: Tab; label: string }[] = [
   { key: 'general', label: 'General' },
@@ -21,6 +23,7 @@ const TABS: { key: Tab; label: string }[] = [
   { key: 'webhooks', label: 'Webhooks' },
   { key: 'runners', label: 'Runners' },
   { key: 'branch-protection', label: 'Branch Protection' },
+  { key: 'audit', label: 'Audit Log' },
 ];
 
 // ---------------------------------------------------------------------------
@@ -163,6 +166,7 @@ export function RepoSettingsView({ owner, repo }: Props) {
       {activeTab === 'webhooks' && <WebhooksTab owner={owner} repo={repo} />}
       {activeTab === 'runners' && <RunnersTab owner={owner} repo={repo} />}
       {activeTab === 'branch-protection' && <BranchProtectionTab owner={owner} repo={repo} />}
+      {activeTab === 'audit' && <AuditTab owner={owner} repo={repo} />}
     </div>
   );
 }
@@ -250,6 +254,7 @@ function GeneralTab({ owner, repo, repoInfo }: { owner: string; repo: string; re
 
 function CollaboratorsTab({ owner, repo }: { owner: string; repo: string }) {
   const [collaborators, setCollaborators] = useState<any[]>([]);
+  const [invitations, setInvitations] = useState<Invitation[]>([]);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState('');
 
@@ -262,6 +267,7 @@ function CollaboratorsTab({ owner, repo }: { owner: string; repo: string }) {
     try {
       const list = await listCollaborators(owner, repo);
       setCollaborators(list || []);
+      setInvitations(await listRepoInvitations(owner, repo) || []);
     } catch (e: any) {
       setError(e.message);
     }
@@ -272,20 +278,36 @@ function CollaboratorsTab({ owner, repo }: { owner: string; repo: string }) {
 
   const handleAdd = async (e: Event) => {
     e.preventDefault();
-    if (!newUsername.trim()) return;
+    const invitee = newUsername.trim();
+    if (!invitee) return;
     setAdding(true);
     setError('');
     try {
-      await addCollaborator(owner, repo, newUsername.trim(), newRole);
+      // Collaborators get access once they accept the invitation.
+      if (invitee.includes('@')) {
+        await inviteCollaboratorByEmail(owner, repo, invitee, newRole);
+      } else {
+        await addCollaborator(owner, repo, invitee, newRole);
+      }
       setNewUsername('');
       setNewRole('read');
       await fetchCollaborators();
     } catch (e: any) {
-      setError(e.message || 'Failed to add collaborator');
+      setError(e.message || 'Failed to invite collaborator');
     }
     setAdding(false);
   };
 
+  const handleRevoke = async (id: number) => {
+    setError('');
+    try {
+      await revokeRepoInvitation(owner, repo, id);
+      setInvitations(invitations.filter((i) => i.id !== id));
+    } catch (e: any) {
+      setError(e.message || 'Failed to revoke invitation');
+    }
+  };
+
   const handleRemove = async (username: string) => {
     const confirmed = window.confirm(`Remove collaborator "${username}"?`);
     if (!confirmed) return;
@@ -321,15 +343,15 @@ function CollaboratorsTab({ owner, repo }: { owner: string; repo: string }) {
 
       {/* Add collaborator form */}
       <div style={sectionBox}>
-        <h3 style={{ color: colors.heading, fontSize: '16px', marginTop: '0', marginBottom: '16px' }}>Add collaborator</h3>
+        <h3 style={{ color: colors.heading, fontSize: '16px', marginTop: '0', marginBottom: '16px' }}>Invite collaborator</h3>
         <form onSubmit={handleAdd} style={{ display: 'flex', gap: '8px', flexWrap: 'wrap', alignItems: 'flex-end' }}>
           <div style={{ flex: '1', minWidth: '200px' }}>
-            <label style={labelStyle}>Username</label>
+            <label style={labelStyle}>Username or email</label>
             <input
               type="text"
               value={newUsername}
               onInput={(e: any) => setNewUsername(e.target.value)}
-              placeholder="username"
+              placeholder="username or name@example.com"
               style={{ ...inputStyle, width: '100%', boxSizing: 'border-box' as any }}
             />
           </div>
@@ -346,7 +368,7 @@ function CollaboratorsTab({ owner, repo }: { owner: string; repo: string }) {
             </select>
           </div>
           <button type="submit" disabled={adding || !newUsername.trim()} style={{ ...btnPrimary, opacity: adding || !newUsername.trim() ? '0.6' : '1' }}>
-            {adding ? 'Adding...' : 'Add'}
+            {adding ? 'Inviting...' : 'Invite'}
           </button>
         </form>
       </div>
@@ -384,6 +406,38 @@ function CollaboratorsTab({ owner, repo }: { owner: string; repo: string }) {
           ))
         )}
       </div>
+
+      {invitations.length > 0 && (
+        <div style={sectionBox}>
+          <h3 style={{ color: colors.heading, fontSize: '16px', marginTop: '0', marginBottom: '16px' }}>Pending invitations</h3>
+          {invitations.map((inv, idx) => (
+            <div
+              key={inv.id}
+              style={{
+                display: 'flex',
+                alignItems: 'center',
+                justifyContent: 'space-between',
+                padding: '10px 0',
+                borderTop: idx === 0 ? 'none' : `1px solid ${colors.border}`,
+              }}
+            >
+              <div style={{ display: 'flex', alignItems: 'center' }}>
+                <span style={{ color: colors.text, fontSize: '14px', fontWeight: 'bold' }}>{inv.invitee_name || inv.email}</span>
+                {roleBadge(inv.role)}
+                <span style={{ color: colors.muted, fontSize: '12px', marginLeft: '8px' }}>
+                  expires {new Date(inv.expires_at).toLocaleDateString()}
+                </span>
+              </div>
+              <button
+                onClick={() => handleRevoke(inv.id)}
+                style={{ ...btnDanger, padding: '4px 10px', fontSize: '12px' }}
+              >
+                Revoke
+              </button>
+            </div>
+          ))}
+        </div>
+      )}
     </div>
   );
 }
@@ -962,3 +1016,73 @@ function BranchProtectionTab({ owner, repo }: { owner: string; repo: string }) {
     </div>
   );
 }
+
+// ---------------------------------------------------------------------------
+// Tab 6: Audit Log
+// ---------------------------------------------------------------------------
+
+function describeChange(event: AuditEvent) {
+  const keys = new Set([...Object.keys(event.before || {}), ...Object.keys(event.after || {})]);
+  return Array.from(keys)
+    .map((k) => `${k}: ${JSON.stringify(event.before?.[k] ?? null)} → ${JSON.stringify(event.after?.[k] ?? null)}`)
+    .join(', ');
+}
+
+function AuditTab({ owner, repo }: { owner: string; repo: string }) {
+  const [events, setEvents] = useState<AuditEvent[]>([]);
+  const [loading, setLoading] = useState(true);
+  const [hasMore, setHasMore] = useState(false);
+  const [error, setError] = useState('');
+
+  const load = async (before?: number) => {
+    setLoading(true);
+    setError('');
+    try {
+      const page = await listRepoAuditEvents(owner, repo, before);
+      const list = Array.isArray(page) ? page : [];
+      setEvents(before ? [...events, ...list] : list);
+      setHasMore(list.length === 50);
+    } catch (e: any) {
+      setError(e?.message || 'Failed to load audit log');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  useEffect(() => { load(); }, [owner, repo]);
+
+  return (
+    <div>
+      <h3 style={{ color: colors.heading, fontSize: '16px', marginTop: '0', marginBottom: '16px' }}>Audit log</h3>
+      {error && <div style={{ color: colors.red, fontSize: '14px', marginBottom: '12px' }}>{error}</div>}
+      {!loading && events.length === 0 && !error && (
+        <div style={{ ...sectionBox, color: colors.muted, fontSize: '14px' }}>No security events recorded yet.</div>
+      )}
+      {events.length > 0 && (
+        <div style={{ border: `1px solid ${colors.border}`, borderRadius: '6px' }}>
+          {events.map((event, idx) => (
+            <div key={event.id} style={{ padding: '12px 16px', borderTop: idx === 0 ? 'none' : `1px solid ${colors.border}` }}>
+              <div style={{ display: 'flex', justifyContent: 'space-between', gap: '12px' }}>
+                <span style={{ color: colors.heading, fontSize: '14px' }}>
+                  <strong>{event.actor_name || 'system'}</strong> <code>{event.action}</code> {event.target}
+                </span>
+                <span style={{ color: colors.muted, fontSize: '12px', whiteSpace: 'nowrap' }}>
+                  {new Date(event.created_at).toLocaleString()}
+                </span>
+              </div>
+              <div style={{ color: colors.muted, fontSize: '12px', marginTop: '4px' }}>
+                {[event.ip, event.request_id && `request ${event.request_id}`, describeChange(event)].filter(Boolean).join(' · ')}
+              </div>
+            </div>
+          ))}
+        </div>
+      )}
+      {loading && <div style={{ color: colors.muted, fontSize: '14px', marginTop: '12px' }}>Loading audit log...</div>}
+      {hasMore && !loading && (
+        <button onClick={() => load(events[events.length - 1].id)} style={{ ...btnSecondary, marginTop: '12px' }}>
+          Load more
+        </button>
+      )}
+    </div>
+  );
+}
@@ -9,6 +9,24 @@ import {
   createOrg,
   beginWebAuthnRegistration,
   finishWebAuthnRegistration,
+  getNotificationSettings,
+  updateNotificationSettings,
+  getTwoFactorStatus,
+  beginTOTPEnrollment,
+  confirmTOTPEnrollment,
+  disableTOTP,
+  regenerateRecoveryCodes,
+  listOAuthApps,
+  createOAuthApp,
+  deleteOAuthApp,
+  resetOAuthAppSecret,
+  listOAuthAuthorizations,
+  revokeOAuthAuthorization,
+  type EmailFrequency,
+  type OAuthApp,
+  type OAuthAuthorization,
+  type TOTPEnrollment,
+  type TwoFactorStatus,
 } from '../api/client';
 import { browserSupportsPasskeys, createPasskeyCredential } from '../lib/webauthn';
 
@@ -31,9 +49,13 @@ export function SettingsView({ path }: Props) {
     <div style={{ maxWidth: '800px', margin: '0 auto' }}>
       <h1 style={{ fontSize: '24px', color: '#f0f6fc', marginBottom: '24px' }}>Settings</h1>
       <ProfileSection />
+      <EmailSection />
       <PasskeysSection />
+      <TwoFactorSection />
       <SSHKeysSection />
       <OrganizationsSection />
+      <AuthorizedAppsSection />
+      <OAuthAppsSection />
     </div>
   );
 }
@@ -290,6 +312,176 @@ function PasskeysSection() {
   );
 }
 
+const emailFrequencyLabels: Record<EmailFrequency, string> = {
+  instant: 'Email each notification as it happens',
+  daily: 'Daily digest',
+  weekly: 'Weekly digest',
+};
+
+function TwoFactorSection() {
+  const [status, setStatus] = useState<TwoFactorStatus | null>(null);
+  const [enrollment, setEnrollment] = useState<TOTPEnrollment | null>(null);
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+  const [code, setCode] = useState('');
+  const [error, setError] = useState('');
+  const [busy, setBusy] = useState(false);
+
+  const load = () => getTwoFactorStatus().then(setStatus).catch((e: any) => setError(e.message));
+
+  useEffect(() => {
+    load();
+  }, []);
+
+  const run = async (action: () => Promise<void>) => {
+    setBusy(true);
+    setError('');
+    try {
+      await action();
+      setCode('');
+      await load();
+    } catch (err: any) {
+      setError(err.message || 'Two-factor update failed');
+    } finally {
+      setBusy(false);
+    }
+  };
+
+  const handleBegin = () => run(async () => {
+    setRecoveryCodes([]);
+    setEnrollment(await beginTOTPEnrollment());
+  });
+  const handleConfirm = (e: Event) => {
+    e.preventDefault();
+    run(async () => {
+      const res = await confirmTOTPEnrollment(code.trim());
+      setEnrollment(null);
+      setRecoveryCodes(res.recovery_codes);
+    });
+  };
+  const handleRegenerate = () => run(async () => {
+    const res = await regenerateRecoveryCodes(code.trim());
+    setRecoveryCodes(res.recovery_codes);
+  });
+  const handleDisable = () => run(async () => {
+    await disableTOTP(code.trim());
+    setRecoveryCodes([]);
+  });
+
+  return (
+    <div style={{ marginBottom: '32px' }}>
+      <h2 style={{ fontSize: '20px', color: '#f0f6fc', marginBottom: '12px' }}>Two-factor authentication</h2>
+      {error && <div style={{ color: '#f85149', marginBottom: '12px' }}>{error}</div>}
+      <div style={{ border: '1px solid #30363d', borderRadius: '6px', padding: '16px', background: '#161b22' }}>
+        {status === null ? (
+          <div style={{ color: '#8b949e' }}>Loading...</div>
+        ) : enrollment ? (
+          <form onSubmit={handleConfirm} style={{ display: 'flex', flexDirection: 'column', gap: '10px' }}>
+            <p style={{ margin: 0, color: '#c9d1d9', fontSize: '14px' }}>
+              Add this account to your authenticator app, then enter the code it shows.
+            </p>
+            <code style={{ color: '#c9d1d9', fontSize: '13px', wordBreak: 'break-all' }}>{enrollment.provisioning_uri}</code>
+            <div style={{ color: '#8b949e', fontSize: '13px' }}>Setup key: <code>{enrollment.secret}</code></div>
+            <input value={code} onInput={(e: any) => setCode(e.target.value)} placeholder="6-digit code" autoComplete="one-time-code" style={inputStyle} />
+            <button type="submit" disabled={busy || !code.trim()} style={{ ...btnPrimary, opacity: busy || !code.trim() ? 0.6 : 1 }}>
+              Enable authenticator app
+            </button>
+          </form>
+        ) : status.totp_enabled ? (
+          <div style={{ display: 'flex', flexDirection: 'column', gap: '10px' }}>
+            <div style={{ color: '#3fb950', fontSize: '14px' }}>
+              Authenticator app enabled. {status.recovery_codes_remaining} recovery codes left.
+            </div>
+            <input value={code} onInput={(e: any) => setCode(e.target.value)} placeholder="Authentication or recovery code" style={inputStyle} />
+            <div style={{ display: 'flex', gap: '8px' }}>
+              <button onClick={handleRegenerate} disabled={busy || !code.trim()} style={{ ...btnPrimary, opacity: busy || !code.trim() ? 0.6 : 1 }}>
+                New recovery codes
+              </button>
+              <button onClick={handleDisable} disabled={busy || !code.trim()} style={{ ...btnDanger, opacity: busy || !code.trim() ? 0.6 : 1 }}>
+                Disable
+              </button>
+            </div>
+          </div>
+        ) : (
+          <div style={{ display: 'flex', flexDirection: 'column', gap: '10px' }}>
+            <p style={{ margin: 0, color: '#8b949e', fontSize: '13px' }}>
+              {status.passkey_enabled
+                ? 'Your passkey already counts as a second factor. An authenticator app also protects magic link and SSH sign-ins.'
+                : 'Protect magic link and SSH sign-ins with codes from an authenticator app.'}
+            </p>
+            <button onClick={handleBegin} disabled={busy} style={{ ...btnPrimary, opacity: busy ? 0.6 : 1 }}>
+              Set up authenticator app
+            </button>
+          </div>
+        )}
+        {recoveryCodes.length > 0 && (
+          <div style={{ marginTop: '12px' }}>
+            <p style={{ color: '#d29922', fontSize: '13px' }}>
+              Save these recovery codes somewhere safe. Each works once, and they will not be shown again.
+            </p>
+            <pre style={{ color: '#c9d1d9', fontSize: '13px', background: '#0d1117', padding: '12px', borderRadius: '6px' }}>
+              {recoveryCodes.join('\n')}
+            </pre>
+          </div>
+        )}
+      </div>
+    </div>
+  );
+}
+
+function EmailSection() {
+  const [frequency, setFrequency] = useState<EmailFrequency | null>(null);
+  const [error, setError] = useState('');
+  const [saving, setSaving] = useState(false);
+
+  useEffect(() => {
+    getNotificationSettings()
+      .then((settings) => setFrequency(settings.email_frequency))
+      .catch((e: any) => setError(e.message));
+  }, []);
+
+  const handleChange = async (next: EmailFrequency) => {
+    setSaving(true);
+    setError('');
+    try {
+      const settings = await updateNotificationSettings(next);
+      setFrequency(settings.email_frequency);
+    } catch (err: any) {
+      setError(err.message || 'Failed to save email preference');
+    } finally {
+      setSaving(false);
+    }
+  };
+
+  return (
+    <div style={{ marginBottom: '32px' }}>
+      <h2 style={{ fontSize: '20px', color: '#f0f6fc', marginBottom: '12px' }}>Notification email</h2>
+      {error && <div style={{ color: '#f85149', marginBottom: '12px' }}>{error}</div>}
+      <div style={{ border: '1px solid #30363d', borderRadius: '6px', padding: '16px', background: '#161b22' }}>
+        {frequency === null ? (
+          <div style={{ color: '#8b949e' }}>Loading...</div>
+        ) : (
+          (Object.keys(emailFrequencyLabels) as EmailFrequency[]).map((option) => (
+            <label key={option} style={{ display: 'block', color: '#c9d1d9', fontSize: '14px', marginBottom: '8px' }}>
+              <input
+                type="radio"
+                name="email-frequency"
+                checked={frequency === option}
+                disabled={saving}
+                onChange={() => handleChange(option)}
+                style={{ marginRight: '8px' }}
+              />
+              {emailFrequencyLabels[option]}
+            </label>
+          ))
+        )}
+        <p style={{ marginBottom: 0, color: '#8b949e', fontSize: '13px' }}>
+          Digests group unread notifications by repository and include pull requests waiting for your review.
+        </p>
+      </div>
+    </div>
+  );
+}
+
 function OrganizationsSection() {
   const [orgs, setOrgs] = useState<any[]>([]);
   const [loading, setLoading] = useState(true);
@@ -416,6 +608,225 @@ function OrganizationsSection() {
   );
 }
 
+function AuthorizedAppsSection() {
+  const [auths, setAuths] = useState<OAuthAuthorization[]>([]);
+  const [loading, setLoading] = useState(true);
+  const [error, setError] = useState('');
+
+  const load = () => {
+    setLoading(true);
+    listOAuthAuthorizations()
+      .then(setAuths)
+      .catch((e: any) => setError(e.message))
+      .finally(() => setLoading(false));
+  };
+
+  useEffect(() => {
+    load();
+  }, []);
+
+  const handleRevoke = async (appId: number) => {
+    if (!confirm('Revoke access for this app? Its tokens stop working immediately.')) return;
+    setError('');
+    try {
+      await revokeOAuthAuthorization(appId);
+      load();
+    } catch (err: any) {
+      setError(err.message || 'Failed to revoke app');
+    }
+  };
+
+  return (
+    <div style={{ marginBottom: '32px' }}>
+      <h2 style={{ fontSize: '20px', color: '#f0f6fc', marginBottom: '12px' }}>Authorized apps</h2>
+      {error && <div style={{ color: '#f85149', marginBottom: '12px' }}>{error}</div>}
+      {loading ? (
+        <div style={{ color: '#8b949e' }}>Loading...</div>
+      ) : auths.length === 0 ? (
+        <div style={{ color: '#8b949e', padding: '16px', border: '1px solid #30363d', borderRadius: '6px', textAlign: 'center' }}>
+          No apps have access to your account
+        </div>
+      ) : (
+        <div style={{ border: '1px solid #30363d', borderRadius: '6px' }}>
+          {auths.map((a) => (
+            <div
+              key={a.app_id}
+              style={{ display: 'flex', justifyContent: 'space-between', alignItems: 'center', padding: '12px 16px', borderBottom: '1px solid #21262d' }}
+            >
+              <div>
+                <div style={{ color: '#f0f6fc', fontWeight: 'bold', fontSize: '14px' }}>{a.app_name}</div>
+                <div style={{ color: '#8b949e', fontSize: '12px', marginTop: '4px' }}>
+                  {a.scopes.join(', ')} &middot; authorized {new Date(a.created_at).toLocaleDateString()}
+                  {a.last_used_at && <> &middot; last used {new Date(a.last_used_at).toLocaleDateString()}</>}
+                </div>
+              </div>
+              <button onClick={() => handleRevoke(a.app_id)} style={btnDanger}>
+                Revoke
+              </button>
+            </div>
+          ))}
+        </div>
+      )}
+    </div>
+  );
+}
+
+function OAuthAppsSection() {
+  const [apps, setApps] = useState<OAuthApp[]>([]);
+  const [loading, setLoading] = useState(true);
+  const [error, setError] = useState('');
+  const [showCreate, setShowCreate] = useState(false);
+  const [name, setName] = useState('');
+  const [homepage, setHomepage] = useState('');
+  const [redirects, setRedirects] = useState('');
+  const [submitting, setSubmitting] = useState(false);
+  const [revealed, setRevealed] = useState<OAuthApp | null>(null);
+
+  const load = () => {
+    setLoading(true);
+    listOAuthApps()
+      .then(setApps)
+      .catch((e: any) => setError(e.message))
+      .finally(() => setLoading(false));
+  };
+
+  useEffect(() => {
+    load();
+  }, []);
+
+  const handleCreate = async (e: Event) => {
+    e.preventDefault();
+    const redirectURIs = redirects
+      .split('\n')
+      .map((line) => line.trim())
+      .filter(Boolean);
+    if (!name.trim() || redirectURIs.length === 0) return;
+    setSubmitting(true);
+    setError('');
+    try {
+      const app = await createOAuthApp({ name: name.trim(), homepage_url: homepage.trim(), redirect_uris: redirectURIs });
+      setRevealed(app);
+      setName('');
+      setHomepage('');
+      setRedirects('');
+      setShowCreate(false);
+      load();
+    } catch (err: any) {
+      setError(err.message || 'Failed to register app');
+    } finally {
+      setSubmitting(false);
+    }
+  };
+
+  const handleReset = async (id: number) => {
+    if (!confirm('Generate a new client secret? The current one stops working immediately.')) return;
+    setError('');
+    try {
+      setRevealed(await resetOAuthAppSecret(id));
+    } catch (err: any) {
+      setError(err.message || 'Failed to reset secret');
+    }
+  };
+
+  const handleDelete = async (id: number) => {
+    if (!confirm('Delete this app? Every token issued to it is revoked.')) return;
+    setError('');
+    try {
+      await deleteOAuthApp(id);
+      if (revealed?.id === id) setRevealed(null);
+      load();
+    } catch (err: any) {
+      setError(err.message || 'Failed to delete app');
+    }
+  };
+
+  return (
+    <div style={{ marginBottom: '32px' }}>
+      <div style={{ display: 'flex', justifyContent: 'space-between', alignItems: 'center', marginBottom: '12px' }}>
+        <h2 style={{ fontSize: '20px', color: '#f0f6fc', margin: 0 }}>OAuth apps</h2>
+        <button onClick={() => setShowCreate(!showCreate)} style={btnPrimary}>
+          {showCreate ? 'Cancel' : 'Register app'}
+        </button>
+      </div>
+
+      {error && <div style={{ color: '#f85149', marginBottom: '12px' }}>{error}</div>}
+
+      {revealed?.client_secret && (
+        <div style={{ border: '1px solid #238636', borderRadius: '6px', padding: '16px', marginBottom: '16px', background: '#161b22' }}>
+          <div style={{ color: '#c9d1d9', fontSize: '14px', marginBottom: '8px' }}>
+            Copy the client secret for <strong>{revealed.name}</strong> now. It will not be shown again.
+          </div>
+          <div style={{ color: '#8b949e', fontSize: '13px' }}>
+            Client ID: <code style={{ color: '#c9d1d9' }}>{revealed.client_id}</code>
+          </div>
+          <div style={{ color: '#8b949e', fontSize: '13px', marginTop: '4px' }}>
+            Client secret: <code style={{ color: '#c9d1d9' }}>{revealed.client_secret}</code>
+          </div>
+        </div>
+      )}
+
+      {showCreate && (
+        <div style={{ border: '1px solid #30363d', borderRadius: '6px', padding: '16px', marginBottom: '16px', background: '#161b22' }}>
+          <form onSubmit={handleCreate} style={{ display: 'flex', flexDirection: 'column', gap: '12px' }}>
+            <input value={name} onInput={(e: any) => setName(e.target.value)} placeholder="App name" style={inputStyle} />
+            <input
+              value={homepage}
+              onInput={(e: any) => setHomepage(e.target.value)}
+              placeholder="Homepage URL (optional)"
+              style={inputStyle}
+            />
+            <textarea
+              value={redirects}
+              onInput={(e: any) => setRedirects(e.target.value)}
+              placeholder="Redirect URIs, one per line"
+              rows={3}
+              style={{ ...inputStyle, fontFamily: 'monospace', resize: 'vertical' }}
+            />
+            <button
+              type="submit"
+              disabled={submitting || !name.trim() || !redirects.trim()}
+              style={{ ...btnPrimary, alignSelf: 'flex-start', opacity: submitting || !name.trim() || !redirects.trim() ? 0.6 : 1 }}
+            >
+              {submitting ? 'Registering...' : 'Register app'}
+            </button>
+          </form>
+        </div>
+      )}
+
+      {loading ? (
+        <div style={{ color: '#8b949e' }}>Loading...</div>
+      ) : apps.length === 0 ? (
+        <div style={{ color: '#8b949e', padding: '16px', border: '1px solid #30363d', borderRadius: '6px', textAlign: 'center' }}>
+          You have not registered any apps
+        </div>
+      ) : (
+        <div style={{ border: '1px solid #30363d', borderRadius: '6px' }}>
+          {apps.map((app) => (
+            <div
+              key={app.id}
+              style={{ display: 'flex', justifyContent: 'space-between', alignItems: 'center', padding: '12px 16px', borderBottom: '1px solid #21262d' }}
+            >
+              <div>
+                <div style={{ color: '#f0f6fc', fontWeight: 'bold', fontSize: '14px' }}>{app.name}</div>
+                <div style={{ color: '#8b949e', fontSize: '12px', marginTop: '4px', fontFamily: 'monospace' }}>{app.client_id}</div>
+                <div style={{ color: '#8b949e', fontSize: '12px', marginTop: '4px' }}>{app.redirect_uris.join(', ')}</div>
+              </div>
+              <div style={{ display: 'flex', gap: '8px' }}>
+                <button onClick={() => handleReset(app.id)} style={{ ...btnPrimary, background: '#21262d', border: '1px solid #30363d' }}>
+                  Reset secret
+                </button>
+                <button onClick={() => handleDelete(app.id)} style={btnDanger}>
+                  Delete
+                </button>
+              </div>
+            </div>
+          ))}
+        </div>
+      )}
+    </div>
+  );
+}
+
 const inputStyle = {
   background: '#0d1117',
   border: '1px solid #30363d',
@@ -424,3 +835,21 @@ const inputStyle = {
   color: '#c9d1d9',
   fontSize: '14px',
 };
+
+const btnPrimary = {
+  background: '#238636',
+  color: '#fff',
+  border: 'none',
+  padding: '8px 16px',
+  borderRadius: '6px',
+  cursor: 'pointer',
+  fontWeight: 'bold',
+  fontSize: '13px',
+};
+
+const btnDanger = {
+  ...btnPrimary,
+  background: '#21262d',
+  color: '#f85149',
+  border: '1px solid #f85149',
+};
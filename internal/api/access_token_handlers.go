@@ -0,0 +1,124 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/service"
+)
+
+type createAccessTokenRequest struct {
+	Name           string   `json:"name"`
+	Scopes         []string `json:"scopes"`
+	Repositories   []string `json:"repositories"` // "owner/repo"; empty allows every repo the user can reach
+	ExpiresInHours int      `json:"expires_in_hours"`
+}
+
+type createAccessTokenResponse struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Token       string     `json:"token"`
+	TokenPrefix string     `json:"token_prefix"`
+	Scopes      []string   `json:"scopes"`
+	RepoIDs     []int64    `json:"repo_ids,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (s *Server) handleCreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	var req createAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		jsonError(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInHours < 0 || req.ExpiresInHours > maxRunnerTokenLifetime {
+		jsonError(w, "expires_in_hours must be between 0 and 8760", http.StatusBadRequest)
+		return
+	}
+
+	repoIDs := make([]int64, 0, len(req.Repositories))
+	for _, fullName := range req.Repositories {
+		owner, name, ok := strings.Cut(strings.TrimSpace(fullName), "/")
+		if !ok || owner == "" || name == "" {
+			jsonError(w, "repositories must be owner/repo names", http.StatusBadRequest)
+			return
+		}
+		repo, err := s.repoSvc.Get(r.Context(), owner, name)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				jsonError(w, "repository not found: "+fullName, http.StatusNotFound)
+				return
+			}
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		allowed, err := s.userHasRepoAccess(r.Context(), repo, claims.UserID, false)
+		if err != nil {
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if !allowed && repo.IsPrivate {
+			jsonError(w, "repository not found: "+fullName, http.StatusNotFound)
+			return
+		}
+		repoIDs = append(repoIDs, repo.ID)
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInHours > 0 {
+		t := time.Now().UTC().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		expiresAt = &t
+	}
+	token, plain, err := s.accessTokenSvc.Create(r.Context(), claims.UserID, req.Name, req.Scopes, repoIDs, expiresAt)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTokenScope) {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusCreated, createAccessTokenResponse{
+		ID:          token.ID,
+		Name:        token.Name,
+		Token:       plain,
+		TokenPrefix: token.TokenPrefix,
+		Scopes:      token.Scopes,
+		RepoIDs:     token.RepoIDs,
+		ExpiresAt:   token.ExpiresAt,
+		CreatedAt:   token.CreatedAt,
+	})
+}
+
+func (s *Server) handleListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	tokens, err := s.accessTokenSvc.List(r.Context(), claims.UserID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, tokens)
+}
+
+func (s *Server) handleDeleteAccessToken(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	id, ok := parsePathPositiveInt64(w, r, "id", "token id")
+	if !ok {
+		return
+	}
+	if err := s.accessTokenSvc.Revoke(r.Context(), claims.UserID, id); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+	"github.com/odvcencio/gothub/internal/service"
+)
+
+type setAdminRequest struct {
+	IsAdmin bool `json:"is_admin"`
+}
+
+type setEntitlementRequest struct {
+	Active    *bool      `json:"active"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type transferRepoRequest struct {
+	NewOwner string `json:"new_owner"`
+}
+
+func (s *Server) handleAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	page, perPage := parsePagination(r, 50, 200)
+	users, err := s.adminSvc.ListUsers(r.Context(), r.URL.Query().Get("q"), page, perPage)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if users == nil {
+		users = []models.User{}
+	}
+	jsonResponse(w, http.StatusOK, users)
+}
+
+func (s *Server) handleAdminSuspendUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.adminTargetUser(w, r, "admins cannot suspend themselves")
+	if !ok {
+		return
+	}
+	if err := s.adminSvc.Suspend(r.Context(), user); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, user)
+}
+
+func (s *Server) handleAdminUnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.adminTargetUser(w, r, "")
+	if !ok {
+		return
+	}
+	if err := s.adminSvc.Unsuspend(r.Context(), user); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, user)
+}
+
+func (s *Server) handleAdminSetUserAdmin(w http.ResponseWriter, r *http.Request) {
+	var req setAdminRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	self := ""
+	if !req.IsAdmin {
+		self = "admins cannot revoke their own admin rights"
+	}
+	user, ok := s.adminTargetUser(w, r, self)
+	if !ok {
+		return
+	}
+	if err := s.adminSvc.SetAdmin(r.Context(), user, req.IsAdmin); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, user)
+}
+
+func (s *Server) handleAdminResetCredentials(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.adminTargetUser(w, r, "")
+	if !ok {
+		return
+	}
+	reset, err := s.adminSvc.ResetCredentials(r.Context(), user)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, reset)
+}
+
+func (s *Server) handleAdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.adminTargetUser(w, r, "admins cannot delete themselves")
+	if !ok {
+		return
+	}
+	if err := s.adminSvc.DeleteUser(r.Context(), user); err != nil {
+		if errors.Is(err, service.ErrUserOwnsRepositories) || errors.Is(err, service.ErrUserSoleOrgOwner) {
+			jsonError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAdminSetEntitlement(w http.ResponseWriter, r *http.Request) {
+	var req setEntitlementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	active := req.Active == nil || *req.Active
+	user, ok := s.adminTargetUser(w, r, "")
+	if !ok {
+		return
+	}
+	entitlement, err := s.adminSvc.SetEntitlement(r.Context(), user, r.PathValue("feature"), active, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownEntitlement) {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, entitlement)
+}
+
+func (s *Server) handleAdminTransferRepo(w http.ResponseWriter, r *http.Request) {
+	var req transferRepoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.NewOwner = strings.TrimSpace(req.NewOwner)
+	if req.NewOwner == "" {
+		jsonError(w, "new_owner is required", http.StatusBadRequest)
+		return
+	}
+	repo, ok := s.adminTargetRepo(w, r)
+	if !ok {
+		return
+	}
+	moved, err := s.repoSvc.Transfer(r.Context(), repo, req.NewOwner)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRepoOwnerNotFound):
+			jsonError(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrRepoNameTaken):
+			jsonError(w, err.Error(), http.StatusConflict)
+		default:
+			jsonError(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+	jsonResponse(w, http.StatusOK, moved)
+}
+
+func (s *Server) handleAdminDeleteRepo(w http.ResponseWriter, r *http.Request) {
+	repo, ok := s.adminTargetRepo(w, r)
+	if !ok {
+		return
+	}
+	if err := s.repoSvc.Delete(r.Context(), repo.ID); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	s.runWebhookAsync(r.Context(), "webhook repository deleted", []any{"repo_id", repo.ID}, func(ctx context.Context) error {
+		return s.webhookSvc.EmitRepositoryEvent(ctx, repo, models.WebhookActionDeleted, nil)
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAdminQueueStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.adminSvc.QueueStats(r.Context())
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if stats == nil {
+		stats = []database.QueueStats{}
+	}
+	jsonResponse(w, http.StatusOK, stats)
+}
+
+// adminTargetUser loads the user named in the path. When selfMessage is set
+// the action may not target the calling admin, and selfMessage explains why.
+func (s *Server) adminTargetUser(w http.ResponseWriter, r *http.Request, selfMessage string) (*models.User, bool) {
+	user, err := s.db.GetUserByUsername(r.Context(), strings.TrimSpace(r.PathValue("username")))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "user not found", http.StatusNotFound)
+			return nil, false
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if selfMessage != "" && user.ID == auth.GetClaims(r.Context()).UserID {
+		jsonError(w, selfMessage, http.StatusBadRequest)
+		return nil, false
+	}
+	return user, true
+}
+
+func (s *Server) adminTargetRepo(w http.ResponseWriter, r *http.Request) (*models.Repository, bool) {
+	repo, err := s.repoSvc.Get(r.Context(), r.PathValue("owner"), r.PathValue("repo"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "repository not found", http.StatusNotFound)
+			return nil, false
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return repo, true
+}
@@ -4,16 +4,27 @@ import (
 	"bytes"
 	"context"
 	"crypto/ed25519"
+	"crypto/hmac"
 	"crypto/md5"
 	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime/quotedprintable"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	netmail "net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -25,7 +36,10 @@ import (
 	"github.com/odvcencio/gothub/internal/database"
 	"github.com/odvcencio/gothub/internal/gitinterop"
 	"github.com/odvcencio/gothub/internal/gotstore"
+	"github.com/odvcencio/gothub/internal/mail"
 	"github.com/odvcencio/gothub/internal/models"
+	"github.com/odvcencio/gothub/internal/oidc"
+	"github.com/odvcencio/gothub/internal/oidc/oidctest"
 	"github.com/odvcencio/gothub/internal/service"
 	"golang.org/x/crypto/ssh"
 )
@@ -51,10 +65,93 @@ func setupTestServerWithOptions(t *testing.T, opts api.ServerOptions) (*api.Serv
 
 	authSvc := auth.NewService("test-secret", 24*time.Hour)
 	repoSvc := service.NewRepoService(db, storagePath)
+	if opts.WebhookWorkerPoll == 0 {
+		opts.WebhookWorkerPoll = 20 * time.Millisecond
+	}
+	if opts.Mailer == nil {
+		opts.Mailer = mail.NewFileSender(tmpDir + "/mail")
+	}
+	if opts.MailWorkerPoll == 0 {
+		opts.MailWorkerPoll = 20 * time.Millisecond
+	}
 	server := api.NewServerWithOptions(db, authSvc, repoSvc, opts)
+	// Async indexing tests drive the index queue by hand, so only the
+	// webhook delivery workers run in the background.
+	if !opts.EnableAsyncIndexing {
+		if err := server.StartBackgroundWorkers(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(server.StopBackgroundWorkersNow)
+	}
 	return server, db
 }
 
+// setupTestServerWithMailbox returns a server whose outbound email is
+// written to the returned directory; read it with takeEmail.
+func setupTestServerWithMailbox(t *testing.T) (*api.Server, database.DB, string) {
+	t.Helper()
+	dir := t.TempDir()
+	server, db := setupTestServerWithOptions(t, api.ServerOptions{
+		Mailer:            mail.NewFileSender(dir),
+		PublicURL:         "https://gothub.test",
+		MailReplyDomain:   "reply.gothub.test",
+		MailInboundSecret: "inbound-secret",
+	})
+	return server, db, dir
+}
+
+type testEmail struct {
+	Header netmail.Header
+	Body   string
+}
+
+// takeEmail waits for a message to recipient in dir, removes it and returns
+// it with the body decoded.
+func takeEmail(t *testing.T, dir, recipient string) testEmail {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			msg, err := netmail.ReadMessage(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("parse %s: %v", entry.Name(), err)
+			}
+			to, err := netmail.ParseAddress(msg.Header.Get("To"))
+			if err != nil || to.Address != recipient {
+				continue
+			}
+			body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			os.Remove(path)
+			return testEmail{Header: msg.Header, Body: string(body)}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no email to %s", recipient)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+var magicTokenPattern = regexp.MustCompile(`magic_token=([A-Za-z0-9_-]+)`)
+
+func takeMagicToken(t *testing.T, dir, recipient string) string {
+	t.Helper()
+	email := takeEmail(t, dir, recipient)
+	m := magicTokenPattern.FindStringSubmatch(email.Body)
+	if m == nil {
+		t.Fatalf("no magic link in email:\n%s", email.Body)
+	}
+	return m[1]
+}
+
 func setupTestServerAsyncIndexing(t *testing.T) (*api.Server, database.DB) {
 	return setupTestServerWithOptions(t, api.ServerOptions{
 		EnableAsyncIndexing: true,
@@ -135,7 +232,7 @@ func TestAuthCapabilitiesNoPasswordAuth(t *testing.T) {
 }
 
 func TestMagicLinkAuthFlow(t *testing.T) {
-	server, _ := setupTestServer(t)
+	server, _, mailbox := setupTestServerWithMailbox(t)
 	ts := httptest.NewServer(server)
 	defer ts.Close()
 
@@ -157,22 +254,30 @@ func TestMagicLinkAuthFlow(t *testing.T) {
 	if resp.StatusCode != http.StatusOK {
 		t.Fatalf("magic request: expected 200, got %d", resp.StatusCode)
 	}
-	var requestResp struct {
-		Sent  bool   `json:"sent"`
-		Token string `json:"token"`
-	}
+	var requestResp map[string]any
 	if err := json.NewDecoder(resp.Body).Decode(&requestResp); err != nil {
 		t.Fatal(err)
 	}
 	resp.Body.Close()
-	if !requestResp.Sent {
+	if requestResp["sent"] != true {
 		t.Fatal("expected sent=true")
 	}
-	if requestResp.Token == "" {
-		t.Fatal("expected magic token in response for local/dev mode")
+	if _, ok := requestResp["token"]; ok {
+		t.Fatal("magic token must only be delivered by email")
+	}
+	magicToken := takeMagicToken(t, mailbox, "magic@example.com")
+
+	// Unknown addresses get the same response and no email.
+	resp, err = http.Post(ts.URL+"/api/v1/auth/magic/request", "application/json", bytes.NewBufferString(`{"email":"nobody@example.com"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("magic request for unknown email: expected 200, got %d", resp.StatusCode)
 	}
+	resp.Body.Close()
 
-	verifyBody := fmt.Sprintf(`{"token":"%s"}`, requestResp.Token)
+	verifyBody := fmt.Sprintf(`{"token":"%s"}`, magicToken)
 	resp, err = http.Post(ts.URL+"/api/v1/auth/magic/verify", "application/json", bytes.NewBufferString(verifyBody))
 	if err != nil {
 		t.Fatal(err)
@@ -208,6 +313,133 @@ func TestMagicLinkAuthFlow(t *testing.T) {
 	resp.Body.Close()
 }
 
+func TestSessionRevocationAndRotation(t *testing.T) {
+	server, db, mailbox := setupTestServerWithMailbox(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	call := func(method, path, token, userAgent, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if userAgent != "" {
+			req.Header.Set("User-Agent", userAgent)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	status := func(method, path, token string) int {
+		t.Helper()
+		resp := call(method, path, token, "", "")
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	decodeToken := func(resp *http.Response) string {
+		t.Helper()
+		defer resp.Body.Close()
+		var out struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil || out.Token == "" {
+			t.Fatalf("expected token (status %d): %v", resp.StatusCode, err)
+		}
+		return out.Token
+	}
+	magicLogin := func(userAgent string) string {
+		t.Helper()
+		call(http.MethodPost, "/api/v1/auth/magic/request", "", "", `{"email":"alice@example.com"}`).Body.Close()
+		magic := takeMagicToken(t, mailbox, "alice@example.com")
+		return decodeToken(call(http.MethodPost, "/api/v1/auth/magic/verify", "", userAgent, fmt.Sprintf(`{"token":%q}`, magic)))
+	}
+
+	first := registerAndGetToken(t, ts.URL, "alice")
+	laptop := magicLogin("laptop-browser")
+
+	resp := call(http.MethodGet, "/api/v1/user/sessions", first, "", "")
+	var sessions []struct {
+		ID        string `json:"id"`
+		UserAgent string `json:"user_agent"`
+		IPAddress string `json:"ip_address"`
+		Current   bool   `json:"current"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&sessions); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", sessions)
+	}
+	var sawLaptop, sawCurrent bool
+	for _, session := range sessions {
+		sawLaptop = sawLaptop || session.UserAgent == "laptop-browser"
+		sawCurrent = sawCurrent || session.Current
+		if session.IPAddress == "" {
+			t.Fatalf("expected session IP, got %+v", session)
+		}
+	}
+	if !sawLaptop || !sawCurrent {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+
+	// Refresh rotates the session and retires the old token.
+	rotated := decodeToken(call(http.MethodPost, "/api/v1/auth/refresh", first, "", ""))
+	if got := status(http.MethodGet, "/api/v1/user", first); got != http.StatusUnauthorized {
+		t.Fatalf("pre-refresh token: expected 401, got %d", got)
+	}
+	if got := status(http.MethodGet, "/api/v1/user", rotated); got != http.StatusOK {
+		t.Fatalf("rotated token: expected 200, got %d", got)
+	}
+
+	// Removing a passkey signs out every other session.
+	user, err := db.GetUserByUsername(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateWebAuthnCredential(context.Background(), &models.WebAuthnCredential{UserID: user.ID, CredentialID: "cred-1", DataJSON: "{}"}); err != nil {
+		t.Fatal(err)
+	}
+	credentials, err := db.ListWebAuthnCredentials(context.Background(), user.ID)
+	if err != nil || len(credentials) != 1 {
+		t.Fatalf("expected one passkey, got %v (%v)", credentials, err)
+	}
+	if got := status(http.MethodDelete, "/api/v1/user/passkeys/999", rotated); got != http.StatusNotFound {
+		t.Fatalf("delete missing passkey: expected 404, got %d", got)
+	}
+	if got := status(http.MethodDelete, fmt.Sprintf("/api/v1/user/passkeys/%d", credentials[0].ID), rotated); got != http.StatusNoContent {
+		t.Fatalf("delete passkey: expected 204, got %d", got)
+	}
+	if got := status(http.MethodGet, "/api/v1/user", laptop); got != http.StatusUnauthorized {
+		t.Fatalf("session after passkey removal: expected 401, got %d", got)
+	}
+	if got := status(http.MethodGet, "/api/v1/user", rotated); got != http.StatusOK {
+		t.Fatalf("current session after passkey removal: expected 200, got %d", got)
+	}
+
+	// Sign out everywhere, then log out a single session.
+	phone := magicLogin("phone")
+	if got := status(http.MethodDelete, "/api/v1/user/sessions", rotated); got != http.StatusNoContent {
+		t.Fatalf("sign out everywhere: expected 204, got %d", got)
+	}
+	for _, token := range []string{rotated, phone} {
+		if got := status(http.MethodGet, "/api/v1/user", token); got != http.StatusUnauthorized {
+			t.Fatalf("after sign out everywhere: expected 401, got %d", got)
+		}
+	}
+	tablet := magicLogin("tablet")
+	if got := status(http.MethodPost, "/api/v1/auth/logout", tablet); got != http.StatusNoContent {
+		t.Fatalf("logout: expected 204, got %d", got)
+	}
+	if got := status(http.MethodGet, "/api/v1/user", tablet); got != http.StatusUnauthorized {
+		t.Fatalf("after logout: expected 401, got %d", got)
+	}
+}
+
 func TestSSHChallengeAuthFlow(t *testing.T) {
 	server, _ := setupTestServer(t)
 	ts := httptest.NewServer(server)
@@ -852,6 +1084,229 @@ func TestProtocolAuthForPrivateRepo(t *testing.T) {
 	resp.Body.Close()
 }
 
+func TestDeployKeysAuthorizeProtocolAccess(t *testing.T) {
+	server, _ := setupTestServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	token := registerAndGetToken(t, ts.URL, "alice")
+	createRepo(t, ts.URL, token, "private-repo", true)
+	createRepo(t, ts.URL, token, "other-repo", true)
+
+	createKey := func(body string) (int64, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/repos/alice/private-repo/deploy-keys", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create deploy key: expected 201, got %d", resp.StatusCode)
+		}
+		var created struct {
+			ID       int64  `json:"id"`
+			Token    string `json:"token"`
+			ReadOnly bool   `json:"read_only"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		return created.ID, created.Token
+	}
+	protocolStatus := func(path, deployToken string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		req.SetBasicAuth("deploy", deployToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	readID, readToken := createKey(`{"name":"deploy-server","kind":"token"}`)
+	if !strings.HasPrefix(readToken, "gdk_") {
+		t.Fatalf("expected deploy token, got %q", readToken)
+	}
+	_, writeToken := createKey(`{"name":"release-bot","kind":"token","read_only":false}`)
+
+	if got := protocolStatus("/git/alice/private-repo/info/refs?service=git-upload-pack", readToken); got != http.StatusOK {
+		t.Fatalf("deploy key clone: expected 200, got %d", got)
+	}
+	if got := protocolStatus("/got/alice/private-repo/refs", readToken); got != http.StatusOK {
+		t.Fatalf("deploy key got refs: expected 200, got %d", got)
+	}
+	if got := protocolStatus("/git/alice/private-repo/info/refs?service=git-receive-pack", readToken); got != http.StatusForbidden {
+		t.Fatalf("read-only deploy key push: expected 403, got %d", got)
+	}
+	if got := protocolStatus("/git/alice/private-repo/info/refs?service=git-receive-pack", writeToken); got != http.StatusOK {
+		t.Fatalf("read-write deploy key push: expected 200, got %d", got)
+	}
+	if got := protocolStatus("/git/alice/other-repo/info/refs?service=git-upload-pack", readToken); got != http.StatusForbidden {
+		t.Fatalf("deploy key on another repo: expected 403, got %d", got)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/repos/alice/private-repo/deploy-keys", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []struct {
+		ID         int64      `json:"id"`
+		Token      string     `json:"token"`
+		LastUsedAt *time.Time `json:"last_used_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 deploy keys, got %d", len(keys))
+	}
+	for _, key := range keys {
+		if key.Token != "" {
+			t.Fatal("deploy key listing must not expose tokens")
+		}
+		if key.ID == readID && key.LastUsedAt == nil {
+			t.Fatal("expected last_used_at to be recorded")
+		}
+	}
+
+	req, _ = http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/api/v1/repos/alice/private-repo/deploy-keys/%d", ts.URL, readID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("revoke deploy key: expected 204, got %d", resp.StatusCode)
+	}
+	if got := protocolStatus("/git/alice/private-repo/info/refs?service=git-upload-pack", readToken); got != http.StatusUnauthorized {
+		t.Fatalf("revoked deploy key: expected 401, got %d", got)
+	}
+}
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	server, _ := setupTestServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	session := registerAndGetToken(t, ts.URL, "alice")
+	createRepo(t, ts.URL, session, "repo", true)
+	createRepo(t, ts.URL, session, "other", true)
+
+	do := func(method, path, bearer, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	expect := func(method, path, bearer, body string, want int) {
+		t.Helper()
+		resp := do(method, path, bearer, body)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("%s %s: expected %d, got %d", method, path, want, resp.StatusCode)
+		}
+	}
+	createToken := func(body string) (int64, string) {
+		t.Helper()
+		resp := do(http.MethodPost, "/api/v1/user/tokens", session, body)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create token: expected 201, got %d", resp.StatusCode)
+		}
+		var created struct {
+			ID    int64  `json:"id"`
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		return created.ID, created.Token
+	}
+
+	expect(http.MethodPost, "/api/v1/user/tokens", session, `{"name":"bad","scopes":["repo:delete"]}`, http.StatusBadRequest)
+	expect(http.MethodPost, "/api/v1/user/tokens", session, `{"name":"none","scopes":[]}`, http.StatusBadRequest)
+
+	readID, readToken := createToken(`{"name":"ci","scopes":["repo:read"],"repositories":["alice/repo"]}`)
+	if !strings.HasPrefix(readToken, "gpat_") {
+		t.Fatalf("expected personal access token, got %q", readToken)
+	}
+	expect(http.MethodGet, "/api/v1/user", readToken, "", http.StatusOK)
+	expect(http.MethodGet, "/api/v1/repos/alice/repo", readToken, "", http.StatusOK)
+	expect(http.MethodGet, "/api/v1/repos/alice/other", readToken, "", http.StatusNotFound)
+	expect(http.MethodDelete, "/api/v1/repos/alice/repo", readToken, "", http.StatusForbidden)
+	expect(http.MethodPost, "/api/v1/repos/alice/repo/issues", readToken, `{"title":"x"}`, http.StatusForbidden)
+	expect(http.MethodPost, "/api/v1/user/tokens", readToken, `{"name":"escalate","scopes":["admin:repo"]}`, http.StatusForbidden)
+	expect(http.MethodPost, "/api/v1/auth/refresh", readToken, "", http.StatusForbidden)
+
+	protocolStatus := func(path, token string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		req.SetBasicAuth("alice", token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := protocolStatus("/git/alice/repo/info/refs?service=git-upload-pack", readToken); got != http.StatusOK {
+		t.Fatalf("repo:read clone: expected 200, got %d", got)
+	}
+	if got := protocolStatus("/git/alice/repo/info/refs?service=git-receive-pack", readToken); got != http.StatusForbidden {
+		t.Fatalf("repo:read push: expected 403, got %d", got)
+	}
+	if got := protocolStatus("/git/alice/other/info/refs?service=git-upload-pack", readToken); got != http.StatusForbidden {
+		t.Fatalf("clone outside allowlist: expected 403, got %d", got)
+	}
+
+	_, issuesToken := createToken(`{"name":"triage","scopes":["issues"]}`)
+	expect(http.MethodPost, "/api/v1/repos/alice/repo/issues", issuesToken, `{"title":"from a script"}`, http.StatusCreated)
+	expect(http.MethodGet, "/api/v1/repos/alice/repo/branches", issuesToken, "", http.StatusNotFound)
+
+	_, writeToken := createToken(`{"name":"push","scopes":["repo:write"]}`)
+	if got := protocolStatus("/git/alice/other/info/refs?service=git-receive-pack", writeToken); got != http.StatusOK {
+		t.Fatalf("repo:write push: expected 200, got %d", got)
+	}
+
+	resp := do(http.MethodGet, "/api/v1/user/tokens", session, "")
+	var tokens []struct {
+		ID         int64      `json:"id"`
+		Scopes     []string   `json:"scopes"`
+		LastUsedAt *time.Time `json:"last_used_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(tokens) != 3 {
+		t.Fatalf("expected 3 tokens, got %d", len(tokens))
+	}
+	for _, tok := range tokens {
+		if tok.ID == readID && (tok.LastUsedAt == nil || len(tok.Scopes) != 1 || tok.Scopes[0] != "repo:read") {
+			t.Fatalf("unexpected listed token %+v", tok)
+		}
+	}
+
+	expect(http.MethodDelete, fmt.Sprintf("/api/v1/user/tokens/%d", readID), session, "", http.StatusNoContent)
+	expect(http.MethodGet, "/api/v1/repos/alice/repo", readToken, "", http.StatusUnauthorized)
+}
+
 func TestProtocolAuthBasicAuthDisabledReturns401(t *testing.T) {
 	server, _ := setupTestServer(t)
 	ts := httptest.NewServer(server)
@@ -1172,6 +1627,7 @@ func TestCollaboratorWriteAccessLifecycle(t *testing.T) {
 		t.Fatalf("add collaborator: expected 201, got %d", resp.StatusCode)
 	}
 	resp.Body.Close()
+	acceptInvitations(t, ts.URL, bobToken)
 
 	resp, err = http.Get(ts.URL + "/api/v1/repos/alice/repo/collaborators")
 	if err != nil {
@@ -1912,11 +2368,11 @@ func TestReceivePackUsesSidebandForStatusWhenRequested(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if !bytes.Contains(body, []byte{0x01, 'u', 'n', 'p', 'a', 'c', 'k', ' ', 'o', 'k', '\n'}) {
+	// The report's pkt-lines are carried inside side-band channel 1.
+	if !bytes.Contains(body, []byte("\x01000eunpack ok\n")) {
 		t.Fatalf("expected side-band framed unpack status, got body %q", string(body))
 	}
-	expectedNg := []byte{0x01, 'n', 'g', ' '}
-	if !bytes.Contains(body, expectedNg) {
+	if !bytes.Contains(body, []byte("ng "+refName+" ")) || !bytes.HasSuffix(body, []byte("00000000")) {
 		t.Fatalf("expected side-band framed ng status, got body %q", string(body))
 	}
 }
@@ -2225,7 +2681,7 @@ func TestIndexStatusEndpointCompletedState(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	claimed, err := db.ClaimIndexingJob(ctx)
+	claimed, err := db.ClaimIndexingJob(ctx, models.IndexJobTypeCommitIndex, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -3290,6 +3746,7 @@ func TestMergeGateRequiresEntityOwnerApproval(t *testing.T) {
 		t.Fatalf("add collaborator: expected 201, got %d", resp.StatusCode)
 	}
 	resp.Body.Close()
+	acceptInvitations(t, ts.URL, reviewerToken)
 
 	prNumber := createPRNumber(t, ts.URL, ownerToken, "alice", "repo", "feature", "main")
 
@@ -3982,444 +4439,2338 @@ func TestMergeProducesEntityEnrichedTree(t *testing.T) {
 	}
 }
 
-func TestWebhookPingRetriesAndRedelivery(t *testing.T) {
-	server, _ := setupTestServer(t)
+func TestMergeClosesIssuesLinkedByClosingKeywords(t *testing.T) {
+	server, db := setupTestServer(t)
 	ts := httptest.NewServer(server)
 	defer ts.Close()
 
 	token := registerAndGetToken(t, ts.URL, "alice")
 	createRepo(t, ts.URL, token, "repo", false)
 
-	var recvCount int32
-	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		atomic.AddInt32(&recvCount, 1)
-		if r.Header.Get("X-Gothub-Event") != "ping" {
-			t.Errorf("expected X-Gothub-Event ping, got %q", r.Header.Get("X-Gothub-Event"))
-		}
-		if r.Header.Get("X-Gothub-Delivery") == "" {
-			t.Errorf("expected X-Gothub-Delivery header")
-		}
-		if !strings.HasPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=") {
-			t.Errorf("expected HMAC signature header, got %q", r.Header.Get("X-Hub-Signature-256"))
+	for _, title := range []string{"fixed by body", "fixed by commit", "only mentioned"} {
+		req, _ := http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/issues", bytes.NewBufferString(fmt.Sprintf(`{"title":%q}`, title)))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
 		}
-		if atomic.LoadInt32(&recvCount) < 3 {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("temporary failure"))
-			return
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create issue: expected 201, got %d", resp.StatusCode)
 		}
-		w.WriteHeader(http.StatusNoContent)
-	}))
-	defer receiver.Close()
+		resp.Body.Close()
+	}
 
-	createHookBody := fmt.Sprintf(`{"url":"%s","secret":"topsecret","events":["ping"],"active":true}`, receiver.URL)
-	req, _ := http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/webhooks", bytes.NewBufferString(createHookBody))
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	repo, err := db.GetRepository(context.Background(), "alice", "repo")
 	if err != nil {
 		t.Fatal(err)
 	}
-	if resp.StatusCode != http.StatusCreated {
-		t.Fatalf("create webhook: expected 201, got %d", resp.StatusCode)
+	store, err := gotstore.Open(repo.StoragePath)
+	if err != nil {
+		t.Fatal(err)
 	}
-	var hook struct {
-		ID        int64 `json:"id"`
-		HasSecret bool  `json:"has_secret"`
+	baseBlobHash, err := store.Objects.WriteBlob(&object.Blob{Data: []byte("package main\n\nfunc ProcessOrder() int { return 1 }\n")})
+	if err != nil {
+		t.Fatal(err)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&hook); err != nil {
+	baseTreeHash, err := store.Objects.WriteTree(&object.TreeObj{Entries: []object.TreeEntry{{Name: "main.go", BlobHash: baseBlobHash}}})
+	if err != nil {
 		t.Fatal(err)
 	}
-	resp.Body.Close()
-	if hook.ID == 0 {
-		t.Fatal("expected webhook id")
+	baseCommitHash, err := store.Objects.WriteCommit(&object.CommitObj{TreeHash: baseTreeHash, Author: "alice", Timestamp: 1700000000, Message: "base"})
+	if err != nil {
+		t.Fatal(err)
 	}
-	if !hook.HasSecret {
-		t.Fatal("expected has_secret=true")
+	featureBlobHash, err := store.Objects.WriteBlob(&object.Blob{Data: []byte("package main\n\nfunc ProcessOrder() int { return 2 }\n")})
+	if err != nil {
+		t.Fatal(err)
 	}
-
-	req, _ = http.NewRequest("POST", fmt.Sprintf("%s/api/v1/repos/alice/repo/webhooks/%d/ping", ts.URL, hook.ID), nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-	resp, err = http.DefaultClient.Do(req)
+	featureTreeHash, err := store.Objects.WriteTree(&object.TreeObj{Entries: []object.TreeEntry{{Name: "main.go", BlobHash: featureBlobHash}}})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("ping webhook: expected 200, got %d", resp.StatusCode)
-	}
-	var pingDelivery struct {
-		ID      int64 `json:"id"`
-		Attempt int   `json:"attempt"`
-		Success bool  `json:"success"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&pingDelivery); err != nil {
+	featureCommitHash, err := store.Objects.WriteCommit(&object.CommitObj{
+		TreeHash:  featureTreeHash,
+		Parents:   []object.Hash{baseCommitHash},
+		Author:    "alice",
+		Timestamp: 1700000100,
+		Message:   "Return two\n\nResolves #2",
+	})
+	if err != nil {
 		t.Fatal(err)
 	}
-	resp.Body.Close()
-	if pingDelivery.ID == 0 || !pingDelivery.Success || pingDelivery.Attempt != 3 {
-		t.Fatalf("unexpected ping delivery: %+v", pingDelivery)
+	if err := store.Refs.Set("heads/main", baseCommitHash); err != nil {
+		t.Fatal(err)
 	}
-	if atomic.LoadInt32(&recvCount) != 3 {
-		t.Fatalf("expected 3 delivery attempts, got %d", atomic.LoadInt32(&recvCount))
+	if err := store.Refs.Set("heads/feature", featureCommitHash); err != nil {
+		t.Fatal(err)
 	}
 
-	resp, err = http.Get(fmt.Sprintf("%s/api/v1/repos/alice/repo/webhooks/%d/deliveries", ts.URL, hook.ID))
+	req, _ := http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/pulls", bytes.NewBufferString(`{"title":"return two","body":"Fixes #1, see #3","source_branch":"feature","target_branch":"main"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("list deliveries: expected 200, got %d", resp.StatusCode)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create PR: expected 201, got %d", resp.StatusCode)
 	}
-	var deliveries []struct {
-		ID             int64  `json:"id"`
-		Attempt        int    `json:"attempt"`
-		DeliveryUID    string `json:"delivery_uid"`
-		Success        bool   `json:"success"`
-		RedeliveryOfID *int64 `json:"redelivery_of_id"`
+	var prResp struct {
+		Number int `json:"number"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&deliveries); err != nil {
+	if err := json.NewDecoder(resp.Body).Decode(&prResp); err != nil {
 		t.Fatal(err)
 	}
 	resp.Body.Close()
-	if len(deliveries) != 3 {
-		t.Fatalf("expected 3 delivery rows, got %d", len(deliveries))
-	}
-	var originalID int64
-	for _, d := range deliveries {
-		if d.Attempt == 1 {
-			originalID = d.ID
-			break
-		}
+
+	issue, err := db.GetIssue(context.Background(), repo.ID, 1)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if originalID == 0 {
-		t.Fatalf("expected attempt 1 delivery in %+v", deliveries)
+	if issue.State != "open" {
+		t.Fatalf("expected issue #1 to stay open before merge, got %q", issue.State)
 	}
 
-	req, _ = http.NewRequest("POST", fmt.Sprintf("%s/api/v1/repos/alice/repo/webhooks/%d/deliveries/%d/redeliver", ts.URL, hook.ID, originalID), nil)
+	req, _ = http.NewRequest("POST", fmt.Sprintf("%s/api/v1/repos/alice/repo/pulls/%d/merge", ts.URL, prResp.Number), nil)
 	req.Header.Set("Authorization", "Bearer "+token)
 	resp, err = http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatal(err)
 	}
 	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("redeliver: expected 200, got %d", resp.StatusCode)
+		t.Fatalf("merge PR: expected 200, got %d", resp.StatusCode)
 	}
-	var redelivery struct {
-		ID             int64  `json:"id"`
-		Attempt        int    `json:"attempt"`
-		RedeliveryOfID *int64 `json:"redelivery_of_id"`
-		Success        bool   `json:"success"`
+	resp.Body.Close()
+
+	for number, want := range map[int]string{1: "closed", 2: "closed", 3: "open"} {
+		issue, err := db.GetIssue(context.Background(), repo.ID, number)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if issue.State != want {
+			t.Fatalf("issue #%d: expected state %q, got %q", number, want, issue.State)
+		}
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&redelivery); err != nil {
+
+	resp, err = http.Get(ts.URL + "/api/v1/repos/alice/repo/issues/3/references")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("list issue references: expected 200, got %d", resp.StatusCode)
+	}
+	var refs []struct {
+		SourceType   string `json:"source_type"`
+		SourceNumber int    `json:"source_number"`
+		Closing      bool   `json:"closing"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&refs); err != nil {
 		t.Fatal(err)
 	}
 	resp.Body.Close()
-	if redelivery.ID == 0 || !redelivery.Success || redelivery.RedeliveryOfID == nil || *redelivery.RedeliveryOfID != originalID {
-		t.Fatalf("unexpected redelivery response: %+v", redelivery)
+	if len(refs) != 1 || refs[0].SourceType != "pull_request" || refs[0].SourceNumber != prResp.Number || refs[0].Closing {
+		t.Fatalf("unexpected references for issue #3: %+v", refs)
 	}
 
-	resp, err = http.Get(fmt.Sprintf("%s/api/v1/repos/alice/repo/webhooks/%d/deliveries", ts.URL, hook.ID))
+	resp, err = http.Get(ts.URL + "/api/v1/repos/alice/repo/issues/2/references")
 	if err != nil {
 		t.Fatal(err)
 	}
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("list deliveries after redelivery: expected 200, got %d", resp.StatusCode)
+	var commitRefs []struct {
+		SourceType string `json:"source_type"`
+		CommitHash string `json:"commit_hash"`
+		Closing    bool   `json:"closing"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&deliveries); err != nil {
+	if err := json.NewDecoder(resp.Body).Decode(&commitRefs); err != nil {
 		t.Fatal(err)
 	}
 	resp.Body.Close()
-	if len(deliveries) != 4 {
-		t.Fatalf("expected 4 delivery rows after redelivery, got %d", len(deliveries))
+	if len(commitRefs) != 1 || commitRefs[0].SourceType != "commit" || commitRefs[0].CommitHash != string(featureCommitHash) || !commitRefs[0].Closing {
+		t.Fatalf("unexpected references for issue #2: %+v", commitRefs)
 	}
 }
 
-func TestPullRequestWebhookIncludesEntityChanges(t *testing.T) {
+func TestSSHPushClosesLinkedIssues(t *testing.T) {
 	server, db := setupTestServer(t)
 	ts := httptest.NewServer(server)
 	defer ts.Close()
 
 	token := registerAndGetToken(t, ts.URL, "alice")
 	createRepo(t, ts.URL, token, "repo", false)
+	signer, pubText, _ := newTestSSHSigner(t)
+	for path, body := range map[string]string{
+		"/api/v1/user/ssh-keys":           fmt.Sprintf(`{"name":"laptop","public_key":%q}`, strings.TrimSpace(pubText)),
+		"/api/v1/repos/alice/repo/issues": `{"title":"crash on start"}`,
+	} {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST %s: expected 201, got %d", path, resp.StatusCode)
+		}
+	}
 
-	repo, err := db.GetRepository(context.Background(), "alice", "repo")
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, err := ssh.NewSignerFromKey(hostPriv)
 	if err != nil {
 		t.Fatal(err)
 	}
-	store, err := gotstore.Open(repo.StoragePath)
+	sshServer := server.NewGitSSHServer(hostKey)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		t.Fatal(err)
 	}
+	go sshServer.Serve(l)
+	defer sshServer.Close()
 
-	baseBlobHash, err := store.Objects.WriteBlob(&object.Blob{Data: []byte("package main\n\nfunc ProcessOrder() int { return 1 }\n")})
+	client, err := ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{
+		User:            "git",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey.PublicKey()),
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
-	baseTreeHash, err := store.Objects.WriteTree(&object.TreeObj{
-		Entries: []object.TreeEntry{{Name: "main.go", BlobHash: baseBlobHash}},
-	})
+	defer client.Close()
+	session, err := client.NewSession()
 	if err != nil {
 		t.Fatal(err)
 	}
-	baseCommitHash, err := store.Objects.WriteCommit(&object.CommitObj{
-		TreeHash:  baseTreeHash,
-		Author:    "alice",
-		Timestamp: 1700000000,
-		Message:   "base",
-	})
+	var stdout, stderr bytes.Buffer
+	session.Stdin = bytes.NewReader(gitPushPayload(t, "refs/heads/main", "Guard nil config\n\nFixes #1"))
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if err := session.Run("git-receive-pack 'alice/repo.git'"); err != nil {
+		t.Fatalf("ssh push: %v (stderr %q)", err, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "ok refs/heads/main\n") {
+		t.Fatalf("expected ok status for refs/heads/main, got %q", stdout.String())
+	}
+
+	repo, err := db.GetRepository(context.Background(), "alice", "repo")
 	if err != nil {
 		t.Fatal(err)
 	}
+	waitForIssueState(t, db, repo.ID, 1, models.IssueStateClosed)
+}
 
-	headBlobHash, err := store.Objects.WriteBlob(&object.Blob{Data: []byte("package main\n\nfunc ProcessOrder() int { return 2 }\n")})
+func TestHTTPTokenPushClosesLinkedIssues(t *testing.T) {
+	server, db := setupTestServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	token := registerAndGetToken(t, ts.URL, "alice")
+	createRepo(t, ts.URL, token, "repo", false)
+	post := func(path, body string, out any) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST %s: expected 201, got %d", path, resp.StatusCode)
+		}
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	post("/api/v1/repos/alice/repo/issues", `{"title":"crash on start"}`, nil)
+	var pat struct {
+		Token string `json:"token"`
+	}
+	post("/api/v1/user/tokens", `{"name":"laptop","scopes":["repo:write"]}`, &pat)
+
+	// Git sends the token as the Basic password, not as a Bearer token.
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/git/alice/repo/git-receive-pack", bytes.NewReader(gitPushPayload(t, "refs/heads/main", "Guard nil config\n\nCloses #1")))
+	req.Header.Set("Content-Type", "application/x-git-receive-pack-request")
+	req.SetBasicAuth("alice", pat.Token)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatal(err)
 	}
-	headTreeHash, err := store.Objects.WriteTree(&object.TreeObj{
-		Entries: []object.TreeEntry{{Name: "main.go", BlobHash: headBlobHash}},
-	})
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "ok refs/heads/main\n") {
+		t.Fatalf("git receive-pack: got %d %q", resp.StatusCode, body)
+	}
+
+	repo, err := db.GetRepository(context.Background(), "alice", "repo")
 	if err != nil {
 		t.Fatal(err)
 	}
-	headCommitHash, err := store.Objects.WriteCommit(&object.CommitObj{
-		TreeHash:  headTreeHash,
-		Parents:   []object.Hash{baseCommitHash},
-		Author:    "alice",
-		Timestamp: 1700000100,
-		Message:   "feature",
-	})
+	waitForIssueState(t, db, repo.ID, 1, models.IssueStateClosed)
+}
+
+func TestPushedMergeDoesNotCloseReopenedIssues(t *testing.T) {
+	server, db := setupTestServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	aliceToken := registerAndGetToken(t, ts.URL, "alice")
+	bobToken := registerAndGetToken(t, ts.URL, "bob")
+	createRepo(t, ts.URL, aliceToken, "repo", false)
+	call := func(method, path, token, body string, want int) {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("%s %s: expected %d, got %d", method, path, want, resp.StatusCode)
+		}
+	}
+	call(http.MethodPost, "/api/v1/repos/alice/repo/issues", aliceToken, `{"title":"crash on start"}`, http.StatusCreated)
+	call(http.MethodPost, "/api/v1/repos/alice/repo/issues", aliceToken, `{"title":"empty input"}`, http.StatusCreated)
+	call(http.MethodPut, "/api/v1/repos/alice/repo/issues/2/subscription", bobToken, `{"subscribed":true}`, http.StatusOK)
+
+	blobData := []byte("package main\n\nfunc main() {}\n")
+	blobRaw, err := hex.DecodeString(string(gitinterop.GitHashBytes(gitinterop.GitTypeBlob, blobData)))
 	if err != nil {
 		t.Fatal(err)
 	}
-	if err := store.Refs.Set("heads/main", baseCommitHash); err != nil {
-		t.Fatal(err)
+	treeData := append([]byte("100644 main.go\x00"), blobRaw...)
+	treeHash := gitinterop.GitHashBytes(gitinterop.GitTypeTree, treeData)
+	commit := func(message string, parents ...gitinterop.GitHash) (gitinterop.GitHash, []byte) {
+		var b strings.Builder
+		fmt.Fprintf(&b, "tree %s\n", treeHash)
+		for _, p := range parents {
+			fmt.Fprintf(&b, "parent %s\n", p)
+		}
+		fmt.Fprintf(&b, "author Owner <owner@example.com> 1700000000 +0000\ncommitter Owner <owner@example.com> 1700000000 +0000\n\n%s\n", message)
+		data := []byte(b.String())
+		return gitinterop.GitHashBytes(gitinterop.GitTypeCommit, data), data
+	}
+	push := func(oldHash, newHash gitinterop.GitHash, commits ...[]byte) {
+		t.Helper()
+		objects := []gitinterop.PackfileObject{
+			{Type: gitinterop.OBJ_BLOB, Data: blobData},
+			{Type: gitinterop.OBJ_TREE, Data: treeData},
+		}
+		for _, data := range commits {
+			objects = append(objects, gitinterop.PackfileObject{Type: gitinterop.OBJ_COMMIT, Data: data})
+		}
+		packData, err := gitinterop.BuildPackfile(objects)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload := append(pktLineForTest(fmt.Sprintf("%s %s refs/heads/main\x00report-status\n", oldHash, newHash)), pktFlushForTest()...)
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/git/alice/repo/git-receive-pack", bytes.NewReader(append(payload, packData...)))
+		req.Header.Set("Content-Type", "application/x-git-receive-pack-request")
+		req.Header.Set("Authorization", "Bearer "+aliceToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "ok refs/heads/main\n") {
+			t.Fatalf("git receive-pack: got %d %q", resp.StatusCode, body)
+		}
 	}
-	if err := store.Refs.Set("heads/feature", headCommitHash); err != nil {
+
+	repo, err := db.GetRepository(context.Background(), "alice", "repo")
+	if err != nil {
 		t.Fatal(err)
 	}
+	fixHash, fixData := commit("Guard nil config\n\nFixes #1")
+	tidyHash, tidyData := commit("Tidy imports", fixHash)
+	push(gitinterop.GitHash(strings.Repeat("0", 40)), tidyHash, fixData, tidyData)
+	waitForIssueState(t, db, repo.ID, 1, models.IssueStateClosed)
+	call(http.MethodPatch, "/api/v1/repos/alice/repo/issues/1", aliceToken, `{"state":"open"}`, http.StatusOK)
 
-	type prWebhookPayload struct {
-		Action          string `json:"action"`
-		EntitiesChanged []struct {
-			File string `json:"file"`
-			Type string `json:"type"`
-			Key  string `json:"key"`
-		} `json:"entities_changed"`
-		EntitiesAdded    int `json:"entities_added"`
-		EntitiesRemoved  int `json:"entities_removed"`
-		EntitiesModified int `json:"entities_modified"`
-	}
+	// A branch forked before the tidy-up is merged back in: the walk from the
+	// merge reaches the old "Fixes #1" commit through the branch's parent.
+	branchHash, branchData := commit("Handle empty input\n\nFixes #2", fixHash)
+	mergeHash, mergeData := commit("Merge branch 'empty-input'", tidyHash, branchHash)
+	push(tidyHash, mergeHash, branchData, mergeData)
+	waitForIssueState(t, db, repo.ID, 2, models.IssueStateClosed)
 
-	payloadCh := make(chan prWebhookPayload, 1)
-	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("X-Gothub-Event") != "pull_request" {
-			w.WriteHeader(http.StatusNoContent)
-			return
+	// Bob hears about #2 closing only after every linked issue was closed.
+	bob, err := db.GetUserByUsername(context.Background(), "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		notifications, err := db.ListNotifications(context.Background(), bob.ID, true)
+		if err != nil {
+			t.Fatal(err)
 		}
-		var payload prWebhookPayload
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
+		if len(notifications) > 0 {
+			break
 		}
-		select {
-		case payloadCh <- payload:
-		default:
+		if time.Now().After(deadline) {
+			t.Fatal("expected bob to be notified that #2 closed")
 		}
-		w.WriteHeader(http.StatusNoContent)
-	}))
-	defer receiver.Close()
-
-	createHookBody := fmt.Sprintf(`{"url":"%s","secret":"topsecret","events":["pull_request"],"active":true}`, receiver.URL)
-	req, _ := http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/webhooks", bytes.NewBufferString(createHookBody))
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+		time.Sleep(10 * time.Millisecond)
+	}
+	issue, err := db.GetIssue(context.Background(), repo.ID, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if resp.StatusCode != http.StatusCreated {
-		t.Fatalf("create webhook: expected 201, got %d", resp.StatusCode)
+	if issue.State != models.IssueStateOpen {
+		t.Fatalf("issue #1: expected reopened issue to stay open, got %q", issue.State)
 	}
-	resp.Body.Close()
+}
 
-	req, _ = http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/pulls", bytes.NewBufferString(`{"title":"entity webhook","source_branch":"feature","target_branch":"main"}`))
+func TestSearchIssuesQuerySyntax(t *testing.T) {
+	server, _ := setupTestServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	token := registerAndGetToken(t, ts.URL, "alice")
+	createRepo(t, ts.URL, token, "repo", false)
+
+	for _, body := range []string{
+		`{"title":"Panic in merge driver","body":"trace attached"}`,
+		`{"title":"Slow clone","body":"takes minutes"}`,
+	} {
+		req, _ := http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/issues", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create issue: expected 201, got %d", resp.StatusCode)
+		}
+		resp.Body.Close()
+	}
+	req, _ := http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/issues/2/comments", bytes.NewBufferString(`{"body":"probably the merge walk again"}`))
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Content-Type", "application/json")
-	resp, err = http.DefaultClient.Do(req)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatal(err)
 	}
 	if resp.StatusCode != http.StatusCreated {
-		t.Fatalf("create PR: expected 201, got %d", resp.StatusCode)
+		t.Fatalf("create issue comment: expected 201, got %d", resp.StatusCode)
 	}
 	resp.Body.Close()
 
-	select {
-	case payload := <-payloadCh:
-		if payload.Action != "opened" {
-			t.Fatalf("expected pull_request action opened, got %q", payload.Action)
-		}
+	var ignored string
+	search := func(q string) (int, []models.IssueSearchResult) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/api/v1/repos/alice/repo/search/issues?q=" + url.QueryEscape(q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		ignored = resp.Header.Get("X-Gothub-Ignored-Qualifiers")
+		var results []models.IssueSearchResult
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode, results
+	}
+
+	status, results := search(`is:open author:alice merge`)
+	if status != http.StatusOK {
+		t.Fatalf("search: expected 200, got %d", status)
+	}
+	if len(results) != 2 || results[0].Number != 1 || results[1].Number != 2 || results[1].CommentCount != 1 {
+		t.Fatalf("expected title match ranked above comment match, got %+v", results)
+	}
+
+	status, results = search(`"merge driver" in:title`)
+	if status != http.StatusOK || len(results) != 1 || results[0].Kind != models.IssueSearchKindIssue {
+		t.Fatalf("expected single phrase match, got status %d results %+v", status, results)
+	}
+
+	status, results = search(`is:closed merge`)
+	if status != http.StatusOK || len(results) != 0 {
+		t.Fatalf("expected no closed matches, got status %d results %+v", status, results)
+	}
+
+	status, results = search(`is:open author:alice label:bug "merge driver"`)
+	if status != http.StatusOK || len(results) != 1 || ignored != "label:bug" {
+		t.Fatalf("expected label qualifier to be ignored, got status %d ignored %q results %+v", status, ignored, results)
+	}
+
+	if status, _ := search(`sort:stars`); status != http.StatusBadRequest {
+		t.Fatalf("invalid sort: expected 400, got %d", status)
+	}
+}
+
+func TestIssueEntityLinksAndEntityIssueListing(t *testing.T) {
+	server, db := setupTestServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	token := registerAndGetToken(t, ts.URL, "alice")
+	createRepo(t, ts.URL, token, "repo", false)
+
+	req, _ := http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/issues", bytes.NewBufferString(`{"title":"ProcessOrder rounds wrong"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create issue: expected 201, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	ctx := context.Background()
+	repo, err := db.GetRepository(ctx, "alice", "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := gotstore.Open(repo.StoragePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobHash, err := store.Objects.WriteBlob(&object.Blob{Data: []byte("package orders\n\nfunc ProcessOrder() int { return 1 }\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subtreeHash, err := store.Objects.WriteTree(&object.TreeObj{Entries: []object.TreeEntry{{Name: "orders.go", BlobHash: blobHash}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	treeHash, err := store.Objects.WriteTree(&object.TreeObj{Entries: []object.TreeEntry{{Name: "orders", IsDir: true, SubtreeHash: subtreeHash}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitHash, err := store.Objects.WriteCommit(&object.CommitObj{TreeHash: treeHash, Author: "alice", Timestamp: 1700000000, Message: "base"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Refs.Set("heads/main", commitHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpsertEntityIdentity(ctx, &models.EntityIdentity{
+		RepoID:          repo.ID,
+		StableID:        "ent-process",
+		Name:            "ProcessOrder",
+		DeclKind:        "function_declaration",
+		FirstSeenCommit: string(commitHash),
+		LastSeenCommit:  string(commitHash),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetEntityVersion(ctx, &models.EntityVersion{
+		RepoID:     repo.ID,
+		StableID:   "ent-process",
+		CommitHash: string(commitHash),
+		Path:       "orders/orders.go",
+		EntityHash: strings.Repeat("b", 64),
+		BodyHash:   strings.Repeat("c", 64),
+		Name:       "ProcessOrder",
+		DeclKind:   "function_declaration",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	link := func(body string) int {
+		t.Helper()
+		req, _ := http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/issues/1/entities", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := link(`{"stable_ids":["ent-unknown"]}`); status != http.StatusNotFound {
+		t.Fatalf("link unknown entity: expected 404, got %d", status)
+	}
+	if status := link(`{"stable_ids":["ent-process"]}`); status != http.StatusCreated {
+		t.Fatalf("link entity: expected 201, got %d", status)
+	}
+
+	listEntityIssues := func(query string) []models.IssueEntityLink {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/api/v1/repos/alice/repo/entity-issues?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("list entity issues (%s): expected 200, got %d", query, resp.StatusCode)
+		}
+		var links []models.IssueEntityLink
+		if err := json.NewDecoder(resp.Body).Decode(&links); err != nil {
+			t.Fatal(err)
+		}
+		return links
+	}
+	for _, query := range []string{"stable_id=ent-process", "path=orders/orders.go", "path=orders&ref=main"} {
+		links := listEntityIssues(query)
+		if len(links) != 1 || links[0].IssueNumber != 1 || links[0].EntityName != "ProcessOrder" {
+			t.Fatalf("list entity issues (%s): unexpected links %+v", query, links)
+		}
+	}
+	if links := listEntityIssues("path=README.md"); len(links) != 0 {
+		t.Fatalf("expected no issues for unrelated file, got %+v", links)
+	}
+
+	req, _ = http.NewRequest("DELETE", ts.URL+"/api/v1/repos/alice/repo/issues/1/entities/ent-process", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("unlink entity: expected 204, got %d", resp.StatusCode)
+	}
+	if links := listEntityIssues("stable_id=ent-process"); len(links) != 0 {
+		t.Fatalf("expected no issues after unlink, got %+v", links)
+	}
+}
+
+func TestWebhookPingRetriesAndRedelivery(t *testing.T) {
+	server, _ := setupTestServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	token := registerAndGetToken(t, ts.URL, "alice")
+	createRepo(t, ts.URL, token, "repo", false)
+
+	var recvCount int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&recvCount, 1)
+		if r.Header.Get("X-Gothub-Event") != "ping" {
+			t.Errorf("expected X-Gothub-Event ping, got %q", r.Header.Get("X-Gothub-Event"))
+		}
+		if r.Header.Get("X-Gothub-Delivery") == "" {
+			t.Errorf("expected X-Gothub-Delivery header")
+		}
+		if !strings.HasPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=") {
+			t.Errorf("expected HMAC signature header, got %q", r.Header.Get("X-Hub-Signature-256"))
+		}
+		if atomic.LoadInt32(&recvCount) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("temporary failure"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	createHookBody := fmt.Sprintf(`{"url":"%s","secret":"topsecret","events":["ping"],"active":true}`, receiver.URL)
+	req, _ := http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/webhooks", bytes.NewBufferString(createHookBody))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create webhook: expected 201, got %d", resp.StatusCode)
+	}
+	var hook struct {
+		ID        int64 `json:"id"`
+		HasSecret bool  `json:"has_secret"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&hook); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if hook.ID == 0 {
+		t.Fatal("expected webhook id")
+	}
+	if !hook.HasSecret {
+		t.Fatal("expected has_secret=true")
+	}
+
+	req, _ = http.NewRequest("POST", fmt.Sprintf("%s/api/v1/repos/alice/repo/webhooks/%d/ping", ts.URL, hook.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ping webhook: expected 200, got %d", resp.StatusCode)
+	}
+	var pingDelivery struct {
+		ID      int64 `json:"id"`
+		Attempt int   `json:"attempt"`
+		Success bool  `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&pingDelivery); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if pingDelivery.ID == 0 || !pingDelivery.Success || pingDelivery.Attempt != 3 {
+		t.Fatalf("unexpected ping delivery: %+v", pingDelivery)
+	}
+	if atomic.LoadInt32(&recvCount) != 3 {
+		t.Fatalf("expected 3 delivery attempts, got %d", atomic.LoadInt32(&recvCount))
+	}
+
+	resp, err = http.Get(fmt.Sprintf("%s/api/v1/repos/alice/repo/webhooks/%d/deliveries", ts.URL, hook.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("list deliveries: expected 200, got %d", resp.StatusCode)
+	}
+	var deliveries []struct {
+		ID             int64  `json:"id"`
+		Attempt        int    `json:"attempt"`
+		DeliveryUID    string `json:"delivery_uid"`
+		Success        bool   `json:"success"`
+		RedeliveryOfID *int64 `json:"redelivery_of_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&deliveries); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(deliveries) != 3 {
+		t.Fatalf("expected 3 delivery rows, got %d", len(deliveries))
+	}
+	var originalID int64
+	for _, d := range deliveries {
+		if d.Attempt == 1 {
+			originalID = d.ID
+			break
+		}
+	}
+	if originalID == 0 {
+		t.Fatalf("expected attempt 1 delivery in %+v", deliveries)
+	}
+
+	req, _ = http.NewRequest("POST", fmt.Sprintf("%s/api/v1/repos/alice/repo/webhooks/%d/deliveries/%d/redeliver", ts.URL, hook.ID, originalID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("redeliver: expected 200, got %d", resp.StatusCode)
+	}
+	var redelivery struct {
+		ID             int64  `json:"id"`
+		Attempt        int    `json:"attempt"`
+		RedeliveryOfID *int64 `json:"redelivery_of_id"`
+		Success        bool   `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&redelivery); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if redelivery.ID == 0 || !redelivery.Success || redelivery.RedeliveryOfID == nil || *redelivery.RedeliveryOfID != originalID {
+		t.Fatalf("unexpected redelivery response: %+v", redelivery)
+	}
+
+	resp, err = http.Get(fmt.Sprintf("%s/api/v1/repos/alice/repo/webhooks/%d/deliveries", ts.URL, hook.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("list deliveries after redelivery: expected 200, got %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&deliveries); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(deliveries) != 4 {
+		t.Fatalf("expected 4 delivery rows after redelivery, got %d", len(deliveries))
+	}
+}
+
+func TestWebhookSecretRotationSignsWithBothSecrets(t *testing.T) {
+	server, _ := setupTestServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	token := registerAndGetToken(t, ts.URL, "alice")
+	createRepo(t, ts.URL, token, "repo", false)
+
+	type capture struct {
+		header http.Header
+		body   []byte
+	}
+	captured := make(chan capture, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		captured <- capture{header: r.Header.Clone(), body: body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	sign := func(secret string, parts ...[]byte) string {
+		m := hmac.New(sha256.New, []byte(secret))
+		for _, p := range parts {
+			m.Write(p)
+		}
+		return hex.EncodeToString(m.Sum(nil))
+	}
+	send := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	ping := func(hookID int64) capture {
+		t.Helper()
+		resp := send("POST", fmt.Sprintf("/api/v1/repos/alice/repo/webhooks/%d/ping", hookID), "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("ping webhook: expected 200, got %d", resp.StatusCode)
+		}
+		return <-captured
+	}
+
+	resp := send("POST", "/api/v1/repos/alice/repo/webhooks", fmt.Sprintf(`{"url":"%s","secret":"old-secret","events":["ping"]}`, receiver.URL))
+	var hook struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&hook); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp = send("PATCH", fmt.Sprintf("/api/v1/repos/alice/repo/webhooks/%d", hook.ID), `{"secret":"new-secret","secret_rotation_seconds":3600,"timestamped_signature":true}`)
+	var updated struct {
+		PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at"`
+		TimestampedSignature    bool       `json:"timestamped_signature"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&updated); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || updated.PreviousSecretExpiresAt == nil || !updated.TimestampedSignature {
+		t.Fatalf("unexpected update response %d: %+v", resp.StatusCode, updated)
+	}
+
+	got := ping(hook.ID)
+	if want := "sha256=" + sign("new-secret", got.body); got.header.Get("X-Hub-Signature-256") != want {
+		t.Fatalf("expected signature with new secret, got %q", got.header.Get("X-Hub-Signature-256"))
+	}
+	if want := "sha256=" + sign("old-secret", got.body); got.header.Get("X-Hub-Signature-256-Previous") != want {
+		t.Fatalf("expected signature with previous secret, got %q", got.header.Get("X-Hub-Signature-256-Previous"))
+	}
+	parts := strings.Split(got.header.Get("X-Gothub-Signature"), ",")
+	if len(parts) != 3 || !strings.HasPrefix(parts[0], "t=") {
+		t.Fatalf("unexpected timestamped signature %q", got.header.Get("X-Gothub-Signature"))
+	}
+	ts0 := []byte(strings.TrimPrefix(parts[0], "t=") + ".")
+	if parts[1] != "v1="+sign("new-secret", ts0, got.body) || parts[2] != "v1="+sign("old-secret", ts0, got.body) {
+		t.Fatalf("timestamped signatures do not verify: %q", got.header.Get("X-Gothub-Signature"))
+	}
+
+	// Changing the secret without a window drops the previous one at once.
+	resp = send("PATCH", fmt.Sprintf("/api/v1/repos/alice/repo/webhooks/%d", hook.ID), `{"secret":"newest-secret"}`)
+	resp.Body.Close()
+	got = ping(hook.ID)
+	if got.header.Get("X-Hub-Signature-256-Previous") != "" || len(strings.Split(got.header.Get("X-Gothub-Signature"), ",")) != 2 {
+		t.Fatalf("expected only the current secret to sign, got %v", got.header)
+	}
+
+	resp = send("PATCH", fmt.Sprintf("/api/v1/repos/alice/repo/webhooks/%d", hook.ID), `{"events":["not_an_event"]}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected unknown event to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestPullRequestWebhookIncludesEntityChanges(t *testing.T) {
+	server, db := setupTestServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	token := registerAndGetToken(t, ts.URL, "alice")
+	createRepo(t, ts.URL, token, "repo", false)
+
+	repo, err := db.GetRepository(context.Background(), "alice", "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := gotstore.Open(repo.StoragePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseBlobHash, err := store.Objects.WriteBlob(&object.Blob{Data: []byte("package main\n\nfunc ProcessOrder() int { return 1 }\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseTreeHash, err := store.Objects.WriteTree(&object.TreeObj{
+		Entries: []object.TreeEntry{{Name: "main.go", BlobHash: baseBlobHash}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseCommitHash, err := store.Objects.WriteCommit(&object.CommitObj{
+		TreeHash:  baseTreeHash,
+		Author:    "alice",
+		Timestamp: 1700000000,
+		Message:   "base",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headBlobHash, err := store.Objects.WriteBlob(&object.Blob{Data: []byte("package main\n\nfunc ProcessOrder() int { return 2 }\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	headTreeHash, err := store.Objects.WriteTree(&object.TreeObj{
+		Entries: []object.TreeEntry{{Name: "main.go", BlobHash: headBlobHash}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	headCommitHash, err := store.Objects.WriteCommit(&object.CommitObj{
+		TreeHash:  headTreeHash,
+		Parents:   []object.Hash{baseCommitHash},
+		Author:    "alice",
+		Timestamp: 1700000100,
+		Message:   "feature",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Refs.Set("heads/main", baseCommitHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Refs.Set("heads/feature", headCommitHash); err != nil {
+		t.Fatal(err)
+	}
+
+	type prWebhookPayload struct {
+		Action          string `json:"action"`
+		EntitiesChanged []struct {
+			File string `json:"file"`
+			Type string `json:"type"`
+			Key  string `json:"key"`
+		} `json:"entities_changed"`
+		EntitiesAdded    int `json:"entities_added"`
+		EntitiesRemoved  int `json:"entities_removed"`
+		EntitiesModified int `json:"entities_modified"`
+	}
+
+	payloadCh := make(chan prWebhookPayload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Gothub-Event") != "pull_request" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		var payload prWebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		select {
+		case payloadCh <- payload:
+		default:
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	createHookBody := fmt.Sprintf(`{"url":"%s","secret":"topsecret","events":["pull_request"],"active":true}`, receiver.URL)
+	req, _ := http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/webhooks", bytes.NewBufferString(createHookBody))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create webhook: expected 201, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	req, _ = http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/pulls", bytes.NewBufferString(`{"title":"entity webhook","source_branch":"feature","target_branch":"main"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create PR: expected 201, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	select {
+	case payload := <-payloadCh:
+		if payload.Action != "opened" {
+			t.Fatalf("expected pull_request action opened, got %q", payload.Action)
+		}
 		if payload.EntitiesModified < 1 {
 			t.Fatalf("expected at least one modified entity, got %+v", payload)
 		}
-		if len(payload.EntitiesChanged) == 0 {
-			t.Fatalf("expected entities_changed entries, got %+v", payload)
+		if len(payload.EntitiesChanged) == 0 {
+			t.Fatalf("expected entities_changed entries, got %+v", payload)
+		}
+	case <-time.After(4 * time.Second):
+		t.Fatal("timed out waiting for pull_request webhook payload")
+	}
+}
+
+func TestNotificationsLifecycle(t *testing.T) {
+	server, _ := setupTestServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	aliceToken := registerAndGetToken(t, ts.URL, "alice")
+	bobToken := registerAndGetToken(t, ts.URL, "bob")
+	createRepo(t, ts.URL, aliceToken, "repo", false)
+
+	// Give bob write access so he can open PRs/issues.
+	addCollabBody := `{"username":"bob","role":"write"}`
+	req, _ := http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/collaborators", bytes.NewBufferString(addCollabBody))
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("add collaborator: expected 201, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+	acceptInvitations(t, ts.URL, bobToken)
+
+	// Bob opens PR -> Alice gets notification.
+	createPRReq := `{"title":"PR from bob","source_branch":"feature","target_branch":"main"}`
+	req, _ = http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/pulls", bytes.NewBufferString(createPRReq))
+	req.Header.Set("Authorization", "Bearer "+bobToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create PR: expected 201, got %d", resp.StatusCode)
+	}
+	var prResp struct {
+		Number int `json:"number"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&prResp); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	req, _ = http.NewRequest("GET", ts.URL+"/api/v1/notifications/unread-count", nil)
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unread count: expected 200, got %d", resp.StatusCode)
+	}
+	var unreadCount struct {
+		Count int `json:"count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&unreadCount); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if unreadCount.Count != 1 {
+		t.Fatalf("expected 1 unread notification for alice, got %d", unreadCount.Count)
+	}
+
+	req, _ = http.NewRequest("GET", ts.URL+"/api/v1/notifications?unread=true", nil)
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("list notifications: expected 200, got %d", resp.StatusCode)
+	}
+	var notifications []struct {
+		ID    int64  `json:"id"`
+		Type  string `json:"type"`
+		Title string `json:"title"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&notifications); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(notifications) != 1 {
+		t.Fatalf("expected 1 unread notification, got %d", len(notifications))
+	}
+	if notifications[0].Type != "pull_request.opened" {
+		t.Fatalf("unexpected notification type %q", notifications[0].Type)
+	}
+
+	// Mark one as read.
+	req, _ = http.NewRequest("POST", fmt.Sprintf("%s/api/v1/notifications/%d/read", ts.URL, notifications[0].ID), nil)
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("mark notification read: expected 204, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	req, _ = http.NewRequest("GET", ts.URL+"/api/v1/notifications/unread-count", nil)
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&unreadCount); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if unreadCount.Count != 0 {
+		t.Fatalf("expected 0 unread notifications after mark read, got %d", unreadCount.Count)
+	}
+
+	// Alice comments on bob's PR -> Bob gets notified.
+	commentReq := `{"body":"Looks good","entity_key":"ProcessOrder","entity_stable_id":"ent_process_order"}`
+	req, _ = http.NewRequest("POST", fmt.Sprintf("%s/api/v1/repos/alice/repo/pulls/%d/comments", ts.URL, prResp.Number), bytes.NewBufferString(commentReq))
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create PR comment: expected 201, got %d", resp.StatusCode)
+	}
+	var createdComment struct {
+		EntityKey      string `json:"entity_key"`
+		EntityStableID string `json:"entity_stable_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&createdComment); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if createdComment.EntityKey != "ProcessOrder" || createdComment.EntityStableID != "ent_process_order" {
+		t.Fatalf("unexpected PR comment anchors: %+v", createdComment)
+	}
+
+	req, _ = http.NewRequest("GET", ts.URL+"/api/v1/notifications/unread-count", nil)
+	req.Header.Set("Authorization", "Bearer "+bobToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&unreadCount); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if unreadCount.Count != 1 {
+		t.Fatalf("expected 1 unread notification for bob, got %d", unreadCount.Count)
+	}
+}
+
+func TestNotificationEmailsThreadPerIssue(t *testing.T) {
+	server, _, mailbox := setupTestServerWithMailbox(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	aliceToken := registerAndGetToken(t, ts.URL, "alice")
+	bobToken := registerAndGetToken(t, ts.URL, "bob")
+	createRepo(t, ts.URL, aliceToken, "repo", false)
+
+	post := func(token, path, body string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST %s: expected 201, got %d", path, resp.StatusCode)
+		}
+	}
+	post(aliceToken, "/api/v1/repos/alice/repo/collaborators", `{"username":"bob","role":"write"}`)
+	acceptInvitations(t, ts.URL, bobToken)
+	post(bobToken, "/api/v1/repos/alice/repo/issues", `{"title":"Crash on start","body":"stack trace"}`)
+	opened := takeEmail(t, mailbox, "alice@example.com")
+	post(bobToken, "/api/v1/repos/alice/repo/issues/1/comments", `{"body":"Also on arm64"}`)
+	commented := takeEmail(t, mailbox, "alice@example.com")
+
+	if got := opened.Header.Get("Subject"); got != "Issue #1 opened in alice/repo" {
+		t.Fatalf("unexpected subject %q", got)
+	}
+	if !strings.Contains(opened.Body, "https://gothub.test/alice/repo/issues/1") {
+		t.Fatalf("expected issue link in body:\n%s", opened.Body)
+	}
+	root := opened.Header.Get("In-Reply-To")
+	if root == "" || commented.Header.Get("In-Reply-To") != root || commented.Header.Get("References") != root {
+		t.Fatalf("expected both emails to thread under one root, got %q and %q", root, commented.Header.Get("In-Reply-To"))
+	}
+	if opened.Header.Get("Message-ID") == commented.Header.Get("Message-ID") {
+		t.Fatal("expected distinct Message-IDs")
+	}
+	replyTo, err := netmail.ParseAddress(commented.Header.Get("Reply-To"))
+	if err != nil {
+		t.Fatalf("parse Reply-To: %v", err)
+	}
+	if !strings.HasPrefix(replyTo.Address, "reply+") || !strings.HasSuffix(replyTo.Address, "@reply.gothub.test") {
+		t.Fatalf("unexpected Reply-To %q", replyTo.Address)
+	}
+	if opened.Header.Get("Reply-To") != commented.Header.Get("Reply-To") {
+		t.Fatal("expected one reply address per user and thread")
+	}
+}
+
+func TestInboundMailReplyCreatesComment(t *testing.T) {
+	server, db, mailbox := setupTestServerWithMailbox(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	aliceToken := registerAndGetToken(t, ts.URL, "alice")
+	bobToken := registerAndGetToken(t, ts.URL, "bob")
+	createRepo(t, ts.URL, aliceToken, "repo", false)
+	for i, call := range []struct{ token, path, body string }{
+		{aliceToken, "/api/v1/repos/alice/repo/collaborators", `{"username":"bob","role":"write"}`},
+		{bobToken, "/api/v1/repos/alice/repo/issues", `{"title":"Crash on start","body":"stack trace"}`},
+	} {
+		if i == 1 {
+			if invite := takeEmail(t, mailbox, "bob@example.com"); invite.Header.Get("Subject") != "alice invited you to join alice/repo" {
+				t.Fatalf("expected an invitation email for bob, got %q", invite.Header.Get("Subject"))
+			}
+			acceptInvitations(t, ts.URL, bobToken)
+		}
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+call.path, bytes.NewBufferString(call.body))
+		req.Header.Set("Authorization", "Bearer "+call.token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST %s: expected 201, got %d", call.path, resp.StatusCode)
+		}
+	}
+	opened := takeEmail(t, mailbox, "alice@example.com")
+	replyTo := opened.Header.Get("Reply-To")
+	if replyTo == "" {
+		t.Fatal("expected notification to carry a reply address")
+	}
+
+	reply := func(from, secret, extraHeaders string) *http.Response {
+		t.Helper()
+		raw := "From: " + from + "\r\n" +
+			"To: " + replyTo + "\r\n" +
+			"Subject: Re: Issue #1 opened in alice/repo\r\n" +
+			"Message-ID: <reply-1@example.com>\r\n" +
+			extraHeaders +
+			"Content-Type: text/plain; charset=utf-8\r\n" +
+			"\r\n" +
+			"Fixed in main, please retry.\r\n" +
+			"\r\n" +
+			"On Mon, Jan 5, 2026 at 9:00 AM gothub <noreply@localhost> wrote:\r\n" +
+			"> stack trace\r\n"
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/mail/inbound", strings.NewReader(raw))
+		req.Header.Set("Content-Type", "message/rfc822")
+		if secret != "" {
+			req.Header.Set("X-Gothub-Inbound-Secret", secret)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := reply("alice@example.com", "wrong", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for bad inbound secret, got %d", resp.StatusCode)
+	}
+	if resp := reply("mallory@example.com", "inbound-secret", ""); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for mismatched sender, got %d", resp.StatusCode)
+	}
+	if resp := reply("alice@example.com", "inbound-secret", "Auto-Submitted: auto-replied\r\n"); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected auto-reply to be ignored with 202, got %d", resp.StatusCode)
+	}
+	alice, err := db.GetUserByUsername(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	suspendedAt := time.Now()
+	if err := db.SetUserSuspended(context.Background(), alice.ID, &suspendedAt); err != nil {
+		t.Fatal(err)
+	}
+	if resp := reply("alice@example.com", "inbound-secret", ""); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for a suspended sender, got %d", resp.StatusCode)
+	}
+	if err := db.SetUserSuspended(context.Background(), alice.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if resp := reply("Alice <ALICE@example.com>", "inbound-secret", ""); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected reply to create a comment, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/repos/alice/repo/issues/1/comments", nil)
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var comments []struct {
+		Body     string `json:"body"`
+		AuthorID int64  `json:"author_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&comments); err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 1 || comments[0].Body != "Fixed in main, please retry." {
+		t.Fatalf("expected one comment with quoted text stripped, got %+v", comments)
+	}
+	// The comment goes through the normal path, so the issue author hears
+	// about it.
+	commented := takeEmail(t, mailbox, "bob@example.com")
+	if !strings.Contains(commented.Body, "Fixed in main, please retry.") {
+		t.Fatalf("expected bob to be notified of the emailed comment:\n%s", commented.Body)
+	}
+}
+
+func TestNotificationSettingsEmailFrequency(t *testing.T) {
+	server, _ := setupTestServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	token := registerAndGetToken(t, ts.URL, "alice")
+	call := func(method, body string, wantStatus int) string {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+"/api/v1/user/notification-settings", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("%s notification-settings: expected %d, got %d", method, wantStatus, resp.StatusCode)
 		}
-	case <-time.After(4 * time.Second):
-		t.Fatal("timed out waiting for pull_request webhook payload")
+		var settings struct {
+			EmailFrequency string `json:"email_frequency"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&settings)
+		return settings.EmailFrequency
+	}
+	if got := call(http.MethodGet, "", http.StatusOK); got != "instant" {
+		t.Fatalf("expected instant by default, got %q", got)
+	}
+	call(http.MethodPut, `{"email_frequency":"hourly"}`, http.StatusBadRequest)
+	if got := call(http.MethodPut, `{"email_frequency":"weekly"}`, http.StatusOK); got != "weekly" {
+		t.Fatalf("expected weekly after update, got %q", got)
+	}
+	if got := call(http.MethodGet, "", http.StatusOK); got != "weekly" {
+		t.Fatalf("expected weekly to persist, got %q", got)
+	}
+}
+
+func TestTwoFactorSignInChallengeAndOrgPolicy(t *testing.T) {
+	mailbox := t.TempDir()
+	server, db := setupTestServerWithOptions(t, api.ServerOptions{
+		Mailer:              mail.NewFileSender(mailbox),
+		EnableOrganizations: true,
+	})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	call := func(method, path, token, body string, wantStatus int, out any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			raw, _ := io.ReadAll(resp.Body)
+			t.Fatalf("%s %s: expected %d, got %d: %s", method, path, wantStatus, resp.StatusCode, raw)
+		}
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	aliceToken := registerAndGetToken(t, ts.URL, "alice")
+	bobToken := registerAndGetToken(t, ts.URL, "bob")
+	registerAndGetToken(t, ts.URL, "carol")
+
+	var enrollment struct {
+		Secret string `json:"secret"`
+		URI    string `json:"provisioning_uri"`
+	}
+	call(http.MethodPost, "/api/v1/user/2fa/totp", aliceToken, "", http.StatusOK, &enrollment)
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") || !strings.Contains(enrollment.URI, enrollment.Secret) {
+		t.Fatalf("unexpected provisioning uri %q", enrollment.URI)
+	}
+	call(http.MethodPost, "/api/v1/user/2fa/totp/confirm", aliceToken, `{"code":"000000"}`, http.StatusUnprocessableEntity, nil)
+	code, err := auth.TOTPCode(enrollment.Secret, auth.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	call(http.MethodPost, "/api/v1/user/2fa/totp/confirm", aliceToken, fmt.Sprintf(`{"code":%q}`, code), http.StatusOK, &confirmed)
+	if len(confirmed.RecoveryCodes) == 0 {
+		t.Fatal("expected recovery codes")
+	}
+
+	// A magic link is now only the first factor.
+	call(http.MethodPost, "/api/v1/auth/magic/request", "", `{"email":"alice@example.com"}`, http.StatusOK, nil)
+	magic := takeMagicToken(t, mailbox, "alice@example.com")
+	var challenge struct {
+		Token             string `json:"token"`
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		Challenge         string `json:"challenge"`
+	}
+	call(http.MethodPost, "/api/v1/auth/magic/verify", "", fmt.Sprintf(`{"token":%q}`, magic), http.StatusOK, &challenge)
+	if !challenge.TwoFactorRequired || challenge.Challenge == "" || challenge.Token != "" {
+		t.Fatalf("expected a two-factor challenge instead of a token, got %+v", challenge)
+	}
+	var retry struct {
+		Challenge string `json:"challenge"`
+	}
+	call(http.MethodPost, "/api/v1/auth/2fa/verify", "", fmt.Sprintf(`{"challenge":%q,"code":"000000"}`, challenge.Challenge), http.StatusUnauthorized, &retry)
+	if retry.Challenge == "" || retry.Challenge == challenge.Challenge {
+		t.Fatalf("expected a replacement challenge, got %q", retry.Challenge)
+	}
+	var signedIn struct {
+		Token string `json:"token"`
+	}
+	call(http.MethodPost, "/api/v1/auth/2fa/verify", "", fmt.Sprintf(`{"challenge":%q,"code":%q}`, retry.Challenge, confirmed.RecoveryCodes[0]), http.StatusOK, &signedIn)
+	if signedIn.Token == "" {
+		t.Fatal("expected a session token after the second factor")
+	}
+	var status struct {
+		TOTPEnabled            bool `json:"totp_enabled"`
+		RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+	}
+	call(http.MethodGet, "/api/v1/user/2fa", signedIn.Token, "", http.StatusOK, &status)
+	if !status.TOTPEnabled || status.RecoveryCodesRemaining != len(confirmed.RecoveryCodes)-1 {
+		t.Fatalf("unexpected two-factor status %+v", status)
+	}
+
+	// Org policy: bob loses access to the org's private repo until he has a
+	// strong factor, and carol cannot be added without one.
+	call(http.MethodPost, "/api/v1/orgs", aliceToken, `{"name":"acme"}`, http.StatusCreated, nil)
+	call(http.MethodPost, "/api/v1/orgs/acme/members", aliceToken, `{"username":"bob"}`, http.StatusCreated, nil)
+	acceptInvitations(t, ts.URL, bobToken)
+	org, err := db.GetOrg(context.Background(), "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateRepository(context.Background(), &models.Repository{
+		OwnerOrgID: &org.ID, Name: "secret", DefaultBranch: "main", IsPrivate: true, StoragePath: "pending",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	call(http.MethodGet, "/api/v1/repos/acme/secret", bobToken, "", http.StatusOK, nil)
+
+	call(http.MethodPut, "/api/v1/orgs/acme/security", bobToken, `{"require_two_factor":true}`, http.StatusForbidden, nil)
+	var security struct {
+		RequireTwoFactor    bool     `json:"require_two_factor"`
+		NonCompliantMembers []string `json:"non_compliant_members"`
+	}
+	call(http.MethodPut, "/api/v1/orgs/acme/security", aliceToken, `{"require_two_factor":true}`, http.StatusOK, &security)
+	if !security.RequireTwoFactor || len(security.NonCompliantMembers) != 1 || security.NonCompliantMembers[0] != "bob" {
+		t.Fatalf("unexpected org security %+v", security)
+	}
+	call(http.MethodGet, "/api/v1/repos/acme/secret", bobToken, "", http.StatusNotFound, nil)
+	call(http.MethodGet, "/api/v1/repos/acme/secret", signedIn.Token, "", http.StatusOK, nil)
+	call(http.MethodPost, "/api/v1/orgs/acme/members", aliceToken, `{"username":"carol"}`, http.StatusConflict, nil)
+	call(http.MethodPost, "/api/v1/user/2fa/totp/disable", aliceToken, fmt.Sprintf(`{"code":%q}`, confirmed.RecoveryCodes[1]), http.StatusConflict, nil)
+}
+
+func TestOrgTeamRepoPermissions(t *testing.T) {
+	server, db := setupTestServerWithOptions(t, api.ServerOptions{EnableOrganizations: true})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	call := func(method, path, token, body string, wantStatus int, out any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			raw, _ := io.ReadAll(resp.Body)
+			t.Fatalf("%s %s: expected %d, got %d: %s", method, path, wantStatus, resp.StatusCode, raw)
+		}
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	aliceToken := registerAndGetToken(t, ts.URL, "alice")
+	bobToken := registerAndGetToken(t, ts.URL, "bob")
+	registerAndGetToken(t, ts.URL, "carol")
+	call(http.MethodPost, "/api/v1/orgs", aliceToken, `{"name":"acme"}`, http.StatusCreated, nil)
+	call(http.MethodPost, "/api/v1/orgs/acme/members", aliceToken, `{"username":"bob"}`, http.StatusCreated, nil)
+	acceptInvitations(t, ts.URL, bobToken)
+	org, err := db.GetOrg(context.Background(), "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateRepository(context.Background(), &models.Repository{
+		OwnerOrgID: &org.ID, Name: "secret", DefaultBranch: "main", IsPrivate: true, StoragePath: "pending",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Members keep write access by default; owners can take it away.
+	call(http.MethodGet, "/api/v1/repos/acme/secret", bobToken, "", http.StatusOK, nil)
+	call(http.MethodPatch, "/api/v1/orgs/acme", bobToken, `{"default_repo_permission":"none"}`, http.StatusForbidden, nil)
+	call(http.MethodPatch, "/api/v1/orgs/acme", aliceToken, `{"default_repo_permission":"admin"}`, http.StatusBadRequest, nil)
+	call(http.MethodPatch, "/api/v1/orgs/acme", aliceToken, `{"default_repo_permission":"none"}`, http.StatusOK, nil)
+	call(http.MethodGet, "/api/v1/repos/acme/secret", bobToken, "", http.StatusNotFound, nil)
+	var repos []models.Repository
+	call(http.MethodGet, "/api/v1/orgs/acme/repos", bobToken, "", http.StatusOK, &repos)
+	if len(repos) != 0 {
+		t.Fatalf("expected the private repo to be hidden, got %+v", repos)
+	}
+
+	// Bob reaches the repo through the parent of his team.
+	call(http.MethodPost, "/api/v1/orgs/acme/teams", bobToken, `{"name":"eng"}`, http.StatusForbidden, nil)
+	call(http.MethodPost, "/api/v1/orgs/acme/teams", aliceToken, `{"name":"eng"}`, http.StatusCreated, nil)
+	call(http.MethodPost, "/api/v1/orgs/acme/teams", aliceToken, `{"name":"backend","parent":"eng"}`, http.StatusCreated, nil)
+	call(http.MethodPut, "/api/v1/orgs/acme/teams/backend/members/carol", aliceToken, "", http.StatusBadRequest, nil)
+	call(http.MethodPut, "/api/v1/orgs/acme/teams/backend/members/bob", aliceToken, "", http.StatusNoContent, nil)
+	call(http.MethodPut, "/api/v1/orgs/acme/teams/eng/repos/secret", aliceToken, `{"permission":"read"}`, http.StatusNoContent, nil)
+	call(http.MethodGet, "/api/v1/repos/acme/secret", bobToken, "", http.StatusOK, nil)
+	call(http.MethodPost, "/api/v1/repos/acme/secret/collaborators", bobToken, `{"username":"carol"}`, http.StatusNotFound, nil)
+	call(http.MethodPut, "/api/v1/orgs/acme/teams/backend/repos/secret", aliceToken, `{"permission":"write"}`, http.StatusNoContent, nil)
+	call(http.MethodPost, "/api/v1/repos/acme/secret/collaborators", bobToken, `{"username":"carol"}`, http.StatusCreated, nil)
+
+	var teams []models.Team
+	call(http.MethodGet, "/api/v1/orgs/acme/teams", bobToken, "", http.StatusOK, &teams)
+	if len(teams) != 2 || teams[0].Name != "backend" || teams[0].ParentID == nil {
+		t.Fatalf("unexpected teams %+v", teams)
+	}
+	var teamRepos []models.TeamRepo
+	call(http.MethodGet, "/api/v1/orgs/acme/teams/backend/repos", bobToken, "", http.StatusOK, &teamRepos)
+	if len(teamRepos) != 1 || teamRepos[0].RepoName != "secret" || teamRepos[0].Permission != "write" {
+		t.Fatalf("unexpected team repos %+v", teamRepos)
+	}
+	call(http.MethodGet, "/api/v1/orgs/acme/teams", registerAndGetToken(t, ts.URL, "dave"), "", http.StatusForbidden, nil)
+
+	call(http.MethodDelete, "/api/v1/orgs/acme/members/bob", aliceToken, "", http.StatusNoContent, nil)
+	call(http.MethodGet, "/api/v1/repos/acme/secret", bobToken, "", http.StatusNotFound, nil)
+}
+
+func TestInvitationsAcceptDeclineAndEmailSignup(t *testing.T) {
+	dir := t.TempDir()
+	server, db := setupTestServerWithOptions(t, api.ServerOptions{
+		Mailer:              mail.NewFileSender(dir),
+		PublicURL:           "https://gothub.test",
+		EnableOrganizations: true,
+	})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	call := func(method, path, token, body string, wantStatus int, out any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			raw, _ := io.ReadAll(resp.Body)
+			t.Fatalf("%s %s: expected %d, got %d: %s", method, path, wantStatus, resp.StatusCode, raw)
+		}
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	aliceToken := registerAndGetToken(t, ts.URL, "alice")
+	bobToken := registerAndGetToken(t, ts.URL, "bob")
+	alice, err := db.GetUserByUsername(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateRepository(context.Background(), &models.Repository{
+		OwnerUserID: &alice.ID, Name: "secret", DefaultBranch: "main", IsPrivate: true, StoragePath: "pending",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Adding a collaborator only invites them; declining leaves no access.
+	call(http.MethodPost, "/api/v1/repos/alice/secret/collaborators", aliceToken, `{"username":"nobody"}`, http.StatusNotFound, nil)
+	var inv models.Invitation
+	call(http.MethodPost, "/api/v1/repos/alice/secret/collaborators", aliceToken, `{"username":"bob","role":"write"}`, http.StatusCreated, &inv)
+	call(http.MethodGet, "/api/v1/repos/alice/secret", bobToken, "", http.StatusNotFound, nil)
+	var pending []models.Invitation
+	call(http.MethodGet, "/api/v1/repos/alice/secret/invitations", aliceToken, "", http.StatusOK, &pending)
+	if len(pending) != 1 || pending[0].InviteeName != "bob" {
+		t.Fatalf("unexpected pending invitations %+v", pending)
+	}
+	call(http.MethodGet, "/api/v1/repos/alice/secret/invitations", bobToken, "", http.StatusNotFound, nil)
+	call(http.MethodPost, fmt.Sprintf("/api/v1/user/invitations/%d/decline", inv.ID), bobToken, "", http.StatusNoContent, nil)
+	call(http.MethodPost, fmt.Sprintf("/api/v1/user/invitations/%d/accept", inv.ID), bobToken, "", http.StatusNotFound, nil)
+	call(http.MethodGet, "/api/v1/repos/alice/secret", bobToken, "", http.StatusNotFound, nil)
+
+	// Revoked invitations cannot be accepted.
+	call(http.MethodPost, "/api/v1/repos/alice/secret/collaborators", aliceToken, `{"username":"bob"}`, http.StatusCreated, &inv)
+	call(http.MethodDelete, fmt.Sprintf("/api/v1/repos/alice/secret/invitations/%d", inv.ID), aliceToken, "", http.StatusNoContent, nil)
+	call(http.MethodPost, fmt.Sprintf("/api/v1/user/invitations/%d/accept", inv.ID), bobToken, "", http.StatusNotFound, nil)
+
+	call(http.MethodPost, "/api/v1/repos/alice/secret/collaborators", aliceToken, `{"username":"bob"}`, http.StatusCreated, &inv)
+	call(http.MethodPost, fmt.Sprintf("/api/v1/user/invitations/%d/accept", inv.ID), aliceToken, "", http.StatusNotFound, nil)
+	call(http.MethodPost, fmt.Sprintf("/api/v1/user/invitations/%d/accept", inv.ID), bobToken, "", http.StatusNoContent, nil)
+	call(http.MethodGet, "/api/v1/repos/alice/secret", bobToken, "", http.StatusOK, nil)
+	call(http.MethodPost, "/api/v1/repos/alice/secret/collaborators", aliceToken, `{"username":"bob"}`, http.StatusConflict, nil)
+
+	// An email invitation signs up an account for the invited address.
+	call(http.MethodPost, "/api/v1/orgs", aliceToken, `{"name":"acme"}`, http.StatusCreated, nil)
+	call(http.MethodPost, "/api/v1/orgs/acme/members", aliceToken, `{"email":"carol@example.com"}`, http.StatusCreated, nil)
+	call(http.MethodGet, "/api/v1/orgs/acme/invitations", bobToken, "", http.StatusForbidden, nil)
+	call(http.MethodGet, "/api/v1/orgs/acme/invitations", aliceToken, "", http.StatusOK, &pending)
+	if len(pending) != 1 || pending[0].Email != "carol@example.com" {
+		t.Fatalf("unexpected pending org invitations %+v", pending)
+	}
+	msg := takeEmail(t, dir, "carol@example.com")
+	if subject := msg.Header.Get("Subject"); subject != "alice invited you to acme on gothub" {
+		t.Fatalf("unexpected subject %q", subject)
+	}
+	match := regexp.MustCompile(`token=([A-Za-z0-9_-]+)`).FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("expected an accept link in %q", msg.Body)
+	}
+	token := match[1]
+	call(http.MethodPost, "/api/v1/invitations/preview", "", `{"token":"wrong"}`, http.StatusNotFound, nil)
+	var preview struct {
+		Invitation    models.Invitation `json:"invitation"`
+		AccountExists bool              `json:"account_exists"`
+	}
+	call(http.MethodPost, "/api/v1/invitations/preview", "", `{"token":"`+token+`"}`, http.StatusOK, &preview)
+	if preview.AccountExists || preview.Invitation.Target != "acme" {
+		t.Fatalf("unexpected preview %+v", preview)
+	}
+	call(http.MethodPost, "/api/v1/invitations/accept", "", `{"token":"`+token+`"}`, http.StatusBadRequest, nil)
+	call(http.MethodPost, "/api/v1/invitations/accept", "", `{"token":"`+token+`","username":"bob"}`, http.StatusConflict, nil)
+	var signedIn struct {
+		Token string      `json:"token"`
+		User  models.User `json:"user"`
+	}
+	call(http.MethodPost, "/api/v1/invitations/accept", "", `{"token":"`+token+`","username":"carol"}`, http.StatusOK, &signedIn)
+	if signedIn.Token == "" || signedIn.User.Username != "carol" {
+		t.Fatalf("unexpected sign-in %+v", signedIn)
+	}
+	call(http.MethodPost, "/api/v1/invitations/accept", "", `{"token":"`+token+`","username":"carol"}`, http.StatusNotFound, nil)
+	carol, err := db.GetUserByUsername(context.Background(), "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	org, err := db.GetOrg(context.Background(), "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetOrgMember(context.Background(), org.ID, carol.ID); err != nil {
+		t.Fatalf("expected carol to be an org member: %v", err)
+	}
+	if verified, err := db.HasVerifiedEmail(context.Background(), carol.ID); err != nil || !verified {
+		t.Fatalf("expected the invited address to be verified, got %v %v", verified, err)
+	}
+
+	// An account that never verified its address is not invited as itself;
+	// the invitation goes to the address.
+	daveToken := registerAndGetToken(t, ts.URL, "dave")
+	var enrollment struct {
+		Secret string `json:"secret"`
+	}
+	call(http.MethodPost, "/api/v1/user/2fa/totp", daveToken, "", http.StatusOK, &enrollment)
+	code, err := auth.TOTPCode(enrollment.Secret, auth.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	call(http.MethodPost, "/api/v1/user/2fa/totp/confirm", daveToken, fmt.Sprintf(`{"code":%q}`, code), http.StatusOK, &confirmed)
+	call(http.MethodPost, "/api/v1/orgs/acme/members", aliceToken, `{"email":"dave@example.com"}`, http.StatusCreated, nil)
+	call(http.MethodGet, "/api/v1/user/invitations", daveToken, "", http.StatusOK, &pending)
+	if len(pending) != 0 {
+		t.Fatalf("unverified account should not be invited directly, got %+v", pending)
+	}
+	match = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`).FindStringSubmatch(takeEmail(t, dir, "dave@example.com").Body)
+	if match == nil {
+		t.Fatal("expected an accept link for dave@example.com")
+	}
+	token = match[1]
+
+	// The token proves the address, which ends sessions opened before, but a
+	// second factor still has to be verified before the invitation counts.
+	var challenge struct {
+		Token             string `json:"token"`
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		Challenge         string `json:"challenge"`
+	}
+	call(http.MethodPost, "/api/v1/invitations/accept", "", `{"token":"`+token+`"}`, http.StatusOK, &challenge)
+	if !challenge.TwoFactorRequired || challenge.Token != "" {
+		t.Fatalf("expected a two-factor challenge, got %+v", challenge)
+	}
+	call(http.MethodGet, "/api/v1/user/invitations", daveToken, "", http.StatusUnauthorized, nil)
+	dave, err := db.GetUserByUsername(context.Background(), "dave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetOrgMember(context.Background(), org.ID, dave.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("dave should not be a member before the second factor, got %v", err)
+	}
+	call(http.MethodPost, "/api/v1/auth/2fa/verify", "", fmt.Sprintf(`{"challenge":%q,"code":%q}`, challenge.Challenge, confirmed.RecoveryCodes[0]), http.StatusOK, &signedIn)
+	call(http.MethodPost, "/api/v1/invitations/accept", signedIn.Token, `{"token":"`+token+`"}`, http.StatusNoContent, nil)
+	if _, err := db.GetOrgMember(context.Background(), org.ID, dave.ID); err != nil {
+		t.Fatalf("expected dave to be an org member: %v", err)
+	}
+}
+
+func TestAuditLogRecordsSecurityChanges(t *testing.T) {
+	server, db := setupTestServerWithOptions(t, api.ServerOptions{EnableOrganizations: true})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	call := func(method, path, token, body string, wantStatus int, out any) http.Header {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			raw, _ := io.ReadAll(resp.Body)
+			t.Fatalf("%s %s: expected %d, got %d: %s", method, path, wantStatus, resp.StatusCode, raw)
+		}
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.Header
+	}
+	actions := func(events []models.AuditEvent) []string {
+		out := make([]string, len(events))
+		for i, e := range events {
+			out[i] = e.Action
+		}
+		return out
+	}
+
+	aliceToken := registerAndGetToken(t, ts.URL, "alice")
+	bobToken := registerAndGetToken(t, ts.URL, "bob")
+	carolToken := registerAndGetToken(t, ts.URL, "carol")
+	var repo models.Repository
+	call(http.MethodPost, "/api/v1/repos", aliceToken, `{"name":"app"}`, http.StatusCreated, &repo)
+
+	call(http.MethodPut, "/api/v1/repos/alice/app/branch-protection/main", aliceToken, `{"enabled":true,"require_approvals":true,"required_approvals":1}`, http.StatusOK, nil)
+	header := call(http.MethodPut, "/api/v1/repos/alice/app/branch-protection/main", aliceToken, `{"enabled":true,"require_approvals":true,"required_approvals":2}`, http.StatusOK, nil)
+	var runnerToken struct {
+		ID int64 `json:"id"`
+	}
+	call(http.MethodPost, "/api/v1/repos/alice/app/runners/tokens", aliceToken, `{"name":"ci"}`, http.StatusCreated, &runnerToken)
+	call(http.MethodDelete, fmt.Sprintf("/api/v1/repos/alice/app/runners/tokens/%d", runnerToken.ID), aliceToken, "", http.StatusNoContent, nil)
+	var hook struct {
+		ID int64 `json:"id"`
+	}
+	call(http.MethodPost, "/api/v1/repos/alice/app/webhooks", aliceToken, fmt.Sprintf(`{"url":"%s/hook","secret":"one","events":["ping"]}`, ts.URL), http.StatusCreated, &hook)
+	call(http.MethodPatch, fmt.Sprintf("/api/v1/repos/alice/app/webhooks/%d", hook.ID), aliceToken, `{"secret":"two"}`, http.StatusOK, nil)
+	call(http.MethodPost, "/api/v1/repos/alice/app/collaborators", aliceToken, `{"username":"bob","role":"write"}`, http.StatusCreated, nil)
+	acceptInvitations(t, ts.URL, bobToken)
+	call(http.MethodDelete, "/api/v1/repos/alice/app/collaborators/bob", aliceToken, "", http.StatusNoContent, nil)
+	call(http.MethodDelete, "/api/v1/repos/alice/app/collaborators/bob", aliceToken, "", http.StatusNotFound, nil)
+
+	// Only repository admins can read its log.
+	call(http.MethodGet, "/api/v1/repos/alice/app/audit", carolToken, "", http.StatusForbidden, nil)
+	var events []models.AuditEvent
+	call(http.MethodGet, "/api/v1/repos/alice/app/audit", aliceToken, "", http.StatusOK, &events)
+	want := []string{
+		"repo.collaborator.remove", "repo.collaborator.add", "repo.invitation.create",
+		"webhook.secret_rotate", "webhook.create",
+		"runner_token.delete", "runner_token.create",
+		"branch_protection.update", "branch_protection.create",
+	}
+	if got := actions(events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("audit actions = %v, want %v", got, want)
+	}
+	if events[1].ActorName != "bob" || events[0].ActorName != "alice" || events[0].Target != "alice/app:bob" {
+		t.Fatalf("unexpected collaborator events %+v", events[:2])
+	}
+	update := events[7]
+	if update.RequestID == "" || update.RequestID != header.Get("X-Request-ID") || update.IP != "127.0.0.1" || update.Target != "alice/app:main" {
+		t.Fatalf("unexpected branch protection event %+v", update)
+	}
+	if !strings.Contains(string(update.Before), `"required_approvals":1`) || !strings.Contains(string(update.After), `"required_approvals":2`) {
+		t.Fatalf("unexpected branch protection diff %s -> %s", update.Before, update.After)
+	}
+	if strings.Contains(string(update.After), "require_approvals") {
+		t.Fatalf("unchanged fields leaked into the diff: %s", update.After)
+	}
+
+	var page []models.AuditEvent
+	call(http.MethodGet, "/api/v1/repos/alice/app/audit?per_page=2", aliceToken, "", http.StatusOK, &page)
+	if len(page) != 2 || page[1].ID != events[1].ID {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+	call(http.MethodGet, fmt.Sprintf("/api/v1/repos/alice/app/audit?per_page=2&before=%d", page[1].ID), aliceToken, "", http.StatusOK, &page)
+	if len(page) != 2 || page[0].ID != events[2].ID {
+		t.Fatalf("unexpected second page %+v", page)
+	}
+	call(http.MethodGet, "/api/v1/repos/alice/app/audit?before=nope", aliceToken, "", http.StatusBadRequest, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/repos/alice/app/audit?format=ndjson", nil)
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("export content type = %q", ct)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) != len(events) {
+		t.Fatalf("export has %d lines, want %d", len(lines), len(events))
+	}
+	var first models.AuditEvent
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.ID != events[0].ID {
+		t.Fatalf("unexpected export line %q: %v", lines[0], err)
+	}
+
+	// Deleting the repository is itself recorded, and the log outlives it.
+	call(http.MethodDelete, "/api/v1/repos/alice/app", aliceToken, "", http.StatusNoContent, nil)
+	stored, err := db.ListAuditEvents(context.Background(), database.AuditEventFilter{RepoID: &repo.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != len(events)+1 || stored[0].Action != "repo.delete" || stored[0].Target != "alice/app" {
+		t.Fatalf("unexpected events after delete %v", actions(stored))
+	}
+
+	// Org owners see membership and settings changes.
+	call(http.MethodPost, "/api/v1/orgs", aliceToken, `{"name":"acme"}`, http.StatusCreated, nil)
+	call(http.MethodPost, "/api/v1/orgs/acme/members", aliceToken, `{"username":"bob"}`, http.StatusCreated, nil)
+	acceptInvitations(t, ts.URL, bobToken)
+	call(http.MethodPatch, "/api/v1/orgs/acme", aliceToken, `{"default_repo_permission":"read"}`, http.StatusOK, nil)
+	call(http.MethodDelete, "/api/v1/orgs/acme/members/bob", aliceToken, "", http.StatusNoContent, nil)
+	call(http.MethodGet, "/api/v1/orgs/acme/audit", bobToken, "", http.StatusForbidden, nil)
+	call(http.MethodGet, "/api/v1/orgs/acme/audit", aliceToken, "", http.StatusOK, &events)
+	want = []string{"org.member.remove", "org.update", "org.member.add", "org.invitation.create"}
+	if got := actions(events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("org audit actions = %v, want %v", got, want)
+	}
+	if string(events[1].Before) != `{"default_repo_permission":"write"}` || string(events[1].After) != `{"default_repo_permission":"read"}` {
+		t.Fatalf("unexpected org update diff %s -> %s", events[1].Before, events[1].After)
+	}
+
+	// The site-wide log is for site admins only.
+	call(http.MethodGet, "/api/v1/admin/audit", aliceToken, "", http.StatusForbidden, nil)
+}
+
+func TestSiteAdministration(t *testing.T) {
+	server, db := setupTestServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	call := func(method, path, token, body string, wantStatus int, out any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			raw, _ := io.ReadAll(resp.Body)
+			t.Fatalf("%s %s: expected %d, got %d: %s", method, path, wantStatus, resp.StatusCode, raw)
+		}
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	ctx := context.Background()
+	adminToken := registerAndGetToken(t, ts.URL, "alice")
+	bobToken := registerAndGetToken(t, ts.URL, "bob")
+	registerAndGetToken(t, ts.URL, "carol")
+	alice, err := db.GetUserByUsername(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetUserAdmin(ctx, alice.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	call(http.MethodGet, "/api/v1/admin/users", bobToken, "", http.StatusForbidden, nil)
+	var users []models.User
+	call(http.MethodGet, "/api/v1/admin/users?q=b", adminToken, "", http.StatusOK, &users)
+	if len(users) != 1 || users[0].Username != "bob" {
+		t.Fatalf("unexpected users for q=b: %+v", users)
+	}
+
+	call(http.MethodPost, "/api/v1/repos", bobToken, `{"name":"tool"}`, http.StatusCreated, nil)
+	var pat struct {
+		Token string `json:"token"`
 	}
-}
+	call(http.MethodPost, "/api/v1/user/tokens", bobToken, `{"name":"ci","scopes":["repo:read"]}`, http.StatusCreated, &pat)
 
-func TestNotificationsLifecycle(t *testing.T) {
-	server, _ := setupTestServer(t)
-	ts := httptest.NewServer(server)
-	defer ts.Close()
+	// Suspension ends sessions and stops tokens working.
+	call(http.MethodPost, "/api/v1/admin/users/alice/suspend", adminToken, "", http.StatusBadRequest, nil)
+	var suspended models.User
+	call(http.MethodPost, "/api/v1/admin/users/bob/suspend", adminToken, "", http.StatusOK, &suspended)
+	if suspended.SuspendedAt == nil {
+		t.Fatal("suspend response should carry suspended_at")
+	}
+	call(http.MethodGet, "/api/v1/user", bobToken, "", http.StatusUnauthorized, nil)
+	call(http.MethodGet, "/api/v1/user", pat.Token, "", http.StatusUnauthorized, nil)
+	call(http.MethodPost, "/api/v1/admin/users/bob/unsuspend", adminToken, "", http.StatusOK, nil)
+	call(http.MethodGet, "/api/v1/user", pat.Token, "", http.StatusOK, nil)
 
-	aliceToken := registerAndGetToken(t, ts.URL, "alice")
-	bobToken := registerAndGetToken(t, ts.URL, "bob")
-	createRepo(t, ts.URL, aliceToken, "repo", false)
+	var reset service.CredentialReset
+	call(http.MethodPost, "/api/v1/admin/users/bob/reset-credentials", adminToken, "", http.StatusOK, &reset)
+	if reset.AccessTokens != 1 {
+		t.Fatalf("expected one access token revoked, got %+v", reset)
+	}
+	call(http.MethodGet, "/api/v1/user", pat.Token, "", http.StatusUnauthorized, nil)
 
-	// Give bob write access so he can open PRs/issues.
-	addCollabBody := `{"username":"bob","role":"write"}`
-	req, _ := http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/collaborators", bytes.NewBufferString(addCollabBody))
-	req.Header.Set("Authorization", "Bearer "+aliceToken)
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		t.Fatal(err)
+	// Users who own repositories cannot be deleted until they are moved.
+	call(http.MethodDelete, "/api/v1/admin/users/bob", adminToken, "", http.StatusConflict, nil)
+	call(http.MethodPost, "/api/v1/admin/repos/bob/tool/transfer", adminToken, `{"new_owner":"nobody"}`, http.StatusNotFound, nil)
+	var moved models.Repository
+	call(http.MethodPost, "/api/v1/admin/repos/bob/tool/transfer", adminToken, `{"new_owner":"carol"}`, http.StatusOK, &moved)
+	if moved.OwnerName != "carol" {
+		t.Fatalf("transferred repo owner = %q, want carol", moved.OwnerName)
 	}
-	if resp.StatusCode != http.StatusCreated {
-		t.Fatalf("add collaborator: expected 201, got %d", resp.StatusCode)
+	call(http.MethodGet, "/api/v1/repos/carol/tool", "", "", http.StatusOK, nil)
+	call(http.MethodDelete, "/api/v1/admin/users/bob", adminToken, "", http.StatusNoContent, nil)
+	if _, err := db.GetUserByUsername(ctx, "bob"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("bob should be gone, got %v", err)
 	}
-	resp.Body.Close()
+	call(http.MethodDelete, "/api/v1/admin/repos/carol/tool", adminToken, "", http.StatusNoContent, nil)
+	call(http.MethodGet, "/api/v1/repos/carol/tool", "", "", http.StatusNotFound, nil)
 
-	// Bob opens PR -> Alice gets notification.
-	createPRReq := `{"title":"PR from bob","source_branch":"feature","target_branch":"main"}`
-	req, _ = http.NewRequest("POST", ts.URL+"/api/v1/repos/alice/repo/pulls", bytes.NewBufferString(createPRReq))
-	req.Header.Set("Authorization", "Bearer "+bobToken)
-	req.Header.Set("Content-Type", "application/json")
-	resp, err = http.DefaultClient.Do(req)
+	call(http.MethodPut, "/api/v1/admin/users/carol/entitlements/teleport", adminToken, `{}`, http.StatusBadRequest, nil)
+	call(http.MethodPut, "/api/v1/admin/users/carol/entitlements/private_repos", adminToken, `{}`, http.StatusOK, nil)
+	carol, err := db.GetUserByUsername(ctx, "carol")
 	if err != nil {
 		t.Fatal(err)
 	}
-	if resp.StatusCode != http.StatusCreated {
-		t.Fatalf("create PR: expected 201, got %d", resp.StatusCode)
+	if ok, err := db.HasUserEntitlement(ctx, carol.ID, models.EntitlementFeaturePrivateRepos, time.Now()); err != nil || !ok {
+		t.Fatalf("carol should have private_repos: %v %v", ok, err)
 	}
-	var prResp struct {
-		Number int `json:"number"`
+
+	call(http.MethodPut, "/api/v1/admin/users/alice/admin", adminToken, `{"is_admin":false}`, http.StatusBadRequest, nil)
+	call(http.MethodPut, "/api/v1/admin/users/carol/admin", adminToken, `{"is_admin":true}`, http.StatusOK, nil)
+
+	var queues []database.QueueStats
+	call(http.MethodGet, "/api/v1/admin/queues", adminToken, "", http.StatusOK, &queues)
+	if len(queues) != 3 {
+		t.Fatalf("expected three queues, got %+v", queues)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&prResp); err != nil {
-		t.Fatal(err)
+
+	var events []models.AuditEvent
+	call(http.MethodGet, "/api/v1/admin/audit?per_page=7", adminToken, "", http.StatusOK, &events)
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Action)
 	}
-	resp.Body.Close()
+	want := []string{
+		"user.admin.grant", "user.entitlement.set", "repo.delete", "user.delete",
+		"repo.transfer", "user.credentials_reset", "user.unsuspend",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("site audit actions = %v, want %v", got, want)
+	}
+	if events[0].ActorName != "alice" || events[0].Target != "carol" {
+		t.Fatalf("unexpected admin grant event %+v", events[0])
+	}
+}
 
-	req, _ = http.NewRequest("GET", ts.URL+"/api/v1/notifications/unread-count", nil)
-	req.Header.Set("Authorization", "Bearer "+aliceToken)
-	resp, err = http.DefaultClient.Do(req)
+func TestOIDCSignInProvisionsAndLinksAccounts(t *testing.T) {
+	idp := oidctest.NewServer("gothub", "s3cret")
+	defer idp.Close()
+	provider, err := oidc.NewProvider(oidc.Config{Name: "corp", DisplayName: "Corp SSO", Issuer: idp.URL, ClientID: "gothub", ClientSecret: "s3cret"}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("unread count: expected 200, got %d", resp.StatusCode)
+	server, _ := setupTestServerWithOptions(t, api.ServerOptions{
+		PublicURL:    "https://gothub.test",
+		SSOProviders: []*service.SSOProvider{{Provider: provider}},
+	})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	call := func(method, path, token, body string, wantStatus int, out any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			raw, _ := io.ReadAll(resp.Body)
+			t.Fatalf("%s %s: expected %d, got %d: %s", method, path, wantStatus, resp.StatusCode, raw)
+		}
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatal(err)
+			}
+		}
 	}
-	var unreadCount struct {
-		Count int `json:"count"`
+	signIn := func(user oidctest.User, wantStatus int, out any) (state, code string) {
+		t.Helper()
+		idp.SetUser(user)
+		var begin struct {
+			AuthorizationURL string `json:"authorization_url"`
+		}
+		call(http.MethodPost, "/api/v1/auth/oidc/corp/begin", "", "", http.StatusOK, &begin)
+		if !strings.Contains(begin.AuthorizationURL, url.QueryEscape("https://gothub.test/login/oidc/callback")) {
+			t.Fatalf("unexpected authorization url %q", begin.AuthorizationURL)
+		}
+		code, state, err := idp.Authorize(begin.AuthorizationURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		call(http.MethodPost, "/api/v1/auth/oidc/callback", "", fmt.Sprintf(`{"state":%q,"code":%q}`, state, code), wantStatus, out)
+		return state, code
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&unreadCount); err != nil {
-		t.Fatal(err)
+
+	var caps struct {
+		OIDCProviders []service.SSOProviderInfo `json:"oidc_providers"`
 	}
-	resp.Body.Close()
-	if unreadCount.Count != 1 {
-		t.Fatalf("expected 1 unread notification for alice, got %d", unreadCount.Count)
+	call(http.MethodGet, "/api/v1/auth/capabilities", "", "", http.StatusOK, &caps)
+	if len(caps.OIDCProviders) != 1 || caps.OIDCProviders[0].Name != "corp" || caps.OIDCProviders[0].DisplayName != "Corp SSO" {
+		t.Fatalf("unexpected providers %+v", caps.OIDCProviders)
 	}
+	call(http.MethodPost, "/api/v1/auth/oidc/nope/begin", "", "", http.StatusNotFound, nil)
 
-	req, _ = http.NewRequest("GET", ts.URL+"/api/v1/notifications?unread=true", nil)
-	req.Header.Set("Authorization", "Bearer "+aliceToken)
-	resp, err = http.DefaultClient.Do(req)
-	if err != nil {
-		t.Fatal(err)
+	var signedIn struct {
+		Token string      `json:"token"`
+		User  models.User `json:"user"`
 	}
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("list notifications: expected 200, got %d", resp.StatusCode)
+	state, code := signIn(oidctest.User{Subject: "d-1", Email: "dana@corp.test", EmailVerified: true, PreferredUsername: "dana"}, http.StatusOK, &signedIn)
+	if signedIn.Token == "" || signedIn.User.Username != "dana" {
+		t.Fatalf("unexpected sign-in response %+v", signedIn)
 	}
-	var notifications []struct {
-		ID    int64  `json:"id"`
-		Type  string `json:"type"`
-		Title string `json:"title"`
+	call(http.MethodPost, "/api/v1/auth/oidc/callback", "", fmt.Sprintf(`{"state":%q,"code":%q}`, state, code), http.StatusBadRequest, nil)
+
+	var identities []models.UserIdentity
+	call(http.MethodGet, "/api/v1/user/identities", signedIn.Token, "", http.StatusOK, &identities)
+	if len(identities) != 1 || identities[0].Provider != "corp" || identities[0].Subject != "d-1" {
+		t.Fatalf("unexpected identities %+v", identities)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&notifications); err != nil {
-		t.Fatal(err)
+
+	// An existing account whose email was never verified is not taken over.
+	registerAndGetToken(t, ts.URL, "erin")
+	signIn(oidctest.User{Subject: "e-1", Email: "erin@example.com", EmailVerified: true}, http.StatusConflict, nil)
+}
+
+func TestOAuthAppAuthorizationCodeFlow(t *testing.T) {
+	server, _ := setupTestServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	call := func(method, path, token, body string, wantStatus int, out any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			raw, _ := io.ReadAll(resp.Body)
+			t.Fatalf("%s %s: expected %d, got %d: %s", method, path, wantStatus, resp.StatusCode, raw)
+		}
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatal(err)
+			}
+		}
 	}
-	resp.Body.Close()
-	if len(notifications) != 1 {
-		t.Fatalf("expected 1 unread notification, got %d", len(notifications))
+	tokenRequest := func(form url.Values, clientID, secret string, wantStatus int) map[string]any {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/oauth/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(clientID, secret)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("token endpoint: expected %d, got %d: %v", wantStatus, resp.StatusCode, out)
+		}
+		return out
 	}
-	if notifications[0].Type != "pull_request.opened" {
-		t.Fatalf("unexpected notification type %q", notifications[0].Type)
+
+	devToken := registerAndGetToken(t, ts.URL, "dev")
+	aliceToken := registerAndGetToken(t, ts.URL, "alice")
+	createRepo(t, ts.URL, aliceToken, "repo", true)
+
+	var app struct {
+		ID           int64  `json:"id"`
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	call(http.MethodPost, "/api/v1/user/oauth-apps", devToken, `{"name":"dashboard","redirect_uris":["http://dash.example.com/cb"]}`, http.StatusBadRequest, nil)
+	call(http.MethodPost, "/api/v1/user/oauth-apps", devToken, `{"name":"dashboard","redirect_uris":["https://dash.example.com/cb"]}`, http.StatusCreated, &app)
+	if app.ClientID == "" || app.ClientSecret == "" {
+		t.Fatalf("expected client credentials, got %+v", app)
 	}
+	call(http.MethodGet, fmt.Sprintf("/api/v1/user/oauth-apps/%d", app.ID), aliceToken, "", http.StatusNotFound, nil)
 
-	// Mark one as read.
-	req, _ = http.NewRequest("POST", fmt.Sprintf("%s/api/v1/notifications/%d/read", ts.URL, notifications[0].ID), nil)
-	req.Header.Set("Authorization", "Bearer "+aliceToken)
-	resp, err = http.DefaultClient.Do(req)
-	if err != nil {
-		t.Fatal(err)
+	// The consent page loads the request, then the user approves it.
+	query := url.Values{"client_id": {app.ClientID}, "response_type": {"code"}, "scope": {"repo:read issues"}, "state": {"xyz"}}
+	var consent struct {
+		App struct {
+			Name string `json:"name"`
+		} `json:"app"`
+		RedirectURI string   `json:"redirect_uri"`
+		Scopes      []string `json:"scopes"`
+	}
+	call(http.MethodGet, "/api/v1/oauth/authorize?"+query.Encode(), aliceToken, "", http.StatusOK, &consent)
+	if consent.App.Name != "dashboard" || consent.RedirectURI != "https://dash.example.com/cb" || len(consent.Scopes) != 2 {
+		t.Fatalf("unexpected consent %+v", consent)
+	}
+	var decision struct {
+		RedirectURL string `json:"redirect_url"`
+	}
+	call(http.MethodPost, "/api/v1/oauth/authorize", aliceToken, fmt.Sprintf(`{"client_id":%q,"scope":"repo:read issues","state":"xyz","approve":false}`, app.ClientID), http.StatusOK, &decision)
+	if !strings.Contains(decision.RedirectURL, "error=access_denied") || !strings.Contains(decision.RedirectURL, "state=xyz") {
+		t.Fatalf("unexpected denial redirect %q", decision.RedirectURL)
+	}
+	call(http.MethodPost, "/api/v1/oauth/authorize", aliceToken, fmt.Sprintf(`{"client_id":%q,"scope":"repo:read issues","state":"xyz","approve":true}`, app.ClientID), http.StatusOK, &decision)
+	redirect, err := url.Parse(decision.RedirectURL)
+	if err != nil || redirect.Host != "dash.example.com" || redirect.Query().Get("state") != "xyz" || redirect.Query().Get("code") == "" {
+		t.Fatalf("unexpected approval redirect %q", decision.RedirectURL)
+	}
+
+	exchange := url.Values{"grant_type": {"authorization_code"}, "code": {redirect.Query().Get("code")}, "redirect_uri": {"https://dash.example.com/cb"}}
+	tokenRequest(exchange, app.ClientID, "wrong", http.StatusUnauthorized)
+	granted := tokenRequest(exchange, app.ClientID, app.ClientSecret, http.StatusOK)
+	accessToken, _ := granted["access_token"].(string)
+	refreshToken, _ := granted["refresh_token"].(string)
+	if !strings.HasPrefix(accessToken, "gpo_") || refreshToken == "" || granted["scope"] != "issues repo:read" {
+		t.Fatalf("unexpected token response %v", granted)
+	}
+	tokenRequest(exchange, app.ClientID, app.ClientSecret, http.StatusBadRequest)
+
+	// Access tokens work like scoped personal access tokens.
+	call(http.MethodGet, "/api/v1/repos/alice/repo", accessToken, "", http.StatusOK, nil)
+	call(http.MethodPost, "/api/v1/repos/alice/repo/issues", accessToken, `{"title":"from the dashboard"}`, http.StatusCreated, nil)
+	call(http.MethodDelete, "/api/v1/repos/alice/repo", accessToken, "", http.StatusForbidden, nil)
+	call(http.MethodGet, "/api/v1/user/oauth-authorizations", accessToken, "", http.StatusForbidden, nil)
+	call(http.MethodGet, "/api/v1/oauth/authorize?"+query.Encode(), accessToken, "", http.StatusForbidden, nil)
+	gitStatus := func(token string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/git/alice/repo/info/refs?service=git-upload-pack", nil)
+		req.SetBasicAuth("alice", token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
 	}
-	if resp.StatusCode != http.StatusNoContent {
-		t.Fatalf("mark notification read: expected 204, got %d", resp.StatusCode)
+	if got := gitStatus(accessToken); got != http.StatusOK {
+		t.Fatalf("oauth clone: expected 200, got %d", got)
 	}
-	resp.Body.Close()
 
-	req, _ = http.NewRequest("GET", ts.URL+"/api/v1/notifications/unread-count", nil)
-	req.Header.Set("Authorization", "Bearer "+aliceToken)
-	resp, err = http.DefaultClient.Do(req)
-	if err != nil {
-		t.Fatal(err)
+	refreshed := tokenRequest(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}}, app.ClientID, app.ClientSecret, http.StatusOK)
+	call(http.MethodGet, "/api/v1/user", accessToken, "", http.StatusUnauthorized, nil)
+	accessToken, _ = refreshed["access_token"].(string)
+	call(http.MethodGet, "/api/v1/user", accessToken, "", http.StatusOK, nil)
+
+	var authorizations []models.OAuthAuthorization
+	call(http.MethodGet, "/api/v1/user/oauth-authorizations", aliceToken, "", http.StatusOK, &authorizations)
+	if len(authorizations) != 1 || authorizations[0].AppName != "dashboard" || authorizations[0].LastUsedAt == nil {
+		t.Fatalf("unexpected authorizations %+v", authorizations)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&unreadCount); err != nil {
-		t.Fatal(err)
+	call(http.MethodDelete, fmt.Sprintf("/api/v1/user/oauth-authorizations/%d", app.ID), aliceToken, "", http.StatusNoContent, nil)
+	call(http.MethodGet, "/api/v1/user", accessToken, "", http.StatusUnauthorized, nil)
+	if got := gitStatus(accessToken); got != http.StatusUnauthorized {
+		t.Fatalf("revoked oauth clone: expected 401, got %d", got)
 	}
-	resp.Body.Close()
-	if unreadCount.Count != 0 {
-		t.Fatalf("expected 0 unread notifications after mark read, got %d", unreadCount.Count)
+}
+
+func TestNotificationWatchLevelsAndThreadSubscriptions(t *testing.T) {
+	server, _ := setupTestServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	aliceToken := registerAndGetToken(t, ts.URL, "alice")
+	bobToken := registerAndGetToken(t, ts.URL, "bob")
+	carolToken := registerAndGetToken(t, ts.URL, "carol")
+	daveToken := registerAndGetToken(t, ts.URL, "dave")
+	createRepo(t, ts.URL, aliceToken, "repo", false)
+
+	call := func(method, path, token, body string, wantStatus int) {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("%s %s: expected %d, got %d", method, path, wantStatus, resp.StatusCode)
+		}
+	}
+	type listedNotification struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+	list := func(token, query string) []listedNotification {
+		t.Helper()
+		req, _ := http.NewRequest("GET", ts.URL+"/api/v1/notifications"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("list notifications%s: expected 200, got %d", query, resp.StatusCode)
+		}
+		var out []listedNotification
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		return out
 	}
 
-	// Alice comments on bob's PR -> Bob gets notified.
-	commentReq := `{"body":"Looks good","entity_key":"ProcessOrder","entity_stable_id":"ent_process_order"}`
-	req, _ = http.NewRequest("POST", fmt.Sprintf("%s/api/v1/repos/alice/repo/pulls/%d/comments", ts.URL, prResp.Number), bytes.NewBufferString(commentReq))
-	req.Header.Set("Authorization", "Bearer "+aliceToken)
-	req.Header.Set("Content-Type", "application/json")
-	resp, err = http.DefaultClient.Do(req)
-	if err != nil {
-		t.Fatal(err)
+	call("POST", "/api/v1/repos/alice/repo/collaborators", aliceToken, `{"username":"bob","role":"write"}`, http.StatusCreated)
+	call("POST", "/api/v1/repos/alice/repo/collaborators", aliceToken, `{"username":"carol","role":"write"}`, http.StatusCreated)
+	acceptInvitations(t, ts.URL, bobToken)
+	acceptInvitations(t, ts.URL, carolToken)
+	call("PUT", "/api/v1/repos/alice/repo/subscription", daveToken, `{"level":"all"}`, http.StatusOK)
+	call("PUT", "/api/v1/repos/alice/repo/subscription", daveToken, `{"level":"sometimes"}`, http.StatusBadRequest)
+	call("PUT", "/api/v1/repos/alice/repo/subscription", carolToken, `{"level":"participating"}`, http.StatusOK)
+
+	// Bob opens an issue: alice hears about it as a maintainer, dave as a watcher.
+	call("POST", "/api/v1/repos/alice/repo/issues", bobToken, `{"title":"Crash on start"}`, http.StatusCreated)
+	if got := list(aliceToken, ""); len(got) != 1 || got[0].Type != "issue.opened" || got[0].Reason != "subscribed" {
+		t.Fatalf("alice notifications after issue opened = %+v", got)
 	}
-	if resp.StatusCode != http.StatusCreated {
-		t.Fatalf("create PR comment: expected 201, got %d", resp.StatusCode)
+	if got := list(daveToken, ""); len(got) != 1 || got[0].Reason != "subscribed" {
+		t.Fatalf("dave notifications after issue opened = %+v", got)
 	}
-	var createdComment struct {
-		EntityKey      string `json:"entity_key"`
-		EntityStableID string `json:"entity_stable_id"`
+	if got := list(carolToken, ""); len(got) != 0 {
+		t.Fatalf("participating carol should not hear about new issues, got %+v", got)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&createdComment); err != nil {
-		t.Fatal(err)
+
+	// Participating maintainers no longer hear about new threads.
+	call("PUT", "/api/v1/repos/alice/repo/subscription", aliceToken, `{"level":"participating"}`, http.StatusOK)
+	call("POST", "/api/v1/repos/alice/repo/issues", bobToken, `{"title":"Second issue"}`, http.StatusCreated)
+	if got := list(aliceToken, ""); len(got) != 1 {
+		t.Fatalf("participating alice should not hear about issue #2, got %+v", got)
 	}
-	resp.Body.Close()
-	if createdComment.EntityKey != "ProcessOrder" || createdComment.EntityStableID != "ent_process_order" {
-		t.Fatalf("unexpected PR comment anchors: %+v", createdComment)
+
+	// Unsubscribing from a thread suppresses comments but not mentions.
+	call("PUT", "/api/v1/repos/alice/repo/issues/1/subscription", aliceToken, `{"subscribed":false}`, http.StatusOK)
+	call("POST", "/api/v1/repos/alice/repo/issues/1/comments", carolToken, `{"body":"Same here"}`, http.StatusCreated)
+	if got := list(aliceToken, ""); len(got) != 1 {
+		t.Fatalf("unsubscribed alice should not hear about comments, got %+v", got)
+	}
+	if got := list(bobToken, "?reason=author"); len(got) != 1 || got[0].Type != "issue.comment" {
+		t.Fatalf("bob author notifications = %+v", got)
+	}
+	call("POST", "/api/v1/repos/alice/repo/issues/1/comments", carolToken, `{"body":"@alice can you take a look?"}`, http.StatusCreated)
+	if got := list(aliceToken, "?reason=mention"); len(got) != 1 || got[0].Type != "issue.mention" {
+		t.Fatalf("alice mention notifications = %+v", got)
 	}
 
-	req, _ = http.NewRequest("GET", ts.URL+"/api/v1/notifications/unread-count", nil)
-	req.Header.Set("Authorization", "Bearer "+bobToken)
-	resp, err = http.DefaultClient.Do(req)
-	if err != nil {
-		t.Fatal(err)
+	// Ignoring the repository silences threads carol participates in.
+	call("PUT", "/api/v1/repos/alice/repo/subscription", carolToken, `{"level":"ignore"}`, http.StatusOK)
+	call("POST", "/api/v1/repos/alice/repo/issues/1/comments", bobToken, `{"body":"Fixed"}`, http.StatusCreated)
+	if got := list(carolToken, ""); len(got) != 0 {
+		t.Fatalf("ignoring carol should not be notified, got %+v", got)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&unreadCount); err != nil {
-		t.Fatal(err)
+	call("DELETE", "/api/v1/repos/alice/repo/subscription", carolToken, "", http.StatusNoContent)
+
+	// Review requests notify the reviewer with their own reason.
+	number := createPRNumber(t, ts.URL, bobToken, "alice", "repo", "feature", "main")
+	call("POST", fmt.Sprintf("/api/v1/repos/alice/repo/pulls/%d/requested-reviewers", number), bobToken, `{"reviewers":["alice"]}`, http.StatusNoContent)
+	call("POST", fmt.Sprintf("/api/v1/repos/alice/repo/pulls/%d/requested-reviewers", number), bobToken, `{"reviewers":["nobody"]}`, http.StatusUnprocessableEntity)
+	if got := list(aliceToken, "?reason=review_requested"); len(got) != 1 || got[0].Type != "pull_request.review_requested" {
+		t.Fatalf("alice review request notifications = %+v", got)
 	}
-	resp.Body.Close()
-	if unreadCount.Count != 1 {
-		t.Fatalf("expected 1 unread notification for bob, got %d", unreadCount.Count)
+	call("POST", fmt.Sprintf("/api/v1/repos/alice/repo/pulls/%d/comments", number), bobToken, `{"body":"Rebased"}`, http.StatusCreated)
+	if got := list(aliceToken, "?reason=review_requested"); len(got) != 2 {
+		t.Fatalf("requested reviewer should follow the PR, got %+v", got)
 	}
+	call("GET", "/api/v1/notifications?reason=bogus", aliceToken, "", http.StatusBadRequest)
 }
 
 func TestPRAndIssueEndpointsRejectInvalidNumbers(t *testing.T) {
@@ -4572,6 +6923,54 @@ func pushSimpleGoCommit(t *testing.T, baseURL, owner, repo, token string) string
 	return string(commitHash)
 }
 
+// gitPushPayload builds a receive-pack request that creates ref at a new
+// root commit with message.
+func gitPushPayload(t *testing.T, ref, message string) []byte {
+	t.Helper()
+	blobData := []byte("package main\n\nfunc main() {}\n")
+	blobRaw, err := hex.DecodeString(string(gitinterop.GitHashBytes(gitinterop.GitTypeBlob, blobData)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	treeData := append([]byte("100644 main.go\x00"), blobRaw...)
+	treeHash := gitinterop.GitHashBytes(gitinterop.GitTypeTree, treeData)
+	commitData := []byte(fmt.Sprintf(
+		"tree %s\nauthor Owner <owner@example.com> 1700000000 +0000\ncommitter Owner <owner@example.com> 1700000000 +0000\n\n%s\n",
+		treeHash, message,
+	))
+	commitHash := gitinterop.GitHashBytes(gitinterop.GitTypeCommit, commitData)
+	packData, err := gitinterop.BuildPackfile([]gitinterop.PackfileObject{
+		{Type: gitinterop.OBJ_BLOB, Data: blobData},
+		{Type: gitinterop.OBJ_TREE, Data: treeData},
+		{Type: gitinterop.OBJ_COMMIT, Data: commitData},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := append(pktLineForTest(fmt.Sprintf("%s %s %s\x00report-status\n", strings.Repeat("0", 40), commitHash, ref)), pktFlushForTest()...)
+	return append(payload, packData...)
+}
+
+// waitForIssueState waits for push hooks, which run in the background, to
+// move an issue to state.
+func waitForIssueState(t *testing.T, db database.DB, repoID int64, number int, state string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		issue, err := db.GetIssue(context.Background(), repoID, number)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if issue.State == state {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("issue #%d: expected state %q, got %q", number, state, issue.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func decodeAPIError(t *testing.T, resp *http.Response) string {
 	t.Helper()
 	var payload struct {
@@ -4746,6 +7145,38 @@ func registerAndGetToken(t *testing.T, baseURL, username string) string {
 	return regResp.Token
 }
 
+// acceptInvitations accepts every pending invitation addressed to the
+// holder of token.
+func acceptInvitations(t *testing.T, baseURL, token string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", baseURL+"/api/v1/user/invitations", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var invs []models.Invitation
+	if err := json.NewDecoder(resp.Body).Decode(&invs); err != nil {
+		t.Fatal(err)
+	}
+	if len(invs) == 0 {
+		t.Fatal("expected a pending invitation")
+	}
+	for _, inv := range invs {
+		req, _ := http.NewRequest("POST", fmt.Sprintf("%s/api/v1/user/invitations/%d/accept", baseURL, inv.ID), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("accept invitation %d: expected 204, got %d", inv.ID, resp.StatusCode)
+		}
+	}
+}
+
 func createRepo(t *testing.T, baseURL, token, name string, isPrivate bool) {
 	t.Helper()
 	body := fmt.Sprintf(`{"name":"%s","description":"","private":%t}`, name, isPrivate)
@@ -7,5 +7,6 @@ func (s *Server) handleAuthCapabilities(w http.ResponseWriter, r *http.Request)
 		"magic_link_enabled": true,
 		"ssh_auth_enabled":   true,
 		"passkey_enabled":    s.passkey != nil,
+		"oidc_providers":     s.ssoSvc.Providers(),
 	})
 }
@@ -3,10 +3,12 @@ package api
 import (
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/odvcencio/gothub/internal/auth"
 	"github.com/odvcencio/gothub/internal/models"
+	"github.com/odvcencio/gothub/internal/service"
 )
 
 type registerRequest struct {
@@ -52,7 +54,7 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := s.authSvc.GenerateToken(user.ID, user.Username)
+	token, err := s.issueSessionToken(r, user)
 	if err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
@@ -61,21 +63,52 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, http.StatusCreated, tokenResponse{Token: token, User: user})
 }
 
+// handleRefreshToken rotates the caller's session: the old JWT stops
+// working once the new one is issued.
 func (s *Server) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
 	claims := auth.GetClaims(r.Context())
-	token, err := s.authSvc.GenerateToken(claims.UserID, claims.Username)
+	user, err := s.db.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		jsonError(w, "user not found", http.StatusNotFound)
+		return
+	}
+	session, err := s.sessionSvc.Rotate(r.Context(), user.ID, claims.SessionID, r.UserAgent(), s.clientIPResolver.clientIPFromRequest(r), s.authSvc.TokenDuration())
 	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			jsonError(w, "session expired", http.StatusUnauthorized)
+			return
+		}
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-	user, err := s.db.GetUserByID(r.Context(), claims.UserID)
+	token, err := s.authSvc.GenerateSessionToken(user.ID, user.Username, session.ID)
 	if err != nil {
-		jsonError(w, "user not found", http.StatusNotFound)
+		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 	jsonResponse(w, http.StatusOK, tokenResponse{Token: token, User: user})
 }
 
+// rejectSuspended answers 403 and returns true when a site admin has
+// suspended user. Sign-in paths check it before issuing a session.
+func rejectSuspended(w http.ResponseWriter, user *models.User) bool {
+	if user.SuspendedAt == nil {
+		return false
+	}
+	jsonError(w, "account suspended", http.StatusForbidden)
+	return true
+}
+
+// issueSessionToken starts a session for the requesting device and returns
+// a JWT bound to it.
+func (s *Server) issueSessionToken(r *http.Request, user *models.User) (string, error) {
+	session, err := s.sessionSvc.Create(r.Context(), user.ID, r.UserAgent(), s.clientIPResolver.clientIPFromRequest(r), s.authSvc.TokenDuration())
+	if err != nil {
+		return "", err
+	}
+	return s.authSvc.GenerateSessionToken(user.ID, user.Username, session.ID)
+}
+
 func (s *Server) handleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	claims := auth.GetClaims(r.Context())
 	user, err := s.db.GetUserByID(r.Context(), claims.UserID)
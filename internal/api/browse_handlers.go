@@ -108,6 +108,19 @@ func (s *Server) handleGetCommit(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, http.StatusOK, commit)
 }
 
+// GET /api/v1/repos/{owner}/{repo}/tags/{tag...}
+func (s *Server) handleGetTag(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authorizeRepoRequest(w, r, false); !ok {
+		return
+	}
+	tag, err := s.browseSvc.GetTag(r.Context(), r.PathValue("owner"), r.PathValue("repo"), r.PathValue("tag"))
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	jsonResponse(w, http.StatusOK, tag)
+}
+
 // GET /api/v1/repos/{owner}/{repo}/entities/{ref}/{path...}
 func (s *Server) handleListEntities(w http.ResponseWriter, r *http.Request) {
 	if _, ok := s.authorizeRepoRequest(w, r, false); !ok {
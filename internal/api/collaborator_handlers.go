@@ -1,17 +1,22 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"strings"
 
+	"github.com/odvcencio/gothub/internal/auth"
 	"github.com/odvcencio/gothub/internal/models"
 )
 
+// addCollaboratorRequest invites a user, by username or by email address,
+// to collaborate on a repository.
 type addCollaboratorRequest struct {
 	Username string `json:"username"`
+	Email    string `json:"email"`
 	Role     string `json:"role"` // "read", "write", "admin"
 }
 
@@ -21,6 +26,8 @@ type collaboratorResponse struct {
 	Role     string `json:"role"`
 }
 
+// handleAddCollaborator invites a collaborator. Access is granted once the
+// invitee accepts.
 func (s *Server) handleAddCollaborator(w http.ResponseWriter, r *http.Request) {
 	repo, ok := s.authorizeRepoRequest(w, r, true)
 	if !ok {
@@ -32,9 +39,8 @@ func (s *Server) handleAddCollaborator(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
-	req.Username = strings.TrimSpace(req.Username)
-	if req.Username == "" {
-		jsonError(w, "username is required", http.StatusBadRequest)
+	if strings.TrimSpace(req.Username) == "" && strings.TrimSpace(req.Email) == "" {
+		jsonError(w, "username or email is required", http.StatusBadRequest)
 		return
 	}
 	role := strings.ToLower(strings.TrimSpace(req.Role))
@@ -46,26 +52,13 @@ func (s *Server) handleAddCollaborator(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := s.db.GetUserByUsername(r.Context(), req.Username)
+	claims := auth.GetClaims(r.Context())
+	inv, err := s.invitationSvc.InviteToRepo(r.Context(), repo, claims.UserID, req.Username, req.Email, role)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			jsonError(w, "user not found", http.StatusNotFound)
-			return
-		}
-		jsonError(w, "internal error", http.StatusInternalServerError)
+		writeInvitationError(w, err)
 		return
 	}
-
-	c := &models.Collaborator{RepoID: repo.ID, UserID: user.ID, Role: role}
-	if err := s.db.AddCollaborator(r.Context(), c); err != nil {
-		jsonError(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-	jsonResponse(w, http.StatusCreated, collaboratorResponse{
-		UserID:   user.ID,
-		Username: user.Username,
-		Role:     role,
-	})
+	jsonResponse(w, http.StatusCreated, inv)
 }
 
 func (s *Server) handleListCollaborators(w http.ResponseWriter, r *http.Request) {
@@ -118,9 +111,16 @@ func (s *Server) handleRemoveCollaborator(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if err := s.db.RemoveCollaborator(r.Context(), repo.ID, user.ID); err != nil {
+	if err := s.repoSvc.RemoveCollaborator(r.Context(), repo, user); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "collaborator not found", http.StatusNotFound)
+			return
+		}
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	s.runWebhookAsync(r.Context(), "webhook member removed", []any{"repo_id", repo.ID, "user_id", user.ID}, func(ctx context.Context) error {
+		return s.webhookSvc.EmitMemberEvent(ctx, repo.ID, models.WebhookActionRemoved, user.ID, user.Username, "")
+	})
 	w.WriteHeader(http.StatusNoContent)
 }
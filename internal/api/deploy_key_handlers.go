@@ -0,0 +1,167 @@
+package api
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// deployTokenPrefix marks deploy tokens, which are presented as the HTTP
+// Basic password for smart HTTP and the got protocol.
+const deployTokenPrefix = "gdk_"
+
+type createDeployKeyRequest struct {
+	Name           string `json:"name"`
+	Kind           string `json:"kind"`
+	PublicKey      string `json:"public_key"`
+	ReadOnly       *bool  `json:"read_only"`
+	ExpiresInHours int    `json:"expires_in_hours"`
+}
+
+type createDeployKeyResponse struct {
+	models.RepoDeployKey
+	Token string `json:"token,omitempty"`
+}
+
+func (s *Server) handleCreateRepoDeployKey(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	repo, ok := s.authorizeRepoRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	var req createDeployKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		jsonError(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInHours < 0 || req.ExpiresInHours > maxRunnerTokenLifetime {
+		jsonError(w, "expires_in_hours must be between 0 and 8760", http.StatusBadRequest)
+		return
+	}
+
+	key := &models.RepoDeployKey{
+		RepoID:          repo.ID,
+		Name:            req.Name,
+		Kind:            strings.ToLower(strings.TrimSpace(req.Kind)),
+		ReadOnly:        req.ReadOnly == nil || *req.ReadOnly,
+		CreatedByUserID: claims.UserID,
+	}
+	if req.ExpiresInHours > 0 {
+		expiresAt := time.Now().UTC().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		key.ExpiresAt = &expiresAt
+	}
+
+	var plainToken string
+	switch key.Kind {
+	case "", models.DeployKeyKindToken:
+		if strings.TrimSpace(req.PublicKey) != "" {
+			jsonError(w, "public_key is only accepted for ssh deploy keys", http.StatusBadRequest)
+			return
+		}
+		token, err := generateDeployToken()
+		if err != nil {
+			jsonError(w, "failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		plainToken = token
+		key.Kind = models.DeployKeyKindToken
+		key.TokenHash = hashRunnerToken(token)
+		key.TokenPrefix = token[:min(len(token), 12)]
+	case models.DeployKeyKindSSH:
+		pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey))
+		if err != nil {
+			jsonError(w, "invalid SSH public key", http.StatusBadRequest)
+			return
+		}
+		key.Fingerprint = fmt.Sprintf("%x", md5.Sum(pubKey.Marshal()))
+		key.PublicKey = strings.TrimSpace(req.PublicKey)
+		key.KeyType = pubKey.Type()
+		if inUse, err := s.sshKeyFingerprintInUse(r, key.Fingerprint); err != nil {
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		} else if inUse {
+			jsonError(w, "key already in use", http.StatusConflict)
+			return
+		}
+	default:
+		jsonError(w, "kind must be one of ssh, token", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.repoSvc.CreateDeployKey(r.Context(), repo, key); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusCreated, createDeployKeyResponse{RepoDeployKey: *key, Token: plainToken})
+}
+
+func (s *Server) handleListRepoDeployKeys(w http.ResponseWriter, r *http.Request) {
+	repo, ok := s.authorizeRepoRequest(w, r, true)
+	if !ok {
+		return
+	}
+	keys, err := s.db.ListRepoDeployKeys(r.Context(), repo.ID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, keys)
+}
+
+func (s *Server) handleDeleteRepoDeployKey(w http.ResponseWriter, r *http.Request) {
+	repo, ok := s.authorizeRepoRequest(w, r, true)
+	if !ok {
+		return
+	}
+	keyID, ok := parsePathPositiveInt64(w, r, "id", "deploy key id")
+	if !ok {
+		return
+	}
+	if err := s.repoSvc.DeleteDeployKey(r.Context(), repo, keyID); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sshKeyFingerprintInUse reports whether a fingerprint already identifies a
+// user SSH key or an active deploy key, so that an SSH login is never
+// ambiguous.
+func (s *Server) sshKeyFingerprintInUse(r *http.Request, fingerprint string) (bool, error) {
+	if _, err := s.db.GetSSHKeyByFingerprint(r.Context(), fingerprint); err == nil {
+		return true, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	if _, err := s.db.GetRepoDeployKeyByFingerprint(r.Context(), fingerprint); err == nil {
+		return true, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	return false, nil
+}
+
+func generateDeployToken() (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return deployTokenPrefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
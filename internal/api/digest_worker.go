@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/service"
+)
+
+const defaultDigestWorkerPoll = 15 * time.Minute
+
+// digestWorker periodically queues the daily and weekly notification digests
+// that have come due. Digests are sent once per UTC day or ISO week, so the
+// poll interval only bounds how late in the period they go out.
+type digestWorker struct {
+	notifySvc    *service.NotificationService
+	pollInterval time.Duration
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newDigestWorker(notifySvc *service.NotificationService, pollInterval time.Duration) *digestWorker {
+	if pollInterval <= 0 {
+		pollInterval = defaultDigestWorkerPoll
+	}
+	return &digestWorker{notifySvc: notifySvc, pollInterval: pollInterval}
+}
+
+func (w *digestWorker) Start(parent context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(parent)
+	done := make(chan struct{})
+	w.cancel = cancel
+	w.done = done
+	go w.run(ctx, done)
+	return nil
+}
+
+func (w *digestWorker) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	cancel, done := w.cancel, w.done
+	w.cancel, w.done = nil, nil
+	w.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *digestWorker) run(ctx context.Context, done chan<- struct{}) {
+	defer close(done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		sent, err := w.notifySvc.SendDueDigests(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("digest worker failed", "error", err)
+		}
+		if sent > 0 {
+			slog.Info("queued notification digests", "count", sent)
+		}
+		timer.Reset(w.pollInterval)
+	}
+}
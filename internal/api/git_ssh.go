@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/gitinterop"
+	"golang.org/x/crypto/ssh"
+)
+
+// NewGitSSHServer returns a git-over-SSH server that shares the smart HTTP
+// handler's repo access checks, ref update validators and push hooks.
+func (s *Server) NewGitSSHServer(hostKey ssh.Signer) *gitinterop.SSHServer {
+	srv := gitinterop.NewSSHServer(s.gitHandler, hostKey, s.authorizeSSHRepoAccess)
+	if s.tenantContext.enabled && s.tenantContext.defaultTenantID != "" {
+		tenantID := s.tenantContext.defaultTenantID
+		srv.SetBaseContext(func() context.Context {
+			return database.WithTenantID(context.Background(), tenantID)
+		})
+	}
+	return srv
+}
+
+func (s *Server) authorizeSSHRepoAccess(ctx context.Context, id gitinterop.SSHIdentity, owner, repo string, write bool) (context.Context, error) {
+	var principal protocolPrincipal
+	if id.DeployKeyID != 0 {
+		key, err := s.db.GetRepoDeployKeyByID(ctx, id.DeployKeyID)
+		if err != nil {
+			return nil, fmt.Errorf("deploy key lookup failed")
+		}
+		if _, err := s.checkDeployKeyUsable(ctx, key); err != nil {
+			return nil, err
+		}
+		principal.deployKey = key
+	} else {
+		user, err := s.db.GetUserByID(ctx, id.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("user lookup failed")
+		}
+		principal.user = user
+	}
+	if _, err := s.authorizeRepoAccessForPrincipal(ctx, principal, owner, repo, write); err != nil {
+		return nil, err
+	}
+	return withProtocolPrincipal(ctx, principal), nil
+}
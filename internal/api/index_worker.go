@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strings"
@@ -48,6 +49,21 @@ func (s *Server) processIndexingJob(ctx context.Context, job *models.IndexingJob
 }
 
 func (s *Server) StartBackgroundWorkers(ctx context.Context) error {
+	if s.webhookWorker != nil {
+		if err := s.webhookWorker.Start(ctx); err != nil {
+			return err
+		}
+	}
+	if s.mailWorker != nil {
+		if err := s.mailWorker.Start(ctx); err != nil {
+			return err
+		}
+	}
+	if s.digestWorker != nil {
+		if err := s.digestWorker.Start(ctx); err != nil {
+			return err
+		}
+	}
 	if !s.asyncIndex || s.indexWorker == nil {
 		return nil
 	}
@@ -55,10 +71,20 @@ func (s *Server) StartBackgroundWorkers(ctx context.Context) error {
 }
 
 func (s *Server) StopBackgroundWorkers(ctx context.Context) error {
-	if s.indexWorker == nil {
-		return nil
+	var errs []error
+	if s.indexWorker != nil {
+		errs = append(errs, s.indexWorker.Stop(ctx))
+	}
+	if s.webhookWorker != nil {
+		errs = append(errs, s.webhookWorker.Stop(ctx))
+	}
+	if s.mailWorker != nil {
+		errs = append(errs, s.mailWorker.Stop(ctx))
+	}
+	if s.digestWorker != nil {
+		errs = append(errs, s.digestWorker.Stop(ctx))
 	}
-	return s.indexWorker.Stop(ctx)
+	return errors.Join(errs...)
 }
 
 func (s *Server) StopBackgroundWorkersNow() {
@@ -6,7 +6,6 @@ import (
 	"regexp"
 	"strings"
 
-	"github.com/odvcencio/gothub/internal/auth"
 	"github.com/odvcencio/gothub/internal/models"
 )
 
@@ -59,20 +58,6 @@ func (s *Server) handleCreateInterestSignup(w http.ResponseWriter, r *http.Reque
 }
 
 func (s *Server) handleListInterestSignups(w http.ResponseWriter, r *http.Request) {
-	claims := auth.GetClaims(r.Context())
-	if claims == nil {
-		jsonError(w, "authentication required", http.StatusUnauthorized)
-		return
-	}
-	user, err := s.db.GetUserByID(r.Context(), claims.UserID)
-	if err != nil {
-		jsonError(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-	if !user.IsAdmin {
-		jsonError(w, "forbidden", http.StatusForbidden)
-		return
-	}
 	page, perPage := parsePagination(r, 50, 200)
 	limit := perPage
 	offset := (page - 1) * perPage
@@ -0,0 +1,398 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/models"
+	"github.com/odvcencio/gothub/internal/service"
+)
+
+func writeInvitationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvitationNotFound), errors.Is(err, service.ErrInviteeNotFound):
+		jsonError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrInvitationExpired):
+		jsonError(w, err.Error(), http.StatusGone)
+	case errors.Is(err, service.ErrAlreadyMember):
+		jsonError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidInvitation):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	default:
+		jsonError(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+// requireOrgTwoFactor rejects userID joining an org whose two-factor
+// requirement they do not meet.
+func (s *Server) requireOrgTwoFactor(w http.ResponseWriter, r *http.Request, orgID, userID int64) bool {
+	ok, err := s.orgTwoFactorSatisfied(r.Context(), orgID, userID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		jsonError(w, "this organization requires members to have two-factor authentication", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// acceptInvitation grants inv to user, checking the org's two-factor
+// requirement first, and announces new repository collaborators.
+func (s *Server) acceptInvitation(w http.ResponseWriter, r *http.Request, inv *models.Invitation, user *models.User) bool {
+	if inv.OrgID != nil && !s.requireOrgTwoFactor(w, r, *inv.OrgID, user.ID) {
+		return false
+	}
+	if err := s.invitationSvc.Accept(r.Context(), inv, user.ID); err != nil {
+		writeInvitationError(w, err)
+		return false
+	}
+	if inv.RepoID != nil {
+		repoID := *inv.RepoID
+		s.runWebhookAsync(r.Context(), "webhook member added", []any{"repo_id", repoID, "user_id", user.ID}, func(ctx context.Context) error {
+			return s.webhookSvc.EmitMemberEvent(ctx, repoID, models.WebhookActionAdded, user.ID, user.Username, inv.Role)
+		})
+	}
+	return true
+}
+
+func (s *Server) handleListRepoInvitations(w http.ResponseWriter, r *http.Request) {
+	repo, ok := s.authorizeRepoRequest(w, r, true)
+	if !ok {
+		return
+	}
+	invs, err := s.invitationSvc.ListForRepo(r.Context(), repo.ID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if invs == nil {
+		invs = []models.Invitation{}
+	}
+	jsonResponse(w, http.StatusOK, invs)
+}
+
+func (s *Server) handleRevokeRepoInvitation(w http.ResponseWriter, r *http.Request) {
+	repo, ok := s.authorizeRepoRequest(w, r, true)
+	if !ok {
+		return
+	}
+	inv, ok := s.invitationForPath(w, r)
+	if !ok {
+		return
+	}
+	if inv.RepoID == nil || *inv.RepoID != repo.ID {
+		jsonError(w, "invitation not found", http.StatusNotFound)
+		return
+	}
+	if err := s.invitationSvc.Delete(r.Context(), inv); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListOrgInvitations(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.orgForOwner(w, r, "only org owners can manage invitations")
+	if !ok {
+		return
+	}
+	invs, err := s.invitationSvc.ListForOrg(r.Context(), org.ID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if invs == nil {
+		invs = []models.Invitation{}
+	}
+	jsonResponse(w, http.StatusOK, invs)
+}
+
+func (s *Server) handleRevokeOrgInvitation(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.orgForOwner(w, r, "only org owners can manage invitations")
+	if !ok {
+		return
+	}
+	inv, ok := s.invitationForPath(w, r)
+	if !ok {
+		return
+	}
+	if inv.OrgID == nil || *inv.OrgID != org.ID {
+		jsonError(w, "invitation not found", http.StatusNotFound)
+		return
+	}
+	if err := s.invitationSvc.Delete(r.Context(), inv); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListUserInvitations(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	invs, err := s.invitationSvc.ListForUser(r.Context(), claims.UserID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if invs == nil {
+		invs = []models.Invitation{}
+	}
+	jsonResponse(w, http.StatusOK, invs)
+}
+
+func (s *Server) invitationForPath(w http.ResponseWriter, r *http.Request) (*models.Invitation, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonError(w, "invalid invitation id", http.StatusBadRequest)
+		return nil, false
+	}
+	inv, err := s.invitationSvc.Get(r.Context(), id)
+	if err != nil {
+		writeInvitationError(w, err)
+		return nil, false
+	}
+	return inv, true
+}
+
+// invitationForInvitee resolves the {id} in the path to an invitation
+// addressed to the caller.
+func (s *Server) invitationForInvitee(w http.ResponseWriter, r *http.Request) (*models.Invitation, bool) {
+	inv, ok := s.invitationForPath(w, r)
+	if !ok {
+		return nil, false
+	}
+	claims := auth.GetClaims(r.Context())
+	if inv.InviteeID == nil || *inv.InviteeID != claims.UserID {
+		jsonError(w, "invitation not found", http.StatusNotFound)
+		return nil, false
+	}
+	return inv, true
+}
+
+func (s *Server) handleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	inv, ok := s.invitationForInvitee(w, r)
+	if !ok {
+		return
+	}
+	user, err := s.db.GetUserByID(r.Context(), *inv.InviteeID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !s.acceptInvitation(w, r, inv, user) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	inv, ok := s.invitationForInvitee(w, r)
+	if !ok {
+		return
+	}
+	if err := s.invitationSvc.Delete(r.Context(), inv); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type invitationTokenRequest struct {
+	Token string `json:"token"`
+	// Username names the account to create when the invited address has
+	// none yet.
+	Username string `json:"username,omitempty"`
+}
+
+func decodeInvitationToken(w http.ResponseWriter, r *http.Request) (invitationTokenRequest, bool) {
+	var req invitationTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return req, false
+	}
+	if strings.TrimSpace(req.Token) == "" {
+		jsonError(w, "token is required", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// handlePreviewInvitationToken describes an email invitation so the accept
+// page can ask for a username when the address has no account.
+func (s *Server) handlePreviewInvitationToken(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeInvitationToken(w, r)
+	if !ok {
+		return
+	}
+	inv, err := s.invitationSvc.GetByToken(r.Context(), req.Token)
+	if err != nil {
+		writeInvitationError(w, err)
+		return
+	}
+	_, err = s.db.GetUserByEmail(r.Context(), inv.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"invitation":     inv,
+		"account_exists": err == nil,
+	})
+}
+
+// handleAcceptInvitationToken accepts an email invitation. A signed-in
+// caller accepts it for their own account. Otherwise the token stands in
+// for a magic link: it signs in the account that owns the invited address,
+// creating one with the requested username if there is none.
+func (s *Server) handleAcceptInvitationToken(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeInvitationToken(w, r)
+	if !ok {
+		return
+	}
+	inv, err := s.invitationSvc.GetByToken(r.Context(), req.Token)
+	if err != nil {
+		writeInvitationError(w, err)
+		return
+	}
+
+	if claims := auth.GetClaims(r.Context()); claims != nil {
+		if claims.Scoped() {
+			jsonError(w, "token scope does not allow this request", http.StatusForbidden)
+			return
+		}
+		user, err := s.db.GetUserByID(r.Context(), claims.UserID)
+		if err != nil {
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if !s.acceptInvitation(w, r, inv, user) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	user, err := s.db.GetUserByEmail(r.Context(), inv.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, ok = s.createInvitedUser(w, r, inv, req.Username)
+		if !ok {
+			return
+		}
+	} else if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	} else if verified, err := s.db.HasVerifiedEmail(r.Context(), user.ID); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	} else if !verified {
+		// Whoever registered the unverified address may not own it; the
+		// emailed token proves who does, so earlier sessions are ended.
+		if err := s.db.RevokeUserSessions(r.Context(), user.ID, ""); err != nil {
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Accept only if the token alone completes sign-in. Users with a second
+	// factor get a challenge instead, and accept while signed in afterwards.
+	twoFactor, err := s.twoFactorSvc.TOTPEnabled(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !twoFactor && user.SuspendedAt == nil && !s.acceptInvitation(w, r, inv, user) {
+		return
+	}
+	s.signInWithMagicLink(w, r, user)
+}
+
+// createInvitedUser creates a passwordless account for the address an
+// invitation was sent to. New accounts have no second factor, so invitations
+// to orgs that require one are refused before the account is made.
+func (s *Server) createInvitedUser(w http.ResponseWriter, r *http.Request, inv *models.Invitation, username string) (*models.User, bool) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		jsonError(w, "username is required to create an account", http.StatusBadRequest)
+		return nil, false
+	}
+	if inv.OrgID != nil {
+		org, err := s.db.GetOrgByID(r.Context(), *inv.OrgID)
+		if err != nil {
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return nil, false
+		}
+		if org.RequireTwoFactor {
+			jsonError(w, "this organization requires members to have two-factor authentication; create an account and enroll first", http.StatusConflict)
+			return nil, false
+		}
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+	hash, err := s.authSvc.HashPassword(string(random))
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+	user := &models.User{Username: username, Email: inv.Email, PasswordHash: hash}
+	if err := s.db.CreateUser(r.Context(), user); err != nil {
+		jsonError(w, "username or email already taken", http.StatusConflict)
+		return nil, false
+	}
+	return user, true
+}
+
+// signInWithMagicLink completes a sign-in proven by an emailed token other
+// than a magic link. It issues and redeems a magic link token for user so
+// the address counts as verified, as it would after a magic link sign-in.
+func (s *Server) signInWithMagicLink(w http.ResponseWriter, r *http.Request, user *models.User) {
+	token, err := randomToken(32)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC()
+	if err := s.db.CreateMagicLinkToken(r.Context(), &models.MagicLinkToken{
+		UserID:    user.ID,
+		TokenHash: sha256Hex(token),
+		ExpiresAt: now.Add(magicLinkTTL),
+	}); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	verified, err := s.db.ConsumeMagicLinkToken(r.Context(), sha256Hex(token), now)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	s.completeSignIn(w, r, verified)
+}
+
+func (s *Server) handleDeclineInvitationToken(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeInvitationToken(w, r)
+	if !ok {
+		return
+	}
+	inv, err := s.invitationSvc.GetByToken(r.Context(), req.Token)
+	if err != nil {
+		writeInvitationError(w, err)
+		return
+	}
+	if err := s.invitationSvc.Delete(r.Context(), inv); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -9,8 +9,10 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/odvcencio/got/pkg/object"
 	"github.com/odvcencio/gothub/internal/auth"
 	"github.com/odvcencio/gothub/internal/models"
+	"github.com/odvcencio/gothub/internal/service"
 )
 
 type createIssueRequest struct {
@@ -36,6 +38,12 @@ func (s *Server) handleCreateIssue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	issue.AuthorName = claims.Username
+	s.linkIssueReferences(r.Context(), repo, models.IssueReference{
+		SourceType:   models.IssueReferenceSourceIssue,
+		SourceID:     issue.ID,
+		SourceNumber: issue.Number,
+		ActorID:      claims.UserID,
+	}, issue.Body)
 	if err := s.notifySvc.NotifyIssueOpened(r.Context(), repo, issue, claims.UserID); err != nil {
 		slog.Error("notify issue opened", "error", err, "repo_id", repo.ID, "issue", issue.Number)
 	}
@@ -98,6 +106,7 @@ type updateIssueRequest struct {
 }
 
 func (s *Server) handleUpdateIssue(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
 	repo, ok := s.authorizeRepoRequest(w, r, true)
 	if !ok {
 		return
@@ -136,6 +145,14 @@ func (s *Server) handleUpdateIssue(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if req.Body != nil {
+		s.linkIssueReferences(r.Context(), repo, models.IssueReference{
+			SourceType:   models.IssueReferenceSourceIssue,
+			SourceID:     issue.ID,
+			SourceNumber: issue.Number,
+			ActorID:      claims.UserID,
+		}, issue.Body)
+	}
 
 	action := issueWebhookAction(beforeState, issue.State)
 	s.runWebhookAsync(r.Context(), "webhook issue event", []any{"repo_id", repo.ID, "issue", issue.Number, "action", action}, func(ctx context.Context) error {
@@ -179,16 +196,35 @@ func (s *Server) handleCreateIssueComment(w http.ResponseWriter, r *http.Request
 		jsonError(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
-	comment, err := s.issueSvc.CreateComment(r.Context(), issue.ID, claims.UserID, req.Body)
+	comment, err := s.postIssueComment(r.Context(), repo, issue, claims.UserID, claims.Username, req.Body)
 	if err != nil {
 		jsonError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	comment.AuthorName = claims.Username
-	if err := s.notifySvc.NotifyIssueComment(r.Context(), repo, issue, comment, claims.UserID); err != nil {
+	jsonResponse(w, http.StatusCreated, comment)
+}
+
+// postIssueComment creates a comment and runs what every new comment
+// triggers: issue reference links, notifications and webhooks.
+func (s *Server) postIssueComment(ctx context.Context, repo *models.Repository, issue *models.Issue, authorID int64, authorName, body string) (*models.IssueComment, error) {
+	comment, err := s.issueSvc.CreateComment(ctx, issue.ID, authorID, body)
+	if err != nil {
+		return nil, err
+	}
+	comment.AuthorName = authorName
+	s.linkIssueReferences(ctx, repo, models.IssueReference{
+		SourceType:   models.IssueReferenceSourceIssue,
+		SourceID:     issue.ID,
+		SourceNumber: issue.Number,
+		ActorID:      authorID,
+	}, comment.Body)
+	if err := s.notifySvc.NotifyIssueComment(ctx, repo, issue, comment, authorID); err != nil {
 		slog.Error("notify issue comment", "error", err, "repo_id", repo.ID, "issue", issue.Number)
 	}
-	jsonResponse(w, http.StatusCreated, comment)
+	s.runWebhookAsync(ctx, "webhook issue comment", []any{"repo_id", repo.ID, "issue", issue.Number, "comment_id", comment.ID}, func(ctx context.Context) error {
+		return s.webhookSvc.EmitIssueCommentEvent(ctx, repo.ID, issue, comment)
+	})
+	return comment, nil
 }
 
 func (s *Server) handleDeleteIssueComment(w http.ResponseWriter, r *http.Request) {
@@ -231,6 +267,305 @@ func (s *Server) handleListIssueComments(w http.ResponseWriter, r *http.Request)
 	jsonResponse(w, http.StatusOK, comments)
 }
 
+func (s *Server) handleListIssueReferences(w http.ResponseWriter, r *http.Request) {
+	repo, ok := s.authorizeRepoRequest(w, r, false)
+	if !ok {
+		return
+	}
+	number, ok := parsePathPositiveInt(w, r, "number", "issue number")
+	if !ok {
+		return
+	}
+	issue, err := s.issueSvc.Get(r.Context(), repo.ID, number)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "issue not found", http.StatusNotFound)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	page, perPage := parsePagination(r, 50, 200)
+	refs, err := s.issueSvc.ListReferences(r.Context(), issue.ID, page, perPage)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, refs)
+}
+
+func (s *Server) handleSearchIssues(w http.ResponseWriter, r *http.Request) {
+	repo, ok := s.authorizeRepoRequest(w, r, false)
+	if !ok {
+		return
+	}
+	page, perPage := parsePagination(r, 30, 100)
+	results, ignored, err := s.issueSvc.Search(r.Context(), repo.ID, r.URL.Query().Get("q"), page, perPage)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidIssueSearch) {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.Error("search issues", "error", err, "repo_id", repo.ID)
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if results == nil {
+		results = []models.IssueSearchResult{}
+	}
+	if len(ignored) > 0 {
+		w.Header().Set("X-Gothub-Ignored-Qualifiers", strings.Join(ignored, " "))
+	}
+	jsonResponse(w, http.StatusOK, results)
+}
+
+type linkIssueEntitiesRequest struct {
+	StableIDs []string `json:"stable_ids"`
+}
+
+func (s *Server) handleLinkIssueEntities(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	repo, ok := s.authorizeRepoRequest(w, r, true)
+	if !ok {
+		return
+	}
+	number, ok := parsePathPositiveInt(w, r, "number", "issue number")
+	if !ok {
+		return
+	}
+	issue, err := s.issueSvc.Get(r.Context(), repo.ID, number)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "issue not found", http.StatusNotFound)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	var req linkIssueEntitiesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	links, err := s.issueSvc.LinkEntities(r.Context(), issue, claims.UserID, req.StableIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrEntityNotFound):
+			jsonError(w, err.Error(), http.StatusNotFound)
+		case strings.Contains(err.Error(), "required"):
+			jsonError(w, err.Error(), http.StatusBadRequest)
+		default:
+			slog.Error("link issue entities", "error", err, "repo_id", repo.ID, "issue", issue.Number)
+			jsonError(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+	jsonResponse(w, http.StatusCreated, links)
+}
+
+func (s *Server) handleListIssueEntities(w http.ResponseWriter, r *http.Request) {
+	repo, ok := s.authorizeRepoRequest(w, r, false)
+	if !ok {
+		return
+	}
+	number, ok := parsePathPositiveInt(w, r, "number", "issue number")
+	if !ok {
+		return
+	}
+	issue, err := s.issueSvc.Get(r.Context(), repo.ID, number)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "issue not found", http.StatusNotFound)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	links, err := s.issueSvc.ListEntityLinks(r.Context(), issue.ID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if links == nil {
+		links = []models.IssueEntityLink{}
+	}
+	jsonResponse(w, http.StatusOK, links)
+}
+
+func (s *Server) handleUnlinkIssueEntity(w http.ResponseWriter, r *http.Request) {
+	repo, ok := s.authorizeRepoRequest(w, r, true)
+	if !ok {
+		return
+	}
+	number, ok := parsePathPositiveInt(w, r, "number", "issue number")
+	if !ok {
+		return
+	}
+	issue, err := s.issueSvc.Get(r.Context(), repo.ID, number)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "issue not found", http.StatusNotFound)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.issueSvc.UnlinkEntity(r.Context(), issue.ID, r.PathValue("stable_id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "entity link not found", http.StatusNotFound)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/v1/repos/{owner}/{repo}/entity-issues?stable_id=...|path=...&ref=...
+func (s *Server) handleListEntityIssues(w http.ResponseWriter, r *http.Request) {
+	repo, ok := s.authorizeRepoRequest(w, r, false)
+	if !ok {
+		return
+	}
+	stableID := strings.TrimSpace(r.URL.Query().Get("stable_id"))
+	path := strings.TrimSpace(r.URL.Query().Get("path"))
+	var stableIDs []string
+	switch {
+	case stableID != "":
+		stableIDs = []string{stableID}
+	case path != "":
+		ref := strings.TrimSpace(r.URL.Query().Get("ref"))
+		if ref == "" {
+			ref = repo.DefaultBranch
+		}
+		ids, err := s.diffSvc.EntityStableIDs(r.Context(), r.PathValue("owner"), r.PathValue("repo"), ref, path)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if strings.Contains(err.Error(), "resolve ref") {
+				status = http.StatusNotFound
+			}
+			jsonError(w, err.Error(), status)
+			return
+		}
+		stableIDs = ids
+	default:
+		jsonError(w, "stable_id or path query is required", http.StatusBadRequest)
+		return
+	}
+	links, err := s.issueSvc.ListOpenIssuesForEntities(r.Context(), repo.ID, stableIDs)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if links == nil {
+		links = []models.IssueEntityLink{}
+	}
+	jsonResponse(w, http.StatusOK, links)
+}
+
+// linkIssueReferences records #N cross-references found in text and returns
+// the open issues it asks to close. Failures are logged, not surfaced.
+func (s *Server) linkIssueReferences(ctx context.Context, repo *models.Repository, source models.IssueReference, text string) []*models.Issue {
+	closable, err := s.issueSvc.LinkReferences(ctx, repo.ID, source, text)
+	if err != nil {
+		slog.Error("link issue references", "error", err, "repo_id", repo.ID, "source_type", source.SourceType, "source_number", source.SourceNumber)
+	}
+	return closable
+}
+
+// closeLinkedIssues closes issues referenced with closing keywords and emits
+// the same notifications, webhooks and realtime events as a manual close.
+func (s *Server) closeLinkedIssues(ctx context.Context, repo *models.Repository, issues []*models.Issue, actorID int64) {
+	closed, err := s.issueSvc.CloseIssues(ctx, issues)
+	if err != nil {
+		slog.Error("close linked issues", "error", err, "repo_id", repo.ID)
+	}
+	for _, issue := range closed {
+		if err := s.notifySvc.NotifyIssueClosed(ctx, repo, issue, actorID); err != nil {
+			slog.Error("notify issue closed", "error", err, "repo_id", repo.ID, "issue", issue.Number)
+		}
+		s.runWebhookAsync(ctx, "webhook issue closed", []any{"repo_id", repo.ID, "issue", issue.Number}, func(ctx context.Context) error {
+			return s.webhookSvc.EmitIssueEvent(ctx, repo.ID, models.WebhookActionClosed, issue.Number, issue.Title, issue.Body, issue.State)
+		})
+		s.publishRepoEvent(repo.ID, "issue.closed", map[string]any{
+			"number": issue.Number,
+			"title":  issue.Title,
+			"state":  issue.State,
+		})
+	}
+}
+
+// linkMergedPullRequestIssues records references from a merged PR's
+// description and commits, closing linked issues when the PR landed on the
+// default branch.
+func (s *Server) linkMergedPullRequestIssues(ctx context.Context, repo *models.Repository, pr *models.PullRequest, actorID int64) {
+	closable := s.linkIssueReferences(ctx, repo, models.IssueReference{
+		SourceType:   models.IssueReferenceSourcePullRequest,
+		SourceID:     pr.ID,
+		SourceNumber: pr.Number,
+		ActorID:      actorID,
+	}, pr.Title+"\n"+pr.Body)
+
+	store, err := s.repoSvc.OpenStoreByID(ctx, repo.ID)
+	if err != nil {
+		slog.Error("link merged pr commits", "error", err, "repo_id", repo.ID, "pr", pr.Number)
+	} else {
+		// Skip everything already on the target branch, including target
+		// history the source branch merged back in.
+		target := []object.Hash{object.Hash(pr.TargetCommit)}
+		commitIssues, err := s.issueSvc.LinkCommitReferences(ctx, repo.ID, actorID, store.Objects, target, object.Hash(pr.SourceCommit))
+		if err != nil {
+			slog.Error("link merged pr commits", "error", err, "repo_id", repo.ID, "pr", pr.Number)
+		}
+		closable = append(closable, commitIssues...)
+	}
+
+	if pr.TargetBranch != repo.DefaultBranch {
+		return
+	}
+	s.closeLinkedIssues(ctx, repo, closable, actorID)
+}
+
+// linkPushedCommits records issue references from commit messages introduced
+// by a push and closes linked issues when the default branch moved.
+func (s *Server) linkPushedCommits(ctx context.Context, owner, repoName, refName string, oldHash, newHash object.Hash) error {
+	actorID, ok := pushActorID(ctx)
+	if !ok || newHash == "" || !strings.HasPrefix(refName, "heads/") {
+		return nil
+	}
+	repo, err := s.repoSvc.Get(ctx, owner, repoName)
+	if err != nil {
+		return err
+	}
+	store, err := s.repoSvc.OpenStore(ctx, owner, repoName)
+	if err != nil {
+		return err
+	}
+	// Only commits the push introduced count: those not reachable from the
+	// old head or, for a new branch, from any other branch.
+	known := []object.Hash{oldHash}
+	if oldHash == "" {
+		heads, err := store.Refs.List("heads")
+		if err != nil {
+			return err
+		}
+		for name, h := range heads {
+			if name != refName {
+				known = append(known, h)
+			}
+		}
+	}
+	closable, err := s.issueSvc.LinkCommitReferences(ctx, repo.ID, actorID, store.Objects, known, newHash)
+	if err != nil {
+		return err
+	}
+	if strings.TrimPrefix(refName, "heads/") != repo.DefaultBranch {
+		return nil
+	}
+	s.closeLinkedIssues(ctx, repo, closable, actorID)
+	return nil
+}
+
 func issueWebhookAction(beforeState, afterState string) string {
 	if beforeState == afterState {
 		return models.WebhookActionEdited
@@ -9,6 +9,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/odvcencio/gothub/internal/service"
 )
 
 const (
@@ -169,6 +171,9 @@ func requestLoggingMiddleware(ipResolver clientIPResolver, next http.Handler) ht
 		start := time.Now()
 		reqID := generateRequestID()
 		w.Header().Set("X-Request-ID", reqID)
+		ip := ipResolver.clientIPFromRequest(r)
+		// Audit events record the request ID and IP of the change.
+		r = r.WithContext(service.WithRequestInfo(r.Context(), service.RequestInfo{RequestID: reqID, IP: ip}))
 		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
 		next.ServeHTTP(rec, r)
 		slog.Info("request",
@@ -177,7 +182,7 @@ func requestLoggingMiddleware(ipResolver clientIPResolver, next http.Handler) ht
 			"path", r.URL.RequestURI(),
 			"status", rec.status,
 			"duration", time.Since(start),
-			"ip", ipResolver.clientIPFromRequest(r),
+			"ip", ip,
 		)
 	})
 }
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/odvcencio/gothub/internal/mail"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+// handleInboundMail accepts a raw RFC 822 message from a mail provider's
+// inbound webhook and posts it as a comment when it is a reply to a
+// notification email. The provider authenticates with the shared inbound
+// secret, either in X-Gothub-Inbound-Secret or as a basic auth password.
+//
+// Messages that can never become a comment are answered with 2xx or 4xx so
+// providers do not retry them; only server errors ask for a retry.
+func (s *Server) handleInboundMail(w http.ResponseWriter, r *http.Request) {
+	if s.mailInboundSecret == "" {
+		jsonError(w, "not found", http.StatusNotFound)
+		return
+	}
+	if !s.inboundMailAuthorized(r) {
+		jsonError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	msg, err := mail.ParseInbound(r.Body)
+	if errors.Is(err, mail.ErrAutoReply) {
+		jsonResponse(w, http.StatusAccepted, map[string]string{"status": "ignored", "reason": err.Error()})
+		return
+	}
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var userID, threadID int64
+	var threadType string
+	found := false
+	for _, rcpt := range msg.Recipients {
+		if userID, threadType, threadID, err = s.mailSvc.ParseReplyAddress(rcpt); err == nil {
+			found = true
+			break
+		}
+	}
+	if !found {
+		jsonError(w, "no valid reply address among recipients", http.StatusUnprocessableEntity)
+		return
+	}
+	user, err := s.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		jsonError(w, "reply address is no longer valid", http.StatusUnprocessableEntity)
+		return
+	}
+	// Repo access checks do not look at suspension, so a suspended user's
+	// reply addresses must be refused here.
+	if rejectSuspended(w, user) {
+		return
+	}
+	// The token proves which notification is being answered; the sender
+	// must still be the recipient it was sent to.
+	if !strings.EqualFold(strings.TrimSpace(user.Email), msg.From) {
+		jsonError(w, "sender does not match reply address", http.StatusForbidden)
+		return
+	}
+	if msg.Text == "" {
+		jsonError(w, "reply has no new text", http.StatusUnprocessableEntity)
+		return
+	}
+
+	ctx := r.Context()
+	attrs := []any{"user_id", user.ID, "thread_type", threadType, "thread_id", threadID, "message_id", msg.MessageID}
+	switch threadType {
+	case models.ThreadTypeIssue:
+		issue, err := s.db.GetIssueByID(ctx, threadID)
+		if err != nil {
+			jsonError(w, "issue not found", http.StatusNotFound)
+			return
+		}
+		repo, ok := s.inboundMailRepo(w, r, issue.RepoID, user.ID)
+		if !ok {
+			return
+		}
+		comment, err := s.postIssueComment(ctx, repo, issue, user.ID, user.Username, msg.Text)
+		if err != nil {
+			slog.Error("post issue comment from email", append(attrs, "error", err)...)
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, http.StatusCreated, comment)
+	case models.ThreadTypePullRequest:
+		pr, err := s.db.GetPullRequestByID(ctx, threadID)
+		if err != nil {
+			jsonError(w, "pull request not found", http.StatusNotFound)
+			return
+		}
+		repo, ok := s.inboundMailRepo(w, r, pr.RepoID, user.ID)
+		if !ok {
+			return
+		}
+		comment := &models.PRComment{PRID: pr.ID, AuthorID: user.ID, Body: msg.Text}
+		if err := s.postPRComment(ctx, repo, pr, comment, user.Username); err != nil {
+			slog.Error("post pr comment from email", append(attrs, "error", err)...)
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, http.StatusCreated, comment)
+	default:
+		jsonError(w, "unsupported thread", http.StatusUnprocessableEntity)
+	}
+}
+
+func (s *Server) inboundMailAuthorized(r *http.Request) bool {
+	secret := r.Header.Get("X-Gothub-Inbound-Secret")
+	if secret == "" {
+		_, secret, _ = r.BasicAuth()
+	}
+	return secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(s.mailInboundSecret)) == 1
+}
+
+// inboundMailRepo loads the thread's repository and checks that the replying
+// user may still comment on it, as the comment APIs require.
+func (s *Server) inboundMailRepo(w http.ResponseWriter, r *http.Request, repoID, userID int64) (*models.Repository, bool) {
+	repo, err := s.db.GetRepositoryByID(r.Context(), repoID)
+	if err != nil {
+		jsonError(w, "repository not found", http.StatusNotFound)
+		return nil, false
+	}
+	allowed, err := s.userHasRepoAccess(r.Context(), repo, userID, true)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !allowed {
+		jsonError(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return repo, true
+}
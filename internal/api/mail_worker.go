@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/service"
+)
+
+const defaultMailWorkerPoll = time.Second
+
+// mailWorker drains the outbound email queue. One worker is enough: sends
+// are I/O bound and SMTP relays rate-limit per connection anyway.
+type mailWorker struct {
+	mailSvc      *service.MailService
+	pollInterval time.Duration
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newMailWorker(mailSvc *service.MailService, pollInterval time.Duration) *mailWorker {
+	if pollInterval <= 0 {
+		pollInterval = defaultMailWorkerPoll
+	}
+	return &mailWorker{mailSvc: mailSvc, pollInterval: pollInterval}
+}
+
+func (w *mailWorker) Start(parent context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(parent)
+	done := make(chan struct{})
+	w.cancel = cancel
+	w.done = done
+	go w.run(ctx, done)
+	return nil
+}
+
+func (w *mailWorker) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	cancel, done := w.cancel, w.done
+	w.cancel, w.done = nil, nil
+	w.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *mailWorker) run(ctx context.Context, done chan<- struct{}) {
+	defer close(done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		// Keep sending while messages are due, then wait for the next poll.
+		for {
+			claimed, err := w.mailSvc.ProcessNext(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("mail worker failed", "error", err)
+				}
+				break
+			}
+			if !claimed || ctx.Err() != nil {
+				break
+			}
+		}
+		timer.Reset(w.pollInterval)
+	}
+}
@@ -1,10 +1,16 @@
 package api
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 
 	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/models"
+	"github.com/odvcencio/gothub/internal/service"
 )
 
 func (s *Server) handleListNotifications(w http.ResponseWriter, r *http.Request) {
@@ -15,10 +21,17 @@ func (s *Server) handleListNotifications(w http.ResponseWriter, r *http.Request)
 	}
 
 	unreadOnly := parseBool(r.URL.Query().Get("unread"))
+	reason := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("reason")))
+	switch reason {
+	case "", models.NotificationReasonMention, models.NotificationReasonReviewRequested, models.NotificationReasonSubscribed, models.NotificationReasonAuthor:
+	default:
+		jsonError(w, "reason must be mention, review_requested, subscribed or author", http.StatusBadRequest)
+		return
+	}
 	page, perPage := parsePagination(r, 30, 200)
 	limit := perPage
 	offset := (page - 1) * perPage
-	notifications, err := s.db.ListNotificationsPage(r.Context(), claims.UserID, unreadOnly, limit, offset)
+	notifications, err := s.db.ListNotificationsPage(r.Context(), claims.UserID, unreadOnly, reason, limit, offset)
 	if err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
@@ -72,6 +85,200 @@ func (s *Server) handleMarkAllNotificationsRead(w http.ResponseWriter, r *http.R
 	w.WriteHeader(http.StatusNoContent)
 }
 
+type setRepoWatchRequest struct {
+	Level string `json:"level"` // "all", "participating", "ignore"
+}
+
+func (s *Server) handleGetRepoSubscription(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	repo, ok := s.authorizeRepoRequest(w, r, false)
+	if !ok {
+		return
+	}
+	watch, err := s.notifySvc.RepoWatch(r.Context(), claims.UserID, repo.ID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, watch)
+}
+
+func (s *Server) handleSetRepoSubscription(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	repo, ok := s.authorizeRepoRequest(w, r, false)
+	if !ok {
+		return
+	}
+	var req setRepoWatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	watch, err := s.notifySvc.WatchRepo(r.Context(), claims.UserID, repo.ID, req.Level)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidWatchLevel) {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, watch)
+}
+
+func (s *Server) handleDeleteRepoSubscription(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	repo, ok := s.authorizeRepoRequest(w, r, false)
+	if !ok {
+		return
+	}
+	if err := s.notifySvc.UnwatchRepo(r.Context(), claims.UserID, repo.ID); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type setThreadSubscriptionRequest struct {
+	Subscribed bool `json:"subscribed"`
+}
+
+func (s *Server) handleGetIssueSubscription(w http.ResponseWriter, r *http.Request) {
+	s.serveThreadSubscription(w, r, models.ThreadTypeIssue, false)
+}
+
+func (s *Server) handleSetIssueSubscription(w http.ResponseWriter, r *http.Request) {
+	s.serveThreadSubscription(w, r, models.ThreadTypeIssue, true)
+}
+
+func (s *Server) handleGetPRSubscription(w http.ResponseWriter, r *http.Request) {
+	s.serveThreadSubscription(w, r, models.ThreadTypePullRequest, false)
+}
+
+func (s *Server) handleSetPRSubscription(w http.ResponseWriter, r *http.Request) {
+	s.serveThreadSubscription(w, r, models.ThreadTypePullRequest, true)
+}
+
+// serveThreadSubscription reads or, when update is set, replaces the caller's
+// subscription to an issue or pull request.
+func (s *Server) serveThreadSubscription(w http.ResponseWriter, r *http.Request, threadType string, update bool) {
+	claims := auth.GetClaims(r.Context())
+	repo, ok := s.authorizeRepoRequest(w, r, false)
+	if !ok {
+		return
+	}
+	var threadID int64
+	if threadType == models.ThreadTypeIssue {
+		number, ok := parsePathPositiveInt(w, r, "number", "issue number")
+		if !ok {
+			return
+		}
+		issue, err := s.issueSvc.Get(r.Context(), repo.ID, number)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				jsonError(w, "issue not found", http.StatusNotFound)
+				return
+			}
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		threadID = issue.ID
+	} else {
+		number, ok := parsePathPositiveInt(w, r, "number", "pull request number")
+		if !ok {
+			return
+		}
+		pr, err := s.prSvc.Get(r.Context(), repo.ID, number)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				jsonError(w, "pull request not found", http.StatusNotFound)
+				return
+			}
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		threadID = pr.ID
+	}
+
+	var (
+		sub *models.ThreadSubscription
+		err error
+	)
+	if update {
+		var req setThreadSubscriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		sub, err = s.notifySvc.SetThreadSubscription(r.Context(), claims.UserID, repo.ID, threadType, threadID, req.Subscribed)
+	} else {
+		sub, err = s.notifySvc.ThreadSubscription(r.Context(), claims.UserID, repo.ID, threadType, threadID)
+	}
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, sub)
+}
+
+type requestReviewersRequest struct {
+	Reviewers []string `json:"reviewers"`
+}
+
+func (s *Server) handleRequestPRReviewers(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	number, ok := parsePathPositiveInt(w, r, "number", "pull request number")
+	if !ok {
+		return
+	}
+	repo, ok := s.authorizeRepoRequest(w, r, true)
+	if !ok {
+		return
+	}
+	pr, err := s.prSvc.Get(r.Context(), repo.ID, number)
+	if err != nil {
+		jsonError(w, "pull request not found", http.StatusNotFound)
+		return
+	}
+	var req requestReviewersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Reviewers) == 0 {
+		jsonError(w, "reviewers is required", http.StatusBadRequest)
+		return
+	}
+	var reviewerIDs []int64
+	for _, name := range req.Reviewers {
+		user, err := s.db.GetUserByUsername(r.Context(), strings.TrimPrefix(strings.TrimSpace(name), "@"))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				jsonError(w, "reviewer not found: "+name, http.StatusUnprocessableEntity)
+				return
+			}
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		canRead, err := s.userHasRepoAccess(r.Context(), repo, user.ID, false)
+		if err != nil {
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if !canRead && repo.IsPrivate {
+			jsonError(w, "reviewer cannot access repository: "+name, http.StatusUnprocessableEntity)
+			return
+		}
+		reviewerIDs = append(reviewerIDs, user.ID)
+	}
+	if err := s.notifySvc.NotifyReviewRequested(r.Context(), repo, pr, reviewerIDs, claims.UserID); err != nil {
+		slog.Error("notify review requested", "error", err, "repo_id", repo.ID, "pr", pr.Number)
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func parseBool(raw string) bool {
 	switch strings.ToLower(strings.TrimSpace(raw)) {
 	case "1", "true", "yes", "on":
@@ -80,3 +287,44 @@ func parseBool(raw string) bool {
 		return false
 	}
 }
+
+func (s *Server) handleGetNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	if claims == nil {
+		jsonError(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	settings, err := s.notifySvc.GetNotificationSettings(r.Context(), claims.UserID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, settings)
+}
+
+func (s *Server) handleUpdateNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	if claims == nil {
+		jsonError(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		EmailFrequency string `json:"email_frequency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	settings, err := s.notifySvc.SetEmailFrequency(r.Context(), claims.UserID, req.EmailFrequency)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidEmailFrequency) {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, settings)
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/models"
+	"github.com/odvcencio/gothub/internal/service"
+)
+
+type oauthAppRequest struct {
+	Name         string   `json:"name"`
+	HomepageURL  string   `json:"homepage_url"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+type oauthAppSecretResponse struct {
+	*models.OAuthApp
+	ClientSecret string `json:"client_secret"`
+}
+
+// oauthAuthorizeRequest carries the authorization request parameters an
+// app put in its /oauth/authorize link, plus the user's decision.
+type oauthAuthorizeRequest struct {
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+
+func (s *Server) handleCreateOAuthApp(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	var req oauthAppRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	app, secret, err := s.oauthSvc.CreateApp(r.Context(), claims.UserID, req.Name, req.HomepageURL, req.RedirectURIs)
+	if err != nil {
+		writeOAuthAppError(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusCreated, oauthAppSecretResponse{OAuthApp: app, ClientSecret: secret})
+}
+
+func (s *Server) handleListOAuthApps(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	apps, err := s.oauthSvc.ListApps(r.Context(), claims.UserID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, apps)
+}
+
+func (s *Server) handleGetOAuthApp(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	id, ok := parsePathPositiveInt64(w, r, "id", "app id")
+	if !ok {
+		return
+	}
+	app, err := s.oauthSvc.GetApp(r.Context(), claims.UserID, id)
+	if err != nil {
+		writeOAuthAppError(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, app)
+}
+
+func (s *Server) handleUpdateOAuthApp(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	id, ok := parsePathPositiveInt64(w, r, "id", "app id")
+	if !ok {
+		return
+	}
+	var req oauthAppRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	app, err := s.oauthSvc.UpdateApp(r.Context(), claims.UserID, id, req.Name, req.HomepageURL, req.RedirectURIs)
+	if err != nil {
+		writeOAuthAppError(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, app)
+}
+
+func (s *Server) handleResetOAuthAppSecret(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	id, ok := parsePathPositiveInt64(w, r, "id", "app id")
+	if !ok {
+		return
+	}
+	app, secret, err := s.oauthSvc.ResetSecret(r.Context(), claims.UserID, id)
+	if err != nil {
+		writeOAuthAppError(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, oauthAppSecretResponse{OAuthApp: app, ClientSecret: secret})
+}
+
+func (s *Server) handleDeleteOAuthApp(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	id, ok := parsePathPositiveInt64(w, r, "id", "app id")
+	if !ok {
+		return
+	}
+	if err := s.oauthSvc.DeleteApp(r.Context(), claims.UserID, id); err != nil {
+		writeOAuthAppError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeOAuthAppError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrOAuthAppNotFound):
+		jsonError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidRedirectURI), errors.Is(err, service.ErrInvalidTokenScope),
+		errors.Is(err, service.ErrUnsupportedPKCEMethod), errors.Is(err, service.ErrInvalidOAuthApp):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	default:
+		jsonError(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+// handleGetOAuthAuthorization validates an authorization request and
+// returns what the consent page shows: the app and the scopes it asks for.
+func (s *Server) handleGetOAuthAuthorization(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if rt := q.Get("response_type"); rt != "" && rt != "code" {
+		jsonError(w, "response_type must be code", http.StatusBadRequest)
+		return
+	}
+	app, redirectURI, scopes, err := s.oauthSvc.PrepareAuthorization(r.Context(), q.Get("client_id"), q.Get("redirect_uri"), q.Get("scope"))
+	if err != nil {
+		writeOAuthAppError(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"app": map[string]any{
+			"name":         app.Name,
+			"homepage_url": app.HomepageURL,
+			"client_id":    app.ClientID,
+		},
+		"redirect_uri": redirectURI,
+		"scopes":       scopes,
+	})
+}
+
+// handleOAuthAuthorize records the user's decision and returns the URL to
+// send the browser back to the app with, carrying a code or access_denied.
+func (s *Server) handleOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	var req oauthAuthorizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	app, redirectURI, scopes, err := s.oauthSvc.PrepareAuthorization(r.Context(), req.ClientID, req.RedirectURI, req.Scope)
+	if err != nil {
+		writeOAuthAppError(w, err)
+		return
+	}
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		jsonError(w, "invalid redirect uri", http.StatusBadRequest)
+		return
+	}
+	params := target.Query()
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	if req.Approve {
+		code, err := s.oauthSvc.Authorize(r.Context(), claims.UserID, app, redirectURI, scopes, req.CodeChallenge, req.CodeChallengeMethod)
+		if err != nil {
+			writeOAuthAppError(w, err)
+			return
+		}
+		params.Set("code", code)
+	} else {
+		params.Set("error", "access_denied")
+	}
+	target.RawQuery = params.Encode()
+	jsonResponse(w, http.StatusOK, map[string]string{"redirect_url": target.String()})
+}
+
+// handleOAuthToken is the token endpoint (RFC 6749 section 3.2). Clients
+// authenticate with HTTP Basic or client_id and client_secret form fields.
+func (s *Server) handleOAuthToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if err := r.ParseForm(); err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID, clientSecret := oauthClientCredentials(r)
+	var (
+		grant *service.OAuthTokenGrant
+		err   error
+	)
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		grant, err = s.oauthSvc.Exchange(r.Context(), clientID, clientSecret,
+			r.PostForm.Get("code"), r.PostForm.Get("redirect_uri"), r.PostForm.Get("code_verifier"))
+	case "refresh_token":
+		grant, err = s.oauthSvc.Refresh(r.Context(), clientID, clientSecret, r.PostForm.Get("refresh_token"))
+	default:
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	switch {
+	case err == nil:
+		jsonResponse(w, http.StatusOK, grant)
+	case errors.Is(err, service.ErrInvalidOAuthClient):
+		w.Header().Set("WWW-Authenticate", `Basic realm="gothub"`)
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+	case errors.Is(err, service.ErrInvalidOAuthGrant):
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+	default:
+		slog.Error("oauth token", "error", err)
+		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+	}
+}
+
+// handleOAuthRevoke is the token revocation endpoint (RFC 7009).
+func (s *Server) handleOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID, clientSecret := oauthClientCredentials(r)
+	err := s.oauthSvc.RevokeToken(r.Context(), clientID, clientSecret, r.PostForm.Get("token"))
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, service.ErrInvalidOAuthClient):
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+	default:
+		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+	}
+}
+
+func oauthClientCredentials(r *http.Request) (string, string) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		return id, secret
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+}
+
+func (s *Server) handleListOAuthAuthorizations(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	auths, err := s.oauthSvc.ListAuthorizations(r.Context(), claims.UserID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, auths)
+}
+
+func (s *Server) handleRevokeOAuthAuthorization(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	appID, ok := parsePathPositiveInt64(w, r, "app_id", "app id")
+	if !ok {
+		return
+	}
+	if err := s.oauthSvc.RevokeAuthorization(r.Context(), claims.UserID, appID); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -6,9 +6,11 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/odvcencio/gothub/internal/auth"
 	"github.com/odvcencio/gothub/internal/models"
+	"github.com/odvcencio/gothub/internal/service"
 )
 
 func (s *Server) handleCreateOrg(w http.ResponseWriter, r *http.Request) {
@@ -99,6 +101,7 @@ func (s *Server) handleDeleteOrg(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "failed to delete org", http.StatusInternalServerError)
 		return
 	}
+	s.auditSvc.RecordOrg(r.Context(), org, service.AuditOrgDelete, "", org, nil)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -128,6 +131,8 @@ func (s *Server) handleListOrgMembers(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, http.StatusOK, members)
 }
 
+// handleAddOrgMember invites a user, by username or by email address, to
+// join the org. Membership starts once the invitee accepts.
 func (s *Server) handleAddOrgMember(w http.ResponseWriter, r *http.Request) {
 	orgName := r.PathValue("org")
 	claims := auth.GetClaims(r.Context())
@@ -142,7 +147,7 @@ func (s *Server) handleAddOrgMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Only owners can add members
+	// Only owners can invite members
 	member, err := s.db.GetOrgMember(r.Context(), org.ID, claims.UserID)
 	if err != nil || member.Role != "owner" {
 		jsonError(w, "only org owners can manage members", http.StatusForbidden)
@@ -151,12 +156,17 @@ func (s *Server) handleAddOrgMember(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
 		Username string `json:"username"`
+		Email    string `json:"email"`
 		Role     string `json:"role"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		jsonError(w, "invalid request", http.StatusBadRequest)
 		return
 	}
+	if strings.TrimSpace(req.Username) == "" && strings.TrimSpace(req.Email) == "" {
+		jsonError(w, "username or email is required", http.StatusBadRequest)
+		return
+	}
 	if req.Role == "" {
 		req.Role = "member"
 	}
@@ -167,22 +177,23 @@ func (s *Server) handleAddOrgMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := s.db.GetUserByUsername(r.Context(), req.Username)
-	if err != nil {
-		jsonError(w, "user not found", http.StatusNotFound)
-		return
+	if org.RequireTwoFactor && strings.TrimSpace(req.Username) != "" {
+		user, err := s.db.GetUserByUsername(r.Context(), strings.TrimSpace(req.Username))
+		if err != nil {
+			jsonError(w, "user not found", http.StatusNotFound)
+			return
+		}
+		if !s.requireOrgTwoFactor(w, r, org.ID, user.ID) {
+			return
+		}
 	}
 
-	if err := s.db.AddOrgMember(r.Context(), &models.OrgMember{
-		OrgID:  org.ID,
-		UserID: user.ID,
-		Role:   req.Role,
-	}); err != nil {
-		jsonError(w, "failed to add member", http.StatusInternalServerError)
+	inv, err := s.invitationSvc.InviteToOrg(r.Context(), org, claims.UserID, req.Username, req.Email, req.Role)
+	if err != nil {
+		writeInvitationError(w, err)
 		return
 	}
-
-	w.WriteHeader(http.StatusNoContent)
+	jsonResponse(w, http.StatusCreated, inv)
 }
 
 func (s *Server) handleRemoveOrgMember(w http.ResponseWriter, r *http.Request) {
@@ -217,6 +228,7 @@ func (s *Server) handleRemoveOrgMember(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "failed to remove member", http.StatusInternalServerError)
 		return
 	}
+	s.auditSvc.RecordOrg(r.Context(), org, service.AuditOrgMemberRemove, user.Username, nil, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -253,7 +265,7 @@ func (s *Server) handleListOrgRepos(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		repos = visible
-	} else if _, err := s.db.GetOrgMember(r.Context(), org.ID, claims.UserID); err != nil {
+	} else if member, err := s.db.GetOrgMember(r.Context(), org.ID, claims.UserID); err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
 			jsonError(w, "failed to verify org membership", http.StatusInternalServerError)
 			return
@@ -265,6 +277,23 @@ func (s *Server) handleListOrgRepos(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		repos = visible
+	} else if member.Role != "owner" && org.DefaultRepoPermission == "none" {
+		// Members only see the private repos their teams grant.
+		visible := repos[:0]
+		for _, repo := range repos {
+			if repo.IsPrivate {
+				ok, err := s.orgMemberHasRepoAccess(r.Context(), &repo, member, false)
+				if err != nil {
+					jsonError(w, "failed to check repository access", http.StatusInternalServerError)
+					return
+				}
+				if !ok {
+					continue
+				}
+			}
+			visible = append(visible, repo)
+		}
+		repos = visible
 	}
 
 	jsonResponse(w, http.StatusOK, repos)
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+// authorizeOrgOwner resolves the {org} path value and requires the caller to
+// be an owner of it. Org webhooks expose delivery bodies for every repository
+// in the org, so even reads are limited to owners.
+func (s *Server) authorizeOrgOwner(w http.ResponseWriter, r *http.Request) (*models.Org, bool) {
+	org, err := s.db.GetOrg(r.Context(), r.PathValue("org"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "org not found", http.StatusNotFound)
+			return nil, false
+		}
+		jsonError(w, "failed to get org", http.StatusInternalServerError)
+		return nil, false
+	}
+	claims := auth.GetClaims(r.Context())
+	member, err := s.db.GetOrgMember(r.Context(), org.ID, claims.UserID)
+	if err != nil || member.Role != "owner" {
+		jsonError(w, "only org owners can manage org webhooks", http.StatusForbidden)
+		return nil, false
+	}
+	return org, true
+}
+
+func (s *Server) handleCreateOrgWebhook(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.authorizeOrgOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var req createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.URL) == "" {
+		jsonError(w, "url is required", http.StatusBadRequest)
+		return
+	}
+
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+
+	hook := &models.Webhook{
+		OrgID:                org.ID,
+		URL:                  req.URL,
+		Secret:               req.Secret,
+		Events:               req.Events,
+		Active:               active,
+		TimestampedSignature: req.TimestampedSignature,
+	}
+	if err := s.webhookSvc.CreateWebhook(r.Context(), hook); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jsonResponse(w, http.StatusCreated, webhookToResponse(hook))
+}
+
+func (s *Server) handleListOrgWebhooks(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.authorizeOrgOwner(w, r)
+	if !ok {
+		return
+	}
+
+	page, perPage := parsePagination(r, 50, 200)
+	hooks, err := s.webhookSvc.ListOrgWebhooksPage(r.Context(), org.ID, page, perPage)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	resp := make([]webhookResponse, 0, len(hooks))
+	for i := range hooks {
+		resp = append(resp, webhookToResponse(&hooks[i]))
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetOrgWebhook(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.authorizeOrgOwner(w, r)
+	if !ok {
+		return
+	}
+	webhookID, ok := parsePathPositiveInt64(w, r, "id", "webhook id")
+	if !ok {
+		return
+	}
+
+	hook, err := s.webhookSvc.GetOrgWebhook(r.Context(), org.ID, webhookID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "webhook not found", http.StatusNotFound)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, webhookToResponse(hook))
+}
+
+func (s *Server) handleUpdateOrgWebhook(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.authorizeOrgOwner(w, r)
+	if !ok {
+		return
+	}
+	webhookID, ok := parsePathPositiveInt64(w, r, "id", "webhook id")
+	if !ok {
+		return
+	}
+	update, ok := decodeWebhookUpdate(w, r)
+	if !ok {
+		return
+	}
+
+	hook, err := s.webhookSvc.GetOrgWebhook(r.Context(), org.ID, webhookID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "webhook not found", http.StatusNotFound)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.webhookSvc.UpdateWebhook(r.Context(), hook, update); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonResponse(w, http.StatusOK, webhookToResponse(hook))
+}
+
+func (s *Server) handleDeleteOrgWebhook(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.authorizeOrgOwner(w, r)
+	if !ok {
+		return
+	}
+	webhookID, ok := parsePathPositiveInt64(w, r, "id", "webhook id")
+	if !ok {
+		return
+	}
+
+	if err := s.webhookSvc.DeleteOrgWebhook(r.Context(), org.ID, webhookID); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListOrgWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.authorizeOrgOwner(w, r)
+	if !ok {
+		return
+	}
+	webhookID, ok := parsePathPositiveInt64(w, r, "id", "webhook id")
+	if !ok {
+		return
+	}
+	if _, err := s.webhookSvc.GetOrgWebhook(r.Context(), org.ID, webhookID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "webhook not found", http.StatusNotFound)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	page, perPage := parsePagination(r, 50, 200)
+	deliveries, err := s.webhookSvc.ListOrgWebhookDeliveriesPage(r.Context(), org.ID, webhookID, page, perPage)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, deliveries)
+}
+
+func (s *Server) handleRedeliverOrgWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.authorizeOrgOwner(w, r)
+	if !ok {
+		return
+	}
+	webhookID, ok := parsePathPositiveInt64(w, r, "id", "webhook id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := parsePathPositiveInt64(w, r, "delivery_id", "delivery id")
+	if !ok {
+		return
+	}
+
+	delivery, err := s.webhookSvc.RedeliverOrg(r.Context(), org.ID, webhookID, deliveryID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "delivery not found", http.StatusNotFound)
+			return
+		}
+		jsonError(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	jsonResponse(w, http.StatusOK, delivery)
+}
+
+func (s *Server) handlePingOrgWebhook(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.authorizeOrgOwner(w, r)
+	if !ok {
+		return
+	}
+	webhookID, ok := parsePathPositiveInt64(w, r, "id", "webhook id")
+	if !ok {
+		return
+	}
+
+	delivery, err := s.webhookSvc.PingOrgWebhook(r.Context(), org.ID, webhookID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "webhook not found", http.StatusNotFound)
+			return
+		}
+		jsonError(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	jsonResponse(w, http.StatusOK, delivery)
+}
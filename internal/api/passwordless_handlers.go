@@ -71,10 +71,13 @@ func (s *Server) handleRequestMagicLink(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Until outbound email delivery is integrated, expose token for first-party UI.
-	resp["token"] = token
-	resp["expires_at"] = expires
-	slog.Info("magic link issued", "user_id", user.ID, "email", email)
+	// The token only ever leaves the server by email, so the response is the
+	// same whether or not the address belongs to an account.
+	if err := s.mailSvc.SendMagicLink(r.Context(), user, token, expires); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("magic link issued", "user_id", user.ID)
 	jsonResponse(w, http.StatusOK, resp)
 }
 
@@ -102,12 +105,7 @@ func (s *Server) handleVerifyMagicLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jwtToken, err := s.authSvc.GenerateToken(user.ID, user.Username)
-	if err != nil {
-		jsonError(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-	jsonResponse(w, http.StatusOK, tokenResponse{Token: jwtToken, User: user})
+	s.completeSignIn(w, r, user)
 }
 
 func (s *Server) handleSSHChallenge(w http.ResponseWriter, r *http.Request) {
@@ -245,12 +243,7 @@ func (s *Server) handleSSHVerify(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-	jwtToken, err := s.authSvc.GenerateToken(user.ID, user.Username)
-	if err != nil {
-		jsonError(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-	jsonResponse(w, http.StatusOK, tokenResponse{Token: jwtToken, User: user})
+	s.completeSignIn(w, r, user)
 }
 
 func (s *Server) handleBeginWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
@@ -509,7 +502,10 @@ func (s *Server) handleFinishWebAuthnLogin(w http.ResponseWriter, r *http.Reques
 		slog.Warn("update webauthn credential", "error", err, "user_id", user.ID)
 	}
 
-	jwtToken, err := s.authSvc.GenerateToken(user.ID, user.Username)
+	if rejectSuspended(w, user) {
+		return
+	}
+	jwtToken, err := s.issueSessionToken(r, user)
 	if err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -61,10 +62,17 @@ func (s *Server) handleUpsertBranchProtection(w http.ResponseWriter, r *http.Req
 		RequireSignedCommits:       req.RequireSignedCommits,
 		RequiredChecks:             req.RequiredChecks,
 	}
+	action := models.WebhookActionEdited
+	if _, err := s.prSvc.GetBranchProtectionRule(r.Context(), repo.ID, branch); errors.Is(err, sql.ErrNoRows) {
+		action = models.WebhookActionCreated
+	}
 	if err := s.prSvc.UpsertBranchProtectionRule(r.Context(), rule); err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	s.runWebhookAsync(r.Context(), "webhook branch protection rule", []any{"repo_id", repo.ID, "branch", branch, "action", action}, func(ctx context.Context) error {
+		return s.webhookSvc.EmitBranchProtectionRuleEvent(ctx, repo.ID, action, rule)
+	})
 	jsonResponse(w, http.StatusOK, rule)
 }
 
@@ -101,10 +109,20 @@ func (s *Server) handleDeleteBranchProtection(w http.ResponseWriter, r *http.Req
 		jsonError(w, "branch is required", http.StatusBadRequest)
 		return
 	}
+	rule, err := s.prSvc.GetBranchProtectionRule(r.Context(), repo.ID, branch)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
 	if err := s.prSvc.DeleteBranchProtectionRule(r.Context(), repo.ID, branch); err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	if rule != nil {
+		s.runWebhookAsync(r.Context(), "webhook branch protection rule", []any{"repo_id", repo.ID, "branch", branch, "action", models.WebhookActionDeleted}, func(ctx context.Context) error {
+			return s.webhookSvc.EmitBranchProtectionRuleEvent(ctx, repo.ID, models.WebhookActionDeleted, rule)
+		})
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -146,6 +164,9 @@ func (s *Server) handleUpsertPRCheckRun(w http.ResponseWriter, r *http.Request)
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	s.runWebhookAsync(r.Context(), "webhook check run", []any{"repo_id", repo.ID, "pr", pr.Number, "check", run.Name}, func(ctx context.Context) error {
+		return s.webhookSvc.EmitCheckRunEvent(ctx, repo.ID, pr, run)
+	})
 	jsonResponse(w, http.StatusOK, run)
 }
 
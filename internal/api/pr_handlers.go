@@ -46,6 +46,12 @@ func (s *Server) handleCreatePR(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	s.linkIssueReferences(r.Context(), repo, models.IssueReference{
+		SourceType:   models.IssueReferenceSourcePullRequest,
+		SourceID:     pr.ID,
+		SourceNumber: pr.Number,
+		ActorID:      claims.UserID,
+	}, pr.Title+"\n"+pr.Body)
 	if err := s.notifySvc.NotifyPullRequestOpened(r.Context(), repo, pr, claims.UserID); err != nil {
 		slog.Error("notify pr opened", "error", err, "repo_id", repo.ID, "pr", pr.Number)
 	}
@@ -131,6 +137,34 @@ func (s *Server) handlePRDiff(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, http.StatusOK, result)
 }
 
+func (s *Server) handlePRLinkedIssues(w http.ResponseWriter, r *http.Request) {
+	number, ok := parsePathPositiveInt(w, r, "number", "pull request number")
+	if !ok {
+		return
+	}
+
+	repo, ok := s.authorizeRepoRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	pr, err := s.prSvc.Get(r.Context(), repo.ID, number)
+	if err != nil {
+		jsonError(w, "pull request not found", http.StatusNotFound)
+		return
+	}
+
+	links, err := s.prSvc.LinkedIssues(r.Context(), r.PathValue("owner"), r.PathValue("repo"), pr)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if links == nil {
+		links = []models.IssueEntityLink{}
+	}
+	jsonResponse(w, http.StatusOK, links)
+}
+
 func (s *Server) handleMergePreview(w http.ResponseWriter, r *http.Request) {
 	owner := r.PathValue("owner")
 	repoName := r.PathValue("repo")
@@ -229,6 +263,8 @@ func (s *Server) handleMergePR(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.linkMergedPullRequestIssues(r.Context(), repo, pr, claims.UserID)
+
 	jsonResponse(w, http.StatusOK, map[string]string{
 		"merge_commit": string(mergeHash),
 		"status":       models.PullRequestStateMerged,
@@ -300,6 +336,12 @@ func (s *Server) handleUpdatePR(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	s.linkIssueReferences(r.Context(), repo, models.IssueReference{
+		SourceType:   models.IssueReferenceSourcePullRequest,
+		SourceID:     pr.ID,
+		SourceNumber: pr.Number,
+		ActorID:      claims.UserID,
+	}, pr.Title+"\n"+pr.Body)
 	jsonResponse(w, http.StatusOK, pr)
 }
 
@@ -390,15 +432,26 @@ func (s *Server) handleCreatePRComment(w http.ResponseWriter, r *http.Request) {
 		LineNumber:     req.LineNumber,
 		CommitHash:     req.CommitHash,
 	}
-	if err := s.prSvc.CreateComment(r.Context(), comment); err != nil {
+	if err := s.postPRComment(r.Context(), repo, pr, comment, claims.Username); err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-	comment.AuthorName = claims.Username
-	if err := s.notifySvc.NotifyPullRequestComment(r.Context(), repo, pr, comment, claims.UserID); err != nil {
+	jsonResponse(w, http.StatusCreated, comment)
+}
+
+// postPRComment creates a comment and sends its notifications and webhooks.
+func (s *Server) postPRComment(ctx context.Context, repo *models.Repository, pr *models.PullRequest, comment *models.PRComment, authorName string) error {
+	if err := s.prSvc.CreateComment(ctx, comment); err != nil {
+		return err
+	}
+	comment.AuthorName = authorName
+	if err := s.notifySvc.NotifyPullRequestComment(ctx, repo, pr, comment, comment.AuthorID); err != nil {
 		slog.Error("notify pr comment", "error", err, "repo_id", repo.ID, "pr", pr.Number)
 	}
-	jsonResponse(w, http.StatusCreated, comment)
+	s.runWebhookAsync(ctx, "webhook pr comment", []any{"repo_id", repo.ID, "pr", pr.Number, "comment_id", comment.ID}, func(ctx context.Context) error {
+		return s.webhookSvc.EmitPullRequestCommentEvent(ctx, repo.ID, pr, comment)
+	})
+	return nil
 }
 
 func (s *Server) handleListPRComments(w http.ResponseWriter, r *http.Request) {
@@ -470,9 +523,13 @@ func (s *Server) handleCreatePRReview(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	review.AuthorName = claims.Username
 	if err := s.notifySvc.NotifyPullRequestReview(r.Context(), repo, pr, review, claims.UserID); err != nil {
 		slog.Error("notify pr review", "error", err, "repo_id", repo.ID, "pr", pr.Number)
 	}
+	s.runWebhookAsync(r.Context(), "webhook pr review", []any{"repo_id", repo.ID, "pr", pr.Number, "review_id", review.ID}, func(ctx context.Context) error {
+		return s.webhookSvc.EmitPullRequestReviewEvent(ctx, repo.ID, pr, review)
+	})
 	jsonResponse(w, http.StatusCreated, review)
 }
 
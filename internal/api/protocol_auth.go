@@ -6,18 +6,93 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/odvcencio/gothub/internal/auth"
 	"github.com/odvcencio/gothub/internal/models"
+	"github.com/odvcencio/gothub/internal/service"
 )
 
+// protocolPrincipal is the credential behind a protocol request: a user, a
+// repository deploy key, or neither for anonymous access. claims is set when
+// the user authenticated with a token, which may be scoped.
+type protocolPrincipal struct {
+	user      *models.User
+	claims    *auth.Claims
+	deployKey *models.RepoDeployKey
+}
+
+func (p protocolPrincipal) authenticated() bool {
+	return p.user != nil || p.deployKey != nil
+}
+
+type protocolPrincipalKey struct{}
+
+// withProtocolPrincipal records principal in ctx for the ref validators and
+// push hooks that run under it. A user also gets claims, so code that only
+// looks at claims sees who pushed.
+func withProtocolPrincipal(ctx context.Context, principal protocolPrincipal) context.Context {
+	ctx = context.WithValue(ctx, protocolPrincipalKey{}, principal)
+	if principal.user != nil && auth.GetClaims(ctx) == nil {
+		claims := principal.claims
+		if claims == nil {
+			claims = &auth.Claims{UserID: principal.user.ID, Username: principal.user.Username}
+		}
+		ctx = auth.WithClaims(ctx, claims)
+	}
+	return ctx
+}
+
+// pushActorID returns the user a push is attributed to. Deploy keys have no
+// account of their own, so their pushes are attributed to the user who
+// created the key.
+func pushActorID(ctx context.Context) (int64, bool) {
+	if claims := auth.GetClaims(ctx); claims != nil {
+		return claims.UserID, true
+	}
+	if principal, ok := ctx.Value(protocolPrincipalKey{}).(protocolPrincipal); ok && principal.deployKey != nil {
+		return principal.deployKey.CreatedByUserID, true
+	}
+	return 0, false
+}
+
+// protocolAuth resolves the credentials on a git or got protocol request
+// before the handler runs. Git clients send tokens as the Basic password,
+// which auth.Middleware does not read, so without this ref validators and
+// push hooks would not know who pushed.
+func (s *Server) protocolAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, status, err := s.authenticateProtocolUser(r)
+		if err != nil {
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Basic realm="gothub"`)
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withProtocolPrincipal(r.Context(), principal)))
+	})
+}
+
 func (s *Server) authorizeProtocolRepoAccess(r *http.Request, owner, repo string, write bool) (int, error) {
-	user, authenticated, status, authErr := s.authenticateProtocolUser(r)
-	if authErr != nil {
-		return status, authErr
+	principal, ok := r.Context().Value(protocolPrincipalKey{}).(protocolPrincipal)
+	if !ok {
+		var status int
+		var authErr error
+		if principal, status, authErr = s.authenticateProtocolUser(r); authErr != nil {
+			return status, authErr
+		}
 	}
 
-	repoModel, err := s.repoSvc.Get(r.Context(), owner, repo)
+	return s.authorizeRepoAccessForPrincipal(r.Context(), principal, owner, repo, write)
+}
+
+// authorizeRepoAccessForPrincipal applies the protocol access rules shared by
+// smart HTTP, the got protocol and git over SSH. Deploy keys only reach the
+// repository they were created for, and read-only keys cannot push.
+func (s *Server) authorizeRepoAccessForPrincipal(ctx context.Context, principal protocolPrincipal, owner, repo string, write bool) (int, error) {
+	repoModel, err := s.repoSvc.Get(ctx, owner, repo)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return http.StatusNotFound, fmt.Errorf("repository not found")
@@ -30,11 +105,31 @@ func (s *Server) authorizeProtocolRepoAccess(r *http.Request, owner, repo string
 		return http.StatusOK, nil
 	}
 
-	if !authenticated || user == nil {
+	if !principal.authenticated() {
 		return http.StatusUnauthorized, fmt.Errorf("authentication required")
 	}
 
-	allowed, err := s.userHasRepoAccess(r.Context(), repoModel, user.ID, write)
+	if key := principal.deployKey; key != nil {
+		if key.RepoID != repoModel.ID {
+			return http.StatusForbidden, fmt.Errorf("deploy key is not valid for this repository")
+		}
+		if write && key.ReadOnly {
+			return http.StatusForbidden, fmt.Errorf("deploy key is read-only")
+		}
+		return http.StatusOK, nil
+	}
+
+	if claims := principal.claims; claims.Scoped() {
+		scope := auth.ScopeRepoRead
+		if write {
+			scope = auth.ScopeRepoWrite
+		}
+		if !claims.AllowsRepo(repoModel.ID) || !claims.HasScope(scope) {
+			return http.StatusForbidden, fmt.Errorf("token scope does not allow this request")
+		}
+	}
+
+	allowed, err := s.userHasRepoAccess(ctx, repoModel, principal.user.ID, write)
 	if err != nil {
 		return http.StatusInternalServerError, fmt.Errorf("authorization failed")
 	}
@@ -45,24 +140,79 @@ func (s *Server) authorizeProtocolRepoAccess(r *http.Request, owner, repo string
 	return http.StatusOK, nil
 }
 
-func (s *Server) authenticateProtocolUser(r *http.Request) (*models.User, bool, int, error) {
-	if claims := auth.GetClaims(r.Context()); claims != nil {
+func (s *Server) authenticateProtocolUser(r *http.Request) (protocolPrincipal, int, error) {
+	claims := auth.GetClaims(r.Context())
+
+	// Basic auth (password) is permanently disabled — use token or SSH auth.
+	// Git clients send tokens as the Basic password, so personal access
+	// tokens, OAuth access tokens and deploy tokens are accepted there.
+	if _, password, ok := r.BasicAuth(); ok && claims == nil {
+		switch {
+		case strings.HasPrefix(password, deployTokenPrefix):
+			return s.authenticateDeployToken(r, password)
+		case strings.HasPrefix(password, service.AccessTokenPrefix):
+			tokenClaims, err := s.accessTokenSvc.Authenticate(r.Context(), password)
+			if err != nil {
+				if errors.Is(err, service.ErrInvalidAccessToken) {
+					return protocolPrincipal{}, http.StatusUnauthorized, fmt.Errorf("invalid token")
+				}
+				return protocolPrincipal{}, http.StatusInternalServerError, fmt.Errorf("token lookup failed")
+			}
+			claims = tokenClaims
+		case strings.HasPrefix(password, service.OAuthAccessTokenPrefix):
+			tokenClaims, err := s.oauthSvc.Authenticate(r.Context(), password)
+			if err != nil {
+				if errors.Is(err, service.ErrInvalidOAuthToken) {
+					return protocolPrincipal{}, http.StatusUnauthorized, fmt.Errorf("invalid token")
+				}
+				return protocolPrincipal{}, http.StatusInternalServerError, fmt.Errorf("token lookup failed")
+			}
+			claims = tokenClaims
+		default:
+			return protocolPrincipal{}, http.StatusUnauthorized, fmt.Errorf("basic auth is disabled; use token or SSH authentication")
+		}
+	}
+
+	if claims != nil {
 		u, err := s.db.GetUserByID(r.Context(), claims.UserID)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
-				return nil, false, http.StatusUnauthorized, fmt.Errorf("invalid token")
+				return protocolPrincipal{}, http.StatusUnauthorized, fmt.Errorf("invalid token")
 			}
-			return nil, false, http.StatusInternalServerError, fmt.Errorf("user lookup failed")
+			return protocolPrincipal{}, http.StatusInternalServerError, fmt.Errorf("user lookup failed")
 		}
-		return u, true, http.StatusOK, nil
+		if u.SuspendedAt != nil {
+			return protocolPrincipal{}, http.StatusForbidden, fmt.Errorf("account suspended")
+		}
+		return protocolPrincipal{user: u, claims: claims}, http.StatusOK, nil
 	}
 
-	// Basic auth (password) is permanently disabled — use token or SSH auth.
-	if _, _, ok := r.BasicAuth(); ok {
-		return nil, false, http.StatusUnauthorized, fmt.Errorf("basic auth is disabled; use token or SSH authentication")
+	return protocolPrincipal{}, http.StatusOK, nil
+}
+
+func (s *Server) authenticateDeployToken(r *http.Request, token string) (protocolPrincipal, int, error) {
+	key, err := s.db.GetRepoDeployKeyByTokenHash(r.Context(), hashRunnerToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return protocolPrincipal{}, http.StatusUnauthorized, fmt.Errorf("invalid deploy key")
+		}
+		return protocolPrincipal{}, http.StatusInternalServerError, fmt.Errorf("deploy key lookup failed")
+	}
+	if status, err := s.checkDeployKeyUsable(r.Context(), key); err != nil {
+		return protocolPrincipal{}, status, err
 	}
+	return protocolPrincipal{deployKey: key}, http.StatusOK, nil
+}
 
-	return nil, false, http.StatusOK, nil
+// checkDeployKeyUsable rejects revoked and expired deploy keys and records
+// the use of a valid one.
+func (s *Server) checkDeployKeyUsable(ctx context.Context, key *models.RepoDeployKey) (int, error) {
+	now := time.Now().UTC()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return http.StatusUnauthorized, fmt.Errorf("invalid deploy key")
+	}
+	_ = s.db.TouchRepoDeployKeyUsed(ctx, key.ID, now)
+	return http.StatusOK, nil
 }
 
 func (s *Server) userHasRepoAccess(ctx context.Context, repo *models.Repository, userID int64, write bool) (bool, error) {
@@ -71,8 +221,14 @@ func (s *Server) userHasRepoAccess(ctx context.Context, repo *models.Repository,
 	}
 
 	if repo.OwnerOrgID != nil {
-		if _, err := s.db.GetOrgMember(ctx, *repo.OwnerOrgID, userID); err == nil {
-			return true, nil
+		if ok, err := s.orgTwoFactorSatisfied(ctx, *repo.OwnerOrgID, userID); err != nil || !ok {
+			return false, err
+		}
+		member, err := s.db.GetOrgMember(ctx, *repo.OwnerOrgID, userID)
+		if err == nil {
+			if ok, err := s.orgMemberHasRepoAccess(ctx, repo, member, write); err != nil || ok {
+				return ok, err
+			}
 		} else if !errors.Is(err, sql.ErrNoRows) {
 			return false, err
 		}
@@ -80,10 +236,7 @@ func (s *Server) userHasRepoAccess(ctx context.Context, repo *models.Repository,
 
 	collab, err := s.db.GetCollaborator(ctx, repo.ID, userID)
 	if err == nil {
-		if !write {
-			return true, nil
-		}
-		return collab.Role == "write" || collab.Role == "admin", nil
+		return repoPermissionAllows(collab.Role, write), nil
 	}
 	if !errors.Is(err, sql.ErrNoRows) {
 		return false, err
@@ -91,3 +244,37 @@ func (s *Server) userHasRepoAccess(ctx context.Context, repo *models.Repository,
 
 	return false, nil
 }
+
+// orgMemberHasRepoAccess applies an org's default member permission and the
+// member's team grants to one of the org's repositories. Owners always have
+// access.
+func (s *Server) orgMemberHasRepoAccess(ctx context.Context, repo *models.Repository, member *models.OrgMember, write bool) (bool, error) {
+	if member.Role == "owner" {
+		return true, nil
+	}
+	org, err := s.db.GetOrgByID(ctx, member.OrgID)
+	if err != nil {
+		return false, err
+	}
+	if repoPermissionAllows(org.DefaultRepoPermission, write) {
+		return true, nil
+	}
+	perm, err := s.teamSvc.RepoPermission(ctx, repo.ID, member.UserID)
+	if err != nil {
+		return false, err
+	}
+	return repoPermissionAllows(perm, write), nil
+}
+
+// repoPermissionAllows reports whether a collaborator or team permission
+// grants read, or write when write is set.
+func repoPermissionAllows(permission string, write bool) bool {
+	switch permission {
+	case "write", "admin":
+		return true
+	case "read":
+		return !write
+	default:
+		return false
+	}
+}
@@ -42,6 +42,15 @@ func (s *Server) authorizeRepoRequest(w http.ResponseWriter, r *http.Request, wr
 		return nil, false
 	}
 
+	if claims.Scoped() && (!claims.AllowsRepo(repo.ID) || !tokenGrantsRequest(claims, r)) {
+		if repo.IsPrivate {
+			jsonError(w, "repository not found", http.StatusNotFound)
+		} else {
+			jsonError(w, "token scope does not allow this request", http.StatusForbidden)
+		}
+		return nil, false
+	}
+
 	allowed, err := s.userHasRepoAccess(r.Context(), repo, claims.UserID, write)
 	if err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
@@ -9,6 +9,7 @@ import (
 	"net/http"
 
 	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/models"
 )
 
 type createRepoRequest struct {
@@ -42,6 +43,9 @@ func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	s.runWebhookAsync(r.Context(), "webhook repository created", []any{"repo_id", repo.ID}, func(ctx context.Context) error {
+		return s.webhookSvc.EmitRepositoryEvent(ctx, repo, models.WebhookActionCreated, nil)
+	})
 	jsonResponse(w, http.StatusCreated, repo)
 }
 
@@ -87,6 +91,10 @@ func (s *Server) handleDeleteRepo(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	// The repository row is gone, so only org webhooks can still receive this.
+	s.runWebhookAsync(r.Context(), "webhook repository deleted", []any{"repo_id", repo.ID}, func(ctx context.Context) error {
+		return s.webhookSvc.EmitRepositoryEvent(ctx, repo, models.WebhookActionDeleted, nil)
+	})
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -117,6 +125,9 @@ func (s *Server) handleForkRepo(w http.ResponseWriter, r *http.Request) {
 	fork.OwnerName = claims.Username
 	fork.ParentOwner = sourceRepo.OwnerName
 	fork.ParentName = sourceRepo.Name
+	s.runWebhookAsync(r.Context(), "webhook repository forked", []any{"repo_id", sourceRepo.ID, "fork_id", fork.ID}, func(ctx context.Context) error {
+		return s.webhookSvc.EmitRepositoryEvent(ctx, sourceRepo, models.WebhookActionForked, fork)
+	})
 	jsonResponse(w, http.StatusCreated, fork)
 }
 
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
@@ -16,6 +17,8 @@ import (
 	"github.com/odvcencio/gothub/internal/gotprotocol"
 	"github.com/odvcencio/gothub/internal/gotstore"
 	"github.com/odvcencio/gothub/internal/jobs"
+	"github.com/odvcencio/gothub/internal/mail"
+	"github.com/odvcencio/gothub/internal/models"
 	"github.com/odvcencio/gothub/internal/service"
 	"github.com/odvcencio/gothub/internal/web"
 )
@@ -32,8 +35,26 @@ type Server struct {
 	notifySvc                *service.NotificationService
 	codeIntelSvc             *service.CodeIntelService
 	lineageSvc               *service.EntityLineageService
+	gpgKeySvc                *service.GPGKeyService
+	sshKeySvc                *service.SSHKeyService
+	accessTokenSvc           *service.AccessTokenService
+	sessionSvc               *service.SessionService
+	twoFactorSvc             *service.TwoFactorService
+	ssoSvc                   *service.SSOService
+	oauthSvc                 *service.OAuthService
+	teamSvc                  *service.TeamService
+	invitationSvc            *service.InvitationService
+	auditSvc                 *service.AuditService
+	adminSvc                 *service.AdminService
+	mailSvc                  *service.MailService
 	indexQueue               *jobs.Queue
 	indexWorker              *jobs.WorkerPool
+	webhookQueue             *jobs.Queue
+	webhookWorker            *jobs.WorkerPool
+	mailWorker               *mailWorker
+	digestWorker             *digestWorker
+	mailInboundSecret        string
+	publicURL                string
 	asyncIndex               bool
 	rateLimiter              *requestRateLimiter
 	httpMetrics              *httpMetrics
@@ -55,6 +76,7 @@ type Server struct {
 	tenantContext            tenantContextOptions
 	adminRouteAccess         adminRouteAccess
 	realtime                 *repoEventBroker
+	gitHandler               *gitinterop.SmartHTTPHandler
 	mux                      *http.ServeMux
 	handler                  http.Handler
 }
@@ -63,6 +85,9 @@ type ServerOptions struct {
 	EnableAsyncIndexing      bool
 	IndexWorkerCount         int
 	IndexWorkerPoll          time.Duration
+	WebhookWorkerCount       int
+	WebhookWorkerPoll        time.Duration
+	WebhookAutoDisableAfter  time.Duration
 	EnableAdminHealth        bool
 	EnablePprof              bool
 	AdminAllowedCIDRs        []string
@@ -81,6 +106,21 @@ type ServerOptions struct {
 	EnableOrganizations      bool
 	PolarWebhookSecret       string
 	PolarProductIDs          []string
+	// Mailer delivers queued email; nil writes messages to stdout.
+	Mailer         mail.Sender
+	MailWorkerPoll time.Duration
+	// DigestWorkerPoll is how often due notification digests are checked.
+	DigestWorkerPoll time.Duration
+	MailFrom         string
+	PublicURL        string // web origin used for links in email
+	MailReplyDomain  string
+	MailReplySecret  string
+	// MailInboundSecret authenticates the inbound mail webhook; empty
+	// disables it.
+	MailInboundSecret string
+	// SSOProviders are the OpenID Connect providers offered on the sign-in
+	// page.
+	SSOProviders []*service.SSOProvider
 }
 
 type middlewareFunc func(http.Handler) http.Handler
@@ -99,9 +139,51 @@ func NewServerWithOptions(db database.DB, authSvc *auth.Service, repoSvc *servic
 	notifySvc := service.NewNotificationService(db)
 	codeIntelSvc := service.NewCodeIntelService(db, repoSvc, browseSvc)
 	indexQueue := jobs.NewQueue(db, jobs.QueueOptions{})
+	webhookQueue := jobs.NewQueue(db, jobs.QueueOptions{
+		JobType:       models.IndexJobTypeWebhookDelivery,
+		RetryDelay:    webhookRetryDelay,
+		MaxRetryDelay: webhookMaxRetryDelay,
+		MaxAttempts:   webhookMaxAttempts,
+		// One in-flight delivery per hook keeps each hook's events in order.
+		ConcurrencyLimit: 1,
+	})
+	mailer := opts.Mailer
+	if mailer == nil {
+		mailer = mail.NewWriterSender(os.Stdout)
+	}
+	mailSvc := service.NewMailService(db, mailer, service.MailOptions{
+		From:        opts.MailFrom,
+		BaseURL:     opts.PublicURL,
+		ReplyDomain: opts.MailReplyDomain,
+		ReplySecret: []byte(opts.MailReplySecret),
+	})
+	teamSvc := service.NewTeamService(db)
+	invitationSvc := service.NewInvitationService(db)
+	auditSvc := service.NewAuditService(db)
+	accessTokenSvc := service.NewAccessTokenService(db)
+	ssoSvc := service.NewSSOService(db)
+	for _, provider := range opts.SSOProviders {
+		ssoSvc.AddProvider(provider)
+	}
 	httpMetrics := getDefaultHTTPMetrics()
 	prSvc.SetCodeIntelService(codeIntelSvc)
 	prSvc.SetLineageService(lineageSvc)
+	prSvc.SetTeamService(teamSvc)
+	webhookSvc.SetDeliveryQueue(webhookQueue)
+	webhookSvc.SetNotificationService(notifySvc)
+	webhookSvc.SetAutoDisableAfter(opts.WebhookAutoDisableAfter)
+	notifySvc.SetMailService(mailSvc)
+	notifySvc.SetTeamMemberResolver(teamSvc.ResolveMemberIDs)
+	invitationSvc.SetNotificationService(notifySvc)
+	invitationSvc.SetMailService(mailSvc)
+	repoSvc.SetAuditService(auditSvc)
+	prSvc.SetAuditService(auditSvc)
+	webhookSvc.SetAuditService(auditSvc)
+	teamSvc.SetAuditService(auditSvc)
+	invitationSvc.SetAuditService(auditSvc)
+	accessTokenSvc.SetAuditService(auditSvc)
+	adminSvc := service.NewAdminService(db)
+	adminSvc.SetAuditService(auditSvc)
 	adminCIDRs := opts.AdminAllowedCIDRs
 	if (opts.EnableAdminHealth || opts.EnablePprof) && len(adminCIDRs) == 0 {
 		adminCIDRs = defaultAdminRouteCIDRs
@@ -134,7 +216,20 @@ func NewServerWithOptions(db database.DB, authSvc *auth.Service, repoSvc *servic
 		notifySvc:                notifySvc,
 		codeIntelSvc:             codeIntelSvc,
 		lineageSvc:               lineageSvc,
+		gpgKeySvc:                service.NewGPGKeyService(db),
+		sshKeySvc:                service.NewSSHKeyService(db),
+		accessTokenSvc:           accessTokenSvc,
+		sessionSvc:               service.NewSessionService(db),
+		twoFactorSvc:             service.NewTwoFactorService(db),
+		ssoSvc:                   ssoSvc,
+		oauthSvc:                 service.NewOAuthService(db),
+		teamSvc:                  teamSvc,
+		invitationSvc:            invitationSvc,
+		auditSvc:                 auditSvc,
+		adminSvc:                 adminSvc,
+		mailSvc:                  mailSvc,
 		indexQueue:               indexQueue,
+		webhookQueue:             webhookQueue,
 		asyncIndex:               opts.EnableAsyncIndexing,
 		rateLimiter:              newRequestRateLimiter(),
 		httpMetrics:              httpMetrics,
@@ -151,6 +246,8 @@ func NewServerWithOptions(db database.DB, authSvc *auth.Service, repoSvc *servic
 		requirePasskeyEnrollment: opts.RequirePasskeyEnrollment,
 		enableOrganizations:      opts.EnableOrganizations,
 		polarWebhookSecret:       strings.TrimSpace(opts.PolarWebhookSecret),
+		mailInboundSecret:        strings.TrimSpace(opts.MailInboundSecret),
+		publicURL:                strings.TrimRight(strings.TrimSpace(opts.PublicURL), "/"),
 		polarProductIDs:          polarProductIDs,
 		clientIPResolver:         clientIPResolver,
 		tenantContext:            newTenantContextOptions(opts.EnableTenantContext, opts.TenantHeader, opts.DefaultTenantID),
@@ -158,9 +255,16 @@ func NewServerWithOptions(db database.DB, authSvc *auth.Service, repoSvc *servic
 		realtime:                 newRepoEventBroker(),
 		mux:                      http.NewServeMux(),
 	}
+	notifySvc.SetRepoAccessChecker(s.userHasRepoAccess)
+	authSvc.RegisterTokenValidator(service.AccessTokenPrefix, s.accessTokenSvc.Authenticate)
+	authSvc.RegisterTokenValidator(service.OAuthAccessTokenPrefix, s.oauthSvc.Authenticate)
+	authSvc.SetSessionStore(s.sessionSvc)
 	if s.asyncIndex {
 		s.indexWorker = s.newIndexWorker(opts.IndexWorkerCount, opts.IndexWorkerPoll)
 	}
+	s.webhookWorker = s.newWebhookWorker(opts.WebhookWorkerCount, opts.WebhookWorkerPoll)
+	s.mailWorker = newMailWorker(mailSvc, opts.MailWorkerPoll)
+	s.digestWorker = newDigestWorker(notifySvc, opts.DigestWorkerPoll)
 	s.routes()
 	s.handler = s.buildHandler()
 	return s
@@ -233,17 +337,40 @@ func (s *Server) routes() {
 	s.mux.HandleFunc("POST /api/v1/auth/register", s.handleRegister)
 	s.mux.HandleFunc("POST /api/v1/auth/magic/request", s.handleRequestMagicLink)
 	s.mux.HandleFunc("POST /api/v1/auth/magic/verify", s.handleVerifyMagicLink)
+	s.mux.HandleFunc("POST /api/v1/mail/inbound", s.handleInboundMail)
 	s.mux.HandleFunc("POST /api/v1/auth/ssh/challenge", s.handleSSHChallenge)
 	s.mux.HandleFunc("POST /api/v1/auth/ssh/verify", s.handleSSHVerify)
 	s.mux.HandleFunc("POST /api/v1/auth/webauthn/register/begin", s.requireAuth(s.handleBeginWebAuthnRegistration))
 	s.mux.HandleFunc("POST /api/v1/auth/webauthn/register/finish", s.requireAuth(s.handleFinishWebAuthnRegistration))
 	s.mux.HandleFunc("POST /api/v1/auth/webauthn/login/begin", s.handleBeginWebAuthnLogin)
 	s.mux.HandleFunc("POST /api/v1/auth/webauthn/login/finish", s.handleFinishWebAuthnLogin)
+	s.mux.HandleFunc("POST /api/v1/auth/2fa/verify", s.handleVerifyTwoFactor)
+	s.mux.HandleFunc("GET /api/v1/auth/oidc/providers", s.handleListOIDCProviders)
+	s.mux.HandleFunc("POST /api/v1/auth/oidc/{provider}/begin", s.handleBeginOIDCLogin)
+	s.mux.HandleFunc("POST /api/v1/auth/oidc/callback", s.handleCompleteOIDCLogin)
+	s.mux.HandleFunc("GET /api/v1/oauth/authorize", s.requireAuth(s.handleGetOAuthAuthorization))
+	s.mux.HandleFunc("POST /api/v1/oauth/authorize", s.requireAuth(s.handleOAuthAuthorize))
+	s.mux.HandleFunc("POST /api/v1/oauth/token", s.handleOAuthToken)
+	s.mux.HandleFunc("POST /api/v1/oauth/revoke", s.handleOAuthRevoke)
 	s.mux.HandleFunc("GET /api/v1/auth/capabilities", s.handleAuthCapabilities)
 	s.mux.HandleFunc("POST /api/v1/auth/refresh", s.requireAuth(s.handleRefreshToken))
+	s.mux.HandleFunc("POST /api/v1/auth/logout", s.requireAuth(s.handleLogout))
 	s.mux.HandleFunc("POST /api/v1/billing/polar/webhook", s.handlePolarWebhook)
 	s.mux.HandleFunc("POST /api/v1/interest-signups", s.handleCreateInterestSignup)
-	s.mux.HandleFunc("GET /api/v1/admin/interest-signups", s.requireAuth(s.handleListInterestSignups))
+	s.mux.HandleFunc("GET /api/v1/admin/interest-signups", s.requireAdmin(s.handleListInterestSignups))
+
+	// Site administration
+	s.mux.HandleFunc("GET /api/v1/admin/users", s.requireAdmin(s.handleAdminListUsers))
+	s.mux.HandleFunc("DELETE /api/v1/admin/users/{username}", s.requireAdmin(s.handleAdminDeleteUser))
+	s.mux.HandleFunc("POST /api/v1/admin/users/{username}/suspend", s.requireAdmin(s.handleAdminSuspendUser))
+	s.mux.HandleFunc("POST /api/v1/admin/users/{username}/unsuspend", s.requireAdmin(s.handleAdminUnsuspendUser))
+	s.mux.HandleFunc("PUT /api/v1/admin/users/{username}/admin", s.requireAdmin(s.handleAdminSetUserAdmin))
+	s.mux.HandleFunc("POST /api/v1/admin/users/{username}/reset-credentials", s.requireAdmin(s.handleAdminResetCredentials))
+	s.mux.HandleFunc("PUT /api/v1/admin/users/{username}/entitlements/{feature}", s.requireAdmin(s.handleAdminSetEntitlement))
+	s.mux.HandleFunc("POST /api/v1/admin/repos/{owner}/{repo}/transfer", s.requireAdmin(s.handleAdminTransferRepo))
+	s.mux.HandleFunc("DELETE /api/v1/admin/repos/{owner}/{repo}", s.requireAdmin(s.handleAdminDeleteRepo))
+	s.mux.HandleFunc("GET /api/v1/admin/queues", s.requireAdmin(s.handleAdminQueueStats))
+	s.mux.HandleFunc("GET /api/v1/admin/audit", s.requireAdmin(s.handleListAuditEvents))
 
 	// Explore
 	s.mux.HandleFunc("GET /api/v1/explore/repos", s.handleExploreRepos)
@@ -253,7 +380,32 @@ func (s *Server) routes() {
 	s.mux.HandleFunc("GET /api/v1/user/ssh-keys", s.requireAuth(s.handleListSSHKeys))
 	s.mux.HandleFunc("POST /api/v1/user/ssh-keys", s.requireAuth(s.handleCreateSSHKey))
 	s.mux.HandleFunc("DELETE /api/v1/user/ssh-keys/{id}", s.requireAuth(s.handleDeleteSSHKey))
+	s.mux.HandleFunc("GET /api/v1/user/gpg-keys", s.requireAuth(s.handleListGPGKeys))
+	s.mux.HandleFunc("GET /api/v1/signing-key", s.handleGetServerSigningKey)
+	s.mux.HandleFunc("POST /api/v1/user/gpg-keys", s.requireAuth(s.handleCreateGPGKey))
+	s.mux.HandleFunc("DELETE /api/v1/user/gpg-keys/{id}", s.requireAuth(s.handleDeleteGPGKey))
+	s.mux.HandleFunc("GET /api/v1/user/tokens", s.requireAuth(s.handleListAccessTokens))
+	s.mux.HandleFunc("POST /api/v1/user/tokens", s.requireAuth(s.handleCreateAccessToken))
+	s.mux.HandleFunc("DELETE /api/v1/user/tokens/{id}", s.requireAuth(s.handleDeleteAccessToken))
 	s.mux.HandleFunc("GET /api/v1/user/passkeys", s.requireAuth(s.handleListPasskeys))
+	s.mux.HandleFunc("DELETE /api/v1/user/passkeys/{id}", s.requireAuth(s.handleDeletePasskey))
+	s.mux.HandleFunc("GET /api/v1/user/2fa", s.requireAuth(s.handleGetTwoFactorStatus))
+	s.mux.HandleFunc("POST /api/v1/user/2fa/totp", s.requireAuth(s.handleBeginTOTPEnrollment))
+	s.mux.HandleFunc("POST /api/v1/user/2fa/totp/confirm", s.requireAuth(s.handleConfirmTOTPEnrollment))
+	s.mux.HandleFunc("POST /api/v1/user/2fa/totp/disable", s.requireAuth(s.handleDisableTOTP))
+	s.mux.HandleFunc("POST /api/v1/user/2fa/recovery-codes", s.requireAuth(s.handleRegenerateRecoveryCodes))
+	s.mux.HandleFunc("GET /api/v1/user/identities", s.requireAuth(s.handleListUserIdentities))
+	s.mux.HandleFunc("GET /api/v1/user/oauth-apps", s.requireAuth(s.handleListOAuthApps))
+	s.mux.HandleFunc("POST /api/v1/user/oauth-apps", s.requireAuth(s.handleCreateOAuthApp))
+	s.mux.HandleFunc("GET /api/v1/user/oauth-apps/{id}", s.requireAuth(s.handleGetOAuthApp))
+	s.mux.HandleFunc("PATCH /api/v1/user/oauth-apps/{id}", s.requireAuth(s.handleUpdateOAuthApp))
+	s.mux.HandleFunc("DELETE /api/v1/user/oauth-apps/{id}", s.requireAuth(s.handleDeleteOAuthApp))
+	s.mux.HandleFunc("POST /api/v1/user/oauth-apps/{id}/secret", s.requireAuth(s.handleResetOAuthAppSecret))
+	s.mux.HandleFunc("GET /api/v1/user/oauth-authorizations", s.requireAuth(s.handleListOAuthAuthorizations))
+	s.mux.HandleFunc("DELETE /api/v1/user/oauth-authorizations/{app_id}", s.requireAuth(s.handleRevokeOAuthAuthorization))
+	s.mux.HandleFunc("GET /api/v1/user/sessions", s.requireAuth(s.handleListSessions))
+	s.mux.HandleFunc("DELETE /api/v1/user/sessions", s.requireAuth(s.handleRevokeAllSessions))
+	s.mux.HandleFunc("DELETE /api/v1/user/sessions/{id}", s.requireAuth(s.handleRevokeSession))
 	s.mux.HandleFunc("GET /api/v1/user/repo-policy", s.requireAuth(s.handleGetRepoCreationPolicy))
 	s.mux.HandleFunc("GET /api/v1/user/starred", s.requireAuth(s.handleListUserStarredRepos))
 	s.mux.HandleFunc("GET /api/v1/user/subscription", s.requireAuth(s.handleGetSubscription))
@@ -261,6 +413,8 @@ func (s *Server) routes() {
 	s.mux.HandleFunc("GET /api/v1/notifications/unread-count", s.requireAuth(s.handleUnreadNotificationsCount))
 	s.mux.HandleFunc("POST /api/v1/notifications/read-all", s.requireAuth(s.handleMarkAllNotificationsRead))
 	s.mux.HandleFunc("POST /api/v1/notifications/{id}/read", s.requireAuth(s.handleMarkNotificationRead))
+	s.mux.HandleFunc("GET /api/v1/user/notification-settings", s.requireAuth(s.handleGetNotificationSettings))
+	s.mux.HandleFunc("PUT /api/v1/user/notification-settings", s.requireAuth(s.handleUpdateNotificationSettings))
 
 	// Repositories
 	s.mux.HandleFunc("POST /api/v1/repos", s.requireAuth(s.handleCreateRepo))
@@ -271,18 +425,35 @@ func (s *Server) routes() {
 	s.mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/runners/tokens", s.requireAuth(s.handleCreateRepoRunnerToken))
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/runners/tokens", s.requireAuth(s.handleListRepoRunnerTokens))
 	s.mux.HandleFunc("DELETE /api/v1/repos/{owner}/{repo}/runners/tokens/{id}", s.requireAuth(s.handleDeleteRepoRunnerToken))
+	s.mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/deploy-keys", s.requireAuth(s.handleCreateRepoDeployKey))
+	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/deploy-keys", s.requireAuth(s.handleListRepoDeployKeys))
+	s.mux.HandleFunc("DELETE /api/v1/repos/{owner}/{repo}/deploy-keys/{id}", s.requireAuth(s.handleDeleteRepoDeployKey))
 	s.mux.HandleFunc("GET /api/v1/user/repos", s.requireAuth(s.handleListUserRepos))
 	s.mux.HandleFunc("DELETE /api/v1/repos/{owner}/{repo}", s.requireAuth(s.handleDeleteRepo))
 	s.mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/collaborators", s.requireAuth(s.handleAddCollaborator))
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/collaborators", s.handleListCollaborators)
 	s.mux.HandleFunc("DELETE /api/v1/repos/{owner}/{repo}/collaborators/{username}", s.requireAuth(s.handleRemoveCollaborator))
+	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/invitations", s.requireAuth(s.handleListRepoInvitations))
+	s.mux.HandleFunc("DELETE /api/v1/repos/{owner}/{repo}/invitations/{id}", s.requireAuth(s.handleRevokeRepoInvitation))
+	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/audit", s.requireAuth(s.handleListRepoAuditEvents))
+	s.mux.HandleFunc("GET /api/v1/user/invitations", s.requireAuth(s.handleListUserInvitations))
+	s.mux.HandleFunc("POST /api/v1/user/invitations/{id}/accept", s.requireAuth(s.handleAcceptInvitation))
+	s.mux.HandleFunc("POST /api/v1/user/invitations/{id}/decline", s.requireAuth(s.handleDeclineInvitation))
+	s.mux.HandleFunc("POST /api/v1/invitations/preview", s.handlePreviewInvitationToken)
+	s.mux.HandleFunc("POST /api/v1/invitations/accept", s.handleAcceptInvitationToken)
+	s.mux.HandleFunc("POST /api/v1/invitations/decline", s.handleDeclineInvitationToken)
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/stars", s.handleGetRepoStars)
 	s.mux.HandleFunc("PUT /api/v1/repos/{owner}/{repo}/star", s.requireAuth(s.handleStarRepo))
 	s.mux.HandleFunc("DELETE /api/v1/repos/{owner}/{repo}/star", s.requireAuth(s.handleUnstarRepo))
+	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/subscription", s.requireAuth(s.handleGetRepoSubscription))
+	s.mux.HandleFunc("PUT /api/v1/repos/{owner}/{repo}/subscription", s.requireAuth(s.handleSetRepoSubscription))
+	s.mux.HandleFunc("DELETE /api/v1/repos/{owner}/{repo}/subscription", s.requireAuth(s.handleDeleteRepoSubscription))
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/stargazers", s.handleListRepoStargazers)
+	s.mux.HandleFunc("GET /api/v1/webhooks/events", s.handleListWebhookEvents)
 	s.mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/webhooks", s.requireAuth(s.handleCreateWebhook))
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/webhooks", s.handleListWebhooks)
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/webhooks/{id}", s.handleGetWebhook)
+	s.mux.HandleFunc("PATCH /api/v1/repos/{owner}/{repo}/webhooks/{id}", s.requireAuth(s.handleUpdateWebhook))
 	s.mux.HandleFunc("DELETE /api/v1/repos/{owner}/{repo}/webhooks/{id}", s.requireAuth(s.handleDeleteWebhook))
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/webhooks/{id}/deliveries", s.handleListWebhookDeliveries)
 	s.mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/webhooks/{id}/deliveries/{delivery_id}/redeliver", s.requireAuth(s.handleRedeliverWebhookDelivery))
@@ -295,6 +466,7 @@ func (s *Server) routes() {
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/blob/{ref}/{path...}", s.handleGetBlob)
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/commits/{ref}", s.handleListCommits)
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/commit/{hash}", s.handleGetCommit)
+	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/tags/{tag...}", s.handleGetTag)
 
 	// Entities & diff
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/entities/{ref}/{path...}", s.handleListEntities)
@@ -310,6 +482,7 @@ func (s *Server) routes() {
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/pulls/{number}", s.handleGetPR)
 	s.mux.HandleFunc("PATCH /api/v1/repos/{owner}/{repo}/pulls/{number}", s.requireAuth(s.handleUpdatePR))
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/pulls/{number}/diff", s.handlePRDiff)
+	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/pulls/{number}/linked-issues", s.handlePRLinkedIssues)
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/pulls/{number}/merge-preview", s.handleMergePreview)
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/pulls/{number}/merge-gate", s.handlePRMergeGate)
 	s.mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/pulls/{number}/merge", s.requireAuth(s.handleMergePR))
@@ -317,6 +490,9 @@ func (s *Server) routes() {
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/pulls/{number}/comments", s.handleListPRComments)
 	s.mux.HandleFunc("DELETE /api/v1/repos/{owner}/{repo}/pulls/{number}/comments/{comment_id}", s.requireAuth(s.handleDeletePRComment))
 	s.mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/pulls/{number}/reviews", s.requireAuth(s.handleCreatePRReview))
+	s.mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/pulls/{number}/requested-reviewers", s.requireAuth(s.handleRequestPRReviewers))
+	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/pulls/{number}/subscription", s.requireAuth(s.handleGetPRSubscription))
+	s.mux.HandleFunc("PUT /api/v1/repos/{owner}/{repo}/pulls/{number}/subscription", s.requireAuth(s.handleSetPRSubscription))
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/pulls/{number}/reviews", s.handleListPRReviews)
 	s.mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/pulls/{number}/checks", s.requireAuth(s.handleUpsertPRCheckRun))
 	s.mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/pulls/{number}/checks/runner", s.handleUpsertPRCheckRunByRunnerToken)
@@ -330,6 +506,14 @@ func (s *Server) routes() {
 	s.mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/issues/{number}/comments", s.requireAuth(s.handleCreateIssueComment))
 	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/issues/{number}/comments", s.handleListIssueComments)
 	s.mux.HandleFunc("DELETE /api/v1/repos/{owner}/{repo}/issues/{number}/comments/{comment_id}", s.requireAuth(s.handleDeleteIssueComment))
+	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/issues/{number}/references", s.handleListIssueReferences)
+	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/issues/{number}/subscription", s.requireAuth(s.handleGetIssueSubscription))
+	s.mux.HandleFunc("PUT /api/v1/repos/{owner}/{repo}/issues/{number}/subscription", s.requireAuth(s.handleSetIssueSubscription))
+	s.mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/issues/{number}/entities", s.requireAuth(s.handleLinkIssueEntities))
+	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/issues/{number}/entities", s.handleListIssueEntities)
+	s.mux.HandleFunc("DELETE /api/v1/repos/{owner}/{repo}/issues/{number}/entities/{stable_id}", s.requireAuth(s.handleUnlinkIssueEntity))
+	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/entity-issues", s.handleListEntityIssues)
+	s.mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/search/issues", s.handleSearchIssues)
 
 	// Branch protection
 	s.mux.HandleFunc("PUT /api/v1/repos/{owner}/{repo}/branch-protection/{branch...}", s.requireAuth(s.handleUpsertBranchProtection))
@@ -347,20 +531,70 @@ func (s *Server) routes() {
 	if s.enableOrganizations {
 		s.mux.HandleFunc("POST /api/v1/orgs", s.requireAuth(s.handleCreateOrg))
 		s.mux.HandleFunc("GET /api/v1/orgs/{org}", s.handleGetOrg)
+		s.mux.HandleFunc("PATCH /api/v1/orgs/{org}", s.requireAuth(s.handleUpdateOrg))
 		s.mux.HandleFunc("DELETE /api/v1/orgs/{org}", s.requireAuth(s.handleDeleteOrg))
 		s.mux.HandleFunc("GET /api/v1/orgs/{org}/members", s.handleListOrgMembers)
 		s.mux.HandleFunc("POST /api/v1/orgs/{org}/members", s.requireAuth(s.handleAddOrgMember))
 		s.mux.HandleFunc("DELETE /api/v1/orgs/{org}/members/{username}", s.requireAuth(s.handleRemoveOrgMember))
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/invitations", s.requireAuth(s.handleListOrgInvitations))
+		s.mux.HandleFunc("DELETE /api/v1/orgs/{org}/invitations/{id}", s.requireAuth(s.handleRevokeOrgInvitation))
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/audit", s.requireAuth(s.handleListOrgAuditEvents))
 		s.mux.HandleFunc("GET /api/v1/orgs/{org}/repos", s.handleListOrgRepos)
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/security", s.requireAuth(s.handleGetOrgSecurity))
+		s.mux.HandleFunc("PUT /api/v1/orgs/{org}/security", s.requireAuth(s.handleUpdateOrgSecurity))
+		s.mux.HandleFunc("POST /api/v1/orgs/{org}/webhooks", s.requireAuth(s.handleCreateOrgWebhook))
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/webhooks", s.requireAuth(s.handleListOrgWebhooks))
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/webhooks/{id}", s.requireAuth(s.handleGetOrgWebhook))
+		s.mux.HandleFunc("PATCH /api/v1/orgs/{org}/webhooks/{id}", s.requireAuth(s.handleUpdateOrgWebhook))
+		s.mux.HandleFunc("DELETE /api/v1/orgs/{org}/webhooks/{id}", s.requireAuth(s.handleDeleteOrgWebhook))
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/webhooks/{id}/deliveries", s.requireAuth(s.handleListOrgWebhookDeliveries))
+		s.mux.HandleFunc("POST /api/v1/orgs/{org}/webhooks/{id}/deliveries/{delivery_id}/redeliver", s.requireAuth(s.handleRedeliverOrgWebhookDelivery))
+		s.mux.HandleFunc("POST /api/v1/orgs/{org}/webhooks/{id}/ping", s.requireAuth(s.handlePingOrgWebhook))
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/teams", s.requireAuth(s.handleListTeams))
+		s.mux.HandleFunc("POST /api/v1/orgs/{org}/teams", s.requireAuth(s.handleCreateTeam))
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/teams/{team}", s.requireAuth(s.handleGetTeam))
+		s.mux.HandleFunc("PATCH /api/v1/orgs/{org}/teams/{team}", s.requireAuth(s.handleUpdateTeam))
+		s.mux.HandleFunc("DELETE /api/v1/orgs/{org}/teams/{team}", s.requireAuth(s.handleDeleteTeam))
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/teams/{team}/members", s.requireAuth(s.handleListTeamMembers))
+		s.mux.HandleFunc("PUT /api/v1/orgs/{org}/teams/{team}/members/{username}", s.requireAuth(s.handleAddTeamMember))
+		s.mux.HandleFunc("DELETE /api/v1/orgs/{org}/teams/{team}/members/{username}", s.requireAuth(s.handleRemoveTeamMember))
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/teams/{team}/repos", s.requireAuth(s.handleListTeamRepos))
+		s.mux.HandleFunc("PUT /api/v1/orgs/{org}/teams/{team}/repos/{repo}", s.requireAuth(s.handleSetTeamRepo))
+		s.mux.HandleFunc("DELETE /api/v1/orgs/{org}/teams/{team}/repos/{repo}", s.requireAuth(s.handleRemoveTeamRepo))
 		s.mux.HandleFunc("GET /api/v1/user/orgs", s.requireAuth(s.handleListUserOrgs))
 	} else {
 		s.mux.HandleFunc("POST /api/v1/orgs", s.handleOrganizationsDisabled)
 		s.mux.HandleFunc("GET /api/v1/orgs/{org}", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("PATCH /api/v1/orgs/{org}", s.handleOrganizationsDisabled)
 		s.mux.HandleFunc("DELETE /api/v1/orgs/{org}", s.handleOrganizationsDisabled)
 		s.mux.HandleFunc("GET /api/v1/orgs/{org}/members", s.handleOrganizationsDisabled)
 		s.mux.HandleFunc("POST /api/v1/orgs/{org}/members", s.handleOrganizationsDisabled)
 		s.mux.HandleFunc("DELETE /api/v1/orgs/{org}/members/{username}", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/invitations", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("DELETE /api/v1/orgs/{org}/invitations/{id}", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/audit", s.handleOrganizationsDisabled)
 		s.mux.HandleFunc("GET /api/v1/orgs/{org}/repos", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/security", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("PUT /api/v1/orgs/{org}/security", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("POST /api/v1/orgs/{org}/webhooks", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/webhooks", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/webhooks/{id}", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("PATCH /api/v1/orgs/{org}/webhooks/{id}", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("DELETE /api/v1/orgs/{org}/webhooks/{id}", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/webhooks/{id}/deliveries", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("POST /api/v1/orgs/{org}/webhooks/{id}/deliveries/{delivery_id}/redeliver", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("POST /api/v1/orgs/{org}/webhooks/{id}/ping", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/teams", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("POST /api/v1/orgs/{org}/teams", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/teams/{team}", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("PATCH /api/v1/orgs/{org}/teams/{team}", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("DELETE /api/v1/orgs/{org}/teams/{team}", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/teams/{team}/members", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("PUT /api/v1/orgs/{org}/teams/{team}/members/{username}", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("DELETE /api/v1/orgs/{org}/teams/{team}/members/{username}", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("GET /api/v1/orgs/{org}/teams/{team}/repos", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("PUT /api/v1/orgs/{org}/teams/{team}/repos/{repo}", s.handleOrganizationsDisabled)
+		s.mux.HandleFunc("DELETE /api/v1/orgs/{org}/teams/{team}/repos/{repo}", s.handleOrganizationsDisabled)
 		s.mux.HandleFunc("GET /api/v1/user/orgs", s.handleOrganizationsDisabled)
 	}
 
@@ -398,6 +632,12 @@ func (s *Server) routes() {
 		return s.codeIntelSvc.EnsureCommitIndexed(ctx, repoModel.ID, store, owner+"/"+repo, commitHash)
 	}
 
+	linkPushedRef := func(ctx context.Context, owner, repo, refName string, oldHash, newHash object.Hash) {
+		s.runAsync(ctx, "link pushed issue references", []any{"owner", owner, "repo", repo, "ref", refName}, func(ctx context.Context) error {
+			return s.linkPushedCommits(ctx, owner, repo, refName, oldHash, newHash)
+		})
+	}
+
 	indexByRepoID := func(ctx context.Context, repoID int64, store *gotstore.RepoStore, commitHash object.Hash) error {
 		if s.asyncIndex {
 			_, err := s.indexQueue.EnqueueCommitIndex(ctx, repoID, string(commitHash))
@@ -420,9 +660,10 @@ func (s *Server) routes() {
 		}
 		return validateProtectedRefUpdate(ctx, repoModel.ID, refName, oldHash, newHash)
 	})
+	gotProto.SetRefUpdatedHook(linkPushedRef)
 	gotProtoMux := http.NewServeMux()
 	gotProto.RegisterRoutes(gotProtoMux)
-	s.mux.Handle("/got/", s.wrapGotBatchGraphErrors(gotProtoMux))
+	s.mux.Handle("/got/", s.wrapGotBatchGraphErrors(s.protocolAuth(gotProtoMux)))
 
 	// Git smart HTTP protocol
 	gitHandler := gitinterop.NewSmartHTTPHandler(
@@ -446,7 +687,13 @@ func (s *Server) routes() {
 	gitHandler.SetRefUpdateValidator(func(ctx context.Context, owner, repo string, repoID int64, refName string, oldHash, newHash object.Hash) error {
 		return validateProtectedRefUpdate(ctx, repoID, refName, oldHash, newHash)
 	})
-	gitHandler.RegisterRoutes(s.mux)
+	gitHandler.SetRefUpdatedHook(func(ctx context.Context, owner, repo string, repoID int64, refName string, oldHash, newHash object.Hash) {
+		linkPushedRef(ctx, owner, repo, refName, oldHash, newHash)
+	})
+	gitMux := http.NewServeMux()
+	gitHandler.RegisterRoutes(gitMux)
+	s.mux.Handle("/git/", s.protocolAuth(gitMux))
+	s.gitHandler = gitHandler
 
 	// Frontend SPA — fallback for all non-API/protocol routes
 	s.mux.Handle("/", web.Handler())
@@ -454,10 +701,32 @@ func (s *Server) routes() {
 
 func (s *Server) requireAuth(fn http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if auth.GetClaims(r.Context()) == nil {
+		claims := auth.GetClaims(r.Context())
+		if claims == nil {
 			http.Error(w, `{"error":"authentication required"}`, http.StatusUnauthorized)
 			return
 		}
+		if claims.Scoped() && !tokenGrantsRequest(claims, r) {
+			http.Error(w, `{"error":"token scope does not allow this request"}`, http.StatusForbidden)
+			return
+		}
 		fn(w, r)
 	}
 }
+
+// requireAdmin is requireAuth for site administration routes: the caller
+// must also be a site admin.
+func (s *Server) requireAdmin(fn http.HandlerFunc) http.HandlerFunc {
+	return s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		user, err := s.db.GetUserByID(r.Context(), auth.GetClaims(r.Context()).UserID)
+		if err != nil {
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if !user.IsAdmin {
+			jsonError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		fn(w, r)
+	})
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
@@ -75,7 +76,7 @@ func (s *Server) handleCreateRepoRunnerToken(w http.ResponseWriter, r *http.Requ
 		token.ExpiresAt = &expiresAt
 	}
 
-	if err := s.db.CreateRepoRunnerToken(r.Context(), token); err != nil {
+	if err := s.repoSvc.CreateRunnerToken(r.Context(), repo, token); err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
@@ -113,7 +114,7 @@ func (s *Server) handleDeleteRepoRunnerToken(w http.ResponseWriter, r *http.Requ
 	if !ok {
 		return
 	}
-	if err := s.db.DeleteRepoRunnerToken(r.Context(), repo.ID, tokenID); err != nil {
+	if err := s.repoSvc.DeleteRunnerToken(r.Context(), repo, tokenID); err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
@@ -180,6 +181,9 @@ func (s *Server) handleUpsertPRCheckRunByRunnerToken(w http.ResponseWriter, r *h
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	s.runWebhookAsync(r.Context(), "webhook check run", []any{"repo_id", repo.ID, "pr", pr.Number, "check", run.Name}, func(ctx context.Context) error {
+		return s.webhookSvc.EmitCheckRunEvent(ctx, repo.ID, pr, run)
+	})
 	jsonResponse(w, http.StatusOK, run)
 }
 
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	sessions, err := s.sessionSvc.List(r.Context(), claims.UserID, claims.SessionID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, sessions)
+}
+
+func (s *Server) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	id := strings.TrimSpace(r.PathValue("id"))
+	if id == "" {
+		jsonError(w, "session id is required", http.StatusBadRequest)
+		return
+	}
+	if err := s.sessionSvc.Revoke(r.Context(), claims.UserID, id); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRevokeAllSessions signs the user out everywhere, including the
+// session making the request.
+func (s *Server) handleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	if err := s.sessionSvc.RevokeAll(r.Context(), claims.UserID, ""); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	if err := s.sessionSvc.Revoke(r.Context(), claims.UserID, claims.SessionID); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeletePasskey removes a passkey and signs out the user's other
+// sessions, any of which may have been created with it.
+func (s *Server) handleDeletePasskey(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	id, ok := parsePathPositiveInt64(w, r, "id", "passkey id")
+	if !ok {
+		return
+	}
+	credentials, err := s.db.ListWebAuthnCredentials(r.Context(), claims.UserID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !slices.ContainsFunc(credentials, func(c models.WebAuthnCredential) bool { return c.ID == id }) {
+		jsonError(w, "passkey not found", http.StatusNotFound)
+		return
+	}
+	if err := s.db.DeleteWebAuthnCredential(r.Context(), id, claims.UserID); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.sessionSvc.RevokeAll(r.Context(), claims.UserID, claims.SessionID); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/service"
+)
+
+// oidcCallbackPath is where providers send the browser back to. The web app
+// posts the code and state from that page to /auth/oidc/callback.
+const oidcCallbackPath = "/login/oidc/callback"
+
+func (s *Server) handleListOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, http.StatusOK, s.ssoSvc.Providers())
+}
+
+func (s *Server) handleBeginOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	authURL, err := s.ssoSvc.Begin(r.Context(), r.PathValue("provider"), s.oidcRedirectURI(r))
+	if errors.Is(err, service.ErrSSOProviderNotFound) {
+		jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("begin oidc login", "provider", r.PathValue("provider"), "error", err)
+		jsonError(w, "sign-in provider is unavailable", http.StatusBadGateway)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"authorization_url": authURL})
+}
+
+func (s *Server) handleCompleteOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		State string `json:"state"`
+		Code  string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.State) == "" || strings.TrimSpace(req.Code) == "" {
+		jsonError(w, "state and code are required", http.StatusBadRequest)
+		return
+	}
+	user, err := s.ssoSvc.Complete(r.Context(), req.State, req.Code, s.oidcRedirectURI(r))
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrSSOInvalidState), errors.Is(err, service.ErrSSOEmailRequired):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrSSOEmailConflict):
+		jsonError(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, service.ErrSSOProviderNotFound):
+		jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	default:
+		slog.Warn("complete oidc login", "error", err)
+		jsonError(w, "sign-in with provider failed", http.StatusUnauthorized)
+		return
+	}
+	s.completeSignIn(w, r, user)
+}
+
+func (s *Server) handleListUserIdentities(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	identities, err := s.ssoSvc.ListIdentities(r.Context(), claims.UserID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, identities)
+}
+
+// oidcRedirectURI is the callback registered with providers. It is built
+// from the configured public URL, falling back to the request's origin.
+func (s *Server) oidcRedirectURI(r *http.Request) string {
+	if s.publicURL != "" {
+		return s.publicURL + oidcCallbackPath
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + oidcCallbackPath
+}
@@ -1,9 +1,11 @@
 package api
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/models"
 )
 
 type repoStarsResponse struct {
@@ -51,10 +53,20 @@ func (s *Server) handleStarRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	wasStarred, err := s.db.IsRepoStarred(r.Context(), repo.ID, claims.UserID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
 	if err := s.db.AddRepoStar(r.Context(), repo.ID, claims.UserID); err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	if wasStarred != true {
+		s.runWebhookAsync(r.Context(), "webhook star", []any{"repo_id", repo.ID, "user_id", claims.UserID}, func(ctx context.Context) error {
+			return s.webhookSvc.EmitStarEvent(ctx, repo.ID, models.WebhookActionCreated, claims.UserID, claims.Username)
+		})
+	}
 	count, err := s.db.CountRepoStars(r.Context(), repo.ID)
 	if err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
@@ -74,10 +86,20 @@ func (s *Server) handleUnstarRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	wasStarred, err := s.db.IsRepoStarred(r.Context(), repo.ID, claims.UserID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
 	if err := s.db.RemoveRepoStar(r.Context(), repo.ID, claims.UserID); err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	if wasStarred != false {
+		s.runWebhookAsync(r.Context(), "webhook star", []any{"repo_id", repo.ID, "user_id", claims.UserID}, func(ctx context.Context) error {
+			return s.webhookSvc.EmitStarEvent(ctx, repo.ID, models.WebhookActionDeleted, claims.UserID, claims.Username)
+		})
+	}
 	count, err := s.db.CountRepoStars(r.Context(), repo.ID)
 	if err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/models"
+	"github.com/odvcencio/gothub/internal/service"
+)
+
+type teamRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	// Parent names the parent team; an empty string makes the team top-level.
+	Parent *string `json:"parent"`
+}
+
+// orgForTeams loads the {org} in the path and checks that the caller is a
+// member of it, or an owner when owner is set.
+func (s *Server) orgForTeams(w http.ResponseWriter, r *http.Request, owner bool) (*models.Org, bool) {
+	org, err := s.db.GetOrg(r.Context(), r.PathValue("org"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "org not found", http.StatusNotFound)
+			return nil, false
+		}
+		jsonError(w, "failed to get org", http.StatusInternalServerError)
+		return nil, false
+	}
+	claims := auth.GetClaims(r.Context())
+	member, err := s.db.GetOrgMember(r.Context(), org.ID, claims.UserID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "failed to verify org membership", http.StatusInternalServerError)
+			return nil, false
+		}
+		jsonError(w, "only org members can view teams", http.StatusForbidden)
+		return nil, false
+	}
+	if owner && member.Role != "owner" {
+		jsonError(w, "only org owners can manage teams", http.StatusForbidden)
+		return nil, false
+	}
+	return org, true
+}
+
+// teamForRequest resolves the {org} and {team} path values.
+func (s *Server) teamForRequest(w http.ResponseWriter, r *http.Request, owner bool) (*models.Org, *models.Team, bool) {
+	org, ok := s.orgForTeams(w, r, owner)
+	if !ok {
+		return nil, nil, false
+	}
+	team, err := s.teamSvc.Get(r.Context(), org.ID, r.PathValue("team"))
+	if err != nil {
+		writeTeamError(w, err)
+		return nil, nil, false
+	}
+	return org, team, true
+}
+
+func writeTeamError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrTeamNotFound):
+		jsonError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrTeamExists):
+		jsonError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidTeam), errors.Is(err, service.ErrInvalidRepoPermission),
+		errors.Is(err, service.ErrNotOrgMember):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	default:
+		jsonError(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleUpdateOrg(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.orgForTeams(w, r, true)
+	if !ok {
+		return
+	}
+	var req struct {
+		DefaultRepoPermission *string `json:"default_repo_permission"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.DefaultRepoPermission != nil {
+		perm := strings.ToLower(strings.TrimSpace(*req.DefaultRepoPermission))
+		switch perm {
+		case "none", "read", "write":
+		default:
+			jsonError(w, "default_repo_permission must be one of none, read, write", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetOrgDefaultRepoPermission(r.Context(), org.ID, perm); err != nil {
+			jsonError(w, "failed to update org", http.StatusInternalServerError)
+			return
+		}
+		s.auditSvc.RecordOrg(r.Context(), org, service.AuditOrgUpdate, "",
+			map[string]string{"default_repo_permission": org.DefaultRepoPermission},
+			map[string]string{"default_repo_permission": perm})
+		org.DefaultRepoPermission = perm
+	}
+	jsonResponse(w, http.StatusOK, org)
+}
+
+func (s *Server) handleListTeams(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.orgForTeams(w, r, false)
+	if !ok {
+		return
+	}
+	teams, err := s.teamSvc.List(r.Context(), org.ID)
+	if err != nil {
+		jsonError(w, "failed to list teams", http.StatusInternalServerError)
+		return
+	}
+	if teams == nil {
+		teams = []models.Team{}
+	}
+	jsonResponse(w, http.StatusOK, teams)
+}
+
+func (s *Server) handleCreateTeam(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.orgForTeams(w, r, true)
+	if !ok {
+		return
+	}
+	var req teamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	var name, description, parent string
+	if req.Name != nil {
+		name = *req.Name
+	}
+	if req.Description != nil {
+		description = *req.Description
+	}
+	if req.Parent != nil {
+		parent = *req.Parent
+	}
+	team, err := s.teamSvc.Create(r.Context(), org.ID, name, description, parent)
+	if err != nil {
+		writeTeamError(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusCreated, team)
+}
+
+func (s *Server) handleGetTeam(w http.ResponseWriter, r *http.Request) {
+	_, team, ok := s.teamForRequest(w, r, false)
+	if !ok {
+		return
+	}
+	jsonResponse(w, http.StatusOK, team)
+}
+
+func (s *Server) handleUpdateTeam(w http.ResponseWriter, r *http.Request) {
+	_, team, ok := s.teamForRequest(w, r, true)
+	if !ok {
+		return
+	}
+	var req teamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	updated, err := s.teamSvc.Update(r.Context(), team, req.Name, req.Description, req.Parent)
+	if err != nil {
+		writeTeamError(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, updated)
+}
+
+func (s *Server) handleDeleteTeam(w http.ResponseWriter, r *http.Request) {
+	_, team, ok := s.teamForRequest(w, r, true)
+	if !ok {
+		return
+	}
+	if err := s.teamSvc.Delete(r.Context(), team); err != nil {
+		jsonError(w, "failed to delete team", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListTeamMembers(w http.ResponseWriter, r *http.Request) {
+	_, team, ok := s.teamForRequest(w, r, false)
+	if !ok {
+		return
+	}
+	members, err := s.teamSvc.Members(r.Context(), team)
+	if err != nil {
+		jsonError(w, "failed to list team members", http.StatusInternalServerError)
+		return
+	}
+	if members == nil {
+		members = []models.TeamMember{}
+	}
+	jsonResponse(w, http.StatusOK, members)
+}
+
+func (s *Server) handleAddTeamMember(w http.ResponseWriter, r *http.Request) {
+	_, team, ok := s.teamForRequest(w, r, true)
+	if !ok {
+		return
+	}
+	user, err := s.db.GetUserByUsername(r.Context(), r.PathValue("username"))
+	if err != nil {
+		jsonError(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err := s.teamSvc.AddMember(r.Context(), team, user.ID); err != nil {
+		writeTeamError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleRemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	_, team, ok := s.teamForRequest(w, r, true)
+	if !ok {
+		return
+	}
+	user, err := s.db.GetUserByUsername(r.Context(), r.PathValue("username"))
+	if err != nil {
+		jsonError(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err := s.teamSvc.RemoveMember(r.Context(), team, user.ID); err != nil {
+		jsonError(w, "failed to remove team member", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListTeamRepos(w http.ResponseWriter, r *http.Request) {
+	_, team, ok := s.teamForRequest(w, r, false)
+	if !ok {
+		return
+	}
+	repos, err := s.teamSvc.Repos(r.Context(), team)
+	if err != nil {
+		jsonError(w, "failed to list team repositories", http.StatusInternalServerError)
+		return
+	}
+	if repos == nil {
+		repos = []models.TeamRepo{}
+	}
+	jsonResponse(w, http.StatusOK, repos)
+}
+
+func (s *Server) handleSetTeamRepo(w http.ResponseWriter, r *http.Request) {
+	org, team, ok := s.teamForRequest(w, r, true)
+	if !ok {
+		return
+	}
+	var req struct {
+		Permission string `json:"permission"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	repo, err := s.repoSvc.Get(r.Context(), org.Name, r.PathValue("repo"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "repository not found", http.StatusNotFound)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.teamSvc.SetRepoPermission(r.Context(), team, repo, req.Permission); err != nil {
+		writeTeamError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleRemoveTeamRepo(w http.ResponseWriter, r *http.Request) {
+	org, team, ok := s.teamForRequest(w, r, true)
+	if !ok {
+		return
+	}
+	repo, err := s.repoSvc.Get(r.Context(), org.Name, r.PathValue("repo"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "repository not found", http.StatusNotFound)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.teamSvc.RemoveRepo(r.Context(), team, repo.ID); err != nil {
+		jsonError(w, "failed to remove team repository", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
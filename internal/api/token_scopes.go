@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/odvcencio/gothub/internal/auth"
+)
+
+// repoAdminPaths are repository routes that change who can reach the repo
+// or how it is guarded, and so need admin:repo.
+var repoAdminPaths = []string{"/collaborators", "/invitations", "/webhooks", "/branch-protection", "/deploy-keys", "/runners/tokens", "/audit"}
+
+// tokenGrantsRequest reports whether a scoped token holds one of the scopes
+// that the matched route accepts.
+func tokenGrantsRequest(claims *auth.Claims, r *http.Request) bool {
+	for _, scope := range tokenScopesForRequest(r) {
+		if claims.HasScope(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenScopesForRequest returns the scopes that each allow the request, keyed
+// off the matched route pattern. Routes that return nil, such as account,
+// credential and session management, are reserved for full sessions.
+func tokenScopesForRequest(r *http.Request) []string {
+	method, path, ok := strings.Cut(r.Pattern, " ")
+	if !ok {
+		method, path = r.Method, r.Pattern
+	}
+	read := method == http.MethodGet || method == http.MethodHead
+
+	switch {
+	case path == "/api/v1/user" && read:
+		return auth.AllScopes
+	case path == "/api/v1/user/repos" && read:
+		return []string{auth.ScopeRepoRead}
+	case path == "/api/v1/user/orgs" && read:
+		return []string{auth.ScopeRepoRead, auth.ScopeAdminOrg}
+	case path == "/api/v1/repos" && method == http.MethodPost:
+		return []string{auth.ScopeAdminRepo}
+	case path == "/api/v1/orgs/{org}/security":
+		return nil
+	case path == "/api/v1/orgs/{org}/audit":
+		return []string{auth.ScopeAdminOrg}
+	case path == "/api/v1/orgs" || strings.HasPrefix(path, "/api/v1/orgs/"):
+		if read {
+			return []string{auth.ScopeRepoRead, auth.ScopeAdminOrg}
+		}
+		return []string{auth.ScopeAdminOrg}
+	}
+
+	rest, ok := strings.CutPrefix(path, "/api/v1/repos/{owner}/{repo}")
+	if !ok {
+		return nil
+	}
+	if rest == "" && method == http.MethodDelete {
+		return []string{auth.ScopeAdminRepo}
+	}
+	for _, prefix := range repoAdminPaths {
+		if strings.HasPrefix(rest, prefix) {
+			return []string{auth.ScopeAdminRepo}
+		}
+	}
+	if strings.HasPrefix(rest, "/issues") || rest == "/search/issues" || rest == "/entity-issues" {
+		if read {
+			return []string{auth.ScopeRepoRead, auth.ScopeIssues}
+		}
+		return []string{auth.ScopeIssues}
+	}
+	if read {
+		return []string{auth.ScopeRepoRead}
+	}
+	return []string{auth.ScopeRepoWrite}
+}
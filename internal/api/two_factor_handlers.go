@@ -0,0 +1,304 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/models"
+	"github.com/odvcencio/gothub/internal/service"
+)
+
+type twoFactorChallengeResponse struct {
+	TwoFactorRequired bool     `json:"two_factor_required"`
+	Challenge         string   `json:"challenge"`
+	Methods           []string `json:"methods"`
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// completeSignIn finishes a sign-in whose first factor (magic link or SSH
+// key) has been checked. Users with an authenticator app get a challenge to
+// answer at /auth/2fa/verify instead of a token. Passkey sign-ins skip this:
+// a passkey is already a strong factor.
+func (s *Server) completeSignIn(w http.ResponseWriter, r *http.Request, user *models.User) {
+	if rejectSuspended(w, user) {
+		return
+	}
+	enabled, err := s.twoFactorSvc.TOTPEnabled(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		challenge, err := s.twoFactorSvc.CreateChallenge(r.Context(), user.ID)
+		if err != nil {
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, http.StatusOK, twoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			Challenge:         challenge,
+			Methods:           []string{"totp", "recovery_code"},
+		})
+		return
+	}
+	token, err := s.issueSessionToken(r, user)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, tokenResponse{Token: token, User: user})
+}
+
+func (s *Server) handleVerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Challenge == "" || req.Code == "" {
+		jsonError(w, "challenge and code are required", http.StatusBadRequest)
+		return
+	}
+	userID, retry, err := s.twoFactorSvc.VerifyChallenge(r.Context(), req.Challenge, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidTwoFactorCode) && retry != "":
+			jsonResponse(w, http.StatusUnauthorized, map[string]any{
+				"error":     "invalid two-factor code",
+				"challenge": retry,
+			})
+		case errors.Is(err, service.ErrInvalidTwoFactorCode):
+			jsonError(w, "too many invalid codes; sign in again", http.StatusUnauthorized)
+		case errors.Is(err, service.ErrTwoFactorChallenge), errors.Is(err, service.ErrTOTPNotEnabled):
+			jsonError(w, "invalid or expired challenge", http.StatusUnauthorized)
+		default:
+			jsonError(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+	user, err := s.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if rejectSuspended(w, user) {
+		return
+	}
+	token, err := s.issueSessionToken(r, user)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, tokenResponse{Token: token, User: user})
+}
+
+func (s *Server) handleGetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	status, err := s.twoFactorSvc.Status(r.Context(), claims.UserID)
+	if err != nil {
+		jsonError(w, "failed to get two-factor status", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, status)
+}
+
+func (s *Server) handleBeginTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	user, err := s.db.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		jsonError(w, "user not found", http.StatusNotFound)
+		return
+	}
+	enrollment, err := s.twoFactorSvc.BeginTOTPEnrollment(r.Context(), user)
+	if err != nil {
+		if errors.Is(err, service.ErrTOTPAlreadyEnabled) {
+			jsonError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		jsonError(w, "failed to start enrollment", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, http.StatusOK, enrollment)
+}
+
+func (s *Server) handleConfirmTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	var req twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	codes, err := s.twoFactorSvc.ConfirmTOTPEnrollment(r.Context(), claims.UserID, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"recovery_codes": codes})
+}
+
+func (s *Server) handleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	var req twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := s.twoFactorSvc.DisableTOTP(r.Context(), claims.UserID, req.Code); err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	var req twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	codes, err := s.twoFactorSvc.RegenerateRecoveryCodes(r.Context(), claims.UserID, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"recovery_codes": codes})
+}
+
+func writeTwoFactorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		jsonError(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, service.ErrTOTPAlreadyEnabled), errors.Is(err, service.ErrTwoFactorRequiredByOrg):
+		jsonError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrTOTPNotEnabled), errors.Is(err, service.ErrTOTPNotPending):
+		jsonError(w, err.Error(), http.StatusBadRequest)
+	default:
+		jsonError(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+type orgSecurityResponse struct {
+	RequireTwoFactor bool `json:"require_two_factor"`
+	// NonCompliantMembers lists members without a strong factor, who lose
+	// access to the org's repositories while the requirement is on.
+	NonCompliantMembers []string `json:"non_compliant_members"`
+}
+
+func (s *Server) handleGetOrgSecurity(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.orgForOwner(w, r, "only org owners can manage security settings")
+	if !ok {
+		return
+	}
+	s.writeOrgSecurity(w, r, org)
+}
+
+func (s *Server) handleUpdateOrgSecurity(w http.ResponseWriter, r *http.Request) {
+	org, ok := s.orgForOwner(w, r, "only org owners can manage security settings")
+	if !ok {
+		return
+	}
+	var req struct {
+		RequireTwoFactor *bool `json:"require_two_factor"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.RequireTwoFactor == nil {
+		jsonError(w, "require_two_factor is required", http.StatusBadRequest)
+		return
+	}
+	if *req.RequireTwoFactor {
+		// Owners could otherwise lock themselves out of their own org.
+		claims := auth.GetClaims(r.Context())
+		strong, err := s.twoFactorSvc.HasStrongFactor(r.Context(), claims.UserID)
+		if err != nil {
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if !strong {
+			jsonError(w, "enable two-factor authentication on your account first", http.StatusConflict)
+			return
+		}
+	}
+	if err := s.db.SetOrgRequireTwoFactor(r.Context(), org.ID, *req.RequireTwoFactor); err != nil {
+		jsonError(w, "failed to update org security", http.StatusInternalServerError)
+		return
+	}
+	s.auditSvc.RecordOrg(r.Context(), org, service.AuditOrgUpdate, "",
+		map[string]bool{"require_two_factor": org.RequireTwoFactor},
+		map[string]bool{"require_two_factor": *req.RequireTwoFactor})
+	org.RequireTwoFactor = *req.RequireTwoFactor
+	s.writeOrgSecurity(w, r, org)
+}
+
+func (s *Server) writeOrgSecurity(w http.ResponseWriter, r *http.Request, org *models.Org) {
+	members, err := s.db.ListOrgMembers(r.Context(), org.ID)
+	if err != nil {
+		jsonError(w, "failed to list members", http.StatusInternalServerError)
+		return
+	}
+	resp := orgSecurityResponse{RequireTwoFactor: org.RequireTwoFactor, NonCompliantMembers: []string{}}
+	for _, m := range members {
+		strong, err := s.twoFactorSvc.HasStrongFactor(r.Context(), m.UserID)
+		if err != nil {
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if strong {
+			continue
+		}
+		user, err := s.db.GetUserByID(r.Context(), m.UserID)
+		if err != nil {
+			jsonError(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		resp.NonCompliantMembers = append(resp.NonCompliantMembers, user.Username)
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+// orgForOwner loads the {org} in the path and checks that the caller owns
+// it, writing the error response if not; forbidden explains the refusal.
+func (s *Server) orgForOwner(w http.ResponseWriter, r *http.Request, forbidden string) (*models.Org, bool) {
+	org, err := s.db.GetOrg(r.Context(), r.PathValue("org"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "org not found", http.StatusNotFound)
+			return nil, false
+		}
+		jsonError(w, "failed to get org", http.StatusInternalServerError)
+		return nil, false
+	}
+	claims := auth.GetClaims(r.Context())
+	member, err := s.db.GetOrgMember(r.Context(), org.ID, claims.UserID)
+	if err != nil || member.Role != "owner" {
+		jsonError(w, forbidden, http.StatusForbidden)
+		return nil, false
+	}
+	return org, true
+}
+
+// orgTwoFactorSatisfied reports whether userID may use orgID's repositories
+// under its two-factor requirement.
+func (s *Server) orgTwoFactorSatisfied(ctx context.Context, orgID, userID int64) (bool, error) {
+	org, err := s.db.GetOrgByID(ctx, orgID)
+	if err != nil {
+		return false, err
+	}
+	if !org.RequireTwoFactor {
+		return true, nil
+	}
+	return s.twoFactorSvc.HasStrongFactor(ctx, userID)
+}
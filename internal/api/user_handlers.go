@@ -1,14 +1,14 @@
 package api
 
 import (
-	"crypto/md5"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/odvcencio/gothub/internal/auth"
 	"github.com/odvcencio/gothub/internal/models"
-	"golang.org/x/crypto/ssh"
+	"github.com/odvcencio/gothub/internal/service"
 )
 
 type createSSHKeyRequest struct {
@@ -18,7 +18,7 @@ type createSSHKeyRequest struct {
 
 func (s *Server) handleListSSHKeys(w http.ResponseWriter, r *http.Request) {
 	claims := auth.GetClaims(r.Context())
-	keys, err := s.db.ListSSHKeys(r.Context(), claims.UserID)
+	keys, err := s.sshKeySvc.List(r.Context(), claims.UserID)
 	if err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
@@ -41,36 +41,106 @@ func (s *Server) handleCreateSSHKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey))
+	key, err := s.sshKeySvc.Add(r.Context(), claims.UserID, req.Name, req.PublicKey)
 	if err != nil {
-		jsonError(w, "invalid SSH public key", http.StatusBadRequest)
+		switch {
+		case errors.Is(err, service.ErrInvalidSSHKey):
+			jsonError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, service.ErrSSHKeyDeployKey):
+			jsonError(w, err.Error(), http.StatusConflict)
+		default:
+			jsonError(w, "key already exists", http.StatusConflict)
+		}
 		return
 	}
+	jsonResponse(w, http.StatusCreated, key)
+}
 
-	fp := fmt.Sprintf("%x", md5.Sum(pubKey.Marshal()))
-	key := &models.SSHKey{
-		UserID:      claims.UserID,
-		Name:        req.Name,
-		Fingerprint: fp,
-		PublicKey:   req.PublicKey,
-		KeyType:     pubKey.Type(),
+func (s *Server) handleDeleteSSHKey(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	id, ok := parsePathPositiveInt64(w, r, "id", "key ID")
+	if !ok {
+		return
+	}
+	if err := s.sshKeySvc.Delete(r.Context(), claims.UserID, id); err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type createGPGKeyRequest struct {
+	PublicKey string `json:"public_key"`
+}
+
+func (s *Server) handleListGPGKeys(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	keys, err := s.gpgKeySvc.List(r.Context(), claims.UserID)
+	if err != nil {
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
 	}
-	if err := s.db.CreateSSHKey(r.Context(), key); err != nil {
+	if keys == nil {
+		keys = []models.GPGKey{}
+	}
+	jsonResponse(w, http.StatusOK, keys)
+}
+
+func (s *Server) handleCreateGPGKey(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetClaims(r.Context())
+	var req createGPGKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.PublicKey) == "" {
+		jsonError(w, "public_key is required", http.StatusBadRequest)
+		return
+	}
+	key, err := s.gpgKeySvc.Add(r.Context(), claims.UserID, req.PublicKey)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidGPGKey) {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		jsonError(w, "key already exists", http.StatusConflict)
 		return
 	}
 	jsonResponse(w, http.StatusCreated, key)
 }
 
-func (s *Server) handleDeleteSSHKey(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleDeleteGPGKey(w http.ResponseWriter, r *http.Request) {
 	claims := auth.GetClaims(r.Context())
 	id, ok := parsePathPositiveInt64(w, r, "id", "key ID")
 	if !ok {
 		return
 	}
-	if err := s.db.DeleteSSHKey(r.Context(), id, claims.UserID); err != nil {
+	if err := s.gpgKeySvc.Delete(r.Context(), claims.UserID, id); err != nil {
 		jsonError(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+type serverSigningKeyResponse struct {
+	Name        string `json:"name"`
+	KeyType     string `json:"key_type"`
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"public_key"`
+}
+
+// GET /api/v1/signing-key publishes the key the server signs merge commits
+// with, so clients can trust it.
+func (s *Server) handleGetServerSigningKey(w http.ResponseWriter, r *http.Request) {
+	signer := s.repoSvc.ServerSigner()
+	if signer == nil {
+		jsonError(w, "commit signing is not configured", http.StatusNotFound)
+		return
+	}
+	jsonResponse(w, http.StatusOK, serverSigningKeyResponse{
+		Name:        "gothub server key",
+		KeyType:     signer.KeyType(),
+		Fingerprint: signer.Fingerprint(),
+		PublicKey:   signer.PublicKey(),
+	})
+}
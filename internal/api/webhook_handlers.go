@@ -9,24 +9,45 @@ import (
 	"time"
 
 	"github.com/odvcencio/gothub/internal/models"
+	"github.com/odvcencio/gothub/internal/service"
 )
 
 type createWebhookRequest struct {
-	URL    string   `json:"url"`
-	Secret string   `json:"secret"`
+	URL                  string   `json:"url"`
+	Secret               string   `json:"secret"`
+	Events               []string `json:"events"`
+	Active               *bool    `json:"active"`
+	TimestampedSignature bool     `json:"timestamped_signature"`
+}
+
+type updateWebhookRequest struct {
+	URL    *string  `json:"url"`
+	Secret *string  `json:"secret"`
 	Events []string `json:"events"`
 	Active *bool    `json:"active"`
+	// SecretRotationSeconds keeps the old secret signing deliveries for this
+	// many seconds after a secret change.
+	SecretRotationSeconds int64 `json:"secret_rotation_seconds"`
+	TimestampedSignature  *bool `json:"timestamped_signature"`
 }
 
 type webhookResponse struct {
-	ID        int64     `json:"id"`
-	RepoID    int64     `json:"repo_id"`
-	URL       string    `json:"url"`
-	Events    []string  `json:"events,omitempty"`
-	Active    bool      `json:"active"`
-	HasSecret bool      `json:"has_secret"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID             int64      `json:"id"`
+	RepoID         int64      `json:"repo_id,omitempty"`
+	OrgID          int64      `json:"org_id,omitempty"`
+	URL            string     `json:"url"`
+	Events         []string   `json:"events,omitempty"`
+	Active         bool       `json:"active"`
+	HasSecret      bool       `json:"has_secret"`
+	FailingSince   *time.Time `json:"failing_since,omitempty"`
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+	// PreviousSecretExpiresAt is set while a rotated secret still signs
+	// deliveries.
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+	TimestampedSignature    bool       `json:"timestamped_signature"`
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
 }
 
 func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
@@ -51,11 +72,12 @@ func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
 	}
 
 	hook := &models.Webhook{
-		RepoID: repo.ID,
-		URL:    req.URL,
-		Secret: req.Secret,
-		Events: req.Events,
-		Active: active,
+		RepoID:               repo.ID,
+		URL:                  req.URL,
+		Secret:               req.Secret,
+		Events:               req.Events,
+		Active:               active,
+		TimestampedSignature: req.TimestampedSignature,
 	}
 	if err := s.webhookSvc.CreateWebhook(r.Context(), hook); err != nil {
 		jsonError(w, err.Error(), http.StatusBadRequest)
@@ -106,6 +128,56 @@ func (s *Server) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, http.StatusOK, webhookToResponse(hook))
 }
 
+func (s *Server) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	repo, ok := s.authorizeRepoRequest(w, r, true)
+	if !ok {
+		return
+	}
+	webhookID, ok := parsePathPositiveInt64(w, r, "id", "webhook id")
+	if !ok {
+		return
+	}
+	update, ok := decodeWebhookUpdate(w, r)
+	if !ok {
+		return
+	}
+
+	hook, err := s.webhookSvc.GetWebhook(r.Context(), repo.ID, webhookID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, "webhook not found", http.StatusNotFound)
+			return
+		}
+		jsonError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.webhookSvc.UpdateWebhook(r.Context(), hook, update); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonResponse(w, http.StatusOK, webhookToResponse(hook))
+}
+
+func decodeWebhookUpdate(w http.ResponseWriter, r *http.Request) (service.WebhookUpdate, bool) {
+	var req updateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "invalid request body", http.StatusBadRequest)
+		return service.WebhookUpdate{}, false
+	}
+	if req.SecretRotationSeconds < 0 {
+		jsonError(w, "secret_rotation_seconds must not be negative", http.StatusBadRequest)
+		return service.WebhookUpdate{}, false
+	}
+	return service.WebhookUpdate{
+		URL:                  req.URL,
+		Events:               req.Events,
+		Active:               req.Active,
+		Secret:               req.Secret,
+		SecretRotationWindow: time.Duration(req.SecretRotationSeconds) * time.Second,
+		TimestampedSignature: req.TimestampedSignature,
+	}, true
+}
+
 func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
 	repo, ok := s.authorizeRepoRequest(w, r, true)
 	if !ok {
@@ -199,14 +271,27 @@ func (s *Server) handlePingWebhook(w http.ResponseWriter, r *http.Request) {
 }
 
 func webhookToResponse(hook *models.Webhook) webhookResponse {
-	return webhookResponse{
-		ID:        hook.ID,
-		RepoID:    hook.RepoID,
-		URL:       hook.URL,
-		Events:    hook.Events,
-		Active:    hook.Active,
-		HasSecret: hook.Secret != "",
-		CreatedAt: hook.CreatedAt,
-		UpdatedAt: hook.UpdatedAt,
+	resp := webhookResponse{
+		ID:                   hook.ID,
+		RepoID:               hook.RepoID,
+		OrgID:                hook.OrgID,
+		URL:                  hook.URL,
+		Events:               hook.Events,
+		Active:               hook.Active,
+		HasSecret:            hook.Secret != "",
+		FailingSince:         hook.FailingSince,
+		DisabledAt:           hook.DisabledAt,
+		DisabledReason:       hook.DisabledReason,
+		CreatedAt:            hook.CreatedAt,
+		UpdatedAt:            hook.UpdatedAt,
+		TimestampedSignature: hook.TimestampedSignature,
+	}
+	if hook.PreviousSecret != "" && hook.PreviousSecretExpiresAt != nil && time.Now().Before(*hook.PreviousSecretExpiresAt) {
+		resp.PreviousSecretExpiresAt = hook.PreviousSecretExpiresAt
 	}
+	return resp
+}
+
+func (s *Server) handleListWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, http.StatusOK, service.WebhookEvents())
 }
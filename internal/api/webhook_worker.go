@@ -0,0 +1,24 @@
+package api
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/jobs"
+)
+
+// Failed deliveries back off exponentially from webhookRetryDelay up to
+// webhookMaxRetryDelay, spreading the attempt budget over about a day.
+const (
+	webhookRetryDelay    = time.Minute
+	webhookMaxRetryDelay = 4 * time.Hour
+	webhookMaxAttempts   = 12
+)
+
+func (s *Server) newWebhookWorker(workerCount int, pollInterval time.Duration) *jobs.WorkerPool {
+	return jobs.NewWorkerPool(s.webhookQueue, s.webhookSvc.ProcessDeliveryJob, jobs.WorkerPoolOptions{
+		Workers:      workerCount,
+		PollInterval: pollInterval,
+		Logger:       slog.Default(),
+	})
+}
@@ -1,7 +1,11 @@
 package auth
 
 import (
+	"context"
 	"errors"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -12,17 +16,92 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrTokenExpired       = errors.New("token expired")
 	ErrInvalidToken       = errors.New("invalid token")
+	ErrSessionRevoked     = errors.New("session revoked")
 )
 
+// Scopes granted to personal access tokens. admin:repo implies repo:write,
+// which implies repo:read.
+const (
+	ScopeRepoRead  = "repo:read"
+	ScopeRepoWrite = "repo:write"
+	ScopeIssues    = "issues"
+	ScopeAdminRepo = "admin:repo"
+	ScopeAdminOrg  = "admin:org"
+)
+
+// AllScopes lists every scope a token may be granted.
+var AllScopes = []string{ScopeRepoRead, ScopeRepoWrite, ScopeIssues, ScopeAdminRepo, ScopeAdminOrg}
+
 type Claims struct {
 	UserID   int64  `json:"user_id"`
 	Username string `json:"username"`
+	// SessionID names the server-side session a JWT belongs to.
+	SessionID string `json:"sid,omitempty"`
+	// Scopes is nil for full sessions and lists the grants of a scoped token.
+	Scopes []string `json:"scopes,omitempty"`
+	// RepoIDs, when non-empty, limits a scoped token to these repositories.
+	RepoIDs []int64 `json:"-"`
 	jwt.RegisteredClaims
 }
 
+// Scoped reports whether the claims come from a scoped token rather than a
+// full session.
+func (c *Claims) Scoped() bool {
+	return c != nil && c.Scopes != nil
+}
+
+// HasScope reports whether the claims grant scope. Full sessions hold every
+// scope.
+func (c *Claims) HasScope(scope string) bool {
+	if !c.Scoped() {
+		return true
+	}
+	for _, granted := range c.Scopes {
+		if granted == scope {
+			return true
+		}
+		switch granted {
+		case ScopeAdminRepo:
+			if scope == ScopeRepoWrite || scope == ScopeRepoRead {
+				return true
+			}
+		case ScopeRepoWrite:
+			if scope == ScopeRepoRead {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AllowsRepo reports whether the claims may act on the repository.
+func (c *Claims) AllowsRepo(repoID int64) bool {
+	if !c.Scoped() || len(c.RepoIDs) == 0 {
+		return true
+	}
+	return slices.Contains(c.RepoIDs, repoID)
+}
+
+// TokenValidator resolves an opaque bearer token, such as a personal access
+// token, into claims.
+type TokenValidator func(ctx context.Context, token string) (*Claims, error)
+
+// SessionStore backs JWTs with server-side sessions so they can be revoked
+// before they expire.
+type SessionStore interface {
+	// ValidateSession returns an error when the session is unknown, belongs
+	// to another user, or has been revoked or has expired. It may record the
+	// activity.
+	ValidateSession(ctx context.Context, sessionID string, userID int64) error
+}
+
 type Service struct {
 	secret   []byte
 	duration time.Duration
+
+	mu         sync.RWMutex
+	validators map[string]TokenValidator
+	sessions   SessionStore
 }
 
 func NewService(secret string, duration time.Duration) *Service {
@@ -47,11 +126,30 @@ func (s *Service) CheckPassword(hash, password string) error {
 	return nil
 }
 
+// TokenDuration is how long issued JWTs, and the sessions behind them, last.
+func (s *Service) TokenDuration() time.Duration {
+	return s.duration
+}
+
+// SetSessionStore makes JWT validation require a live session. Tokens
+// without a session ID are rejected once a store is set.
+func (s *Service) SetSessionStore(store SessionStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = store
+}
+
 func (s *Service) GenerateToken(userID int64, username string) (string, error) {
+	return s.GenerateSessionToken(userID, username, "")
+}
+
+// GenerateSessionToken issues a JWT bound to a server-side session.
+func (s *Service) GenerateSessionToken(userID int64, username, sessionID string) (string, error) {
 	now := time.Now()
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		Username:  username,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(s.duration)),
@@ -61,6 +159,48 @@ func (s *Service) GenerateToken(userID int64, username string) (string, error) {
 	return token.SignedString(s.secret)
 }
 
+// RegisterTokenValidator routes bearer tokens starting with prefix to fn
+// instead of JWT validation.
+func (s *Service) RegisterTokenValidator(prefix string, fn TokenValidator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.validators == nil {
+		s.validators = make(map[string]TokenValidator)
+	}
+	s.validators[prefix] = fn
+}
+
+// ValidateBearerToken validates a bearer token with the validator
+// registered for its prefix, falling back to JWT validation.
+func (s *Service) ValidateBearerToken(ctx context.Context, tokenStr string) (*Claims, error) {
+	s.mu.RLock()
+	var validate TokenValidator
+	for prefix, fn := range s.validators {
+		if strings.HasPrefix(tokenStr, prefix) {
+			validate = fn
+			break
+		}
+	}
+	sessions := s.sessions
+	s.mu.RUnlock()
+	if validate != nil {
+		return validate(ctx, tokenStr)
+	}
+	claims, err := s.ValidateToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if sessions != nil {
+		if claims.SessionID == "" {
+			return nil, ErrInvalidToken
+		}
+		if err := sessions.ValidateSession(ctx, claims.SessionID, claims.UserID); err != nil {
+			return nil, ErrSessionRevoked
+		}
+	}
+	return claims, nil
+}
+
 func (s *Service) ValidateToken(tokenStr string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (any, error) {
 		return s.secret, nil
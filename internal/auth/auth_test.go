@@ -55,3 +55,28 @@ func TestHashAndCheckPassword(t *testing.T) {
 		t.Fatalf("CheckPassword(invalid) error = %v, want %v", err, ErrInvalidCredentials)
 	}
 }
+
+func TestClaimsScopes(t *testing.T) {
+	session := &Claims{UserID: 1}
+	if session.Scoped() || !session.HasScope(ScopeAdminOrg) || !session.AllowsRepo(7) {
+		t.Fatal("full sessions must hold every scope and repository")
+	}
+
+	token := &Claims{UserID: 1, Scopes: []string{ScopeAdminRepo}, RepoIDs: []int64{7}}
+	for _, scope := range []string{ScopeAdminRepo, ScopeRepoWrite, ScopeRepoRead} {
+		if !token.HasScope(scope) {
+			t.Fatalf("admin:repo should grant %s", scope)
+		}
+	}
+	if token.HasScope(ScopeIssues) || token.HasScope(ScopeAdminOrg) {
+		t.Fatal("admin:repo must not grant issues or admin:org")
+	}
+	if !token.AllowsRepo(7) || token.AllowsRepo(8) {
+		t.Fatal("repo allowlist not enforced")
+	}
+
+	readOnly := &Claims{UserID: 1, Scopes: []string{ScopeRepoRead}}
+	if readOnly.HasScope(ScopeRepoWrite) || !readOnly.AllowsRepo(8) {
+		t.Fatal("repo:read must not grant repo:write, and no allowlist means any repo")
+	}
+}
@@ -10,7 +10,8 @@ type contextKey string
 
 const claimsKey contextKey = "claims"
 
-// Middleware extracts and validates JWT from the Authorization header.
+// Middleware extracts and validates a JWT or registered opaque token from the
+// Authorization header.
 // If valid, the claims are stored in the request context.
 func Middleware(authSvc *Service) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -25,7 +26,7 @@ func Middleware(authSvc *Service) func(http.Handler) http.Handler {
 				next.ServeHTTP(w, r)
 				return
 			}
-			claims, err := authSvc.ValidateToken(token)
+			claims, err := authSvc.ValidateBearerToken(r.Context(), token)
 			if err != nil {
 				http.Error(w, `{"error":"invalid token"}`, http.StatusUnauthorized)
 				return
@@ -36,6 +37,12 @@ func Middleware(authSvc *Service) func(http.Handler) http.Handler {
 	}
 }
 
+// WithClaims returns a copy of ctx carrying claims, for callers that
+// authenticate outside Middleware, such as git over SSH.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey, claims)
+}
+
 // GetClaims retrieves the JWT claims from a request context. Returns nil if unauthenticated.
 func GetClaims(ctx context.Context) *Claims {
 	c, _ := ctx.Value(claimsKey).(*Claims)
@@ -197,3 +197,67 @@ func mutateLastByte(token string) string {
 	}
 	return token[:len(token)-1] + string(replacement)
 }
+
+func TestMiddlewareUsesRegisteredTokenValidator(t *testing.T) {
+	svc := NewService("test-secret-1234567890", time.Hour)
+	svc.RegisterTokenValidator("pat_", func(ctx context.Context, token string) (*Claims, error) {
+		if token != "pat_good" {
+			return nil, ErrInvalidToken
+		}
+		return &Claims{UserID: 9, Scopes: []string{ScopeRepoRead}}, nil
+	})
+
+	var got *Claims
+	handler := Middleware(svc)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetClaims(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer pat_good")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got == nil || got.UserID != 9 || !got.Scoped() {
+		t.Fatalf("expected scoped claims from validator, got %+v", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer pat_bad")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for rejected opaque token, got %d", rec.Code)
+	}
+}
+
+type fakeSessionStore map[string]int64
+
+func (f fakeSessionStore) ValidateSession(ctx context.Context, sessionID string, userID int64) error {
+	if owner, ok := f[sessionID]; !ok || owner != userID {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+func TestMiddlewareRequiresLiveSessionWhenStoreIsSet(t *testing.T) {
+	svc := NewService("test-secret-1234567890", time.Hour)
+	store := fakeSessionStore{"live": 1}
+	svc.SetSessionStore(store)
+
+	live, _ := svc.GenerateSessionToken(1, "alice", "live")
+	revoked, _ := svc.GenerateSessionToken(1, "alice", "gone")
+	legacy, _ := svc.GenerateToken(1, "alice")
+
+	handler := Middleware(svc)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims := GetClaims(r.Context()); claims == nil || claims.SessionID != "live" {
+			t.Fatalf("unexpected claims %+v", claims)
+		}
+	}))
+	for token, want := range map[string]int{live: http.StatusOK, revoked: http.StatusUnauthorized, legacy: http.StatusUnauthorized} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("expected %d, got %d", want, rec.Code)
+		}
+	}
+}
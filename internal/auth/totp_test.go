@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	// RFC 6238 appendix B SHA1 vectors, truncated to six digits.
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("TOTP at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidateTOTPSkewAndReplay(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	previous, _ := TOTPCode(secret, TOTPStep(now)-1)
+	step, ok := ValidateTOTP(secret, previous, now, 0)
+	if !ok || step != TOTPStep(now)-1 {
+		t.Fatalf("expected code from the previous step to be accepted, got %d %v", step, ok)
+	}
+	if _, ok := ValidateTOTP(secret, previous, now, step); ok {
+		t.Fatal("expected a used code to be rejected")
+	}
+	stale, _ := TOTPCode(secret, TOTPStep(now)-3)
+	if _, ok := ValidateTOTP(secret, stale, now, 0); ok {
+		t.Fatal("expected a code outside the skew window to be rejected")
+	}
+	if _, ok := ValidateTOTP(secret, "12345", now, 0); ok {
+		t.Fatal("expected a short code to be rejected")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("gothub", "alice@example.com", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/gothub:alice@example.com?") {
+		t.Fatalf("unexpected label in %q", uri)
+	}
+	for _, want := range []string{"secret=JBSWY3DPEHPK3PXP", "issuer=gothub", "digits=6", "period=30"} {
+		if !strings.Contains(uri, want) {
+			t.Fatalf("expected %q in %q", want, uri)
+		}
+	}
+}
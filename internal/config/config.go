@@ -16,6 +16,8 @@ type Config struct {
 	Auth     AuthConfig     `yaml:"auth"`
 	Tenancy  TenancyConfig  `yaml:"tenancy"`
 	Launch   LaunchConfig   `yaml:"launch"`
+	Signing  SigningConfig  `yaml:"signing"`
+	Mail     MailConfig     `yaml:"mail"`
 }
 
 type ServerConfig struct {
@@ -23,6 +25,11 @@ type ServerConfig struct {
 	Port               int      `yaml:"port"`
 	TrustedProxies     []string `yaml:"trusted_proxies"`
 	CORSAllowedOrigins []string `yaml:"cors_allowed_origins"`
+	SSHPort            int      `yaml:"ssh_port"`     // git over SSH; 0 disables
+	SSHHostKeyPath     string   `yaml:"ssh_host_key"` // generated on first start when missing
+	// Dev marks a local development server, which may use the stdout mail
+	// driver.
+	Dev bool `yaml:"dev"`
 }
 
 type DatabaseConfig struct {
@@ -35,8 +42,49 @@ type StorageConfig struct {
 }
 
 type AuthConfig struct {
-	JWTSecret     string `yaml:"jwt_secret"`
-	TokenDuration string `yaml:"token_duration"` // e.g. "24h"
+	JWTSecret     string               `yaml:"jwt_secret"`
+	TokenDuration string               `yaml:"token_duration"` // e.g. "24h"
+	OIDCProviders []OIDCProviderConfig `yaml:"oidc_providers"`
+}
+
+// OIDCProviderConfig configures single sign-on through an OpenID Connect
+// provider. The provider's redirect URI is <public_url>/login/oidc/callback.
+type OIDCProviderConfig struct {
+	Name          string             `yaml:"name"` // used in URLs, e.g. "okta"
+	DisplayName   string             `yaml:"display_name"`
+	Issuer        string             `yaml:"issuer"`
+	ClientID      string             `yaml:"client_id"`
+	ClientSecret  string             `yaml:"client_secret"`
+	Scopes        []string           `yaml:"scopes"`       // added to "openid"; defaults to email and profile
+	GroupsClaim   string             `yaml:"groups_claim"` // defaults to "groups"
+	GroupMappings []OIDCGroupMapping `yaml:"group_mappings"`
+}
+
+// OIDCGroupMapping makes members of Group members of Org with Role.
+type OIDCGroupMapping struct {
+	Group string `yaml:"group"`
+	Org   string `yaml:"org"`
+	Role  string `yaml:"role"` // "member" (default) or "owner"
+}
+
+type SigningConfig struct {
+	SSHKeyPath string `yaml:"ssh_key_path"` // private key used to sign server-created commits
+}
+
+type MailConfig struct {
+	Driver      string `yaml:"driver"` // "smtp", "file" or "stdout"
+	From        string `yaml:"from"`
+	PublicURL   string `yaml:"public_url"`   // web origin used for links in email
+	ReplyDomain string `yaml:"reply_domain"` // replies to notifications go to reply+<token>@ this domain
+	// ReplySecret signs reply addresses; required with a reply domain.
+	ReplySecret string `yaml:"reply_secret"`
+	// InboundSecret authenticates POST /api/v1/mail/inbound; empty disables it.
+	InboundSecret string `yaml:"inbound_secret"`
+	SMTPHost      string `yaml:"smtp_host"`
+	SMTPPort      int    `yaml:"smtp_port"`
+	SMTPUsername  string `yaml:"smtp_username"`
+	SMTPPassword  string `yaml:"smtp_password"`
+	FileDir       string `yaml:"file_dir"` // where the file driver writes .eml files
 }
 
 type TenancyConfig struct {
@@ -57,6 +105,11 @@ func (c *Config) Addr() string {
 	return fmt.Sprintf("%s:%d", c.Server.Host, c.Server.Port)
 }
 
+// SSHAddr returns the git-over-SSH listen address.
+func (c *Config) SSHAddr() string {
+	return fmt.Sprintf("%s:%d", c.Server.Host, c.Server.SSHPort)
+}
+
 func (c *Config) ValidateServe() error {
 	if c == nil {
 		return fmt.Errorf("config is required")
@@ -70,6 +123,49 @@ func (c *Config) ValidateServe() error {
 	if c.Storage.Path == "" {
 		return fmt.Errorf("storage.path must be configured")
 	}
+	seen := map[string]bool{}
+	for i, p := range c.Auth.OIDCProviders {
+		name := strings.ToLower(strings.TrimSpace(p.Name))
+		if name == "" || p.Issuer == "" || p.ClientID == "" {
+			return fmt.Errorf("auth.oidc_providers[%d] needs name, issuer and client_id", i)
+		}
+		if seen[name] {
+			return fmt.Errorf("auth.oidc_providers: duplicate provider name %q", name)
+		}
+		seen[name] = true
+		for _, m := range p.GroupMappings {
+			if m.Group == "" || m.Org == "" {
+				return fmt.Errorf("auth.oidc_providers[%d]: group mappings need group and org", i)
+			}
+			if m.Role != "" && m.Role != "member" && m.Role != "owner" {
+				return fmt.Errorf("auth.oidc_providers[%d]: invalid role %q for group %q", i, m.Role, m.Group)
+			}
+		}
+	}
+	return c.ValidateMail()
+}
+
+// ValidateMail requires an explicit mail driver. The stdout driver writes
+// sign-in and invitation links to the server log, so only dev servers may
+// use it. Reply addresses are signed with their own secret.
+func (c *Config) ValidateMail() error {
+	switch strings.ToLower(strings.TrimSpace(c.Mail.Driver)) {
+	case "":
+		return fmt.Errorf("GOTHUB_MAIL_DRIVER must be set to smtp or file (stdout is allowed with GOTHUB_DEV=true)")
+	case "stdout":
+		if !c.Server.Dev {
+			return fmt.Errorf("GOTHUB_MAIL_DRIVER=stdout logs sign-in links and is only allowed with GOTHUB_DEV=true")
+		}
+	}
+	if c.Mail.ReplyDomain == "" {
+		return nil
+	}
+	if len(c.Mail.ReplySecret) < 16 {
+		return fmt.Errorf("GOTHUB_MAIL_REPLY_SECRET must be at least 16 characters when a reply domain is set (current length: %d)", len(c.Mail.ReplySecret))
+	}
+	if c.Mail.ReplySecret == c.Auth.JWTSecret {
+		return fmt.Errorf("GOTHUB_MAIL_REPLY_SECRET must differ from GOTHUB_JWT_SECRET")
+	}
 	return nil
 }
 
@@ -100,6 +196,11 @@ func Default() *Config {
 			RequirePrivateRepoPlan: false,
 			MaxPrivateReposPerUser: 0,
 		},
+		Mail: MailConfig{
+			From:      "gothub <noreply@localhost>",
+			PublicURL: "http://localhost:3000",
+			SMTPPort:  587,
+		},
 	}
 }
 
@@ -129,12 +230,25 @@ func applyEnv(cfg *Config) {
 			cfg.Server.Port = p
 		}
 	}
+	if v := os.Getenv("GOTHUB_SSH_PORT"); v != "" {
+		if p, err := strconv.Atoi(v); err == nil {
+			cfg.Server.SSHPort = p
+		}
+	}
+	if v := os.Getenv("GOTHUB_SSH_HOST_KEY"); v != "" {
+		cfg.Server.SSHHostKeyPath = strings.TrimSpace(v)
+	}
 	if v := os.Getenv("GOTHUB_TRUSTED_PROXIES"); v != "" {
 		cfg.Server.TrustedProxies = parseCSV(v)
 	}
 	if v := os.Getenv("GOTHUB_CORS_ALLOW_ORIGINS"); v != "" {
 		cfg.Server.CORSAllowedOrigins = parseCSV(v)
 	}
+	if v := os.Getenv("GOTHUB_DEV"); v != "" {
+		if dev, err := strconv.ParseBool(v); err == nil {
+			cfg.Server.Dev = dev
+		}
+	}
 	if v := os.Getenv("GOTHUB_DB_DRIVER"); v != "" {
 		cfg.Database.Driver = v
 	}
@@ -147,6 +261,12 @@ func applyEnv(cfg *Config) {
 	if v := os.Getenv("GOTHUB_JWT_SECRET"); v != "" {
 		cfg.Auth.JWTSecret = v
 	}
+	if v := os.Getenv("GOTHUB_OIDC_ISSUER"); v != "" {
+		cfg.Auth.OIDCProviders = append(cfg.Auth.OIDCProviders, oidcProviderFromEnv(strings.TrimSpace(v)))
+	}
+	if v := os.Getenv("GOTHUB_COMMIT_SIGNING_KEY"); v != "" {
+		cfg.Signing.SSHKeyPath = strings.TrimSpace(v)
+	}
 	if v := os.Getenv("GOTHUB_ENABLE_TENANCY"); v != "" {
 		if enabled, err := strconv.ParseBool(v); err == nil {
 			cfg.Tenancy.Enabled = enabled
@@ -181,6 +301,68 @@ func applyEnv(cfg *Config) {
 	if v := os.Getenv("GOTHUB_PRIVATE_REPO_ALLOWED_USERS"); v != "" {
 		cfg.Launch.PrivateRepoAllowedUsers = parseCSV(v)
 	}
+	if v := os.Getenv("GOTHUB_MAIL_DRIVER"); v != "" {
+		cfg.Mail.Driver = strings.TrimSpace(v)
+	}
+	if v := os.Getenv("GOTHUB_MAIL_FROM"); v != "" {
+		cfg.Mail.From = strings.TrimSpace(v)
+	}
+	if v := os.Getenv("GOTHUB_PUBLIC_URL"); v != "" {
+		cfg.Mail.PublicURL = strings.TrimSpace(v)
+	}
+	if v := os.Getenv("GOTHUB_MAIL_REPLY_DOMAIN"); v != "" {
+		cfg.Mail.ReplyDomain = strings.TrimSpace(v)
+	}
+	if v := os.Getenv("GOTHUB_MAIL_REPLY_SECRET"); v != "" {
+		cfg.Mail.ReplySecret = strings.TrimSpace(v)
+	}
+	if v := os.Getenv("GOTHUB_MAIL_INBOUND_SECRET"); v != "" {
+		cfg.Mail.InboundSecret = strings.TrimSpace(v)
+	}
+	if v := os.Getenv("GOTHUB_MAIL_FILE_DIR"); v != "" {
+		cfg.Mail.FileDir = strings.TrimSpace(v)
+	}
+	if v := os.Getenv("GOTHUB_SMTP_HOST"); v != "" {
+		cfg.Mail.SMTPHost = strings.TrimSpace(v)
+	}
+	if v := os.Getenv("GOTHUB_SMTP_PORT"); v != "" {
+		if p, err := strconv.Atoi(v); err == nil && p > 0 {
+			cfg.Mail.SMTPPort = p
+		}
+	}
+	if v := os.Getenv("GOTHUB_SMTP_USERNAME"); v != "" {
+		cfg.Mail.SMTPUsername = v
+	}
+	if v := os.Getenv("GOTHUB_SMTP_PASSWORD"); v != "" {
+		cfg.Mail.SMTPPassword = v
+	}
+}
+
+// oidcProviderFromEnv builds a single provider from GOTHUB_OIDC_* variables.
+// GOTHUB_OIDC_GROUP_ORGS maps groups as "group=org[:role],...".
+func oidcProviderFromEnv(issuer string) OIDCProviderConfig {
+	p := OIDCProviderConfig{
+		Name:         strings.TrimSpace(os.Getenv("GOTHUB_OIDC_NAME")),
+		DisplayName:  strings.TrimSpace(os.Getenv("GOTHUB_OIDC_DISPLAY_NAME")),
+		Issuer:       issuer,
+		ClientID:     strings.TrimSpace(os.Getenv("GOTHUB_OIDC_CLIENT_ID")),
+		ClientSecret: os.Getenv("GOTHUB_OIDC_CLIENT_SECRET"),
+		Scopes:       parseCSV(os.Getenv("GOTHUB_OIDC_SCOPES")),
+		GroupsClaim:  strings.TrimSpace(os.Getenv("GOTHUB_OIDC_GROUPS_CLAIM")),
+	}
+	if p.Name == "" {
+		p.Name = "sso"
+	}
+	for _, entry := range parseCSV(os.Getenv("GOTHUB_OIDC_GROUP_ORGS")) {
+		group, target, _ := strings.Cut(entry, "=")
+		org, role, _ := strings.Cut(target, ":")
+		p.GroupMappings = append(p.GroupMappings, OIDCGroupMapping{
+			Group: strings.TrimSpace(group),
+			Org:   strings.TrimSpace(org),
+			Role:  strings.TrimSpace(role),
+		})
+	}
+	return p
 }
 
 func parseCSV(v string) []string {
@@ -131,6 +131,55 @@ func TestLoadParsesTenancyEnv(t *testing.T) {
 	}
 }
 
+func TestLoadParsesMailEnv(t *testing.T) {
+	t.Setenv("GOTHUB_MAIL_DRIVER", "smtp")
+	t.Setenv("GOTHUB_SMTP_HOST", " smtp.example.com ")
+	t.Setenv("GOTHUB_SMTP_PORT", "2525")
+	t.Setenv("GOTHUB_MAIL_REPLY_DOMAIN", "reply.example.com")
+	t.Setenv("GOTHUB_MAIL_REPLY_SECRET", " reply-secret-0123456 ")
+	t.Setenv("GOTHUB_DEV", "true")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Mail.Driver != "smtp" || cfg.Mail.SMTPHost != "smtp.example.com" || cfg.Mail.SMTPPort != 2525 {
+		t.Fatalf("unexpected mail config %+v", cfg.Mail)
+	}
+	if cfg.Mail.ReplyDomain != "reply.example.com" || cfg.Mail.ReplySecret != "reply-secret-0123456" {
+		t.Fatalf("unexpected reply settings %q %q", cfg.Mail.ReplyDomain, cfg.Mail.ReplySecret)
+	}
+	if !cfg.Server.Dev {
+		t.Fatal("Server.Dev = false, want true")
+	}
+	if cfg.Mail.PublicURL != "http://localhost:3000" {
+		t.Fatalf("Mail.PublicURL = %q, want default", cfg.Mail.PublicURL)
+	}
+}
+
+func TestLoadParsesOIDCEnv(t *testing.T) {
+	t.Setenv("GOTHUB_OIDC_ISSUER", " https://idp.example.com ")
+	t.Setenv("GOTHUB_OIDC_NAME", "okta")
+	t.Setenv("GOTHUB_OIDC_CLIENT_ID", "gothub")
+	t.Setenv("GOTHUB_OIDC_GROUP_ORGS", "eng=acme, eng-leads=acme:owner")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cfg.Auth.OIDCProviders) != 1 {
+		t.Fatalf("expected one provider, got %+v", cfg.Auth.OIDCProviders)
+	}
+	p := cfg.Auth.OIDCProviders[0]
+	if p.Name != "okta" || p.Issuer != "https://idp.example.com" || p.ClientID != "gothub" {
+		t.Fatalf("unexpected provider %+v", p)
+	}
+	want := []OIDCGroupMapping{{Group: "eng", Org: "acme"}, {Group: "eng-leads", Org: "acme", Role: "owner"}}
+	if len(p.GroupMappings) != len(want) || p.GroupMappings[0] != want[0] || p.GroupMappings[1] != want[1] {
+		t.Fatalf("GroupMappings = %+v, want %+v", p.GroupMappings, want)
+	}
+}
+
 func TestLoadFromYAMLParsesCORSOrigins(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "config.yaml")
@@ -210,11 +259,69 @@ func TestValidateServe(t *testing.T) {
 			},
 			wantErr: "storage.path must be configured",
 		},
+		{
+			name: "oidc provider without issuer is rejected",
+			cfg: &Config{
+				Auth: AuthConfig{JWTSecret: "1234567890abcdef", OIDCProviders: []OIDCProviderConfig{
+					{Name: "okta", ClientID: "gothub"},
+				}},
+				Storage: StorageConfig{Path: "data/repos"},
+			},
+			wantErr: "needs name, issuer and client_id",
+		},
+		{
+			name: "oidc group mapping with unknown role is rejected",
+			cfg: &Config{
+				Auth: AuthConfig{JWTSecret: "1234567890abcdef", OIDCProviders: []OIDCProviderConfig{
+					{Name: "okta", Issuer: "https://idp.example.com", ClientID: "gothub", GroupMappings: []OIDCGroupMapping{
+						{Group: "eng", Org: "acme", Role: "admin"},
+					}},
+				}},
+				Storage: StorageConfig{Path: "data/repos"},
+			},
+			wantErr: `invalid role "admin"`,
+		},
+		{
+			name: "missing mail driver is rejected",
+			cfg: &Config{
+				Auth:    AuthConfig{JWTSecret: "1234567890abcdef"},
+				Storage: StorageConfig{Path: "data/repos"},
+			},
+			wantErr: "GOTHUB_MAIL_DRIVER must be set",
+		},
+		{
+			name: "stdout mail driver is rejected outside dev",
+			cfg: &Config{
+				Auth:    AuthConfig{JWTSecret: "1234567890abcdef"},
+				Storage: StorageConfig{Path: "data/repos"},
+				Mail:    MailConfig{Driver: "stdout"},
+			},
+			wantErr: "only allowed with GOTHUB_DEV=true",
+		},
+		{
+			name: "reply domain without its own secret is rejected",
+			cfg: &Config{
+				Auth:    AuthConfig{JWTSecret: "1234567890abcdef"},
+				Storage: StorageConfig{Path: "data/repos"},
+				Mail:    MailConfig{Driver: "smtp", ReplyDomain: "reply.example.com", ReplySecret: "1234567890abcdef"},
+			},
+			wantErr: "GOTHUB_MAIL_REPLY_SECRET must differ from GOTHUB_JWT_SECRET",
+		},
+		{
+			name: "stdout mail driver passes in dev",
+			cfg: &Config{
+				Server:  ServerConfig{Dev: true},
+				Auth:    AuthConfig{JWTSecret: "1234567890abcdef"},
+				Storage: StorageConfig{Path: "data/repos"},
+				Mail:    MailConfig{Driver: "stdout"},
+			},
+		},
 		{
 			name: "valid serve config passes",
 			cfg: &Config{
 				Auth:    AuthConfig{JWTSecret: "1234567890abcdef"},
 				Storage: StorageConfig{Path: "data/repos"},
+				Mail:    MailConfig{Driver: "smtp", ReplyDomain: "reply.example.com", ReplySecret: "fedcba0987654321"},
 			},
 		},
 	}
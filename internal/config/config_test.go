@@ -60,6 +60,9 @@ func TestLoadAppliesEnvOverrides(t *testing.T) {
 	t.Setenv("GOTHUB_REQUIRE_PRIVATE_REPO_PLAN", "true")
 	t.Setenv("GOTHUB_MAX_PRIVATE_REPOS_PER_USER", "3")
 	t.Setenv("GOTHUB_PRIVATE_REPO_ALLOWED_USERS", "alice, bob")
+	t.Setenv("GOTHUB_COMMIT_SIGNING_KEY", "/etc/gothub/signing_key")
+	t.Setenv("GOTHUB_SSH_PORT", "2222")
+	t.Setenv("GOTHUB_SSH_HOST_KEY", "/etc/gothub/ssh_host_key")
 
 	cfg, err := Load("")
 	if err != nil {
@@ -123,6 +126,15 @@ func TestLoadAppliesEnvOverrides(t *testing.T) {
 	if cfg.Launch.PrivateRepoAllowedUsers[1] != "bob" {
 		t.Fatalf("Launch.PrivateRepoAllowedUsers[1] = %q, want %q", cfg.Launch.PrivateRepoAllowedUsers[1], "bob")
 	}
+	if cfg.Signing.SSHKeyPath != "/etc/gothub/signing_key" {
+		t.Fatalf("Signing.SSHKeyPath = %q, want %q", cfg.Signing.SSHKeyPath, "/etc/gothub/signing_key")
+	}
+	if cfg.Server.SSHPort != 2222 {
+		t.Fatalf("Server.SSHPort = %d, want 2222", cfg.Server.SSHPort)
+	}
+	if cfg.Server.SSHHostKeyPath != "/etc/gothub/ssh_host_key" {
+		t.Fatalf("Server.SSHHostKeyPath = %q, want %q", cfg.Server.SSHHostKeyPath, "/etc/gothub/ssh_host_key")
+	}
 }
 
 func TestLoadFromYAML(t *testing.T) {
@@ -109,7 +109,7 @@ func BenchmarkSQLiteClaimAndCompleteIndexingJobLoop(b *testing.B) {
 	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		claimed, err := db.ClaimIndexingJob(ctx)
+		claimed, err := db.ClaimIndexingJob(ctx, models.IndexJobTypeCommitIndex, 1)
 		if err != nil {
 			b.Fatalf("claim indexing job: %v", err)
 		}
@@ -20,6 +20,16 @@ type DB interface {
 	HasVerifiedEmail(ctx context.Context, userID int64) (bool, error)
 	HasWebAuthnCredential(ctx context.Context, userID int64) (bool, error)
 	UpdateUserPassword(ctx context.Context, userID int64, passwordHash string) error
+	// ListUsers pages through accounts in ID order. A non-empty query
+	// matches a username or email prefix.
+	ListUsers(ctx context.Context, query string, limit, offset int) ([]models.User, error)
+	SetUserAdmin(ctx context.Context, userID int64, isAdmin bool) error
+	// SetUserSuspended suspends the account, or lifts the suspension when
+	// suspendedAt is nil.
+	SetUserSuspended(ctx context.Context, userID int64, suspendedAt *time.Time) error
+	// DeleteUser deletes the account, handing the issues, pull requests,
+	// comments, reviews and repo credentials it created to successorID.
+	DeleteUser(ctx context.Context, userID, successorID int64) error
 	UpsertUserEntitlement(ctx context.Context, entitlement *models.UserEntitlement) error
 	HasUserEntitlement(ctx context.Context, userID int64, feature string, at time.Time) (bool, error)
 	GetUserEntitlements(ctx context.Context, userID int64) ([]*models.UserEntitlement, error)
@@ -30,8 +40,38 @@ type DB interface {
 	CreateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error
 	ListWebAuthnCredentials(ctx context.Context, userID int64) ([]models.WebAuthnCredential, error)
 	UpdateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error
+	DeleteWebAuthnCredential(ctx context.Context, id, userID int64) error
+	CreateUserSession(ctx context.Context, session *models.UserSession) error
+	GetUserSession(ctx context.Context, id string) (*models.UserSession, error)
+	ListActiveUserSessions(ctx context.Context, userID int64, now time.Time) ([]models.UserSession, error)
+	TouchUserSession(ctx context.Context, id string, seenAt time.Time) error
+	RevokeUserSession(ctx context.Context, id string, userID int64) error
+	RevokeUserSessions(ctx context.Context, userID int64, exceptID string) error
 	CreateWebAuthnSession(ctx context.Context, session *models.WebAuthnSession) error
 	ConsumeWebAuthnSession(ctx context.Context, id, flow string, now time.Time) (*models.WebAuthnSession, error)
+	// UpsertUserTOTP stores a new, unconfirmed TOTP secret, replacing any
+	// earlier enrollment.
+	UpsertUserTOTP(ctx context.Context, totp *models.UserTOTP) error
+	GetUserTOTP(ctx context.Context, userID int64) (*models.UserTOTP, error)
+	ConfirmUserTOTP(ctx context.Context, userID, step int64, confirmedAt time.Time) error
+	// AdvanceUserTOTPStep records step as used, reporting false when it is
+	// not later than the last used step.
+	AdvanceUserTOTPStep(ctx context.Context, userID, step int64) (bool, error)
+	// DeleteUserTOTP removes the enrollment and its recovery codes.
+	DeleteUserTOTP(ctx context.Context, userID int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error
+	// ConsumeRecoveryCode marks an unused code as used, returning
+	// sql.ErrNoRows when there is none matching.
+	ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string, now time.Time) error
+	CountRecoveryCodes(ctx context.Context, userID int64) (int, error)
+	CreateOIDCAuthState(ctx context.Context, state *models.OIDCAuthState) error
+	// ConsumeOIDCAuthState marks an unexpired state as used and returns it;
+	// sql.ErrNoRows when there is none.
+	ConsumeOIDCAuthState(ctx context.Context, state string, now time.Time) (*models.OIDCAuthState, error)
+	CreateUserIdentity(ctx context.Context, identity *models.UserIdentity) error
+	GetUserIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error)
+	ListUserIdentities(ctx context.Context, userID int64) ([]models.UserIdentity, error)
+	TouchUserIdentity(ctx context.Context, id int64, email string, now time.Time) error
 
 	// SSH Keys
 	CreateSSHKey(ctx context.Context, key *models.SSHKey) error
@@ -39,6 +79,40 @@ type DB interface {
 	GetSSHKeyByFingerprint(ctx context.Context, fingerprint string) (*models.SSHKey, error)
 	DeleteSSHKey(ctx context.Context, id, userID int64) error
 
+	// GPG Keys
+	CreateGPGKey(ctx context.Context, key *models.GPGKey) error
+	ListGPGKeys(ctx context.Context, userID int64) ([]models.GPGKey, error)
+	GetGPGKeyByKeyID(ctx context.Context, keyID string) (*models.GPGKey, error)
+	DeleteGPGKey(ctx context.Context, id, userID int64) error
+	CreatePersonalAccessToken(ctx context.Context, token *models.PersonalAccessToken) error
+	ListPersonalAccessTokens(ctx context.Context, userID int64) ([]models.PersonalAccessToken, error)
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error)
+	RevokePersonalAccessToken(ctx context.Context, id, userID int64) error
+	TouchPersonalAccessTokenUsed(ctx context.Context, id int64, usedAt time.Time) error
+
+	// OAuth apps
+	CreateOAuthApp(ctx context.Context, app *models.OAuthApp) error
+	GetOAuthApp(ctx context.Context, id int64) (*models.OAuthApp, error)
+	GetOAuthAppByClientID(ctx context.Context, clientID string) (*models.OAuthApp, error)
+	ListOAuthApps(ctx context.Context, ownerID int64) ([]models.OAuthApp, error)
+	UpdateOAuthApp(ctx context.Context, app *models.OAuthApp) error
+	DeleteOAuthApp(ctx context.Context, id, ownerID int64) error
+	CreateOAuthAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error
+	// ConsumeOAuthAuthorizationCode marks an unused, unexpired code as used
+	// and returns it; sql.ErrNoRows when there is none.
+	ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string, now time.Time) (*models.OAuthAuthorizationCode, error)
+	UpsertOAuthAuthorization(ctx context.Context, auth *models.OAuthAuthorization) error
+	ListOAuthAuthorizations(ctx context.Context, userID int64) ([]models.OAuthAuthorization, error)
+	// DeleteOAuthAuthorization forgets the grant and revokes every token the
+	// app holds for the user.
+	DeleteOAuthAuthorization(ctx context.Context, appID, userID int64) error
+	CreateOAuthToken(ctx context.Context, token *models.OAuthToken) error
+	GetOAuthTokenByAccessHash(ctx context.Context, hash string) (*models.OAuthToken, error)
+	GetOAuthTokenByRefreshHash(ctx context.Context, hash string) (*models.OAuthToken, error)
+	// RevokeOAuthToken reports whether the token was live until this call.
+	RevokeOAuthToken(ctx context.Context, id int64, now time.Time) (bool, error)
+	TouchOAuthTokenUsed(ctx context.Context, id int64, usedAt time.Time) error
+
 	// Repositories
 	CreateRepository(ctx context.Context, repo *models.Repository) error
 	UpdateRepositoryStoragePath(ctx context.Context, id int64, storagePath string) error
@@ -52,6 +126,9 @@ type DB interface {
 	ListRepositoryForksPage(ctx context.Context, parentRepoID int64, limit, offset int) ([]models.Repository, error)
 	ListPublicRepositoriesPage(ctx context.Context, sort string, limit, offset int) ([]models.Repository, error)
 	DeleteRepository(ctx context.Context, id int64) error
+	// TransferRepository moves the repository to a user or an org; exactly
+	// one of ownerUserID and ownerOrgID is set.
+	TransferRepository(ctx context.Context, id int64, ownerUserID, ownerOrgID *int64) error
 
 	// Stars
 	AddRepoStar(ctx context.Context, repoID, userID int64) error
@@ -70,9 +147,25 @@ type DB interface {
 	ListCollaboratorsPage(ctx context.Context, repoID int64, limit, offset int) ([]models.Collaborator, error)
 	RemoveCollaborator(ctx context.Context, repoID, userID int64) error
 
+	// Invitations
+	CreateInvitation(ctx context.Context, inv *models.Invitation) error
+	GetInvitation(ctx context.Context, id int64) (*models.Invitation, error)
+	GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*models.Invitation, error)
+	// The list methods skip invitations that expired before now.
+	ListRepoInvitations(ctx context.Context, repoID int64, now time.Time) ([]models.Invitation, error)
+	ListOrgInvitations(ctx context.Context, orgID int64, now time.Time) ([]models.Invitation, error)
+	ListUserInvitations(ctx context.Context, userID int64, now time.Time) ([]models.Invitation, error)
+	DeleteInvitation(ctx context.Context, id int64) error
+
+	// Audit log. It is append-only: there is no update or delete.
+	CreateAuditEvent(ctx context.Context, e *models.AuditEvent) error
+	// ListAuditEvents returns the events matching filter, newest first.
+	ListAuditEvents(ctx context.Context, filter AuditEventFilter) ([]models.AuditEvent, error)
+
 	// Pull Requests
 	CreatePullRequest(ctx context.Context, pr *models.PullRequest) error
 	GetPullRequest(ctx context.Context, repoID int64, number int) (*models.PullRequest, error)
+	GetPullRequestByID(ctx context.Context, id int64) (*models.PullRequest, error)
 	ListPullRequests(ctx context.Context, repoID int64, state string) ([]models.PullRequest, error)
 	ListPullRequestsPage(ctx context.Context, repoID int64, state string, limit, offset int) ([]models.PullRequest, error)
 	UpdatePullRequest(ctx context.Context, pr *models.PullRequest) error
@@ -102,10 +195,18 @@ type DB interface {
 	DeleteRepoRunnerToken(ctx context.Context, repoID, tokenID int64) error
 	GetRepoRunnerTokenByHash(ctx context.Context, tokenHash string) (*models.RepoRunnerToken, error)
 	TouchRepoRunnerTokenUsed(ctx context.Context, tokenID int64, usedAt time.Time) error
+	CreateRepoDeployKey(ctx context.Context, key *models.RepoDeployKey) error
+	ListRepoDeployKeys(ctx context.Context, repoID int64) ([]models.RepoDeployKey, error)
+	DeleteRepoDeployKey(ctx context.Context, repoID, keyID int64) error
+	GetRepoDeployKeyByID(ctx context.Context, keyID int64) (*models.RepoDeployKey, error)
+	GetRepoDeployKeyByTokenHash(ctx context.Context, tokenHash string) (*models.RepoDeployKey, error)
+	GetRepoDeployKeyByFingerprint(ctx context.Context, fingerprint string) (*models.RepoDeployKey, error)
+	TouchRepoDeployKeyUsed(ctx context.Context, keyID int64, usedAt time.Time) error
 
 	// Issues
 	CreateIssue(ctx context.Context, issue *models.Issue) error
 	GetIssue(ctx context.Context, repoID int64, number int) (*models.Issue, error)
+	GetIssueByID(ctx context.Context, id int64) (*models.Issue, error)
 	ListIssues(ctx context.Context, repoID int64, state string) ([]models.Issue, error)
 	ListIssuesPage(ctx context.Context, repoID int64, state string, limit, offset int) ([]models.Issue, error)
 	UpdateIssue(ctx context.Context, issue *models.Issue) error
@@ -113,25 +214,80 @@ type DB interface {
 	ListIssueComments(ctx context.Context, issueID int64) ([]models.IssueComment, error)
 	ListIssueCommentsPage(ctx context.Context, issueID int64, limit, offset int) ([]models.IssueComment, error)
 	DeleteIssueComment(ctx context.Context, commentID, authorID int64) error
+	UpsertIssueReference(ctx context.Context, ref *models.IssueReference) error
+	ListIssueReferences(ctx context.Context, issueID int64) ([]models.IssueReference, error)
+	ListIssueReferencesPage(ctx context.Context, issueID int64, limit, offset int) ([]models.IssueReference, error)
+	SearchIssues(ctx context.Context, q models.IssueSearchQuery, limit, offset int) ([]models.IssueSearchResult, error)
+	AddIssueEntityLink(ctx context.Context, link *models.IssueEntityLink) error
+	DeleteIssueEntityLink(ctx context.Context, issueID int64, stableID string) error
+	ListIssueEntityLinks(ctx context.Context, issueID int64) ([]models.IssueEntityLink, error)
+	ListOpenIssueEntityLinks(ctx context.Context, repoID int64, stableIDs []string) ([]models.IssueEntityLink, error)
 
 	// Notifications
 	CreateNotification(ctx context.Context, n *models.Notification) error
 	ListNotifications(ctx context.Context, userID int64, unreadOnly bool) ([]models.Notification, error)
-	ListNotificationsPage(ctx context.Context, userID int64, unreadOnly bool, limit, offset int) ([]models.Notification, error)
+	ListNotificationsPage(ctx context.Context, userID int64, unreadOnly bool, reason string, limit, offset int) ([]models.Notification, error)
 	CountUnreadNotifications(ctx context.Context, userID int64) (int, error)
 	MarkNotificationRead(ctx context.Context, id, userID int64) error
 	MarkAllNotificationsRead(ctx context.Context, userID int64) error
+	// DeleteNotificationsForResource withdraws a user's notifications that
+	// link to resourcePath, such as one for an invitation that was resolved.
+	DeleteNotificationsForResource(ctx context.Context, userID int64, resourcePath string) error
+	EnsureThreadSubscription(ctx context.Context, sub *models.ThreadSubscription) error
+	SetThreadSubscription(ctx context.Context, sub *models.ThreadSubscription) error
+	GetThreadSubscription(ctx context.Context, userID int64, threadType string, threadID int64) (*models.ThreadSubscription, error)
+	ListThreadSubscriptions(ctx context.Context, threadType string, threadID int64) ([]models.ThreadSubscription, error)
+	SetRepoWatch(ctx context.Context, w *models.RepoWatch) error
+	GetRepoWatch(ctx context.Context, userID, repoID int64) (*models.RepoWatch, error)
+	DeleteRepoWatch(ctx context.Context, userID, repoID int64) error
+	ListRepoWatches(ctx context.Context, repoID int64) ([]models.RepoWatch, error)
+
+	// Notification digests
+	GetNotificationSettings(ctx context.Context, userID int64) (*models.NotificationSettings, error)
+	UpsertNotificationSettings(ctx context.Context, settings *models.NotificationSettings) error
+	// ListDigestRecipients returns users on the given email frequency whose
+	// last digest, if any, went out before sentBefore.
+	ListDigestRecipients(ctx context.Context, frequency string, sentBefore time.Time) ([]models.NotificationSettings, error)
+	SetNotificationDigestSent(ctx context.Context, userID int64, sentAt time.Time) error
+	// ListUnemailedNotifications returns a user's unread notifications that
+	// have not been emailed, oldest first.
+	ListUnemailedNotifications(ctx context.Context, userID int64, limit int) ([]models.Notification, error)
+	MarkNotificationsEmailed(ctx context.Context, userID int64, ids []int64, emailedAt time.Time) error
+	// CountPRsAwaitingReview counts open pull requests the user was asked to
+	// review and has not reviewed since.
+	CountPRsAwaitingReview(ctx context.Context, userID int64) (int, error)
+	// CountPRsWithFailingChecks counts the user's open pull requests with at
+	// least one failed check run.
+	CountPRsWithFailingChecks(ctx context.Context, userID int64) (int, error)
 
 	// Webhooks
 	CreateWebhook(ctx context.Context, hook *models.Webhook) error
 	GetWebhook(ctx context.Context, repoID, webhookID int64) (*models.Webhook, error)
 	ListWebhooks(ctx context.Context, repoID int64) ([]models.Webhook, error)
 	ListWebhooksPage(ctx context.Context, repoID int64, limit, offset int) ([]models.Webhook, error)
+	UpdateWebhook(ctx context.Context, hook *models.Webhook) error
 	DeleteWebhook(ctx context.Context, repoID, webhookID int64) error
+	RecordWebhookFailure(ctx context.Context, repoID, webhookID int64) (time.Time, error)
+	ClearWebhookFailure(ctx context.Context, repoID, webhookID int64) error
+	DisableWebhook(ctx context.Context, repoID, webhookID int64, reason string) error
 	CreateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
 	GetWebhookDelivery(ctx context.Context, repoID, webhookID, deliveryID int64) (*models.WebhookDelivery, error)
 	ListWebhookDeliveries(ctx context.Context, repoID, webhookID int64) ([]models.WebhookDelivery, error)
 	ListWebhookDeliveriesPage(ctx context.Context, repoID, webhookID int64, limit, offset int) ([]models.WebhookDelivery, error)
+
+	// Org webhooks
+	CreateOrgWebhook(ctx context.Context, hook *models.Webhook) error
+	GetOrgWebhook(ctx context.Context, orgID, webhookID int64) (*models.Webhook, error)
+	ListOrgWebhooks(ctx context.Context, orgID int64) ([]models.Webhook, error)
+	ListOrgWebhooksPage(ctx context.Context, orgID int64, limit, offset int) ([]models.Webhook, error)
+	UpdateOrgWebhook(ctx context.Context, hook *models.Webhook) error
+	DeleteOrgWebhook(ctx context.Context, orgID, webhookID int64) error
+	RecordOrgWebhookFailure(ctx context.Context, orgID, webhookID int64) (time.Time, error)
+	ClearOrgWebhookFailure(ctx context.Context, orgID, webhookID int64) error
+	DisableOrgWebhook(ctx context.Context, orgID, webhookID int64, reason string) error
+	CreateOrgWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	GetOrgWebhookDelivery(ctx context.Context, orgID, webhookID, deliveryID int64) (*models.WebhookDelivery, error)
+	ListOrgWebhookDeliveriesPage(ctx context.Context, orgID, webhookID int64, limit, offset int) ([]models.WebhookDelivery, error)
 	CreateInterestSignup(ctx context.Context, signup *models.InterestSignup) error
 	ListInterestSignupsPage(ctx context.Context, limit, offset int) ([]models.InterestSignup, error)
 
@@ -144,8 +300,11 @@ type DB interface {
 	GetCommitMetadata(ctx context.Context, repoID int64, commitHash string) (*models.CommitMetadata, bool, error)
 	SetMergeBaseCache(ctx context.Context, repoID int64, leftHash, rightHash, baseHash string) error
 	GetMergeBaseCache(ctx context.Context, repoID int64, leftHash, rightHash string) (string, bool, error)
+	UpsertCommitVerification(ctx context.Context, v *models.CommitVerification) error
+	GetCommitVerification(ctx context.Context, repoID int64, commitHash string) (*models.CommitVerification, error)
+	DeleteCommitVerificationsByKeyIDs(ctx context.Context, keyIDs []string) error
 	EnqueueIndexingJob(ctx context.Context, job *models.IndexingJob) error
-	ClaimIndexingJob(ctx context.Context) (*models.IndexingJob, error)
+	ClaimIndexingJob(ctx context.Context, jobType models.IndexJobType, perKeyLimit int) (*models.IndexingJob, error)
 	CompleteIndexingJob(ctx context.Context, jobID int64, status models.IndexJobStatus, errMsg string) error
 	RequeueIndexingJob(ctx context.Context, jobID int64, errMsg string, nextAttemptAt time.Time) error
 	GetIndexingJobStatus(ctx context.Context, repoID int64, commitHash string) (*models.IndexingJob, error)
@@ -154,6 +313,7 @@ type DB interface {
 	SetGitTreeEntryModes(ctx context.Context, repoID int64, gotTreeHash string, modes map[string]string) error
 	GetGitTreeEntryModes(ctx context.Context, repoID int64, gotTreeHash string) (map[string]string, error)
 	UpsertEntityIdentity(ctx context.Context, identity *models.EntityIdentity) error
+	GetEntityIdentity(ctx context.Context, repoID int64, stableID string) (*models.EntityIdentity, error)
 	SetEntityVersion(ctx context.Context, version *models.EntityVersion) error
 	ListEntityVersionsByCommit(ctx context.Context, repoID int64, commitHash string) ([]models.EntityVersion, error)
 	CountEntityVersionsByCommitFiltered(ctx context.Context, repoID int64, commitHash, stableID, name, bodyHash string) (int, error)
@@ -170,6 +330,19 @@ type DB interface {
 	ListXRefEdgesFrom(ctx context.Context, repoID int64, commitHash, sourceEntityID, kind string) ([]models.XRefEdge, error)
 	ListXRefEdgesTo(ctx context.Context, repoID int64, commitHash, targetEntityID, kind string) ([]models.XRefEdge, error)
 
+	// Outbound email queue
+	EnqueueOutboundEmail(ctx context.Context, email *models.OutboundEmail) error
+	// ClaimOutboundEmail marks the next due email as sending until
+	// leaseUntil, after which it may be claimed again if never completed.
+	ClaimOutboundEmail(ctx context.Context, now, leaseUntil time.Time) (*models.OutboundEmail, error)
+	// CompleteOutboundEmail records a terminal status and clears the stored
+	// message, which may carry sign-in or invitation tokens.
+	CompleteOutboundEmail(ctx context.Context, id int64, status models.OutboundEmailStatus, errMsg string) error
+	RequeueOutboundEmail(ctx context.Context, id int64, errMsg string, nextAttemptAt time.Time) error
+	// ListQueueStats summarizes each background queue: indexing jobs by job
+	// type, then outbound email.
+	ListQueueStats(ctx context.Context) ([]QueueStats, error)
+
 	// Organizations
 	CreateOrg(ctx context.Context, o *models.Org) error
 	GetOrg(ctx context.Context, name string) (*models.Org, error)
@@ -177,11 +350,47 @@ type DB interface {
 	ListUserOrgs(ctx context.Context, userID int64) ([]models.Org, error)
 	ListUserOrgsPage(ctx context.Context, userID int64, limit, offset int) ([]models.Org, error)
 	DeleteOrg(ctx context.Context, id int64) error
+	SetOrgRequireTwoFactor(ctx context.Context, orgID int64, require bool) error
+	SetOrgDefaultRepoPermission(ctx context.Context, orgID int64, permission string) error
 	AddOrgMember(ctx context.Context, m *models.OrgMember) error
 	GetOrgMember(ctx context.Context, orgID, userID int64) (*models.OrgMember, error)
 	ListOrgMembers(ctx context.Context, orgID int64) ([]models.OrgMember, error)
 	ListOrgMembersPage(ctx context.Context, orgID int64, limit, offset int) ([]models.OrgMember, error)
+	// RemoveOrgMember also drops the user from the org's teams.
 	RemoveOrgMember(ctx context.Context, orgID, userID int64) error
 	ListOrgRepositories(ctx context.Context, orgID int64) ([]models.Repository, error)
 	ListOrgRepositoriesPage(ctx context.Context, orgID int64, limit, offset int) ([]models.Repository, error)
+
+	// Teams
+	CreateTeam(ctx context.Context, t *models.Team) error
+	GetTeam(ctx context.Context, orgID int64, name string) (*models.Team, error)
+	GetTeamByID(ctx context.Context, id int64) (*models.Team, error)
+	ListTeams(ctx context.Context, orgID int64) ([]models.Team, error)
+	UpdateTeam(ctx context.Context, t *models.Team) error
+	// DeleteTeam moves the team's children up to its parent.
+	DeleteTeam(ctx context.Context, orgID, id int64) error
+	AddTeamMember(ctx context.Context, teamID, userID int64) error
+	RemoveTeamMember(ctx context.Context, teamID, userID int64) error
+	ListTeamMembers(ctx context.Context, teamID int64) ([]models.TeamMember, error)
+	// ListNestedTeamMembers lists the distinct members of a team and all of
+	// its descendants.
+	ListNestedTeamMembers(ctx context.Context, teamID int64) ([]models.TeamMember, error)
+	SetTeamRepo(ctx context.Context, tr *models.TeamRepo) error
+	RemoveTeamRepo(ctx context.Context, teamID, repoID int64) error
+	ListTeamRepos(ctx context.Context, teamID int64) ([]models.TeamRepo, error)
+	// ListUserTeamRepoPermissions returns the permissions granted on a repo
+	// to the teams a user belongs to, directly or through a child team.
+	ListUserTeamRepoPermissions(ctx context.Context, repoID, userID int64) ([]string, error)
+}
+
+// AuditEventFilter selects audit events. Zero fields match everything.
+type AuditEventFilter struct {
+	RepoID *int64
+	OrgID  *int64
+	// BeforeID pages backwards: only events with a smaller ID match.
+	BeforeID int64
+	// AfterID skips events up to and including this ID, for incremental
+	// exports.
+	AfterID int64
+	Limit   int
 }
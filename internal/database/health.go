@@ -9,3 +9,12 @@ type IndexingQueueStats struct {
 	Failed         int64
 	OldestQueuedAt *time.Time
 }
+
+// QueueStats summarizes one background job queue for site admins.
+type QueueStats struct {
+	Queue          string     `json:"queue"`
+	Queued         int64      `json:"queued"`
+	InProgress     int64      `json:"in_progress"`
+	Failed         int64      `json:"failed"`
+	OldestQueuedAt *time.Time `json:"oldest_queued_at,omitempty"`
+}
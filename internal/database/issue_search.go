@@ -0,0 +1,77 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+// issueSearchFields lists the searchable text columns in index order.
+var issueSearchFields = []string{"title", "body", "comments"}
+
+// issueSearchSelectedFields returns the requested fields in index order,
+// defaulting to all of them.
+func issueSearchSelectedFields(q models.IssueSearchQuery) []string {
+	if len(q.Fields) == 0 {
+		return issueSearchFields
+	}
+	var fields []string
+	for _, field := range issueSearchFields {
+		for _, want := range q.Fields {
+			if want == field {
+				fields = append(fields, field)
+				break
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return issueSearchFields
+	}
+	return fields
+}
+
+// issueSearchStateClause filters column by a search state. Closed pull
+// requests include merged ones.
+func issueSearchStateClause(column, state string) string {
+	switch state {
+	case models.IssueStateOpen:
+		return " AND " + column + " = 'open'"
+	case models.IssueStateClosed:
+		return " AND " + column + " IN ('closed', 'merged')"
+	case models.PullRequestStateMerged:
+		return " AND " + column + " = 'merged'"
+	}
+	return ""
+}
+
+// issueSearchOrderBy builds the ORDER BY clause for the union aliased t.
+// bestOrder ranks by relevance and is only used when the query has terms.
+func issueSearchOrderBy(q models.IssueSearchQuery, bestOrder string) string {
+	dir := "DESC"
+	if q.Ascending {
+		dir = "ASC"
+	}
+	switch {
+	case q.Sort == models.IssueSearchSortBest && len(q.Terms) > 0:
+		return " ORDER BY " + bestOrder + ", t.updated_at DESC, t.id DESC"
+	case q.Sort == models.IssueSearchSortUpdated:
+		return " ORDER BY t.updated_at " + dir + ", t.id " + dir
+	case q.Sort == models.IssueSearchSortComments:
+		return " ORDER BY t.comment_count " + dir + ", t.created_at " + dir + ", t.id " + dir
+	}
+	return " ORDER BY t.created_at " + dir + ", t.id " + dir
+}
+
+// sqliteIssueSearchMatch renders query terms as an FTS5 expression in which
+// every term must match as a phrase, optionally restricted to columns.
+func sqliteIssueSearchMatch(q models.IssueSearchQuery) string {
+	phrases := make([]string, 0, len(q.Terms))
+	for _, term := range q.Terms {
+		phrases = append(phrases, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+	}
+	expr := strings.Join(phrases, " AND ")
+	if len(q.Fields) > 0 {
+		expr = "{" + strings.Join(issueSearchSelectedFields(q), " ") + "} : (" + expr + ")"
+	}
+	return expr
+}
@@ -86,8 +86,134 @@ func (p *PostgresDB) Migrate(ctx context.Context) error {
 	if _, err := p.db.ExecContext(ctx, `ALTER TABLE branch_protection_rules ADD COLUMN IF NOT EXISTS require_no_new_dead_code BOOLEAN NOT NULL DEFAULT FALSE`); err != nil {
 		return err
 	}
-	_, err := p.db.ExecContext(ctx, `ALTER TABLE branch_protection_rules ADD COLUMN IF NOT EXISTS require_signed_commits BOOLEAN NOT NULL DEFAULT FALSE`)
-	return err
+	if _, err := p.db.ExecContext(ctx, `ALTER TABLE branch_protection_rules ADD COLUMN IF NOT EXISTS require_signed_commits BOOLEAN NOT NULL DEFAULT FALSE`); err != nil {
+		return err
+	}
+	for _, table := range []string{"issues", "pull_requests"} {
+		stmts := []string{
+			`ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ`,
+			`UPDATE ` + table + ` SET updated_at = created_at WHERE updated_at IS NULL`,
+			`ALTER TABLE ` + table + ` ALTER COLUMN updated_at SET DEFAULT NOW()`,
+			`ALTER TABLE ` + table + ` ALTER COLUMN updated_at SET NOT NULL`,
+		}
+		for _, stmt := range stmts {
+			if _, err := p.db.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := p.db.ExecContext(ctx, `ALTER TABLE notifications ADD COLUMN IF NOT EXISTS reason TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if _, err := p.db.ExecContext(ctx, `ALTER TABLE notifications ADD COLUMN IF NOT EXISTS emailed_at TIMESTAMPTZ`); err != nil {
+		return err
+	}
+	if _, err := p.db.ExecContext(ctx, `ALTER TABLE orgs ADD COLUMN IF NOT EXISTS require_two_factor BOOLEAN NOT NULL DEFAULT FALSE`); err != nil {
+		return err
+	}
+	if _, err := p.db.ExecContext(ctx, `ALTER TABLE orgs ADD COLUMN IF NOT EXISTS default_repo_permission TEXT NOT NULL DEFAULT 'write'`); err != nil {
+		return err
+	}
+	for _, stmt := range []string{
+		`ALTER TABLE indexing_jobs ADD COLUMN IF NOT EXISTS concurrency_key TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE indexing_jobs ADD COLUMN IF NOT EXISTS payload TEXT NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS idx_indexing_jobs_concurrency ON indexing_jobs(job_type, concurrency_key, status, id)`,
+		`ALTER TABLE indexing_jobs DROP CONSTRAINT IF EXISTS indexing_jobs_repo_id_fkey`,
+		`CREATE OR REPLACE FUNCTION gothub_repositories_drop_indexing_jobs()
+		 RETURNS TRIGGER
+		 LANGUAGE plpgsql
+		 AS $$
+		 BEGIN
+			DELETE FROM indexing_jobs WHERE repo_id = OLD.id AND job_type <> 'webhook_delivery';
+			RETURN OLD;
+		 END
+		 $$`,
+		`DROP TRIGGER IF EXISTS repositories_drop_indexing_jobs ON repositories`,
+		`CREATE TRIGGER repositories_drop_indexing_jobs AFTER DELETE ON repositories
+			FOR EACH ROW EXECUTE FUNCTION gothub_repositories_drop_indexing_jobs()`,
+		`ALTER TABLE repo_webhooks ADD COLUMN IF NOT EXISTS failing_since TIMESTAMPTZ`,
+		`ALTER TABLE repo_webhooks ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ`,
+		`ALTER TABLE repo_webhooks ADD COLUMN IF NOT EXISTS disabled_reason TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE repo_webhooks ADD COLUMN IF NOT EXISTS previous_secret TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE repo_webhooks ADD COLUMN IF NOT EXISTS previous_secret_expires_at TIMESTAMPTZ`,
+		`ALTER TABLE repo_webhooks ADD COLUMN IF NOT EXISTS timestamped_signature BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE org_webhooks ADD COLUMN IF NOT EXISTS previous_secret TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE org_webhooks ADD COLUMN IF NOT EXISTS previous_secret_expires_at TIMESTAMPTZ`,
+		`ALTER TABLE org_webhooks ADD COLUMN IF NOT EXISTS timestamped_signature BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMPTZ`,
+		// Delivered and failed messages may carry sign-in or invitation tokens.
+		`UPDATE outbound_emails SET message = '' WHERE status IN ('sent', 'failed') AND message <> ''`,
+	} {
+		if _, err := p.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return p.migrateIssueSearchVectors(ctx)
+}
+
+// migrateIssueSearchVectors maintains search_vector on issues and pull
+// requests from their title, body and comments, weighted A, B and C.
+// Triggers recompute it when any of those are written, so SearchIssues
+// matches through a GIN index instead of building documents per query.
+func (p *PostgresDB) migrateIssueSearchVectors(ctx context.Context) error {
+	for _, t := range []struct{ table, comments, key string }{
+		{"issues", "issue_comments", "issue_id"},
+		{"pull_requests", "pr_comments", "pr_id"},
+	} {
+		document := `gothub_` + t.table + `_search_document`
+		stmts := []string{
+			`ALTER TABLE ` + t.table + ` ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+			`CREATE OR REPLACE FUNCTION ` + document + `(row_id BIGINT, doc_title TEXT, doc_body TEXT)
+			 RETURNS tsvector
+			 LANGUAGE sql
+			 STABLE
+			 AS $$
+				SELECT setweight(to_tsvector('english', doc_title), 'A')
+					|| setweight(to_tsvector('english', doc_body), 'B')
+					|| setweight(to_tsvector('english', COALESCE((SELECT string_agg(c.body, ' ' ORDER BY c.id) FROM ` + t.comments + ` c WHERE c.` + t.key + ` = row_id), '')), 'C')
+			 $$`,
+			`CREATE OR REPLACE FUNCTION gothub_` + t.table + `_search_vector()
+			 RETURNS TRIGGER
+			 LANGUAGE plpgsql
+			 AS $$
+			 BEGIN
+				NEW.search_vector := ` + document + `(NEW.id, NEW.title, NEW.body);
+				RETURN NEW;
+			 END
+			 $$`,
+			`DROP TRIGGER IF EXISTS ` + t.table + `_search_vector ON ` + t.table,
+			`CREATE TRIGGER ` + t.table + `_search_vector BEFORE INSERT OR UPDATE OF title, body ON ` + t.table + `
+				FOR EACH ROW EXECUTE FUNCTION gothub_` + t.table + `_search_vector()`,
+			`CREATE OR REPLACE FUNCTION gothub_` + t.comments + `_search_vector()
+			 RETURNS TRIGGER
+			 LANGUAGE plpgsql
+			 AS $$
+			 DECLARE
+				parent_id BIGINT;
+			 BEGIN
+				IF TG_OP = 'DELETE' THEN
+					parent_id := OLD.` + t.key + `;
+				ELSE
+					parent_id := NEW.` + t.key + `;
+				END IF;
+				UPDATE ` + t.table + ` SET search_vector = ` + document + `(id, title, body) WHERE id = parent_id;
+				RETURN NULL;
+			 END
+			 $$`,
+			`DROP TRIGGER IF EXISTS ` + t.comments + `_search_vector ON ` + t.comments,
+			`CREATE TRIGGER ` + t.comments + `_search_vector AFTER INSERT OR UPDATE OF body OR DELETE ON ` + t.comments + `
+				FOR EACH ROW EXECUTE FUNCTION gothub_` + t.comments + `_search_vector()`,
+			// Only rows written before the triggers existed are still NULL.
+			`UPDATE ` + t.table + ` SET search_vector = ` + document + `(id, title, body) WHERE search_vector IS NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_` + t.table + `_search_vector ON ` + t.table + ` USING GIN (search_vector)`,
+		}
+		for _, stmt := range stmts {
+			if _, err := p.db.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 func (p *PostgresDB) migrateTenancySchema(ctx context.Context) error {
@@ -103,6 +229,7 @@ func (p *PostgresDB) migrateTenancySchema(ctx context.Context) error {
 		`ALTER TABLE repo_webhooks ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), 'default')`,
 		`ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), 'default')`,
 		`ALTER TABLE repo_runner_tokens ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), 'default')`,
+		`ALTER TABLE repo_deploy_keys ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), 'default')`,
 		`ALTER TABLE interest_signups ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), 'default')`,
 		`ALTER TABLE user_entitlements ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), 'default')`,
 		`CREATE INDEX IF NOT EXISTS idx_users_tenant_username ON users(tenant_id, username)`,
@@ -118,6 +245,8 @@ func (p *PostgresDB) migrateTenancySchema(ctx context.Context) error {
 		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_tenant_repo_webhook_time ON webhook_deliveries(tenant_id, repo_id, webhook_id, created_at DESC)`,
 		`CREATE INDEX IF NOT EXISTS idx_repo_runner_tokens_tenant_repo_active ON repo_runner_tokens(tenant_id, repo_id, revoked_at, created_at DESC)`,
 		`CREATE INDEX IF NOT EXISTS idx_repo_runner_tokens_tenant_hash ON repo_runner_tokens(tenant_id, token_hash)`,
+		`CREATE INDEX IF NOT EXISTS idx_repo_deploy_keys_tenant_repo_active ON repo_deploy_keys(tenant_id, repo_id, revoked_at, created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_repo_deploy_keys_tenant_lookup ON repo_deploy_keys(tenant_id, token_hash, fingerprint)`,
 		`CREATE INDEX IF NOT EXISTS idx_interest_signups_tenant_created ON interest_signups(tenant_id, created_at DESC)`,
 		`CREATE INDEX IF NOT EXISTS idx_user_entitlements_tenant_user_feature ON user_entitlements(tenant_id, user_id, feature)`,
 		`CREATE INDEX IF NOT EXISTS idx_user_entitlements_tenant_feature_active ON user_entitlements(tenant_id, feature, active, expires_at)`,
@@ -146,6 +275,7 @@ CREATE TABLE IF NOT EXISTS users (
 	email TEXT NOT NULL UNIQUE,
 	password_hash TEXT NOT NULL,
 	is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+	suspended_at TIMESTAMPTZ,
 	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
@@ -159,6 +289,95 @@ CREATE TABLE IF NOT EXISTS ssh_keys (
 	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+CREATE TABLE IF NOT EXISTS gpg_keys (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	key_id TEXT NOT NULL UNIQUE,
+	fingerprint TEXT NOT NULL,
+	public_key TEXT NOT NULL,
+	emails_csv TEXT NOT NULL DEFAULT '',
+	expires_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	token_prefix TEXT NOT NULL,
+	scopes_csv TEXT NOT NULL,
+	repo_ids_csv TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_used_at TIMESTAMPTZ,
+	expires_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS gpg_subkeys (
+	id BIGSERIAL PRIMARY KEY,
+	gpg_key_id BIGINT NOT NULL REFERENCES gpg_keys(id) ON DELETE CASCADE,
+	key_id TEXT NOT NULL UNIQUE,
+	fingerprint TEXT NOT NULL,
+	expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_gpg_keys_user ON gpg_keys(user_id);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user ON personal_access_tokens(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_gpg_subkeys_key ON gpg_subkeys(gpg_key_id);
+
+CREATE TABLE IF NOT EXISTS oauth_apps (
+	id BIGSERIAL PRIMARY KEY,
+	owner_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	homepage_url TEXT NOT NULL DEFAULT '',
+	client_id TEXT NOT NULL UNIQUE,
+	client_secret_hash TEXT NOT NULL,
+	redirect_uris_csv TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_oauth_apps_owner ON oauth_apps(owner_id);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+	id BIGSERIAL PRIMARY KEY,
+	app_id BIGINT NOT NULL REFERENCES oauth_apps(id) ON DELETE CASCADE,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL UNIQUE,
+	redirect_uri TEXT NOT NULL,
+	scopes_csv TEXT NOT NULL,
+	code_challenge TEXT NOT NULL DEFAULT '',
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorizations (
+	app_id BIGINT NOT NULL REFERENCES oauth_apps(id) ON DELETE CASCADE,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	scopes_csv TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_used_at TIMESTAMPTZ,
+	PRIMARY KEY (app_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_oauth_authorizations_user ON oauth_authorizations(user_id);
+
+CREATE TABLE IF NOT EXISTS oauth_tokens (
+	id BIGSERIAL PRIMARY KEY,
+	app_id BIGINT NOT NULL REFERENCES oauth_apps(id) ON DELETE CASCADE,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	access_token_hash TEXT NOT NULL UNIQUE,
+	refresh_token_hash TEXT NOT NULL UNIQUE,
+	scopes_csv TEXT NOT NULL,
+	access_expires_at TIMESTAMPTZ NOT NULL,
+	refresh_expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_used_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_oauth_tokens_app_user ON oauth_tokens(app_id, user_id);
+
 CREATE TABLE IF NOT EXISTS magic_link_tokens (
 	id BIGSERIAL PRIMARY KEY,
 	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -187,6 +406,17 @@ CREATE TABLE IF NOT EXISTS webauthn_credentials (
 	last_used_at TIMESTAMPTZ
 );
 
+CREATE TABLE IF NOT EXISTS user_sessions (
+	id TEXT PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip_address TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ
+);
+
 CREATE TABLE IF NOT EXISTS webauthn_sessions (
 	id TEXT PRIMARY KEY,
 	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -197,10 +427,51 @@ CREATE TABLE IF NOT EXISTS webauthn_sessions (
 	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+CREATE TABLE IF NOT EXISTS user_totp (
+	user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	secret TEXT NOT NULL,
+	last_used_step BIGINT NOT NULL DEFAULT 0,
+	confirmed_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL,
+	used_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user ON user_recovery_codes(user_id, code_hash);
+
+CREATE TABLE IF NOT EXISTS oidc_auth_states (
+	state TEXT PRIMARY KEY,
+	provider TEXT NOT NULL,
+	code_verifier TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	email TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_login_at TIMESTAMPTZ,
+	UNIQUE(provider, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);
+
 CREATE TABLE IF NOT EXISTS orgs (
 	id BIGSERIAL PRIMARY KEY,
 	name TEXT NOT NULL UNIQUE,
-	display_name TEXT NOT NULL DEFAULT ''
+	display_name TEXT NOT NULL DEFAULT '',
+	require_two_factor BOOLEAN NOT NULL DEFAULT FALSE,
+	default_repo_permission TEXT NOT NULL DEFAULT 'write'
 );
 
 CREATE TABLE IF NOT EXISTS org_members (
@@ -231,6 +502,77 @@ CREATE TABLE IF NOT EXISTS collaborators (
 	PRIMARY KEY (repo_id, user_id)
 );
 
+CREATE TABLE IF NOT EXISTS invitations (
+	id BIGSERIAL PRIMARY KEY,
+	repo_id BIGINT REFERENCES repositories(id) ON DELETE CASCADE,
+	org_id BIGINT REFERENCES orgs(id) ON DELETE CASCADE,
+	inviter_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	invitee_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+	email TEXT NOT NULL DEFAULT '',
+	role TEXT NOT NULL,
+	token_hash TEXT NOT NULL DEFAULT '',
+	expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_invitations_repo ON invitations(repo_id);
+CREATE INDEX IF NOT EXISTS idx_invitations_org ON invitations(org_id);
+CREATE INDEX IF NOT EXISTS idx_invitations_invitee ON invitations(invitee_id);
+CREATE INDEX IF NOT EXISTS idx_invitations_token ON invitations(token_hash);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+	id BIGSERIAL PRIMARY KEY,
+	actor_id BIGINT,
+	actor_name TEXT NOT NULL DEFAULT '',
+	action TEXT NOT NULL,
+	target TEXT NOT NULL DEFAULT '',
+	repo_id BIGINT,
+	org_id BIGINT,
+	ip TEXT NOT NULL DEFAULT '',
+	request_id TEXT NOT NULL DEFAULT '',
+	before_json TEXT NOT NULL DEFAULT '',
+	after_json TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_repo ON audit_events(repo_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_org ON audit_events(org_id, id);
+CREATE OR REPLACE FUNCTION gothub_audit_events_append_only()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END
+$$;
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+	FOR EACH ROW EXECUTE FUNCTION gothub_audit_events_append_only();
+
+CREATE TABLE IF NOT EXISTS teams (
+	id BIGSERIAL PRIMARY KEY,
+	org_id BIGINT NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+	parent_id BIGINT REFERENCES teams(id) ON DELETE SET NULL,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE(org_id, name)
+);
+CREATE INDEX IF NOT EXISTS idx_teams_parent ON teams(parent_id);
+
+CREATE TABLE IF NOT EXISTS team_members (
+	team_id BIGINT NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (team_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_team_members_user ON team_members(user_id);
+
+CREATE TABLE IF NOT EXISTS team_repos (
+	team_id BIGINT NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+	repo_id BIGINT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	permission TEXT NOT NULL DEFAULT 'read',
+	PRIMARY KEY (team_id, repo_id)
+);
+CREATE INDEX IF NOT EXISTS idx_team_repos_repo ON team_repos(repo_id);
+
 CREATE TABLE IF NOT EXISTS repo_stars (
 	repo_id BIGINT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
 	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -253,7 +595,9 @@ CREATE TABLE IF NOT EXISTS pull_requests (
 	merge_commit TEXT NOT NULL DEFAULT '',
 	merge_method TEXT NOT NULL DEFAULT '',
 	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
 	merged_at TIMESTAMPTZ,
+	search_vector tsvector,
 	tenant_id TEXT NOT NULL DEFAULT COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), 'default'),
 	UNIQUE(repo_id, number)
 );
@@ -292,7 +636,9 @@ CREATE TABLE IF NOT EXISTS issues (
 	state TEXT NOT NULL DEFAULT 'open',
 	author_id BIGINT NOT NULL REFERENCES users(id),
 	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
 	closed_at TIMESTAMPTZ,
+	search_vector tsvector,
 	tenant_id TEXT NOT NULL DEFAULT COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), 'default'),
 	UNIQUE(repo_id, number)
 );
@@ -306,6 +652,30 @@ CREATE TABLE IF NOT EXISTS issue_comments (
 	tenant_id TEXT NOT NULL DEFAULT COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), 'default')
 );
 
+CREATE TABLE IF NOT EXISTS issue_references (
+	id BIGSERIAL PRIMARY KEY,
+	repo_id BIGINT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	issue_id BIGINT NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+	source_type TEXT NOT NULL,
+	source_id BIGINT NOT NULL DEFAULT 0,
+	source_number INTEGER NOT NULL DEFAULT 0,
+	commit_hash TEXT NOT NULL DEFAULT '',
+	actor_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	closing BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE(issue_id, source_type, source_id, commit_hash)
+);
+
+CREATE TABLE IF NOT EXISTS issue_entity_links (
+	id BIGSERIAL PRIMARY KEY,
+	repo_id BIGINT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	issue_id BIGINT NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+	stable_id TEXT NOT NULL,
+	creator_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE(issue_id, stable_id)
+);
+
 CREATE TABLE IF NOT EXISTS notifications (
 	id BIGSERIAL PRIMARY KEY,
 	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -317,10 +687,41 @@ CREATE TABLE IF NOT EXISTS notifications (
 	repo_id BIGINT REFERENCES repositories(id) ON DELETE CASCADE,
 	pr_id BIGINT REFERENCES pull_requests(id) ON DELETE CASCADE,
 	issue_id BIGINT REFERENCES issues(id) ON DELETE CASCADE,
+	reason TEXT NOT NULL DEFAULT '',
 	read_at TIMESTAMPTZ,
+	emailed_at TIMESTAMPTZ,
 	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+CREATE TABLE IF NOT EXISTS notification_settings (
+	user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	email_frequency TEXT NOT NULL DEFAULT 'instant',
+	last_digest_at TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS thread_subscriptions (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	repo_id BIGINT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	thread_type TEXT NOT NULL,
+	thread_id BIGINT NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	subscribed BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE(user_id, thread_type, thread_id)
+);
+
+CREATE TABLE IF NOT EXISTS repo_watches (
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	repo_id BIGINT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	level TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (user_id, repo_id)
+);
+
 CREATE TABLE IF NOT EXISTS branch_protection_rules (
 	id BIGSERIAL PRIMARY KEY,
 	repo_id BIGINT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
@@ -367,6 +768,25 @@ CREATE TABLE IF NOT EXISTS repo_runner_tokens (
 	tenant_id TEXT NOT NULL DEFAULT COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), 'default')
 );
 
+CREATE TABLE IF NOT EXISTS repo_deploy_keys (
+	id BIGSERIAL PRIMARY KEY,
+	repo_id BIGINT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	read_only BOOLEAN NOT NULL DEFAULT TRUE,
+	fingerprint TEXT NOT NULL DEFAULT '',
+	public_key TEXT NOT NULL DEFAULT '',
+	key_type TEXT NOT NULL DEFAULT '',
+	token_hash TEXT NOT NULL DEFAULT '',
+	token_prefix TEXT NOT NULL DEFAULT '',
+	created_by_user_id BIGINT NOT NULL REFERENCES users(id),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_used_at TIMESTAMPTZ,
+	expires_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ,
+	tenant_id TEXT NOT NULL DEFAULT COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), 'default')
+);
+
 CREATE TABLE IF NOT EXISTS repo_webhooks (
 	id BIGSERIAL PRIMARY KEY,
 	repo_id BIGINT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
@@ -374,6 +794,12 @@ CREATE TABLE IF NOT EXISTS repo_webhooks (
 	secret TEXT NOT NULL DEFAULT '',
 	events_csv TEXT NOT NULL DEFAULT '*',
 	active BOOLEAN NOT NULL DEFAULT TRUE,
+	failing_since TIMESTAMPTZ,
+	disabled_at TIMESTAMPTZ,
+	disabled_reason TEXT NOT NULL DEFAULT '',
+	previous_secret TEXT NOT NULL DEFAULT '',
+	previous_secret_expires_at TIMESTAMPTZ,
+	timestamped_signature BOOLEAN NOT NULL DEFAULT FALSE,
 	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
 	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
@@ -395,6 +821,43 @@ CREATE TABLE IF NOT EXISTS webhook_deliveries (
 	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+CREATE TABLE IF NOT EXISTS org_webhooks (
+	id BIGSERIAL PRIMARY KEY,
+	org_id BIGINT NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL DEFAULT '',
+	events_csv TEXT NOT NULL DEFAULT '*',
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	failing_since TIMESTAMPTZ,
+	disabled_at TIMESTAMPTZ,
+	disabled_reason TEXT NOT NULL DEFAULT '',
+	previous_secret TEXT NOT NULL DEFAULT '',
+	previous_secret_expires_at TIMESTAMPTZ,
+	timestamped_signature BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	tenant_id TEXT NOT NULL DEFAULT COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), 'default')
+);
+
+CREATE TABLE IF NOT EXISTS org_webhook_deliveries (
+	id BIGSERIAL PRIMARY KEY,
+	org_id BIGINT NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+	webhook_id BIGINT NOT NULL REFERENCES org_webhooks(id) ON DELETE CASCADE,
+	repo_id BIGINT NOT NULL DEFAULT 0,
+	event TEXT NOT NULL,
+	delivery_uid TEXT NOT NULL,
+	attempt INTEGER NOT NULL DEFAULT 1,
+	status_code INTEGER NOT NULL DEFAULT 0,
+	success BOOLEAN NOT NULL DEFAULT FALSE,
+	error TEXT NOT NULL DEFAULT '',
+	request_body TEXT NOT NULL DEFAULT '',
+	response_body TEXT NOT NULL DEFAULT '',
+	duration_ms BIGINT NOT NULL DEFAULT 0,
+	redelivery_of_id BIGINT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	tenant_id TEXT NOT NULL DEFAULT COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), 'default')
+);
+
 CREATE TABLE IF NOT EXISTS interest_signups (
 	id BIGSERIAL PRIMARY KEY,
 	email TEXT NOT NULL,
@@ -450,11 +913,28 @@ CREATE TABLE IF NOT EXISTS merge_base_cache (
 	PRIMARY KEY (repo_id, left_hash, right_hash)
 );
 
+CREATE TABLE IF NOT EXISTS commit_verifications (
+	repo_id BIGINT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	commit_hash TEXT NOT NULL,
+	status TEXT NOT NULL,
+	signature_type TEXT NOT NULL DEFAULT '',
+	key_id TEXT NOT NULL DEFAULT '',
+	fingerprint TEXT NOT NULL DEFAULT '',
+	signer_user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+	signed_by_server BOOLEAN NOT NULL DEFAULT FALSE,
+	verified_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (repo_id, commit_hash)
+);
+
+-- repo_id is not a foreign key: webhook deliveries outlive the repository,
+-- and repositories_drop_indexing_jobs removes every other job with it.
 CREATE TABLE IF NOT EXISTS indexing_jobs (
 	id BIGSERIAL PRIMARY KEY,
-	repo_id BIGINT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	repo_id BIGINT NOT NULL,
 	commit_hash TEXT NOT NULL,
 	job_type TEXT NOT NULL DEFAULT 'commit_index',
+	concurrency_key TEXT NOT NULL DEFAULT '',
+	payload TEXT NOT NULL DEFAULT '',
 	status TEXT NOT NULL DEFAULT 'queued',
 	attempt_count INTEGER NOT NULL DEFAULT 0,
 	max_attempts INTEGER NOT NULL DEFAULT 3,
@@ -467,6 +947,21 @@ CREATE TABLE IF NOT EXISTS indexing_jobs (
 	UNIQUE (repo_id, commit_hash, job_type)
 );
 
+CREATE TABLE IF NOT EXISTS outbound_emails (
+	id BIGSERIAL PRIMARY KEY,
+	recipient TEXT NOT NULL,
+	subject TEXT NOT NULL DEFAULT '',
+	message TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'queued',
+	attempt_count INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL DEFAULT 8,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	sent_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_outbound_emails_due ON outbound_emails(status, next_attempt_at);
+
 CREATE TABLE IF NOT EXISTS commit_indexes (
 	repo_id BIGINT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
 	commit_hash TEXT NOT NULL,
@@ -575,11 +1070,13 @@ CREATE INDEX IF NOT EXISTS idx_hash_mapping_git ON hash_mapping(repo_id, git_has
 CREATE INDEX IF NOT EXISTS idx_hash_mapping_got ON hash_mapping(repo_id, got_hash);
 CREATE INDEX IF NOT EXISTS idx_commit_metadata_repo_generation ON commit_metadata(repo_id, generation DESC);
 CREATE INDEX IF NOT EXISTS idx_merge_base_cache_repo ON merge_base_cache(repo_id, updated_at DESC);
+CREATE INDEX IF NOT EXISTS idx_commit_verifications_key ON commit_verifications(key_id);
 CREATE INDEX IF NOT EXISTS idx_magic_link_tokens_hash ON magic_link_tokens(token_hash);
 CREATE INDEX IF NOT EXISTS idx_magic_link_tokens_user ON magic_link_tokens(user_id, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_ssh_auth_challenges_user ON ssh_auth_challenges(user_id, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user ON webauthn_credentials(user_id, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_webauthn_sessions_user_flow ON webauthn_sessions(user_id, flow, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user ON user_sessions(user_id, revoked_at, expires_at);
 CREATE INDEX IF NOT EXISTS idx_indexing_jobs_claim ON indexing_jobs(status, next_attempt_at, id);
 CREATE INDEX IF NOT EXISTS idx_indexing_jobs_repo_commit ON indexing_jobs(repo_id, commit_hash, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_commit_indexes_repo ON commit_indexes(repo_id, created_at DESC);
@@ -600,6 +1097,9 @@ CREATE INDEX IF NOT EXISTS idx_branch_protection_repo_branch ON branch_protectio
 CREATE INDEX IF NOT EXISTS idx_pr_check_runs_pr ON pr_check_runs(pr_id, updated_at DESC);
 CREATE INDEX IF NOT EXISTS idx_repo_runner_tokens_repo_active ON repo_runner_tokens(repo_id, revoked_at, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_repo_runner_tokens_hash ON repo_runner_tokens(token_hash);
+CREATE INDEX IF NOT EXISTS idx_repo_deploy_keys_repo ON repo_deploy_keys(repo_id, revoked_at, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_repo_deploy_keys_token_hash ON repo_deploy_keys(token_hash);
+CREATE INDEX IF NOT EXISTS idx_repo_deploy_keys_fingerprint ON repo_deploy_keys(fingerprint);
 CREATE INDEX IF NOT EXISTS idx_pull_requests_tenant_repo_number ON pull_requests(tenant_id, repo_id, number DESC);
 CREATE INDEX IF NOT EXISTS idx_pr_comments_tenant_pr_created ON pr_comments(tenant_id, pr_id, created_at);
 CREATE INDEX IF NOT EXISTS idx_pr_reviews_tenant_pr_created ON pr_reviews(tenant_id, pr_id, created_at);
@@ -607,10 +1107,16 @@ CREATE INDEX IF NOT EXISTS idx_issues_repo_number ON issues(repo_id, number DESC
 CREATE INDEX IF NOT EXISTS idx_issues_tenant_repo_number ON issues(tenant_id, repo_id, number DESC);
 CREATE INDEX IF NOT EXISTS idx_issue_comments_issue ON issue_comments(issue_id, created_at);
 CREATE INDEX IF NOT EXISTS idx_issue_comments_tenant_issue_created ON issue_comments(tenant_id, issue_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_issue_references_issue ON issue_references(issue_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_issue_entity_links_repo_stable ON issue_entity_links(repo_id, stable_id);
 CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications(user_id, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_notifications_user_unread ON notifications(user_id, read_at, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_thread_subscriptions_thread ON thread_subscriptions(thread_type, thread_id, subscribed);
+CREATE INDEX IF NOT EXISTS idx_repo_watches_repo ON repo_watches(repo_id, level);
 CREATE INDEX IF NOT EXISTS idx_repo_webhooks_repo ON repo_webhooks(repo_id);
 CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_time ON webhook_deliveries(webhook_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_org_webhooks_tenant_org ON org_webhooks(tenant_id, org_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_org_webhook_deliveries_tenant_webhook_time ON org_webhook_deliveries(tenant_id, org_id, webhook_id, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_interest_signups_created ON interest_signups(created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_user_entitlements_user_feature ON user_entitlements(user_id, feature);
 CREATE INDEX IF NOT EXISTS idx_user_entitlements_feature_active ON user_entitlements(feature, active, expires_at);
@@ -789,6 +1295,38 @@ BEGIN
 	END IF;
 END $$;
 
+ALTER TABLE org_webhooks ENABLE ROW LEVEL SECURITY;
+ALTER TABLE org_webhooks FORCE ROW LEVEL SECURITY;
+DO $$
+BEGIN
+	IF NOT EXISTS (
+		SELECT 1 FROM pg_policies
+		WHERE schemaname = current_schema()
+			AND tablename = 'org_webhooks'
+			AND policyname = 'org_webhooks_tenant_rls'
+	) THEN
+		CREATE POLICY org_webhooks_tenant_rls ON org_webhooks
+		USING (gothub_tenant_rls_match(tenant_id))
+		WITH CHECK (gothub_tenant_rls_match(tenant_id));
+	END IF;
+END $$;
+
+ALTER TABLE org_webhook_deliveries ENABLE ROW LEVEL SECURITY;
+ALTER TABLE org_webhook_deliveries FORCE ROW LEVEL SECURITY;
+DO $$
+BEGIN
+	IF NOT EXISTS (
+		SELECT 1 FROM pg_policies
+		WHERE schemaname = current_schema()
+			AND tablename = 'org_webhook_deliveries'
+			AND policyname = 'org_webhook_deliveries_tenant_rls'
+	) THEN
+		CREATE POLICY org_webhook_deliveries_tenant_rls ON org_webhook_deliveries
+		USING (gothub_tenant_rls_match(tenant_id))
+		WITH CHECK (gothub_tenant_rls_match(tenant_id));
+	END IF;
+END $$;
+
 ALTER TABLE repo_runner_tokens ENABLE ROW LEVEL SECURITY;
 ALTER TABLE repo_runner_tokens FORCE ROW LEVEL SECURITY;
 DO $$
@@ -805,6 +1343,22 @@ BEGIN
 	END IF;
 END $$;
 
+ALTER TABLE repo_deploy_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE repo_deploy_keys FORCE ROW LEVEL SECURITY;
+DO $$
+BEGIN
+	IF NOT EXISTS (
+		SELECT 1 FROM pg_policies
+		WHERE schemaname = current_schema()
+			AND tablename = 'repo_deploy_keys'
+			AND policyname = 'repo_deploy_keys_tenant_rls'
+	) THEN
+		CREATE POLICY repo_deploy_keys_tenant_rls ON repo_deploy_keys
+		USING (gothub_tenant_rls_match(tenant_id))
+		WITH CHECK (gothub_tenant_rls_match(tenant_id));
+	END IF;
+END $$;
+
 ALTER TABLE interest_signups ENABLE ROW LEVEL SECURITY;
 ALTER TABLE interest_signups FORCE ROW LEVEL SECURITY;
 DO $$
@@ -850,19 +1404,19 @@ func (p *PostgresDB) CreateUser(ctx context.Context, u *models.User) error {
 func (p *PostgresDB) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
 	tenantID := tenantIDForContext(ctx)
 	return p.scanUser(p.db.QueryRowContext(ctx,
-		`SELECT id, username, email, password_hash, is_admin, created_at FROM users WHERE id = $1 AND tenant_id = $2`, id, tenantID))
+		`SELECT id, username, email, password_hash, is_admin, suspended_at, created_at FROM users WHERE id = $1 AND tenant_id = $2`, id, tenantID))
 }
 
 func (p *PostgresDB) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	tenantID := tenantIDForContext(ctx)
 	return p.scanUser(p.db.QueryRowContext(ctx,
-		`SELECT id, username, email, password_hash, is_admin, created_at FROM users WHERE username = $1 AND tenant_id = $2`, username, tenantID))
+		`SELECT id, username, email, password_hash, is_admin, suspended_at, created_at FROM users WHERE username = $1 AND tenant_id = $2`, username, tenantID))
 }
 
 func (p *PostgresDB) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	tenantID := tenantIDForContext(ctx)
 	return p.scanUser(p.db.QueryRowContext(ctx,
-		`SELECT id, username, email, password_hash, is_admin, created_at FROM users WHERE email = $1 AND tenant_id = $2`, email, tenantID))
+		`SELECT id, username, email, password_hash, is_admin, suspended_at, created_at FROM users WHERE email = $1 AND tenant_id = $2`, email, tenantID))
 }
 
 func (p *PostgresDB) HasVerifiedEmail(ctx context.Context, userID int64) (bool, error) {
@@ -910,7 +1464,7 @@ func (p *PostgresDB) HasWebAuthnCredential(ctx context.Context, userID int64) (b
 
 func (p *PostgresDB) scanUser(row *sql.Row) (*models.User, error) {
 	u := &models.User{}
-	if err := row.Scan(&u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.IsAdmin, &u.CreatedAt); err != nil {
+	if err := row.Scan(&u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.IsAdmin, &u.SuspendedAt, &u.CreatedAt); err != nil {
 		return nil, err
 	}
 	return u, nil
@@ -922,14 +1476,93 @@ func (p *PostgresDB) UpdateUserPassword(ctx context.Context, userID int64, passw
 	return err
 }
 
-func (p *PostgresDB) UpsertUserEntitlement(ctx context.Context, entitlement *models.UserEntitlement) error {
-	if entitlement == nil {
-		return fmt.Errorf("entitlement is required")
+func (p *PostgresDB) ListUsers(ctx context.Context, query string, limit, offset int) ([]models.User, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
 	}
 	tenantID := tenantIDForContext(ctx)
-	_, err := p.db.ExecContext(ctx,
-		`INSERT INTO user_entitlements (
-			user_id, feature, source, external_customer_id, active, expires_at, metadata_json, tenant_id
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT id, username, email, password_hash, is_admin, suspended_at, created_at
+		 FROM users
+		 WHERE tenant_id = $1
+		   AND ($2 = '' OR lower(username) LIKE lower($2) || '%' OR lower(email) LIKE lower($2) || '%')
+		 ORDER BY id
+		 LIMIT $3 OFFSET $4`,
+		tenantID, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.IsAdmin, &u.SuspendedAt, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (p *PostgresDB) SetUserAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	tenantID := tenantIDForContext(ctx)
+	res, err := p.db.ExecContext(ctx, `UPDATE users SET is_admin = $1 WHERE id = $2 AND tenant_id = $3`, isAdmin, userID, tenantID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (p *PostgresDB) SetUserSuspended(ctx context.Context, userID int64, suspendedAt *time.Time) error {
+	tenantID := tenantIDForContext(ctx)
+	res, err := p.db.ExecContext(ctx, `UPDATE users SET suspended_at = $1 WHERE id = $2 AND tenant_id = $3`, suspendedAt, userID, tenantID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (p *PostgresDB) DeleteUser(ctx context.Context, userID, successorID int64) error {
+	tenantID := tenantIDForContext(ctx)
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, ref := range userAuthoredColumns {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE `+ref.table+` SET `+ref.column+` = $1 WHERE `+ref.column+` = $2`, successorID, userID); err != nil {
+			return err
+		}
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1 AND tenant_id = $2`, userID, tenantID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresDB) UpsertUserEntitlement(ctx context.Context, entitlement *models.UserEntitlement) error {
+	if entitlement == nil {
+		return fmt.Errorf("entitlement is required")
+	}
+	tenantID := tenantIDForContext(ctx)
+	_, err := p.db.ExecContext(ctx,
+		`INSERT INTO user_entitlements (
+			user_id, feature, source, external_customer_id, active, expires_at, metadata_json, tenant_id
 		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		ON CONFLICT (tenant_id, user_id, feature) DO UPDATE SET
 			source = EXCLUDED.source,
@@ -1012,12 +1645,12 @@ func (p *PostgresDB) ConsumeMagicLinkToken(ctx context.Context, tokenHash string
 	var tokenID int64
 	u := &models.User{}
 	err = tx.QueryRowContext(ctx,
-		`SELECT m.id, u.id, u.username, u.email, u.password_hash, u.is_admin, u.created_at
+		`SELECT m.id, u.id, u.username, u.email, u.password_hash, u.is_admin, u.suspended_at, u.created_at
 		 FROM magic_link_tokens m
 		 JOIN users u ON u.id = m.user_id
 		 WHERE m.token_hash = $1 AND m.used_at IS NULL AND m.expires_at > $2
 		 FOR UPDATE`,
-		tokenHash, now).Scan(&tokenID, &u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.IsAdmin, &u.CreatedAt)
+		tokenHash, now).Scan(&tokenID, &u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.IsAdmin, &u.SuspendedAt, &u.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -1110,6 +1743,77 @@ func (p *PostgresDB) UpdateWebAuthnCredential(ctx context.Context, credential *m
 	return err
 }
 
+func (p *PostgresDB) DeleteWebAuthnCredential(ctx context.Context, id, userID int64) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`, id, userID)
+	return err
+}
+
+// --- User sessions ---
+
+func (p *PostgresDB) CreateUserSession(ctx context.Context, session *models.UserSession) error {
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO user_sessions (id, user_id, user_agent, ip_address, expires_at) VALUES ($1, $2, $3, $4, $5)
+		 RETURNING created_at, last_seen_at`,
+		session.ID, session.UserID, session.UserAgent, session.IPAddress, session.ExpiresAt,
+	).Scan(&session.CreatedAt, &session.LastSeenAt)
+}
+
+func (p *PostgresDB) GetUserSession(ctx context.Context, id string) (*models.UserSession, error) {
+	session := &models.UserSession{}
+	err := p.db.QueryRowContext(ctx,
+		`SELECT id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at
+		 FROM user_sessions WHERE id = $1`, id,
+	).Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress,
+		&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (p *PostgresDB) ListActiveUserSessions(ctx context.Context, userID int64, now time.Time) ([]models.UserSession, error) {
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at
+		 FROM user_sessions
+		 WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		 ORDER BY last_seen_at DESC, created_at DESC`, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := make([]models.UserSession, 0)
+	for rows.Next() {
+		var session models.UserSession
+		if err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (p *PostgresDB) TouchUserSession(ctx context.Context, id string, seenAt time.Time) error {
+	_, err := p.db.ExecContext(ctx, `UPDATE user_sessions SET last_seen_at = $1 WHERE id = $2`, seenAt, id)
+	return err
+}
+
+func (p *PostgresDB) RevokeUserSession(ctx context.Context, id string, userID int64) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE user_sessions SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id = $1 AND user_id = $2`,
+		id, userID)
+	return err
+}
+
+// RevokeUserSessions revokes every session of the user except exceptID,
+// which may be empty.
+func (p *PostgresDB) RevokeUserSessions(ctx context.Context, userID int64, exceptID string) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE user_sessions SET revoked_at = COALESCE(revoked_at, NOW()) WHERE user_id = $1 AND id <> $2`,
+		userID, exceptID)
+	return err
+}
+
 func (p *PostgresDB) CreateWebAuthnSession(ctx context.Context, session *models.WebAuthnSession) error {
 	_, err := p.db.ExecContext(ctx,
 		`INSERT INTO webauthn_sessions (id, user_id, flow, data_json, expires_at) VALUES ($1, $2, $3, $4, $5)`,
@@ -1149,6 +1853,203 @@ func (p *PostgresDB) ConsumeWebAuthnSession(ctx context.Context, id, flow string
 	return session, nil
 }
 
+func (p *PostgresDB) UpsertUserTOTP(ctx context.Context, totp *models.UserTOTP) error {
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO user_totp (user_id, secret, last_used_step, confirmed_at)
+		 VALUES ($1, $2, 0, NULL)
+		 ON CONFLICT(user_id) DO UPDATE SET
+			 secret = excluded.secret,
+			 last_used_step = 0,
+			 confirmed_at = NULL,
+			 created_at = NOW()
+		 RETURNING created_at`,
+		totp.UserID, totp.Secret).Scan(&totp.CreatedAt)
+}
+
+func (p *PostgresDB) GetUserTOTP(ctx context.Context, userID int64) (*models.UserTOTP, error) {
+	totp := &models.UserTOTP{}
+	var confirmedAt sql.NullTime
+	err := p.db.QueryRowContext(ctx,
+		`SELECT user_id, secret, last_used_step, confirmed_at, created_at
+		 FROM user_totp WHERE user_id = $1`, userID).
+		Scan(&totp.UserID, &totp.Secret, &totp.LastUsedStep, &confirmedAt, &totp.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if confirmedAt.Valid {
+		t := confirmedAt.Time
+		totp.ConfirmedAt = &t
+	}
+	return totp, nil
+}
+
+func (p *PostgresDB) ConfirmUserTOTP(ctx context.Context, userID, step int64, confirmedAt time.Time) error {
+	res, err := p.db.ExecContext(ctx,
+		`UPDATE user_totp SET confirmed_at = $1, last_used_step = $2
+		 WHERE user_id = $3 AND confirmed_at IS NULL`,
+		confirmedAt, step, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (p *PostgresDB) AdvanceUserTOTPStep(ctx context.Context, userID, step int64) (bool, error) {
+	res, err := p.db.ExecContext(ctx,
+		`UPDATE user_totp SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1`,
+		step, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+func (p *PostgresDB) DeleteUserTOTP(ctx context.Context, userID int64) error {
+	tx, err := p.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresDB) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	tx, err := p.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresDB) ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string, now time.Time) error {
+	res, err := p.db.ExecContext(ctx,
+		`UPDATE user_recovery_codes SET used_at = $1
+		 WHERE id = (
+			 SELECT id FROM user_recovery_codes
+			 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL
+			 LIMIT 1
+		 ) AND used_at IS NULL`,
+		now, userID, codeHash)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (p *PostgresDB) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := p.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL`,
+		userID).Scan(&count)
+	return count, err
+}
+
+func (p *PostgresDB) CreateOIDCAuthState(ctx context.Context, state *models.OIDCAuthState) error {
+	_, err := p.db.ExecContext(ctx,
+		`INSERT INTO oidc_auth_states (state, provider, code_verifier, nonce, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		state.State, state.Provider, state.CodeVerifier, state.Nonce, state.ExpiresAt)
+	return err
+}
+
+func (p *PostgresDB) ConsumeOIDCAuthState(ctx context.Context, state string, now time.Time) (*models.OIDCAuthState, error) {
+	tx, err := p.beginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	st := &models.OIDCAuthState{}
+	err = tx.QueryRowContext(ctx,
+		`SELECT state, provider, code_verifier, nonce, expires_at, created_at
+		 FROM oidc_auth_states
+		 WHERE state = $1 AND used_at IS NULL AND expires_at > $2
+		 FOR UPDATE`,
+		state, now).Scan(&st.State, &st.Provider, &st.CodeVerifier, &st.Nonce, &st.ExpiresAt, &st.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE oidc_auth_states SET used_at = $1 WHERE state = $2 AND used_at IS NULL`, now, state)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return nil, sql.ErrNoRows
+	}
+	// Expired states are only useful until now; clear them while here.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM oidc_auth_states WHERE expires_at <= $1`, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	st.UsedAt = &now
+	return st, nil
+}
+
+func (p *PostgresDB) CreateUserIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4) RETURNING id, created_at`,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email).Scan(&identity.ID, &identity.CreatedAt)
+}
+
+func (p *PostgresDB) GetUserIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	tenantID := tenantIDForContext(ctx)
+	return scanUserIdentity(p.db.QueryRowContext(ctx,
+		`SELECT i.id, i.user_id, i.provider, i.subject, i.email, i.created_at, i.last_login_at
+		 FROM user_identities i
+		 JOIN users u ON u.id = i.user_id
+		 WHERE i.provider = $1 AND i.subject = $2 AND u.tenant_id = $3`, provider, subject, tenantID))
+}
+
+func (p *PostgresDB) ListUserIdentities(ctx context.Context, userID int64) ([]models.UserIdentity, error) {
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT id, user_id, provider, subject, email, created_at, last_login_at
+		 FROM user_identities WHERE user_id = $1 ORDER BY provider, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var identities []models.UserIdentity
+	for rows.Next() {
+		identity, err := scanUserIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, *identity)
+	}
+	return identities, rows.Err()
+}
+
+func (p *PostgresDB) TouchUserIdentity(ctx context.Context, id int64, email string, now time.Time) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE user_identities SET email = $1, last_login_at = $2 WHERE id = $3`, email, now, id)
+	return err
+}
+
 // --- SSH Keys ---
 
 func (p *PostgresDB) CreateSSHKey(ctx context.Context, k *models.SSHKey) error {
@@ -1191,27 +2092,368 @@ func (p *PostgresDB) DeleteSSHKey(ctx context.Context, id, userID int64) error {
 	return err
 }
 
-// --- Repositories ---
+// --- Personal access tokens ---
 
-func (p *PostgresDB) CreateRepository(ctx context.Context, r *models.Repository) error {
-	tenantID := tenantIDForContext(ctx)
+func (p *PostgresDB) CreatePersonalAccessToken(ctx context.Context, t *models.PersonalAccessToken) error {
 	return p.db.QueryRowContext(ctx,
-		`INSERT INTO repositories (owner_user_id, owner_org_id, parent_repo_id, name, description, default_branch, is_private, storage_path, tenant_id)
-			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at`,
-		r.OwnerUserID, r.OwnerOrgID, r.ParentRepoID, r.Name, r.Description, r.DefaultBranch, r.IsPrivate, r.StoragePath, tenantID).Scan(&r.ID, &r.CreatedAt)
+		`INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes_csv, repo_ids_csv, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id, created_at`,
+		t.UserID, t.Name, t.TokenHash, t.TokenPrefix, t.ScopesCSV, t.RepoIDsCSV, t.ExpiresAt,
+	).Scan(&t.ID, &t.CreatedAt)
 }
 
-func (p *PostgresDB) UpdateRepositoryStoragePath(ctx context.Context, id int64, storagePath string) error {
-	_, err := p.db.ExecContext(ctx, `UPDATE repositories SET storage_path = $1 WHERE id = $2`, storagePath, id)
+func (p *PostgresDB) ListPersonalAccessTokens(ctx context.Context, userID int64) ([]models.PersonalAccessToken, error) {
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT `+personalAccessTokenColumns+`
+		 FROM personal_access_tokens
+		 WHERE user_id = $1
+		 ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := make([]models.PersonalAccessToken, 0)
+	for rows.Next() {
+		t, err := scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+func (p *PostgresDB) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	return scanPersonalAccessToken(p.db.QueryRowContext(ctx,
+		`SELECT `+personalAccessTokenColumns+` FROM personal_access_tokens WHERE token_hash = $1`, tokenHash))
+}
+
+func (p *PostgresDB) RevokePersonalAccessToken(ctx context.Context, id, userID int64) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE personal_access_tokens SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id = $1 AND user_id = $2`,
+		id, userID)
 	return err
 }
 
-func (p *PostgresDB) CloneRepoMetadata(ctx context.Context, sourceRepoID, targetRepoID int64) error {
-	tx, err := p.beginTx(ctx)
+func (p *PostgresDB) TouchPersonalAccessTokenUsed(ctx context.Context, id int64, usedAt time.Time) error {
+	_, err := p.db.ExecContext(ctx, `UPDATE personal_access_tokens SET last_used_at = $1 WHERE id = $2`, usedAt, id)
+	return err
+}
+
+// --- OAuth apps ---
+
+func (p *PostgresDB) CreateOAuthApp(ctx context.Context, app *models.OAuthApp) error {
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO oauth_apps (owner_id, name, homepage_url, client_id, client_secret_hash, redirect_uris_csv)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING id, created_at, updated_at`,
+		app.OwnerID, app.Name, app.HomepageURL, app.ClientID, app.ClientSecretHash, app.RedirectURIsCSV,
+	).Scan(&app.ID, &app.CreatedAt, &app.UpdatedAt)
+}
+
+func (p *PostgresDB) GetOAuthApp(ctx context.Context, id int64) (*models.OAuthApp, error) {
+	return scanOAuthApp(p.db.QueryRowContext(ctx, `SELECT `+oauthAppColumns+` FROM oauth_apps WHERE id = $1`, id))
+}
+
+func (p *PostgresDB) GetOAuthAppByClientID(ctx context.Context, clientID string) (*models.OAuthApp, error) {
+	return scanOAuthApp(p.db.QueryRowContext(ctx, `SELECT `+oauthAppColumns+` FROM oauth_apps WHERE client_id = $1`, clientID))
+}
+
+func (p *PostgresDB) ListOAuthApps(ctx context.Context, ownerID int64) ([]models.OAuthApp, error) {
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT `+oauthAppColumns+` FROM oauth_apps WHERE owner_id = $1 ORDER BY created_at DESC, id DESC`, ownerID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer tx.Rollback()
+	defer rows.Close()
+	apps := make([]models.OAuthApp, 0)
+	for rows.Next() {
+		app, err := scanOAuthApp(rows)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, *app)
+	}
+	return apps, rows.Err()
+}
+
+func (p *PostgresDB) UpdateOAuthApp(ctx context.Context, app *models.OAuthApp) error {
+	return p.db.QueryRowContext(ctx,
+		`UPDATE oauth_apps
+		 SET name = $1, homepage_url = $2, client_secret_hash = $3, redirect_uris_csv = $4, updated_at = NOW()
+		 WHERE id = $5 AND owner_id = $6
+		 RETURNING updated_at`,
+		app.Name, app.HomepageURL, app.ClientSecretHash, app.RedirectURIsCSV, app.ID, app.OwnerID,
+	).Scan(&app.UpdatedAt)
+}
+
+func (p *PostgresDB) DeleteOAuthApp(ctx context.Context, id, ownerID int64) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM oauth_apps WHERE id = $1 AND owner_id = $2`, id, ownerID)
+	return err
+}
+
+func (p *PostgresDB) CreateOAuthAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO oauth_authorization_codes (app_id, user_id, code_hash, redirect_uri, scopes_csv, code_challenge, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id, created_at`,
+		code.AppID, code.UserID, code.CodeHash, code.RedirectURI, code.ScopesCSV, code.CodeChallenge, code.ExpiresAt,
+	).Scan(&code.ID, &code.CreatedAt)
+}
+
+func (p *PostgresDB) ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string, now time.Time) (*models.OAuthAuthorizationCode, error) {
+	tx, err := p.beginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	c := &models.OAuthAuthorizationCode{}
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, app_id, user_id, code_hash, redirect_uri, scopes_csv, code_challenge, expires_at, created_at
+		 FROM oauth_authorization_codes
+		 WHERE code_hash = $1 AND used_at IS NULL AND expires_at > $2`,
+		codeHash, now).Scan(&c.ID, &c.AppID, &c.UserID, &c.CodeHash, &c.RedirectURI, &c.ScopesCSV, &c.CodeChallenge, &c.ExpiresAt, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE oauth_authorization_codes SET used_at = $1 WHERE id = $2 AND used_at IS NULL`, now, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return nil, sql.ErrNoRows
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM oauth_authorization_codes WHERE expires_at <= $1`, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	c.UsedAt = &now
+	return c, nil
+}
+
+func (p *PostgresDB) UpsertOAuthAuthorization(ctx context.Context, a *models.OAuthAuthorization) error {
+	_, err := p.db.ExecContext(ctx,
+		`INSERT INTO oauth_authorizations (app_id, user_id, scopes_csv) VALUES ($1, $2, $3)
+		 ON CONFLICT(app_id, user_id) DO UPDATE SET scopes_csv = excluded.scopes_csv, updated_at = NOW()`,
+		a.AppID, a.UserID, a.ScopesCSV)
+	return err
+}
+
+func (p *PostgresDB) ListOAuthAuthorizations(ctx context.Context, userID int64) ([]models.OAuthAuthorization, error) {
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT a.app_id, p.name, p.client_id, p.homepage_url, a.user_id, a.scopes_csv, a.created_at, a.updated_at, a.last_used_at
+		 FROM oauth_authorizations a
+		 JOIN oauth_apps p ON p.id = a.app_id
+		 WHERE a.user_id = $1
+		 ORDER BY a.updated_at DESC, a.app_id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	auths := make([]models.OAuthAuthorization, 0)
+	for rows.Next() {
+		a, err := scanOAuthAuthorization(rows)
+		if err != nil {
+			return nil, err
+		}
+		auths = append(auths, *a)
+	}
+	return auths, rows.Err()
+}
+
+func (p *PostgresDB) DeleteOAuthAuthorization(ctx context.Context, appID, userID int64) error {
+	tx, err := p.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM oauth_authorizations WHERE app_id = $1 AND user_id = $2`, appID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE oauth_tokens SET revoked_at = NOW() WHERE app_id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		appID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM oauth_authorization_codes WHERE app_id = $1 AND user_id = $2`, appID, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresDB) CreateOAuthToken(ctx context.Context, t *models.OAuthToken) error {
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO oauth_tokens (app_id, user_id, access_token_hash, refresh_token_hash, scopes_csv, access_expires_at, refresh_expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id, created_at`,
+		t.AppID, t.UserID, t.AccessTokenHash, t.RefreshTokenHash, t.ScopesCSV, t.AccessExpiresAt, t.RefreshExpiresAt,
+	).Scan(&t.ID, &t.CreatedAt)
+}
+
+func (p *PostgresDB) GetOAuthTokenByAccessHash(ctx context.Context, hash string) (*models.OAuthToken, error) {
+	return scanOAuthToken(p.db.QueryRowContext(ctx,
+		`SELECT `+oauthTokenColumns+` FROM oauth_tokens WHERE access_token_hash = $1`, hash))
+}
+
+func (p *PostgresDB) GetOAuthTokenByRefreshHash(ctx context.Context, hash string) (*models.OAuthToken, error) {
+	return scanOAuthToken(p.db.QueryRowContext(ctx,
+		`SELECT `+oauthTokenColumns+` FROM oauth_tokens WHERE refresh_token_hash = $1`, hash))
+}
+
+func (p *PostgresDB) RevokeOAuthToken(ctx context.Context, id int64, now time.Time) (bool, error) {
+	res, err := p.db.ExecContext(ctx, `UPDATE oauth_tokens SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`, now, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (p *PostgresDB) TouchOAuthTokenUsed(ctx context.Context, id int64, usedAt time.Time) error {
+	if _, err := p.db.ExecContext(ctx, `UPDATE oauth_tokens SET last_used_at = $1 WHERE id = $2`, usedAt, id); err != nil {
+		return err
+	}
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE oauth_authorizations SET last_used_at = $1
+		 WHERE (app_id, user_id) = (SELECT app_id, user_id FROM oauth_tokens WHERE id = $2)`, usedAt, id)
+	return err
+}
+
+// --- GPG keys ---
+
+func (p *PostgresDB) CreateGPGKey(ctx context.Context, k *models.GPGKey) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRowContext(ctx,
+		`INSERT INTO gpg_keys (user_id, key_id, fingerprint, public_key, emails_csv, expires_at) VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING id, created_at`,
+		k.UserID, k.KeyID, k.Fingerprint, k.PublicKey, k.EmailsCSV, k.ExpiresAt).Scan(&k.ID, &k.CreatedAt); err != nil {
+		return err
+	}
+	for i := range k.Subkeys {
+		sub := &k.Subkeys[i]
+		sub.GPGKeyID = k.ID
+		if err := tx.QueryRowContext(ctx,
+			`INSERT INTO gpg_subkeys (gpg_key_id, key_id, fingerprint, expires_at) VALUES ($1, $2, $3, $4) RETURNING id`,
+			sub.GPGKeyID, sub.KeyID, sub.Fingerprint, sub.ExpiresAt).Scan(&sub.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresDB) ListGPGKeys(ctx context.Context, userID int64) ([]models.GPGKey, error) {
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT id, user_id, key_id, fingerprint, public_key, emails_csv, expires_at, created_at
+		 FROM gpg_keys WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	var keys []models.GPGKey
+	for rows.Next() {
+		var k models.GPGKey
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&k.ID, &k.UserID, &k.KeyID, &k.Fingerprint, &k.PublicKey, &k.EmailsCSV, &expiresAt, &k.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if expiresAt.Valid {
+			k.ExpiresAt = &expiresAt.Time
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		if keys[i].Subkeys, err = p.listGPGSubkeys(ctx, keys[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// GetGPGKeyByKeyID finds the key whose primary key or one of whose subkeys
+// has the given key ID.
+func (p *PostgresDB) GetGPGKeyByKeyID(ctx context.Context, keyID string) (*models.GPGKey, error) {
+	k := &models.GPGKey{}
+	var expiresAt sql.NullTime
+	err := p.db.QueryRowContext(ctx,
+		`SELECT id, user_id, key_id, fingerprint, public_key, emails_csv, expires_at, created_at
+		 FROM gpg_keys
+		 WHERE key_id = $1 OR id = (SELECT gpg_key_id FROM gpg_subkeys WHERE key_id = $1)`, keyID).
+		Scan(&k.ID, &k.UserID, &k.KeyID, &k.Fingerprint, &k.PublicKey, &k.EmailsCSV, &expiresAt, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
+	if k.Subkeys, err = p.listGPGSubkeys(ctx, k.ID); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (p *PostgresDB) listGPGSubkeys(ctx context.Context, gpgKeyID int64) ([]models.GPGSubkey, error) {
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT id, gpg_key_id, key_id, fingerprint, expires_at FROM gpg_subkeys WHERE gpg_key_id = $1 ORDER BY id`, gpgKeyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var subkeys []models.GPGSubkey
+	for rows.Next() {
+		var sub models.GPGSubkey
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&sub.ID, &sub.GPGKeyID, &sub.KeyID, &sub.Fingerprint, &expiresAt); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			sub.ExpiresAt = &expiresAt.Time
+		}
+		subkeys = append(subkeys, sub)
+	}
+	return subkeys, rows.Err()
+}
+
+func (p *PostgresDB) DeleteGPGKey(ctx context.Context, id, userID int64) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM gpg_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	return err
+}
+
+// --- Repositories ---
+
+func (p *PostgresDB) CreateRepository(ctx context.Context, r *models.Repository) error {
+	tenantID := tenantIDForContext(ctx)
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO repositories (owner_user_id, owner_org_id, parent_repo_id, name, description, default_branch, is_private, storage_path, tenant_id)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at`,
+		r.OwnerUserID, r.OwnerOrgID, r.ParentRepoID, r.Name, r.Description, r.DefaultBranch, r.IsPrivate, r.StoragePath, tenantID).Scan(&r.ID, &r.CreatedAt)
+}
+
+func (p *PostgresDB) UpdateRepositoryStoragePath(ctx context.Context, id int64, storagePath string) error {
+	_, err := p.db.ExecContext(ctx, `UPDATE repositories SET storage_path = $1 WHERE id = $2`, storagePath, id)
+	return err
+}
+
+func (p *PostgresDB) CloneRepoMetadata(ctx context.Context, sourceRepoID, targetRepoID int64) error {
+	tx, err := p.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
 	copyStatements := []struct {
 		query string
@@ -1536,6 +2778,20 @@ func (p *PostgresDB) DeleteRepository(ctx context.Context, id int64) error {
 	return err
 }
 
+func (p *PostgresDB) TransferRepository(ctx context.Context, id int64, ownerUserID, ownerOrgID *int64) error {
+	tenantID := tenantIDForContext(ctx)
+	res, err := p.db.ExecContext(ctx,
+		`UPDATE repositories SET owner_user_id = $1, owner_org_id = $2 WHERE id = $3 AND tenant_id = $4`,
+		ownerUserID, ownerOrgID, id, tenantID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 // --- Stars ---
 
 func (p *PostgresDB) AddRepoStar(ctx context.Context, repoID, userID int64) error {
@@ -1759,6 +3015,24 @@ func (p *PostgresDB) GetPullRequest(ctx context.Context, repoID int64, number in
 	return pr, nil
 }
 
+func (p *PostgresDB) GetPullRequestByID(ctx context.Context, id int64) (*models.PullRequest, error) {
+	tenantID := tenantIDForContext(ctx)
+	pr := &models.PullRequest{}
+	err := p.db.QueryRowContext(ctx,
+		`SELECT pr.id, pr.repo_id, pr.number, pr.title, pr.body, pr.state, pr.author_id, u.username,
+		        pr.source_branch, pr.target_branch, pr.source_commit, pr.target_commit, pr.merge_commit, pr.merge_method, pr.created_at, pr.merged_at
+		 FROM pull_requests pr
+		 JOIN users u ON u.id = pr.author_id AND u.tenant_id = pr.tenant_id
+		 WHERE pr.id = $1 AND pr.tenant_id = $2`, id, tenantID).
+		Scan(&pr.ID, &pr.RepoID, &pr.Number, &pr.Title, &pr.Body, &pr.State, &pr.AuthorID, &pr.AuthorName,
+			&pr.SourceBranch, &pr.TargetBranch, &pr.SourceCommit, &pr.TargetCommit,
+			&pr.MergeCommit, &pr.MergeMethod, &pr.CreatedAt, &pr.MergedAt)
+	if err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
 func (p *PostgresDB) ListPullRequests(ctx context.Context, repoID int64, state string) ([]models.PullRequest, error) {
 	return p.ListPullRequestsPage(ctx, repoID, state, 1<<30, 0)
 }
@@ -1807,7 +3081,7 @@ func (p *PostgresDB) ListPullRequestsPage(ctx context.Context, repoID int64, sta
 func (p *PostgresDB) UpdatePullRequest(ctx context.Context, pr *models.PullRequest) error {
 	tenantID := tenantIDForContext(ctx)
 	_, err := p.db.ExecContext(ctx,
-		`UPDATE pull_requests SET title=$1, body=$2, state=$3, source_commit=$4, target_commit=$5, merge_commit=$6, merge_method=$7, merged_at=$8
+		`UPDATE pull_requests SET title=$1, body=$2, state=$3, source_commit=$4, target_commit=$5, merge_commit=$6, merge_method=$7, merged_at=$8, updated_at=NOW()
 		 WHERE id = $9 AND tenant_id = $10`,
 		pr.Title, pr.Body, pr.State, pr.SourceCommit, pr.TargetCommit, pr.MergeCommit, pr.MergeMethod, pr.MergedAt, pr.ID, tenantID)
 	return err
@@ -1817,14 +3091,18 @@ func (p *PostgresDB) UpdatePullRequest(ctx context.Context, pr *models.PullReque
 
 func (p *PostgresDB) CreatePRComment(ctx context.Context, c *models.PRComment) error {
 	tenantID := tenantIDForContext(ctx)
-	return p.db.QueryRowContext(ctx,
+	if err := p.db.QueryRowContext(ctx,
 		`INSERT INTO pr_comments (pr_id, author_id, body, file_path, entity_key, entity_stable_id, line_number, commit_hash, tenant_id)
 		 SELECT p.id, $2, $3, $4, $5, $6, $7, $8, $9
 		 FROM pull_requests p
 		 JOIN users u ON u.id = $2 AND u.tenant_id = $9
 		 WHERE p.id = $1 AND p.tenant_id = $9
 		 RETURNING id, created_at`,
-		c.PRID, c.AuthorID, c.Body, c.FilePath, c.EntityKey, c.EntityStableID, c.LineNumber, c.CommitHash, tenantID).Scan(&c.ID, &c.CreatedAt)
+		c.PRID, c.AuthorID, c.Body, c.FilePath, c.EntityKey, c.EntityStableID, c.LineNumber, c.CommitHash, tenantID).Scan(&c.ID, &c.CreatedAt); err != nil {
+		return err
+	}
+	_, err := p.db.ExecContext(ctx, `UPDATE pull_requests SET updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND tenant_id = $2`, c.PRID, tenantID)
+	return err
 }
 
 func (p *PostgresDB) ListPRComments(ctx context.Context, prID int64) ([]models.PRComment, error) {
@@ -1878,14 +3156,18 @@ func (p *PostgresDB) DeletePRComment(ctx context.Context, commentID, authorID in
 
 func (p *PostgresDB) CreatePRReview(ctx context.Context, r *models.PRReview) error {
 	tenantID := tenantIDForContext(ctx)
-	return p.db.QueryRowContext(ctx,
+	if err := p.db.QueryRowContext(ctx,
 		`INSERT INTO pr_reviews (pr_id, author_id, state, body, commit_hash, tenant_id)
 		 SELECT p.id, $2, $3, $4, $5, $6
 		 FROM pull_requests p
 		 JOIN users u ON u.id = $2 AND u.tenant_id = $6
 		 WHERE p.id = $1 AND p.tenant_id = $6
 		 RETURNING id, created_at`,
-		r.PRID, r.AuthorID, r.State, r.Body, r.CommitHash, tenantID).Scan(&r.ID, &r.CreatedAt)
+		r.PRID, r.AuthorID, r.State, r.Body, r.CommitHash, tenantID).Scan(&r.ID, &r.CreatedAt); err != nil {
+		return err
+	}
+	_, err := p.db.ExecContext(ctx, `UPDATE pull_requests SET updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND tenant_id = $2`, r.PRID, tenantID)
+	return err
 }
 
 func (p *PostgresDB) ListPRReviews(ctx context.Context, prID int64) ([]models.PRReview, error) {
@@ -1977,6 +3259,21 @@ func (p *PostgresDB) GetIssue(ctx context.Context, repoID int64, number int) (*m
 	return issue, nil
 }
 
+func (p *PostgresDB) GetIssueByID(ctx context.Context, id int64) (*models.Issue, error) {
+	tenantID := tenantIDForContext(ctx)
+	issue := &models.Issue{}
+	err := p.db.QueryRowContext(ctx,
+		`SELECT i.id, i.repo_id, i.number, i.title, i.body, i.state, i.author_id, u.username, i.created_at, i.closed_at
+		 FROM issues i
+		 JOIN users u ON u.id = i.author_id AND u.tenant_id = i.tenant_id
+		 WHERE i.id = $1 AND i.tenant_id = $2`, id, tenantID).
+		Scan(&issue.ID, &issue.RepoID, &issue.Number, &issue.Title, &issue.Body, &issue.State, &issue.AuthorID, &issue.AuthorName, &issue.CreatedAt, &issue.ClosedAt)
+	if err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
 func (p *PostgresDB) ListIssues(ctx context.Context, repoID int64, state string) ([]models.Issue, error) {
 	return p.ListIssuesPage(ctx, repoID, state, 1<<30, 0)
 }
@@ -2022,21 +3319,25 @@ func (p *PostgresDB) ListIssuesPage(ctx context.Context, repoID int64, state str
 func (p *PostgresDB) UpdateIssue(ctx context.Context, issue *models.Issue) error {
 	tenantID := tenantIDForContext(ctx)
 	_, err := p.db.ExecContext(ctx,
-		`UPDATE issues SET title = $1, body = $2, state = $3, closed_at = $4 WHERE id = $5 AND tenant_id = $6`,
+		`UPDATE issues SET title = $1, body = $2, state = $3, closed_at = $4, updated_at = NOW() WHERE id = $5 AND tenant_id = $6`,
 		issue.Title, issue.Body, issue.State, issue.ClosedAt, issue.ID, tenantID)
 	return err
 }
 
 func (p *PostgresDB) CreateIssueComment(ctx context.Context, c *models.IssueComment) error {
 	tenantID := tenantIDForContext(ctx)
-	return p.db.QueryRowContext(ctx,
+	if err := p.db.QueryRowContext(ctx,
 		`INSERT INTO issue_comments (issue_id, author_id, body, tenant_id)
 		 SELECT i.id, $2, $3, $4
 		 FROM issues i
 		 JOIN users u ON u.id = $2 AND u.tenant_id = $4
 		 WHERE i.id = $1 AND i.tenant_id = $4
 		 RETURNING id, created_at`,
-		c.IssueID, c.AuthorID, c.Body, tenantID).Scan(&c.ID, &c.CreatedAt)
+		c.IssueID, c.AuthorID, c.Body, tenantID).Scan(&c.ID, &c.CreatedAt); err != nil {
+		return err
+	}
+	_, err := p.db.ExecContext(ctx, `UPDATE issues SET updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND tenant_id = $2`, c.IssueID, tenantID)
+	return err
 }
 
 func (p *PostgresDB) ListIssueComments(ctx context.Context, issueID int64) ([]models.IssueComment, error) {
@@ -2086,53 +3387,444 @@ func (p *PostgresDB) DeleteIssueComment(ctx context.Context, commentID, authorID
 	return nil
 }
 
-// --- Notifications ---
-
-func (p *PostgresDB) CreateNotification(ctx context.Context, n *models.Notification) error {
+func (p *PostgresDB) UpsertIssueReference(ctx context.Context, ref *models.IssueReference) error {
+	tenantID := tenantIDForContext(ctx)
 	return p.db.QueryRowContext(ctx,
-		`INSERT INTO notifications (
-			 user_id, actor_id, type, title, body, resource_path, repo_id, pr_id, issue_id, read_at
-		 ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		 RETURNING id, created_at`,
-		n.UserID, n.ActorID, n.Type, n.Title, n.Body, n.ResourcePath, n.RepoID, n.PRID, n.IssueID, n.ReadAt).
-		Scan(&n.ID, &n.CreatedAt)
+		`INSERT INTO issue_references (
+			 repo_id, issue_id, source_type, source_id, source_number, commit_hash, actor_id, closing
+		 )
+		 SELECT i.repo_id, i.id, $2, $3, $4, $5, $6, $7
+		 FROM issues i
+		 WHERE i.id = $1 AND i.tenant_id = $8
+		 ON CONFLICT(issue_id, source_type, source_id, commit_hash) DO UPDATE SET
+			 closing = issue_references.closing OR EXCLUDED.closing
+		 RETURNING id, closing, created_at`,
+		ref.IssueID, ref.SourceType, ref.SourceID, ref.SourceNumber, ref.CommitHash, ref.ActorID, ref.Closing, tenantID).
+		Scan(&ref.ID, &ref.Closing, &ref.CreatedAt)
 }
 
-func (p *PostgresDB) ListNotifications(ctx context.Context, userID int64, unreadOnly bool) ([]models.Notification, error) {
-	return p.ListNotificationsPage(ctx, userID, unreadOnly, 1<<30, 0)
+func (p *PostgresDB) ListIssueReferences(ctx context.Context, issueID int64) ([]models.IssueReference, error) {
+	return p.ListIssueReferencesPage(ctx, issueID, 1<<30, 0)
 }
 
-func (p *PostgresDB) ListNotificationsPage(ctx context.Context, userID int64, unreadOnly bool, limit, offset int) ([]models.Notification, error) {
-	query := `SELECT n.id, n.user_id, n.actor_id, a.username, n.type, n.title, n.body, n.resource_path, n.repo_id, n.pr_id, n.issue_id, n.read_at, n.created_at
-		 FROM notifications n
-		 JOIN users a ON a.id = n.actor_id
-		 WHERE n.user_id = $1`
-	args := []any{userID}
-	argPos := 2
-	if unreadOnly {
-		query += ` AND n.read_at IS NULL`
-	}
+func (p *PostgresDB) ListIssueReferencesPage(ctx context.Context, issueID int64, limit, offset int) ([]models.IssueReference, error) {
+	tenantID := tenantIDForContext(ctx)
 	if limit <= 0 {
 		limit = 100
 	}
 	if offset < 0 {
 		offset = 0
 	}
-	query += fmt.Sprintf(" ORDER BY n.created_at DESC, n.id DESC LIMIT $%d OFFSET $%d", argPos, argPos+1)
-	args = append(args, limit, offset)
-
-	rows, err := p.db.QueryContext(ctx, query, args...)
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT r.id, r.repo_id, r.issue_id, i.number, r.source_type, r.source_id, r.source_number, r.commit_hash, r.actor_id, u.username, r.closing, r.created_at
+		 FROM issue_references r
+		 JOIN issues i ON i.id = r.issue_id
+		 JOIN users u ON u.id = r.actor_id
+		 WHERE r.issue_id = $1 AND i.tenant_id = $2
+		 ORDER BY r.created_at, r.id
+		 LIMIT $3 OFFSET $4`, issueID, tenantID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-
-	var notifications []models.Notification
+	var refs []models.IssueReference
+	for rows.Next() {
+		var ref models.IssueReference
+		if err := rows.Scan(&ref.ID, &ref.RepoID, &ref.IssueID, &ref.IssueNumber, &ref.SourceType, &ref.SourceID, &ref.SourceNumber, &ref.CommitHash, &ref.ActorID, &ref.ActorName, &ref.Closing, &ref.CreatedAt); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
+func (p *PostgresDB) AddIssueEntityLink(ctx context.Context, link *models.IssueEntityLink) error {
+	tenantID := tenantIDForContext(ctx)
+	if _, err := p.db.ExecContext(ctx,
+		`INSERT INTO issue_entity_links (repo_id, issue_id, stable_id, creator_id)
+		 SELECT i.repo_id, i.id, $2, $3
+		 FROM issues i
+		 WHERE i.id = $1 AND i.tenant_id = $4
+		 ON CONFLICT(issue_id, stable_id) DO NOTHING`,
+		link.IssueID, link.StableID, link.CreatorID, tenantID); err != nil {
+		return err
+	}
+	return p.db.QueryRowContext(ctx,
+		`SELECT l.id, l.repo_id, l.creator_id, l.created_at
+		 FROM issue_entity_links l
+		 JOIN issues i ON i.id = l.issue_id
+		 WHERE l.issue_id = $1 AND l.stable_id = $2 AND i.tenant_id = $3`,
+		link.IssueID, link.StableID, tenantID).Scan(&link.ID, &link.RepoID, &link.CreatorID, &link.CreatedAt)
+}
+
+func (p *PostgresDB) DeleteIssueEntityLink(ctx context.Context, issueID int64, stableID string) error {
+	tenantID := tenantIDForContext(ctx)
+	res, err := p.db.ExecContext(ctx,
+		`DELETE FROM issue_entity_links l
+		 USING issues i
+		 WHERE i.id = l.issue_id AND l.issue_id = $1 AND l.stable_id = $2 AND i.tenant_id = $3`,
+		issueID, stableID, tenantID)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const pgIssueEntityLinkColumns = `l.id, l.repo_id, l.issue_id, i.number, i.title, i.state, l.stable_id,
+	COALESCE(e.name, ''), COALESCE(e.decl_kind, ''), COALESCE(e.receiver, ''), l.creator_id, l.created_at`
+
+func (p *PostgresDB) ListIssueEntityLinks(ctx context.Context, issueID int64) ([]models.IssueEntityLink, error) {
+	tenantID := tenantIDForContext(ctx)
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT `+pgIssueEntityLinkColumns+`
+		 FROM issue_entity_links l
+		 JOIN issues i ON i.id = l.issue_id
+		 LEFT JOIN entity_identities e ON e.repo_id = l.repo_id AND e.stable_id = l.stable_id
+		 WHERE l.issue_id = $1 AND i.tenant_id = $2
+		 ORDER BY l.created_at, l.id`, issueID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanPostgresIssueEntityLinks(rows)
+}
+
+func (p *PostgresDB) ListOpenIssueEntityLinks(ctx context.Context, repoID int64, stableIDs []string) ([]models.IssueEntityLink, error) {
+	tenantID := tenantIDForContext(ctx)
+	if len(stableIDs) == 0 {
+		return nil, nil
+	}
+	args := []any{repoID, tenantID}
+	placeholders := make([]string, 0, len(stableIDs))
+	for _, id := range stableIDs {
+		args = append(args, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT `+pgIssueEntityLinkColumns+`
+		 FROM issue_entity_links l
+		 JOIN issues i ON i.id = l.issue_id
+		 LEFT JOIN entity_identities e ON e.repo_id = l.repo_id AND e.stable_id = l.stable_id
+		 WHERE l.repo_id = $1 AND i.tenant_id = $2 AND i.state = 'open' AND l.stable_id IN (`+strings.Join(placeholders, ", ")+`)
+		 ORDER BY i.number DESC, l.stable_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanPostgresIssueEntityLinks(rows)
+}
+
+func scanPostgresIssueEntityLinks(rows *sql.Rows) ([]models.IssueEntityLink, error) {
+	var links []models.IssueEntityLink
+	for rows.Next() {
+		var l models.IssueEntityLink
+		if err := rows.Scan(&l.ID, &l.RepoID, &l.IssueID, &l.IssueNumber, &l.IssueTitle, &l.IssueState, &l.StableID, &l.EntityName, &l.DeclKind, &l.Receiver, &l.CreatorID, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+func (p *PostgresDB) SearchIssues(ctx context.Context, q models.IssueSearchQuery, limit, offset int) ([]models.IssueSearchResult, error) {
+	tenantID := tenantIDForContext(ctx)
+	if limit <= 0 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	var args []any
+	argPos := 1
+	tsquery := ""
+	if len(q.Terms) > 0 {
+		parts := make([]string, 0, len(q.Terms))
+		for _, term := range q.Terms {
+			parts = append(parts, fmt.Sprintf("phraseto_tsquery('english', $%d)", argPos))
+			args = append(args, term)
+			argPos++
+		}
+		tsquery = "(" + strings.Join(parts, " && ") + ")"
+	}
+
+	// search_vector weights title over body over comments for ts_rank_cd.
+	// Matching the whole vector uses its GIN index; ts_filter then narrows
+	// the match to the requested fields.
+	document := func(alias string) string {
+		fields := issueSearchSelectedFields(q)
+		if len(fields) == len(issueSearchFields) {
+			return alias + ".search_vector"
+		}
+		weights := map[string]string{"title": "a", "body": "b", "comments": "c"}
+		labels := make([]string, 0, len(fields))
+		for _, field := range fields {
+			labels = append(labels, weights[field])
+		}
+		return fmt.Sprintf("ts_filter(%s.search_vector, '{%s}')", alias, strings.Join(labels, ","))
+	}
+	match := func(alias string) (string, string) {
+		if tsquery == "" {
+			return "", ""
+		}
+		doc := document(alias)
+		where := fmt.Sprintf(" AND %s.search_vector @@ %s", alias, tsquery)
+		if doc != alias+".search_vector" {
+			where += fmt.Sprintf(" AND %s @@ %s", doc, tsquery)
+		}
+		return ", " + doc + " AS document", where
+	}
+	var branches []string
+	if q.Kind != models.IssueSearchKindPullRequest && q.State != models.PullRequestStateMerged {
+		doc, matches := match("i")
+		branches = append(branches, fmt.Sprintf(`SELECT 'issue' AS kind, i.id, i.repo_id, i.number, i.title, i.body, i.state, i.author_id, i.tenant_id,
+			 (SELECT COUNT(*) FROM issue_comments c WHERE c.issue_id = i.id AND c.tenant_id = i.tenant_id) AS comment_count, i.created_at, i.updated_at%s
+		 FROM issues i
+		 WHERE i.repo_id = $%d AND i.tenant_id = $%d`, doc, argPos, argPos+1)+issueSearchStateClause("i.state", q.State)+matches)
+		args = append(args, q.RepoID, tenantID)
+		argPos += 2
+	}
+	if q.Kind != models.IssueSearchKindIssue {
+		doc, matches := match("p")
+		branches = append(branches, fmt.Sprintf(`SELECT 'pull_request' AS kind, p.id, p.repo_id, p.number, p.title, p.body, p.state, p.author_id, p.tenant_id,
+			 (SELECT COUNT(*) FROM pr_comments c WHERE c.pr_id = p.id AND c.tenant_id = p.tenant_id) AS comment_count, p.created_at, p.updated_at%s
+		 FROM pull_requests p
+		 WHERE p.repo_id = $%d AND p.tenant_id = $%d`, doc, argPos, argPos+1)+issueSearchStateClause("p.state", q.State)+matches)
+		args = append(args, q.RepoID, tenantID)
+		argPos += 2
+	}
+	if len(branches) == 0 {
+		return nil, nil
+	}
+
+	score := "0::float8"
+	if tsquery != "" {
+		score = "ts_rank_cd(t.document, " + tsquery + ")::float8"
+	}
+	where := " WHERE 1 = 1"
+	if q.AuthorName != "" {
+		where += fmt.Sprintf(" AND u.username = $%d", argPos)
+		args = append(args, q.AuthorName)
+		argPos++
+	}
+	query := `SELECT t.kind, t.id, t.repo_id, t.number, t.title, t.body, t.state, t.author_id, COALESCE(u.username, ''), t.comment_count, ` + score + `, t.created_at, t.updated_at
+		 FROM (` + strings.Join(branches, " UNION ALL ") + `) t
+		 LEFT JOIN users u ON u.id = t.author_id AND u.tenant_id = t.tenant_id` + where +
+		issueSearchOrderBy(q, "ts_rank_cd(t.document, "+tsquery+") DESC") + fmt.Sprintf(" LIMIT $%d OFFSET $%d", argPos, argPos+1)
+	args = append(args, limit, offset)
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var results []models.IssueSearchResult
+	for rows.Next() {
+		var r models.IssueSearchResult
+		if err := rows.Scan(&r.Kind, &r.ID, &r.RepoID, &r.Number, &r.Title, &r.Body, &r.State, &r.AuthorID, &r.AuthorName, &r.CommentCount, &r.Score, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// --- Notifications ---
+
+func (p *PostgresDB) CreateNotification(ctx context.Context, n *models.Notification) error {
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO notifications (
+			 user_id, actor_id, type, title, body, resource_path, repo_id, pr_id, issue_id, reason, read_at
+		 ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		 RETURNING id, created_at`,
+		n.UserID, n.ActorID, n.Type, n.Title, n.Body, n.ResourcePath, n.RepoID, n.PRID, n.IssueID, n.Reason, n.ReadAt).
+		Scan(&n.ID, &n.CreatedAt)
+}
+
+func (p *PostgresDB) ListNotifications(ctx context.Context, userID int64, unreadOnly bool) ([]models.Notification, error) {
+	return p.ListNotificationsPage(ctx, userID, unreadOnly, "", 1<<30, 0)
+}
+
+func (p *PostgresDB) ListNotificationsPage(ctx context.Context, userID int64, unreadOnly bool, reason string, limit, offset int) ([]models.Notification, error) {
+	query := `SELECT n.id, n.user_id, n.actor_id, a.username, n.type, n.title, n.body, n.resource_path, n.repo_id, n.pr_id, n.issue_id, n.reason, n.read_at, n.created_at
+		 FROM notifications n
+		 JOIN users a ON a.id = n.actor_id
+		 WHERE n.user_id = $1`
+	args := []any{userID}
+	argPos := 2
+	if unreadOnly {
+		query += ` AND n.read_at IS NULL`
+	}
+	if reason != "" {
+		query += fmt.Sprintf(" AND n.reason = $%d", argPos)
+		args = append(args, reason)
+		argPos++
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	query += fmt.Sprintf(" ORDER BY n.created_at DESC, n.id DESC LIMIT $%d OFFSET $%d", argPos, argPos+1)
+	args = append(args, limit, offset)
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPostgresNotificationRows(rows)
+}
+
+func (p *PostgresDB) CountUnreadNotifications(ctx context.Context, userID int64) (int, error) {
+	var count int
+	if err := p.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`,
+		userID).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (p *PostgresDB) MarkNotificationRead(ctx context.Context, id, userID int64) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE notifications SET read_at = NOW() WHERE id = $1 AND user_id = $2 AND read_at IS NULL`,
+		id, userID)
+	return err
+}
+
+func (p *PostgresDB) MarkAllNotificationsRead(ctx context.Context, userID int64) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`,
+		userID)
+	return err
+}
+
+func (p *PostgresDB) DeleteNotificationsForResource(ctx context.Context, userID int64, resourcePath string) error {
+	_, err := p.db.ExecContext(ctx,
+		`DELETE FROM notifications WHERE user_id = $1 AND resource_path = $2`, userID, resourcePath)
+	return err
+}
+
+func (p *PostgresDB) EnsureThreadSubscription(ctx context.Context, sub *models.ThreadSubscription) error {
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO thread_subscriptions (user_id, repo_id, thread_type, thread_id, reason, subscribed)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT(user_id, thread_type, thread_id) DO UPDATE SET
+			 user_id = thread_subscriptions.user_id
+		 RETURNING id, repo_id, reason, subscribed, created_at, updated_at`,
+		sub.UserID, sub.RepoID, sub.ThreadType, sub.ThreadID, sub.Reason, sub.Subscribed).
+		Scan(&sub.ID, &sub.RepoID, &sub.Reason, &sub.Subscribed, &sub.CreatedAt, &sub.UpdatedAt)
+}
+
+func (p *PostgresDB) SetThreadSubscription(ctx context.Context, sub *models.ThreadSubscription) error {
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO thread_subscriptions (user_id, repo_id, thread_type, thread_id, reason, subscribed)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT(user_id, thread_type, thread_id) DO UPDATE SET
+			 reason = EXCLUDED.reason,
+			 subscribed = EXCLUDED.subscribed,
+			 updated_at = NOW()
+		 RETURNING id, repo_id, created_at, updated_at`,
+		sub.UserID, sub.RepoID, sub.ThreadType, sub.ThreadID, sub.Reason, sub.Subscribed).
+		Scan(&sub.ID, &sub.RepoID, &sub.CreatedAt, &sub.UpdatedAt)
+}
+
+func (p *PostgresDB) GetThreadSubscription(ctx context.Context, userID int64, threadType string, threadID int64) (*models.ThreadSubscription, error) {
+	sub := &models.ThreadSubscription{}
+	err := p.db.QueryRowContext(ctx,
+		`SELECT id, user_id, repo_id, thread_type, thread_id, reason, subscribed, created_at, updated_at
+		 FROM thread_subscriptions
+		 WHERE user_id = $1 AND thread_type = $2 AND thread_id = $3`,
+		userID, threadType, threadID).
+		Scan(&sub.ID, &sub.UserID, &sub.RepoID, &sub.ThreadType, &sub.ThreadID, &sub.Reason, &sub.Subscribed, &sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (p *PostgresDB) ListThreadSubscriptions(ctx context.Context, threadType string, threadID int64) ([]models.ThreadSubscription, error) {
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT id, user_id, repo_id, thread_type, thread_id, reason, subscribed, created_at, updated_at
+		 FROM thread_subscriptions
+		 WHERE thread_type = $1 AND thread_id = $2
+		 ORDER BY user_id`, threadType, threadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var subs []models.ThreadSubscription
+	for rows.Next() {
+		var sub models.ThreadSubscription
+		if err := rows.Scan(&sub.ID, &sub.UserID, &sub.RepoID, &sub.ThreadType, &sub.ThreadID, &sub.Reason, &sub.Subscribed, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (p *PostgresDB) SetRepoWatch(ctx context.Context, w *models.RepoWatch) error {
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO repo_watches (user_id, repo_id, level)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT(user_id, repo_id) DO UPDATE SET
+			 level = EXCLUDED.level,
+			 updated_at = NOW()
+		 RETURNING created_at, updated_at`,
+		w.UserID, w.RepoID, w.Level).Scan(&w.CreatedAt, &w.UpdatedAt)
+}
+
+func (p *PostgresDB) GetRepoWatch(ctx context.Context, userID, repoID int64) (*models.RepoWatch, error) {
+	w := &models.RepoWatch{}
+	err := p.db.QueryRowContext(ctx,
+		`SELECT user_id, repo_id, level, created_at, updated_at
+		 FROM repo_watches WHERE user_id = $1 AND repo_id = $2`,
+		userID, repoID).Scan(&w.UserID, &w.RepoID, &w.Level, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (p *PostgresDB) DeleteRepoWatch(ctx context.Context, userID, repoID int64) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM repo_watches WHERE user_id = $1 AND repo_id = $2`, userID, repoID)
+	return err
+}
+
+func (p *PostgresDB) ListRepoWatches(ctx context.Context, repoID int64) ([]models.RepoWatch, error) {
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT user_id, repo_id, level, created_at, updated_at
+		 FROM repo_watches WHERE repo_id = $1
+		 ORDER BY user_id`, repoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var watches []models.RepoWatch
+	for rows.Next() {
+		var w models.RepoWatch
+		if err := rows.Scan(&w.UserID, &w.RepoID, &w.Level, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return nil, err
+		}
+		watches = append(watches, w)
+	}
+	return watches, rows.Err()
+}
+
+func scanPostgresNotificationRows(rows *sql.Rows) ([]models.Notification, error) {
+	var notifications []models.Notification
 	for rows.Next() {
 		var n models.Notification
 		var repoID, prID, issueID sql.NullInt64
 		var readAt sql.NullTime
-		if err := rows.Scan(&n.ID, &n.UserID, &n.ActorID, &n.ActorName, &n.Type, &n.Title, &n.Body, &n.ResourcePath, &repoID, &prID, &issueID, &readAt, &n.CreatedAt); err != nil {
+		if err := rows.Scan(&n.ID, &n.UserID, &n.ActorID, &n.ActorName, &n.Type, &n.Title, &n.Body, &n.ResourcePath, &repoID, &prID, &issueID, &n.Reason, &readAt, &n.CreatedAt); err != nil {
 			return nil, err
 		}
 		if repoID.Valid {
@@ -2156,30 +3848,133 @@ func (p *PostgresDB) ListNotificationsPage(ctx context.Context, userID int64, un
 	return notifications, rows.Err()
 }
 
-func (p *PostgresDB) CountUnreadNotifications(ctx context.Context, userID int64) (int, error) {
-	var count int
-	if err := p.db.QueryRowContext(ctx,
-		`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`,
-		userID).Scan(&count); err != nil {
-		return 0, err
+// --- Notification digests ---
+
+func (p *PostgresDB) GetNotificationSettings(ctx context.Context, userID int64) (*models.NotificationSettings, error) {
+	settings := &models.NotificationSettings{}
+	var lastDigestAt sql.NullTime
+	err := p.db.QueryRowContext(ctx,
+		`SELECT user_id, email_frequency, last_digest_at, updated_at
+		 FROM notification_settings WHERE user_id = $1`, userID).
+		Scan(&settings.UserID, &settings.EmailFrequency, &lastDigestAt, &settings.UpdatedAt)
+	if err != nil {
+		return nil, err
 	}
-	return count, nil
+	if lastDigestAt.Valid {
+		t := lastDigestAt.Time
+		settings.LastDigestAt = &t
+	}
+	return settings, nil
 }
 
-func (p *PostgresDB) MarkNotificationRead(ctx context.Context, id, userID int64) error {
+func (p *PostgresDB) UpsertNotificationSettings(ctx context.Context, settings *models.NotificationSettings) error {
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO notification_settings (user_id, email_frequency)
+		 VALUES ($1, $2)
+		 ON CONFLICT(user_id) DO UPDATE SET
+			 email_frequency = excluded.email_frequency,
+			 updated_at = NOW()
+		 RETURNING updated_at`,
+		settings.UserID, settings.EmailFrequency).
+		Scan(&settings.UpdatedAt)
+}
+
+func (p *PostgresDB) ListDigestRecipients(ctx context.Context, frequency string, sentBefore time.Time) ([]models.NotificationSettings, error) {
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT user_id, email_frequency, last_digest_at, updated_at
+		 FROM notification_settings
+		 WHERE email_frequency = $1 AND (last_digest_at IS NULL OR last_digest_at < $2)
+		 ORDER BY user_id`, frequency, sentBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var recipients []models.NotificationSettings
+	for rows.Next() {
+		var settings models.NotificationSettings
+		var lastDigestAt sql.NullTime
+		if err := rows.Scan(&settings.UserID, &settings.EmailFrequency, &lastDigestAt, &settings.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if lastDigestAt.Valid {
+			t := lastDigestAt.Time
+			settings.LastDigestAt = &t
+		}
+		recipients = append(recipients, settings)
+	}
+	return recipients, rows.Err()
+}
+
+func (p *PostgresDB) SetNotificationDigestSent(ctx context.Context, userID int64, sentAt time.Time) error {
 	_, err := p.db.ExecContext(ctx,
-		`UPDATE notifications SET read_at = NOW() WHERE id = $1 AND user_id = $2 AND read_at IS NULL`,
-		id, userID)
+		`UPDATE notification_settings SET last_digest_at = $1 WHERE user_id = $2`,
+		sentAt, userID)
 	return err
 }
 
-func (p *PostgresDB) MarkAllNotificationsRead(ctx context.Context, userID int64) error {
+func (p *PostgresDB) ListUnemailedNotifications(ctx context.Context, userID int64, limit int) ([]models.Notification, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT n.id, n.user_id, n.actor_id, a.username, n.type, n.title, n.body, n.resource_path, n.repo_id, n.pr_id, n.issue_id, n.reason, n.read_at, n.created_at
+		 FROM notifications n
+		 JOIN users a ON a.id = n.actor_id
+		 WHERE n.user_id = $1 AND n.read_at IS NULL AND n.emailed_at IS NULL
+		 ORDER BY n.created_at ASC, n.id ASC
+		 LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanPostgresNotificationRows(rows)
+}
+
+func (p *PostgresDB) MarkNotificationsEmailed(ctx context.Context, userID int64, ids []int64, emailedAt time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := []any{emailedAt, userID}
+	placeholders := make([]string, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
 	_, err := p.db.ExecContext(ctx,
-		`UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`,
-		userID)
+		`UPDATE notifications SET emailed_at = $1
+		 WHERE user_id = $2 AND emailed_at IS NULL AND id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
 	return err
 }
 
+func (p *PostgresDB) CountPRsAwaitingReview(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := p.db.QueryRowContext(ctx,
+		`SELECT COUNT(*)
+		 FROM thread_subscriptions ts
+		 JOIN pull_requests pr ON pr.id = ts.thread_id
+		 WHERE ts.user_id = $1 AND ts.thread_type = $2 AND ts.reason = $3 AND pr.state = 'open'
+			 AND NOT EXISTS (
+				 SELECT 1 FROM pr_reviews r
+				 WHERE r.pr_id = pr.id AND r.author_id = ts.user_id AND r.created_at >= ts.updated_at
+			 )`,
+		userID, models.ThreadTypePullRequest, models.SubscriptionReasonReviewRequested).Scan(&count)
+	return count, err
+}
+
+func (p *PostgresDB) CountPRsWithFailingChecks(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := p.db.QueryRowContext(ctx,
+		`SELECT COUNT(*)
+		 FROM pull_requests pr
+		 WHERE pr.author_id = $1 AND pr.state = 'open'
+			 AND EXISTS (
+				 SELECT 1 FROM pr_check_runs c
+				 WHERE c.pr_id = pr.id AND c.status = 'completed' AND c.conclusion IN ('failure', 'timed_out', 'action_required')
+			 )`,
+		userID).Scan(&count)
+	return count, err
+}
+
 // --- Branch Protection ---
 
 func (p *PostgresDB) UpsertBranchProtectionRule(ctx context.Context, rule *models.BranchProtectionRule) error {
@@ -2361,6 +4156,98 @@ func (p *PostgresDB) TouchRepoRunnerTokenUsed(ctx context.Context, tokenID int64
 	return err
 }
 
+func (p *PostgresDB) CreateRepoDeployKey(ctx context.Context, key *models.RepoDeployKey) error {
+	tenantID := tenantIDForContext(ctx)
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO repo_deploy_keys (
+			repo_id, name, kind, read_only, fingerprint, public_key, key_type, token_hash, token_prefix, created_by_user_id, expires_at, revoked_at, tenant_id
+		)
+		 SELECT r.id, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+		 FROM repositories r
+		 WHERE r.id = $1 AND r.tenant_id = $13
+		 RETURNING id, created_at, last_used_at`,
+		key.RepoID, key.Name, key.Kind, key.ReadOnly, key.Fingerprint, key.PublicKey, key.KeyType, key.TokenHash, key.TokenPrefix,
+		key.CreatedByUserID, key.ExpiresAt, key.RevokedAt, tenantID).
+		Scan(&key.ID, &key.CreatedAt, &key.LastUsedAt)
+}
+
+func (p *PostgresDB) ListRepoDeployKeys(ctx context.Context, repoID int64) ([]models.RepoDeployKey, error) {
+	tenantID := tenantIDForContext(ctx)
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT `+repoDeployKeyColumns+`
+		 FROM repo_deploy_keys
+		 WHERE repo_id = $1 AND tenant_id = $2
+		 ORDER BY created_at DESC, id DESC`,
+		repoID, tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]models.RepoDeployKey, 0)
+	for rows.Next() {
+		key, err := scanRepoDeployKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (p *PostgresDB) DeleteRepoDeployKey(ctx context.Context, repoID, keyID int64) error {
+	tenantID := tenantIDForContext(ctx)
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE repo_deploy_keys
+		 SET revoked_at = COALESCE(revoked_at, NOW())
+		 WHERE repo_id = $1 AND id = $2 AND tenant_id = $3`,
+		repoID, keyID, tenantID,
+	)
+	return err
+}
+
+func (p *PostgresDB) GetRepoDeployKeyByID(ctx context.Context, keyID int64) (*models.RepoDeployKey, error) {
+	tenantID := tenantIDForContext(ctx)
+	return scanRepoDeployKey(p.db.QueryRowContext(ctx,
+		`SELECT `+repoDeployKeyColumns+` FROM repo_deploy_keys WHERE id = $1 AND tenant_id = $2`,
+		keyID, tenantID,
+	))
+}
+
+func (p *PostgresDB) GetRepoDeployKeyByTokenHash(ctx context.Context, tokenHash string) (*models.RepoDeployKey, error) {
+	tenantID := tenantIDForContext(ctx)
+	return scanRepoDeployKey(p.db.QueryRowContext(ctx,
+		`SELECT `+repoDeployKeyColumns+`
+		 FROM repo_deploy_keys
+		 WHERE kind = 'token' AND token_hash = $1 AND tenant_id = $2`,
+		tokenHash, tenantID,
+	))
+}
+
+func (p *PostgresDB) GetRepoDeployKeyByFingerprint(ctx context.Context, fingerprint string) (*models.RepoDeployKey, error) {
+	tenantID := tenantIDForContext(ctx)
+	return scanRepoDeployKey(p.db.QueryRowContext(ctx,
+		`SELECT `+repoDeployKeyColumns+`
+		 FROM repo_deploy_keys
+		 WHERE kind = 'ssh' AND fingerprint = $1 AND revoked_at IS NULL AND tenant_id = $2
+		 ORDER BY id DESC
+		 LIMIT 1`,
+		fingerprint, tenantID,
+	))
+}
+
+func (p *PostgresDB) TouchRepoDeployKeyUsed(ctx context.Context, keyID int64, usedAt time.Time) error {
+	tenantID := tenantIDForContext(ctx)
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE repo_deploy_keys
+		 SET last_used_at = $1
+		 WHERE id = $2 AND tenant_id = $3`,
+		usedAt, keyID, tenantID,
+	)
+	return err
+}
+
 // --- Webhooks ---
 
 func (p *PostgresDB) CreateWebhook(ctx context.Context, hook *models.Webhook) error {
@@ -2371,29 +4258,212 @@ func (p *PostgresDB) CreateWebhook(ctx context.Context, hook *models.Webhook) er
 		 FROM repositories r
 		 WHERE r.id = $1 AND r.tenant_id = $6
 		 RETURNING id, created_at, updated_at`,
-		hook.RepoID, hook.URL, hook.Secret, hook.EventsCSV, hook.Active, tenantID).
+		hook.RepoID, hook.URL, hook.Secret, hook.EventsCSV, hook.Active, tenantID).
+		Scan(&hook.ID, &hook.CreatedAt, &hook.UpdatedAt)
+}
+
+func (p *PostgresDB) GetWebhook(ctx context.Context, repoID, webhookID int64) (*models.Webhook, error) {
+	tenantID := tenantIDForContext(ctx)
+	hook := &models.Webhook{}
+	var failingSince, disabledAt, previousSecretExpiresAt sql.NullTime
+	err := p.db.QueryRowContext(ctx,
+		`SELECT id, repo_id, url, secret, events_csv, active, failing_since, disabled_at, disabled_reason, previous_secret, previous_secret_expires_at, timestamped_signature, created_at, updated_at
+		 FROM repo_webhooks
+		 WHERE repo_id = $1 AND id = $2 AND tenant_id = $3`, repoID, webhookID, tenantID).
+		Scan(&hook.ID, &hook.RepoID, &hook.URL, &hook.Secret, &hook.EventsCSV, &hook.Active, &failingSince, &disabledAt, &hook.DisabledReason, &hook.PreviousSecret, &previousSecretExpiresAt, &hook.TimestampedSignature, &hook.CreatedAt, &hook.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	setWebhookTimes(hook, failingSince, disabledAt, previousSecretExpiresAt)
+	return hook, nil
+}
+
+func (p *PostgresDB) ListWebhooks(ctx context.Context, repoID int64) ([]models.Webhook, error) {
+	return p.ListWebhooksPage(ctx, repoID, 1<<30, 0)
+}
+
+func (p *PostgresDB) ListWebhooksPage(ctx context.Context, repoID int64, limit, offset int) ([]models.Webhook, error) {
+	tenantID := tenantIDForContext(ctx)
+	if limit <= 0 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT id, repo_id, url, secret, events_csv, active, failing_since, disabled_at, disabled_reason, previous_secret, previous_secret_expires_at, timestamped_signature, created_at, updated_at
+		 FROM repo_webhooks
+		 WHERE repo_id = $1 AND tenant_id = $2
+		 ORDER BY id DESC
+		 LIMIT $3 OFFSET $4`, repoID, tenantID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var hooks []models.Webhook
+	for rows.Next() {
+		var hook models.Webhook
+		var failingSince, disabledAt, previousSecretExpiresAt sql.NullTime
+		if err := rows.Scan(&hook.ID, &hook.RepoID, &hook.URL, &hook.Secret, &hook.EventsCSV, &hook.Active, &failingSince, &disabledAt, &hook.DisabledReason, &hook.PreviousSecret, &previousSecretExpiresAt, &hook.TimestampedSignature, &hook.CreatedAt, &hook.UpdatedAt); err != nil {
+			return nil, err
+		}
+		setWebhookTimes(&hook, failingSince, disabledAt, previousSecretExpiresAt)
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+// UpdateWebhook saves the hook's mutable settings, including its delivery
+// failure and disable state.
+func (p *PostgresDB) UpdateWebhook(ctx context.Context, hook *models.Webhook) error {
+	tenantID := tenantIDForContext(ctx)
+	return p.db.QueryRowContext(ctx,
+		`UPDATE repo_webhooks
+		 SET url = $1, secret = $2, previous_secret = $3, previous_secret_expires_at = $4, events_csv = $5, active = $6, timestamped_signature = $7,
+		     failing_since = $8, disabled_at = $9, disabled_reason = $10, updated_at = CURRENT_TIMESTAMP
+		 WHERE repo_id = $11 AND id = $12 AND tenant_id = $13
+		 RETURNING updated_at`,
+		hook.URL, hook.Secret, hook.PreviousSecret, hook.PreviousSecretExpiresAt, hook.EventsCSV, hook.Active, hook.TimestampedSignature,
+		hook.FailingSince, hook.DisabledAt, hook.DisabledReason, hook.RepoID, hook.ID, tenantID).Scan(&hook.UpdatedAt)
+}
+
+func (p *PostgresDB) DeleteWebhook(ctx context.Context, repoID, webhookID int64) error {
+	tenantID := tenantIDForContext(ctx)
+	_, err := p.db.ExecContext(ctx,
+		`DELETE FROM repo_webhooks WHERE repo_id = $1 AND id = $2 AND tenant_id = $3`, repoID, webhookID, tenantID)
+	return err
+}
+
+func (p *PostgresDB) RecordWebhookFailure(ctx context.Context, repoID, webhookID int64) (time.Time, error) {
+	tenantID := tenantIDForContext(ctx)
+	var since time.Time
+	err := p.db.QueryRowContext(ctx,
+		`UPDATE repo_webhooks SET failing_since = COALESCE(failing_since, NOW())
+		 WHERE repo_id = $1 AND id = $2 AND tenant_id = $3
+		 RETURNING failing_since`, repoID, webhookID, tenantID).Scan(&since)
+	return since, err
+}
+
+func (p *PostgresDB) ClearWebhookFailure(ctx context.Context, repoID, webhookID int64) error {
+	tenantID := tenantIDForContext(ctx)
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE repo_webhooks SET failing_since = NULL
+		 WHERE repo_id = $1 AND id = $2 AND tenant_id = $3 AND failing_since IS NOT NULL`, repoID, webhookID, tenantID)
+	return err
+}
+
+func (p *PostgresDB) DisableWebhook(ctx context.Context, repoID, webhookID int64, reason string) error {
+	tenantID := tenantIDForContext(ctx)
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE repo_webhooks
+		 SET active = FALSE, disabled_at = NOW(), disabled_reason = $1, failing_since = NULL, updated_at = NOW()
+		 WHERE repo_id = $2 AND id = $3 AND tenant_id = $4`, reason, repoID, webhookID, tenantID)
+	return err
+}
+
+func (p *PostgresDB) CreateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	tenantID := tenantIDForContext(ctx)
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO webhook_deliveries (
+			 repo_id, webhook_id, event, delivery_uid, attempt, status_code, success, error, request_body, response_body, duration_ms, redelivery_of_id, tenant_id
+		 )
+		 SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+		 WHERE EXISTS (
+			 SELECT 1
+			 FROM repo_webhooks h
+			 WHERE h.repo_id = $1
+				AND h.id = $2
+				AND h.tenant_id = $13
+		 )
+		 RETURNING id, created_at`,
+		delivery.RepoID, delivery.WebhookID, delivery.Event, delivery.DeliveryUID, delivery.Attempt, delivery.StatusCode,
+		delivery.Success, delivery.Error, delivery.RequestBody, delivery.ResponseBody, delivery.DurationMS, delivery.RedeliveryOfID, tenantID).
+		Scan(&delivery.ID, &delivery.CreatedAt)
+}
+
+func (p *PostgresDB) GetWebhookDelivery(ctx context.Context, repoID, webhookID, deliveryID int64) (*models.WebhookDelivery, error) {
+	tenantID := tenantIDForContext(ctx)
+	d := &models.WebhookDelivery{}
+	err := p.db.QueryRowContext(ctx,
+		`SELECT id, repo_id, webhook_id, event, delivery_uid, attempt, status_code, success, error, request_body, response_body, duration_ms, redelivery_of_id, created_at
+		 FROM webhook_deliveries
+		 WHERE repo_id = $1 AND webhook_id = $2 AND id = $3 AND tenant_id = $4`,
+		repoID, webhookID, deliveryID, tenantID).
+		Scan(&d.ID, &d.RepoID, &d.WebhookID, &d.Event, &d.DeliveryUID, &d.Attempt, &d.StatusCode, &d.Success, &d.Error,
+			&d.RequestBody, &d.ResponseBody, &d.DurationMS, &d.RedeliveryOfID, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (p *PostgresDB) ListWebhookDeliveries(ctx context.Context, repoID, webhookID int64) ([]models.WebhookDelivery, error) {
+	return p.ListWebhookDeliveriesPage(ctx, repoID, webhookID, 1<<30, 0)
+}
+
+func (p *PostgresDB) ListWebhookDeliveriesPage(ctx context.Context, repoID, webhookID int64, limit, offset int) ([]models.WebhookDelivery, error) {
+	tenantID := tenantIDForContext(ctx)
+	if limit <= 0 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT id, repo_id, webhook_id, event, delivery_uid, attempt, status_code, success, error, request_body, response_body, duration_ms, redelivery_of_id, created_at
+		 FROM webhook_deliveries
+		 WHERE repo_id = $1 AND webhook_id = $2 AND tenant_id = $3
+		 ORDER BY id DESC
+		 LIMIT $4 OFFSET $5`, repoID, webhookID, tenantID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.RepoID, &d.WebhookID, &d.Event, &d.DeliveryUID, &d.Attempt, &d.StatusCode, &d.Success, &d.Error,
+			&d.RequestBody, &d.ResponseBody, &d.DurationMS, &d.RedeliveryOfID, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (p *PostgresDB) CreateOrgWebhook(ctx context.Context, hook *models.Webhook) error {
+	tenantID := tenantIDForContext(ctx)
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO org_webhooks (org_id, url, secret, events_csv, active, tenant_id)
+		 SELECT o.id, $2, $3, $4, $5, $6
+		 FROM orgs o
+		 WHERE o.id = $1 AND o.tenant_id = $6
+		 RETURNING id, created_at, updated_at`,
+		hook.OrgID, hook.URL, hook.Secret, hook.EventsCSV, hook.Active, tenantID).
 		Scan(&hook.ID, &hook.CreatedAt, &hook.UpdatedAt)
 }
 
-func (p *PostgresDB) GetWebhook(ctx context.Context, repoID, webhookID int64) (*models.Webhook, error) {
+func (p *PostgresDB) GetOrgWebhook(ctx context.Context, orgID, webhookID int64) (*models.Webhook, error) {
 	tenantID := tenantIDForContext(ctx)
 	hook := &models.Webhook{}
+	var failingSince, disabledAt, previousSecretExpiresAt sql.NullTime
 	err := p.db.QueryRowContext(ctx,
-		`SELECT id, repo_id, url, secret, events_csv, active, created_at, updated_at
-		 FROM repo_webhooks
-		 WHERE repo_id = $1 AND id = $2 AND tenant_id = $3`, repoID, webhookID, tenantID).
-		Scan(&hook.ID, &hook.RepoID, &hook.URL, &hook.Secret, &hook.EventsCSV, &hook.Active, &hook.CreatedAt, &hook.UpdatedAt)
+		`SELECT id, org_id, url, secret, events_csv, active, failing_since, disabled_at, disabled_reason, previous_secret, previous_secret_expires_at, timestamped_signature, created_at, updated_at
+		 FROM org_webhooks
+		 WHERE org_id = $1 AND id = $2 AND tenant_id = $3`, orgID, webhookID, tenantID).
+		Scan(&hook.ID, &hook.OrgID, &hook.URL, &hook.Secret, &hook.EventsCSV, &hook.Active, &failingSince, &disabledAt, &hook.DisabledReason, &hook.PreviousSecret, &previousSecretExpiresAt, &hook.TimestampedSignature, &hook.CreatedAt, &hook.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
+	setWebhookTimes(hook, failingSince, disabledAt, previousSecretExpiresAt)
 	return hook, nil
 }
 
-func (p *PostgresDB) ListWebhooks(ctx context.Context, repoID int64) ([]models.Webhook, error) {
-	return p.ListWebhooksPage(ctx, repoID, 1<<30, 0)
+func (p *PostgresDB) ListOrgWebhooks(ctx context.Context, orgID int64) ([]models.Webhook, error) {
+	return p.ListOrgWebhooksPage(ctx, orgID, 1<<30, 0)
 }
 
-func (p *PostgresDB) ListWebhooksPage(ctx context.Context, repoID int64, limit, offset int) ([]models.Webhook, error) {
+func (p *PostgresDB) ListOrgWebhooksPage(ctx context.Context, orgID int64, limit, offset int) ([]models.Webhook, error) {
 	tenantID := tenantIDForContext(ctx)
 	if limit <= 0 {
 		limit = 100
@@ -2402,11 +4472,11 @@ func (p *PostgresDB) ListWebhooksPage(ctx context.Context, repoID int64, limit,
 		offset = 0
 	}
 	rows, err := p.db.QueryContext(ctx,
-		`SELECT id, repo_id, url, secret, events_csv, active, created_at, updated_at
-		 FROM repo_webhooks
-		 WHERE repo_id = $1 AND tenant_id = $2
+		`SELECT id, org_id, url, secret, events_csv, active, failing_since, disabled_at, disabled_reason, previous_secret, previous_secret_expires_at, timestamped_signature, created_at, updated_at
+		 FROM org_webhooks
+		 WHERE org_id = $1 AND tenant_id = $2
 		 ORDER BY id DESC
-		 LIMIT $3 OFFSET $4`, repoID, tenantID, limit, offset)
+		 LIMIT $3 OFFSET $4`, orgID, tenantID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -2414,50 +4484,91 @@ func (p *PostgresDB) ListWebhooksPage(ctx context.Context, repoID int64, limit,
 	var hooks []models.Webhook
 	for rows.Next() {
 		var hook models.Webhook
-		if err := rows.Scan(&hook.ID, &hook.RepoID, &hook.URL, &hook.Secret, &hook.EventsCSV, &hook.Active, &hook.CreatedAt, &hook.UpdatedAt); err != nil {
+		var failingSince, disabledAt, previousSecretExpiresAt sql.NullTime
+		if err := rows.Scan(&hook.ID, &hook.OrgID, &hook.URL, &hook.Secret, &hook.EventsCSV, &hook.Active, &failingSince, &disabledAt, &hook.DisabledReason, &hook.PreviousSecret, &previousSecretExpiresAt, &hook.TimestampedSignature, &hook.CreatedAt, &hook.UpdatedAt); err != nil {
 			return nil, err
 		}
+		setWebhookTimes(&hook, failingSince, disabledAt, previousSecretExpiresAt)
 		hooks = append(hooks, hook)
 	}
 	return hooks, rows.Err()
 }
 
-func (p *PostgresDB) DeleteWebhook(ctx context.Context, repoID, webhookID int64) error {
+func (p *PostgresDB) UpdateOrgWebhook(ctx context.Context, hook *models.Webhook) error {
+	tenantID := tenantIDForContext(ctx)
+	return p.db.QueryRowContext(ctx,
+		`UPDATE org_webhooks
+		 SET url = $1, secret = $2, previous_secret = $3, previous_secret_expires_at = $4, events_csv = $5, active = $6, timestamped_signature = $7,
+		     failing_since = $8, disabled_at = $9, disabled_reason = $10, updated_at = CURRENT_TIMESTAMP
+		 WHERE org_id = $11 AND id = $12 AND tenant_id = $13
+		 RETURNING updated_at`,
+		hook.URL, hook.Secret, hook.PreviousSecret, hook.PreviousSecretExpiresAt, hook.EventsCSV, hook.Active, hook.TimestampedSignature,
+		hook.FailingSince, hook.DisabledAt, hook.DisabledReason, hook.OrgID, hook.ID, tenantID).Scan(&hook.UpdatedAt)
+}
+
+func (p *PostgresDB) DeleteOrgWebhook(ctx context.Context, orgID, webhookID int64) error {
 	tenantID := tenantIDForContext(ctx)
 	_, err := p.db.ExecContext(ctx,
-		`DELETE FROM repo_webhooks WHERE repo_id = $1 AND id = $2 AND tenant_id = $3`, repoID, webhookID, tenantID)
+		`DELETE FROM org_webhooks WHERE org_id = $1 AND id = $2 AND tenant_id = $3`, orgID, webhookID, tenantID)
 	return err
 }
 
-func (p *PostgresDB) CreateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+func (p *PostgresDB) RecordOrgWebhookFailure(ctx context.Context, orgID, webhookID int64) (time.Time, error) {
+	tenantID := tenantIDForContext(ctx)
+	var since time.Time
+	err := p.db.QueryRowContext(ctx,
+		`UPDATE org_webhooks SET failing_since = COALESCE(failing_since, NOW())
+		 WHERE org_id = $1 AND id = $2 AND tenant_id = $3
+		 RETURNING failing_since`, orgID, webhookID, tenantID).Scan(&since)
+	return since, err
+}
+
+func (p *PostgresDB) ClearOrgWebhookFailure(ctx context.Context, orgID, webhookID int64) error {
+	tenantID := tenantIDForContext(ctx)
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE org_webhooks SET failing_since = NULL
+		 WHERE org_id = $1 AND id = $2 AND tenant_id = $3 AND failing_since IS NOT NULL`, orgID, webhookID, tenantID)
+	return err
+}
+
+func (p *PostgresDB) DisableOrgWebhook(ctx context.Context, orgID, webhookID int64, reason string) error {
+	tenantID := tenantIDForContext(ctx)
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE org_webhooks
+		 SET active = FALSE, disabled_at = NOW(), disabled_reason = $1, failing_since = NULL, updated_at = NOW()
+		 WHERE org_id = $2 AND id = $3 AND tenant_id = $4`, reason, orgID, webhookID, tenantID)
+	return err
+}
+
+func (p *PostgresDB) CreateOrgWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
 	tenantID := tenantIDForContext(ctx)
 	return p.db.QueryRowContext(ctx,
-		`INSERT INTO webhook_deliveries (
-			 repo_id, webhook_id, event, delivery_uid, attempt, status_code, success, error, request_body, response_body, duration_ms, redelivery_of_id, tenant_id
+		`INSERT INTO org_webhook_deliveries (
+			 org_id, webhook_id, repo_id, event, delivery_uid, attempt, status_code, success, error, request_body, response_body, duration_ms, redelivery_of_id, tenant_id
 		 )
-		 SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+		 SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14
 		 WHERE EXISTS (
 			 SELECT 1
-			 FROM repo_webhooks h
-			 WHERE h.repo_id = $1
+			 FROM org_webhooks h
+			 WHERE h.org_id = $1
 				AND h.id = $2
-				AND h.tenant_id = $13
+				AND h.tenant_id = $14
 		 )
 		 RETURNING id, created_at`,
-		delivery.RepoID, delivery.WebhookID, delivery.Event, delivery.DeliveryUID, delivery.Attempt, delivery.StatusCode,
+		delivery.OrgID, delivery.WebhookID, delivery.RepoID, delivery.Event, delivery.DeliveryUID, delivery.Attempt, delivery.StatusCode,
 		delivery.Success, delivery.Error, delivery.RequestBody, delivery.ResponseBody, delivery.DurationMS, delivery.RedeliveryOfID, tenantID).
 		Scan(&delivery.ID, &delivery.CreatedAt)
 }
 
-func (p *PostgresDB) GetWebhookDelivery(ctx context.Context, repoID, webhookID, deliveryID int64) (*models.WebhookDelivery, error) {
+func (p *PostgresDB) GetOrgWebhookDelivery(ctx context.Context, orgID, webhookID, deliveryID int64) (*models.WebhookDelivery, error) {
 	tenantID := tenantIDForContext(ctx)
 	d := &models.WebhookDelivery{}
 	err := p.db.QueryRowContext(ctx,
-		`SELECT id, repo_id, webhook_id, event, delivery_uid, attempt, status_code, success, error, request_body, response_body, duration_ms, redelivery_of_id, created_at
-		 FROM webhook_deliveries
-		 WHERE repo_id = $1 AND webhook_id = $2 AND id = $3 AND tenant_id = $4`,
-		repoID, webhookID, deliveryID, tenantID).
-		Scan(&d.ID, &d.RepoID, &d.WebhookID, &d.Event, &d.DeliveryUID, &d.Attempt, &d.StatusCode, &d.Success, &d.Error,
+		`SELECT id, org_id, webhook_id, repo_id, event, delivery_uid, attempt, status_code, success, error, request_body, response_body, duration_ms, redelivery_of_id, created_at
+		 FROM org_webhook_deliveries
+		 WHERE org_id = $1 AND webhook_id = $2 AND id = $3 AND tenant_id = $4`,
+		orgID, webhookID, deliveryID, tenantID).
+		Scan(&d.ID, &d.OrgID, &d.WebhookID, &d.RepoID, &d.Event, &d.DeliveryUID, &d.Attempt, &d.StatusCode, &d.Success, &d.Error,
 			&d.RequestBody, &d.ResponseBody, &d.DurationMS, &d.RedeliveryOfID, &d.CreatedAt)
 	if err != nil {
 		return nil, err
@@ -2465,11 +4576,7 @@ func (p *PostgresDB) GetWebhookDelivery(ctx context.Context, repoID, webhookID,
 	return d, nil
 }
 
-func (p *PostgresDB) ListWebhookDeliveries(ctx context.Context, repoID, webhookID int64) ([]models.WebhookDelivery, error) {
-	return p.ListWebhookDeliveriesPage(ctx, repoID, webhookID, 1<<30, 0)
-}
-
-func (p *PostgresDB) ListWebhookDeliveriesPage(ctx context.Context, repoID, webhookID int64, limit, offset int) ([]models.WebhookDelivery, error) {
+func (p *PostgresDB) ListOrgWebhookDeliveriesPage(ctx context.Context, orgID, webhookID int64, limit, offset int) ([]models.WebhookDelivery, error) {
 	tenantID := tenantIDForContext(ctx)
 	if limit <= 0 {
 		limit = 100
@@ -2478,11 +4585,11 @@ func (p *PostgresDB) ListWebhookDeliveriesPage(ctx context.Context, repoID, webh
 		offset = 0
 	}
 	rows, err := p.db.QueryContext(ctx,
-		`SELECT id, repo_id, webhook_id, event, delivery_uid, attempt, status_code, success, error, request_body, response_body, duration_ms, redelivery_of_id, created_at
-		 FROM webhook_deliveries
-		 WHERE repo_id = $1 AND webhook_id = $2 AND tenant_id = $3
+		`SELECT id, org_id, webhook_id, repo_id, event, delivery_uid, attempt, status_code, success, error, request_body, response_body, duration_ms, redelivery_of_id, created_at
+		 FROM org_webhook_deliveries
+		 WHERE org_id = $1 AND webhook_id = $2 AND tenant_id = $3
 		 ORDER BY id DESC
-		 LIMIT $4 OFFSET $5`, repoID, webhookID, tenantID, limit, offset)
+		 LIMIT $4 OFFSET $5`, orgID, webhookID, tenantID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -2490,7 +4597,7 @@ func (p *PostgresDB) ListWebhookDeliveriesPage(ctx context.Context, repoID, webh
 	var deliveries []models.WebhookDelivery
 	for rows.Next() {
 		var d models.WebhookDelivery
-		if err := rows.Scan(&d.ID, &d.RepoID, &d.WebhookID, &d.Event, &d.DeliveryUID, &d.Attempt, &d.StatusCode, &d.Success, &d.Error,
+		if err := rows.Scan(&d.ID, &d.OrgID, &d.WebhookID, &d.RepoID, &d.Event, &d.DeliveryUID, &d.Attempt, &d.StatusCode, &d.Success, &d.Error,
 			&d.RequestBody, &d.ResponseBody, &d.DurationMS, &d.RedeliveryOfID, &d.CreatedAt); err != nil {
 			return nil, err
 		}
@@ -2675,6 +4782,60 @@ func (p *PostgresDB) GetMergeBaseCache(ctx context.Context, repoID int64, leftHa
 	return baseHash, true, nil
 }
 
+func (p *PostgresDB) UpsertCommitVerification(ctx context.Context, v *models.CommitVerification) error {
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO commit_verifications (repo_id, commit_hash, status, signature_type, key_id, fingerprint, signer_user_id, signed_by_server)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		 ON CONFLICT(repo_id, commit_hash) DO UPDATE SET
+			 status = EXCLUDED.status,
+			 signature_type = EXCLUDED.signature_type,
+			 key_id = EXCLUDED.key_id,
+			 fingerprint = EXCLUDED.fingerprint,
+			 signer_user_id = EXCLUDED.signer_user_id,
+			 signed_by_server = EXCLUDED.signed_by_server,
+			 verified_at = NOW()
+		 RETURNING verified_at`,
+		v.RepoID, v.CommitHash, v.Status, v.SignatureType, v.KeyID, v.Fingerprint, v.SignerUserID, v.SignedByServer,
+	).Scan(&v.VerifiedAt)
+}
+
+func (p *PostgresDB) GetCommitVerification(ctx context.Context, repoID int64, commitHash string) (*models.CommitVerification, error) {
+	v := &models.CommitVerification{}
+	var signerID sql.NullInt64
+	var signerName sql.NullString
+	err := p.db.QueryRowContext(ctx,
+		`SELECT cv.repo_id, cv.commit_hash, cv.status, cv.signature_type, cv.key_id, cv.fingerprint, cv.signer_user_id, u.username, cv.signed_by_server, cv.verified_at
+		 FROM commit_verifications cv
+		 LEFT JOIN users u ON u.id = cv.signer_user_id
+		 WHERE cv.repo_id = $1 AND cv.commit_hash = $2`, repoID, commitHash).
+		Scan(&v.RepoID, &v.CommitHash, &v.Status, &v.SignatureType, &v.KeyID, &v.Fingerprint, &signerID, &signerName, &v.SignedByServer, &v.VerifiedAt)
+	if err != nil {
+		return nil, err
+	}
+	if signerID.Valid {
+		v.SignerUserID = &signerID.Int64
+		v.SignerName = signerName.String
+	}
+	return v, nil
+}
+
+// DeleteCommitVerificationsByKeyIDs drops cached verifications made with, or
+// waiting on, any of the given key IDs so they are re-checked after a key is
+// added or removed.
+func (p *PostgresDB) DeleteCommitVerificationsByKeyIDs(ctx context.Context, keyIDs []string) error {
+	if len(keyIDs) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(keyIDs))
+	placeholders := make([]string, 0, len(keyIDs))
+	for _, id := range keyIDs {
+		args = append(args, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	_, err := p.db.ExecContext(ctx, `DELETE FROM commit_verifications WHERE key_id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	return err
+}
+
 func (p *PostgresDB) EnqueueIndexingJob(ctx context.Context, job *models.IndexingJob) error {
 	if job == nil {
 		return fmt.Errorf("indexing job is nil")
@@ -2698,8 +4859,8 @@ func (p *PostgresDB) EnqueueIndexingJob(ctx context.Context, job *models.Indexin
 
 	row := p.db.QueryRowContext(ctx,
 		`INSERT INTO indexing_jobs (
-			 repo_id, commit_hash, job_type, status, attempt_count, max_attempts, last_error, next_attempt_at
-		 ) VALUES ($1, $2, $3, $4, 0, $5, '', $6)
+			 repo_id, commit_hash, job_type, concurrency_key, payload, status, attempt_count, max_attempts, last_error, next_attempt_at
+		 ) VALUES ($1, $2, $3, $9, $10, $4, 0, $5, '', $6)
 		 ON CONFLICT (repo_id, commit_hash, job_type) DO UPDATE SET
 			 status = CASE
 				WHEN indexing_jobs.status = $7 THEN indexing_jobs.status
@@ -2721,9 +4882,10 @@ func (p *PostgresDB) EnqueueIndexingJob(ctx context.Context, job *models.Indexin
 				WHEN indexing_jobs.status = $7 THEN indexing_jobs.updated_at
 				ELSE NOW()
 			 END
-		 RETURNING id, repo_id, commit_hash, job_type, status, attempt_count, max_attempts, last_error, next_attempt_at, created_at, updated_at, started_at, completed_at`,
+		 RETURNING id, repo_id, commit_hash, job_type, concurrency_key, payload, status, attempt_count, max_attempts, last_error, next_attempt_at, created_at, updated_at, started_at, completed_at`,
 		job.RepoID, job.CommitHash, jobType, status, maxAttempts, nextAttemptAt,
 		models.IndexJobCompleted, models.IndexJobQueued,
+		job.ConcurrencyKey, job.Payload,
 	)
 
 	loaded, err := scanPostgresIndexingJob(row)
@@ -2734,14 +4896,30 @@ func (p *PostgresDB) EnqueueIndexingJob(ctx context.Context, job *models.Indexin
 	return nil
 }
 
-func (p *PostgresDB) ClaimIndexingJob(ctx context.Context) (*models.IndexingJob, error) {
+func (p *PostgresDB) ClaimIndexingJob(ctx context.Context, jobType models.IndexJobType, perKeyLimit int) (*models.IndexingJob, error) {
+	if perKeyLimit <= 0 {
+		perKeyLimit = 1
+	}
 	row := p.db.QueryRowContext(ctx,
 		`WITH next_job AS (
-			 SELECT id
-			 FROM indexing_jobs
-			 WHERE status = $1
-			   AND next_attempt_at <= NOW()
-			 ORDER BY next_attempt_at ASC, id ASC
+			 SELECT q.id
+			 FROM indexing_jobs q
+			 WHERE q.status = $1
+			   AND q.job_type = $3
+			   AND q.next_attempt_at <= NOW()
+			   AND (q.concurrency_key = '' OR (
+				   NOT EXISTS (
+					   SELECT 1 FROM indexing_jobs o
+					   WHERE o.job_type = q.job_type AND o.concurrency_key = q.concurrency_key
+						 AND o.status = $1 AND o.id < q.id
+				   )
+				   AND (
+					   SELECT COUNT(*) FROM indexing_jobs r
+					   WHERE r.job_type = q.job_type AND r.concurrency_key = q.concurrency_key
+						 AND r.status = $2
+				   ) < $4
+			   ))
+			 ORDER BY q.next_attempt_at ASC, q.id ASC
 			 LIMIT 1
 			 FOR UPDATE SKIP LOCKED
 		 )
@@ -2753,8 +4931,8 @@ func (p *PostgresDB) ClaimIndexingJob(ctx context.Context) (*models.IndexingJob,
 			 updated_at = NOW()
 		 FROM next_job
 		 WHERE j.id = next_job.id
-		 RETURNING j.id, j.repo_id, j.commit_hash, j.job_type, j.status, j.attempt_count, j.max_attempts, j.last_error, j.next_attempt_at, j.created_at, j.updated_at, j.started_at, j.completed_at`,
-		models.IndexJobQueued, models.IndexJobInProgress,
+		 RETURNING j.id, j.repo_id, j.commit_hash, j.job_type, j.concurrency_key, j.payload, j.status, j.attempt_count, j.max_attempts, j.last_error, j.next_attempt_at, j.created_at, j.updated_at, j.started_at, j.completed_at`,
+		models.IndexJobQueued, models.IndexJobInProgress, jobType, perKeyLimit,
 	)
 	job, err := scanPostgresIndexingJob(row)
 	if err != nil {
@@ -2835,9 +5013,65 @@ func (p *PostgresDB) RequeueIndexingJob(ctx context.Context, jobID int64, errMsg
 	return nil
 }
 
+// --- Outbound email queue ---
+
+func (p *PostgresDB) EnqueueOutboundEmail(ctx context.Context, email *models.OutboundEmail) error {
+	if email.Status == "" {
+		email.Status = models.OutboundEmailQueued
+	}
+	if email.NextAttemptAt.IsZero() {
+		email.NextAttemptAt = time.Now().UTC()
+	}
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO outbound_emails (recipient, subject, message, status, max_attempts, next_attempt_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING id, created_at`,
+		email.Recipient, email.Subject, email.Message, email.Status, email.MaxAttempts, email.NextAttemptAt,
+	).Scan(&email.ID, &email.CreatedAt)
+}
+
+func (p *PostgresDB) ClaimOutboundEmail(ctx context.Context, now, leaseUntil time.Time) (*models.OutboundEmail, error) {
+	row := p.db.QueryRowContext(ctx,
+		`WITH next_email AS (
+			 SELECT id FROM outbound_emails
+			 WHERE status IN ($3, $1) AND next_attempt_at <= $4
+			 ORDER BY next_attempt_at ASC, id ASC
+			 LIMIT 1
+			 FOR UPDATE SKIP LOCKED
+		 )
+		 UPDATE outbound_emails e
+		 SET status = $1, attempt_count = e.attempt_count + 1, next_attempt_at = $2
+		 FROM next_email
+		 WHERE e.id = next_email.id
+		 RETURNING e.id, e.recipient, e.subject, e.message, e.status, e.attempt_count, e.max_attempts, e.last_error, e.next_attempt_at, e.created_at, e.sent_at`,
+		models.OutboundEmailSending, leaseUntil, models.OutboundEmailQueued, now,
+	)
+	email, err := scanOutboundEmail(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return email, err
+}
+
+func (p *PostgresDB) CompleteOutboundEmail(ctx context.Context, id int64, status models.OutboundEmailStatus, errMsg string) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE outbound_emails
+		 SET status = $1, last_error = $2, message = '', sent_at = CASE WHEN $1 = 'sent' THEN NOW() ELSE sent_at END
+		 WHERE id = $3`,
+		status, errMsg, id)
+	return err
+}
+
+func (p *PostgresDB) RequeueOutboundEmail(ctx context.Context, id int64, errMsg string, nextAttemptAt time.Time) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE outbound_emails SET status = $1, last_error = $2, next_attempt_at = $3 WHERE id = $4`,
+		models.OutboundEmailQueued, errMsg, nextAttemptAt, id)
+	return err
+}
+
 func (p *PostgresDB) GetIndexingJobStatus(ctx context.Context, repoID int64, commitHash string) (*models.IndexingJob, error) {
 	row := p.db.QueryRowContext(ctx,
-		`SELECT id, repo_id, commit_hash, job_type, status, attempt_count, max_attempts, last_error, next_attempt_at, created_at, updated_at, started_at, completed_at
+		`SELECT id, repo_id, commit_hash, job_type, concurrency_key, payload, status, attempt_count, max_attempts, last_error, next_attempt_at, created_at, updated_at, started_at, completed_at
 		 FROM indexing_jobs
 		 WHERE repo_id = $1 AND commit_hash = $2
 		 ORDER BY created_at DESC, id DESC
@@ -2865,6 +5099,8 @@ func scanPostgresIndexingJob(row *sql.Row) (*models.IndexingJob, error) {
 		&job.RepoID,
 		&job.CommitHash,
 		&jobType,
+		&job.ConcurrencyKey,
+		&job.Payload,
 		&status,
 		&job.AttemptCount,
 		&job.MaxAttempts,
@@ -2975,6 +5211,19 @@ func (p *PostgresDB) UpsertEntityIdentity(ctx context.Context, identity *models.
 	return err
 }
 
+func (p *PostgresDB) GetEntityIdentity(ctx context.Context, repoID int64, stableID string) (*models.EntityIdentity, error) {
+	identity := &models.EntityIdentity{}
+	err := p.db.QueryRowContext(ctx,
+		`SELECT repo_id, stable_id, name, decl_kind, receiver, first_seen_commit, last_seen_commit, created_at, updated_at
+		 FROM entity_identities
+		 WHERE repo_id = $1 AND stable_id = $2`, repoID, stableID).
+		Scan(&identity.RepoID, &identity.StableID, &identity.Name, &identity.DeclKind, &identity.Receiver, &identity.FirstSeenCommit, &identity.LastSeenCommit, &identity.CreatedAt, &identity.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
 func (p *PostgresDB) SetEntityVersion(ctx context.Context, version *models.EntityVersion) error {
 	_, err := p.db.ExecContext(ctx,
 		`INSERT INTO entity_versions
@@ -3564,17 +5813,20 @@ func (p *PostgresDB) ListXRefEdgesTo(ctx context.Context, repoID int64, commitHa
 
 func (p *PostgresDB) CreateOrg(ctx context.Context, o *models.Org) error {
 	tenantID := tenantIDForContext(ctx)
+	if o.DefaultRepoPermission == "" {
+		o.DefaultRepoPermission = "write"
+	}
 	return p.db.QueryRowContext(ctx,
-		`INSERT INTO orgs (name, display_name, tenant_id) VALUES ($1, $2, $3) RETURNING id`,
-		o.Name, o.DisplayName, tenantID).Scan(&o.ID)
+		`INSERT INTO orgs (name, display_name, default_repo_permission, tenant_id) VALUES ($1, $2, $3, $4) RETURNING id`,
+		o.Name, o.DisplayName, o.DefaultRepoPermission, tenantID).Scan(&o.ID)
 }
 
 func (p *PostgresDB) GetOrg(ctx context.Context, name string) (*models.Org, error) {
 	tenantID := tenantIDForContext(ctx)
 	o := &models.Org{}
 	err := p.db.QueryRowContext(ctx,
-		`SELECT id, name, display_name FROM orgs WHERE name = $1 AND tenant_id = $2`, name, tenantID).
-		Scan(&o.ID, &o.Name, &o.DisplayName)
+		`SELECT id, name, display_name, require_two_factor, default_repo_permission FROM orgs WHERE name = $1 AND tenant_id = $2`, name, tenantID).
+		Scan(&o.ID, &o.Name, &o.DisplayName, &o.RequireTwoFactor, &o.DefaultRepoPermission)
 	if err != nil {
 		return nil, err
 	}
@@ -3585,8 +5837,8 @@ func (p *PostgresDB) GetOrgByID(ctx context.Context, id int64) (*models.Org, err
 	tenantID := tenantIDForContext(ctx)
 	o := &models.Org{}
 	err := p.db.QueryRowContext(ctx,
-		`SELECT id, name, display_name FROM orgs WHERE id = $1 AND tenant_id = $2`, id, tenantID).
-		Scan(&o.ID, &o.Name, &o.DisplayName)
+		`SELECT id, name, display_name, require_two_factor, default_repo_permission FROM orgs WHERE id = $1 AND tenant_id = $2`, id, tenantID).
+		Scan(&o.ID, &o.Name, &o.DisplayName, &o.RequireTwoFactor, &o.DefaultRepoPermission)
 	if err != nil {
 		return nil, err
 	}
@@ -3606,7 +5858,7 @@ func (p *PostgresDB) ListUserOrgsPage(ctx context.Context, userID int64, limit,
 		offset = 0
 	}
 	rows, err := p.db.QueryContext(ctx,
-		`SELECT o.id, o.name, o.display_name FROM orgs o
+		`SELECT o.id, o.name, o.display_name, o.require_two_factor, default_repo_permission FROM orgs o
 		 JOIN org_members om ON om.org_id = o.id
 		 WHERE om.user_id = $1 AND o.tenant_id = $2
 		 ORDER BY o.name ASC
@@ -3618,7 +5870,7 @@ func (p *PostgresDB) ListUserOrgsPage(ctx context.Context, userID int64, limit,
 	var orgs []models.Org
 	for rows.Next() {
 		var o models.Org
-		if err := rows.Scan(&o.ID, &o.Name, &o.DisplayName); err != nil {
+		if err := rows.Scan(&o.ID, &o.Name, &o.DisplayName, &o.RequireTwoFactor, &o.DefaultRepoPermission); err != nil {
 			return nil, err
 		}
 		orgs = append(orgs, o)
@@ -3632,6 +5884,18 @@ func (p *PostgresDB) DeleteOrg(ctx context.Context, id int64) error {
 	return err
 }
 
+func (p *PostgresDB) SetOrgRequireTwoFactor(ctx context.Context, orgID int64, require bool) error {
+	tenantID := tenantIDForContext(ctx)
+	_, err := p.db.ExecContext(ctx, `UPDATE orgs SET require_two_factor = $1 WHERE id = $2 AND tenant_id = $3`, require, orgID, tenantID)
+	return err
+}
+
+func (p *PostgresDB) SetOrgDefaultRepoPermission(ctx context.Context, orgID int64, permission string) error {
+	tenantID := tenantIDForContext(ctx)
+	_, err := p.db.ExecContext(ctx, `UPDATE orgs SET default_repo_permission = $1 WHERE id = $2 AND tenant_id = $3`, permission, orgID, tenantID)
+	return err
+}
+
 func (p *PostgresDB) AddOrgMember(ctx context.Context, m *models.OrgMember) error {
 	_, err := p.db.ExecContext(ctx,
 		`INSERT INTO org_members (org_id, user_id, role) VALUES ($1, $2, $3)
@@ -3680,8 +5944,19 @@ func (p *PostgresDB) ListOrgMembersPage(ctx context.Context, orgID int64, limit,
 }
 
 func (p *PostgresDB) RemoveOrgMember(ctx context.Context, orgID, userID int64) error {
-	_, err := p.db.ExecContext(ctx, `DELETE FROM org_members WHERE org_id = $1 AND user_id = $2`, orgID, userID)
-	return err
+	tx, err := p.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM team_members WHERE user_id = $1 AND team_id IN (SELECT id FROM teams WHERE org_id = $2)`, userID, orgID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM org_members WHERE org_id = $1 AND user_id = $2`, orgID, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (p *PostgresDB) ListOrgRepositories(ctx context.Context, orgID int64) ([]models.Repository, error) {
@@ -3718,5 +5993,235 @@ func (p *PostgresDB) ListOrgRepositoriesPage(ctx context.Context, orgID int64, l
 	return repos, rows.Err()
 }
 
+// --- Teams ---
+
+func (p *PostgresDB) CreateTeam(ctx context.Context, t *models.Team) error {
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO teams (org_id, parent_id, name, description, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		t.OrgID, t.ParentID, t.Name, t.Description, t.CreatedAt).Scan(&t.ID)
+}
+
+func (p *PostgresDB) GetTeam(ctx context.Context, orgID int64, name string) (*models.Team, error) {
+	return scanTeam(p.db.QueryRowContext(ctx,
+		`SELECT `+teamColumns+` FROM teams WHERE org_id = $1 AND name = $2`, orgID, name))
+}
+
+func (p *PostgresDB) GetTeamByID(ctx context.Context, id int64) (*models.Team, error) {
+	return scanTeam(p.db.QueryRowContext(ctx, `SELECT `+teamColumns+` FROM teams WHERE id = $1`, id))
+}
+
+func (p *PostgresDB) ListTeams(ctx context.Context, orgID int64) ([]models.Team, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+teamColumns+` FROM teams WHERE org_id = $1 ORDER BY name`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var teams []models.Team
+	for rows.Next() {
+		t, err := scanTeam(rows)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, *t)
+	}
+	return teams, rows.Err()
+}
+
+func (p *PostgresDB) UpdateTeam(ctx context.Context, t *models.Team) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE teams SET parent_id = $1, name = $2, description = $3 WHERE id = $4 AND org_id = $5`,
+		t.ParentID, t.Name, t.Description, t.ID, t.OrgID)
+	return err
+}
+
+func (p *PostgresDB) DeleteTeam(ctx context.Context, orgID, id int64) error {
+	tx, err := p.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE teams SET parent_id = (SELECT parent_id FROM teams WHERE id = $1 AND org_id = $2) WHERE parent_id = $1`,
+		id, orgID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM teams WHERE id = $1 AND org_id = $2`, id, orgID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresDB) AddTeamMember(ctx context.Context, teamID, userID int64) error {
+	_, err := p.db.ExecContext(ctx,
+		`INSERT INTO team_members (team_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, teamID, userID)
+	return err
+}
+
+func (p *PostgresDB) RemoveTeamMember(ctx context.Context, teamID, userID int64) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM team_members WHERE team_id = $1 AND user_id = $2`, teamID, userID)
+	return err
+}
+
+func (p *PostgresDB) ListTeamMembers(ctx context.Context, teamID int64) ([]models.TeamMember, error) {
+	return p.queryTeamMembers(ctx,
+		`SELECT tm.team_id, tm.user_id, u.username FROM team_members tm
+		 JOIN users u ON u.id = tm.user_id
+		 WHERE tm.team_id = $1
+		 ORDER BY u.username`, teamID)
+}
+
+func (p *PostgresDB) ListNestedTeamMembers(ctx context.Context, teamID int64) ([]models.TeamMember, error) {
+	return p.queryTeamMembers(ctx, fmt.Sprintf(teamDescendantsCTE, "$1::BIGINT")+`
+		SELECT $1::BIGINT, u.id, u.username FROM users u
+		WHERE u.id IN (SELECT tm.user_id FROM team_members tm JOIN sub_teams st ON st.id = tm.team_id)
+		ORDER BY u.username`, teamID)
+}
+
+func (p *PostgresDB) queryTeamMembers(ctx context.Context, query string, args ...any) ([]models.TeamMember, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var members []models.TeamMember
+	for rows.Next() {
+		var m models.TeamMember
+		if err := rows.Scan(&m.TeamID, &m.UserID, &m.Username); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (p *PostgresDB) SetTeamRepo(ctx context.Context, tr *models.TeamRepo) error {
+	_, err := p.db.ExecContext(ctx,
+		`INSERT INTO team_repos (team_id, repo_id, permission) VALUES ($1, $2, $3)
+		 ON CONFLICT (team_id, repo_id) DO UPDATE SET permission = EXCLUDED.permission`,
+		tr.TeamID, tr.RepoID, tr.Permission)
+	return err
+}
+
+func (p *PostgresDB) RemoveTeamRepo(ctx context.Context, teamID, repoID int64) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM team_repos WHERE team_id = $1 AND repo_id = $2`, teamID, repoID)
+	return err
+}
+
+func (p *PostgresDB) ListTeamRepos(ctx context.Context, teamID int64) ([]models.TeamRepo, error) {
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT tr.team_id, tr.repo_id, r.name, tr.permission FROM team_repos tr
+		 JOIN repositories r ON r.id = tr.repo_id
+		 WHERE tr.team_id = $1
+		 ORDER BY r.name`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var repos []models.TeamRepo
+	for rows.Next() {
+		var tr models.TeamRepo
+		if err := rows.Scan(&tr.TeamID, &tr.RepoID, &tr.RepoName, &tr.Permission); err != nil {
+			return nil, err
+		}
+		repos = append(repos, tr)
+	}
+	return repos, rows.Err()
+}
+
+func (p *PostgresDB) ListUserTeamRepoPermissions(ctx context.Context, repoID, userID int64) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, fmt.Sprintf(userTeamAncestorsCTE, "$1")+`
+		SELECT tr.permission FROM team_repos tr
+		JOIN user_teams ut ON ut.id = tr.team_id
+		JOIN teams t ON t.id = tr.team_id
+		JOIN repositories r ON r.id = tr.repo_id AND r.owner_org_id = t.org_id
+		WHERE tr.repo_id = $2`, userID, repoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var perms []string
+	for rows.Next() {
+		var perm string
+		if err := rows.Scan(&perm); err != nil {
+			return nil, err
+		}
+		perms = append(perms, perm)
+	}
+	return perms, rows.Err()
+}
+
+// --- Invitations ---
+
+func (p *PostgresDB) CreateInvitation(ctx context.Context, inv *models.Invitation) error {
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO invitations (repo_id, org_id, inviter_id, invitee_id, email, role, token_hash, expires_at, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+		inv.RepoID, inv.OrgID, inv.InviterID, inv.InviteeID, inv.Email, inv.Role, inv.TokenHash, inv.ExpiresAt, inv.CreatedAt).Scan(&inv.ID)
+}
+
+func (p *PostgresDB) GetInvitation(ctx context.Context, id int64) (*models.Invitation, error) {
+	return scanInvitation(p.db.QueryRowContext(ctx, `SELECT `+invitationColumns+invitationFrom+` WHERE i.id = $1`, id))
+}
+
+func (p *PostgresDB) GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	if tokenHash == "" {
+		return nil, sql.ErrNoRows
+	}
+	return scanInvitation(p.db.QueryRowContext(ctx,
+		`SELECT `+invitationColumns+invitationFrom+` WHERE i.token_hash = $1`, tokenHash))
+}
+
+func (p *PostgresDB) ListRepoInvitations(ctx context.Context, repoID int64, now time.Time) ([]models.Invitation, error) {
+	return p.queryInvitations(ctx, `WHERE i.repo_id = $1 AND i.expires_at > $2`, repoID, now)
+}
+
+func (p *PostgresDB) ListOrgInvitations(ctx context.Context, orgID int64, now time.Time) ([]models.Invitation, error) {
+	return p.queryInvitations(ctx, `WHERE i.org_id = $1 AND i.expires_at > $2`, orgID, now)
+}
+
+func (p *PostgresDB) ListUserInvitations(ctx context.Context, userID int64, now time.Time) ([]models.Invitation, error) {
+	return p.queryInvitations(ctx, `WHERE i.invitee_id = $1 AND i.expires_at > $2`, userID, now)
+}
+
+func (p *PostgresDB) queryInvitations(ctx context.Context, where string, args ...any) ([]models.Invitation, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+invitationColumns+invitationFrom+` `+where+` ORDER BY i.created_at DESC, i.id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var invs []models.Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invs = append(invs, *inv)
+	}
+	return invs, rows.Err()
+}
+
+func (p *PostgresDB) DeleteInvitation(ctx context.Context, id int64) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM invitations WHERE id = $1`, id)
+	return err
+}
+
+// --- Audit log ---
+
+func (p *PostgresDB) CreateAuditEvent(ctx context.Context, e *models.AuditEvent) error {
+	return p.db.QueryRowContext(ctx,
+		`INSERT INTO audit_events (actor_id, actor_name, action, target, repo_id, org_id, ip, request_id, before_json, after_json, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`,
+		e.ActorID, e.ActorName, e.Action, e.Target, e.RepoID, e.OrgID, e.IP, e.RequestID, string(e.Before), string(e.After), e.CreatedAt).Scan(&e.ID)
+}
+
+func (p *PostgresDB) ListAuditEvents(ctx context.Context, filter AuditEventFilter) ([]models.AuditEvent, error) {
+	where, args := auditEventWhere(filter, func(n int) string { return fmt.Sprintf("$%d", n) })
+	rows, err := p.db.QueryContext(ctx, `SELECT `+auditEventColumns+` FROM audit_events`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditEvents(rows)
+}
+
 // Compile-time interface check
 var _ DB = (*PostgresDB)(nil)
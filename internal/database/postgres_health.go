@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/odvcencio/gothub/internal/models"
 )
@@ -31,6 +32,59 @@ func (p *PostgresDB) IndexingQueueStats(ctx context.Context) (IndexingQueueStats
 	return stats, nil
 }
 
+func (p *PostgresDB) ListQueueStats(ctx context.Context) ([]QueueStats, error) {
+	var out []QueueStats
+	for _, jobType := range []models.IndexJobType{models.IndexJobTypeCommitIndex, models.IndexJobTypeWebhookDelivery} {
+		stats := QueueStats{Queue: string(jobType)}
+		var oldestQueued sql.NullTime
+		err := p.db.QueryRowContext(ctx,
+			`SELECT
+				 COALESCE(SUM(CASE WHEN status = $1 THEN 1 ELSE 0 END), 0),
+				 COALESCE(SUM(CASE WHEN status = $2 THEN 1 ELSE 0 END), 0),
+				 COALESCE(SUM(CASE WHEN status = $3 THEN 1 ELSE 0 END), 0),
+				 MIN(CASE WHEN status = $1 THEN next_attempt_at END)
+			 FROM indexing_jobs
+			 WHERE job_type = $4`,
+			models.IndexJobQueued,
+			models.IndexJobInProgress,
+			models.IndexJobFailed,
+			jobType,
+		).Scan(&stats.Queued, &stats.InProgress, &stats.Failed, &oldestQueued)
+		if err != nil {
+			return nil, err
+		}
+		stats.OldestQueuedAt = nullTimeUTC(oldestQueued)
+		out = append(out, stats)
+	}
+
+	stats := QueueStats{Queue: "mail"}
+	var oldestQueued sql.NullTime
+	err := p.db.QueryRowContext(ctx,
+		`SELECT
+			 COALESCE(SUM(CASE WHEN status = $1 THEN 1 ELSE 0 END), 0),
+			 COALESCE(SUM(CASE WHEN status = $2 THEN 1 ELSE 0 END), 0),
+			 COALESCE(SUM(CASE WHEN status = $3 THEN 1 ELSE 0 END), 0),
+			 MIN(CASE WHEN status = $1 THEN next_attempt_at END)
+		 FROM outbound_emails`,
+		models.OutboundEmailQueued,
+		models.OutboundEmailSending,
+		models.OutboundEmailFailed,
+	).Scan(&stats.Queued, &stats.InProgress, &stats.Failed, &oldestQueued)
+	if err != nil {
+		return nil, err
+	}
+	stats.OldestQueuedAt = nullTimeUTC(oldestQueued)
+	return append(out, stats), nil
+}
+
 func (p *PostgresDB) DBStats() sql.DBStats {
 	return p.db.Stats()
 }
+
+func nullTimeUTC(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
@@ -28,6 +28,7 @@ func setupPostgresPRTenantTestDB(t *testing.T) *PostgresDB {
 		)`,
 		`CREATE TABLE pull_requests (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			updated_at DATETIME,
 			tenant_id TEXT NOT NULL
 		)`,
 		`CREATE TABLE pr_comments (
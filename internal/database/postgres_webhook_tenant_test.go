@@ -32,6 +32,12 @@ func setupPostgresWebhookTenantTestDB(t *testing.T) *PostgresDB {
 			secret TEXT NOT NULL DEFAULT '',
 			events_csv TEXT NOT NULL DEFAULT '*',
 			active BOOLEAN NOT NULL DEFAULT TRUE,
+			failing_since DATETIME,
+			disabled_at DATETIME,
+			disabled_reason TEXT NOT NULL DEFAULT '',
+			previous_secret TEXT NOT NULL DEFAULT '',
+			previous_secret_expires_at DATETIME,
+			timestamped_signature BOOLEAN NOT NULL DEFAULT FALSE,
 			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			tenant_id TEXT NOT NULL
@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -19,6 +20,14 @@ type SQLiteDB struct {
 }
 
 func OpenSQLite(dsn string) (*SQLiteDB, error) {
+	// Connection-scoped pragmas go in the DSN so that every pooled connection
+	// gets them, not just the one that happens to run an Exec. Background
+	// workers write concurrently with requests and rely on busy_timeout.
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	dsn += sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
 	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("open sqlite: %w", err)
@@ -82,7 +91,178 @@ func (s *SQLiteDB) Migrate(ctx context.Context) error {
 			return err
 		}
 	}
-	return nil
+	// Backfill schema for existing installations created before issue search.
+	for _, table := range []string{"issues", "pull_requests"} {
+		if _, err := s.db.ExecContext(ctx, `ALTER TABLE `+table+` ADD COLUMN updated_at DATETIME`); err != nil {
+			if !isSQLiteDuplicateColumnErr(err) {
+				return err
+			}
+		}
+		if _, err := s.db.ExecContext(ctx, `UPDATE `+table+` SET updated_at = created_at WHERE updated_at IS NULL`); err != nil {
+			return err
+		}
+	}
+	// Backfill schema for existing installations created before the webhook delivery queue.
+	for _, stmt := range []string{
+		`ALTER TABLE indexing_jobs ADD COLUMN concurrency_key TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE indexing_jobs ADD COLUMN payload TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE repo_webhooks ADD COLUMN failing_since DATETIME`,
+		`ALTER TABLE repo_webhooks ADD COLUMN disabled_at DATETIME`,
+		`ALTER TABLE repo_webhooks ADD COLUMN disabled_reason TEXT NOT NULL DEFAULT ''`,
+	} {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			if !isSQLiteDuplicateColumnErr(err) {
+				return err
+			}
+		}
+	}
+	if _, err := s.db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_indexing_jobs_concurrency ON indexing_jobs(job_type, concurrency_key, status, id)`); err != nil {
+		return err
+	}
+	if err := s.dropIndexingJobsRepoForeignKey(ctx); err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, `CREATE TRIGGER IF NOT EXISTS repositories_indexing_jobs_ad AFTER DELETE ON repositories BEGIN
+	DELETE FROM indexing_jobs WHERE repo_id = old.id AND job_type <> 'webhook_delivery';
+END`); err != nil {
+		return err
+	}
+	// Backfill schema for existing installations created before notification reasons.
+	if _, err := s.db.ExecContext(ctx, `ALTER TABLE notifications ADD COLUMN reason TEXT NOT NULL DEFAULT ''`); err != nil {
+		if !isSQLiteDuplicateColumnErr(err) {
+			return err
+		}
+	}
+	// Backfill schema for existing installations created before org 2FA policies.
+	if _, err := s.db.ExecContext(ctx, `ALTER TABLE orgs ADD COLUMN require_two_factor BOOLEAN NOT NULL DEFAULT FALSE`); err != nil {
+		if !isSQLiteDuplicateColumnErr(err) {
+			return err
+		}
+	}
+	// Backfill schema for existing installations created before org teams.
+	if _, err := s.db.ExecContext(ctx, `ALTER TABLE orgs ADD COLUMN default_repo_permission TEXT NOT NULL DEFAULT 'write'`); err != nil {
+		if !isSQLiteDuplicateColumnErr(err) {
+			return err
+		}
+	}
+	// Backfill schema for existing installations created before email digests.
+	if _, err := s.db.ExecContext(ctx, `ALTER TABLE notifications ADD COLUMN emailed_at DATETIME`); err != nil {
+		if !isSQLiteDuplicateColumnErr(err) {
+			return err
+		}
+	}
+	// Backfill schema for existing installations created before webhook secret rotation.
+	for _, table := range []string{"repo_webhooks", "org_webhooks"} {
+		for _, column := range []string{
+			`previous_secret TEXT NOT NULL DEFAULT ''`,
+			`previous_secret_expires_at DATETIME`,
+			`timestamped_signature BOOLEAN NOT NULL DEFAULT FALSE`,
+		} {
+			if _, err := s.db.ExecContext(ctx, `ALTER TABLE `+table+` ADD COLUMN `+column); err != nil {
+				if !isSQLiteDuplicateColumnErr(err) {
+					return err
+				}
+			}
+		}
+	}
+	// Backfill schema for existing installations created before account suspension.
+	if _, err := s.db.ExecContext(ctx, `ALTER TABLE users ADD COLUMN suspended_at DATETIME`); err != nil {
+		if !isSQLiteDuplicateColumnErr(err) {
+			return err
+		}
+	}
+	// Delivered and failed messages may carry sign-in or invitation tokens.
+	if _, err := s.db.ExecContext(ctx, `UPDATE outbound_emails SET message = '' WHERE status IN ('sent', 'failed') AND message <> ''`); err != nil {
+		return err
+	}
+	return s.backfillIssueSearchIndex(ctx)
+}
+
+// dropIndexingJobsRepoForeignKey rebuilds indexing_jobs without the
+// cascading repository foreign key that installations created before durable
+// repository.deleted webhooks still have. SQLite cannot drop a constraint in
+// place.
+func (s *SQLiteDB) dropIndexingJobsRepoForeignKey(ctx context.Context) error {
+	var fks int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_foreign_key_list('indexing_jobs')`).Scan(&fks); err != nil {
+		return err
+	}
+	if fks == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	const columns = `id, repo_id, commit_hash, job_type, concurrency_key, payload, status, attempt_count, max_attempts, last_error, next_attempt_at, created_at, updated_at, started_at, completed_at`
+	stmts := []string{
+		`DROP TRIGGER IF EXISTS repositories_indexing_jobs_ad`,
+		`CREATE TABLE indexing_jobs_new (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			repo_id INTEGER NOT NULL,
+			commit_hash TEXT NOT NULL,
+			job_type TEXT NOT NULL DEFAULT 'commit_index',
+			concurrency_key TEXT NOT NULL DEFAULT '',
+			payload TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'queued',
+			attempt_count INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL DEFAULT 3,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			started_at DATETIME,
+			completed_at DATETIME,
+			UNIQUE (repo_id, commit_hash, job_type)
+		)`,
+		`INSERT INTO indexing_jobs_new (` + columns + `) SELECT ` + columns + ` FROM indexing_jobs`,
+		`DROP TABLE indexing_jobs`,
+		`ALTER TABLE indexing_jobs_new RENAME TO indexing_jobs`,
+		`CREATE INDEX idx_indexing_jobs_claim ON indexing_jobs(status, next_attempt_at, id)`,
+		`CREATE INDEX idx_indexing_jobs_repo_commit ON indexing_jobs(repo_id, commit_hash, created_at DESC)`,
+		`CREATE INDEX idx_indexing_jobs_concurrency ON indexing_jobs(job_type, concurrency_key, status, id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// backfillIssueSearchIndex populates issue_search_fts from issues, pull
+// requests and their comments written before the index existed. Triggers
+// keep a populated index current, so this only runs while it is empty.
+func (s *SQLiteDB) backfillIssueSearchIndex(ctx context.Context) error {
+	var indexed bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM issue_search_fts)`).Scan(&indexed); err != nil {
+		return err
+	}
+	if indexed {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmts := []string{
+		`INSERT INTO issue_search_fts(rowid, title, body, comments)
+		 SELECT i.id * 2, i.title, i.body,
+			 COALESCE((SELECT group_concat(c.body, char(10)) FROM issue_comments c WHERE c.issue_id = i.id), '')
+		 FROM issues i`,
+		`INSERT INTO issue_search_fts(rowid, title, body, comments)
+		 SELECT p.id * 2 + 1, p.title, p.body,
+			 COALESCE((SELECT group_concat(c.body, char(10)) FROM pr_comments c WHERE c.pr_id = p.id), '')
+		 FROM pull_requests p`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 const schema = `
@@ -92,6 +272,7 @@ CREATE TABLE IF NOT EXISTS users (
 	email TEXT NOT NULL UNIQUE,
 	password_hash TEXT NOT NULL,
 	is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+	suspended_at DATETIME,
 	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -105,6 +286,95 @@ CREATE TABLE IF NOT EXISTS ssh_keys (
 	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE IF NOT EXISTS gpg_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	key_id TEXT NOT NULL UNIQUE,
+	fingerprint TEXT NOT NULL,
+	public_key TEXT NOT NULL,
+	emails_csv TEXT NOT NULL DEFAULT '',
+	expires_at DATETIME,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	token_prefix TEXT NOT NULL,
+	scopes_csv TEXT NOT NULL,
+	repo_ids_csv TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_used_at DATETIME,
+	expires_at DATETIME,
+	revoked_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS gpg_subkeys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	gpg_key_id INTEGER NOT NULL REFERENCES gpg_keys(id) ON DELETE CASCADE,
+	key_id TEXT NOT NULL UNIQUE,
+	fingerprint TEXT NOT NULL,
+	expires_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_gpg_keys_user ON gpg_keys(user_id);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user ON personal_access_tokens(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_gpg_subkeys_key ON gpg_subkeys(gpg_key_id);
+
+CREATE TABLE IF NOT EXISTS oauth_apps (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	homepage_url TEXT NOT NULL DEFAULT '',
+	client_id TEXT NOT NULL UNIQUE,
+	client_secret_hash TEXT NOT NULL,
+	redirect_uris_csv TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_oauth_apps_owner ON oauth_apps(owner_id);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	app_id INTEGER NOT NULL REFERENCES oauth_apps(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL UNIQUE,
+	redirect_uri TEXT NOT NULL,
+	scopes_csv TEXT NOT NULL,
+	code_challenge TEXT NOT NULL DEFAULT '',
+	expires_at DATETIME NOT NULL,
+	used_at DATETIME,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorizations (
+	app_id INTEGER NOT NULL REFERENCES oauth_apps(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	scopes_csv TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_used_at DATETIME,
+	PRIMARY KEY (app_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_oauth_authorizations_user ON oauth_authorizations(user_id);
+
+CREATE TABLE IF NOT EXISTS oauth_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	app_id INTEGER NOT NULL REFERENCES oauth_apps(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	access_token_hash TEXT NOT NULL UNIQUE,
+	refresh_token_hash TEXT NOT NULL UNIQUE,
+	scopes_csv TEXT NOT NULL,
+	access_expires_at DATETIME NOT NULL,
+	refresh_expires_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_used_at DATETIME,
+	revoked_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_oauth_tokens_app_user ON oauth_tokens(app_id, user_id);
+
 CREATE TABLE IF NOT EXISTS magic_link_tokens (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -133,6 +403,17 @@ CREATE TABLE IF NOT EXISTS webauthn_credentials (
 	last_used_at DATETIME
 );
 
+CREATE TABLE IF NOT EXISTS user_sessions (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip_address TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_seen_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at DATETIME NOT NULL,
+	revoked_at DATETIME
+);
+
 CREATE TABLE IF NOT EXISTS webauthn_sessions (
 	id TEXT PRIMARY KEY,
 	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -143,10 +424,51 @@ CREATE TABLE IF NOT EXISTS webauthn_sessions (
 	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE IF NOT EXISTS user_totp (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	secret TEXT NOT NULL,
+	last_used_step BIGINT NOT NULL DEFAULT 0,
+	confirmed_at DATETIME,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL,
+	used_at DATETIME,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user ON user_recovery_codes(user_id, code_hash);
+
+CREATE TABLE IF NOT EXISTS oidc_auth_states (
+	state TEXT PRIMARY KEY,
+	provider TEXT NOT NULL,
+	code_verifier TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	expires_at DATETIME NOT NULL,
+	used_at DATETIME,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	email TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_login_at DATETIME,
+	UNIQUE(provider, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);
+
 CREATE TABLE IF NOT EXISTS orgs (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	name TEXT NOT NULL UNIQUE,
-	display_name TEXT NOT NULL DEFAULT ''
+	display_name TEXT NOT NULL DEFAULT '',
+	require_two_factor BOOLEAN NOT NULL DEFAULT FALSE,
+	default_repo_permission TEXT NOT NULL DEFAULT 'write'
 );
 
 CREATE TABLE IF NOT EXISTS org_members (
@@ -177,6 +499,74 @@ CREATE TABLE IF NOT EXISTS collaborators (
 	PRIMARY KEY (repo_id, user_id)
 );
 
+CREATE TABLE IF NOT EXISTS invitations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	repo_id INTEGER REFERENCES repositories(id) ON DELETE CASCADE,
+	org_id INTEGER REFERENCES orgs(id) ON DELETE CASCADE,
+	inviter_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	invitee_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	email TEXT NOT NULL DEFAULT '',
+	role TEXT NOT NULL,
+	token_hash TEXT NOT NULL DEFAULT '',
+	expires_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_invitations_repo ON invitations(repo_id);
+CREATE INDEX IF NOT EXISTS idx_invitations_org ON invitations(org_id);
+CREATE INDEX IF NOT EXISTS idx_invitations_invitee ON invitations(invitee_id);
+CREATE INDEX IF NOT EXISTS idx_invitations_token ON invitations(token_hash);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	actor_id INTEGER,
+	actor_name TEXT NOT NULL DEFAULT '',
+	action TEXT NOT NULL,
+	target TEXT NOT NULL DEFAULT '',
+	repo_id INTEGER,
+	org_id INTEGER,
+	ip TEXT NOT NULL DEFAULT '',
+	request_id TEXT NOT NULL DEFAULT '',
+	before_json TEXT NOT NULL DEFAULT '',
+	after_json TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_repo ON audit_events(repo_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_org ON audit_events(org_id, id);
+CREATE TRIGGER IF NOT EXISTS audit_events_no_update BEFORE UPDATE ON audit_events
+BEGIN
+	SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+CREATE TRIGGER IF NOT EXISTS audit_events_no_delete BEFORE DELETE ON audit_events
+BEGIN
+	SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TABLE IF NOT EXISTS teams (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	org_id INTEGER NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+	parent_id INTEGER REFERENCES teams(id) ON DELETE SET NULL,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(org_id, name)
+);
+CREATE INDEX IF NOT EXISTS idx_teams_parent ON teams(parent_id);
+
+CREATE TABLE IF NOT EXISTS team_members (
+	team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (team_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_team_members_user ON team_members(user_id);
+
+CREATE TABLE IF NOT EXISTS team_repos (
+	team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+	repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	permission TEXT NOT NULL DEFAULT 'read',
+	PRIMARY KEY (team_id, repo_id)
+);
+CREATE INDEX IF NOT EXISTS idx_team_repos_repo ON team_repos(repo_id);
+
 CREATE TABLE IF NOT EXISTS repo_stars (
 	repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
 	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -199,6 +589,7 @@ CREATE TABLE IF NOT EXISTS pull_requests (
 	merge_commit TEXT NOT NULL DEFAULT '',
 	merge_method TEXT NOT NULL DEFAULT '',
 	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 	merged_at DATETIME,
 	UNIQUE(repo_id, number)
 );
@@ -235,6 +626,7 @@ CREATE TABLE IF NOT EXISTS issues (
 	state TEXT NOT NULL DEFAULT 'open',
 	author_id INTEGER NOT NULL REFERENCES users(id),
 	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 	closed_at DATETIME,
 	UNIQUE(repo_id, number)
 );
@@ -247,6 +639,89 @@ CREATE TABLE IF NOT EXISTS issue_comments (
 	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE IF NOT EXISTS issue_references (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	issue_id INTEGER NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+	source_type TEXT NOT NULL,
+	source_id INTEGER NOT NULL DEFAULT 0,
+	source_number INTEGER NOT NULL DEFAULT 0,
+	commit_hash TEXT NOT NULL DEFAULT '',
+	actor_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	closing BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(issue_id, source_type, source_id, commit_hash)
+);
+
+CREATE TABLE IF NOT EXISTS issue_entity_links (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	issue_id INTEGER NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+	stable_id TEXT NOT NULL,
+	creator_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(issue_id, stable_id)
+);
+
+-- Search rows are keyed by issue id * 2 and pull request id * 2 + 1 so both
+-- kinds share one index.
+CREATE VIRTUAL TABLE IF NOT EXISTS issue_search_fts USING fts5(
+	title,
+	body,
+	comments,
+	tokenize='unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS issues_search_ai AFTER INSERT ON issues BEGIN
+	INSERT INTO issue_search_fts(rowid, title, body, comments)
+	VALUES (new.id * 2, new.title, new.body, '');
+END;
+
+CREATE TRIGGER IF NOT EXISTS issues_search_au AFTER UPDATE OF title, body ON issues BEGIN
+	UPDATE issue_search_fts SET title = new.title, body = new.body WHERE rowid = new.id * 2;
+END;
+
+CREATE TRIGGER IF NOT EXISTS issues_search_ad AFTER DELETE ON issues BEGIN
+	DELETE FROM issue_search_fts WHERE rowid = old.id * 2;
+END;
+
+CREATE TRIGGER IF NOT EXISTS issue_comments_search_ai AFTER INSERT ON issue_comments BEGIN
+	UPDATE issue_search_fts
+	SET comments = (SELECT COALESCE(group_concat(body, char(10)), '') FROM issue_comments WHERE issue_id = new.issue_id)
+	WHERE rowid = new.issue_id * 2;
+END;
+
+CREATE TRIGGER IF NOT EXISTS issue_comments_search_ad AFTER DELETE ON issue_comments BEGIN
+	UPDATE issue_search_fts
+	SET comments = (SELECT COALESCE(group_concat(body, char(10)), '') FROM issue_comments WHERE issue_id = old.issue_id)
+	WHERE rowid = old.issue_id * 2;
+END;
+
+CREATE TRIGGER IF NOT EXISTS pull_requests_search_ai AFTER INSERT ON pull_requests BEGIN
+	INSERT INTO issue_search_fts(rowid, title, body, comments)
+	VALUES (new.id * 2 + 1, new.title, new.body, '');
+END;
+
+CREATE TRIGGER IF NOT EXISTS pull_requests_search_au AFTER UPDATE OF title, body ON pull_requests BEGIN
+	UPDATE issue_search_fts SET title = new.title, body = new.body WHERE rowid = new.id * 2 + 1;
+END;
+
+CREATE TRIGGER IF NOT EXISTS pull_requests_search_ad AFTER DELETE ON pull_requests BEGIN
+	DELETE FROM issue_search_fts WHERE rowid = old.id * 2 + 1;
+END;
+
+CREATE TRIGGER IF NOT EXISTS pr_comments_search_ai AFTER INSERT ON pr_comments BEGIN
+	UPDATE issue_search_fts
+	SET comments = (SELECT COALESCE(group_concat(body, char(10)), '') FROM pr_comments WHERE pr_id = new.pr_id)
+	WHERE rowid = new.pr_id * 2 + 1;
+END;
+
+CREATE TRIGGER IF NOT EXISTS pr_comments_search_ad AFTER DELETE ON pr_comments BEGIN
+	UPDATE issue_search_fts
+	SET comments = (SELECT COALESCE(group_concat(body, char(10)), '') FROM pr_comments WHERE pr_id = old.pr_id)
+	WHERE rowid = old.pr_id * 2 + 1;
+END;
+
 CREATE TABLE IF NOT EXISTS notifications (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -258,10 +733,41 @@ CREATE TABLE IF NOT EXISTS notifications (
 	repo_id INTEGER REFERENCES repositories(id) ON DELETE CASCADE,
 	pr_id INTEGER REFERENCES pull_requests(id) ON DELETE CASCADE,
 	issue_id INTEGER REFERENCES issues(id) ON DELETE CASCADE,
+	reason TEXT NOT NULL DEFAULT '',
 	read_at DATETIME,
+	emailed_at DATETIME,
 	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE IF NOT EXISTS notification_settings (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	email_frequency TEXT NOT NULL DEFAULT 'instant',
+	last_digest_at DATETIME,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS thread_subscriptions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	thread_type TEXT NOT NULL,
+	thread_id INTEGER NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	subscribed BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(user_id, thread_type, thread_id)
+);
+
+CREATE TABLE IF NOT EXISTS repo_watches (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	level TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, repo_id)
+);
+
 CREATE TABLE IF NOT EXISTS branch_protection_rules (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
@@ -307,6 +813,24 @@ CREATE TABLE IF NOT EXISTS repo_runner_tokens (
 	revoked_at DATETIME
 );
 
+CREATE TABLE IF NOT EXISTS repo_deploy_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	read_only INTEGER NOT NULL DEFAULT 1,
+	fingerprint TEXT NOT NULL DEFAULT '',
+	public_key TEXT NOT NULL DEFAULT '',
+	key_type TEXT NOT NULL DEFAULT '',
+	token_hash TEXT NOT NULL DEFAULT '',
+	token_prefix TEXT NOT NULL DEFAULT '',
+	created_by_user_id INTEGER NOT NULL REFERENCES users(id),
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_used_at DATETIME,
+	expires_at DATETIME,
+	revoked_at DATETIME
+);
+
 CREATE TABLE IF NOT EXISTS repo_webhooks (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
@@ -314,6 +838,12 @@ CREATE TABLE IF NOT EXISTS repo_webhooks (
 	secret TEXT NOT NULL DEFAULT '',
 	events_csv TEXT NOT NULL DEFAULT '*',
 	active BOOLEAN NOT NULL DEFAULT TRUE,
+	failing_since DATETIME,
+	disabled_at DATETIME,
+	disabled_reason TEXT NOT NULL DEFAULT '',
+	previous_secret TEXT NOT NULL DEFAULT '',
+	previous_secret_expires_at DATETIME,
+	timestamped_signature BOOLEAN NOT NULL DEFAULT FALSE,
 	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
@@ -335,17 +865,52 @@ CREATE TABLE IF NOT EXISTS webhook_deliveries (
 	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE TABLE IF NOT EXISTS interest_signups (
+CREATE TABLE IF NOT EXISTS org_webhooks (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	email TEXT NOT NULL,
-	name TEXT NOT NULL DEFAULT '',
-	company TEXT NOT NULL DEFAULT '',
-	message TEXT NOT NULL DEFAULT '',
-	source TEXT NOT NULL DEFAULT '',
-	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	org_id INTEGER NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL DEFAULT '',
+	events_csv TEXT NOT NULL DEFAULT '*',
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	failing_since DATETIME,
+	disabled_at DATETIME,
+	disabled_reason TEXT NOT NULL DEFAULT '',
+	previous_secret TEXT NOT NULL DEFAULT '',
+	previous_secret_expires_at DATETIME,
+	timestamped_signature BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE TABLE IF NOT EXISTS user_entitlements (
+CREATE TABLE IF NOT EXISTS org_webhook_deliveries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	org_id INTEGER NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+	webhook_id INTEGER NOT NULL REFERENCES org_webhooks(id) ON DELETE CASCADE,
+	repo_id INTEGER NOT NULL DEFAULT 0,
+	event TEXT NOT NULL,
+	delivery_uid TEXT NOT NULL,
+	attempt INTEGER NOT NULL DEFAULT 1,
+	status_code INTEGER NOT NULL DEFAULT 0,
+	success BOOLEAN NOT NULL DEFAULT FALSE,
+	error TEXT NOT NULL DEFAULT '',
+	request_body TEXT NOT NULL DEFAULT '',
+	response_body TEXT NOT NULL DEFAULT '',
+	duration_ms INTEGER NOT NULL DEFAULT 0,
+	redelivery_of_id INTEGER,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS interest_signups (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	email TEXT NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	company TEXT NOT NULL DEFAULT '',
+	message TEXT NOT NULL DEFAULT '',
+	source TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_entitlements (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
 	feature TEXT NOT NULL,
@@ -388,11 +953,28 @@ CREATE TABLE IF NOT EXISTS merge_base_cache (
 	PRIMARY KEY (repo_id, left_hash, right_hash)
 );
 
+CREATE TABLE IF NOT EXISTS commit_verifications (
+	repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	commit_hash TEXT NOT NULL,
+	status TEXT NOT NULL,
+	signature_type TEXT NOT NULL DEFAULT '',
+	key_id TEXT NOT NULL DEFAULT '',
+	fingerprint TEXT NOT NULL DEFAULT '',
+	signer_user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	signed_by_server INTEGER NOT NULL DEFAULT 0,
+	verified_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (repo_id, commit_hash)
+);
+
+-- repo_id is not a foreign key: webhook deliveries outlive the repository,
+-- and repositories_indexing_jobs_ad removes every other job with it.
 CREATE TABLE IF NOT EXISTS indexing_jobs (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+	repo_id INTEGER NOT NULL,
 	commit_hash TEXT NOT NULL,
 	job_type TEXT NOT NULL DEFAULT 'commit_index',
+	concurrency_key TEXT NOT NULL DEFAULT '',
+	payload TEXT NOT NULL DEFAULT '',
 	status TEXT NOT NULL DEFAULT 'queued',
 	attempt_count INTEGER NOT NULL DEFAULT 0,
 	max_attempts INTEGER NOT NULL DEFAULT 3,
@@ -405,6 +987,21 @@ CREATE TABLE IF NOT EXISTS indexing_jobs (
 	UNIQUE (repo_id, commit_hash, job_type)
 );
 
+CREATE TABLE IF NOT EXISTS outbound_emails (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	recipient TEXT NOT NULL,
+	subject TEXT NOT NULL DEFAULT '',
+	message TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'queued',
+	attempt_count INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL DEFAULT 8,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	sent_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_outbound_emails_due ON outbound_emails(status, next_attempt_at);
+
 CREATE TABLE IF NOT EXISTS commit_indexes (
 	repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
 	commit_hash TEXT NOT NULL,
@@ -539,11 +1136,13 @@ CREATE INDEX IF NOT EXISTS idx_hash_mapping_git ON hash_mapping(repo_id, git_has
 CREATE INDEX IF NOT EXISTS idx_hash_mapping_got ON hash_mapping(repo_id, got_hash);
 CREATE INDEX IF NOT EXISTS idx_commit_metadata_repo_generation ON commit_metadata(repo_id, generation DESC);
 CREATE INDEX IF NOT EXISTS idx_merge_base_cache_repo ON merge_base_cache(repo_id, updated_at DESC);
+CREATE INDEX IF NOT EXISTS idx_commit_verifications_key ON commit_verifications(key_id);
 CREATE INDEX IF NOT EXISTS idx_magic_link_tokens_hash ON magic_link_tokens(token_hash);
 CREATE INDEX IF NOT EXISTS idx_magic_link_tokens_user ON magic_link_tokens(user_id, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_ssh_auth_challenges_user ON ssh_auth_challenges(user_id, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user ON webauthn_credentials(user_id, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_webauthn_sessions_user_flow ON webauthn_sessions(user_id, flow, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user ON user_sessions(user_id, revoked_at, expires_at);
 CREATE INDEX IF NOT EXISTS idx_indexing_jobs_claim ON indexing_jobs(status, next_attempt_at, id);
 CREATE INDEX IF NOT EXISTS idx_indexing_jobs_repo_commit ON indexing_jobs(repo_id, commit_hash, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_commit_indexes_repo ON commit_indexes(repo_id, created_at DESC);
@@ -562,12 +1161,21 @@ CREATE INDEX IF NOT EXISTS idx_branch_protection_repo_branch ON branch_protectio
 CREATE INDEX IF NOT EXISTS idx_pr_check_runs_pr ON pr_check_runs(pr_id, updated_at);
 CREATE INDEX IF NOT EXISTS idx_repo_runner_tokens_repo_active ON repo_runner_tokens(repo_id, revoked_at, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_repo_runner_tokens_hash ON repo_runner_tokens(token_hash);
+CREATE INDEX IF NOT EXISTS idx_repo_deploy_keys_repo ON repo_deploy_keys(repo_id, revoked_at, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_repo_deploy_keys_token_hash ON repo_deploy_keys(token_hash);
+CREATE INDEX IF NOT EXISTS idx_repo_deploy_keys_fingerprint ON repo_deploy_keys(fingerprint);
 CREATE INDEX IF NOT EXISTS idx_issues_repo_number ON issues(repo_id, number DESC);
 CREATE INDEX IF NOT EXISTS idx_issue_comments_issue ON issue_comments(issue_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_issue_references_issue ON issue_references(issue_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_issue_entity_links_repo_stable ON issue_entity_links(repo_id, stable_id);
 CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications(user_id, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_notifications_user_unread ON notifications(user_id, read_at, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_thread_subscriptions_thread ON thread_subscriptions(thread_type, thread_id, subscribed);
+CREATE INDEX IF NOT EXISTS idx_repo_watches_repo ON repo_watches(repo_id, level);
 CREATE INDEX IF NOT EXISTS idx_repo_webhooks_repo ON repo_webhooks(repo_id);
 CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_time ON webhook_deliveries(webhook_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_org_webhooks_org ON org_webhooks(org_id);
+CREATE INDEX IF NOT EXISTS idx_org_webhook_deliveries_webhook_time ON org_webhook_deliveries(webhook_id, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_interest_signups_created ON interest_signups(created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_user_entitlements_user_feature ON user_entitlements(user_id, feature);
 CREATE INDEX IF NOT EXISTS idx_user_entitlements_feature_active ON user_entitlements(feature, active, expires_at);
@@ -590,17 +1198,17 @@ func (s *SQLiteDB) CreateUser(ctx context.Context, u *models.User) error {
 
 func (s *SQLiteDB) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
 	return s.scanUser(s.db.QueryRowContext(ctx,
-		`SELECT id, username, email, password_hash, is_admin, created_at FROM users WHERE id = ?`, id))
+		`SELECT id, username, email, password_hash, is_admin, suspended_at, created_at FROM users WHERE id = ?`, id))
 }
 
 func (s *SQLiteDB) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	return s.scanUser(s.db.QueryRowContext(ctx,
-		`SELECT id, username, email, password_hash, is_admin, created_at FROM users WHERE username = ?`, username))
+		`SELECT id, username, email, password_hash, is_admin, suspended_at, created_at FROM users WHERE username = ?`, username))
 }
 
 func (s *SQLiteDB) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	return s.scanUser(s.db.QueryRowContext(ctx,
-		`SELECT id, username, email, password_hash, is_admin, created_at FROM users WHERE email = ?`, email))
+		`SELECT id, username, email, password_hash, is_admin, suspended_at, created_at FROM users WHERE email = ?`, email))
 }
 
 func (s *SQLiteDB) HasVerifiedEmail(ctx context.Context, userID int64) (bool, error) {
@@ -642,7 +1250,7 @@ func (s *SQLiteDB) HasWebAuthnCredential(ctx context.Context, userID int64) (boo
 
 func (s *SQLiteDB) scanUser(row *sql.Row) (*models.User, error) {
 	u := &models.User{}
-	if err := row.Scan(&u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.IsAdmin, &u.CreatedAt); err != nil {
+	if err := row.Scan(&u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.IsAdmin, &u.SuspendedAt, &u.CreatedAt); err != nil {
 		return nil, err
 	}
 	return u, nil
@@ -653,6 +1261,92 @@ func (s *SQLiteDB) UpdateUserPassword(ctx context.Context, userID int64, passwor
 	return err
 }
 
+func (s *SQLiteDB) ListUsers(ctx context.Context, query string, limit, offset int) ([]models.User, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, username, email, password_hash, is_admin, suspended_at, created_at
+		 FROM users
+		 WHERE ? = '' OR username LIKE ? || '%' OR email LIKE ? || '%'
+		 ORDER BY id
+		 LIMIT ? OFFSET ?`,
+		query, query, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.IsAdmin, &u.SuspendedAt, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *SQLiteDB) SetUserAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE users SET is_admin = ? WHERE id = ?`, isAdmin, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *SQLiteDB) SetUserSuspended(ctx context.Context, userID int64, suspendedAt *time.Time) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE users SET suspended_at = ? WHERE id = ?`, suspendedAt, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// userAuthoredColumns lists the references to users that do not cascade:
+// content and credentials that outlive their author.
+var userAuthoredColumns = []struct{ table, column string }{
+	{"pull_requests", "author_id"},
+	{"pr_comments", "author_id"},
+	{"pr_reviews", "author_id"},
+	{"issues", "author_id"},
+	{"issue_comments", "author_id"},
+	{"repo_runner_tokens", "created_by_user_id"},
+	{"repo_deploy_keys", "created_by_user_id"},
+}
+
+func (s *SQLiteDB) DeleteUser(ctx context.Context, userID, successorID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, ref := range userAuthoredColumns {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE `+ref.table+` SET `+ref.column+` = ? WHERE `+ref.column+` = ?`, successorID, userID); err != nil {
+			return err
+		}
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
 func (s *SQLiteDB) UpsertUserEntitlement(ctx context.Context, entitlement *models.UserEntitlement) error {
 	if entitlement == nil {
 		return fmt.Errorf("entitlement is required")
@@ -742,11 +1436,11 @@ func (s *SQLiteDB) ConsumeMagicLinkToken(ctx context.Context, tokenHash string,
 	var tokenID int64
 	u := &models.User{}
 	err = tx.QueryRowContext(ctx,
-		`SELECT m.id, u.id, u.username, u.email, u.password_hash, u.is_admin, u.created_at
+		`SELECT m.id, u.id, u.username, u.email, u.password_hash, u.is_admin, u.suspended_at, u.created_at
 		 FROM magic_link_tokens m
 		 JOIN users u ON u.id = m.user_id
 		 WHERE m.token_hash = ? AND m.used_at IS NULL AND m.expires_at > ?`,
-		tokenHash, now).Scan(&tokenID, &u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.IsAdmin, &u.CreatedAt)
+		tokenHash, now).Scan(&tokenID, &u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.IsAdmin, &u.SuspendedAt, &u.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -842,6 +1536,77 @@ func (s *SQLiteDB) UpdateWebAuthnCredential(ctx context.Context, credential *mod
 	return err
 }
 
+func (s *SQLiteDB) DeleteWebAuthnCredential(ctx context.Context, id, userID int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM webauthn_credentials WHERE id = ? AND user_id = ?`, id, userID)
+	return err
+}
+
+// --- User sessions ---
+
+func (s *SQLiteDB) CreateUserSession(ctx context.Context, session *models.UserSession) error {
+	return s.db.QueryRowContext(ctx,
+		`INSERT INTO user_sessions (id, user_id, user_agent, ip_address, expires_at) VALUES (?, ?, ?, ?, ?)
+		 RETURNING created_at, last_seen_at`,
+		session.ID, session.UserID, session.UserAgent, session.IPAddress, session.ExpiresAt,
+	).Scan(&session.CreatedAt, &session.LastSeenAt)
+}
+
+func (s *SQLiteDB) GetUserSession(ctx context.Context, id string) (*models.UserSession, error) {
+	session := &models.UserSession{}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at
+		 FROM user_sessions WHERE id = ?`, id,
+	).Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress,
+		&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *SQLiteDB) ListActiveUserSessions(ctx context.Context, userID int64, now time.Time) ([]models.UserSession, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at
+		 FROM user_sessions
+		 WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		 ORDER BY last_seen_at DESC, created_at DESC`, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := make([]models.UserSession, 0)
+	for rows.Next() {
+		var session models.UserSession
+		if err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *SQLiteDB) TouchUserSession(ctx context.Context, id string, seenAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE user_sessions SET last_seen_at = ? WHERE id = ?`, seenAt, id)
+	return err
+}
+
+func (s *SQLiteDB) RevokeUserSession(ctx context.Context, id string, userID int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE user_sessions SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP) WHERE id = ? AND user_id = ?`,
+		id, userID)
+	return err
+}
+
+// RevokeUserSessions revokes every session of the user except exceptID,
+// which may be empty.
+func (s *SQLiteDB) RevokeUserSessions(ctx context.Context, userID int64, exceptID string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE user_sessions SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP) WHERE user_id = ? AND id <> ?`,
+		userID, exceptID)
+	return err
+}
+
 func (s *SQLiteDB) CreateWebAuthnSession(ctx context.Context, session *models.WebAuthnSession) error {
 	_, err := s.db.ExecContext(ctx,
 		`INSERT INTO webauthn_sessions (id, user_id, flow, data_json, expires_at) VALUES (?, ?, ?, ?, ?)`,
@@ -880,6 +1645,212 @@ func (s *SQLiteDB) ConsumeWebAuthnSession(ctx context.Context, id, flow string,
 	return session, nil
 }
 
+func (s *SQLiteDB) UpsertUserTOTP(ctx context.Context, totp *models.UserTOTP) error {
+	return s.db.QueryRowContext(ctx,
+		`INSERT INTO user_totp (user_id, secret, last_used_step, confirmed_at)
+		 VALUES (?, ?, 0, NULL)
+		 ON CONFLICT(user_id) DO UPDATE SET
+			 secret = excluded.secret,
+			 last_used_step = 0,
+			 confirmed_at = NULL,
+			 created_at = CURRENT_TIMESTAMP
+		 RETURNING created_at`,
+		totp.UserID, totp.Secret).Scan(&totp.CreatedAt)
+}
+
+func (s *SQLiteDB) GetUserTOTP(ctx context.Context, userID int64) (*models.UserTOTP, error) {
+	totp := &models.UserTOTP{}
+	var confirmedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT user_id, secret, last_used_step, confirmed_at, created_at
+		 FROM user_totp WHERE user_id = ?`, userID).
+		Scan(&totp.UserID, &totp.Secret, &totp.LastUsedStep, &confirmedAt, &totp.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if confirmedAt.Valid {
+		t := confirmedAt.Time
+		totp.ConfirmedAt = &t
+	}
+	return totp, nil
+}
+
+func (s *SQLiteDB) ConfirmUserTOTP(ctx context.Context, userID, step int64, confirmedAt time.Time) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE user_totp SET confirmed_at = ?, last_used_step = ?
+		 WHERE user_id = ? AND confirmed_at IS NULL`,
+		confirmedAt, step, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *SQLiteDB) AdvanceUserTOTPStep(ctx context.Context, userID, step int64) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE user_totp SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?`,
+		step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+func (s *SQLiteDB) DeleteUserTOTP(ctx context.Context, userID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteDB) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)`,
+			userID, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteDB) ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string, now time.Time) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE user_recovery_codes SET used_at = ?
+		 WHERE id = (
+			 SELECT id FROM user_recovery_codes
+			 WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+			 LIMIT 1
+		 ) AND used_at IS NULL`,
+		now, userID, codeHash)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *SQLiteDB) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL`,
+		userID).Scan(&count)
+	return count, err
+}
+
+func (s *SQLiteDB) CreateOIDCAuthState(ctx context.Context, state *models.OIDCAuthState) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO oidc_auth_states (state, provider, code_verifier, nonce, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		state.State, state.Provider, state.CodeVerifier, state.Nonce, state.ExpiresAt)
+	return err
+}
+
+func (s *SQLiteDB) ConsumeOIDCAuthState(ctx context.Context, state string, now time.Time) (*models.OIDCAuthState, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	st := &models.OIDCAuthState{}
+	err = tx.QueryRowContext(ctx,
+		`SELECT state, provider, code_verifier, nonce, expires_at, created_at
+		 FROM oidc_auth_states
+		 WHERE state = ? AND used_at IS NULL AND expires_at > ?`,
+		state, now).Scan(&st.State, &st.Provider, &st.CodeVerifier, &st.Nonce, &st.ExpiresAt, &st.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE oidc_auth_states SET used_at = ? WHERE state = ? AND used_at IS NULL`, now, state)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return nil, sql.ErrNoRows
+	}
+	// Expired states are only useful until now; clear them while here.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM oidc_auth_states WHERE expires_at <= ?`, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	st.UsedAt = &now
+	return st, nil
+}
+
+func (s *SQLiteDB) CreateUserIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	return s.db.QueryRowContext(ctx,
+		`INSERT INTO user_identities (user_id, provider, subject, email) VALUES (?, ?, ?, ?) RETURNING id, created_at`,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email).Scan(&identity.ID, &identity.CreatedAt)
+}
+
+func (s *SQLiteDB) GetUserIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	return scanUserIdentity(s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, provider, subject, email, created_at, last_login_at
+		 FROM user_identities WHERE provider = ? AND subject = ?`, provider, subject))
+}
+
+func (s *SQLiteDB) ListUserIdentities(ctx context.Context, userID int64) ([]models.UserIdentity, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, user_id, provider, subject, email, created_at, last_login_at
+		 FROM user_identities WHERE user_id = ? ORDER BY provider, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var identities []models.UserIdentity
+	for rows.Next() {
+		identity, err := scanUserIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, *identity)
+	}
+	return identities, rows.Err()
+}
+
+func (s *SQLiteDB) TouchUserIdentity(ctx context.Context, id int64, email string, now time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE user_identities SET email = ?, last_login_at = ? WHERE id = ?`, email, now, id)
+	return err
+}
+
+func scanUserIdentity(row interface{ Scan(...any) error }) (*models.UserIdentity, error) {
+	identity := &models.UserIdentity{}
+	var lastLogin sql.NullTime
+	if err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt, &lastLogin); err != nil {
+		return nil, err
+	}
+	if lastLogin.Valid {
+		t := lastLogin.Time
+		identity.LastLoginAt = &t
+	}
+	return identity, nil
+}
+
 // --- SSH Keys ---
 
 func (s *SQLiteDB) CreateSSHKey(ctx context.Context, k *models.SSHKey) error {
@@ -893,37 +1864,434 @@ func (s *SQLiteDB) CreateSSHKey(ctx context.Context, k *models.SSHKey) error {
 	return nil
 }
 
-func (s *SQLiteDB) ListSSHKeys(ctx context.Context, userID int64) ([]models.SSHKey, error) {
+func (s *SQLiteDB) ListSSHKeys(ctx context.Context, userID int64) ([]models.SSHKey, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, user_id, name, fingerprint, public_key, key_type, created_at FROM ssh_keys WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []models.SSHKey
+	for rows.Next() {
+		var k models.SSHKey
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Fingerprint, &k.PublicKey, &k.KeyType, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *SQLiteDB) GetSSHKeyByFingerprint(ctx context.Context, fp string) (*models.SSHKey, error) {
+	k := &models.SSHKey{}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, name, fingerprint, public_key, key_type, created_at FROM ssh_keys WHERE fingerprint = ?`, fp).
+		Scan(&k.ID, &k.UserID, &k.Name, &k.Fingerprint, &k.PublicKey, &k.KeyType, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (s *SQLiteDB) DeleteSSHKey(ctx context.Context, id, userID int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM ssh_keys WHERE id = ? AND user_id = ?`, id, userID)
+	return err
+}
+
+// --- Personal access tokens ---
+
+const personalAccessTokenColumns = `id, user_id, name, token_hash, token_prefix, scopes_csv, repo_ids_csv, created_at, last_used_at, expires_at, revoked_at`
+
+func scanPersonalAccessToken(row interface{ Scan(...any) error }) (*models.PersonalAccessToken, error) {
+	t := &models.PersonalAccessToken{}
+	if err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.TokenHash, &t.TokenPrefix, &t.ScopesCSV, &t.RepoIDsCSV,
+		&t.CreatedAt, &t.LastUsedAt, &t.ExpiresAt, &t.RevokedAt); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *SQLiteDB) CreatePersonalAccessToken(ctx context.Context, t *models.PersonalAccessToken) error {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes_csv, repo_ids_csv, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.UserID, t.Name, t.TokenHash, t.TokenPrefix, t.ScopesCSV, t.RepoIDsCSV, t.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	t.ID, _ = res.LastInsertId()
+	return s.db.QueryRowContext(ctx, `SELECT created_at FROM personal_access_tokens WHERE id = ?`, t.ID).Scan(&t.CreatedAt)
+}
+
+func (s *SQLiteDB) ListPersonalAccessTokens(ctx context.Context, userID int64) ([]models.PersonalAccessToken, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+personalAccessTokenColumns+`
+		 FROM personal_access_tokens
+		 WHERE user_id = ?
+		 ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := make([]models.PersonalAccessToken, 0)
+	for rows.Next() {
+		t, err := scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *SQLiteDB) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	return scanPersonalAccessToken(s.db.QueryRowContext(ctx,
+		`SELECT `+personalAccessTokenColumns+` FROM personal_access_tokens WHERE token_hash = ?`, tokenHash))
+}
+
+func (s *SQLiteDB) RevokePersonalAccessToken(ctx context.Context, id, userID int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE personal_access_tokens SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP) WHERE id = ? AND user_id = ?`,
+		id, userID)
+	return err
+}
+
+func (s *SQLiteDB) TouchPersonalAccessTokenUsed(ctx context.Context, id int64, usedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE personal_access_tokens SET last_used_at = ? WHERE id = ?`, usedAt, id)
+	return err
+}
+
+// --- OAuth apps ---
+
+const oauthAppColumns = `id, owner_id, name, homepage_url, client_id, client_secret_hash, redirect_uris_csv, created_at, updated_at`
+
+func scanOAuthApp(row interface{ Scan(...any) error }) (*models.OAuthApp, error) {
+	app := &models.OAuthApp{}
+	if err := row.Scan(&app.ID, &app.OwnerID, &app.Name, &app.HomepageURL, &app.ClientID, &app.ClientSecretHash,
+		&app.RedirectURIsCSV, &app.CreatedAt, &app.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+const oauthTokenColumns = `id, app_id, user_id, access_token_hash, refresh_token_hash, scopes_csv, access_expires_at, refresh_expires_at, created_at, last_used_at, revoked_at`
+
+func scanOAuthToken(row interface{ Scan(...any) error }) (*models.OAuthToken, error) {
+	t := &models.OAuthToken{}
+	if err := row.Scan(&t.ID, &t.AppID, &t.UserID, &t.AccessTokenHash, &t.RefreshTokenHash, &t.ScopesCSV,
+		&t.AccessExpiresAt, &t.RefreshExpiresAt, &t.CreatedAt, &t.LastUsedAt, &t.RevokedAt); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func scanOAuthAuthorization(row interface{ Scan(...any) error }) (*models.OAuthAuthorization, error) {
+	a := &models.OAuthAuthorization{}
+	var lastUsed sql.NullTime
+	if err := row.Scan(&a.AppID, &a.AppName, &a.ClientID, &a.HomepageURL, &a.UserID, &a.ScopesCSV,
+		&a.CreatedAt, &a.UpdatedAt, &lastUsed); err != nil {
+		return nil, err
+	}
+	if lastUsed.Valid {
+		t := lastUsed.Time
+		a.LastUsedAt = &t
+	}
+	return a, nil
+}
+
+func (s *SQLiteDB) CreateOAuthApp(ctx context.Context, app *models.OAuthApp) error {
+	return s.db.QueryRowContext(ctx,
+		`INSERT INTO oauth_apps (owner_id, name, homepage_url, client_id, client_secret_hash, redirect_uris_csv)
+		 VALUES (?, ?, ?, ?, ?, ?)
+		 RETURNING id, created_at, updated_at`,
+		app.OwnerID, app.Name, app.HomepageURL, app.ClientID, app.ClientSecretHash, app.RedirectURIsCSV,
+	).Scan(&app.ID, &app.CreatedAt, &app.UpdatedAt)
+}
+
+func (s *SQLiteDB) GetOAuthApp(ctx context.Context, id int64) (*models.OAuthApp, error) {
+	return scanOAuthApp(s.db.QueryRowContext(ctx, `SELECT `+oauthAppColumns+` FROM oauth_apps WHERE id = ?`, id))
+}
+
+func (s *SQLiteDB) GetOAuthAppByClientID(ctx context.Context, clientID string) (*models.OAuthApp, error) {
+	return scanOAuthApp(s.db.QueryRowContext(ctx, `SELECT `+oauthAppColumns+` FROM oauth_apps WHERE client_id = ?`, clientID))
+}
+
+func (s *SQLiteDB) ListOAuthApps(ctx context.Context, ownerID int64) ([]models.OAuthApp, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+oauthAppColumns+` FROM oauth_apps WHERE owner_id = ? ORDER BY created_at DESC, id DESC`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	apps := make([]models.OAuthApp, 0)
+	for rows.Next() {
+		app, err := scanOAuthApp(rows)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, *app)
+	}
+	return apps, rows.Err()
+}
+
+func (s *SQLiteDB) UpdateOAuthApp(ctx context.Context, app *models.OAuthApp) error {
+	return s.db.QueryRowContext(ctx,
+		`UPDATE oauth_apps
+		 SET name = ?, homepage_url = ?, client_secret_hash = ?, redirect_uris_csv = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND owner_id = ?
+		 RETURNING updated_at`,
+		app.Name, app.HomepageURL, app.ClientSecretHash, app.RedirectURIsCSV, app.ID, app.OwnerID,
+	).Scan(&app.UpdatedAt)
+}
+
+func (s *SQLiteDB) DeleteOAuthApp(ctx context.Context, id, ownerID int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM oauth_apps WHERE id = ? AND owner_id = ?`, id, ownerID)
+	return err
+}
+
+func (s *SQLiteDB) CreateOAuthAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	return s.db.QueryRowContext(ctx,
+		`INSERT INTO oauth_authorization_codes (app_id, user_id, code_hash, redirect_uri, scopes_csv, code_challenge, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)
+		 RETURNING id, created_at`,
+		code.AppID, code.UserID, code.CodeHash, code.RedirectURI, code.ScopesCSV, code.CodeChallenge, code.ExpiresAt,
+	).Scan(&code.ID, &code.CreatedAt)
+}
+
+func (s *SQLiteDB) ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string, now time.Time) (*models.OAuthAuthorizationCode, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	c := &models.OAuthAuthorizationCode{}
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, app_id, user_id, code_hash, redirect_uri, scopes_csv, code_challenge, expires_at, created_at
+		 FROM oauth_authorization_codes
+		 WHERE code_hash = ? AND used_at IS NULL AND expires_at > ?`,
+		codeHash, now).Scan(&c.ID, &c.AppID, &c.UserID, &c.CodeHash, &c.RedirectURI, &c.ScopesCSV, &c.CodeChallenge, &c.ExpiresAt, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE oauth_authorization_codes SET used_at = ? WHERE id = ? AND used_at IS NULL`, now, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return nil, sql.ErrNoRows
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM oauth_authorization_codes WHERE expires_at <= ?`, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	c.UsedAt = &now
+	return c, nil
+}
+
+func (s *SQLiteDB) UpsertOAuthAuthorization(ctx context.Context, a *models.OAuthAuthorization) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO oauth_authorizations (app_id, user_id, scopes_csv) VALUES (?, ?, ?)
+		 ON CONFLICT(app_id, user_id) DO UPDATE SET scopes_csv = excluded.scopes_csv, updated_at = CURRENT_TIMESTAMP`,
+		a.AppID, a.UserID, a.ScopesCSV)
+	return err
+}
+
+func (s *SQLiteDB) ListOAuthAuthorizations(ctx context.Context, userID int64) ([]models.OAuthAuthorization, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT a.app_id, p.name, p.client_id, p.homepage_url, a.user_id, a.scopes_csv, a.created_at, a.updated_at, a.last_used_at
+		 FROM oauth_authorizations a
+		 JOIN oauth_apps p ON p.id = a.app_id
+		 WHERE a.user_id = ?
+		 ORDER BY a.updated_at DESC, a.app_id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	auths := make([]models.OAuthAuthorization, 0)
+	for rows.Next() {
+		a, err := scanOAuthAuthorization(rows)
+		if err != nil {
+			return nil, err
+		}
+		auths = append(auths, *a)
+	}
+	return auths, rows.Err()
+}
+
+func (s *SQLiteDB) DeleteOAuthAuthorization(ctx context.Context, appID, userID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM oauth_authorizations WHERE app_id = ? AND user_id = ?`, appID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE oauth_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE app_id = ? AND user_id = ? AND revoked_at IS NULL`,
+		appID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM oauth_authorization_codes WHERE app_id = ? AND user_id = ?`, appID, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteDB) CreateOAuthToken(ctx context.Context, t *models.OAuthToken) error {
+	return s.db.QueryRowContext(ctx,
+		`INSERT INTO oauth_tokens (app_id, user_id, access_token_hash, refresh_token_hash, scopes_csv, access_expires_at, refresh_expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)
+		 RETURNING id, created_at`,
+		t.AppID, t.UserID, t.AccessTokenHash, t.RefreshTokenHash, t.ScopesCSV, t.AccessExpiresAt, t.RefreshExpiresAt,
+	).Scan(&t.ID, &t.CreatedAt)
+}
+
+func (s *SQLiteDB) GetOAuthTokenByAccessHash(ctx context.Context, hash string) (*models.OAuthToken, error) {
+	return scanOAuthToken(s.db.QueryRowContext(ctx,
+		`SELECT `+oauthTokenColumns+` FROM oauth_tokens WHERE access_token_hash = ?`, hash))
+}
+
+func (s *SQLiteDB) GetOAuthTokenByRefreshHash(ctx context.Context, hash string) (*models.OAuthToken, error) {
+	return scanOAuthToken(s.db.QueryRowContext(ctx,
+		`SELECT `+oauthTokenColumns+` FROM oauth_tokens WHERE refresh_token_hash = ?`, hash))
+}
+
+func (s *SQLiteDB) RevokeOAuthToken(ctx context.Context, id int64, now time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE oauth_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, now, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *SQLiteDB) TouchOAuthTokenUsed(ctx context.Context, id int64, usedAt time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `UPDATE oauth_tokens SET last_used_at = ? WHERE id = ?`, usedAt, id); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE oauth_authorizations SET last_used_at = ?
+		 WHERE (app_id, user_id) = (SELECT app_id, user_id FROM oauth_tokens WHERE id = ?)`, usedAt, id)
+	return err
+}
+
+// --- GPG keys ---
+
+func (s *SQLiteDB) CreateGPGKey(ctx context.Context, k *models.GPGKey) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO gpg_keys (user_id, key_id, fingerprint, public_key, emails_csv, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		k.UserID, k.KeyID, k.Fingerprint, k.PublicKey, k.EmailsCSV, k.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	k.ID, _ = res.LastInsertId()
+	for i := range k.Subkeys {
+		sub := &k.Subkeys[i]
+		sub.GPGKeyID = k.ID
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO gpg_subkeys (gpg_key_id, key_id, fingerprint, expires_at) VALUES (?, ?, ?, ?)`,
+			sub.GPGKeyID, sub.KeyID, sub.Fingerprint, sub.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		sub.ID, _ = res.LastInsertId()
+	}
+	if err := tx.QueryRowContext(ctx, `SELECT created_at FROM gpg_keys WHERE id = ?`, k.ID).Scan(&k.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteDB) ListGPGKeys(ctx context.Context, userID int64) ([]models.GPGKey, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, user_id, key_id, fingerprint, public_key, emails_csv, expires_at, created_at
+		 FROM gpg_keys WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	var keys []models.GPGKey
+	for rows.Next() {
+		var k models.GPGKey
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&k.ID, &k.UserID, &k.KeyID, &k.Fingerprint, &k.PublicKey, &k.EmailsCSV, &expiresAt, &k.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if expiresAt.Valid {
+			k.ExpiresAt = &expiresAt.Time
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		if keys[i].Subkeys, err = s.listGPGSubkeys(ctx, keys[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// GetGPGKeyByKeyID finds the key whose primary key or one of whose subkeys
+// has the given key ID.
+func (s *SQLiteDB) GetGPGKeyByKeyID(ctx context.Context, keyID string) (*models.GPGKey, error) {
+	k := &models.GPGKey{}
+	var expiresAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, key_id, fingerprint, public_key, emails_csv, expires_at, created_at
+		 FROM gpg_keys
+		 WHERE key_id = ? OR id = (SELECT gpg_key_id FROM gpg_subkeys WHERE key_id = ?)`, keyID, keyID).
+		Scan(&k.ID, &k.UserID, &k.KeyID, &k.Fingerprint, &k.PublicKey, &k.EmailsCSV, &expiresAt, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
+	if k.Subkeys, err = s.listGPGSubkeys(ctx, k.ID); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (s *SQLiteDB) listGPGSubkeys(ctx context.Context, gpgKeyID int64) ([]models.GPGSubkey, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, user_id, name, fingerprint, public_key, key_type, created_at FROM ssh_keys WHERE user_id = ?`, userID)
+		`SELECT id, gpg_key_id, key_id, fingerprint, expires_at FROM gpg_subkeys WHERE gpg_key_id = ? ORDER BY id`, gpgKeyID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var keys []models.SSHKey
+	var subkeys []models.GPGSubkey
 	for rows.Next() {
-		var k models.SSHKey
-		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Fingerprint, &k.PublicKey, &k.KeyType, &k.CreatedAt); err != nil {
+		var sub models.GPGSubkey
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&sub.ID, &sub.GPGKeyID, &sub.KeyID, &sub.Fingerprint, &expiresAt); err != nil {
 			return nil, err
 		}
-		keys = append(keys, k)
-	}
-	return keys, rows.Err()
-}
-
-func (s *SQLiteDB) GetSSHKeyByFingerprint(ctx context.Context, fp string) (*models.SSHKey, error) {
-	k := &models.SSHKey{}
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, user_id, name, fingerprint, public_key, key_type, created_at FROM ssh_keys WHERE fingerprint = ?`, fp).
-		Scan(&k.ID, &k.UserID, &k.Name, &k.Fingerprint, &k.PublicKey, &k.KeyType, &k.CreatedAt)
-	if err != nil {
-		return nil, err
+		if expiresAt.Valid {
+			sub.ExpiresAt = &expiresAt.Time
+		}
+		subkeys = append(subkeys, sub)
 	}
-	return k, nil
+	return subkeys, rows.Err()
 }
 
-func (s *SQLiteDB) DeleteSSHKey(ctx context.Context, id, userID int64) error {
-	_, err := s.db.ExecContext(ctx, `DELETE FROM ssh_keys WHERE id = ? AND user_id = ?`, id, userID)
+func (s *SQLiteDB) DeleteGPGKey(ctx context.Context, id, userID int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM gpg_keys WHERE id = ? AND user_id = ?`, id, userID)
 	return err
 }
 
@@ -1255,6 +2623,18 @@ func (s *SQLiteDB) DeleteRepository(ctx context.Context, id int64) error {
 	return err
 }
 
+func (s *SQLiteDB) TransferRepository(ctx context.Context, id int64, ownerUserID, ownerOrgID *int64) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE repositories SET owner_user_id = ?, owner_org_id = ? WHERE id = ?`, ownerUserID, ownerOrgID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 // --- Stars ---
 
 func (s *SQLiteDB) AddRepoStar(ctx context.Context, repoID, userID int64) error {
@@ -1449,8 +2829,8 @@ func (s *SQLiteDB) CreatePullRequest(ctx context.Context, pr *models.PullRequest
 		pr.Number = maxNum + 1
 
 		res, err := tx.ExecContext(ctx,
-			`INSERT INTO pull_requests (repo_id, number, title, body, state, author_id, source_branch, target_branch, source_commit, target_commit)
-			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			`INSERT INTO pull_requests (repo_id, number, title, body, state, author_id, source_branch, target_branch, source_commit, target_commit, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
 			pr.RepoID, pr.Number, pr.Title, pr.Body, pr.State, pr.AuthorID, pr.SourceBranch, pr.TargetBranch, pr.SourceCommit, pr.TargetCommit)
 		if err != nil {
 			tx.Rollback()
@@ -1513,6 +2893,23 @@ func (s *SQLiteDB) GetPullRequest(ctx context.Context, repoID int64, number int)
 	return pr, nil
 }
 
+func (s *SQLiteDB) GetPullRequestByID(ctx context.Context, id int64) (*models.PullRequest, error) {
+	pr := &models.PullRequest{}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT pr.id, pr.repo_id, pr.number, pr.title, pr.body, pr.state, pr.author_id, u.username,
+		        pr.source_branch, pr.target_branch, pr.source_commit, pr.target_commit, pr.merge_commit, pr.merge_method, pr.created_at, pr.merged_at
+		 FROM pull_requests pr
+		 JOIN users u ON u.id = pr.author_id
+		 WHERE pr.id = ?`, id).
+		Scan(&pr.ID, &pr.RepoID, &pr.Number, &pr.Title, &pr.Body, &pr.State, &pr.AuthorID, &pr.AuthorName,
+			&pr.SourceBranch, &pr.TargetBranch, &pr.SourceCommit, &pr.TargetCommit,
+			&pr.MergeCommit, &pr.MergeMethod, &pr.CreatedAt, &pr.MergedAt)
+	if err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
 func (s *SQLiteDB) ListPullRequests(ctx context.Context, repoID int64, state string) ([]models.PullRequest, error) {
 	return s.ListPullRequestsPage(ctx, repoID, state, 1<<30, 0)
 }
@@ -1557,7 +2954,7 @@ func (s *SQLiteDB) ListPullRequestsPage(ctx context.Context, repoID int64, state
 
 func (s *SQLiteDB) UpdatePullRequest(ctx context.Context, pr *models.PullRequest) error {
 	_, err := s.db.ExecContext(ctx,
-		`UPDATE pull_requests SET title=?, body=?, state=?, source_commit=?, target_commit=?, merge_commit=?, merge_method=?, merged_at=?
+		`UPDATE pull_requests SET title=?, body=?, state=?, source_commit=?, target_commit=?, merge_commit=?, merge_method=?, merged_at=?, updated_at=CURRENT_TIMESTAMP
 		 WHERE id = ?`,
 		pr.Title, pr.Body, pr.State, pr.SourceCommit, pr.TargetCommit, pr.MergeCommit, pr.MergeMethod, pr.MergedAt, pr.ID)
 	return err
@@ -1574,7 +2971,8 @@ func (s *SQLiteDB) CreatePRComment(ctx context.Context, c *models.PRComment) err
 		return err
 	}
 	c.ID, _ = res.LastInsertId()
-	return nil
+	_, err = s.db.ExecContext(ctx, `UPDATE pull_requests SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, c.PRID)
+	return err
 }
 
 func (s *SQLiteDB) ListPRComments(ctx context.Context, prID int64) ([]models.PRComment, error) {
@@ -1632,7 +3030,8 @@ func (s *SQLiteDB) CreatePRReview(ctx context.Context, r *models.PRReview) error
 		return err
 	}
 	r.ID, _ = res.LastInsertId()
-	return nil
+	_, err = s.db.ExecContext(ctx, `UPDATE pull_requests SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, r.PRID)
+	return err
 }
 
 func (s *SQLiteDB) ListPRReviews(ctx context.Context, prID int64) ([]models.PRReview, error) {
@@ -1695,8 +3094,8 @@ func (s *SQLiteDB) CreateIssue(ctx context.Context, issue *models.Issue) error {
 		issue.Number = maxNum + 1
 
 		res, err := tx.ExecContext(ctx,
-			`INSERT INTO issues (repo_id, number, title, body, state, author_id)
-			 VALUES (?, ?, ?, ?, ?, ?)`,
+			`INSERT INTO issues (repo_id, number, title, body, state, author_id, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
 			issue.RepoID, issue.Number, issue.Title, issue.Body, issue.State, issue.AuthorID)
 		if err != nil {
 			tx.Rollback()
@@ -1734,6 +3133,20 @@ func (s *SQLiteDB) GetIssue(ctx context.Context, repoID int64, number int) (*mod
 	return issue, nil
 }
 
+func (s *SQLiteDB) GetIssueByID(ctx context.Context, id int64) (*models.Issue, error) {
+	issue := &models.Issue{}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT i.id, i.repo_id, i.number, i.title, i.body, i.state, i.author_id, u.username, i.created_at, i.closed_at
+		 FROM issues i
+		 JOIN users u ON u.id = i.author_id
+		 WHERE i.id = ?`, id).
+		Scan(&issue.ID, &issue.RepoID, &issue.Number, &issue.Title, &issue.Body, &issue.State, &issue.AuthorID, &issue.AuthorName, &issue.CreatedAt, &issue.ClosedAt)
+	if err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
 func (s *SQLiteDB) ListIssues(ctx context.Context, repoID int64, state string) ([]models.Issue, error) {
 	return s.ListIssuesPage(ctx, repoID, state, 1<<30, 0)
 }
@@ -1775,7 +3188,7 @@ func (s *SQLiteDB) ListIssuesPage(ctx context.Context, repoID int64, state strin
 
 func (s *SQLiteDB) UpdateIssue(ctx context.Context, issue *models.Issue) error {
 	_, err := s.db.ExecContext(ctx,
-		`UPDATE issues SET title = ?, body = ?, state = ?, closed_at = ? WHERE id = ?`,
+		`UPDATE issues SET title = ?, body = ?, state = ?, closed_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
 		issue.Title, issue.Body, issue.State, issue.ClosedAt, issue.ID)
 	return err
 }
@@ -1788,7 +3201,8 @@ func (s *SQLiteDB) CreateIssueComment(ctx context.Context, c *models.IssueCommen
 		return err
 	}
 	c.ID, _ = res.LastInsertId()
-	return nil
+	_, err = s.db.ExecContext(ctx, `UPDATE issues SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, c.IssueID)
+	return err
 }
 
 func (s *SQLiteDB) ListIssueComments(ctx context.Context, issueID int64) ([]models.IssueComment, error) {
@@ -1836,14 +3250,208 @@ func (s *SQLiteDB) DeleteIssueComment(ctx context.Context, commentID, authorID i
 	return nil
 }
 
+func (s *SQLiteDB) UpsertIssueReference(ctx context.Context, ref *models.IssueReference) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO issue_references (
+			 repo_id, issue_id, source_type, source_id, source_number, commit_hash, actor_id, closing
+		 ) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(issue_id, source_type, source_id, commit_hash) DO UPDATE SET
+			 closing = issue_references.closing OR excluded.closing`,
+		ref.RepoID, ref.IssueID, ref.SourceType, ref.SourceID, ref.SourceNumber, ref.CommitHash, ref.ActorID, ref.Closing)
+	if err != nil {
+		return err
+	}
+	return s.db.QueryRowContext(ctx,
+		`SELECT id, closing, created_at
+		 FROM issue_references
+		 WHERE issue_id = ? AND source_type = ? AND source_id = ? AND commit_hash = ?`,
+		ref.IssueID, ref.SourceType, ref.SourceID, ref.CommitHash).
+		Scan(&ref.ID, &ref.Closing, &ref.CreatedAt)
+}
+
+func (s *SQLiteDB) ListIssueReferences(ctx context.Context, issueID int64) ([]models.IssueReference, error) {
+	return s.ListIssueReferencesPage(ctx, issueID, 1<<30, 0)
+}
+
+func (s *SQLiteDB) ListIssueReferencesPage(ctx context.Context, issueID int64, limit, offset int) ([]models.IssueReference, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT r.id, r.repo_id, r.issue_id, i.number, r.source_type, r.source_id, r.source_number, r.commit_hash, r.actor_id, u.username, r.closing, r.created_at
+		 FROM issue_references r
+		 JOIN issues i ON i.id = r.issue_id
+		 JOIN users u ON u.id = r.actor_id
+		 WHERE r.issue_id = ?
+		 ORDER BY r.created_at, r.id
+		 LIMIT ? OFFSET ?`, issueID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var refs []models.IssueReference
+	for rows.Next() {
+		var ref models.IssueReference
+		if err := rows.Scan(&ref.ID, &ref.RepoID, &ref.IssueID, &ref.IssueNumber, &ref.SourceType, &ref.SourceID, &ref.SourceNumber, &ref.CommitHash, &ref.ActorID, &ref.ActorName, &ref.Closing, &ref.CreatedAt); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
+func (s *SQLiteDB) AddIssueEntityLink(ctx context.Context, link *models.IssueEntityLink) error {
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT INTO issue_entity_links (repo_id, issue_id, stable_id, creator_id)
+		 VALUES (?, ?, ?, ?)
+		 ON CONFLICT(issue_id, stable_id) DO NOTHING`,
+		link.RepoID, link.IssueID, link.StableID, link.CreatorID); err != nil {
+		return err
+	}
+	return s.db.QueryRowContext(ctx,
+		`SELECT id, creator_id, created_at FROM issue_entity_links WHERE issue_id = ? AND stable_id = ?`,
+		link.IssueID, link.StableID).Scan(&link.ID, &link.CreatorID, &link.CreatedAt)
+}
+
+func (s *SQLiteDB) DeleteIssueEntityLink(ctx context.Context, issueID int64, stableID string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM issue_entity_links WHERE issue_id = ? AND stable_id = ?`, issueID, stableID)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const sqliteIssueEntityLinkColumns = `l.id, l.repo_id, l.issue_id, i.number, i.title, i.state, l.stable_id,
+	COALESCE(e.name, ''), COALESCE(e.decl_kind, ''), COALESCE(e.receiver, ''), l.creator_id, l.created_at`
+
+func (s *SQLiteDB) ListIssueEntityLinks(ctx context.Context, issueID int64) ([]models.IssueEntityLink, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+sqliteIssueEntityLinkColumns+`
+		 FROM issue_entity_links l
+		 JOIN issues i ON i.id = l.issue_id
+		 LEFT JOIN entity_identities e ON e.repo_id = l.repo_id AND e.stable_id = l.stable_id
+		 WHERE l.issue_id = ?
+		 ORDER BY l.created_at, l.id`, issueID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanSQLiteIssueEntityLinks(rows)
+}
+
+func (s *SQLiteDB) ListOpenIssueEntityLinks(ctx context.Context, repoID int64, stableIDs []string) ([]models.IssueEntityLink, error) {
+	if len(stableIDs) == 0 {
+		return nil, nil
+	}
+	args := []any{repoID}
+	placeholders := make([]string, 0, len(stableIDs))
+	for _, id := range stableIDs {
+		placeholders = append(placeholders, "?")
+		args = append(args, id)
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+sqliteIssueEntityLinkColumns+`
+		 FROM issue_entity_links l
+		 JOIN issues i ON i.id = l.issue_id
+		 LEFT JOIN entity_identities e ON e.repo_id = l.repo_id AND e.stable_id = l.stable_id
+		 WHERE l.repo_id = ? AND i.state = 'open' AND l.stable_id IN (`+strings.Join(placeholders, ", ")+`)
+		 ORDER BY i.number DESC, l.stable_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanSQLiteIssueEntityLinks(rows)
+}
+
+func scanSQLiteIssueEntityLinks(rows *sql.Rows) ([]models.IssueEntityLink, error) {
+	var links []models.IssueEntityLink
+	for rows.Next() {
+		var l models.IssueEntityLink
+		if err := rows.Scan(&l.ID, &l.RepoID, &l.IssueID, &l.IssueNumber, &l.IssueTitle, &l.IssueState, &l.StableID, &l.EntityName, &l.DeclKind, &l.Receiver, &l.CreatorID, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+func (s *SQLiteDB) SearchIssues(ctx context.Context, q models.IssueSearchQuery, limit, offset int) ([]models.IssueSearchResult, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	var branches []string
+	var args []any
+	if q.Kind != models.IssueSearchKindPullRequest && q.State != models.PullRequestStateMerged {
+		branches = append(branches, `SELECT 'issue' AS kind, i.id * 2 AS search_rowid, i.id, i.repo_id, i.number, i.title, i.body, i.state, i.author_id,
+			 (SELECT COUNT(*) FROM issue_comments c WHERE c.issue_id = i.id) AS comment_count, i.created_at, i.updated_at
+		 FROM issues i
+		 WHERE i.repo_id = ?`+issueSearchStateClause("i.state", q.State))
+		args = append(args, q.RepoID)
+	}
+	if q.Kind != models.IssueSearchKindIssue {
+		branches = append(branches, `SELECT 'pull_request' AS kind, p.id * 2 + 1 AS search_rowid, p.id, p.repo_id, p.number, p.title, p.body, p.state, p.author_id,
+			 (SELECT COUNT(*) FROM pr_comments c WHERE c.pr_id = p.id) AS comment_count, p.created_at, p.updated_at
+		 FROM pull_requests p
+		 WHERE p.repo_id = ?`+issueSearchStateClause("p.state", q.State))
+		args = append(args, q.RepoID)
+	}
+	if len(branches) == 0 {
+		return nil, nil
+	}
+
+	score := "0.0"
+	join := ""
+	where := " WHERE 1 = 1"
+	if len(q.Terms) > 0 {
+		score = "-issue_search_fts.rank"
+		join = " JOIN issue_search_fts ON issue_search_fts.rowid = t.search_rowid"
+		where += ` AND issue_search_fts MATCH ? AND issue_search_fts.rank MATCH 'bm25(10.0, 4.0, 1.0)'`
+		args = append(args, sqliteIssueSearchMatch(q))
+	}
+	if q.AuthorName != "" {
+		where += " AND u.username = ?"
+		args = append(args, q.AuthorName)
+	}
+	query := `SELECT t.kind, t.id, t.repo_id, t.number, t.title, t.body, t.state, t.author_id, COALESCE(u.username, ''), t.comment_count, ` + score + `, t.created_at, t.updated_at
+		 FROM (` + strings.Join(branches, " UNION ALL ") + `) t` + join + `
+		 LEFT JOIN users u ON u.id = t.author_id` + where +
+		issueSearchOrderBy(q, "issue_search_fts.rank") + ` LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var results []models.IssueSearchResult
+	for rows.Next() {
+		var r models.IssueSearchResult
+		if err := rows.Scan(&r.Kind, &r.ID, &r.RepoID, &r.Number, &r.Title, &r.Body, &r.State, &r.AuthorID, &r.AuthorName, &r.CommentCount, &r.Score, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
 // --- Notifications ---
 
 func (s *SQLiteDB) CreateNotification(ctx context.Context, n *models.Notification) error {
 	res, err := s.db.ExecContext(ctx,
 		`INSERT INTO notifications (
-			 user_id, actor_id, type, title, body, resource_path, repo_id, pr_id, issue_id, read_at
-		 ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		n.UserID, n.ActorID, n.Type, n.Title, n.Body, n.ResourcePath, n.RepoID, n.PRID, n.IssueID, n.ReadAt)
+			 user_id, actor_id, type, title, body, resource_path, repo_id, pr_id, issue_id, reason, read_at
+		 ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		n.UserID, n.ActorID, n.Type, n.Title, n.Body, n.ResourcePath, n.RepoID, n.PRID, n.IssueID, n.Reason, n.ReadAt)
 	if err != nil {
 		return err
 	}
@@ -1852,11 +3460,11 @@ func (s *SQLiteDB) CreateNotification(ctx context.Context, n *models.Notificatio
 }
 
 func (s *SQLiteDB) ListNotifications(ctx context.Context, userID int64, unreadOnly bool) ([]models.Notification, error) {
-	return s.ListNotificationsPage(ctx, userID, unreadOnly, 1<<30, 0)
+	return s.ListNotificationsPage(ctx, userID, unreadOnly, "", 1<<30, 0)
 }
 
-func (s *SQLiteDB) ListNotificationsPage(ctx context.Context, userID int64, unreadOnly bool, limit, offset int) ([]models.Notification, error) {
-	query := `SELECT n.id, n.user_id, n.actor_id, a.username, n.type, n.title, n.body, n.resource_path, n.repo_id, n.pr_id, n.issue_id, n.read_at, n.created_at
+func (s *SQLiteDB) ListNotificationsPage(ctx context.Context, userID int64, unreadOnly bool, reason string, limit, offset int) ([]models.Notification, error) {
+	query := `SELECT n.id, n.user_id, n.actor_id, a.username, n.type, n.title, n.body, n.resource_path, n.repo_id, n.pr_id, n.issue_id, n.reason, n.read_at, n.created_at
 		 FROM notifications n
 		 JOIN users a ON a.id = n.actor_id
 		 WHERE n.user_id = ?`
@@ -1864,6 +3472,10 @@ func (s *SQLiteDB) ListNotificationsPage(ctx context.Context, userID int64, unre
 	if unreadOnly {
 		query += ` AND n.read_at IS NULL`
 	}
+	if reason != "" {
+		query += ` AND n.reason = ?`
+		args = append(args, reason)
+	}
 	if limit <= 0 {
 		limit = 100
 	}
@@ -1879,12 +3491,168 @@ func (s *SQLiteDB) ListNotificationsPage(ctx context.Context, userID int64, unre
 	}
 	defer rows.Close()
 
+	return scanNotificationRows(rows)
+}
+
+func (s *SQLiteDB) CountUnreadNotifications(ctx context.Context, userID int64) (int, error) {
+	var count int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL`,
+		userID).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *SQLiteDB) MarkNotificationRead(ctx context.Context, id, userID int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ? AND read_at IS NULL`,
+		id, userID)
+	return err
+}
+
+func (s *SQLiteDB) MarkAllNotificationsRead(ctx context.Context, userID int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = ? AND read_at IS NULL`,
+		userID)
+	return err
+}
+
+func (s *SQLiteDB) DeleteNotificationsForResource(ctx context.Context, userID int64, resourcePath string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM notifications WHERE user_id = ? AND resource_path = ?`, userID, resourcePath)
+	return err
+}
+
+func (s *SQLiteDB) EnsureThreadSubscription(ctx context.Context, sub *models.ThreadSubscription) error {
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT INTO thread_subscriptions (user_id, repo_id, thread_type, thread_id, reason, subscribed)
+		 VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(user_id, thread_type, thread_id) DO NOTHING`,
+		sub.UserID, sub.RepoID, sub.ThreadType, sub.ThreadID, sub.Reason, sub.Subscribed); err != nil {
+		return err
+	}
+	return s.db.QueryRowContext(ctx,
+		`SELECT id, repo_id, reason, subscribed, created_at, updated_at
+		 FROM thread_subscriptions
+		 WHERE user_id = ? AND thread_type = ? AND thread_id = ?`,
+		sub.UserID, sub.ThreadType, sub.ThreadID).
+		Scan(&sub.ID, &sub.RepoID, &sub.Reason, &sub.Subscribed, &sub.CreatedAt, &sub.UpdatedAt)
+}
+
+func (s *SQLiteDB) SetThreadSubscription(ctx context.Context, sub *models.ThreadSubscription) error {
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT INTO thread_subscriptions (user_id, repo_id, thread_type, thread_id, reason, subscribed)
+		 VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(user_id, thread_type, thread_id) DO UPDATE SET
+			 reason = excluded.reason,
+			 subscribed = excluded.subscribed,
+			 updated_at = CURRENT_TIMESTAMP`,
+		sub.UserID, sub.RepoID, sub.ThreadType, sub.ThreadID, sub.Reason, sub.Subscribed); err != nil {
+		return err
+	}
+	return s.db.QueryRowContext(ctx,
+		`SELECT id, repo_id, created_at, updated_at
+		 FROM thread_subscriptions
+		 WHERE user_id = ? AND thread_type = ? AND thread_id = ?`,
+		sub.UserID, sub.ThreadType, sub.ThreadID).
+		Scan(&sub.ID, &sub.RepoID, &sub.CreatedAt, &sub.UpdatedAt)
+}
+
+func (s *SQLiteDB) GetThreadSubscription(ctx context.Context, userID int64, threadType string, threadID int64) (*models.ThreadSubscription, error) {
+	sub := &models.ThreadSubscription{}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, repo_id, thread_type, thread_id, reason, subscribed, created_at, updated_at
+		 FROM thread_subscriptions
+		 WHERE user_id = ? AND thread_type = ? AND thread_id = ?`,
+		userID, threadType, threadID).
+		Scan(&sub.ID, &sub.UserID, &sub.RepoID, &sub.ThreadType, &sub.ThreadID, &sub.Reason, &sub.Subscribed, &sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (s *SQLiteDB) ListThreadSubscriptions(ctx context.Context, threadType string, threadID int64) ([]models.ThreadSubscription, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, user_id, repo_id, thread_type, thread_id, reason, subscribed, created_at, updated_at
+		 FROM thread_subscriptions
+		 WHERE thread_type = ? AND thread_id = ?
+		 ORDER BY user_id`, threadType, threadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var subs []models.ThreadSubscription
+	for rows.Next() {
+		var sub models.ThreadSubscription
+		if err := rows.Scan(&sub.ID, &sub.UserID, &sub.RepoID, &sub.ThreadType, &sub.ThreadID, &sub.Reason, &sub.Subscribed, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (s *SQLiteDB) SetRepoWatch(ctx context.Context, w *models.RepoWatch) error {
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT INTO repo_watches (user_id, repo_id, level)
+		 VALUES (?, ?, ?)
+		 ON CONFLICT(user_id, repo_id) DO UPDATE SET
+			 level = excluded.level,
+			 updated_at = CURRENT_TIMESTAMP`,
+		w.UserID, w.RepoID, w.Level); err != nil {
+		return err
+	}
+	return s.db.QueryRowContext(ctx,
+		`SELECT created_at, updated_at FROM repo_watches WHERE user_id = ? AND repo_id = ?`,
+		w.UserID, w.RepoID).Scan(&w.CreatedAt, &w.UpdatedAt)
+}
+
+func (s *SQLiteDB) GetRepoWatch(ctx context.Context, userID, repoID int64) (*models.RepoWatch, error) {
+	w := &models.RepoWatch{}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT user_id, repo_id, level, created_at, updated_at
+		 FROM repo_watches WHERE user_id = ? AND repo_id = ?`,
+		userID, repoID).Scan(&w.UserID, &w.RepoID, &w.Level, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (s *SQLiteDB) DeleteRepoWatch(ctx context.Context, userID, repoID int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM repo_watches WHERE user_id = ? AND repo_id = ?`, userID, repoID)
+	return err
+}
+
+func (s *SQLiteDB) ListRepoWatches(ctx context.Context, repoID int64) ([]models.RepoWatch, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT user_id, repo_id, level, created_at, updated_at
+		 FROM repo_watches WHERE repo_id = ?
+		 ORDER BY user_id`, repoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var watches []models.RepoWatch
+	for rows.Next() {
+		var w models.RepoWatch
+		if err := rows.Scan(&w.UserID, &w.RepoID, &w.Level, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return nil, err
+		}
+		watches = append(watches, w)
+	}
+	return watches, rows.Err()
+}
+
+func scanNotificationRows(rows *sql.Rows) ([]models.Notification, error) {
 	var notifications []models.Notification
 	for rows.Next() {
 		var n models.Notification
 		var repoID, prID, issueID sql.NullInt64
 		var readAt sql.NullTime
-		if err := rows.Scan(&n.ID, &n.UserID, &n.ActorID, &n.ActorName, &n.Type, &n.Title, &n.Body, &n.ResourcePath, &repoID, &prID, &issueID, &readAt, &n.CreatedAt); err != nil {
+		if err := rows.Scan(&n.ID, &n.UserID, &n.ActorID, &n.ActorName, &n.Type, &n.Title, &n.Body, &n.ResourcePath, &repoID, &prID, &issueID, &n.Reason, &readAt, &n.CreatedAt); err != nil {
 			return nil, err
 		}
 		if repoID.Valid {
@@ -1899,37 +3667,140 @@ func (s *SQLiteDB) ListNotificationsPage(ctx context.Context, userID int64, unre
 			v := issueID.Int64
 			n.IssueID = &v
 		}
-		if readAt.Valid {
-			t := readAt.Time
-			n.ReadAt = &t
+		if readAt.Valid {
+			t := readAt.Time
+			n.ReadAt = &t
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// --- Notification digests ---
+
+func (s *SQLiteDB) GetNotificationSettings(ctx context.Context, userID int64) (*models.NotificationSettings, error) {
+	settings := &models.NotificationSettings{}
+	var lastDigestAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT user_id, email_frequency, last_digest_at, updated_at
+		 FROM notification_settings WHERE user_id = ?`, userID).
+		Scan(&settings.UserID, &settings.EmailFrequency, &lastDigestAt, &settings.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastDigestAt.Valid {
+		t := lastDigestAt.Time
+		settings.LastDigestAt = &t
+	}
+	return settings, nil
+}
+
+func (s *SQLiteDB) UpsertNotificationSettings(ctx context.Context, settings *models.NotificationSettings) error {
+	return s.db.QueryRowContext(ctx,
+		`INSERT INTO notification_settings (user_id, email_frequency)
+		 VALUES (?, ?)
+		 ON CONFLICT(user_id) DO UPDATE SET
+			 email_frequency = excluded.email_frequency,
+			 updated_at = CURRENT_TIMESTAMP
+		 RETURNING updated_at`,
+		settings.UserID, settings.EmailFrequency).
+		Scan(&settings.UpdatedAt)
+}
+
+func (s *SQLiteDB) ListDigestRecipients(ctx context.Context, frequency string, sentBefore time.Time) ([]models.NotificationSettings, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT user_id, email_frequency, last_digest_at, updated_at
+		 FROM notification_settings
+		 WHERE email_frequency = ? AND (last_digest_at IS NULL OR last_digest_at < ?)
+		 ORDER BY user_id`, frequency, sentBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var recipients []models.NotificationSettings
+	for rows.Next() {
+		var settings models.NotificationSettings
+		var lastDigestAt sql.NullTime
+		if err := rows.Scan(&settings.UserID, &settings.EmailFrequency, &lastDigestAt, &settings.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if lastDigestAt.Valid {
+			t := lastDigestAt.Time
+			settings.LastDigestAt = &t
 		}
-		notifications = append(notifications, n)
+		recipients = append(recipients, settings)
 	}
-	return notifications, rows.Err()
+	return recipients, rows.Err()
 }
 
-func (s *SQLiteDB) CountUnreadNotifications(ctx context.Context, userID int64) (int, error) {
-	var count int
-	if err := s.db.QueryRowContext(ctx,
-		`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL`,
-		userID).Scan(&count); err != nil {
-		return 0, err
+func (s *SQLiteDB) SetNotificationDigestSent(ctx context.Context, userID int64, sentAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE notification_settings SET last_digest_at = ? WHERE user_id = ?`,
+		sentAt, userID)
+	return err
+}
+
+func (s *SQLiteDB) ListUnemailedNotifications(ctx context.Context, userID int64, limit int) ([]models.Notification, error) {
+	if limit <= 0 {
+		limit = 100
 	}
-	return count, nil
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT n.id, n.user_id, n.actor_id, a.username, n.type, n.title, n.body, n.resource_path, n.repo_id, n.pr_id, n.issue_id, n.reason, n.read_at, n.created_at
+		 FROM notifications n
+		 JOIN users a ON a.id = n.actor_id
+		 WHERE n.user_id = ? AND n.read_at IS NULL AND n.emailed_at IS NULL
+		 ORDER BY n.created_at ASC, n.id ASC
+		 LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanNotificationRows(rows)
 }
 
-func (s *SQLiteDB) MarkNotificationRead(ctx context.Context, id, userID int64) error {
+func (s *SQLiteDB) MarkNotificationsEmailed(ctx context.Context, userID int64, ids []int64, emailedAt time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := []any{emailedAt, userID}
+	placeholders := make([]string, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+		placeholders = append(placeholders, "?")
+	}
 	_, err := s.db.ExecContext(ctx,
-		`UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ? AND read_at IS NULL`,
-		id, userID)
+		`UPDATE notifications SET emailed_at = ?
+		 WHERE user_id = ? AND emailed_at IS NULL AND id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
 	return err
 }
 
-func (s *SQLiteDB) MarkAllNotificationsRead(ctx context.Context, userID int64) error {
-	_, err := s.db.ExecContext(ctx,
-		`UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = ? AND read_at IS NULL`,
-		userID)
-	return err
+func (s *SQLiteDB) CountPRsAwaitingReview(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*)
+		 FROM thread_subscriptions ts
+		 JOIN pull_requests pr ON pr.id = ts.thread_id
+		 WHERE ts.user_id = ? AND ts.thread_type = ? AND ts.reason = ? AND pr.state = 'open'
+			 AND NOT EXISTS (
+				 SELECT 1 FROM pr_reviews r
+				 WHERE r.pr_id = pr.id AND r.author_id = ts.user_id AND r.created_at >= ts.updated_at
+			 )`,
+		userID, models.ThreadTypePullRequest, models.SubscriptionReasonReviewRequested).Scan(&count)
+	return count, err
+}
+
+func (s *SQLiteDB) CountPRsWithFailingChecks(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*)
+		 FROM pull_requests pr
+		 WHERE pr.author_id = ? AND pr.state = 'open'
+			 AND EXISTS (
+				 SELECT 1 FROM pr_check_runs c
+				 WHERE c.pr_id = pr.id AND c.status = 'completed' AND c.conclusion IN ('failure', 'timed_out', 'action_required')
+			 )`,
+		userID).Scan(&count)
+	return count, err
 }
 
 // --- Branch Protection ---
@@ -2122,6 +3993,108 @@ func (s *SQLiteDB) TouchRepoRunnerTokenUsed(ctx context.Context, tokenID int64,
 	return err
 }
 
+func (s *SQLiteDB) CreateRepoDeployKey(ctx context.Context, key *models.RepoDeployKey) error {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO repo_deploy_keys (
+			repo_id, name, kind, read_only, fingerprint, public_key, key_type, token_hash, token_prefix, created_by_user_id, expires_at, revoked_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.RepoID, key.Name, key.Kind, key.ReadOnly, key.Fingerprint, key.PublicKey, key.KeyType, key.TokenHash, key.TokenPrefix,
+		key.CreatedByUserID, key.ExpiresAt, key.RevokedAt)
+	if err != nil {
+		return err
+	}
+	key.ID, _ = res.LastInsertId()
+	return s.db.QueryRowContext(ctx,
+		`SELECT created_at, last_used_at FROM repo_deploy_keys WHERE id = ?`,
+		key.ID,
+	).Scan(&key.CreatedAt, &key.LastUsedAt)
+}
+
+const repoDeployKeyColumns = `id, repo_id, name, kind, read_only, fingerprint, public_key, key_type, token_hash, token_prefix,
+		created_by_user_id, created_at, last_used_at, expires_at, revoked_at`
+
+func (s *SQLiteDB) ListRepoDeployKeys(ctx context.Context, repoID int64) ([]models.RepoDeployKey, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+repoDeployKeyColumns+`
+		 FROM repo_deploy_keys
+		 WHERE repo_id = ?
+		 ORDER BY created_at DESC, id DESC`,
+		repoID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]models.RepoDeployKey, 0)
+	for rows.Next() {
+		key, err := scanRepoDeployKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *SQLiteDB) DeleteRepoDeployKey(ctx context.Context, repoID, keyID int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE repo_deploy_keys
+		 SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+		 WHERE repo_id = ? AND id = ?`,
+		repoID, keyID,
+	)
+	return err
+}
+
+func (s *SQLiteDB) GetRepoDeployKeyByID(ctx context.Context, keyID int64) (*models.RepoDeployKey, error) {
+	return scanRepoDeployKey(s.db.QueryRowContext(ctx,
+		`SELECT `+repoDeployKeyColumns+` FROM repo_deploy_keys WHERE id = ?`,
+		keyID,
+	))
+}
+
+func (s *SQLiteDB) GetRepoDeployKeyByTokenHash(ctx context.Context, tokenHash string) (*models.RepoDeployKey, error) {
+	return scanRepoDeployKey(s.db.QueryRowContext(ctx,
+		`SELECT `+repoDeployKeyColumns+`
+		 FROM repo_deploy_keys
+		 WHERE kind = 'token' AND token_hash = ?`,
+		tokenHash,
+	))
+}
+
+func (s *SQLiteDB) GetRepoDeployKeyByFingerprint(ctx context.Context, fingerprint string) (*models.RepoDeployKey, error) {
+	return scanRepoDeployKey(s.db.QueryRowContext(ctx,
+		`SELECT `+repoDeployKeyColumns+`
+		 FROM repo_deploy_keys
+		 WHERE kind = 'ssh' AND fingerprint = ? AND revoked_at IS NULL
+		 ORDER BY id DESC
+		 LIMIT 1`,
+		fingerprint,
+	))
+}
+
+// scanRepoDeployKey scans a row selected with the deploy key column list
+// shared by both backends.
+func scanRepoDeployKey(row interface{ Scan(...any) error }) (*models.RepoDeployKey, error) {
+	key := &models.RepoDeployKey{}
+	if err := row.Scan(
+		&key.ID, &key.RepoID, &key.Name, &key.Kind, &key.ReadOnly, &key.Fingerprint, &key.PublicKey, &key.KeyType,
+		&key.TokenHash, &key.TokenPrefix, &key.CreatedByUserID, &key.CreatedAt, &key.LastUsedAt, &key.ExpiresAt, &key.RevokedAt,
+	); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *SQLiteDB) TouchRepoDeployKeyUsed(ctx context.Context, keyID int64, usedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE repo_deploy_keys SET last_used_at = ? WHERE id = ?`,
+		usedAt, keyID,
+	)
+	return err
+}
+
 // --- Webhooks ---
 
 func (s *SQLiteDB) CreateWebhook(ctx context.Context, hook *models.Webhook) error {
@@ -2140,14 +4113,16 @@ func (s *SQLiteDB) CreateWebhook(ctx context.Context, hook *models.Webhook) erro
 
 func (s *SQLiteDB) GetWebhook(ctx context.Context, repoID, webhookID int64) (*models.Webhook, error) {
 	hook := &models.Webhook{}
+	var failingSince, disabledAt, previousSecretExpiresAt sql.NullTime
 	err := s.db.QueryRowContext(ctx,
-		`SELECT id, repo_id, url, secret, events_csv, active, created_at, updated_at
+		`SELECT id, repo_id, url, secret, events_csv, active, failing_since, disabled_at, disabled_reason, previous_secret, previous_secret_expires_at, timestamped_signature, created_at, updated_at
 		 FROM repo_webhooks
 		 WHERE repo_id = ? AND id = ?`, repoID, webhookID).
-		Scan(&hook.ID, &hook.RepoID, &hook.URL, &hook.Secret, &hook.EventsCSV, &hook.Active, &hook.CreatedAt, &hook.UpdatedAt)
+		Scan(&hook.ID, &hook.RepoID, &hook.URL, &hook.Secret, &hook.EventsCSV, &hook.Active, &failingSince, &disabledAt, &hook.DisabledReason, &hook.PreviousSecret, &previousSecretExpiresAt, &hook.TimestampedSignature, &hook.CreatedAt, &hook.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
+	setWebhookTimes(hook, failingSince, disabledAt, previousSecretExpiresAt)
 	return hook, nil
 }
 
@@ -2163,7 +4138,7 @@ func (s *SQLiteDB) ListWebhooksPage(ctx context.Context, repoID int64, limit, of
 		offset = 0
 	}
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, repo_id, url, secret, events_csv, active, created_at, updated_at
+		`SELECT id, repo_id, url, secret, events_csv, active, failing_since, disabled_at, disabled_reason, previous_secret, previous_secret_expires_at, timestamped_signature, created_at, updated_at
 		 FROM repo_webhooks
 		 WHERE repo_id = ?
 		 ORDER BY id DESC
@@ -2175,20 +4150,83 @@ func (s *SQLiteDB) ListWebhooksPage(ctx context.Context, repoID int64, limit, of
 	var hooks []models.Webhook
 	for rows.Next() {
 		var hook models.Webhook
-		if err := rows.Scan(&hook.ID, &hook.RepoID, &hook.URL, &hook.Secret, &hook.EventsCSV, &hook.Active, &hook.CreatedAt, &hook.UpdatedAt); err != nil {
+		var failingSince, disabledAt, previousSecretExpiresAt sql.NullTime
+		if err := rows.Scan(&hook.ID, &hook.RepoID, &hook.URL, &hook.Secret, &hook.EventsCSV, &hook.Active, &failingSince, &disabledAt, &hook.DisabledReason, &hook.PreviousSecret, &previousSecretExpiresAt, &hook.TimestampedSignature, &hook.CreatedAt, &hook.UpdatedAt); err != nil {
 			return nil, err
 		}
+		setWebhookTimes(&hook, failingSince, disabledAt, previousSecretExpiresAt)
 		hooks = append(hooks, hook)
 	}
 	return hooks, rows.Err()
 }
 
+// UpdateWebhook saves the hook's mutable settings, including its delivery
+// failure and disable state.
+func (s *SQLiteDB) UpdateWebhook(ctx context.Context, hook *models.Webhook) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE repo_webhooks
+		 SET url = ?, secret = ?, previous_secret = ?, previous_secret_expires_at = ?, events_csv = ?, active = ?, timestamped_signature = ?,
+		     failing_since = ?, disabled_at = ?, disabled_reason = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE repo_id = ? AND id = ?`,
+		hook.URL, hook.Secret, hook.PreviousSecret, hook.PreviousSecretExpiresAt, hook.EventsCSV, hook.Active, hook.TimestampedSignature,
+		hook.FailingSince, hook.DisabledAt, hook.DisabledReason, hook.RepoID, hook.ID)
+	if err != nil {
+		return err
+	}
+	return s.db.QueryRowContext(ctx,
+		`SELECT updated_at FROM repo_webhooks WHERE repo_id = ? AND id = ?`, hook.RepoID, hook.ID).Scan(&hook.UpdatedAt)
+}
+
 func (s *SQLiteDB) DeleteWebhook(ctx context.Context, repoID, webhookID int64) error {
 	_, err := s.db.ExecContext(ctx,
 		`DELETE FROM repo_webhooks WHERE repo_id = ? AND id = ?`, repoID, webhookID)
 	return err
 }
 
+// RecordWebhookFailure marks the hook as failing, keeping the time of the
+// first failure, and returns that time.
+func (s *SQLiteDB) RecordWebhookFailure(ctx context.Context, repoID, webhookID int64) (time.Time, error) {
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE repo_webhooks SET failing_since = COALESCE(failing_since, CURRENT_TIMESTAMP)
+		 WHERE repo_id = ? AND id = ?`, repoID, webhookID); err != nil {
+		return time.Time{}, err
+	}
+	var since time.Time
+	err := s.db.QueryRowContext(ctx,
+		`SELECT failing_since FROM repo_webhooks WHERE repo_id = ? AND id = ?`, repoID, webhookID).Scan(&since)
+	return since, err
+}
+
+func (s *SQLiteDB) ClearWebhookFailure(ctx context.Context, repoID, webhookID int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE repo_webhooks SET failing_since = NULL
+		 WHERE repo_id = ? AND id = ? AND failing_since IS NOT NULL`, repoID, webhookID)
+	return err
+}
+
+func (s *SQLiteDB) DisableWebhook(ctx context.Context, repoID, webhookID int64, reason string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE repo_webhooks
+		 SET active = FALSE, disabled_at = CURRENT_TIMESTAMP, disabled_reason = ?, failing_since = NULL, updated_at = CURRENT_TIMESTAMP
+		 WHERE repo_id = ? AND id = ?`, reason, repoID, webhookID)
+	return err
+}
+
+func setWebhookTimes(hook *models.Webhook, failingSince, disabledAt, previousSecretExpiresAt sql.NullTime) {
+	if failingSince.Valid {
+		t := failingSince.Time
+		hook.FailingSince = &t
+	}
+	if disabledAt.Valid {
+		t := disabledAt.Time
+		hook.DisabledAt = &t
+	}
+	if previousSecretExpiresAt.Valid {
+		t := previousSecretExpiresAt.Time
+		hook.PreviousSecretExpiresAt = &t
+	}
+}
+
 func (s *SQLiteDB) CreateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
 	res, err := s.db.ExecContext(ctx,
 		`INSERT INTO webhook_deliveries (
@@ -2253,6 +4291,177 @@ func (s *SQLiteDB) ListWebhookDeliveriesPage(ctx context.Context, repoID, webhoo
 	return deliveries, rows.Err()
 }
 
+func (s *SQLiteDB) CreateOrgWebhook(ctx context.Context, hook *models.Webhook) error {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO org_webhooks (org_id, url, secret, events_csv, active)
+		 VALUES (?, ?, ?, ?, ?)`,
+		hook.OrgID, hook.URL, hook.Secret, hook.EventsCSV, hook.Active)
+	if err != nil {
+		return err
+	}
+	hook.ID, _ = res.LastInsertId()
+	return s.db.QueryRowContext(ctx,
+		`SELECT created_at, updated_at FROM org_webhooks WHERE id = ?`, hook.ID).
+		Scan(&hook.CreatedAt, &hook.UpdatedAt)
+}
+
+func (s *SQLiteDB) GetOrgWebhook(ctx context.Context, orgID, webhookID int64) (*models.Webhook, error) {
+	hook := &models.Webhook{}
+	var failingSince, disabledAt, previousSecretExpiresAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, org_id, url, secret, events_csv, active, failing_since, disabled_at, disabled_reason, previous_secret, previous_secret_expires_at, timestamped_signature, created_at, updated_at
+		 FROM org_webhooks
+		 WHERE org_id = ? AND id = ?`, orgID, webhookID).
+		Scan(&hook.ID, &hook.OrgID, &hook.URL, &hook.Secret, &hook.EventsCSV, &hook.Active, &failingSince, &disabledAt, &hook.DisabledReason, &hook.PreviousSecret, &previousSecretExpiresAt, &hook.TimestampedSignature, &hook.CreatedAt, &hook.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	setWebhookTimes(hook, failingSince, disabledAt, previousSecretExpiresAt)
+	return hook, nil
+}
+
+func (s *SQLiteDB) ListOrgWebhooks(ctx context.Context, orgID int64) ([]models.Webhook, error) {
+	return s.ListOrgWebhooksPage(ctx, orgID, 1<<30, 0)
+}
+
+func (s *SQLiteDB) ListOrgWebhooksPage(ctx context.Context, orgID int64, limit, offset int) ([]models.Webhook, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, org_id, url, secret, events_csv, active, failing_since, disabled_at, disabled_reason, previous_secret, previous_secret_expires_at, timestamped_signature, created_at, updated_at
+		 FROM org_webhooks
+		 WHERE org_id = ?
+		 ORDER BY id DESC
+		 LIMIT ? OFFSET ?`, orgID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var hooks []models.Webhook
+	for rows.Next() {
+		var hook models.Webhook
+		var failingSince, disabledAt, previousSecretExpiresAt sql.NullTime
+		if err := rows.Scan(&hook.ID, &hook.OrgID, &hook.URL, &hook.Secret, &hook.EventsCSV, &hook.Active, &failingSince, &disabledAt, &hook.DisabledReason, &hook.PreviousSecret, &previousSecretExpiresAt, &hook.TimestampedSignature, &hook.CreatedAt, &hook.UpdatedAt); err != nil {
+			return nil, err
+		}
+		setWebhookTimes(&hook, failingSince, disabledAt, previousSecretExpiresAt)
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+func (s *SQLiteDB) UpdateOrgWebhook(ctx context.Context, hook *models.Webhook) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE org_webhooks
+		 SET url = ?, secret = ?, previous_secret = ?, previous_secret_expires_at = ?, events_csv = ?, active = ?, timestamped_signature = ?,
+		     failing_since = ?, disabled_at = ?, disabled_reason = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE org_id = ? AND id = ?`,
+		hook.URL, hook.Secret, hook.PreviousSecret, hook.PreviousSecretExpiresAt, hook.EventsCSV, hook.Active, hook.TimestampedSignature,
+		hook.FailingSince, hook.DisabledAt, hook.DisabledReason, hook.OrgID, hook.ID)
+	if err != nil {
+		return err
+	}
+	return s.db.QueryRowContext(ctx,
+		`SELECT updated_at FROM org_webhooks WHERE org_id = ? AND id = ?`, hook.OrgID, hook.ID).Scan(&hook.UpdatedAt)
+}
+
+func (s *SQLiteDB) DeleteOrgWebhook(ctx context.Context, orgID, webhookID int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM org_webhooks WHERE org_id = ? AND id = ?`, orgID, webhookID)
+	return err
+}
+
+func (s *SQLiteDB) RecordOrgWebhookFailure(ctx context.Context, orgID, webhookID int64) (time.Time, error) {
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE org_webhooks SET failing_since = COALESCE(failing_since, CURRENT_TIMESTAMP)
+		 WHERE org_id = ? AND id = ?`, orgID, webhookID); err != nil {
+		return time.Time{}, err
+	}
+	var since time.Time
+	err := s.db.QueryRowContext(ctx,
+		`SELECT failing_since FROM org_webhooks WHERE org_id = ? AND id = ?`, orgID, webhookID).Scan(&since)
+	return since, err
+}
+
+func (s *SQLiteDB) ClearOrgWebhookFailure(ctx context.Context, orgID, webhookID int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE org_webhooks SET failing_since = NULL
+		 WHERE org_id = ? AND id = ? AND failing_since IS NOT NULL`, orgID, webhookID)
+	return err
+}
+
+func (s *SQLiteDB) DisableOrgWebhook(ctx context.Context, orgID, webhookID int64, reason string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE org_webhooks
+		 SET active = FALSE, disabled_at = CURRENT_TIMESTAMP, disabled_reason = ?, failing_since = NULL, updated_at = CURRENT_TIMESTAMP
+		 WHERE org_id = ? AND id = ?`, reason, orgID, webhookID)
+	return err
+}
+
+func (s *SQLiteDB) CreateOrgWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO org_webhook_deliveries (
+			 org_id, webhook_id, repo_id, event, delivery_uid, attempt, status_code, success, error, request_body, response_body, duration_ms, redelivery_of_id
+		 ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		delivery.OrgID, delivery.WebhookID, delivery.RepoID, delivery.Event, delivery.DeliveryUID, delivery.Attempt, delivery.StatusCode,
+		delivery.Success, delivery.Error, delivery.RequestBody, delivery.ResponseBody, delivery.DurationMS, delivery.RedeliveryOfID)
+	if err != nil {
+		return err
+	}
+	delivery.ID, _ = res.LastInsertId()
+	return s.db.QueryRowContext(ctx,
+		`SELECT created_at FROM org_webhook_deliveries WHERE id = ?`, delivery.ID).
+		Scan(&delivery.CreatedAt)
+}
+
+func (s *SQLiteDB) GetOrgWebhookDelivery(ctx context.Context, orgID, webhookID, deliveryID int64) (*models.WebhookDelivery, error) {
+	d := &models.WebhookDelivery{}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, org_id, webhook_id, repo_id, event, delivery_uid, attempt, status_code, success, error, request_body, response_body, duration_ms, redelivery_of_id, created_at
+		 FROM org_webhook_deliveries
+		 WHERE org_id = ? AND webhook_id = ? AND id = ?`,
+		orgID, webhookID, deliveryID).
+		Scan(&d.ID, &d.OrgID, &d.WebhookID, &d.RepoID, &d.Event, &d.DeliveryUID, &d.Attempt, &d.StatusCode, &d.Success, &d.Error,
+			&d.RequestBody, &d.ResponseBody, &d.DurationMS, &d.RedeliveryOfID, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *SQLiteDB) ListOrgWebhookDeliveriesPage(ctx context.Context, orgID, webhookID int64, limit, offset int) ([]models.WebhookDelivery, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, org_id, webhook_id, repo_id, event, delivery_uid, attempt, status_code, success, error, request_body, response_body, duration_ms, redelivery_of_id, created_at
+		 FROM org_webhook_deliveries
+		 WHERE org_id = ? AND webhook_id = ?
+		 ORDER BY id DESC
+		 LIMIT ? OFFSET ?`, orgID, webhookID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.OrgID, &d.WebhookID, &d.RepoID, &d.Event, &d.DeliveryUID, &d.Attempt, &d.StatusCode, &d.Success, &d.Error,
+			&d.RequestBody, &d.ResponseBody, &d.DurationMS, &d.RedeliveryOfID, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
 func (s *SQLiteDB) CreateInterestSignup(ctx context.Context, signup *models.InterestSignup) error {
 	res, err := s.db.ExecContext(ctx,
 		`INSERT INTO interest_signups (email, name, company, message, source) VALUES (?, ?, ?, ?, ?)`,
@@ -2425,18 +4634,72 @@ func (s *SQLiteDB) GetMergeBaseCache(ctx context.Context, repoID int64, leftHash
 	if leftHash == "" || rightHash == "" {
 		return "", false, nil
 	}
-	var baseHash string
-	err := s.db.QueryRowContext(ctx,
-		`SELECT base_hash FROM merge_base_cache WHERE repo_id = ? AND left_hash = ? AND right_hash = ?`,
-		repoID, leftHash, rightHash,
-	).Scan(&baseHash)
-	if err == sql.ErrNoRows {
-		return "", false, nil
+	var baseHash string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT base_hash FROM merge_base_cache WHERE repo_id = ? AND left_hash = ? AND right_hash = ?`,
+		repoID, leftHash, rightHash,
+	).Scan(&baseHash)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return baseHash, true, nil
+}
+
+func (s *SQLiteDB) UpsertCommitVerification(ctx context.Context, v *models.CommitVerification) error {
+	return s.db.QueryRowContext(ctx,
+		`INSERT INTO commit_verifications (repo_id, commit_hash, status, signature_type, key_id, fingerprint, signer_user_id, signed_by_server)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(repo_id, commit_hash) DO UPDATE SET
+			 status = excluded.status,
+			 signature_type = excluded.signature_type,
+			 key_id = excluded.key_id,
+			 fingerprint = excluded.fingerprint,
+			 signer_user_id = excluded.signer_user_id,
+			 signed_by_server = excluded.signed_by_server,
+			 verified_at = CURRENT_TIMESTAMP
+		 RETURNING verified_at`,
+		v.RepoID, v.CommitHash, v.Status, v.SignatureType, v.KeyID, v.Fingerprint, v.SignerUserID, v.SignedByServer,
+	).Scan(&v.VerifiedAt)
+}
+
+func (s *SQLiteDB) GetCommitVerification(ctx context.Context, repoID int64, commitHash string) (*models.CommitVerification, error) {
+	v := &models.CommitVerification{}
+	var signerID sql.NullInt64
+	var signerName sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		`SELECT cv.repo_id, cv.commit_hash, cv.status, cv.signature_type, cv.key_id, cv.fingerprint, cv.signer_user_id, u.username, cv.signed_by_server, cv.verified_at
+		 FROM commit_verifications cv
+		 LEFT JOIN users u ON u.id = cv.signer_user_id
+		 WHERE cv.repo_id = ? AND cv.commit_hash = ?`, repoID, commitHash).
+		Scan(&v.RepoID, &v.CommitHash, &v.Status, &v.SignatureType, &v.KeyID, &v.Fingerprint, &signerID, &signerName, &v.SignedByServer, &v.VerifiedAt)
+	if err != nil {
+		return nil, err
+	}
+	if signerID.Valid {
+		v.SignerUserID = &signerID.Int64
+		v.SignerName = signerName.String
+	}
+	return v, nil
+}
+
+// DeleteCommitVerificationsByKeyIDs drops cached verifications made with, or
+// waiting on, any of the given key IDs so they are re-checked after a key is
+// added or removed.
+func (s *SQLiteDB) DeleteCommitVerificationsByKeyIDs(ctx context.Context, keyIDs []string) error {
+	if len(keyIDs) == 0 {
+		return nil
 	}
-	if err != nil {
-		return "", false, err
+	args := make([]any, 0, len(keyIDs))
+	placeholders := make([]string, 0, len(keyIDs))
+	for _, id := range keyIDs {
+		args = append(args, id)
+		placeholders = append(placeholders, "?")
 	}
-	return baseHash, true, nil
+	_, err := s.db.ExecContext(ctx, `DELETE FROM commit_verifications WHERE key_id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	return err
 }
 
 func (s *SQLiteDB) EnqueueIndexingJob(ctx context.Context, job *models.IndexingJob) error {
@@ -2463,8 +4726,8 @@ func (s *SQLiteDB) EnqueueIndexingJob(ctx context.Context, job *models.IndexingJ
 
 	_, err := s.db.ExecContext(ctx,
 		`INSERT INTO indexing_jobs (
-			 repo_id, commit_hash, job_type, status, attempt_count, max_attempts, last_error, next_attempt_at
-		 ) VALUES (?, ?, ?, ?, 0, ?, '', datetime(?))
+			 repo_id, commit_hash, job_type, concurrency_key, payload, status, attempt_count, max_attempts, last_error, next_attempt_at
+		 ) VALUES (?, ?, ?, ?, ?, ?, 0, ?, '', datetime(?))
 		 ON CONFLICT(repo_id, commit_hash, job_type) DO UPDATE SET
 			 status = CASE
 				WHEN indexing_jobs.status = ? THEN indexing_jobs.status
@@ -2486,7 +4749,7 @@ func (s *SQLiteDB) EnqueueIndexingJob(ctx context.Context, job *models.IndexingJ
 				WHEN indexing_jobs.status = ? THEN indexing_jobs.updated_at
 				ELSE CURRENT_TIMESTAMP
 			 END`,
-		job.RepoID, job.CommitHash, jobType, status, maxAttempts, nextAttempt,
+		job.RepoID, job.CommitHash, jobType, job.ConcurrencyKey, job.Payload, status, maxAttempts, nextAttempt,
 		models.IndexJobCompleted, models.IndexJobQueued,
 		models.IndexJobCompleted,
 		models.IndexJobCompleted,
@@ -2508,7 +4771,10 @@ func (s *SQLiteDB) EnqueueIndexingJob(ctx context.Context, job *models.IndexingJ
 	return nil
 }
 
-func (s *SQLiteDB) ClaimIndexingJob(ctx context.Context) (*models.IndexingJob, error) {
+func (s *SQLiteDB) ClaimIndexingJob(ctx context.Context, jobType models.IndexJobType, perKeyLimit int) (*models.IndexingJob, error) {
+	if perKeyLimit <= 0 {
+		perKeyLimit = 1
+	}
 	row := s.db.QueryRowContext(ctx,
 		`UPDATE indexing_jobs
 		 SET status = ?,
@@ -2517,15 +4783,29 @@ func (s *SQLiteDB) ClaimIndexingJob(ctx context.Context) (*models.IndexingJob, e
 			 completed_at = NULL,
 			 updated_at = CURRENT_TIMESTAMP
 		 WHERE id = (
-			 SELECT id
-			 FROM indexing_jobs
-			 WHERE status = ?
-			   AND datetime(next_attempt_at) <= CURRENT_TIMESTAMP
-			 ORDER BY next_attempt_at ASC, id ASC
+			 SELECT j.id
+			 FROM indexing_jobs j
+			 WHERE j.job_type = ?
+			   AND j.status = ?
+			   AND datetime(j.next_attempt_at) <= CURRENT_TIMESTAMP
+			   AND (j.concurrency_key = '' OR (
+				   NOT EXISTS (
+					   SELECT 1 FROM indexing_jobs o
+					   WHERE o.job_type = j.job_type AND o.concurrency_key = j.concurrency_key
+						 AND o.status = ? AND o.id < j.id
+				   )
+				   AND (
+					   SELECT COUNT(*) FROM indexing_jobs r
+					   WHERE r.job_type = j.job_type AND r.concurrency_key = j.concurrency_key
+						 AND r.status = ?
+				   ) < ?
+			   ))
+			 ORDER BY j.next_attempt_at ASC, j.id ASC
 			 LIMIT 1
 		 )
-		 RETURNING id, repo_id, commit_hash, job_type, status, attempt_count, max_attempts, last_error, next_attempt_at, created_at, updated_at, started_at, completed_at`,
-		models.IndexJobInProgress, models.IndexJobQueued,
+		 RETURNING id, repo_id, commit_hash, job_type, concurrency_key, payload, status, attempt_count, max_attempts, last_error, next_attempt_at, created_at, updated_at, started_at, completed_at`,
+		models.IndexJobInProgress, jobType, models.IndexJobQueued,
+		models.IndexJobQueued, models.IndexJobInProgress, perKeyLimit,
 	)
 	job, err := scanSQLiteIndexingJob(row)
 	if err != nil {
@@ -2609,7 +4889,7 @@ func (s *SQLiteDB) RequeueIndexingJob(ctx context.Context, jobID int64, errMsg s
 
 func (s *SQLiteDB) GetIndexingJobStatus(ctx context.Context, repoID int64, commitHash string) (*models.IndexingJob, error) {
 	row := s.db.QueryRowContext(ctx,
-		`SELECT id, repo_id, commit_hash, job_type, status, attempt_count, max_attempts, last_error, next_attempt_at, created_at, updated_at, started_at, completed_at
+		`SELECT id, repo_id, commit_hash, job_type, concurrency_key, payload, status, attempt_count, max_attempts, last_error, next_attempt_at, created_at, updated_at, started_at, completed_at
 		 FROM indexing_jobs
 		 WHERE repo_id = ? AND commit_hash = ?
 		 ORDER BY created_at DESC, id DESC
@@ -2628,7 +4908,7 @@ func (s *SQLiteDB) GetIndexingJobStatus(ctx context.Context, repoID int64, commi
 
 func (s *SQLiteDB) getIndexingJobStatusByType(ctx context.Context, repoID int64, commitHash string, jobType models.IndexJobType) (*models.IndexingJob, error) {
 	row := s.db.QueryRowContext(ctx,
-		`SELECT id, repo_id, commit_hash, job_type, status, attempt_count, max_attempts, last_error, next_attempt_at, created_at, updated_at, started_at, completed_at
+		`SELECT id, repo_id, commit_hash, job_type, concurrency_key, payload, status, attempt_count, max_attempts, last_error, next_attempt_at, created_at, updated_at, started_at, completed_at
 		 FROM indexing_jobs
 		 WHERE repo_id = ? AND commit_hash = ? AND job_type = ?
 		 LIMIT 1`,
@@ -2644,6 +4924,74 @@ func (s *SQLiteDB) getIndexingJobStatusByType(ctx context.Context, repoID int64,
 	return job, nil
 }
 
+// --- Outbound email queue ---
+
+const outboundEmailColumns = `id, recipient, subject, message, status, attempt_count, max_attempts, last_error, next_attempt_at, created_at, sent_at`
+
+func scanOutboundEmail(row interface{ Scan(...any) error }) (*models.OutboundEmail, error) {
+	var email models.OutboundEmail
+	var status string
+	if err := row.Scan(&email.ID, &email.Recipient, &email.Subject, &email.Message, &status,
+		&email.AttemptCount, &email.MaxAttempts, &email.LastError, &email.NextAttemptAt,
+		&email.CreatedAt, &email.SentAt); err != nil {
+		return nil, err
+	}
+	email.Status = models.OutboundEmailStatus(status)
+	return &email, nil
+}
+
+func (s *SQLiteDB) EnqueueOutboundEmail(ctx context.Context, email *models.OutboundEmail) error {
+	if email.Status == "" {
+		email.Status = models.OutboundEmailQueued
+	}
+	if email.NextAttemptAt.IsZero() {
+		email.NextAttemptAt = time.Now().UTC()
+	}
+	return s.db.QueryRowContext(ctx,
+		`INSERT INTO outbound_emails (recipient, subject, message, status, max_attempts, next_attempt_at)
+		 VALUES (?, ?, ?, ?, ?, ?)
+		 RETURNING id, created_at`,
+		email.Recipient, email.Subject, email.Message, email.Status, email.MaxAttempts, email.NextAttemptAt,
+	).Scan(&email.ID, &email.CreatedAt)
+}
+
+func (s *SQLiteDB) ClaimOutboundEmail(ctx context.Context, now, leaseUntil time.Time) (*models.OutboundEmail, error) {
+	row := s.db.QueryRowContext(ctx,
+		`UPDATE outbound_emails
+		 SET status = ?, attempt_count = attempt_count + 1, next_attempt_at = ?
+		 WHERE id = (
+			 SELECT id FROM outbound_emails
+			 WHERE status IN (?, ?) AND next_attempt_at <= ?
+			 ORDER BY next_attempt_at ASC, id ASC
+			 LIMIT 1
+		 )
+		 RETURNING `+outboundEmailColumns,
+		models.OutboundEmailSending, leaseUntil,
+		models.OutboundEmailQueued, models.OutboundEmailSending, now,
+	)
+	email, err := scanOutboundEmail(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return email, err
+}
+
+func (s *SQLiteDB) CompleteOutboundEmail(ctx context.Context, id int64, status models.OutboundEmailStatus, errMsg string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE outbound_emails
+		 SET status = ?, last_error = ?, message = '', sent_at = CASE WHEN ? = 'sent' THEN CURRENT_TIMESTAMP ELSE sent_at END
+		 WHERE id = ?`,
+		status, errMsg, status, id)
+	return err
+}
+
+func (s *SQLiteDB) RequeueOutboundEmail(ctx context.Context, id int64, errMsg string, nextAttemptAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE outbound_emails SET status = ?, last_error = ?, next_attempt_at = ? WHERE id = ?`,
+		models.OutboundEmailQueued, errMsg, nextAttemptAt, id)
+	return err
+}
+
 func scanSQLiteIndexingJob(row *sql.Row) (*models.IndexingJob, error) {
 	var job models.IndexingJob
 	var jobType string
@@ -2655,6 +5003,8 @@ func scanSQLiteIndexingJob(row *sql.Row) (*models.IndexingJob, error) {
 		&job.RepoID,
 		&job.CommitHash,
 		&jobType,
+		&job.ConcurrencyKey,
+		&job.Payload,
 		&status,
 		&job.AttemptCount,
 		&job.MaxAttempts,
@@ -2769,6 +5119,19 @@ func (s *SQLiteDB) UpsertEntityIdentity(ctx context.Context, identity *models.En
 	return err
 }
 
+func (s *SQLiteDB) GetEntityIdentity(ctx context.Context, repoID int64, stableID string) (*models.EntityIdentity, error) {
+	identity := &models.EntityIdentity{}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT repo_id, stable_id, name, decl_kind, receiver, first_seen_commit, last_seen_commit, created_at, updated_at
+		 FROM entity_identities
+		 WHERE repo_id = ? AND stable_id = ?`, repoID, stableID).
+		Scan(&identity.RepoID, &identity.StableID, &identity.Name, &identity.DeclKind, &identity.Receiver, &identity.FirstSeenCommit, &identity.LastSeenCommit, &identity.CreatedAt, &identity.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
 func (s *SQLiteDB) SetEntityVersion(ctx context.Context, version *models.EntityVersion) error {
 	_, err := s.db.ExecContext(ctx,
 		`INSERT INTO entity_versions
@@ -3451,9 +5814,12 @@ func (s *SQLiteDB) ListXRefEdgesTo(ctx context.Context, repoID int64, commitHash
 // --- Organizations ---
 
 func (s *SQLiteDB) CreateOrg(ctx context.Context, o *models.Org) error {
+	if o.DefaultRepoPermission == "" {
+		o.DefaultRepoPermission = "write"
+	}
 	res, err := s.db.ExecContext(ctx,
-		`INSERT INTO orgs (name, display_name) VALUES (?, ?)`,
-		o.Name, o.DisplayName)
+		`INSERT INTO orgs (name, display_name, default_repo_permission) VALUES (?, ?, ?)`,
+		o.Name, o.DisplayName, o.DefaultRepoPermission)
 	if err != nil {
 		return err
 	}
@@ -3464,8 +5830,8 @@ func (s *SQLiteDB) CreateOrg(ctx context.Context, o *models.Org) error {
 func (s *SQLiteDB) GetOrg(ctx context.Context, name string) (*models.Org, error) {
 	o := &models.Org{}
 	err := s.db.QueryRowContext(ctx,
-		`SELECT id, name, display_name FROM orgs WHERE name = ?`, name).
-		Scan(&o.ID, &o.Name, &o.DisplayName)
+		`SELECT id, name, display_name, require_two_factor, default_repo_permission FROM orgs WHERE name = ?`, name).
+		Scan(&o.ID, &o.Name, &o.DisplayName, &o.RequireTwoFactor, &o.DefaultRepoPermission)
 	if err != nil {
 		return nil, err
 	}
@@ -3475,8 +5841,8 @@ func (s *SQLiteDB) GetOrg(ctx context.Context, name string) (*models.Org, error)
 func (s *SQLiteDB) GetOrgByID(ctx context.Context, id int64) (*models.Org, error) {
 	o := &models.Org{}
 	err := s.db.QueryRowContext(ctx,
-		`SELECT id, name, display_name FROM orgs WHERE id = ?`, id).
-		Scan(&o.ID, &o.Name, &o.DisplayName)
+		`SELECT id, name, display_name, require_two_factor, default_repo_permission FROM orgs WHERE id = ?`, id).
+		Scan(&o.ID, &o.Name, &o.DisplayName, &o.RequireTwoFactor, &o.DefaultRepoPermission)
 	if err != nil {
 		return nil, err
 	}
@@ -3495,7 +5861,7 @@ func (s *SQLiteDB) ListUserOrgsPage(ctx context.Context, userID int64, limit, of
 		offset = 0
 	}
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT o.id, o.name, o.display_name FROM orgs o
+		`SELECT o.id, o.name, o.display_name, o.require_two_factor, default_repo_permission FROM orgs o
 		 JOIN org_members om ON om.org_id = o.id
 		 WHERE om.user_id = ?
 		 ORDER BY o.name ASC
@@ -3507,7 +5873,7 @@ func (s *SQLiteDB) ListUserOrgsPage(ctx context.Context, userID int64, limit, of
 	var orgs []models.Org
 	for rows.Next() {
 		var o models.Org
-		if err := rows.Scan(&o.ID, &o.Name, &o.DisplayName); err != nil {
+		if err := rows.Scan(&o.ID, &o.Name, &o.DisplayName, &o.RequireTwoFactor, &o.DefaultRepoPermission); err != nil {
 			return nil, err
 		}
 		orgs = append(orgs, o)
@@ -3520,6 +5886,16 @@ func (s *SQLiteDB) DeleteOrg(ctx context.Context, id int64) error {
 	return err
 }
 
+func (s *SQLiteDB) SetOrgRequireTwoFactor(ctx context.Context, orgID int64, require bool) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE orgs SET require_two_factor = ? WHERE id = ?`, require, orgID)
+	return err
+}
+
+func (s *SQLiteDB) SetOrgDefaultRepoPermission(ctx context.Context, orgID int64, permission string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE orgs SET default_repo_permission = ? WHERE id = ?`, permission, orgID)
+	return err
+}
+
 func (s *SQLiteDB) AddOrgMember(ctx context.Context, m *models.OrgMember) error {
 	_, err := s.db.ExecContext(ctx,
 		`INSERT OR REPLACE INTO org_members (org_id, user_id, role) VALUES (?, ?, ?)`,
@@ -3567,8 +5943,19 @@ func (s *SQLiteDB) ListOrgMembersPage(ctx context.Context, orgID int64, limit, o
 }
 
 func (s *SQLiteDB) RemoveOrgMember(ctx context.Context, orgID, userID int64) error {
-	_, err := s.db.ExecContext(ctx, `DELETE FROM org_members WHERE org_id = ? AND user_id = ?`, orgID, userID)
-	return err
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM team_members WHERE user_id = ? AND team_id IN (SELECT id FROM teams WHERE org_id = ?)`, userID, orgID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM org_members WHERE org_id = ? AND user_id = ?`, orgID, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (s *SQLiteDB) ListOrgRepositories(ctx context.Context, orgID int64) ([]models.Repository, error) {
@@ -3604,5 +5991,381 @@ func (s *SQLiteDB) ListOrgRepositoriesPage(ctx context.Context, orgID int64, lim
 	return repos, rows.Err()
 }
 
+// --- Teams ---
+
+const teamColumns = `id, org_id, parent_id, name, description, created_at`
+
+func scanTeam(row interface{ Scan(...any) error }) (*models.Team, error) {
+	t := &models.Team{}
+	var parentID sql.NullInt64
+	if err := row.Scan(&t.ID, &t.OrgID, &parentID, &t.Name, &t.Description, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		t.ParentID = &parentID.Int64
+	}
+	return t, nil
+}
+
+// userTeamAncestorsCTE selects into user_teams the teams a user is in,
+// directly or as a member of a descendant team.
+const userTeamAncestorsCTE = `WITH RECURSIVE user_teams(id) AS (
+	SELECT team_id FROM team_members WHERE user_id = %s
+	UNION
+	SELECT t.parent_id FROM teams t JOIN user_teams ut ON t.id = ut.id WHERE t.parent_id IS NOT NULL
+)`
+
+// teamDescendantsCTE selects into sub_teams a team and all of its descendants.
+const teamDescendantsCTE = `WITH RECURSIVE sub_teams(id) AS (
+	SELECT %s
+	UNION
+	SELECT t.id FROM teams t JOIN sub_teams st ON t.parent_id = st.id
+)`
+
+func (s *SQLiteDB) CreateTeam(ctx context.Context, t *models.Team) error {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO teams (org_id, parent_id, name, description, created_at) VALUES (?, ?, ?, ?, ?)`,
+		t.OrgID, t.ParentID, t.Name, t.Description, t.CreatedAt)
+	if err != nil {
+		return err
+	}
+	t.ID, _ = res.LastInsertId()
+	return nil
+}
+
+func (s *SQLiteDB) GetTeam(ctx context.Context, orgID int64, name string) (*models.Team, error) {
+	return scanTeam(s.db.QueryRowContext(ctx,
+		`SELECT `+teamColumns+` FROM teams WHERE org_id = ? AND name = ?`, orgID, name))
+}
+
+func (s *SQLiteDB) GetTeamByID(ctx context.Context, id int64) (*models.Team, error) {
+	return scanTeam(s.db.QueryRowContext(ctx, `SELECT `+teamColumns+` FROM teams WHERE id = ?`, id))
+}
+
+func (s *SQLiteDB) ListTeams(ctx context.Context, orgID int64) ([]models.Team, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+teamColumns+` FROM teams WHERE org_id = ? ORDER BY name`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var teams []models.Team
+	for rows.Next() {
+		t, err := scanTeam(rows)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, *t)
+	}
+	return teams, rows.Err()
+}
+
+func (s *SQLiteDB) UpdateTeam(ctx context.Context, t *models.Team) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE teams SET parent_id = ?, name = ?, description = ? WHERE id = ? AND org_id = ?`,
+		t.ParentID, t.Name, t.Description, t.ID, t.OrgID)
+	return err
+}
+
+func (s *SQLiteDB) DeleteTeam(ctx context.Context, orgID, id int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE teams SET parent_id = (SELECT parent_id FROM teams WHERE id = ? AND org_id = ?) WHERE parent_id = ?`,
+		id, orgID, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM teams WHERE id = ? AND org_id = ?`, id, orgID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteDB) AddTeamMember(ctx context.Context, teamID, userID int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO team_members (team_id, user_id) VALUES (?, ?)`, teamID, userID)
+	return err
+}
+
+func (s *SQLiteDB) RemoveTeamMember(ctx context.Context, teamID, userID int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM team_members WHERE team_id = ? AND user_id = ?`, teamID, userID)
+	return err
+}
+
+func (s *SQLiteDB) ListTeamMembers(ctx context.Context, teamID int64) ([]models.TeamMember, error) {
+	return s.queryTeamMembers(ctx,
+		`SELECT tm.team_id, tm.user_id, u.username FROM team_members tm
+		 JOIN users u ON u.id = tm.user_id
+		 WHERE tm.team_id = ?
+		 ORDER BY u.username`, teamID)
+}
+
+func (s *SQLiteDB) ListNestedTeamMembers(ctx context.Context, teamID int64) ([]models.TeamMember, error) {
+	return s.queryTeamMembers(ctx, fmt.Sprintf(teamDescendantsCTE, "?")+`
+		SELECT ?, u.id, u.username FROM users u
+		WHERE u.id IN (SELECT tm.user_id FROM team_members tm JOIN sub_teams st ON st.id = tm.team_id)
+		ORDER BY u.username`, teamID, teamID)
+}
+
+func (s *SQLiteDB) queryTeamMembers(ctx context.Context, query string, args ...any) ([]models.TeamMember, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var members []models.TeamMember
+	for rows.Next() {
+		var m models.TeamMember
+		if err := rows.Scan(&m.TeamID, &m.UserID, &m.Username); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (s *SQLiteDB) SetTeamRepo(ctx context.Context, tr *models.TeamRepo) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO team_repos (team_id, repo_id, permission) VALUES (?, ?, ?)
+		 ON CONFLICT (team_id, repo_id) DO UPDATE SET permission = excluded.permission`,
+		tr.TeamID, tr.RepoID, tr.Permission)
+	return err
+}
+
+func (s *SQLiteDB) RemoveTeamRepo(ctx context.Context, teamID, repoID int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM team_repos WHERE team_id = ? AND repo_id = ?`, teamID, repoID)
+	return err
+}
+
+func (s *SQLiteDB) ListTeamRepos(ctx context.Context, teamID int64) ([]models.TeamRepo, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT tr.team_id, tr.repo_id, r.name, tr.permission FROM team_repos tr
+		 JOIN repositories r ON r.id = tr.repo_id
+		 WHERE tr.team_id = ?
+		 ORDER BY r.name`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var repos []models.TeamRepo
+	for rows.Next() {
+		var tr models.TeamRepo
+		if err := rows.Scan(&tr.TeamID, &tr.RepoID, &tr.RepoName, &tr.Permission); err != nil {
+			return nil, err
+		}
+		repos = append(repos, tr)
+	}
+	return repos, rows.Err()
+}
+
+func (s *SQLiteDB) ListUserTeamRepoPermissions(ctx context.Context, repoID, userID int64) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(userTeamAncestorsCTE, "?")+`
+		SELECT tr.permission FROM team_repos tr
+		JOIN user_teams ut ON ut.id = tr.team_id
+		JOIN teams t ON t.id = tr.team_id
+		JOIN repositories r ON r.id = tr.repo_id AND r.owner_org_id = t.org_id
+		WHERE tr.repo_id = ?`, userID, repoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var perms []string
+	for rows.Next() {
+		var perm string
+		if err := rows.Scan(&perm); err != nil {
+			return nil, err
+		}
+		perms = append(perms, perm)
+	}
+	return perms, rows.Err()
+}
+
+// --- Invitations ---
+
+const invitationColumns = `i.id, i.repo_id, i.org_id, i.inviter_id, inviter.username, i.invitee_id,
+	COALESCE(invitee.username, ''), i.email, i.role, i.token_hash, i.expires_at, i.created_at`
+
+const invitationFrom = ` FROM invitations i
+	JOIN users inviter ON inviter.id = i.inviter_id
+	LEFT JOIN users invitee ON invitee.id = i.invitee_id`
+
+func scanInvitation(row interface{ Scan(...any) error }) (*models.Invitation, error) {
+	inv := &models.Invitation{}
+	var repoID, orgID, inviteeID sql.NullInt64
+	if err := row.Scan(&inv.ID, &repoID, &orgID, &inv.InviterID, &inv.InviterName, &inviteeID,
+		&inv.InviteeName, &inv.Email, &inv.Role, &inv.TokenHash, &inv.ExpiresAt, &inv.CreatedAt); err != nil {
+		return nil, err
+	}
+	if repoID.Valid {
+		inv.RepoID = &repoID.Int64
+	}
+	if orgID.Valid {
+		inv.OrgID = &orgID.Int64
+	}
+	if inviteeID.Valid {
+		inv.InviteeID = &inviteeID.Int64
+	}
+	return inv, nil
+}
+
+func (s *SQLiteDB) CreateInvitation(ctx context.Context, inv *models.Invitation) error {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO invitations (repo_id, org_id, inviter_id, invitee_id, email, role, token_hash, expires_at, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		inv.RepoID, inv.OrgID, inv.InviterID, inv.InviteeID, inv.Email, inv.Role, inv.TokenHash, inv.ExpiresAt, inv.CreatedAt)
+	if err != nil {
+		return err
+	}
+	inv.ID, _ = res.LastInsertId()
+	return nil
+}
+
+func (s *SQLiteDB) GetInvitation(ctx context.Context, id int64) (*models.Invitation, error) {
+	return scanInvitation(s.db.QueryRowContext(ctx, `SELECT `+invitationColumns+invitationFrom+` WHERE i.id = ?`, id))
+}
+
+func (s *SQLiteDB) GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	if tokenHash == "" {
+		return nil, sql.ErrNoRows
+	}
+	return scanInvitation(s.db.QueryRowContext(ctx,
+		`SELECT `+invitationColumns+invitationFrom+` WHERE i.token_hash = ?`, tokenHash))
+}
+
+func (s *SQLiteDB) ListRepoInvitations(ctx context.Context, repoID int64, now time.Time) ([]models.Invitation, error) {
+	return s.queryInvitations(ctx, `WHERE i.repo_id = ? AND i.expires_at > ?`, repoID, now)
+}
+
+func (s *SQLiteDB) ListOrgInvitations(ctx context.Context, orgID int64, now time.Time) ([]models.Invitation, error) {
+	return s.queryInvitations(ctx, `WHERE i.org_id = ? AND i.expires_at > ?`, orgID, now)
+}
+
+func (s *SQLiteDB) ListUserInvitations(ctx context.Context, userID int64, now time.Time) ([]models.Invitation, error) {
+	return s.queryInvitations(ctx, `WHERE i.invitee_id = ? AND i.expires_at > ?`, userID, now)
+}
+
+func (s *SQLiteDB) queryInvitations(ctx context.Context, where string, args ...any) ([]models.Invitation, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+invitationColumns+invitationFrom+` `+where+` ORDER BY i.created_at DESC, i.id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var invs []models.Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invs = append(invs, *inv)
+	}
+	return invs, rows.Err()
+}
+
+func (s *SQLiteDB) DeleteInvitation(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM invitations WHERE id = ?`, id)
+	return err
+}
+
+// --- Audit log ---
+
+// Audit events have no foreign keys, so they outlive the users, repositories
+// and orgs they name.
+const auditEventColumns = `id, actor_id, actor_name, action, target, repo_id, org_id, ip, request_id,
+	before_json, after_json, created_at`
+
+func scanAuditEvent(row interface{ Scan(...any) error }) (*models.AuditEvent, error) {
+	e := &models.AuditEvent{}
+	var actorID, repoID, orgID sql.NullInt64
+	var before, after string
+	if err := row.Scan(&e.ID, &actorID, &e.ActorName, &e.Action, &e.Target, &repoID, &orgID, &e.IP, &e.RequestID,
+		&before, &after, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	if actorID.Valid {
+		e.ActorID = &actorID.Int64
+	}
+	if repoID.Valid {
+		e.RepoID = &repoID.Int64
+	}
+	if orgID.Valid {
+		e.OrgID = &orgID.Int64
+	}
+	if before != "" {
+		e.Before = json.RawMessage(before)
+	}
+	if after != "" {
+		e.After = json.RawMessage(after)
+	}
+	return e, nil
+}
+
+// auditEventWhere builds the WHERE clause for filter, numbering placeholders
+// with placeholder.
+func auditEventWhere(filter AuditEventFilter, placeholder func(int) string) (string, []any) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, cond+" "+placeholder(len(args)))
+	}
+	if filter.RepoID != nil {
+		add("repo_id =", *filter.RepoID)
+	}
+	if filter.OrgID != nil {
+		add("org_id =", *filter.OrgID)
+	}
+	if filter.BeforeID > 0 {
+		add("id <", filter.BeforeID)
+	}
+	if filter.AfterID > 0 {
+		add("id >", filter.AfterID)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	where += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		where += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+	return where, args
+}
+
+func scanAuditEvents(rows *sql.Rows) ([]models.AuditEvent, error) {
+	defer rows.Close()
+	var events []models.AuditEvent
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *e)
+	}
+	return events, rows.Err()
+}
+
+func (s *SQLiteDB) CreateAuditEvent(ctx context.Context, e *models.AuditEvent) error {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO audit_events (actor_id, actor_name, action, target, repo_id, org_id, ip, request_id, before_json, after_json, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ActorID, e.ActorName, e.Action, e.Target, e.RepoID, e.OrgID, e.IP, e.RequestID, string(e.Before), string(e.After), e.CreatedAt)
+	if err != nil {
+		return err
+	}
+	e.ID, _ = res.LastInsertId()
+	return nil
+}
+
+func (s *SQLiteDB) ListAuditEvents(ctx context.Context, filter AuditEventFilter) ([]models.AuditEvent, error) {
+	where, args := auditEventWhere(filter, func(int) string { return "?" })
+	rows, err := s.db.QueryContext(ctx, `SELECT `+auditEventColumns+` FROM audit_events`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditEvents(rows)
+}
+
 // Compile-time interface check
 var _ DB = (*SQLiteDB)(nil)
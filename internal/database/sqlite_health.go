@@ -3,6 +3,8 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"time"
 
 	"github.com/odvcencio/gothub/internal/models"
 )
@@ -32,6 +34,55 @@ func (s *SQLiteDB) IndexingQueueStats(ctx context.Context) (IndexingQueueStats,
 	return stats, nil
 }
 
+func (s *SQLiteDB) ListQueueStats(ctx context.Context) ([]QueueStats, error) {
+	var out []QueueStats
+	for _, jobType := range []models.IndexJobType{models.IndexJobTypeCommitIndex, models.IndexJobTypeWebhookDelivery} {
+		stats, err := s.queueStats(ctx, string(jobType), `indexing_jobs WHERE job_type = ?`, []any{jobType},
+			models.IndexJobQueued, models.IndexJobInProgress, models.IndexJobFailed)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, stats)
+	}
+	stats, err := s.queueStats(ctx, "mail", `outbound_emails WHERE 1 = 1`, nil,
+		models.OutboundEmailQueued, models.OutboundEmailSending, models.OutboundEmailFailed)
+	if err != nil {
+		return nil, err
+	}
+	return append(out, stats), nil
+}
+
+// queueStats counts the jobs selected by from (a table and WHERE clause)
+// in each status. The oldest queued job is read as a plain column because
+// SQLite returns aggregates of DATETIME columns as text.
+func (s *SQLiteDB) queueStats(ctx context.Context, queue, from string, args []any, queued, inProgress, failed any) (QueueStats, error) {
+	stats := QueueStats{Queue: queue}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT
+			 COALESCE(SUM(CASE WHEN status = ? THEN 1 ELSE 0 END), 0),
+			 COALESCE(SUM(CASE WHEN status = ? THEN 1 ELSE 0 END), 0),
+			 COALESCE(SUM(CASE WHEN status = ? THEN 1 ELSE 0 END), 0)
+		 FROM `+from,
+		append([]any{queued, inProgress, failed}, args...)...,
+	).Scan(&stats.Queued, &stats.InProgress, &stats.Failed)
+	if err != nil {
+		return QueueStats{}, err
+	}
+	var oldest time.Time
+	err = s.db.QueryRowContext(ctx,
+		`SELECT next_attempt_at FROM `+from+` AND status = ? ORDER BY next_attempt_at LIMIT 1`,
+		append(args, queued)...,
+	).Scan(&oldest)
+	switch {
+	case err == nil:
+		oldest = oldest.UTC()
+		stats.OldestQueuedAt = &oldest
+	case !errors.Is(err, sql.ErrNoRows):
+		return QueueStats{}, err
+	}
+	return stats, nil
+}
+
 func (s *SQLiteDB) DBStats() sql.DBStats {
 	return s.db.Stats()
 }
@@ -3,6 +3,9 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -2002,6 +2005,215 @@ func TestSQLiteListIssuesPageAppliesStateAndOffset(t *testing.T) {
 	}
 }
 
+func TestSQLiteIssueReferenceUpsertKeepsClosingFlag(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := OpenSQLite(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := db.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	repo := &models.Repository{
+		OwnerUserID:   &user.ID,
+		Name:          "repo",
+		DefaultBranch: "main",
+		StoragePath:   "pending",
+	}
+	if err := db.CreateRepository(ctx, repo); err != nil {
+		t.Fatal(err)
+	}
+	issue := &models.Issue{RepoID: repo.ID, Title: "Issue", State: "open", AuthorID: user.ID}
+	if err := db.CreateIssue(ctx, issue); err != nil {
+		t.Fatal(err)
+	}
+
+	ref := &models.IssueReference{
+		RepoID:       repo.ID,
+		IssueID:      issue.ID,
+		SourceType:   models.IssueReferenceSourcePullRequest,
+		SourceID:     42,
+		SourceNumber: 7,
+		ActorID:      user.ID,
+		Closing:      true,
+	}
+	if err := db.UpsertIssueReference(ctx, ref); err != nil {
+		t.Fatal(err)
+	}
+	firstID := ref.ID
+
+	again := *ref
+	again.ID = 0
+	again.Closing = false
+	if err := db.UpsertIssueReference(ctx, &again); err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != firstID || !again.Closing {
+		t.Fatalf("expected upsert to reuse row %d and keep closing flag, got %+v", firstID, again)
+	}
+
+	commitRef := &models.IssueReference{
+		RepoID:     repo.ID,
+		IssueID:    issue.ID,
+		SourceType: models.IssueReferenceSourceCommit,
+		CommitHash: "abc123",
+		ActorID:    user.ID,
+	}
+	if err := db.UpsertIssueReference(ctx, commitRef); err != nil {
+		t.Fatal(err)
+	}
+
+	refs, err := db.ListIssueReferences(ctx, issue.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 2 {
+		t.Fatalf("expected 2 references, got %+v", refs)
+	}
+	if refs[0].SourceNumber != 7 || refs[0].IssueNumber != issue.Number || refs[0].ActorName != "alice" {
+		t.Fatalf("unexpected pull request reference: %+v", refs[0])
+	}
+	if refs[1].CommitHash != "abc123" || refs[1].Closing {
+		t.Fatalf("unexpected commit reference: %+v", refs[1])
+	}
+}
+
+func TestSQLiteSearchIssues(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := OpenSQLite(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := db.CreateUser(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", PasswordHash: "x"}
+	if err := db.CreateUser(ctx, bob); err != nil {
+		t.Fatal(err)
+	}
+	repo := &models.Repository{
+		OwnerUserID:   &alice.ID,
+		Name:          "repo",
+		DefaultBranch: "main",
+		StoragePath:   "pending",
+	}
+	if err := db.CreateRepository(ctx, repo); err != nil {
+		t.Fatal(err)
+	}
+
+	titleHit := &models.Issue{RepoID: repo.ID, Title: "Panic in merge driver", Body: "stack trace attached", State: "open", AuthorID: alice.ID}
+	if err := db.CreateIssue(ctx, titleHit); err != nil {
+		t.Fatal(err)
+	}
+	commentHit := &models.Issue{RepoID: repo.ID, Title: "Flaky test", Body: "fails sometimes", State: "closed", AuthorID: bob.ID}
+	if err := db.CreateIssue(ctx, commentHit); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateIssueComment(ctx, &models.IssueComment{IssueID: commentHit.ID, AuthorID: alice.ID, Body: "looks like a panic in merge"}); err != nil {
+		t.Fatal(err)
+	}
+	pr := &models.PullRequest{RepoID: repo.ID, Title: "Fix merge panic", Body: "guards nil entries", State: "merged", AuthorID: bob.ID, SourceBranch: "fix", TargetBranch: "main"}
+	if err := db.CreatePullRequest(ctx, pr); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := db.SearchIssues(ctx, models.IssueSearchQuery{RepoID: repo.ID, Terms: []string{"panic in merge"}, Sort: models.IssueSearchSortBest}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].ID != titleHit.ID || results[1].ID != commentHit.ID {
+		t.Fatalf("expected title match ranked above comment match, got %+v", results)
+	}
+	if results[0].AuthorName != "alice" || results[1].CommentCount != 1 || results[0].Score <= results[1].Score {
+		t.Fatalf("unexpected result details: %+v", results)
+	}
+
+	results, err = db.SearchIssues(ctx, models.IssueSearchQuery{RepoID: repo.ID, Terms: []string{"panic"}, Fields: []string{"title"}, Sort: models.IssueSearchSortCreated}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Kind == results[1].Kind {
+		t.Fatalf("expected title-only matches for the issue and pull request, got %+v", results)
+	}
+
+	results, err = db.SearchIssues(ctx, models.IssueSearchQuery{RepoID: repo.ID, State: "closed", AuthorName: "bob", Sort: models.IssueSearchSortCreated}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Kind == results[1].Kind {
+		t.Fatalf("expected bob's closed issue and merged pull request, got %+v", results)
+	}
+	for _, r := range results {
+		if r.AuthorName != "bob" || r.State == "open" {
+			t.Fatalf("unexpected closed result: %+v", r)
+		}
+	}
+
+	results, err = db.SearchIssues(ctx, models.IssueSearchQuery{RepoID: repo.ID, Kind: models.IssueSearchKindIssue, Sort: models.IssueSearchSortComments}, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != commentHit.ID {
+		t.Fatalf("expected most commented issue, got %+v", results)
+	}
+
+	commentHit.Title = "Flaky merge test"
+	if err := db.UpdateIssue(ctx, commentHit); err != nil {
+		t.Fatal(err)
+	}
+	results, err = db.SearchIssues(ctx, models.IssueSearchQuery{RepoID: repo.ID, Terms: []string{"flaky"}, Fields: []string{"title"}, Sort: models.IssueSearchSortBest}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Title != "Flaky merge test" {
+		t.Fatalf("expected updated title to be searchable, got %+v", results)
+	}
+
+	// Startup leaves a populated index alone and backfills an empty one.
+	if _, err := db.db.ExecContext(ctx, `DELETE FROM issue_search_fts WHERE rowid = ?`, titleHit.ID*2); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	results, err = db.SearchIssues(ctx, models.IssueSearchQuery{RepoID: repo.ID, Terms: []string{"stack trace"}}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("expected migrate not to rebuild a populated index, got %+v", results)
+	}
+	if _, err := db.db.ExecContext(ctx, `DELETE FROM issue_search_fts`); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	results, err = db.SearchIssues(ctx, models.IssueSearchQuery{RepoID: repo.ID, Terms: []string{"panic in merge"}, Sort: models.IssueSearchSortBest}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].ID != titleHit.ID || results[1].ID != commentHit.ID {
+		t.Fatalf("expected an empty index to be backfilled, got %+v", results)
+	}
+}
+
 func TestSQLiteIndexingJobLifecycle(t *testing.T) {
 	db, ctx, repoID := setupSQLiteIndexingRepo(t)
 	commitHash := strings.Repeat("a", 64)
@@ -2023,7 +2235,7 @@ func TestSQLiteIndexingJobLifecycle(t *testing.T) {
 		t.Fatalf("expected queued status after enqueue, got %q", job.Status)
 	}
 
-	claimed, err := db.ClaimIndexingJob(ctx)
+	claimed, err := db.ClaimIndexingJob(ctx, models.IndexJobTypeCommitIndex, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2043,7 +2255,7 @@ func TestSQLiteIndexingJobLifecycle(t *testing.T) {
 		t.Fatal("expected started_at to be set after claim")
 	}
 
-	emptyClaim, err := db.ClaimIndexingJob(ctx)
+	emptyClaim, err := db.ClaimIndexingJob(ctx, models.IndexJobTypeCommitIndex, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2084,7 +2296,7 @@ func TestSQLiteIndexingJobRetryAndFailureTransitions(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	first, err := db.ClaimIndexingJob(ctx)
+	first, err := db.ClaimIndexingJob(ctx, models.IndexJobTypeCommitIndex, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2114,7 +2326,7 @@ func TestSQLiteIndexingJobRetryAndFailureTransitions(t *testing.T) {
 		t.Fatalf("expected last_error to be persisted, got %q", queued.LastError)
 	}
 
-	second, err := db.ClaimIndexingJob(ctx)
+	second, err := db.ClaimIndexingJob(ctx, models.IndexJobTypeCommitIndex, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2145,7 +2357,7 @@ func TestSQLiteIndexingJobRetryAndFailureTransitions(t *testing.T) {
 		t.Fatalf("expected terminal last_error, got %q", final.LastError)
 	}
 
-	none, err := db.ClaimIndexingJob(ctx)
+	none, err := db.ClaimIndexingJob(ctx, models.IndexJobTypeCommitIndex, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2154,6 +2366,232 @@ func TestSQLiteIndexingJobRetryAndFailureTransitions(t *testing.T) {
 	}
 }
 
+func TestSQLiteWebhookJobsOutliveRepository(t *testing.T) {
+	db, ctx, repoID := setupSQLiteIndexingRepo(t)
+
+	// Recreate the table as installations before this change have it; the
+	// next migration must drop the cascading foreign key and keep the rows.
+	for _, stmt := range []string{
+		`DROP TRIGGER repositories_indexing_jobs_ad`,
+		`DROP TABLE indexing_jobs`,
+		`CREATE TABLE indexing_jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			repo_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+			commit_hash TEXT NOT NULL,
+			job_type TEXT NOT NULL DEFAULT 'commit_index',
+			concurrency_key TEXT NOT NULL DEFAULT '',
+			payload TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'queued',
+			attempt_count INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL DEFAULT 3,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			started_at DATETIME,
+			completed_at DATETIME,
+			UNIQUE (repo_id, commit_hash, job_type)
+		)`,
+	} {
+		if _, err := db.db.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, jobType := range []models.IndexJobType{models.IndexJobTypeCommitIndex, models.IndexJobTypeWebhookDelivery} {
+		if err := db.EnqueueIndexingJob(ctx, &models.IndexingJob{RepoID: repoID, CommitHash: "c0ffee", JobType: jobType, Status: models.IndexJobQueued}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var fks int
+	if err := db.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_foreign_key_list('indexing_jobs')`).Scan(&fks); err != nil {
+		t.Fatal(err)
+	}
+	if fks != 0 {
+		t.Fatalf("expected indexing_jobs without foreign keys, got %d", fks)
+	}
+
+	if err := db.DeleteRepository(ctx, repoID); err != nil {
+		t.Fatal(err)
+	}
+	if job, err := db.getIndexingJobStatusByType(ctx, repoID, "c0ffee", models.IndexJobTypeCommitIndex); err != nil || job != nil {
+		t.Fatalf("expected commit index job to be deleted with the repository, got %+v %v", job, err)
+	}
+	claimed, err := db.ClaimIndexingJob(ctx, models.IndexJobTypeWebhookDelivery, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed == nil || claimed.RepoID != repoID {
+		t.Fatalf("expected webhook delivery job to survive the repository, got %+v", claimed)
+	}
+}
+
+func TestSQLiteCompleteOutboundEmailClearsMessage(t *testing.T) {
+	db, ctx, _ := setupSQLiteIndexingRepo(t)
+	for _, to := range []string{"sent@example.com", "failed@example.com"} {
+		if err := db.EnqueueOutboundEmail(ctx, &models.OutboundEmail{
+			Recipient: to, Subject: "Sign in", Message: `{"text":"magic_token=secret"}`, MaxAttempts: 1,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().UTC()
+	for _, status := range []models.OutboundEmailStatus{models.OutboundEmailSent, models.OutboundEmailFailed} {
+		email, err := db.ClaimOutboundEmail(ctx, now, now.Add(time.Minute))
+		if err != nil || email == nil || email.Message == "" {
+			t.Fatalf("claim: %+v %v", email, err)
+		}
+		if err := db.CompleteOutboundEmail(ctx, email.ID, status, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stored int
+	if err := db.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM outbound_emails WHERE message <> ''`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored != 0 {
+		t.Fatalf("expected completed emails to drop their message, %d still stored", stored)
+	}
+}
+
+func TestSQLiteAuditEventsAreAppendOnly(t *testing.T) {
+	db, ctx, repoID := setupSQLiteIndexingRepo(t)
+	for i, action := range []string{"repo.create", "branch_protection.update", "repo.delete"} {
+		e := &models.AuditEvent{
+			ActorName: "queue-user",
+			Action:    action,
+			Target:    "queue-user/queue-repo",
+			RepoID:    &repoID,
+			After:     json.RawMessage(fmt.Sprintf(`{"step":%d}`, i)),
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := db.CreateAuditEvent(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.CreateAuditEvent(ctx, &models.AuditEvent{Action: "token.create", CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteRepository(ctx, repoID); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := db.ListAuditEvents(ctx, AuditEventFilter{RepoID: &repoID, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Action != "repo.delete" || string(events[0].After) != `{"step":2}` || events[0].Before != nil {
+		t.Fatalf("unexpected newest repo events %+v", events)
+	}
+	older, err := db.ListAuditEvents(ctx, AuditEventFilter{RepoID: &repoID, BeforeID: events[1].ID})
+	if err != nil || len(older) != 1 || older[0].Action != "repo.create" {
+		t.Fatalf("unexpected older repo events %+v %v", older, err)
+	}
+	all, err := db.ListAuditEvents(ctx, AuditEventFilter{})
+	if err != nil || len(all) != 4 {
+		t.Fatalf("expected 4 events site-wide, got %d %v", len(all), err)
+	}
+	newer, err := db.ListAuditEvents(ctx, AuditEventFilter{AfterID: events[0].ID})
+	if err != nil || len(newer) != 1 || newer[0].Action != "token.create" {
+		t.Fatalf("unexpected events after the repo's newest %+v %v", newer, err)
+	}
+
+	if _, err := db.db.ExecContext(ctx, `UPDATE audit_events SET action = 'noop'`); err == nil {
+		t.Fatal("expected updates to be rejected")
+	}
+	if _, err := db.db.ExecContext(ctx, `DELETE FROM audit_events`); err == nil {
+		t.Fatal("expected deletes to be rejected")
+	}
+}
+
+func TestSQLiteUserAdministration(t *testing.T) {
+	db, ctx, repoID := setupSQLiteIndexingRepo(t)
+	owner, err := db.GetUserByUsername(ctx, "queue-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	author := &models.User{Username: "author", Email: "author@example.com", PasswordHash: "x"}
+	ghost := &models.User{Username: "ghost", Email: "ghost@example.com", PasswordHash: "x"}
+	for _, u := range []*models.User{author, ghost} {
+		if err := db.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	users, err := db.ListUsers(ctx, "AUTH", 10, 0)
+	if err != nil || len(users) != 1 || users[0].ID != author.ID {
+		t.Fatalf("unexpected users for prefix query %+v %v", users, err)
+	}
+	if users, err = db.ListUsers(ctx, "", 2, 1); err != nil || len(users) != 2 || users[0].ID != author.ID {
+		t.Fatalf("unexpected users page %+v %v", users, err)
+	}
+
+	suspendedAt := time.Now().UTC().Truncate(time.Second)
+	if err := db.SetUserSuspended(ctx, author.ID, &suspendedAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetUserAdmin(ctx, author.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.GetUserByID(ctx, author.ID)
+	if err != nil || got.SuspendedAt == nil || !got.SuspendedAt.Equal(suspendedAt) || !got.IsAdmin {
+		t.Fatalf("expected a suspended admin, got %+v %v", got, err)
+	}
+	if err := db.SetUserSuspended(ctx, author.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = db.GetUserByID(ctx, author.ID); err != nil || got.SuspendedAt != nil {
+		t.Fatalf("expected suspension to be lifted, got %+v %v", got, err)
+	}
+	if err := db.SetUserSuspended(ctx, 9999, nil); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows for an unknown user, got %v", err)
+	}
+
+	// Deleting a user keeps their issues, credited to the successor.
+	issue := &models.Issue{RepoID: repoID, Title: "bug", State: "open", AuthorID: author.ID}
+	if err := db.CreateIssue(ctx, issue); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteUser(ctx, author.ID, ghost.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetUserByID(ctx, author.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected the user to be deleted, got %v", err)
+	}
+	kept, err := db.GetIssue(ctx, repoID, issue.Number)
+	if err != nil || kept.AuthorID != ghost.ID {
+		t.Fatalf("expected the issue to pass to the successor, got %+v %v", kept, err)
+	}
+
+	org := &models.Org{Name: "acme"}
+	if err := db.CreateOrg(ctx, org); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.TransferRepository(ctx, repoID, nil, &org.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetRepository(ctx, owner.Username, "queue-repo"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected the repo to leave its old owner, got %v", err)
+	}
+	moved, err := db.GetRepository(ctx, "acme", "queue-repo")
+	if err != nil || moved.ID != repoID || moved.OwnerUserID != nil {
+		t.Fatalf("unexpected transferred repo %+v %v", moved, err)
+	}
+
+	if err := db.EnqueueIndexingJob(ctx, &models.IndexingJob{RepoID: repoID, CommitHash: "abc", JobType: models.IndexJobTypeCommitIndex, Status: models.IndexJobQueued}); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := db.ListQueueStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 3 || stats[0].Queue != "commit_index" || stats[0].Queued != 1 || stats[0].OldestQueuedAt == nil || stats[2].Queue != "mail" || stats[2].Queued != 0 {
+		t.Fatalf("unexpected queue stats %+v", stats)
+	}
+}
+
 func setupSQLiteIndexingRepo(t *testing.T) (*SQLiteDB, context.Context, int64) {
 	t.Helper()
 	dbPath := filepath.Join(t.TempDir(), "test.db")
@@ -271,3 +271,47 @@ func TestConvertGotToGitTagRestoresObjectHeader(t *testing.T) {
 		t.Fatalf("expected got hash to be rewritten, got %q", string(converted))
 	}
 }
+
+func TestGitCommitGPGSignatureRoundTrip(t *testing.T) {
+	treeGitHash := strings.Repeat("1", 40)
+	gotTreeHash := strings.Repeat("a", 64)
+	resolve := func(gitHash string) (string, error) {
+		if gitHash == treeGitHash {
+			return gotTreeHash, nil
+		}
+		return "", fmt.Errorf("missing mapping for %s", gitHash)
+	}
+
+	raw := []byte("tree " + treeGitHash + "\n" +
+		"author Alice <alice@example.com> 1700000000 +0200\n" +
+		"committer Alice <alice@example.com> 1700000000 +0200\n" +
+		"gpgsig -----BEGIN PGP SIGNATURE-----\n" +
+		" \n" +
+		" iQEzBAABCAAdFiEE\n" +
+		" -----END PGP SIGNATURE-----\n" +
+		"\nsigned message\n")
+
+	commit, err := parseGitCommit(raw, resolve)
+	if err != nil {
+		t.Fatalf("parseGitCommit: %v", err)
+	}
+	wantSig := "-----BEGIN PGP SIGNATURE-----\n\niQEzBAABCAAdFiEE\n-----END PGP SIGNATURE-----"
+	if commit.Signature != wantSig {
+		t.Fatalf("unexpected signature: %q", commit.Signature)
+	}
+	if commit.Message != "signed message\n" {
+		t.Fatalf("unexpected message: %q", commit.Message)
+	}
+
+	_, roundTrip := GotToGitCommit(commit, GitHash(treeGitHash), nil)
+	if !bytes.Equal(roundTrip, raw) {
+		t.Fatalf("expected signed commit to round-trip\n got: %q\nwant: %q", roundTrip, raw)
+	}
+
+	unsigned := *commit
+	unsigned.Signature = "sshsig-v1:ssh-ed25519:AAAA:BBBB"
+	_, data := GotToGitCommit(&unsigned, GitHash(treeGitHash), nil)
+	if bytes.Contains(data, []byte("gpgsig")) {
+		t.Fatalf("expected got-native signature to be omitted, got %q", data)
+	}
+}
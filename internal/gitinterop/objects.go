@@ -3,6 +3,7 @@ package gitinterop
 import (
 	"bytes"
 	"compress/zlib"
+	"context"
 	"crypto/sha1"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/odvcencio/got/pkg/object"
+	"github.com/odvcencio/gothub/internal/database"
 )
 
 // Git object types
@@ -76,11 +78,25 @@ func GotToGitCommit(c *object.CommitObj, treeGitHash GitHash, parentGitHashes []
 	}
 	fmt.Fprintf(&buf, "author %s %d %s\n", c.Author, c.Timestamp, authorTZ)
 	fmt.Fprintf(&buf, "committer %s %d %s\n", committer, committerTS, committerTZ)
+	if sig := gitArmoredSignature(c.Signature); sig != "" {
+		fmt.Fprintf(&buf, "gpgsig %s\n", strings.ReplaceAll(sig, "\n", "\n "))
+	}
 	fmt.Fprintf(&buf, "\n%s", c.Message)
 	data := buf.Bytes()
 	return GitHashBytes(GitTypeCommit, data), data
 }
 
+// gitArmoredSignature returns sig without its trailing newline if it is an
+// armored signature that git carries in a gpgsig header. Got-native
+// signatures are not part of the git object.
+func gitArmoredSignature(sig string) string {
+	sig = strings.TrimRight(sig, "\n")
+	if !strings.HasPrefix(sig, "-----BEGIN ") {
+		return ""
+	}
+	return sig
+}
+
 // GotToGitTree converts a Got tree to a git tree object.
 // entryHashes maps entry names to their pre-resolved git hashes.
 // entryModes maps entry names to git modes (e.g. "100644", "100755", "120000", "160000", "40000").
@@ -156,3 +172,71 @@ func hexToBytes(hex string) []byte {
 func bytesToHex(b []byte) string {
 	return fmt.Sprintf("%x", b)
 }
+
+// CommitSigningPayload returns the git commit object that a gpgsig signature
+// on c covers, i.e. the commit as served to git clients without its gpgsig
+// header. Trees without a git hash mapping, such as those rewritten with
+// entity lists after a push, are converted from store. It reports false when
+// the commit's objects cannot be mapped back to git, which means the commit
+// was not created through git.
+func CommitSigningPayload(ctx context.Context, store *object.Store, db database.DB, repoID int64, c *object.CommitObj) ([]byte, bool) {
+	treeGitHash, ok := gitTreeHash(ctx, store, db, repoID, c.TreeHash)
+	if !ok {
+		return nil, false
+	}
+	parents := make([]GitHash, 0, len(c.Parents))
+	for _, p := range c.Parents {
+		h, err := db.GetGitHash(ctx, repoID, string(p))
+		if err != nil {
+			return nil, false
+		}
+		parents = append(parents, GitHash(h))
+	}
+	unsigned := *c
+	unsigned.Signature = ""
+	_, data := GotToGitCommit(&unsigned, treeGitHash, parents)
+	return data, true
+}
+
+func gitTreeHash(ctx context.Context, store *object.Store, db database.DB, repoID int64, treeHash object.Hash) (GitHash, bool) {
+	if h, err := db.GetGitHash(ctx, repoID, string(treeHash)); err == nil {
+		return GitHash(h), true
+	}
+	tree, err := store.ReadTree(treeHash)
+	if err != nil {
+		return "", false
+	}
+	entryHashes := make(map[string]GitHash, len(tree.Entries))
+	for _, e := range tree.Entries {
+		if e.IsDir {
+			h, ok := gitTreeHash(ctx, store, db, repoID, e.SubtreeHash)
+			if !ok {
+				return "", false
+			}
+			entryHashes[e.Name] = h
+			continue
+		}
+		h, err := db.GetGitHash(ctx, repoID, string(e.BlobHash))
+		if err != nil {
+			return "", false
+		}
+		entryHashes[e.Name] = GitHash(h)
+	}
+	modeMap, _ := db.GetGitTreeEntryModes(ctx, repoID, string(treeHash))
+	h, _ := GotToGitTree(tree, entryHashes, modeMap)
+	return h, true
+}
+
+// TagSigningPayload splits an annotated tag pushed through git into the
+// bytes its embedded armored signature covers and the signature itself.
+func TagSigningPayload(ctx context.Context, db database.DB, repoID int64, tag *object.TagObj) (payload []byte, signature string, ok bool) {
+	if len(tag.Data) == 0 {
+		return nil, "", false
+	}
+	data := gotTagDataToGit(tag.Data, ctx, db, repoID)
+	idx := bytes.Index(data, []byte("-----BEGIN "))
+	if idx < 0 || (idx > 0 && data[idx-1] != '\n') {
+		return nil, "", false
+	}
+	return data[:idx], string(data[idx:]), true
+}
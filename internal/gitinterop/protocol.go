@@ -27,6 +27,7 @@ type SmartHTTPHandler struct {
 	authorize    func(r *http.Request, owner, repo string, write bool) (int, error)
 	indexLineage func(ctx context.Context, repoID int64, store *gotstore.RepoStore, commitHash object.Hash) error
 	validateRef  func(ctx context.Context, owner, repo string, repoID int64, refName string, oldHash, newHash object.Hash) error
+	refUpdated   func(ctx context.Context, owner, repo string, repoID int64, refName string, oldHash, newHash object.Hash)
 }
 
 type refUpdate struct {
@@ -66,6 +67,12 @@ func (h *SmartHTTPHandler) SetRefUpdateValidator(fn func(ctx context.Context, ow
 	h.validateRef = fn
 }
 
+// SetRefUpdatedHook registers a callback invoked after a pushed ref has been
+// moved to a new commit.
+func (h *SmartHTTPHandler) SetRefUpdatedHook(fn func(ctx context.Context, owner, repo string, repoID int64, refName string, oldHash, newHash object.Hash)) {
+	h.refUpdated = fn
+}
+
 // RegisterRoutes sets up git smart HTTP protocol routes.
 func (h *SmartHTTPHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /git/{owner}/{repo}/info/refs", h.handleInfoRefs)
@@ -93,13 +100,6 @@ func (h *SmartHTTPHandler) handleInfoRefs(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	refs, err := store.Refs.ListAll()
-	if err != nil {
-		// Empty repo — return empty ref list
-		refs = map[string]object.Hash{}
-	}
-
-	// Convert Got hashes to git hashes
 	repoID, err := h.getRepo(r.Context(), owner, repo)
 	if err != nil {
 		http.Error(w, "repository not found", http.StatusNotFound)
@@ -113,12 +113,23 @@ func (h *SmartHTTPHandler) handleInfoRefs(w http.ResponseWriter, r *http.Request
 	w.Write(pktLine(fmt.Sprintf("# service=%s\n", svc)))
 	w.Write(pktFlush())
 
+	h.advertiseRefs(r.Context(), w, store, repoID, svc)
+}
+
+// advertiseRefs writes the ref advertisement for svc, terminated by a flush.
+func (h *SmartHTTPHandler) advertiseRefs(ctx context.Context, w io.Writer, store *gotstore.RepoStore, repoID int64, svc string) {
+	refs, err := store.Refs.ListAll()
+	if err != nil {
+		// Empty repo — return empty ref list
+		refs = map[string]object.Hash{}
+	}
+
 	capabilities := advertisedCapabilities(svc)
 
-	// Send refs
+	// Send refs, converting Got hashes to git hashes
 	first := true
 	for name, gotHash := range refs {
-		gitHash, err := h.db.GetGitHash(r.Context(), repoID, string(gotHash))
+		gitHash, err := h.db.GetGitHash(ctx, repoID, string(gotHash))
 		if err != nil {
 			// If no mapping exists, the hash might not have been pushed via git
 			continue
@@ -162,8 +173,34 @@ func (h *SmartHTTPHandler) handleReceivePack(w http.ResponseWriter, r *http.Requ
 	}
 
 	br := bufio.NewReader(http.MaxBytesReader(w, r.Body, maxReceivePackBytes))
+	updates, useSideband, err := readReceivePackCommands(br)
+	if err != nil {
+		if isRequestTooLarge(err) {
+			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "protocol error", http.StatusBadRequest)
+		return
+	}
 
-	// Read ref update commands
+	// Read packfile (rest of body)
+	packData, err := io.ReadAll(br)
+	if err != nil {
+		if isRequestTooLarge(err) {
+			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "read packfile error", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-git-receive-pack-result")
+	h.receivePack(r.Context(), w, owner, repo, store, repoID, updates, packData, useSideband)
+}
+
+// readReceivePackCommands reads ref update commands up to the flush that
+// ends them.
+func readReceivePackCommands(br *bufio.Reader) ([]refUpdate, bool, error) {
 	var updates []refUpdate
 	useSideband := false
 	firstCommand := true
@@ -171,12 +208,7 @@ func (h *SmartHTTPHandler) handleReceivePack(w http.ResponseWriter, r *http.Requ
 	for {
 		line, err := readPktLine(br)
 		if err != nil {
-			if isRequestTooLarge(err) {
-				http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
-				return
-			}
-			http.Error(w, "protocol error", http.StatusBadRequest)
-			return
+			return nil, false, err
 		}
 		if line == nil {
 			break // flush
@@ -200,18 +232,12 @@ func (h *SmartHTTPHandler) handleReceivePack(w http.ResponseWriter, r *http.Requ
 			storageRef: normalizeGitRefName(parts[2]),
 		})
 	}
+	return updates, useSideband, nil
+}
 
-	// Read packfile (rest of body)
-	packData, err := io.ReadAll(br)
-	if err != nil {
-		if isRequestTooLarge(err) {
-			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
-			return
-		}
-		http.Error(w, "read packfile error", http.StatusBadRequest)
-		return
-	}
-
+// receivePack unpacks packData into the repository, applies the ref updates
+// and writes the report-status response.
+func (h *SmartHTTPHandler) receivePack(ctx context.Context, w io.Writer, owner, repo string, store *gotstore.RepoStore, repoID int64, updates []refUpdate, packData []byte, useSideband bool) {
 	if len(packData) > 0 {
 		// Parse packfile and convert objects to Got format
 		objects, err := ParsePackfile(bytes.NewReader(packData))
@@ -231,7 +257,7 @@ func (h *SmartHTTPHandler) handleReceivePack(w http.ResponseWriter, r *http.Requ
 			if gotHash, ok := knownGotByGit[gitHash]; ok {
 				return gotHash, nil
 			}
-			gotHash, err := h.db.GetGotHash(r.Context(), repoID, gitHash)
+			gotHash, err := h.db.GetGotHash(ctx, repoID, gitHash)
 			if err == nil {
 				knownGotByGit[gitHash] = gotHash
 				return gotHash, nil
@@ -363,25 +389,25 @@ func (h *SmartHTTPHandler) handleReceivePack(w http.ResponseWriter, r *http.Requ
 			deferred = nextDeferred
 		}
 
-		if err := h.db.SetHashMappings(r.Context(), pendingMappings); err != nil {
+		if err := h.db.SetHashMappings(ctx, pendingMappings); err != nil {
 			h.sendReceivePackResult(w, fmt.Sprintf("unpack error: persist hash mappings: %v", err), nil, nil, useSideband)
 			return
 		}
 		for _, tm := range pendingTreeModes {
-			if err := h.db.SetGitTreeEntryModes(r.Context(), repoID, tm.gotTreeHash, tm.modes); err != nil {
+			if err := h.db.SetGitTreeEntryModes(ctx, repoID, tm.gotTreeHash, tm.modes); err != nil {
 				h.sendReceivePackResult(w, fmt.Sprintf("unpack error: persist tree modes: %v", err), nil, nil, useSideband)
 				return
 			}
 		}
 
 		// Run entity extraction and rewrite trees/commits so entity lists are reachable.
-		entityCommitMappings, err := h.extractEntitiesForCommits(r.Context(), store, repoID, updates)
+		entityCommitMappings, err := h.extractEntitiesForCommits(ctx, store, repoID, updates)
 		if err != nil {
 			h.sendReceivePackResult(w, fmt.Sprintf("unpack error: entity extraction: %v", err), nil, nil, useSideband)
 			return
 		}
 		if len(entityCommitMappings) > 0 {
-			if err := h.db.SetHashMappings(r.Context(), entityCommitMappings); err != nil {
+			if err := h.db.SetHashMappings(ctx, entityCommitMappings); err != nil {
 				h.sendReceivePackResult(w, fmt.Sprintf("unpack error: persist entity commit mappings: %v", err), nil, nil, useSideband)
 				return
 			}
@@ -391,7 +417,7 @@ func (h *SmartHTTPHandler) handleReceivePack(w http.ResponseWriter, r *http.Requ
 	// Update refs
 	refErrors := make(map[string]string, len(updates))
 	for _, u := range updates {
-		expectedOldGotHash, err := h.resolveExpectedOldGotHash(r.Context(), repoID, u.oldHash)
+		expectedOldGotHash, err := h.resolveExpectedOldGotHash(ctx, repoID, u.oldHash)
 		if err != nil {
 			refErrors[u.refName] = err.Error()
 			continue
@@ -400,7 +426,7 @@ func (h *SmartHTTPHandler) handleReceivePack(w http.ResponseWriter, r *http.Requ
 
 		if string(u.newHash) == gitZeroHash40 {
 			if h.validateRef != nil {
-				if err := h.validateRef(r.Context(), owner, repo, repoID, u.storageRef, expectedOldGotHash, ""); err != nil {
+				if err := h.validateRef(ctx, owner, repo, repoID, u.storageRef, expectedOldGotHash, ""); err != nil {
 					refErrors[u.refName] = err.Error()
 					continue
 				}
@@ -408,7 +434,7 @@ func (h *SmartHTTPHandler) handleReceivePack(w http.ResponseWriter, r *http.Requ
 			if err := store.Refs.Update(u.storageRef, expectedOldPtr, nil); err != nil {
 				var mismatch *gotstore.RefCASMismatchError
 				if errors.As(err, &mismatch) {
-					actualGit := h.gitHashForGotHash(r.Context(), repoID, mismatch.Actual)
+					actualGit := h.gitHashForGotHash(ctx, repoID, mismatch.Actual)
 					refErrors[u.refName] = fmt.Sprintf("stale old hash (expected %s, got %s)", string(u.oldHash), actualGit)
 					continue
 				}
@@ -416,20 +442,20 @@ func (h *SmartHTTPHandler) handleReceivePack(w http.ResponseWriter, r *http.Requ
 			}
 			continue
 		}
-		gotHash, err := h.db.GetGotHash(r.Context(), repoID, string(u.newHash))
+		gotHash, err := h.db.GetGotHash(ctx, repoID, string(u.newHash))
 		if err != nil {
 			refErrors[u.refName] = "missing object mapping"
 			continue
 		}
 		newGotHash := object.Hash(gotHash)
 		if h.validateRef != nil {
-			if err := h.validateRef(r.Context(), owner, repo, repoID, u.storageRef, expectedOldGotHash, newGotHash); err != nil {
+			if err := h.validateRef(ctx, owner, repo, repoID, u.storageRef, expectedOldGotHash, newGotHash); err != nil {
 				refErrors[u.refName] = err.Error()
 				continue
 			}
 		}
 		if h.indexLineage != nil {
-			if err := h.indexLineage(r.Context(), repoID, store, newGotHash); err != nil {
+			if err := h.indexLineage(ctx, repoID, store, newGotHash); err != nil {
 				refErrors[u.refName] = "lineage index failed"
 				continue
 			}
@@ -437,11 +463,15 @@ func (h *SmartHTTPHandler) handleReceivePack(w http.ResponseWriter, r *http.Requ
 		if err := store.Refs.Update(u.storageRef, expectedOldPtr, &newGotHash); err != nil {
 			var mismatch *gotstore.RefCASMismatchError
 			if errors.As(err, &mismatch) {
-				actualGit := h.gitHashForGotHash(r.Context(), repoID, mismatch.Actual)
+				actualGit := h.gitHashForGotHash(ctx, repoID, mismatch.Actual)
 				refErrors[u.refName] = fmt.Sprintf("stale old hash (expected %s, got %s)", string(u.oldHash), actualGit)
 				continue
 			}
 			refErrors[u.refName] = err.Error()
+			continue
+		}
+		if h.refUpdated != nil {
+			h.refUpdated(ctx, owner, repo, repoID, u.storageRef, expectedOldGotHash, newGotHash)
 		}
 	}
 
@@ -494,38 +524,42 @@ func (h *SmartHTTPHandler) handleUploadPack(w http.ResponseWriter, r *http.Reque
 	}
 
 	br := bufio.NewReader(http.MaxBytesReader(w, r.Body, maxUploadPackBytes))
+	wants, haves, useSideband, err := readUploadPackRequest(br)
+	if err != nil {
+		if isRequestTooLarge(err) {
+			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "protocol error", http.StatusBadRequest)
+		return
+	}
 
-	// Read want/have negotiation
-	var wants []GitHash
-	var haves []GitHash
-	useSideband := false
+	w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+	h.uploadPack(r.Context(), w, store, repoID, wants, haves, useSideband)
+}
+
+// readUploadPackRequest reads a stateless want/have negotiation through
+// "done".
+func readUploadPackRequest(br *bufio.Reader) (wants, haves []GitHash, useSideband bool, err error) {
 	firstWant := true
 
 	for {
 		line, err := readPktLine(br)
 		if err != nil {
-			if isRequestTooLarge(err) {
-				http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
-				return
-			}
-			http.Error(w, "protocol error", http.StatusBadRequest)
-			return
+			return nil, nil, false, err
 		}
 		if line == nil {
 			break
 		}
-		raw := strings.TrimRight(string(line), "\n")
-		s := raw
-		if firstWant && strings.HasPrefix(raw, "want ") {
-			payload, caps := splitPktPayloadAndCapabilities(raw)
-			s = payload
-			useSideband = caps["side-band-64k"] || caps["side-band"]
-			firstWant = false
-		}
+		s := strings.TrimRight(string(line), "\n")
 		if strings.HasPrefix(s, "want ") {
-			fields := strings.Fields(s)
-			if len(fields) >= 2 {
-				wants = append(wants, GitHash(fields[1]))
+			hash, caps := splitWantLine(s)
+			if firstWant {
+				useSideband = caps["side-band-64k"] || caps["side-band"]
+				firstWant = false
+			}
+			if hash != "" {
+				wants = append(wants, hash)
 			}
 		} else if strings.HasPrefix(s, "have ") {
 			fields := strings.Fields(s)
@@ -542,8 +576,7 @@ func (h *SmartHTTPHandler) handleUploadPack(w http.ResponseWriter, r *http.Reque
 		line, err := readPktLine(br)
 		if err != nil {
 			if isRequestTooLarge(err) {
-				http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
-				return
+				return nil, nil, false, err
 			}
 			break
 		}
@@ -554,11 +587,16 @@ func (h *SmartHTTPHandler) handleUploadPack(w http.ResponseWriter, r *http.Reque
 			break
 		}
 	}
+	return wants, haves, useSideband, nil
+}
 
+// uploadPack writes the final NAK and a packfile with the objects reachable
+// from wants that are not reachable from haves.
+func (h *SmartHTTPHandler) uploadPack(ctx context.Context, w io.Writer, store *gotstore.RepoStore, repoID int64, wants, haves []GitHash, useSideband bool) {
 	// Collect objects to send
 	haveSet := make(map[object.Hash]bool)
 	for _, gh := range haves {
-		if gotHash, err := h.db.GetGotHash(r.Context(), repoID, string(gh)); err == nil {
+		if gotHash, err := h.db.GetGotHash(ctx, repoID, string(gh)); err == nil {
 			haveSet[object.Hash(gotHash)] = true
 		}
 	}
@@ -566,7 +604,7 @@ func (h *SmartHTTPHandler) handleUploadPack(w http.ResponseWriter, r *http.Reque
 	var packObjects []PackfileObject
 
 	for _, wantGitHash := range wants {
-		gotHash, err := h.db.GetGotHash(r.Context(), repoID, string(wantGitHash))
+		gotHash, err := h.db.GetGotHash(ctx, repoID, string(wantGitHash))
 		if err != nil {
 			continue
 		}
@@ -587,7 +625,7 @@ func (h *SmartHTTPHandler) handleUploadPack(w http.ResponseWriter, r *http.Reque
 				return
 			}
 			gitType := gotTypeToPackType(objType)
-			gitData, err := convertGotToGitData(m, objType, data, store.Objects, r.Context(), h.db, repoID)
+			gitData, err := convertGotToGitData(m, objType, data, store.Objects, ctx, h.db, repoID)
 			if err != nil {
 				h.sendUploadPackError(w, http.StatusUnprocessableEntity, fmt.Sprintf("convert object %s to git: %v", m, err), useSideband)
 				return
@@ -598,6 +636,7 @@ func (h *SmartHTTPHandler) handleUploadPack(w http.ResponseWriter, r *http.Reque
 
 	var packData []byte
 	if len(packObjects) > 0 {
+		var err error
 		packData, err = BuildPackfile(packObjects)
 		if err != nil {
 			h.sendUploadPackError(w, http.StatusInternalServerError, fmt.Sprintf("build packfile: %v", err), useSideband)
@@ -606,7 +645,6 @@ func (h *SmartHTTPHandler) handleUploadPack(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Build and send upload-pack response.
-	w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
 	w.Write(pktLine("NAK\n"))
 
 	if len(packData) == 0 {
@@ -622,9 +660,26 @@ func (h *SmartHTTPHandler) handleUploadPack(w http.ResponseWriter, r *http.Reque
 	w.Write(packData)
 }
 
-func (h *SmartHTTPHandler) sendUploadPackError(w http.ResponseWriter, status int, errMsg string, useSideband bool) {
-	w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
-	w.WriteHeader(status)
+// splitWantLine returns the object ID of a want line and the capabilities
+// that follow it. git separates them with a space; a NUL, as in ref
+// advertisements, is accepted too.
+func splitWantLine(line string) (GitHash, map[string]bool) {
+	payload, caps := splitPktPayloadAndCapabilities(line)
+	fields := strings.Fields(payload)
+	if len(fields) < 2 {
+		return "", caps
+	}
+	for _, capName := range fields[2:] {
+		caps[capName] = true
+	}
+	return GitHash(fields[1]), caps
+}
+
+func (h *SmartHTTPHandler) sendUploadPackError(w io.Writer, status int, errMsg string, useSideband bool) {
+	if hw, ok := w.(http.ResponseWriter); ok {
+		hw.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+		hw.WriteHeader(status)
+	}
 	if useSideband {
 		if err := writeSideband(w, 3, []byte(errMsg+"\n")); err == nil {
 			w.Write(pktFlush())
@@ -634,29 +689,32 @@ func (h *SmartHTTPHandler) sendUploadPackError(w http.ResponseWriter, status int
 	_, _ = w.Write(pktLine(fmt.Sprintf("ERR %s\n", errMsg)))
 }
 
-func (h *SmartHTTPHandler) sendReceivePackResult(w http.ResponseWriter, errMsg string, updates []refUpdate, refErrors map[string]string, useSideband bool) {
-	w.Header().Set("Content-Type", "application/x-git-receive-pack-result")
+// sendReceivePackResult writes the report-status pkt-lines. With side-band
+// the whole report, including its flush, is carried on channel 1 as git's
+// receive-pack does.
+func (h *SmartHTTPHandler) sendReceivePackResult(w io.Writer, errMsg string, updates []refUpdate, refErrors map[string]string, useSideband bool) {
+	var report bytes.Buffer
 	if errMsg != "" {
-		h.writeReceivePackLine(w, fmt.Sprintf("unpack %s\n", errMsg), useSideband)
+		report.Write(pktLine(fmt.Sprintf("unpack %s\n", errMsg)))
 	} else {
-		h.writeReceivePackLine(w, "unpack ok\n", useSideband)
+		report.Write(pktLine("unpack ok\n"))
 		for _, u := range updates {
 			if msg, failed := refErrors[u.refName]; failed && msg != "" {
-				h.writeReceivePackLine(w, fmt.Sprintf("ng %s %s\n", u.refName, msg), useSideband)
+				report.Write(pktLine(fmt.Sprintf("ng %s %s\n", u.refName, msg)))
 				continue
 			}
-			h.writeReceivePackLine(w, fmt.Sprintf("ok %s\n", u.refName), useSideband)
+			report.Write(pktLine(fmt.Sprintf("ok %s\n", u.refName)))
 		}
 	}
-	w.Write(pktFlush())
-}
-
-func (h *SmartHTTPHandler) writeReceivePackLine(w http.ResponseWriter, line string, useSideband bool) {
-	if useSideband {
-		_, _ = w.Write(sidebandPacket(1, []byte(line)))
+	report.Write(pktFlush())
+	if !useSideband {
+		_, _ = w.Write(report.Bytes())
+		return
+	}
+	if err := writeSideband(w, 1, report.Bytes()); err != nil {
 		return
 	}
-	_, _ = w.Write(pktLine(line))
+	_, _ = w.Write(pktFlush())
 }
 
 func advertisedCapabilities(service string) string {
@@ -837,7 +895,8 @@ func parseGitCommit(data []byte, resolveGotHash func(gitHash string) (string, er
 	lines := strings.Split(string(data), "\n")
 	c := &object.CommitObj{}
 	inBody := false
-	var bodyLines []string
+	inSignature := false
+	var bodyLines, sigLines []string
 
 	for _, line := range lines {
 		if inBody {
@@ -848,6 +907,11 @@ func parseGitCommit(data []byte, resolveGotHash func(gitHash string) (string, er
 			inBody = true
 			continue
 		}
+		if inSignature && strings.HasPrefix(line, " ") {
+			sigLines = append(sigLines, line[1:])
+			continue
+		}
+		inSignature = false
 		parts := strings.SplitN(line, " ", 2)
 		if len(parts) != 2 {
 			continue
@@ -875,11 +939,15 @@ func parseGitCommit(data []byte, resolveGotHash func(gitHash string) (string, er
 			c.Committer = ident
 			c.CommitterTimestamp = ts
 			c.CommitterTimezone = tz
+		case "gpgsig":
+			inSignature = true
+			sigLines = append(sigLines[:0], parts[1])
 		}
 	}
 	if c.TreeHash == "" {
 		return nil, fmt.Errorf("commit is missing tree hash")
 	}
+	c.Signature = strings.Join(sigLines, "\n")
 	c.Message = strings.Join(bodyLines, "\n")
 	return c, nil
 }
@@ -1023,12 +1091,16 @@ func convertGotToGitData(gotHash object.Hash, objType object.ObjectType, data []
 		if err != nil {
 			return nil, err
 		}
-		treeGitHash := getGitHash(ctx, db, repoID, string(commit.TreeHash))
+		// Trees rewritten with entity lists have no mapping of their own.
+		treeGitHash, ok := gitTreeHash(ctx, store, db, repoID, commit.TreeHash)
+		if !ok {
+			treeGitHash = GitHash(strings.Repeat("0", 40))
+		}
 		var parentGitHashes []GitHash
 		for _, p := range commit.Parents {
 			parentGitHashes = append(parentGitHashes, GitHash(getGitHash(ctx, db, repoID, string(p))))
 		}
-		_, gitData := GotToGitCommit(commit, GitHash(treeGitHash), parentGitHashes)
+		_, gitData := GotToGitCommit(commit, treeGitHash, parentGitHashes)
 		return gitData, nil
 	case object.TypeTree:
 		tree, err := object.UnmarshalTree(data)
@@ -1037,13 +1109,15 @@ func convertGotToGitData(gotHash object.Hash, objType object.ObjectType, data []
 		}
 		entryHashes := make(map[string]GitHash)
 		for _, e := range tree.Entries {
-			var h object.Hash
 			if e.IsDir {
-				h = e.SubtreeHash
-			} else {
-				h = e.BlobHash
+				h, ok := gitTreeHash(ctx, store, db, repoID, e.SubtreeHash)
+				if !ok {
+					h = GitHash(strings.Repeat("0", 40))
+				}
+				entryHashes[e.Name] = h
+				continue
 			}
-			entryHashes[e.Name] = GitHash(getGitHash(ctx, db, repoID, string(h)))
+			entryHashes[e.Name] = GitHash(getGitHash(ctx, db, repoID, string(e.BlobHash)))
 		}
 		modeMap, _ := db.GetGitTreeEntryModes(ctx, repoID, string(gotHash))
 		_, gitData := GotToGitTree(tree, entryHashes, modeMap)
@@ -0,0 +1,484 @@
+package gitinterop
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshUserIDExtension      = "gothub-user-id"
+	sshDeployKeyIDExtension = "gothub-deploy-key-id"
+)
+
+var errUnknownSSHKey = errors.New("unknown public key")
+
+// SSHIdentity is the credential an SSH connection authenticated with: a
+// user's SSH key or a repository deploy key. Exactly one ID is set.
+type SSHIdentity struct {
+	UserID      int64
+	DeployKeyID int64
+}
+
+// SSHServer serves git-upload-pack and git-receive-pack over SSH to users
+// authenticated by one of their registered SSH keys, and to machines holding
+// a repository deploy key. It shares the smart HTTP handler's object
+// conversion, ref validators and hooks.
+type SSHServer struct {
+	handler     *SmartHTTPHandler
+	config      *ssh.ServerConfig
+	authorize   func(ctx context.Context, id SSHIdentity, owner, repo string, write bool) (context.Context, error)
+	baseContext func() context.Context
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+// NewSSHServer returns an SSH server backed by handler. authorize decides
+// whether the key's owner may read (or, for pushes, write) a repository and
+// its error is shown to the client when access is refused. The context it
+// returns identifies the pusher to ref validators and hooks.
+func NewSSHServer(handler *SmartHTTPHandler, hostKey ssh.Signer, authorize func(ctx context.Context, id SSHIdentity, owner, repo string, write bool) (context.Context, error)) *SSHServer {
+	s := &SSHServer{
+		handler:     handler,
+		authorize:   authorize,
+		baseContext: context.Background,
+		listeners:   make(map[net.Listener]struct{}),
+		conns:       make(map[net.Conn]struct{}),
+	}
+	s.config = &ssh.ServerConfig{
+		PublicKeyCallback: s.authenticateKey,
+		ServerVersion:     "SSH-2.0-gothub",
+	}
+	s.config.AddHostKey(hostKey)
+	return s
+}
+
+// SetBaseContext sets the function that returns the context each session
+// starts from, e.g. to carry a tenant ID.
+func (s *SSHServer) SetBaseContext(fn func() context.Context) {
+	if fn == nil {
+		fn = context.Background
+	}
+	s.baseContext = fn
+}
+
+// ListenAndServe listens on addr and serves SSH connections until Close.
+func (s *SSHServer) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Close is called.
+func (s *SSHServer) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return net.ErrClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed {
+				return net.ErrClosed
+			}
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// Close stops the listeners and drops open connections.
+func (s *SSHServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	return nil
+}
+
+func (s *SSHServer) trackConn(conn net.Conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		if s.closed {
+			return false
+		}
+		s.conns[conn] = struct{}{}
+		return true
+	}
+	delete(s.conns, conn)
+	return true
+}
+
+// authenticateKey accepts a key registered by a user or as an active deploy
+// key. The MD5 fingerprint locates the key; the full key is compared before
+// it is trusted.
+func (s *SSHServer) authenticateKey(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	ctx := s.baseContext()
+	fp := fmt.Sprintf("%x", md5.Sum(key.Marshal()))
+	if stored, err := s.handler.db.GetSSHKeyByFingerprint(ctx, fp); err == nil {
+		if !sshKeyMatches(stored.PublicKey, key) {
+			return nil, errUnknownSSHKey
+		}
+		// Suspended users keep their keys but cannot use them.
+		if user, err := s.handler.db.GetUserByID(ctx, stored.UserID); err != nil || user.SuspendedAt != nil {
+			return nil, errUnknownSSHKey
+		}
+		return &ssh.Permissions{
+			Extensions: map[string]string{sshUserIDExtension: strconv.FormatInt(stored.UserID, 10)},
+		}, nil
+	}
+	deployKey, err := s.handler.db.GetRepoDeployKeyByFingerprint(ctx, fp)
+	if err != nil || !sshKeyMatches(deployKey.PublicKey, key) {
+		return nil, errUnknownSSHKey
+	}
+	return &ssh.Permissions{
+		Extensions: map[string]string{sshDeployKeyIDExtension: strconv.FormatInt(deployKey.ID, 10)},
+	}, nil
+}
+
+func sshKeyMatches(authorizedKey string, key ssh.PublicKey) bool {
+	storedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	return err == nil && bytes.Equal(storedKey.Marshal(), key.Marshal())
+}
+
+// sshIdentityFromPermissions recovers the identity authenticateKey recorded.
+func sshIdentityFromPermissions(perms *ssh.Permissions) (SSHIdentity, bool) {
+	if perms == nil {
+		return SSHIdentity{}, false
+	}
+	if v, ok := perms.Extensions[sshUserIDExtension]; ok {
+		id, err := strconv.ParseInt(v, 10, 64)
+		return SSHIdentity{UserID: id}, err == nil
+	}
+	if v, ok := perms.Extensions[sshDeployKeyIDExtension]; ok {
+		id, err := strconv.ParseInt(v, 10, 64)
+		return SSHIdentity{DeployKeyID: id}, err == nil
+	}
+	return SSHIdentity{}, false
+}
+
+func (s *SSHServer) handleConn(conn net.Conn) {
+	if !s.trackConn(conn, true) {
+		conn.Close()
+		return
+	}
+	defer s.trackConn(conn, false)
+	defer conn.Close()
+
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	defer sshConn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	identity, ok := sshIdentityFromPermissions(sshConn.Permissions)
+	if !ok {
+		return
+	}
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		ch, chanReqs, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go s.handleSession(identity, ch, chanReqs)
+	}
+}
+
+func (s *SSHServer) handleSession(identity SSHIdentity, ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+	for req := range reqs {
+		switch req.Type {
+		case "env":
+			// GIT_PROTOCOL may ask for protocol v2; v0 is always answered.
+			req.Reply(true, nil)
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			status := s.runCommand(identity, ch, payload.Command)
+			sendSSHExitStatus(ch, status)
+			return
+		case "shell":
+			req.Reply(true, nil)
+			fmt.Fprintln(ch.Stderr(), "gothub does not provide shell access; use git to clone and push over SSH.")
+			sendSSHExitStatus(ch, 1)
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+func sendSSHExitStatus(ch ssh.Channel, status uint32) {
+	_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+}
+
+// runCommand runs a git service command and returns its exit status.
+func (s *SSHServer) runCommand(identity SSHIdentity, ch ssh.Channel, command string) uint32 {
+	svc, owner, repo, err := parseSSHGitCommand(command)
+	if err != nil {
+		fmt.Fprintf(ch.Stderr(), "ERROR: %v\n", err)
+		return 1
+	}
+	ctx := s.baseContext()
+	if s.authorize != nil {
+		authorized, err := s.authorize(ctx, identity, owner, repo, svc == "git-receive-pack")
+		if err != nil {
+			fmt.Fprintf(ch.Stderr(), "ERROR: %v\n", err)
+			return 1
+		}
+		ctx = authorized
+	}
+	store, err := s.handler.getStore(owner, repo)
+	if err != nil {
+		fmt.Fprintln(ch.Stderr(), "ERROR: repository not found")
+		return 1
+	}
+	repoID, err := s.handler.getRepo(ctx, owner, repo)
+	if err != nil {
+		fmt.Fprintln(ch.Stderr(), "ERROR: repository not found")
+		return 1
+	}
+
+	h := s.handler
+	h.advertiseRefs(ctx, ch, store, repoID, svc)
+	if svc == "git-upload-pack" {
+		br := bufio.NewReader(&maxBytesReader{r: ch, n: maxUploadPackBytes})
+		wants, haves, useSideband, err := negotiateUploadPack(br, ch)
+		if err != nil {
+			fmt.Fprintf(ch.Stderr(), "ERROR: protocol error: %v\n", err)
+			return 1
+		}
+		if len(wants) > 0 {
+			h.uploadPack(ctx, ch, store, repoID, wants, haves, useSideband)
+		}
+		return 0
+	}
+
+	br := bufio.NewReader(&maxBytesReader{r: ch, n: maxReceivePackBytes})
+	updates, useSideband, err := readReceivePackCommands(br)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0
+		}
+		fmt.Fprintf(ch.Stderr(), "ERROR: protocol error: %v\n", err)
+		return 1
+	}
+	if len(updates) == 0 {
+		return 0
+	}
+	var packData []byte
+	for _, u := range updates {
+		if string(u.newHash) != gitZeroHash40 {
+			// A pack follows unless every command is a delete.
+			if packData, err = readPackStream(br); err != nil {
+				h.sendReceivePackResult(ch, fmt.Sprintf("unpack error: read packfile: %v", err), nil, nil, useSideband)
+				return 1
+			}
+			break
+		}
+	}
+	h.receivePack(ctx, ch, owner, repo, store, repoID, updates, packData, useSideband)
+	return 0
+}
+
+// parseSSHGitCommand parses commands such as
+// "git-upload-pack '/alice/repo.git'" as sent by git over SSH.
+func parseSSHGitCommand(command string) (svc, owner, repo string, err error) {
+	svc, arg, ok := strings.Cut(strings.TrimSpace(command), " ")
+	if !ok || (svc != "git-upload-pack" && svc != "git-receive-pack") {
+		return "", "", "", fmt.Errorf("unsupported command %q", command)
+	}
+	arg = strings.TrimSpace(arg)
+	if len(arg) >= 2 && (arg[0] == '\'' || arg[0] == '"') && arg[len(arg)-1] == arg[0] {
+		arg = arg[1 : len(arg)-1]
+	}
+	arg = strings.Trim(arg, "/")
+	owner, repo, ok = strings.Cut(arg, "/")
+	repo = strings.TrimSuffix(repo, ".git")
+	if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return "", "", "", fmt.Errorf("invalid repository path %q", arg)
+	}
+	return svc, owner, repo, nil
+}
+
+// negotiateUploadPack reads a stateful want/have negotiation, answering each
+// flushed batch of haves with NAK, until the client sends "done". It returns
+// no wants when the client only wanted the ref advertisement.
+func negotiateUploadPack(br *bufio.Reader, w io.Writer) (wants, haves []GitHash, useSideband bool, err error) {
+	for {
+		line, err := readPktLine(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(wants) == 0 {
+				return nil, nil, false, nil
+			}
+			return nil, nil, false, err
+		}
+		if line == nil {
+			break
+		}
+		s := strings.TrimRight(string(line), "\n")
+		if !strings.HasPrefix(s, "want ") {
+			continue
+		}
+		hash, caps := splitWantLine(s)
+		if len(wants) == 0 {
+			useSideband = caps["side-band-64k"] || caps["side-band"]
+		}
+		if hash != "" {
+			wants = append(wants, hash)
+		}
+	}
+	if len(wants) == 0 {
+		return nil, nil, false, nil
+	}
+
+	for {
+		line, err := readPktLine(br)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if line == nil {
+			if _, err := w.Write(pktLine("NAK\n")); err != nil {
+				return nil, nil, false, err
+			}
+			continue
+		}
+		s := strings.TrimRight(string(line), "\n")
+		if s == "done" {
+			return wants, haves, useSideband, nil
+		}
+		if fields := strings.Fields(s); len(fields) >= 2 && fields[0] == "have" {
+			haves = append(haves, GitHash(fields[1]))
+		}
+	}
+}
+
+// readPackStream reads exactly one packfile from br. Over SSH the client
+// keeps the channel open for the report, so the pack's end is found by
+// walking its objects rather than waiting for EOF.
+func readPackStream(br *bufio.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	r := &recordingReader{r: br, buf: &buf}
+
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if string(header[:4]) != "PACK" {
+		return nil, fmt.Errorf("invalid packfile magic: %s", header[:4])
+	}
+	numObjects := binary.BigEndian.Uint32(header[8:])
+	for i := uint32(0); i < numObjects; i++ {
+		objType, _, err := readPackfileObjHeader(r)
+		if err != nil {
+			return nil, fmt.Errorf("object %d header: %w", i, err)
+		}
+		switch objType {
+		case OBJ_OFS_DELTA:
+			if _, err := readOfsOffset(r); err != nil {
+				return nil, fmt.Errorf("object %d ofs-delta offset: %w", i, err)
+			}
+		case OBJ_REF_DELTA:
+			var base [20]byte
+			if _, err := io.ReadFull(r, base[:]); err != nil {
+				return nil, fmt.Errorf("object %d ref-delta base: %w", i, err)
+			}
+		}
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("object %d data: %w", i, err)
+		}
+		if _, err := io.Copy(io.Discard, zr); err != nil {
+			return nil, fmt.Errorf("object %d data: %w", i, err)
+		}
+		zr.Close()
+	}
+	var trailer [20]byte
+	if _, err := io.ReadFull(r, trailer[:]); err != nil {
+		return nil, fmt.Errorf("read trailer: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// recordingReader copies everything read from r into buf. It implements
+// io.ByteReader so zlib stops at the end of each compressed object.
+type recordingReader struct {
+	r   *bufio.Reader
+	buf *bytes.Buffer
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.buf.Write(p[:n])
+	return n, err
+}
+
+func (r *recordingReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.buf.WriteByte(b)
+	}
+	return b, err
+}
+
+// maxBytesReader fails with *http.MaxBytesError once more than n bytes have
+// been read, matching the smart HTTP request limits.
+type maxBytesReader struct {
+	r    io.Reader
+	n    int64
+	read int64
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if m.read >= m.n {
+		return 0, &http.MaxBytesError{Limit: m.n}
+	}
+	if remaining := m.n - m.read; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := m.r.Read(p)
+	m.read += int64(n)
+	return n, err
+}
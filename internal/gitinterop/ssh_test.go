@@ -0,0 +1,307 @@
+package gitinterop
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/odvcencio/got/pkg/object"
+	"github.com/odvcencio/gothub/internal/gotstore"
+	"github.com/odvcencio/gothub/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// testPusherKey carries the authorized user from the authorize callback to
+// the ref updated hook.
+type testPusherKey struct{}
+
+func TestSSHServerPushAndFetch(t *testing.T) {
+	store, db, repoID, owner, repo, cleanup := setupUploadPackTestRepo(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	alice, err := db.GetUserByUsername(ctx, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", PasswordHash: "x"}
+	if err := db.CreateUser(ctx, bob); err != nil {
+		t.Fatal(err)
+	}
+	aliceKey := registerTestSSHKey(t, db.CreateSSHKey, alice.ID)
+	bobKey := registerTestSSHKey(t, db.CreateSSHKey, bob.ID)
+	_, strangerPriv, _ := ed25519.GenerateKey(rand.Reader)
+	strangerKey, err := ssh.NewSignerFromKey(strangerPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewSmartHTTPHandler(
+		func(ownerArg, repoArg string) (*gotstore.RepoStore, error) {
+			if ownerArg == owner && repoArg == repo {
+				return store, nil
+			}
+			return nil, errRepoNotFound
+		},
+		db,
+		func(ctx context.Context, ownerArg, repoArg string) (int64, error) {
+			if ownerArg == owner && repoArg == repo {
+				return repoID, nil
+			}
+			return 0, errRepoNotFound
+		},
+		nil,
+		nil,
+	)
+	h.SetRefUpdateValidator(func(ctx context.Context, owner, repo string, repoID int64, refName string, oldHash, newHash object.Hash) error {
+		if refName == "heads/protected" {
+			return errors.New("branch is protected")
+		}
+		return nil
+	})
+	var updated []string
+	h.SetRefUpdatedHook(func(ctx context.Context, owner, repo string, repoID int64, refName string, oldHash, newHash object.Hash) {
+		pusher, _ := ctx.Value(testPusherKey{}).(int64)
+		updated = append(updated, fmt.Sprintf("%s by %d", refName, pusher))
+	})
+
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewSSHServer(h, hostKey, func(ctx context.Context, id SSHIdentity, ownerArg, repoArg string, write bool) (context.Context, error) {
+		if id.DeployKeyID != 0 && id.UserID != 0 {
+			return nil, errors.New("ambiguous identity")
+		}
+		if write && id.UserID != alice.ID {
+			return nil, errors.New("forbidden")
+		}
+		return context.WithValue(ctx, testPusherKey{}, id.UserID), nil
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	dial := func(signer ssh.Signer) (*ssh.Client, error) {
+		return ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{
+			User:            "git",
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: ssh.FixedHostKey(hostKey.PublicKey()),
+		})
+	}
+
+	if _, err := dial(strangerKey); err == nil {
+		t.Fatal("expected unregistered key to be rejected")
+	}
+
+	// A deploy key authenticates as itself, not as a user.
+	deployKey := registerTestSSHKey(t, func(ctx context.Context, key *models.SSHKey) error {
+		return db.CreateRepoDeployKey(ctx, &models.RepoDeployKey{
+			RepoID: repoID, Name: "deploy", Kind: models.DeployKeyKindSSH, ReadOnly: true,
+			Fingerprint: key.Fingerprint, PublicKey: key.PublicKey, KeyType: key.KeyType, CreatedByUserID: alice.ID,
+		})
+	}, alice.ID)
+	deployClient, err := dial(deployKey)
+	if err != nil {
+		t.Fatalf("expected deploy key to authenticate: %v", err)
+	}
+	session, err := deployClient.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deployStderr bytes.Buffer
+	session.Stderr = &deployStderr
+	if err := session.Run("git-receive-pack 'alice/repo.git'"); err == nil || !strings.Contains(deployStderr.String(), "forbidden") {
+		t.Fatalf("expected deploy key push to be refused, got %v (stderr %q)", err, deployStderr.String())
+	}
+	deployClient.Close()
+
+	blob := []byte("hello\n")
+	blobHash := gitHashRaw(OBJ_BLOB, blob)
+	rawBlobHash, _ := hex.DecodeString(blobHash)
+	tree := append([]byte("100644 README\x00"), rawBlobHash...)
+	treeHash := gitHashRaw(OBJ_TREE, tree)
+	commit := []byte(fmt.Sprintf("tree %s\nauthor Alice <alice@example.com> 1700000000 +0000\ncommitter Alice <alice@example.com> 1700000000 +0000\n\ninitial\n", treeHash))
+	commitHash := gitHashRaw(OBJ_COMMIT, commit)
+	pack, err := BuildPackfile([]PackfileObject{
+		{Type: OBJ_BLOB, Data: blob},
+		{Type: OBJ_TREE, Data: tree},
+		{Type: OBJ_COMMIT, Data: commit},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bob can read but not push.
+	bobClient, err := dial(bobKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bobClient.Close()
+	session, err = bobClient.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	err = session.Run("git-receive-pack '/alice/repo.git'")
+	var exitErr *ssh.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitStatus() != 1 || !strings.Contains(stderr.String(), "forbidden") {
+		t.Fatalf("expected bob's push to be refused, got %v (stderr %q)", err, stderr.String())
+	}
+
+	aliceClient, err := dial(aliceKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aliceClient.Close()
+
+	// Push the commit to main and to a protected branch. Stdin stays open, as
+	// git keeps it open while it waits for the report.
+	session, err = aliceClient.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, _ := session.StdinPipe()
+	stdout, _ := session.StdoutPipe()
+	if err := session.Start("git-receive-pack 'alice/repo.git'"); err != nil {
+		t.Fatal(err)
+	}
+	out := bufio.NewReader(stdout)
+	readTestPktLines(t, out)
+	stdin.Write(pktLine(gitZeroHash40 + " " + commitHash + " refs/heads/main\x00report-status\n"))
+	stdin.Write(pktLine(gitZeroHash40 + " " + commitHash + " refs/heads/protected\n"))
+	stdin.Write(pktFlush())
+	stdin.Write(pack)
+	report := readTestPktLines(t, out)
+	want := []string{"unpack ok", "ok refs/heads/main", "ng refs/heads/protected branch is protected"}
+	if strings.Join(report, "|") != strings.Join(want, "|") {
+		t.Fatalf("unexpected push report %q", report)
+	}
+	stdin.Close()
+	if err := session.Wait(); err != nil {
+		t.Fatalf("receive-pack exit: %v", err)
+	}
+	if _, err := store.Refs.Get("heads/main"); err != nil {
+		t.Fatalf("expected heads/main to be created: %v", err)
+	}
+	if _, err := store.Refs.Get("heads/protected"); err == nil {
+		t.Fatal("expected protected branch update to be rejected")
+	}
+	if want := fmt.Sprintf("heads/main by %d", alice.ID); len(updated) != 1 || updated[0] != want {
+		t.Fatalf("expected ref updated hook %q with the pusher in its context, got %v", want, updated)
+	}
+
+	// Fetch it back with a stateful negotiation.
+	session, err = bobClient.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, _ = session.StdinPipe()
+	stdout, _ = session.StdoutPipe()
+	if err := session.Start("git-upload-pack '/alice/repo.git'"); err != nil {
+		t.Fatal(err)
+	}
+	out = bufio.NewReader(stdout)
+	refs := readTestPktLines(t, out)
+	if len(refs) != 1 || !strings.HasPrefix(refs[0], commitHash+" refs/heads/main\x00") {
+		t.Fatalf("unexpected ref advertisement %q", refs)
+	}
+	stdin.Write(pktLine("want " + commitHash + "\n"))
+	stdin.Write(pktFlush())
+	stdin.Write(pktLine("have " + strings.Repeat("1", 40) + "\n"))
+	stdin.Write(pktFlush())
+	if line, err := readPktLine(out); err != nil || string(line) != "NAK\n" {
+		t.Fatalf("expected NAK for have batch, got %q (%v)", line, err)
+	}
+	stdin.Write(pktLine("done\n"))
+	if line, err := readPktLine(out); err != nil || string(line) != "NAK\n" {
+		t.Fatalf("expected final NAK, got %q (%v)", line, err)
+	}
+	packData, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Wait(); err != nil {
+		t.Fatalf("upload-pack exit: %v", err)
+	}
+	objects, err := ParsePackfile(bytes.NewReader(packData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 3 {
+		t.Fatalf("expected 3 fetched objects, got %d", len(objects))
+	}
+}
+
+func TestParseSSHGitCommand(t *testing.T) {
+	for _, tc := range []struct {
+		command, svc, owner, repo string
+	}{
+		{"git-upload-pack '/alice/repo.git'", "git-upload-pack", "alice", "repo"},
+		{"git-receive-pack 'alice/repo'", "git-receive-pack", "alice", "repo"},
+	} {
+		svc, owner, repo, err := parseSSHGitCommand(tc.command)
+		if err != nil || svc != tc.svc || owner != tc.owner || repo != tc.repo {
+			t.Fatalf("parse %q = %q %q %q %v", tc.command, svc, owner, repo, err)
+		}
+	}
+	for _, command := range []string{"ls -la", "git-upload-pack 'alice'", "git-upload-pack 'a/b/c'", "git-upload-archive 'alice/repo'"} {
+		if _, _, _, err := parseSSHGitCommand(command); err == nil {
+			t.Fatalf("expected %q to be rejected", command)
+		}
+	}
+}
+
+func registerTestSSHKey(t *testing.T, create func(context.Context, *models.SSHKey) error, userID int64) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := signer.PublicKey()
+	if err := create(context.Background(), &models.SSHKey{
+		UserID:      userID,
+		Name:        "laptop",
+		Fingerprint: fmt.Sprintf("%x", md5.Sum(pub.Marshal())),
+		PublicKey:   string(ssh.MarshalAuthorizedKey(pub)),
+		KeyType:     pub.Type(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// readTestPktLines reads pkt-lines up to a flush, trimming newlines.
+func readTestPktLines(t *testing.T, r *bufio.Reader) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := readPktLine(r)
+		if err != nil {
+			t.Fatalf("read pkt-line: %v", err)
+		}
+		if line == nil {
+			return lines
+		}
+		lines = append(lines, strings.TrimRight(string(line), "\n"))
+	}
+}
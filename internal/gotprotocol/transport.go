@@ -47,6 +47,7 @@ type Handler struct {
 	authorize   func(r *http.Request, owner, repo string, write bool) (int, error)
 	indexCommit func(ctx context.Context, owner, repo string, commitHash object.Hash) error
 	validateRef func(ctx context.Context, owner, repo, refName string, oldHash, newHash object.Hash) error
+	refUpdated  func(ctx context.Context, owner, repo, refName string, oldHash, newHash object.Hash)
 }
 
 type refUpdateRequest struct {
@@ -71,6 +72,12 @@ func (h *Handler) SetRefUpdateValidator(fn func(ctx context.Context, owner, repo
 	h.validateRef = fn
 }
 
+// SetRefUpdatedHook registers a callback invoked after a ref has been moved
+// to a new commit.
+func (h *Handler) SetRefUpdatedHook(fn func(ctx context.Context, owner, repo, refName string, oldHash, newHash object.Hash)) {
+	h.refUpdated = fn
+}
+
 // RegisterRoutes sets up Got protocol routes on the given mux.
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /got/{owner}/{repo}/refs", h.handleListRefs)
@@ -618,6 +625,9 @@ func (h *Handler) handleUpdateRefs(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		applied[u.Name] = string(target)
+		if h.refUpdated != nil {
+			h.refUpdated(r.Context(), owner, repo, u.Name, currentHash, target)
+		}
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{"status": "ok", "updated": applied})
@@ -19,16 +19,23 @@ const (
 
 // Queue persists indexing jobs and status transitions in the database.
 type Queue struct {
-	db          database.DB
-	retryDelay  time.Duration
-	maxAttempts int
-	jobType     models.IndexJobType
+	db               database.DB
+	retryDelay       time.Duration
+	maxRetryDelay    time.Duration
+	maxAttempts      int
+	jobType          models.IndexJobType
+	concurrencyLimit int
 }
 
 type QueueOptions struct {
-	RetryDelay  time.Duration
-	MaxAttempts int
-	JobType     models.IndexJobType
+	RetryDelay time.Duration
+	// MaxRetryDelay enables exponential backoff: each retry doubles the
+	// previous delay, capped at this value. Zero keeps a fixed RetryDelay.
+	MaxRetryDelay time.Duration
+	MaxAttempts   int
+	JobType       models.IndexJobType
+	// ConcurrencyLimit caps in-progress jobs per concurrency key. Defaults to 1.
+	ConcurrencyLimit int
 }
 
 func NewQueue(db database.DB, opts QueueOptions) *Queue {
@@ -44,26 +51,37 @@ func NewQueue(db database.DB, opts QueueOptions) *Queue {
 	if jobType == "" {
 		jobType = models.IndexJobTypeCommitIndex
 	}
+	concurrencyLimit := opts.ConcurrencyLimit
+	if concurrencyLimit <= 0 {
+		concurrencyLimit = 1
+	}
 	return &Queue{
-		db:          db,
-		retryDelay:  retryDelay,
-		maxAttempts: maxAttempts,
-		jobType:     jobType,
+		db:               db,
+		retryDelay:       retryDelay,
+		maxRetryDelay:    opts.MaxRetryDelay,
+		maxAttempts:      maxAttempts,
+		jobType:          jobType,
+		concurrencyLimit: concurrencyLimit,
 	}
 }
 
 func (q *Queue) EnqueueCommitIndex(ctx context.Context, repoID int64, commitHash string) (*models.IndexingJob, error) {
-	if strings.TrimSpace(commitHash) == "" {
-		return nil, fmt.Errorf("commit hash is required")
+	return q.Enqueue(ctx, &models.IndexingJob{RepoID: repoID, CommitHash: commitHash})
+}
+
+// Enqueue persists job with the queue's job type and attempt budget. Jobs
+// that share a ConcurrencyKey are claimed strictly in enqueue order.
+func (q *Queue) Enqueue(ctx context.Context, job *models.IndexingJob) (*models.IndexingJob, error) {
+	if job == nil {
+		return nil, fmt.Errorf("indexing job is nil")
 	}
-	job := &models.IndexingJob{
-		RepoID:        repoID,
-		CommitHash:    commitHash,
-		JobType:       q.jobType,
-		Status:        models.IndexJobQueued,
-		MaxAttempts:   q.maxAttempts,
-		NextAttemptAt: time.Now().UTC(),
+	if strings.TrimSpace(job.CommitHash) == "" {
+		return nil, fmt.Errorf("commit hash is required")
 	}
+	job.JobType = q.jobType
+	job.Status = models.IndexJobQueued
+	job.MaxAttempts = q.maxAttempts
+	job.NextAttemptAt = time.Now().UTC()
 	if err := q.db.EnqueueIndexingJob(ctx, job); err != nil {
 		return nil, err
 	}
@@ -71,7 +89,7 @@ func (q *Queue) EnqueueCommitIndex(ctx context.Context, repoID int64, commitHash
 }
 
 func (q *Queue) Claim(ctx context.Context) (*models.IndexingJob, error) {
-	return q.db.ClaimIndexingJob(ctx)
+	return q.db.ClaimIndexingJob(ctx, q.jobType, q.concurrencyLimit)
 }
 
 func (q *Queue) Complete(ctx context.Context, jobID int64) error {
@@ -90,10 +108,25 @@ func (q *Queue) RetryOrFail(ctx context.Context, job *models.IndexingJob, runErr
 	if job.MaxAttempts > 0 && job.AttemptCount >= job.MaxAttempts {
 		return q.db.CompleteIndexingJob(ctx, job.ID, models.IndexJobFailed, message)
 	}
-	nextAttempt := time.Now().UTC().Add(q.retryDelay)
+	nextAttempt := time.Now().UTC().Add(q.backoff(job.AttemptCount))
 	return q.db.RequeueIndexingJob(ctx, job.ID, message, nextAttempt)
 }
 
+// backoff returns the delay before the retry following attempt.
+func (q *Queue) backoff(attempt int) time.Duration {
+	if q.maxRetryDelay <= 0 {
+		return q.retryDelay
+	}
+	delay := q.retryDelay
+	for i := 1; i < attempt && delay < q.maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.maxRetryDelay {
+		delay = q.maxRetryDelay
+	}
+	return delay
+}
+
 func (q *Queue) Status(ctx context.Context, repoID int64, commitHash string) (*models.IndexingJob, error) {
 	job, err := q.db.GetIndexingJobStatus(ctx, repoID, commitHash)
 	if err != nil {
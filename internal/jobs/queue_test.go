@@ -105,6 +105,94 @@ func TestQueueRetryOrFailTransitions(t *testing.T) {
 	}
 }
 
+func TestQueueConcurrencyKeyOrderingAndLimit(t *testing.T) {
+	db, repoID := setupQueueTestDB(t)
+	q := NewQueue(db, QueueOptions{
+		JobType:       models.IndexJobTypeWebhookDelivery,
+		RetryDelay:    time.Hour,
+		MaxRetryDelay: 4 * time.Hour,
+		MaxAttempts:   5,
+	})
+
+	ctx := context.Background()
+	enqueue := func(uid, key string) *models.IndexingJob {
+		t.Helper()
+		job, err := q.Enqueue(ctx, &models.IndexingJob{RepoID: repoID, CommitHash: uid, ConcurrencyKey: key, Payload: "{}"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+	a1 := enqueue("a1", "webhook:1")
+	a2 := enqueue("a2", "webhook:1")
+	b1 := enqueue("b1", "webhook:2")
+
+	// Commit index jobs live in the same table but are never claimed here.
+	if _, err := NewQueue(db, QueueOptions{}).EnqueueCommitIndex(ctx, repoID, strings.Repeat("c", 64)); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := q.Claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == nil || first.ID != a1.ID || first.Payload != "{}" || first.ConcurrencyKey != "webhook:1" {
+		t.Fatalf("expected a1 first, got %+v", first)
+	}
+	second, err := q.Claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == nil || second.ID != b1.ID {
+		t.Fatalf("expected b1 while webhook:1 is busy, got %+v", second)
+	}
+	none, err := q.Claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if none != nil {
+		t.Fatalf("expected no claimable job, got %+v", none)
+	}
+
+	// A retried job keeps its place: later jobs for the key wait behind it.
+	if err := q.RetryOrFail(ctx, first, errors.New("connection refused")); err != nil {
+		t.Fatal(err)
+	}
+	none, err = q.Claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if none != nil {
+		t.Fatalf("expected a2 to wait behind backed-off a1, got %+v", none)
+	}
+	status, err := q.Status(ctx, repoID, a1.CommitHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status == nil || status.Status != models.IndexJobQueued || status.NextAttemptAt.Before(time.Now().Add(50*time.Minute)) {
+		t.Fatalf("expected a1 requeued about an hour out, got %+v", status)
+	}
+	if status, err := q.Status(ctx, repoID, a2.CommitHash); err != nil || status.Status != models.IndexJobQueued {
+		t.Fatalf("expected a2 still queued, got %+v err=%v", status, err)
+	}
+}
+
+func TestQueueExponentialBackoff(t *testing.T) {
+	q := NewQueue(nil, QueueOptions{RetryDelay: time.Minute, MaxRetryDelay: 4 * time.Hour})
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute}
+	for i, w := range want {
+		if got := q.backoff(i + 1); got != w {
+			t.Fatalf("backoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+	if got := q.backoff(20); got != 4*time.Hour {
+		t.Fatalf("backoff(20) = %s, want cap of 4h", got)
+	}
+	if got := NewQueue(nil, QueueOptions{RetryDelay: time.Minute}).backoff(5); got != time.Minute {
+		t.Fatalf("fixed backoff = %s, want 1m", got)
+	}
+}
+
 func setupQueueTestDB(t *testing.T) (database.DB, int64) {
 	t.Helper()
 
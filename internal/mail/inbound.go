@@ -0,0 +1,202 @@
+package mail
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// maxInboundBody bounds how much of a decoded body part is read.
+const maxInboundBody = 1 << 20
+
+var (
+	ErrAutoReply   = errors.New("message is an automatic reply")
+	ErrNoPlainText = errors.New("message has no text/plain body")
+)
+
+// InboundMessage is a received email reduced to what a reply needs.
+type InboundMessage struct {
+	From string // bare sender address
+	// Recipients are the bare addresses from Delivered-To, X-Original-To,
+	// To and Cc, in that order.
+	Recipients []string
+	MessageID  string
+	// Text is the plain-text body with quoted text and signature removed.
+	Text string
+}
+
+// ParseInbound parses an RFC 822 message. Automatic replies such as
+// out-of-office notices are rejected with ErrAutoReply so that they never
+// become comments.
+func ParseInbound(r io.Reader) (*InboundMessage, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("parse message: %w", err)
+	}
+	if isAutoReply(msg.Header) {
+		return nil, ErrAutoReply
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("parse from: %w", err)
+	}
+	in := &InboundMessage{
+		From:      strings.ToLower(from.Address),
+		MessageID: strings.TrimSpace(msg.Header.Get("Message-ID")),
+	}
+	for _, name := range []string{"Delivered-To", "X-Original-To", "To", "Cc"} {
+		for _, value := range msg.Header[name] {
+			addrs, err := mail.ParseAddressList(value)
+			if err != nil {
+				continue
+			}
+			for _, addr := range addrs {
+				in.Recipients = append(in.Recipients, addr.Address)
+			}
+		}
+	}
+	text, err := plainTextBody(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	in.Text = StripQuotedReply(text)
+	return in, nil
+}
+
+func isAutoReply(h mail.Header) bool {
+	if v := strings.ToLower(strings.TrimSpace(h.Get("Auto-Submitted"))); v != "" && v != "no" {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(h.Get("Precedence"))) {
+	case "bulk", "junk", "auto_reply", "list":
+		return true
+	}
+	return h.Get("X-Autoreply") != "" || h.Get("X-Autorespond") != ""
+}
+
+// plainTextBody returns the first text/plain part, descending into
+// multipart bodies and undoing the transfer encoding.
+func plainTextBody(contentType, encoding string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || contentType == "" {
+		mediaType, params = "text/plain", nil
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return "", ErrNoPlainText
+			}
+			if err != nil {
+				return "", fmt.Errorf("read multipart body: %w", err)
+			}
+			text, err := plainTextBody(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err == nil {
+				return text, nil
+			}
+			if !errors.Is(err, ErrNoPlainText) {
+				return "", err
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", ErrNoPlainText
+	}
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: body})
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxInboundBody))
+	if err != nil {
+		return "", fmt.Errorf("decode body: %w", err)
+	}
+	return string(data), nil
+}
+
+// newlineStripper drops line breaks so base64 bodies wrapped at 76 columns
+// decode.
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	for {
+		count, err := n.r.Read(p)
+		kept := 0
+		for _, b := range p[:count] {
+			if b != '\r' && b != '\n' {
+				p[kept] = b
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+var (
+	// "On Tue, Jan 2, 2026 at 3:04 PM Alice <alice@example.com> wrote:",
+	// which some clients wrap over two lines.
+	replyHeaderPattern    = regexp.MustCompile(`(?i)^on\b.*\bwrote:\s*$`)
+	originalMessageMarker = regexp.MustCompile(`(?i)^-+\s*original message\s*-+$`)
+	sentFromPattern       = regexp.MustCompile(`(?i)^sent from my \w+`)
+)
+
+// StripQuotedReply returns the new text of a reply: everything before the
+// quoted original, a signature delimiter or a mobile "Sent from" footer,
+// with inline ">" quotes removed.
+func StripQuotedReply(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxInboundBody)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	var kept []string
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+		if isQuoteBoundary(trimmed, lines, i) {
+			break
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+func isQuoteBoundary(trimmed string, lines []string, i int) bool {
+	switch {
+	case trimmed == "--" || lines[i] == "-- ":
+		return true
+	case replyHeaderPattern.MatchString(trimmed):
+		return true
+	case strings.HasPrefix(strings.ToLower(trimmed), "on ") && i+1 < len(lines) &&
+		replyHeaderPattern.MatchString(trimmed+" "+strings.TrimSpace(lines[i+1])):
+		return true
+	case originalMessageMarker.MatchString(trimmed):
+		return true
+	case sentFromPattern.MatchString(trimmed):
+		return true
+	case strings.HasPrefix(trimmed, "From:") && i+1 < len(lines):
+		next := strings.TrimSpace(lines[i+1])
+		return strings.HasPrefix(next, "Sent:") || strings.HasPrefix(next, "Date:")
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageBytesThreadsAndEncodes(t *testing.T) {
+	msg := &Message{
+		From:       "gothub <noreply@example.com>",
+		To:         "alice <alice@example.com>",
+		ReplyTo:    "reply+abc@reply.example.com",
+		Subject:    "Héllo",
+		Text:       "line one\nhttps://example.com/login?magic_token=abc\n",
+		MessageID:  "<issue-1.2@example.com>",
+		InReplyTo:  "<issue-1@example.com>",
+		References: []string{"<issue-1@example.com>"},
+		Headers:    map[string]string{"X-Gothub-Reason": "mention\r\nBcc: evil@example.com"},
+		Date:       time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != "Héllo" {
+		t.Fatalf("subject = %q, %v", subject, err)
+	}
+	for name, want := range map[string]string{
+		"Reply-To":        "reply+abc@reply.example.com",
+		"Message-Id":      "<issue-1.2@example.com>",
+		"In-Reply-To":     "<issue-1@example.com>",
+		"References":      "<issue-1@example.com>",
+		"X-Gothub-Reason": "mentionBcc: evil@example.com",
+	} {
+		if got := parsed.Header.Get(name); got != want {
+			t.Fatalf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if parsed.Header.Get("Bcc") != "" {
+		t.Fatal("header injection was not neutralized")
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "magic_token=abc") {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
+
+func TestMessageValidate(t *testing.T) {
+	msg := &Message{From: "noreply@example.com", To: "not an address", Subject: "x"}
+	if err := msg.Validate(); err == nil {
+		t.Fatal("expected invalid recipient to be rejected")
+	}
+	msg.To = "alice@example.com"
+	msg.Subject = " "
+	if err := msg.Validate(); err == nil {
+		t.Fatal("expected empty subject to be rejected")
+	}
+}
+
+func TestFileSenderWritesEML(t *testing.T) {
+	dir := t.TempDir()
+	sender, err := NewSender(Config{Driver: "file", FileDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &Message{From: "noreply@example.com", To: "alice@example.com", Subject: "hi", Text: "body"}
+	if err := sender.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || filepath.Ext(entries[0].Name()) != ".eml" {
+		t.Fatalf("expected one .eml file, got %v (%v)", entries, err)
+	}
+}
+
+func TestNewSenderRejectsUnknownDriver(t *testing.T) {
+	if _, err := NewSender(Config{Driver: "carrier-pigeon"}); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := NewSender(Config{}); err == nil {
+		t.Fatal("expected a missing driver to be rejected")
+	}
+	if _, err := NewSender(Config{Driver: "smtp"}); err == nil {
+		t.Fatal("expected smtp without host to be rejected")
+	}
+}
+
+func TestRenderTemplates(t *testing.T) {
+	subject, body, err := Render(TemplateMagicLink, MagicLinkData{
+		Username:  "alice",
+		Link:      "https://example.com/login?magic_token=tok",
+		Token:     "tok",
+		ExpiresAt: time.Now().Add(15 * time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Your gothub sign-in link" || !strings.Contains(body, "magic_token=tok") || !strings.Contains(body, "15 minutes") {
+		t.Fatalf("unexpected magic link email %q / %q", subject, body)
+	}
+
+	subject, body, err = Render(TemplateNotification, NotificationData{
+		Title:    "New comment on issue #3 in alice/repo",
+		Body:     "looks good",
+		Reason:   "mention",
+		Link:     "https://example.com/alice/repo/issues/3",
+		CanReply: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "New comment on issue #3 in alice/repo" || !strings.Contains(body, "Reply to this email") {
+		t.Fatalf("unexpected notification email %q / %q", subject, body)
+	}
+
+	subject, body, err = Render(TemplateInvitation, InvitationData{
+		Inviter:   "alice",
+		Kind:      "organization",
+		Target:    "acme",
+		Role:      "member",
+		Link:      "https://example.com/invitations/accept?token=tok",
+		ExpiresAt: time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "alice invited you to acme on gothub" || !strings.Contains(body, "token=tok") || !strings.Contains(body, "March 9, 2026") {
+		t.Fatalf("unexpected invitation email %q / %q", subject, body)
+	}
+}
+
+func TestParseInboundMultipartReply(t *testing.T) {
+	raw := "From: Alice <Alice@Example.com>\r\n" +
+		"To: reply+abc@reply.example.com\r\n" +
+		"Cc: bob@example.com\r\n" +
+		"Message-ID: <r1@example.com>\r\n" +
+		"Content-Type: multipart/alternative; boundary=b1\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"U2hpcCBpdC4KCk9uIE1vbiwgSmFuIDUsIDIwMjYgYXQgOTowMCBBTSBnb3RodWIKPG5vcmVw\r\n" +
+		"bHlAbG9jYWxob3N0PiB3cm90ZToKPiBvcmlnaW5hbAo=\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<p>Ship it.</p>\r\n" +
+		"--b1--\r\n"
+	msg, err := ParseInbound(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.From != "alice@example.com" || msg.MessageID != "<r1@example.com>" {
+		t.Fatalf("unexpected headers: %+v", msg)
+	}
+	if len(msg.Recipients) != 2 || msg.Recipients[0] != "reply+abc@reply.example.com" {
+		t.Fatalf("unexpected recipients %v", msg.Recipients)
+	}
+	if msg.Text != "Ship it." {
+		t.Fatalf("expected wrapped quote header to be stripped, got %q", msg.Text)
+	}
+
+	auto := "From: alice@example.com\r\nAuto-Submitted: auto-replied\r\n\r\nOut of office\r\n"
+	if _, err := ParseInbound(strings.NewReader(auto)); !errors.Is(err, ErrAutoReply) {
+		t.Fatalf("expected ErrAutoReply, got %v", err)
+	}
+	html := "From: alice@example.com\r\nContent-Type: text/html\r\n\r\n<p>hi</p>\r\n"
+	if _, err := ParseInbound(strings.NewReader(html)); !errors.Is(err, ErrNoPlainText) {
+		t.Fatalf("expected ErrNoPlainText, got %v", err)
+	}
+}
+
+func TestStripQuotedReply(t *testing.T) {
+	for name, tc := range map[string]struct{ in, want string }{
+		"gmail":     {"Looks good.\n\nOn Tue, Jan 6, 2026 at 10:00 AM Bob <bob@example.com> wrote:\n> old\n", "Looks good."},
+		"inline":    {"> question?\nanswer\n> another?\nsecond answer", "answer\nsecond answer"},
+		"signature": {"Thanks!\n-- \nAlice\nExample Corp", "Thanks!"},
+		"mobile":    {"On it\n\nSent from my iPhone", "On it"},
+		"outlook":   {"Merged.\n\nFrom: gothub <noreply@localhost>\nSent: Tuesday\nSubject: PR", "Merged."},
+		"original":  {"Done\r\n-----Original Message-----\r\nold", "Done"},
+	} {
+		if got := StripQuotedReply(tc.in); got != tc.want {
+			t.Errorf("%s: got %q, want %q", name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Package mail builds and delivers outbound email: login links and
+// notifications. Senders deliver one rendered message; queuing and retries
+// live with the caller.
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	ReplyTo string `json:"reply_to,omitempty"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	// MessageID, InReplyTo and References thread related messages together
+	// in mail clients. Values include the surrounding angle brackets.
+	MessageID  string            `json:"message_id,omitempty"`
+	InReplyTo  string            `json:"in_reply_to,omitempty"`
+	References []string          `json:"references,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Date       time.Time         `json:"date"`
+}
+
+// Validate checks that the message has parseable addresses and a subject.
+func (m *Message) Validate() error {
+	if m == nil {
+		return fmt.Errorf("message is nil")
+	}
+	if _, err := mail.ParseAddress(m.From); err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+	if _, err := mail.ParseAddress(m.To); err != nil {
+		return fmt.Errorf("invalid to address: %w", err)
+	}
+	if m.ReplyTo != "" {
+		if _, err := mail.ParseAddress(m.ReplyTo); err != nil {
+			return fmt.Errorf("invalid reply-to address: %w", err)
+		}
+	}
+	if strings.TrimSpace(m.Subject) == "" {
+		return fmt.Errorf("subject is required")
+	}
+	return nil
+}
+
+// Recipient returns the bare address of To, as used for the SMTP envelope.
+func (m *Message) Recipient() (string, error) {
+	addr, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return "", err
+	}
+	return addr.Address, nil
+}
+
+// Sender returns the bare address of From.
+func (m *Message) Sender() (string, error) {
+	addr, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return "", err
+	}
+	return addr.Address, nil
+}
+
+// Bytes renders the message in RFC 5322 form with a quoted-printable body.
+func (m *Message) Bytes() ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", m.From)
+	header("To", m.To)
+	if m.ReplyTo != "" {
+		header("Reply-To", m.ReplyTo)
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	if m.MessageID != "" {
+		header("Message-ID", m.MessageID)
+	}
+	if m.InReplyTo != "" {
+		header("In-Reply-To", m.InReplyTo)
+	}
+	if len(m.References) > 0 {
+		header("References", strings.Join(m.References, " "))
+	}
+	names := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header(name, m.Headers[name])
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	text := strings.ReplaceAll(m.Text, "\r\n", "\n")
+	if _, err := qp.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
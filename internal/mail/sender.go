@@ -0,0 +1,145 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sender delivers a single message. A returned error means the message was
+// not accepted and may be retried.
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Config selects and configures a Sender.
+type Config struct {
+	Driver       string // "smtp", "file" or "stdout"
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	FileDir      string // where the file driver writes .eml files
+}
+
+// NewSender builds the Sender named by cfg.Driver, which must be set.
+func NewSender(cfg Config) (Sender, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.Driver)) {
+	case "":
+		return nil, fmt.Errorf("mail driver is required")
+	case "stdout":
+		return NewWriterSender(os.Stdout), nil
+	case "file":
+		if strings.TrimSpace(cfg.FileDir) == "" {
+			return nil, fmt.Errorf("mail file driver requires a directory")
+		}
+		return NewFileSender(cfg.FileDir), nil
+	case "smtp":
+		if strings.TrimSpace(cfg.SMTPHost) == "" {
+			return nil, fmt.Errorf("mail smtp driver requires a host")
+		}
+		port := cfg.SMTPPort
+		if port <= 0 {
+			port = 587
+		}
+		return &SMTPSender{
+			Addr:     net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(port)),
+			Host:     cfg.SMTPHost,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+// SMTPSender relays messages through an SMTP server, upgrading to TLS when
+// the server offers STARTTLS.
+type SMTPSender struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	from, err := msg.Sender()
+	if err != nil {
+		return err
+	}
+	to, err := msg.Recipient()
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	return smtp.SendMail(s.Addr, auth, from, []string{to}, data)
+}
+
+// FileSender writes each message to its own .eml file in Dir.
+type FileSender struct {
+	Dir string
+}
+
+func NewFileSender(dir string) *FileSender {
+	return &FileSender{Dir: dir}
+}
+
+func (s *FileSender) Send(ctx context.Context, msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UTC().UnixNano(), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(s.Dir, name), data, 0o644)
+}
+
+// WriterSender writes messages to w separated by a delimiter line. It backs
+// the stdout driver used in development.
+type WriterSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSender(w io.Writer) *WriterSender {
+	return &WriterSender{w: w}
+}
+
+func (s *WriterSender) Send(ctx context.Context, msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.w, "----- outbound email -----\r\n%s\r\n----- end email -----\r\n", data); err != nil {
+		return err
+	}
+	return nil
+}
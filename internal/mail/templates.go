@@ -0,0 +1,156 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Template names accepted by Render.
+const (
+	TemplateMagicLink    = "magic_link"
+	TemplateNotification = "notification"
+	TemplateDigest       = "digest"
+	TemplateInvitation   = "invitation"
+)
+
+// MagicLinkData fills the magic_link template.
+type MagicLinkData struct {
+	Username  string
+	Link      string
+	Token     string
+	ExpiresAt time.Time
+}
+
+// NotificationData fills the notification template.
+type NotificationData struct {
+	Username string
+	Title    string
+	Body     string
+	Reason   string
+	Link     string
+	// CanReply notes that replying to the email posts a comment.
+	CanReply bool
+}
+
+// InvitationData fills the invitation template, sent to addresses that do
+// not have an account yet.
+type InvitationData struct {
+	Inviter   string
+	Kind      string // "repository" or "organization"
+	Target    string
+	Role      string
+	Link      string
+	ExpiresAt time.Time
+}
+
+// DigestData fills the digest template.
+type DigestData struct {
+	Username string
+	Period   string // "daily" or "weekly"
+	// Unread counts every notification in the digest.
+	Unread int
+	Repos  []DigestRepo
+	// AwaitingReview counts open pull requests waiting on the user's review
+	// and FailingChecks the user's open pull requests with failed checks.
+	AwaitingReview int
+	FailingChecks  int
+	Link           string
+	SettingsLink   string
+}
+
+// DigestRepo groups a digest's threads by repository.
+type DigestRepo struct {
+	Name    string
+	Threads []DigestThread
+}
+
+// DigestThread summarizes the notifications about one thread. Title is the
+// most recent notification's.
+type DigestThread struct {
+	Title   string
+	Link    string
+	Updates int
+}
+
+// Each template renders a subject line, a blank line, then the body.
+var templates = template.Must(template.New("mail").Funcs(template.FuncMap{
+	"minutes": func(t time.Time) int {
+		return int(time.Until(t).Round(time.Minute) / time.Minute)
+	},
+	"plural": func(n int, one, many string) string {
+		if n == 1 {
+			return "1 " + one
+		}
+		return fmt.Sprintf("%d %s", n, many)
+	},
+}).Parse(`
+{{define "magic_link"}}Your gothub sign-in link
+
+Hi {{.Username}},
+
+Use this link to sign in to gothub:
+
+{{.Link}}
+
+Or paste this code into the sign-in page:
+
+{{.Token}}
+
+The link expires in {{minutes .ExpiresAt}} minutes and can be used once.
+If you did not ask to sign in, you can ignore this email.
+{{end}}
+
+{{define "notification"}}{{.Title}}
+
+{{if .Body}}{{.Body}}
+
+{{end}}View it on gothub: {{.Link}}
+{{if .CanReply}}Reply to this email to comment.
+{{end}}
+You are receiving this because of: {{.Reason}}.
+{{end}}
+
+{{define "invitation"}}{{.Inviter}} invited you to {{.Target}} on gothub
+
+{{.Inviter}} invited you to join the {{.Kind}} {{.Target}} as {{.Role}}.
+
+Accept the invitation, creating a gothub account if you need one:
+
+{{.Link}}
+
+The invitation expires on {{.ExpiresAt.Format "January 2, 2006"}}.
+If you were not expecting it, you can ignore this email.
+{{end}}
+
+{{define "digest"}}Your {{.Period}} gothub digest{{if .Unread}}: {{.Unread}} unread{{end}}
+
+Hi {{.Username}},
+{{if .AwaitingReview}}
+{{plural .AwaitingReview "pull request is" "pull requests are"}} waiting for your review.{{end}}{{if .FailingChecks}}
+{{plural .FailingChecks "of your pull requests has" "of your pull requests have"}} failing checks.{{end}}
+{{range .Repos}}
+{{.Name}}
+{{range .Threads}}  - {{.Title}}{{if gt .Updates 1}} ({{.Updates}} updates){{end}}
+    {{.Link}}
+{{end}}{{end}}
+See all notifications: {{.Link}}
+Change how often you get email: {{.SettingsLink}}
+{{end}}
+`))
+
+// Render executes the named template and splits its output into a subject
+// and body.
+func Render(name string, data any) (subject, body string, err error) {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", "", err
+	}
+	subject, body, ok := strings.Cut(buf.String(), "\n\n")
+	if !ok {
+		return "", "", fmt.Errorf("template %q did not render a subject", name)
+	}
+	return strings.TrimSpace(subject), strings.TrimLeft(body, "\n"), nil
+}
@@ -1,14 +1,20 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type User struct {
-	ID           int64     `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	IsAdmin      bool      `json:"is_admin"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID           int64  `json:"id"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"-"`
+	IsAdmin      bool   `json:"is_admin"`
+	// SuspendedAt is set while a site admin has suspended the account. A
+	// suspended user cannot sign in or use tokens.
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
 }
 
 type MagicLinkToken struct {
@@ -20,6 +26,49 @@ type MagicLinkToken struct {
 	CreatedAt time.Time  `json:"created_at"`
 }
 
+// UserTOTP is a user's authenticator app enrollment. It counts as a second
+// factor only once ConfirmedAt is set.
+type UserTOTP struct {
+	UserID int64  `json:"user_id"`
+	Secret string `json:"-"`
+	// LastUsedStep is the time step of the last accepted code; codes from it
+	// or earlier steps are rejected.
+	LastUsedStep int64      `json:"-"`
+	ConfirmedAt  *time.Time `json:"confirmed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// TwoFactorStatus summarizes a user's second factors. Passkeys count as a
+// strong factor on their own.
+type TwoFactorStatus struct {
+	TOTPEnabled            bool `json:"totp_enabled"`
+	PasskeyEnabled         bool `json:"passkey_enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// UserIdentity links a user to an account at an OpenID Connect provider.
+type UserIdentity struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// OIDCAuthState is an in-flight OpenID Connect sign-in, keyed by the state
+// parameter sent to the provider.
+type OIDCAuthState struct {
+	State        string
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+	UsedAt       *time.Time
+	CreatedAt    time.Time
+}
+
 type SSHAuthChallenge struct {
 	ID          string     `json:"id"`
 	UserID      int64      `json:"user_id"`
@@ -39,6 +88,20 @@ type WebAuthnCredential struct {
 	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
 }
 
+// UserSession is the server-side record behind a login JWT. Revoking it
+// invalidates the JWT before it expires.
+type UserSession struct {
+	ID         string     `json:"id"`
+	UserID     int64      `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Current    bool       `json:"current"`
+}
+
 type WebAuthnSession struct {
 	ID        string     `json:"id"`
 	UserID    int64      `json:"user_id"`
@@ -59,10 +122,144 @@ type SSHKey struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// PersonalAccessToken is a user-created API and protocol credential limited
+// to Scopes and, when RepoIDs is non-empty, to those repositories. Only the
+// token hash is stored.
+type PersonalAccessToken struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Name        string     `json:"name"`
+	TokenHash   string     `json:"-"`
+	TokenPrefix string     `json:"token_prefix"`
+	ScopesCSV   string     `json:"-"`
+	Scopes      []string   `json:"scopes"`
+	RepoIDsCSV  string     `json:"-"`
+	RepoIDs     []int64    `json:"repo_ids,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// OAuthApp is a third-party application registered to request access to
+// users' accounts through the OAuth2 authorization code flow.
+type OAuthApp struct {
+	ID               int64     `json:"id"`
+	OwnerID          int64     `json:"owner_id"`
+	Name             string    `json:"name"`
+	HomepageURL      string    `json:"homepage_url,omitempty"`
+	ClientID         string    `json:"client_id"`
+	ClientSecretHash string    `json:"-"`
+	RedirectURIsCSV  string    `json:"-"`
+	RedirectURIs     []string  `json:"redirect_uris"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// OAuthAuthorizationCode is a short-lived, single-use code handed to an app
+// after the user consents.
+type OAuthAuthorizationCode struct {
+	ID            int64
+	AppID         int64
+	UserID        int64
+	CodeHash      string
+	RedirectURI   string
+	ScopesCSV     string
+	CodeChallenge string // S256 PKCE challenge; empty when the app sent none
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+	CreatedAt     time.Time
+}
+
+// OAuthToken is an access and refresh token pair issued to an app on a
+// user's behalf. Refreshing revokes the pair and issues a new one.
+type OAuthToken struct {
+	ID               int64
+	AppID            int64
+	UserID           int64
+	AccessTokenHash  string
+	RefreshTokenHash string
+	ScopesCSV        string
+	Scopes           []string
+	AccessExpiresAt  time.Time
+	RefreshExpiresAt time.Time
+	CreatedAt        time.Time
+	LastUsedAt       *time.Time
+	RevokedAt        *time.Time
+}
+
+// OAuthAuthorization records that a user has granted an app access, for
+// review and revocation in account settings.
+type OAuthAuthorization struct {
+	AppID       int64      `json:"app_id"`
+	AppName     string     `json:"app_name"`
+	ClientID    string     `json:"client_id"`
+	HomepageURL string     `json:"homepage_url,omitempty"`
+	UserID      int64      `json:"-"`
+	ScopesCSV   string     `json:"-"`
+	Scopes      []string   `json:"scopes"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+}
+
+// GPGKey is an uploaded OpenPGP public key. KeyID is the 16 hex digit ID
+// of the primary key; signatures made by any of its subkeys verify too.
+type GPGKey struct {
+	ID          int64       `json:"id"`
+	UserID      int64       `json:"user_id"`
+	KeyID       string      `json:"key_id"`
+	Fingerprint string      `json:"fingerprint"`
+	PublicKey   string      `json:"public_key"`
+	EmailsCSV   string      `json:"-"`
+	Emails      []string    `json:"emails,omitempty"`
+	Subkeys     []GPGSubkey `json:"subkeys,omitempty"`
+	ExpiresAt   *time.Time  `json:"expires_at,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+type GPGSubkey struct {
+	ID          int64      `json:"id"`
+	GPGKeyID    int64      `json:"gpg_key_id"`
+	KeyID       string     `json:"key_id"`
+	Fingerprint string     `json:"fingerprint"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// Signature verification statuses reported for commits and tags.
+const (
+	SignatureStatusUnsigned     = "unsigned"
+	SignatureStatusVerified     = "verified"
+	SignatureStatusUnknownKey   = "unknown_key"
+	SignatureStatusBadSignature = "bad_signature"
+	SignatureStatusExpiredKey   = "expired_key"
+	SignatureStatusUnsupported  = "unsupported"
+)
+
+// CommitVerification is the cached result of verifying a commit signature.
+// SignerName is filled from the signer's user row when read.
+type CommitVerification struct {
+	RepoID         int64     `json:"repo_id"`
+	CommitHash     string    `json:"commit_hash"`
+	Status         string    `json:"status"`
+	SignatureType  string    `json:"signature_type,omitempty"`
+	KeyID          string    `json:"key_id,omitempty"`
+	Fingerprint    string    `json:"fingerprint,omitempty"`
+	SignerUserID   *int64    `json:"signer_user_id,omitempty"`
+	SignerName     string    `json:"signer_name,omitempty"`
+	SignedByServer bool      `json:"signed_by_server,omitempty"`
+	VerifiedAt     time.Time `json:"verified_at"`
+}
+
 type Org struct {
 	ID          int64  `json:"id"`
 	Name        string `json:"name"`
 	DisplayName string `json:"display_name"`
+	// RequireTwoFactor limits member access to users with TOTP or a passkey.
+	RequireTwoFactor bool `json:"require_two_factor"`
+	// DefaultRepoPermission is what every member gets on the org's
+	// repositories before team grants: "none", "read" or "write".
+	DefaultRepoPermission string `json:"default_repo_permission"`
 }
 
 type OrgMember struct {
@@ -71,6 +268,30 @@ type OrgMember struct {
 	Role   string `json:"role"` // "owner", "member"
 }
 
+// Team groups org members. Members of a child team are also members of its
+// parent, so a child inherits the parent's repository grants.
+type Team struct {
+	ID          int64     `json:"id"`
+	OrgID       int64     `json:"org_id"`
+	ParentID    *int64    `json:"parent_id,omitempty"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type TeamMember struct {
+	TeamID   int64  `json:"team_id"`
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+}
+
+type TeamRepo struct {
+	TeamID     int64  `json:"team_id"`
+	RepoID     int64  `json:"repo_id"`
+	RepoName   string `json:"repo_name"`
+	Permission string `json:"permission"` // "read", "write", "admin"
+}
+
 type Repository struct {
 	ID            int64     `json:"id"`
 	OwnerUserID   *int64    `json:"owner_user_id,omitempty"`
@@ -94,6 +315,46 @@ type Collaborator struct {
 	Role   string `json:"role"` // "admin", "write", "read"
 }
 
+// Invitation offers a user, or an email address without an account, a
+// collaborator role on a repository or membership of an org. Exactly one of
+// RepoID and OrgID is set. Invitations are deleted once accepted, declined
+// or revoked.
+type Invitation struct {
+	ID          int64  `json:"id"`
+	RepoID      *int64 `json:"repo_id,omitempty"`
+	OrgID       *int64 `json:"org_id,omitempty"`
+	Target      string `json:"target"` // "owner/repo" or the org name; populated by service layer
+	InviterID   int64  `json:"inviter_id"`
+	InviterName string `json:"inviter_name"`
+	InviteeID   *int64 `json:"invitee_id,omitempty"`
+	InviteeName string `json:"invitee_name,omitempty"`
+	// Email is set for invitations to addresses without an account, which
+	// are accepted with the emailed token instead of by the invitee's ID.
+	Email     string    `json:"email,omitempty"`
+	Role      string    `json:"role"`
+	TokenHash string    `json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuditEvent records a security-relevant change. Events are never updated or
+// deleted, and keep the names of actors and targets that may since be gone.
+type AuditEvent struct {
+	ID        int64  `json:"id"`
+	ActorID   *int64 `json:"actor_id,omitempty"`
+	ActorName string `json:"actor_name,omitempty"`
+	Action    string `json:"action"` // e.g. "repo.delete", "webhook.secret_rotate"
+	Target    string `json:"target"` // e.g. "alice/repo", "alice/repo:main"
+	RepoID    *int64 `json:"repo_id,omitempty"`
+	OrgID     *int64 `json:"org_id,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// Before and After hold only the fields the change touched.
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
 const (
 	PullRequestStateOpen   = "open"
 	PullRequestStateClosed = "closed"
@@ -105,6 +366,24 @@ const (
 	IssueStateClosed = "closed"
 )
 
+const (
+	IssueReferenceSourcePullRequest = "pull_request"
+	IssueReferenceSourceIssue       = "issue"
+	IssueReferenceSourceCommit      = "commit"
+)
+
+const (
+	IssueSearchKindIssue       = "issue"
+	IssueSearchKindPullRequest = "pull_request"
+)
+
+const (
+	IssueSearchSortBest     = "best"
+	IssueSearchSortCreated  = "created"
+	IssueSearchSortUpdated  = "updated"
+	IssueSearchSortComments = "comments"
+)
+
 const (
 	ReviewStateApproved         = "approved"
 	ReviewStateChangesRequested = "changes_requested"
@@ -112,13 +391,42 @@ const (
 )
 
 const (
-	WebhookActionOpened   = "opened"
-	WebhookActionEdited   = "edited"
-	WebhookActionClosed   = "closed"
-	WebhookActionReopened = "reopened"
-	WebhookActionMerged   = "merged"
+	WebhookActionOpened    = "opened"
+	WebhookActionEdited    = "edited"
+	WebhookActionClosed    = "closed"
+	WebhookActionReopened  = "reopened"
+	WebhookActionMerged    = "merged"
+	WebhookActionCreated   = "created"
+	WebhookActionDeleted   = "deleted"
+	WebhookActionForked    = "forked"
+	WebhookActionSubmitted = "submitted"
+	WebhookActionCompleted = "completed"
+	WebhookActionAdded     = "added"
+	WebhookActionRemoved   = "removed"
+)
+
+const (
+	WebhookEventPing                     = "ping"
+	WebhookEventPullRequest              = "pull_request"
+	WebhookEventPullRequestReview        = "pull_request_review"
+	WebhookEventPullRequestReviewComment = "pull_request_review_comment"
+	WebhookEventIssues                   = "issues"
+	WebhookEventIssueComment             = "issue_comment"
+	WebhookEventCheckRun                 = "check_run"
+	WebhookEventBranchProtectionRule     = "branch_protection_rule"
+	WebhookEventRepository               = "repository"
+	WebhookEventStar                     = "star"
+	WebhookEventMember                   = "member"
 )
 
+// WebhookEventSpec describes one entry of the webhook event catalog.
+type WebhookEventSpec struct {
+	Name          string   `json:"name"`
+	SchemaVersion int      `json:"schema_version"`
+	Actions       []string `json:"actions,omitempty"`
+	Description   string   `json:"description"`
+}
+
 func IsIssueState(state string) bool {
 	switch state {
 	case IssueStateOpen, IssueStateClosed:
@@ -234,21 +542,57 @@ type RepoRunnerToken struct {
 	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
 }
 
+// RepoDeployKey is a machine credential scoped to one repository. SSH keys
+// authenticate git over SSH; token keys authenticate smart HTTP and the got
+// protocol as the HTTP Basic password.
+type RepoDeployKey struct {
+	ID              int64      `json:"id"`
+	RepoID          int64      `json:"repo_id"`
+	Name            string     `json:"name"`
+	Kind            string     `json:"kind"` // "ssh" or "token"
+	ReadOnly        bool       `json:"read_only"`
+	Fingerprint     string     `json:"fingerprint,omitempty"`
+	PublicKey       string     `json:"public_key,omitempty"`
+	KeyType         string     `json:"key_type,omitempty"`
+	TokenHash       string     `json:"-"`
+	TokenPrefix     string     `json:"token_prefix,omitempty"`
+	CreatedByUserID int64      `json:"created_by_user_id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+}
+
+const (
+	DeployKeyKindSSH   = "ssh"
+	DeployKeyKindToken = "token"
+)
+
 type Webhook struct {
-	ID        int64     `json:"id"`
-	RepoID    int64     `json:"repo_id"`
-	URL       string    `json:"url"`
-	Secret    string    `json:"-"`
-	EventsCSV string    `json:"-"`
-	Events    []string  `json:"events,omitempty"`
-	Active    bool      `json:"active"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID             int64      `json:"id"`
+	RepoID         int64      `json:"repo_id,omitempty"`
+	OrgID          int64      `json:"org_id,omitempty"` // set for org webhooks, which fire for every repo in the org
+	URL            string     `json:"url"`
+	Secret         string     `json:"-"`
+	EventsCSV      string     `json:"-"`
+	Events         []string   `json:"events,omitempty"`
+	Active         bool       `json:"active"`
+	FailingSince   *time.Time `json:"failing_since,omitempty"` // first failed delivery since the last success
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+	// PreviousSecret keeps signing deliveries until PreviousSecretExpiresAt
+	// so receivers can roll over to a rotated secret without downtime.
+	PreviousSecret          string     `json:"-"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+	TimestampedSignature    bool       `json:"timestamped_signature"`
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
 }
 
 type WebhookDelivery struct {
 	ID             int64     `json:"id"`
-	RepoID         int64     `json:"repo_id"`
+	RepoID         int64     `json:"repo_id,omitempty"`
+	OrgID          int64     `json:"org_id,omitempty"`
 	WebhookID      int64     `json:"webhook_id"`
 	Event          string    `json:"event"`
 	DeliveryUID    string    `json:"delivery_uid"`
@@ -285,6 +629,75 @@ type IssueComment struct {
 	CreatedAt  time.Time `json:"created_at"`
 }
 
+// IssueSearchQuery is a parsed issue and pull request search. Terms are
+// words or quoted phrases that must all match; Fields limits which text is
+// searched ("title", "body", "comments"; empty means all).
+type IssueSearchQuery struct {
+	RepoID     int64    `json:"repo_id"`
+	Terms      []string `json:"terms,omitempty"`
+	Fields     []string `json:"fields,omitempty"`
+	Kind       string   `json:"kind,omitempty"`  // "", "issue", "pull_request"
+	State      string   `json:"state,omitempty"` // "", "open", "closed", "merged"
+	AuthorName string   `json:"author,omitempty"`
+	Sort       string   `json:"sort"` // "best", "created", "updated", "comments"
+	Ascending  bool     `json:"ascending,omitempty"`
+	// Ignored lists qualifiers that were accepted but not applied, such as
+	// label:, which has nothing to match until issues carry labels.
+	Ignored []string `json:"ignored,omitempty"`
+}
+
+// IssueSearchResult is an issue or pull request matched by an IssueSearchQuery.
+type IssueSearchResult struct {
+	Kind         string    `json:"kind"` // "issue", "pull_request"
+	ID           int64     `json:"id"`
+	RepoID       int64     `json:"repo_id"`
+	Number       int       `json:"number"`
+	Title        string    `json:"title"`
+	Body         string    `json:"body"`
+	State        string    `json:"state"`
+	AuthorID     int64     `json:"author_id"`
+	AuthorName   string    `json:"author_name,omitempty"`
+	CommentCount int       `json:"comment_count"`
+	Score        float64   `json:"score,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// IssueReference is a cross-reference to an issue from a pull request,
+// another issue, or a pushed commit. Closing is set once the source has used
+// a closing keyword (fixes/closes/resolves) for the issue.
+type IssueReference struct {
+	ID           int64     `json:"id"`
+	RepoID       int64     `json:"repo_id"`
+	IssueID      int64     `json:"issue_id"`
+	IssueNumber  int       `json:"issue_number"`
+	SourceType   string    `json:"source_type"` // "pull_request", "issue", "commit"
+	SourceID     int64     `json:"source_id,omitempty"`
+	SourceNumber int       `json:"source_number,omitempty"`
+	CommitHash   string    `json:"commit_hash,omitempty"`
+	ActorID      int64     `json:"actor_id"`
+	ActorName    string    `json:"actor_name,omitempty"`
+	Closing      bool      `json:"closing"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// IssueEntityLink attaches an issue to a code entity by its lineage stable ID.
+// Entity and issue fields are joined in for display.
+type IssueEntityLink struct {
+	ID          int64     `json:"id"`
+	RepoID      int64     `json:"repo_id"`
+	IssueID     int64     `json:"issue_id"`
+	IssueNumber int       `json:"issue_number"`
+	IssueTitle  string    `json:"issue_title"`
+	IssueState  string    `json:"issue_state"`
+	StableID    string    `json:"stable_id"`
+	EntityName  string    `json:"entity_name,omitempty"`
+	DeclKind    string    `json:"decl_kind,omitempty"`
+	Receiver    string    `json:"receiver,omitempty"`
+	CreatorID   int64     `json:"creator_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
 type Notification struct {
 	ID           int64      `json:"id"`
 	UserID       int64      `json:"user_id"`
@@ -297,10 +710,77 @@ type Notification struct {
 	RepoID       *int64     `json:"repo_id,omitempty"`
 	PRID         *int64     `json:"pr_id,omitempty"`
 	IssueID      *int64     `json:"issue_id,omitempty"`
+	Reason       string     `json:"reason,omitempty"` // "mention", "review_requested", "author", "subscribed"
 	ReadAt       *time.Time `json:"read_at,omitempty"`
 	CreatedAt    time.Time  `json:"created_at"`
 }
 
+// Email frequencies for notification email. Instant sends each
+// notification as it happens; daily and weekly batch unread notifications
+// into one digest per period.
+const (
+	EmailFrequencyInstant = "instant"
+	EmailFrequencyDaily   = "daily"
+	EmailFrequencyWeekly  = "weekly"
+)
+
+type NotificationSettings struct {
+	UserID         int64      `json:"user_id"`
+	EmailFrequency string     `json:"email_frequency"`
+	LastDigestAt   *time.Time `json:"last_digest_at,omitempty"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+const (
+	ThreadTypeIssue       = "issue"
+	ThreadTypePullRequest = "pull_request"
+)
+
+const (
+	SubscriptionReasonMention         = "mention"
+	SubscriptionReasonManual          = "manual"
+	SubscriptionReasonComment         = "comment"
+	SubscriptionReasonReviewRequested = "review_requested"
+)
+
+const (
+	NotificationReasonMention         = "mention"
+	NotificationReasonReviewRequested = "review_requested"
+	NotificationReasonAuthor          = "author"
+	NotificationReasonSubscribed      = "subscribed"
+)
+
+// RepoWatch is a user's notification level for a repository. Users without a
+// watch row are treated as participating, except repo maintainers, who also
+// hear about newly opened issues and pull requests.
+type RepoWatch struct {
+	UserID    int64     `json:"user_id"`
+	RepoID    int64     `json:"repo_id"`
+	Level     string    `json:"level"` // "all", "participating", "ignore"
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const (
+	WatchLevelAll           = "all"
+	WatchLevelParticipating = "participating"
+	WatchLevelIgnore        = "ignore"
+)
+
+// ThreadSubscription records whether a user follows an issue or pull request
+// thread. Subscribed is false when the user has explicitly opted out.
+type ThreadSubscription struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	RepoID     int64     `json:"repo_id"`
+	ThreadType string    `json:"thread_type"` // "issue", "pull_request"
+	ThreadID   int64     `json:"thread_id"`
+	Reason     string    `json:"reason"`
+	Subscribed bool      `json:"subscribed"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
 type InterestSignup struct {
 	ID        int64     `json:"id"`
 	Email     string    `json:"email"`
@@ -345,7 +825,8 @@ type CommitMetadata struct {
 type IndexJobType string
 
 const (
-	IndexJobTypeCommitIndex IndexJobType = "commit_index"
+	IndexJobTypeCommitIndex     IndexJobType = "commit_index"
+	IndexJobTypeWebhookDelivery IndexJobType = "webhook_delivery"
 )
 
 type IndexJobStatus string
@@ -358,19 +839,47 @@ const (
 )
 
 type IndexingJob struct {
-	ID            int64          `json:"id"`
-	RepoID        int64          `json:"repo_id"`
-	CommitHash    string         `json:"commit_hash"`
-	JobType       IndexJobType   `json:"job_type"`
-	Status        IndexJobStatus `json:"status"`
-	AttemptCount  int            `json:"attempt_count"`
-	MaxAttempts   int            `json:"max_attempts"`
-	LastError     string         `json:"last_error,omitempty"`
-	NextAttemptAt time.Time      `json:"next_attempt_at"`
-	CreatedAt     time.Time      `json:"created_at"`
-	UpdatedAt     time.Time      `json:"updated_at"`
-	StartedAt     *time.Time     `json:"started_at,omitempty"`
-	CompletedAt   *time.Time     `json:"completed_at,omitempty"`
+	ID             int64          `json:"id"`
+	RepoID         int64          `json:"repo_id"`
+	CommitHash     string         `json:"commit_hash"` // job subject; the delivery UID for webhook deliveries
+	JobType        IndexJobType   `json:"job_type"`
+	ConcurrencyKey string         `json:"concurrency_key,omitempty"` // jobs sharing a key run in enqueue order
+	Payload        string         `json:"-"`
+	Status         IndexJobStatus `json:"status"`
+	AttemptCount   int            `json:"attempt_count"`
+	MaxAttempts    int            `json:"max_attempts"`
+	LastError      string         `json:"last_error,omitempty"`
+	NextAttemptAt  time.Time      `json:"next_attempt_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	StartedAt      *time.Time     `json:"started_at,omitempty"`
+	CompletedAt    *time.Time     `json:"completed_at,omitempty"`
+}
+
+type OutboundEmailStatus string
+
+const (
+	OutboundEmailQueued  OutboundEmailStatus = "queued"
+	OutboundEmailSending OutboundEmailStatus = "sending"
+	OutboundEmailSent    OutboundEmailStatus = "sent"
+	OutboundEmailFailed  OutboundEmailStatus = "failed"
+)
+
+// OutboundEmail is a message waiting in, or delivered from, the mail send
+// queue. Message holds the JSON-encoded mail.Message until the email is sent
+// or fails for good, when it is cleared.
+type OutboundEmail struct {
+	ID            int64               `json:"id"`
+	Recipient     string              `json:"recipient"`
+	Subject       string              `json:"subject"`
+	Message       string              `json:"-"`
+	Status        OutboundEmailStatus `json:"status"`
+	AttemptCount  int                 `json:"attempt_count"`
+	MaxAttempts   int                 `json:"max_attempts"`
+	LastError     string              `json:"last_error,omitempty"`
+	NextAttemptAt time.Time           `json:"next_attempt_at"`
+	CreatedAt     time.Time           `json:"created_at"`
+	SentAt        *time.Time          `json:"sent_at,omitempty"`
 }
 
 type EntityIdentity struct {
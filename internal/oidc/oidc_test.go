@@ -0,0 +1,88 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/odvcencio/gothub/internal/oidc"
+	"github.com/odvcencio/gothub/internal/oidc/oidctest"
+)
+
+const redirectURI = "https://gothub.test/login/oidc/callback"
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	ctx := context.Background()
+	idp := oidctest.NewServer("gothub", "s3cret")
+	defer idp.Close()
+	idp.SetUser(oidctest.User{Subject: "u-1", Email: "alice@corp.test", EmailVerified: true, PreferredUsername: "alice", Groups: []string{"eng"}})
+
+	provider, err := oidc.NewProvider(oidc.Config{Name: "Corp", Issuer: idp.URL + "/", ClientID: "gothub", ClientSecret: "s3cret"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.Name() != "corp" {
+		t.Fatalf("expected normalized name, got %q", provider.Name())
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := provider.AuthCodeURL(ctx, redirectURI, "state-1", "nonce-1", oidc.CodeChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	if u.Query().Get("scope") != "openid email profile" || u.Query().Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization url %s", authURL)
+	}
+
+	code, state, err := idp.Authorize(authURL)
+	if err != nil || state != "state-1" {
+		t.Fatalf("Authorize = %q, %q, %v", code, state, err)
+	}
+	if _, err := provider.Exchange(ctx, redirectURI, code, "wrong-verifier"); err == nil {
+		t.Fatal("expected exchange with the wrong PKCE verifier to fail")
+	}
+
+	code, _, _ = idp.Authorize(authURL)
+	idToken, err := provider.Exchange(ctx, redirectURI, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.VerifyIDToken(ctx, idToken, "other-nonce"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("expected nonce mismatch to be rejected, got %v", err)
+	}
+	claims, err := provider.VerifyIDToken(ctx, idToken, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "u-1" || claims.Email != "alice@corp.test" || !claims.EmailVerified ||
+		claims.PreferredUsername != "alice" || !slices.Equal(claims.Groups, []string{"eng"}) {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	// A token minted for another client must not be accepted.
+	other, err := oidc.NewProvider(oidc.Config{Name: "other", Issuer: idp.URL, ClientID: "someone-else"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.VerifyIDToken(ctx, idToken, "nonce-1"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("expected audience mismatch to be rejected, got %v", err)
+	}
+}
+
+func TestNewProviderValidatesConfig(t *testing.T) {
+	for _, cfg := range []oidc.Config{
+		{Issuer: "https://idp.test", ClientID: "id"},
+		{Name: "corp", ClientID: "id"},
+		{Name: "corp", Issuer: "not a url", ClientID: "id"},
+		{Name: "corp", Issuer: "https://idp.test"},
+	} {
+		if _, err := oidc.NewProvider(cfg, nil); err == nil {
+			t.Fatalf("expected %+v to be rejected", cfg)
+		}
+	}
+}
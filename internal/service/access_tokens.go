@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+// AccessTokenPrefix marks personal access tokens so they can be told apart
+// from session JWTs.
+const AccessTokenPrefix = "gpat_"
+
+var (
+	ErrInvalidAccessToken = errors.New("invalid access token")
+	ErrInvalidTokenScope  = errors.New("invalid token scope")
+)
+
+// AccessTokenService issues and authenticates scoped personal access tokens.
+type AccessTokenService struct {
+	db    database.DB
+	audit *AuditService
+}
+
+func NewAccessTokenService(db database.DB) *AccessTokenService {
+	return &AccessTokenService{db: db}
+}
+
+// Create issues a token for the user and returns it with the plaintext
+// value, which is not stored and cannot be recovered later.
+func (s *AccessTokenService) Create(ctx context.Context, userID int64, name string, scopes []string, repoIDs []int64, expiresAt *time.Time) (*models.PersonalAccessToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("name is required")
+	}
+	scopes, err := normalizeTokenScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", err
+	}
+	plain := AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	repoIDs = slices.Clone(repoIDs)
+	slices.Sort(repoIDs)
+	repoIDs = slices.Compact(repoIDs)
+	ids := make([]string, len(repoIDs))
+	for i, id := range repoIDs {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+
+	token := &models.PersonalAccessToken{
+		UserID:      userID,
+		Name:        name,
+		TokenHash:   hashAccessToken(plain),
+		TokenPrefix: plain[:12],
+		ScopesCSV:   strings.Join(scopes, ","),
+		RepoIDsCSV:  strings.Join(ids, ","),
+		ExpiresAt:   expiresAt,
+	}
+	if err := s.db.CreatePersonalAccessToken(ctx, token); err != nil {
+		return nil, "", err
+	}
+	expandAccessToken(token)
+	s.audit.Record(ctx, AuditEntry{Action: AuditAccessTokenCreate, Target: fmt.Sprintf("access_token/%d", token.ID), After: token})
+	return token, plain, nil
+}
+
+// SetAuditService records token creation and revocation.
+func (s *AccessTokenService) SetAuditService(audit *AuditService) {
+	s.audit = audit
+}
+
+func (s *AccessTokenService) List(ctx context.Context, userID int64) ([]models.PersonalAccessToken, error) {
+	tokens, err := s.db.ListPersonalAccessTokens(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tokens {
+		expandAccessToken(&tokens[i])
+	}
+	return tokens, nil
+}
+
+func (s *AccessTokenService) Revoke(ctx context.Context, userID, id int64) error {
+	if err := s.db.RevokePersonalAccessToken(ctx, id, userID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{Action: AuditAccessTokenRevoke, Target: fmt.Sprintf("access_token/%d", id)})
+	return nil
+}
+
+// Authenticate resolves a plaintext token into scoped claims, rejecting
+// unknown, revoked and expired tokens, and records its use.
+func (s *AccessTokenService) Authenticate(ctx context.Context, plain string) (*auth.Claims, error) {
+	token, err := s.db.GetPersonalAccessTokenByHash(ctx, hashAccessToken(plain))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidAccessToken
+		}
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if token.RevokedAt != nil || (token.ExpiresAt != nil && now.After(*token.ExpiresAt)) {
+		return nil, ErrInvalidAccessToken
+	}
+	user, err := s.db.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidAccessToken
+		}
+		return nil, err
+	}
+	if user.SuspendedAt != nil {
+		return nil, ErrInvalidAccessToken
+	}
+	_ = s.db.TouchPersonalAccessTokenUsed(ctx, token.ID, now)
+
+	expandAccessToken(token)
+	return &auth.Claims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Scopes:   token.Scopes,
+		RepoIDs:  token.RepoIDs,
+	}, nil
+}
+
+// normalizeTokenScopes validates, de-duplicates and sorts scopes. At least
+// one scope is required so a token is never mistaken for a full session.
+func normalizeTokenScopes(scopes []string) ([]string, error) {
+	out := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !slices.Contains(auth.AllScopes, scope) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTokenScope, scope)
+		}
+		if !slices.Contains(out, scope) {
+			out = append(out, scope)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidTokenScope)
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+func expandAccessToken(token *models.PersonalAccessToken) {
+	token.Scopes = []string{}
+	if token.ScopesCSV != "" {
+		token.Scopes = strings.Split(token.ScopesCSV, ",")
+	}
+	token.RepoIDs = nil
+	for _, part := range strings.Split(token.RepoIDsCSV, ",") {
+		if id, err := strconv.ParseInt(part, 10, 64); err == nil {
+			token.RepoIDs = append(token.RepoIDs, id)
+		}
+	}
+}
+
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+var (
+	ErrUserOwnsRepositories = errors.New("user still owns repositories; transfer or delete them first")
+	ErrUserSoleOrgOwner     = errors.New("user is the only owner of an organization; add another owner first")
+	ErrUnknownEntitlement   = errors.New("unknown entitlement feature")
+)
+
+// GhostUsername is the suspended placeholder account that inherits the
+// issues, pull requests and comments of deleted users.
+const GhostUsername = "ghost"
+
+// entitlementFeatures lists the features a site admin can grant.
+var entitlementFeatures = map[string]bool{
+	models.EntitlementFeaturePrivateRepos: true,
+}
+
+// AdminService carries out site administration: suspending and deleting
+// accounts, resetting credentials, promoting admins and granting
+// entitlements.
+type AdminService struct {
+	db      database.DB
+	now     func() time.Time
+	audit   *AuditService
+	sshKeys *SSHKeyService
+}
+
+func NewAdminService(db database.DB) *AdminService {
+	return &AdminService{db: db, now: time.Now, sshKeys: NewSSHKeyService(db)}
+}
+
+// SetAuditService records every administrative change.
+func (s *AdminService) SetAuditService(audit *AuditService) {
+	s.audit = audit
+}
+
+// ListUsers pages through accounts in ID order, optionally narrowed to a
+// username or email prefix.
+func (s *AdminService) ListUsers(ctx context.Context, query string, page, perPage int) ([]models.User, error) {
+	limit, offset := normalizePage(page, perPage, 50, 200)
+	return s.db.ListUsers(ctx, strings.TrimSpace(query), limit, offset)
+}
+
+// SetAdmin grants or revokes site admin rights.
+func (s *AdminService) SetAdmin(ctx context.Context, user *models.User, isAdmin bool) error {
+	if user.IsAdmin == isAdmin {
+		return nil
+	}
+	if err := s.db.SetUserAdmin(ctx, user.ID, isAdmin); err != nil {
+		return err
+	}
+	action := AuditUserAdminRevoke
+	if isAdmin {
+		action = AuditUserAdminGrant
+	}
+	s.audit.RecordUser(ctx, user, action, "", map[string]bool{"is_admin": user.IsAdmin}, map[string]bool{"is_admin": isAdmin})
+	user.IsAdmin = isAdmin
+	return nil
+}
+
+// Suspend blocks the user from signing in and ends their sessions.
+// Personal access and OAuth tokens stop working while the suspension
+// lasts.
+func (s *AdminService) Suspend(ctx context.Context, user *models.User) error {
+	if user.SuspendedAt != nil {
+		return nil
+	}
+	now := s.now().UTC()
+	if err := s.db.SetUserSuspended(ctx, user.ID, &now); err != nil {
+		return err
+	}
+	if err := s.db.RevokeUserSessions(ctx, user.ID, ""); err != nil {
+		return err
+	}
+	user.SuspendedAt = &now
+	s.audit.RecordUser(ctx, user, AuditUserSuspend, "", nil, map[string]time.Time{"suspended_at": now})
+	return nil
+}
+
+// Unsuspend lifts a suspension. The user signs in again from scratch.
+func (s *AdminService) Unsuspend(ctx context.Context, user *models.User) error {
+	if user.SuspendedAt == nil {
+		return nil
+	}
+	if err := s.db.SetUserSuspended(ctx, user.ID, nil); err != nil {
+		return err
+	}
+	s.audit.RecordUser(ctx, user, AuditUserUnsuspend, "", map[string]time.Time{"suspended_at": *user.SuspendedAt}, nil)
+	user.SuspendedAt = nil
+	return nil
+}
+
+// DeleteUser deletes the account. Its repositories must first be
+// transferred or deleted, and any org it solely owns given another owner.
+// Issues, pull requests and comments it wrote pass to the ghost account.
+func (s *AdminService) DeleteUser(ctx context.Context, user *models.User) error {
+	if user.Username == GhostUsername {
+		return fmt.Errorf("the %s account cannot be deleted", GhostUsername)
+	}
+	for _, private := range []bool{false, true} {
+		n, err := s.db.CountUserOwnedRepositoriesByVisibility(ctx, user.ID, private)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrUserOwnsRepositories
+		}
+	}
+	orgs, err := s.db.ListUserOrgs(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, org := range orgs {
+		sole, err := s.soleOwner(ctx, org.ID, user.ID)
+		if err != nil {
+			return err
+		}
+		if sole {
+			return ErrUserSoleOrgOwner
+		}
+	}
+	ghost, err := s.ghostUser(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.db.DeleteUser(ctx, user.ID, ghost.ID); err != nil {
+		return err
+	}
+	s.audit.RecordUser(ctx, user, AuditUserDelete, "", map[string]string{"email": user.Email}, nil)
+	return nil
+}
+
+func (s *AdminService) soleOwner(ctx context.Context, orgID, userID int64) (bool, error) {
+	members, err := s.db.ListOrgMembers(ctx, orgID)
+	if err != nil {
+		return false, err
+	}
+	owners, isOwner := 0, false
+	for _, m := range members {
+		if m.Role == "owner" {
+			owners++
+			isOwner = isOwner || m.UserID == userID
+		}
+	}
+	return isOwner && owners == 1, nil
+}
+
+// ghostUser returns the placeholder account, creating it suspended on
+// first use so that nobody can sign in as it.
+func (s *AdminService) ghostUser(ctx context.Context) (*models.User, error) {
+	ghost, err := s.db.GetUserByUsername(ctx, GhostUsername)
+	if err == nil {
+		if ghost.SuspendedAt == nil {
+			return nil, fmt.Errorf("the %q username belongs to an active account; suspend or rename it before deleting users", GhostUsername)
+		}
+		return ghost, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	ghost = &models.User{
+		Username:     GhostUsername,
+		Email:        GhostUsername + "@users.noreply.invalid",
+		PasswordHash: "!",
+	}
+	if err := s.db.CreateUser(ctx, ghost); err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	if err := s.db.SetUserSuspended(ctx, ghost.ID, &now); err != nil {
+		return nil, err
+	}
+	ghost.SuspendedAt = &now
+	return ghost, nil
+}
+
+// CredentialReset counts what ResetCredentials removed.
+type CredentialReset struct {
+	AccessTokens int  `json:"access_tokens"`
+	OAuthApps    int  `json:"oauth_apps"`
+	SSHKeys      int  `json:"ssh_keys"`
+	Passkeys     int  `json:"passkeys"`
+	TwoFactor    bool `json:"two_factor"`
+}
+
+// ResetCredentials signs the user out everywhere and removes every way of
+// signing in other than an emailed magic link: access tokens, OAuth
+// grants, SSH keys, passkeys and two-factor enrollment.
+func (s *AdminService) ResetCredentials(ctx context.Context, user *models.User) (*CredentialReset, error) {
+	reset := &CredentialReset{}
+	if err := s.db.RevokeUserSessions(ctx, user.ID, ""); err != nil {
+		return nil, err
+	}
+	tokens, err := s.db.ListPersonalAccessTokens(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		if t.RevokedAt != nil {
+			continue
+		}
+		if err := s.db.RevokePersonalAccessToken(ctx, t.ID, user.ID); err != nil {
+			return nil, err
+		}
+		reset.AccessTokens++
+	}
+	grants, err := s.db.ListOAuthAuthorizations(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range grants {
+		if err := s.db.DeleteOAuthAuthorization(ctx, g.AppID, user.ID); err != nil {
+			return nil, err
+		}
+		reset.OAuthApps++
+	}
+	keys, err := s.db.ListSSHKeys(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if err := s.sshKeys.Delete(ctx, user.ID, k.ID); err != nil {
+			return nil, err
+		}
+		reset.SSHKeys++
+	}
+	passkeys, err := s.db.ListWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range passkeys {
+		if err := s.db.DeleteWebAuthnCredential(ctx, c.ID, user.ID); err != nil {
+			return nil, err
+		}
+		reset.Passkeys++
+	}
+	if _, err := s.db.GetUserTOTP(ctx, user.ID); err == nil {
+		if err := s.db.DeleteUserTOTP(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		reset.TwoFactor = true
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	s.audit.RecordUser(ctx, user, AuditUserCredentialsReset, "", nil, reset)
+	return reset, nil
+}
+
+// SetEntitlement grants feature to the user, or withdraws it when active is
+// false. A nil expiresAt grants it indefinitely.
+func (s *AdminService) SetEntitlement(ctx context.Context, user *models.User, feature string, active bool, expiresAt *time.Time) (*models.UserEntitlement, error) {
+	feature = strings.TrimSpace(feature)
+	if !entitlementFeatures[feature] {
+		return nil, ErrUnknownEntitlement
+	}
+	var before *models.UserEntitlement
+	existing, err := s.db.GetUserEntitlements(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range existing {
+		if e.Feature == feature {
+			before = e
+		}
+	}
+	entitlement := &models.UserEntitlement{
+		UserID:    user.ID,
+		Feature:   feature,
+		Source:    "admin",
+		Active:    active,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.db.UpsertUserEntitlement(ctx, entitlement); err != nil {
+		return nil, err
+	}
+	s.audit.RecordUser(ctx, user, AuditUserEntitlementSet, feature, entitlementAudit(before), entitlementAudit(entitlement))
+	return entitlement, nil
+}
+
+func entitlementAudit(e *models.UserEntitlement) any {
+	if e == nil {
+		return nil
+	}
+	return map[string]any{"source": e.Source, "active": e.Active, "expires_at": e.ExpiresAt}
+}
+
+// QueueStats reports the depth of each background job queue.
+func (s *AdminService) QueueStats(ctx context.Context) ([]database.QueueStats, error) {
+	return s.db.ListQueueStats(ctx)
+}
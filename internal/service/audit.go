@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+// Audit actions. Each names the kind of target and what happened to it.
+const (
+	AuditRepoDelete              = "repo.delete"
+	AuditRepoTransfer            = "repo.transfer"
+	AuditRepoCollaboratorAdd     = "repo.collaborator.add"
+	AuditRepoCollaboratorRemove  = "repo.collaborator.remove"
+	AuditRepoInvitationCreate    = "repo.invitation.create"
+	AuditBranchProtectionCreate  = "branch_protection.create"
+	AuditBranchProtectionUpdate  = "branch_protection.update"
+	AuditBranchProtectionDelete  = "branch_protection.delete"
+	AuditRunnerTokenCreate       = "runner_token.create"
+	AuditRunnerTokenDelete       = "runner_token.delete"
+	AuditDeployKeyCreate         = "deploy_key.create"
+	AuditDeployKeyDelete         = "deploy_key.delete"
+	AuditWebhookCreate           = "webhook.create"
+	AuditWebhookUpdate           = "webhook.update"
+	AuditWebhookSecretRotate     = "webhook.secret_rotate"
+	AuditWebhookDelete           = "webhook.delete"
+	AuditOrgDelete               = "org.delete"
+	AuditOrgUpdate               = "org.update"
+	AuditOrgMemberAdd            = "org.member.add"
+	AuditOrgMemberRemove         = "org.member.remove"
+	AuditOrgInvitationCreate     = "org.invitation.create"
+	AuditTeamRepoPermissionSet   = "team.repo_permission.set"
+	AuditTeamRepoPermissionClear = "team.repo_permission.remove"
+	AuditAccessTokenCreate       = "access_token.create"
+	AuditAccessTokenRevoke       = "access_token.revoke"
+	AuditUserSuspend             = "user.suspend"
+	AuditUserUnsuspend           = "user.unsuspend"
+	AuditUserDelete              = "user.delete"
+	AuditUserCredentialsReset    = "user.credentials_reset"
+	AuditUserAdminGrant          = "user.admin.grant"
+	AuditUserAdminRevoke         = "user.admin.revoke"
+	AuditUserEntitlementSet      = "user.entitlement.set"
+)
+
+type requestInfoKey struct{}
+
+// RequestInfo identifies the HTTP request a change was made in.
+type RequestInfo struct {
+	RequestID string
+	IP        string
+}
+
+// WithRequestInfo stores the request ID and client IP that audit events
+// record for changes made under ctx.
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+func requestInfoFromContext(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info
+}
+
+// AuditService appends security-relevant changes to the audit log. A nil
+// *AuditService records nothing, so services work without one.
+type AuditService struct {
+	db  database.DB
+	now func() time.Time
+}
+
+func NewAuditService(db database.DB) *AuditService {
+	return &AuditService{db: db, now: time.Now}
+}
+
+// AuditEntry describes a change to record. Before and After are snapshots
+// of the target, marshaled to JSON objects; only the fields that differ
+// between them are kept.
+type AuditEntry struct {
+	Action string
+	Target string
+	RepoID *int64
+	OrgID  *int64
+	Before any
+	After  any
+}
+
+// Record appends entry to the audit log, attributed to the caller in ctx.
+// Failures are logged rather than returned: the change has already been
+// made by the time it is recorded.
+func (s *AuditService) Record(ctx context.Context, entry AuditEntry) {
+	if s == nil {
+		return
+	}
+	info := requestInfoFromContext(ctx)
+	event := &models.AuditEvent{
+		Action:    entry.Action,
+		Target:    entry.Target,
+		RepoID:    entry.RepoID,
+		OrgID:     entry.OrgID,
+		IP:        info.IP,
+		RequestID: info.RequestID,
+		CreatedAt: s.now().UTC(),
+	}
+	if claims := auth.GetClaims(ctx); claims != nil {
+		actorID := claims.UserID
+		event.ActorID = &actorID
+		event.ActorName = claims.Username
+	}
+	var err error
+	if event.Before, event.After, err = auditDiff(entry.Before, entry.After); err == nil {
+		err = s.db.CreateAuditEvent(ctx, event)
+	}
+	if err != nil {
+		slog.Error("record audit event", "error", err, "action", entry.Action, "target", entry.Target, "request_id", info.RequestID)
+	}
+}
+
+// RecordRepo records a change to repo, or to the part of it named by detail
+// (a branch, a webhook, a collaborator). Changes to org repositories also
+// appear in the org's log.
+func (s *AuditService) RecordRepo(ctx context.Context, repo *models.Repository, action, detail string, before, after any) {
+	if s == nil {
+		return
+	}
+	repoID := repo.ID
+	s.Record(ctx, AuditEntry{
+		Action: action,
+		Target: auditTarget(repo.OwnerName+"/"+repo.Name, detail),
+		RepoID: &repoID,
+		OrgID:  repo.OwnerOrgID,
+		Before: before,
+		After:  after,
+	})
+}
+
+// RecordRepoID is RecordRepo for callers that only have the repository ID.
+func (s *AuditService) RecordRepoID(ctx context.Context, repoID int64, action, detail string, before, after any) {
+	if s == nil {
+		return
+	}
+	repo, err := s.db.GetRepositoryByID(ctx, repoID)
+	if err != nil {
+		slog.Error("record audit event", "error", err, "action", action, "repo_id", repoID)
+		return
+	}
+	s.RecordRepo(ctx, repo, action, detail, before, after)
+}
+
+// RecordOrg records a change to org, or to the part of it named by detail.
+func (s *AuditService) RecordOrg(ctx context.Context, org *models.Org, action, detail string, before, after any) {
+	if s == nil {
+		return
+	}
+	orgID := org.ID
+	s.Record(ctx, AuditEntry{
+		Action: action,
+		Target: auditTarget(org.Name, detail),
+		OrgID:  &orgID,
+		Before: before,
+		After:  after,
+	})
+}
+
+// RecordOrgID is RecordOrg for callers that only have the org ID.
+func (s *AuditService) RecordOrgID(ctx context.Context, orgID int64, action, detail string, before, after any) {
+	if s == nil {
+		return
+	}
+	org, err := s.db.GetOrgByID(ctx, orgID)
+	if err != nil {
+		slog.Error("record audit event", "error", err, "action", action, "org_id", orgID)
+		return
+	}
+	s.RecordOrg(ctx, org, action, detail, before, after)
+}
+
+// RecordUser records a change to a user account. Account changes appear
+// only in the site-wide log.
+func (s *AuditService) RecordUser(ctx context.Context, user *models.User, action, detail string, before, after any) {
+	if s == nil {
+		return
+	}
+	s.Record(ctx, AuditEntry{
+		Action: action,
+		Target: auditTarget(user.Username, detail),
+		Before: before,
+		After:  after,
+	})
+}
+
+// List returns the events matching filter, newest first.
+func (s *AuditService) List(ctx context.Context, filter database.AuditEventFilter) ([]models.AuditEvent, error) {
+	return s.db.ListAuditEvents(ctx, filter)
+}
+
+func auditTarget(name, detail string) string {
+	if detail == "" {
+		return name
+	}
+	return name + ":" + detail
+}
+
+// auditDiff marshals before and after and drops the fields they share.
+// Either may be nil, for targets that were created or deleted.
+func auditDiff(before, after any) (json.RawMessage, json.RawMessage, error) {
+	b, err := auditFields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := auditFields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range b {
+		if av, ok := a[k]; ok && bytes.Equal(av, v) {
+			delete(a, k)
+			delete(b, k)
+		}
+	}
+	beforeJSON, err := marshalAuditFields(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterJSON, err := marshalAuditFields(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	return beforeJSON, afterJSON, nil
+}
+
+func auditFields(v any) (map[string]json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func marshalAuditFields(fields map[string]json.RawMessage) (json.RawMessage, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(fields)
+}
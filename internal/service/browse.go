@@ -10,6 +10,7 @@ import (
 
 	"github.com/odvcencio/got/pkg/object"
 	"github.com/odvcencio/gothub/internal/gotstore"
+	"github.com/odvcencio/gothub/internal/models"
 )
 
 // TreeEntry represents a file or directory in a tree listing.
@@ -39,6 +40,18 @@ type CommitInfo struct {
 	Signature string   `json:"signature,omitempty"`
 	Verified  bool     `json:"verified"`
 	Signer    string   `json:"signer,omitempty"`
+
+	Verification SignatureVerification `json:"verification"`
+}
+
+// TagInfo describes a tag for API responses. For lightweight tags Hash is
+// the tagged commit and the tag is reported unsigned.
+type TagInfo struct {
+	Name         string                `json:"name"`
+	Hash         string                `json:"hash"`
+	TargetHash   string                `json:"target_hash"`
+	Annotated    bool                  `json:"annotated"`
+	Verification SignatureVerification `json:"verification"`
 }
 
 // BlobContent holds file content for API responses.
@@ -94,6 +107,46 @@ func (s *BrowseService) ListBranches(ctx context.Context, owner, repo string) ([
 	return branches, nil
 }
 
+// GetTag returns a tag and the verification status of its signature.
+func (s *BrowseService) GetTag(ctx context.Context, owner, repo, name string) (*TagInfo, error) {
+	store, err := s.repoSvc.OpenStore(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	h, err := store.Refs.Get("tags/" + name)
+	if err != nil {
+		return nil, fmt.Errorf("tag not found: %s", name)
+	}
+	info := &TagInfo{
+		Name:         name,
+		Hash:         string(h),
+		TargetHash:   string(h),
+		Verification: SignatureVerification{Status: models.SignatureStatusUnsigned},
+	}
+	objType, data, err := store.Objects.Read(h)
+	if err != nil {
+		return nil, fmt.Errorf("read tag: %w", err)
+	}
+	if objType != object.TypeTag {
+		return info, nil
+	}
+	tag, err := object.UnmarshalTag(data)
+	if err != nil {
+		return nil, fmt.Errorf("read tag: %w", err)
+	}
+	info.Annotated = true
+	info.TargetHash = string(tag.TargetHash)
+	repoModel, err := s.repoSvc.Get(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	if v, err := verifyTagSignature(ctx, s.repoSvc.db, repoModel.ID, tag); err == nil {
+		info.Verification = v
+	}
+	info.Verification.Reason = signatureReason(info.Verification)
+	return info, nil
+}
+
 // ListTree returns the entries of a directory at the given path within a commit.
 func (s *BrowseService) ListTree(ctx context.Context, owner, repo, ref, dirPath string) ([]TreeEntry, error) {
 	store, err := s.repoSvc.OpenStore(ctx, owner, repo)
@@ -179,9 +232,9 @@ func (s *BrowseService) GetCommit(ctx context.Context, owner, repo, hash string)
 		return nil, fmt.Errorf("read commit: %w", err)
 	}
 	info := commitToInfo(hash, commit)
-	verified, signer, _ := verifyCommitSignature(ctx, s.repoSvc.db, commit)
-	info.Verified = verified
-	info.Signer = signer
+	if repoModel, err := s.repoSvc.Get(ctx, owner, repo); err == nil {
+		s.setCommitVerification(ctx, store, repoModel.ID, info, commit)
+	}
 	return info, nil
 }
 
@@ -191,6 +244,10 @@ func (s *BrowseService) ListCommits(ctx context.Context, owner, repo, ref string
 	if err != nil {
 		return nil, err
 	}
+	repoModel, err := s.repoSvc.Get(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
 	head, err := s.ResolveRef(ctx, owner, repo, ref)
 	if err != nil {
 		return nil, err
@@ -223,9 +280,7 @@ func (s *BrowseService) ListCommits(ctx context.Context, owner, repo, ref string
 			skipped++
 		} else {
 			info := commitToInfo(string(h), commit)
-			verified, signer, _ := verifyCommitSignature(ctx, s.repoSvc.db, commit)
-			info.Verified = verified
-			info.Signer = signer
+			s.setCommitVerification(ctx, store, repoModel.ID, info, commit)
 			commits = append(commits, *info)
 		}
 		for _, p := range commit.Parents {
@@ -237,6 +292,16 @@ func (s *BrowseService) ListCommits(ctx context.Context, owner, repo, ref string
 	return commits, nil
 }
 
+func (s *BrowseService) setCommitVerification(ctx context.Context, store *gotstore.RepoStore, repoID int64, info *CommitInfo, commit *object.CommitObj) {
+	v, err := s.repoSvc.verifyCommit(ctx, store.Objects, repoID, object.Hash(info.Hash), commit)
+	if err != nil {
+		return
+	}
+	info.Verification = v
+	info.Verified = v.Verified()
+	info.Signer = v.Signer
+}
+
 // FlattenTree returns all files recursively under a commit's tree.
 func (s *BrowseService) FlattenTree(ctx context.Context, owner, repo, ref string) ([]FileEntry, error) {
 	store, err := s.repoSvc.OpenStore(ctx, owner, repo)
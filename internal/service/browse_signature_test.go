@@ -209,3 +209,110 @@ func signCommitForTest(commit *object.CommitObj, signer ssh.Signer) (string, err
 	sigB64 := base64.StdEncoding.EncodeToString(sig.Blob)
 	return fmt.Sprintf("sshsig-v1:%s:%s:%s", sig.Format, pubB64, sigB64), nil
 }
+
+func TestBrowseServiceCachesCommitVerificationUntilKeyChanges(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	db, err := database.OpenSQLite(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := db.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	repoSvc := NewRepoService(db, filepath.Join(tmpDir, "repos"))
+	repo, err := repoSvc.Create(ctx, user.ID, "repo", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := repoSvc.OpenStore(ctx, "alice", "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubKeyText, signer, err := generateTestSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobHash, err := store.Objects.WriteBlob(&object.Blob{Data: []byte("package main\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	treeHash, err := store.Objects.WriteTree(&object.TreeObj{Entries: []object.TreeEntry{{Name: "main.go", BlobHash: blobHash}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := &object.CommitObj{TreeHash: treeHash, Author: "alice", Timestamp: 1700000002, Message: "signed"}
+	sig, err := signCommitForTest(commit, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit.Signature = sig
+	commitHash, err := store.Objects.WriteCommit(commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	browse := NewBrowseService(repoSvc)
+	info, err := browse.GetCommit(ctx, "alice", "repo", string(commitHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Verification.Status != models.SignatureStatusUnknownKey || info.Verification.Reason == "" {
+		t.Fatalf("expected unknown key with a reason, got %+v", info.Verification)
+	}
+	cached, err := db.GetCommitVerification(ctx, repo.ID, string(commitHash))
+	if err != nil {
+		t.Fatalf("expected cached verification: %v", err)
+	}
+
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pubKeyText))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := fmt.Sprintf("%x", md5.Sum(pubKey.Marshal()))
+	if cached.KeyID != fp {
+		t.Fatalf("expected cached key id %s, got %+v", fp, cached)
+	}
+	if _, err := NewSSHKeyService(db).Add(ctx, user.ID, "test", pubKeyText); err != nil {
+		t.Fatal(err)
+	}
+	info, err = browse.GetCommit(ctx, "alice", "repo", string(commitHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Verified || info.Verification.SignerID != user.ID || info.Verification.Fingerprint != fp {
+		t.Fatalf("expected verified commit once the key is added, got %+v", info.Verification)
+	}
+	cached, err = db.GetCommitVerification(ctx, repo.ID, string(commitHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.Status != models.SignatureStatusVerified || cached.SignerName != "alice" {
+		t.Fatalf("expected cached verified result, got %+v", cached)
+	}
+
+	// An admin credential reset deletes the key outside the user's own key
+	// endpoints and must drop the cached result as well.
+	reset, err := NewAdminService(db).ResetCredentials(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reset.SSHKeys != 1 {
+		t.Fatalf("expected one SSH key removed, got %+v", reset)
+	}
+	info, err = browse.GetCommit(ctx, "alice", "repo", string(commitHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Verified || info.Verification.Status != models.SignatureStatusUnknownKey {
+		t.Fatalf("expected unknown key after the key was removed, got %+v", info.Verification)
+	}
+}
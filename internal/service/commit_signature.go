@@ -6,53 +6,197 @@ import (
 	"crypto/md5"
 	"database/sql"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/odvcencio/got/pkg/object"
 	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/gitinterop"
+	"github.com/odvcencio/gothub/internal/models"
 	"golang.org/x/crypto/ssh"
 )
 
-func verifyCommitSignature(ctx context.Context, db database.DB, commit *object.CommitObj) (bool, string, error) {
+// Signature types reported in SignatureVerification.
+const (
+	SignatureTypeSSH = "ssh"
+	SignatureTypeGPG = "gpg"
+)
+
+// SignatureVerification is the outcome of checking a commit or tag
+// signature. KeyID is the OpenPGP key ID for GPG signatures and the key
+// fingerprint for SSH signatures; Fingerprint is the full fingerprint of the
+// registered key that made the signature.
+type SignatureVerification struct {
+	Status      string `json:"status"`
+	Reason      string `json:"reason"`
+	Type        string `json:"type,omitempty"`
+	KeyID       string `json:"key_id,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	SignerID    int64  `json:"signer_id,omitempty"`
+	Signer      string `json:"signer,omitempty"`
+	// SignedByServer is set when the signature was made with the server key
+	// rather than a user's key.
+	SignedByServer bool `json:"signed_by_server,omitempty"`
+}
+
+func (v SignatureVerification) Verified() bool {
+	return v.Status == models.SignatureStatusVerified
+}
+
+// signatureReason explains a verification status for API responses.
+func signatureReason(v SignatureVerification) string {
+	switch v.Status {
+	case models.SignatureStatusUnsigned:
+		return "no signature present"
+	case models.SignatureStatusVerified:
+		if v.SignedByServer {
+			return "signed with the gothub server key"
+		}
+		return "signature matches a key registered to " + v.Signer
+	case models.SignatureStatusUnknownKey:
+		return "signing key is not registered to any user"
+	case models.SignatureStatusBadSignature:
+		return "signature does not match the signed content"
+	case models.SignatureStatusExpiredKey:
+		return "signing key had expired when the signature was made"
+	case models.SignatureStatusUnsupported:
+		return "signature format is not supported"
+	}
+	return ""
+}
+
+// verifyCommit returns the verification result for a commit, from the
+// per-commit cache when present. Results are cached until a key they depend
+// on is added or removed.
+func (s *RepoService) verifyCommit(ctx context.Context, store *object.Store, repoID int64, hash object.Hash, commit *object.CommitObj) (SignatureVerification, error) {
+	if cached, err := s.db.GetCommitVerification(ctx, repoID, string(hash)); err == nil {
+		return verificationFromModel(cached), nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return SignatureVerification{}, err
+	}
+	v, err := s.verifyCommitSignature(ctx, store, repoID, commit)
+	if err != nil {
+		return v, err
+	}
+	v.Reason = signatureReason(v)
+	if v.SignedByServer {
+		// Server-key results depend on configuration, not on stored keys,
+		// and are cheap to recompute.
+		return v, nil
+	}
+	row := &models.CommitVerification{
+		RepoID:        repoID,
+		CommitHash:    string(hash),
+		Status:        v.Status,
+		SignatureType: v.Type,
+		KeyID:         v.KeyID,
+		Fingerprint:   v.Fingerprint,
+	}
+	if v.SignerID != 0 {
+		row.SignerUserID = &v.SignerID
+	}
+	if err := s.db.UpsertCommitVerification(ctx, row); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+func verificationFromModel(m *models.CommitVerification) SignatureVerification {
+	v := SignatureVerification{
+		Status:         m.Status,
+		Type:           m.SignatureType,
+		KeyID:          m.KeyID,
+		Fingerprint:    m.Fingerprint,
+		Signer:         m.SignerName,
+		SignedByServer: m.SignedByServer,
+	}
+	if m.SignerUserID != nil {
+		v.SignerID = *m.SignerUserID
+	}
+	v.Reason = signatureReason(v)
+	return v
+}
+
+// verifyCommitSignature checks a commit's got-native SSH signature or the
+// OpenPGP signature carried over from a git gpgsig header. OpenPGP
+// signatures made by git cover the git form of the commit, which is rebuilt
+// from the repository's hash mappings. SSH signatures made with the server
+// key are trusted without a user key.
+func (s *RepoService) verifyCommitSignature(ctx context.Context, store *object.Store, repoID int64, commit *object.CommitObj) (SignatureVerification, error) {
 	if commit == nil || strings.TrimSpace(commit.Signature) == "" {
-		return false, "", nil
+		return SignatureVerification{Status: models.SignatureStatusUnsigned}, nil
 	}
+	if strings.HasPrefix(strings.TrimSpace(commit.Signature), "-----BEGIN PGP SIGNATURE-----") {
+		gitPayload, _ := gitinterop.CommitSigningPayload(ctx, store, s.db, repoID, commit)
+		return verifyPGPSignature(ctx, s.db, commit.Signature, gitPayload, commitSigningPayloadForVerification(commit))
+	}
+	return verifySSHCommitSignature(ctx, s.db, s.serverSigner, commit)
+}
+
+func verifySSHCommitSignature(ctx context.Context, db database.DB, server *ServerSigner, commit *object.CommitObj) (SignatureVerification, error) {
+	v := SignatureVerification{Status: models.SignatureStatusUnsupported}
 	sigFormat, pubBytes, sigBlob, ok := parseSSHCommitSignature(commit.Signature)
 	if !ok {
-		return false, "", nil
+		return v, nil
 	}
+	v.Type = SignatureTypeSSH
+	v.Status = models.SignatureStatusBadSignature
 
 	pubKey, err := ssh.ParsePublicKey(pubBytes)
 	if err != nil {
-		return false, "", nil
+		return v, nil
 	}
 	payload := commitSigningPayloadForVerification(commit)
 	if err := pubKey.Verify(payload, &ssh.Signature{Format: sigFormat, Blob: sigBlob}); err != nil {
-		return false, "", nil
+		return v, nil
 	}
 
 	fp := fmt.Sprintf("%x", md5.Sum(pubKey.Marshal()))
+	v.KeyID = fp
+	if server.owns(pubKey) {
+		v.Status = models.SignatureStatusVerified
+		v.Fingerprint = fp
+		v.Signer = ServerSignerName
+		v.SignedByServer = true
+		return v, nil
+	}
+	v.Status = models.SignatureStatusUnknownKey
 	key, err := db.GetSSHKeyByFingerprint(ctx, fp)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return false, "", nil
+			return v, nil
 		}
-		return false, "", err
+		return v, err
 	}
 	storedPubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key.PublicKey))
 	if err != nil {
-		return false, "", nil
+		return v, nil
 	}
 	if !bytes.Equal(storedPubKey.Marshal(), pubKey.Marshal()) {
-		return false, "", nil
+		return v, nil
 	}
 
-	user, err := db.GetUserByID(ctx, key.UserID)
-	if err != nil {
-		return true, "", nil
+	v.Status = models.SignatureStatusVerified
+	v.Fingerprint = fp
+	v.SignerID = key.UserID
+	if user, err := db.GetUserByID(ctx, key.UserID); err == nil {
+		v.Signer = user.Username
+	}
+	return v, nil
+}
+
+// verifyTagSignature checks the OpenPGP signature embedded in an annotated
+// tag pushed through git. Tags without an embedded signature are unsigned.
+func verifyTagSignature(ctx context.Context, db database.DB, repoID int64, tag *object.TagObj) (SignatureVerification, error) {
+	payload, sig, ok := gitinterop.TagSigningPayload(ctx, db, repoID, tag)
+	if !ok {
+		return SignatureVerification{Status: models.SignatureStatusUnsigned}, nil
+	}
+	if !strings.HasPrefix(sig, "-----BEGIN PGP SIGNATURE-----") {
+		return SignatureVerification{Status: models.SignatureStatusUnsupported}, nil
 	}
-	return true, user.Username, nil
+	return verifyPGPSignature(ctx, db, sig, payload)
 }
 
 func parseSSHCommitSignature(raw string) (sigFormat string, pubBytes []byte, sigBlob []byte, ok bool) {
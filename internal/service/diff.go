@@ -15,6 +15,7 @@ import (
 	gotrepo "github.com/odvcencio/got/pkg/repo"
 	"github.com/odvcencio/gothub/internal/database"
 	"github.com/odvcencio/gothub/internal/entityutil"
+	"github.com/odvcencio/gothub/internal/models"
 )
 
 // EntityInfo represents a single entity for API responses.
@@ -42,6 +43,7 @@ type EntityChangeInfo struct {
 	Type           string      `json:"type"` // "added", "removed", "modified"
 	Classification string      `json:"classification"`
 	Key            string      `json:"key"`
+	StableID       string      `json:"stable_id,omitempty"`
 	Before         *EntityInfo `json:"before,omitempty"`
 	After          *EntityInfo `json:"after,omitempty"`
 }
@@ -64,11 +66,12 @@ type DiffSummaryCounts struct {
 
 // DiffResponse holds diffs across multiple files.
 type DiffResponse struct {
-	Base    string                `json:"base"`
-	Head    string                `json:"head"`
-	Summary DiffSummaryCounts     `json:"summary"`
-	Files   []FileDiffResponse    `json:"files"`
-	Semver  *SemverRecommendation `json:"semver,omitempty"`
+	Base         string                   `json:"base"`
+	Head         string                   `json:"head"`
+	Summary      DiffSummaryCounts        `json:"summary"`
+	Files        []FileDiffResponse       `json:"files"`
+	Semver       *SemverRecommendation    `json:"semver,omitempty"`
+	LinkedIssues []models.IssueEntityLink `json:"linked_issues,omitempty"`
 }
 
 func (r DiffResponse) MarshalJSON() ([]byte, error) {
@@ -483,6 +486,47 @@ func (s *DiffService) EntityHistory(ctx context.Context, owner, repo, ref, stabl
 	return hits, nil
 }
 
+// EntityStableIDs returns the stable IDs of entities at ref in path, which
+// may name a file or a directory.
+func (s *DiffService) EntityStableIDs(ctx context.Context, owner, repo, ref, path string) ([]string, error) {
+	path = strings.Trim(strings.TrimSpace(path), "/")
+	if path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	if s.lineageSvc == nil {
+		return nil, fmt.Errorf("entity lineage is not available")
+	}
+	store, err := s.repoSvc.OpenStore(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	repoModel, err := s.repoSvc.Get(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	head, err := s.browseSvc.ResolveRef(ctx, owner, repo, ref)
+	if err != nil {
+		return nil, fmt.Errorf("resolve ref: %w", err)
+	}
+	versions, err := s.lineageSvc.VersionsAtCommit(ctx, repoModel.ID, store, head)
+	if err != nil {
+		return nil, fmt.Errorf("lineage index: %w", err)
+	}
+	var ids []string
+	seen := make(map[string]bool)
+	for _, v := range versions {
+		if v.Path != path && !strings.HasPrefix(v.Path, path+"/") {
+			continue
+		}
+		if v.StableID == "" || seen[v.StableID] {
+			continue
+		}
+		seen[v.StableID] = true
+		ids = append(ids, v.StableID)
+	}
+	return ids, nil
+}
+
 // EntityLog returns newest-first commits that changed the selected entity key.
 // key is required. path is optional and narrows matching to a single file.
 func (s *DiffService) EntityLog(ctx context.Context, owner, repo, ref, path, key string, limit int) ([]EntityLogHit, error) {
@@ -62,6 +62,27 @@ func (s *EntityLineageService) IndexCommit(ctx context.Context, repoID int64, st
 	return walk(commitHash)
 }
 
+// VersionsAtCommit returns the entity versions recorded for commitHash,
+// indexing the commit first if it has no lineage yet.
+func (s *EntityLineageService) VersionsAtCommit(ctx context.Context, repoID int64, store *gotstore.RepoStore, commitHash object.Hash) ([]models.EntityVersion, error) {
+	has, err := s.db.HasEntityVersionsForCommit(ctx, repoID, string(commitHash))
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		if err := s.IndexCommit(ctx, repoID, store, commitHash); err != nil {
+			return nil, err
+		}
+	}
+	return s.db.ListEntityVersionsByCommit(ctx, repoID, string(commitHash))
+}
+
+// entityLineageKey identifies an entity within a commit by file path and
+// signature, matching how diff entries describe it.
+func entityLineageKey(path, name, declKind, receiver string) string {
+	return path + "\x00" + signatureKey(name, declKind, receiver)
+}
+
 func (s *EntityLineageService) indexCommitEntities(ctx context.Context, repoID int64, store *gotstore.RepoStore, commitHash object.Hash, commit *object.CommitObj) error {
 	done, err := s.db.HasEntityVersionsForCommit(ctx, repoID, string(commitHash))
 	if err == nil && done {
@@ -19,7 +19,11 @@ type ownerEntityChange struct {
 
 type gotOwnersConfig struct {
 	teams map[string][]string
-	rules []gotOwnerRule
+	// orgTeams holds the members of the org teams the rules reference as
+	// @org/team, keyed by "org/team". Such references fall back to in-file
+	// team definitions of the same name.
+	orgTeams map[string][]string
+	rules    []gotOwnerRule
 }
 
 type gotOwnerRule struct {
@@ -71,7 +75,7 @@ func parseGotOwners(data []byte) (*gotOwnersConfig, error) {
 				if member == "" {
 					return nil, fmt.Errorf(".gotowners:%d invalid team member %q", lineNo, token)
 				}
-				if strings.HasPrefix(member, "team/") {
+				if strings.HasPrefix(member, "team/") || strings.Contains(member, "/") {
 					return nil, fmt.Errorf(".gotowners:%d teams cannot include other teams", lineNo)
 				}
 				if !seenMembers[member] {
@@ -123,6 +127,13 @@ func parseOwnerRef(token string) (ownerRef, error) {
 	if strings.HasPrefix(normalized, "team/") {
 		return ownerRef{kind: ownerTeam, value: strings.TrimPrefix(normalized, "team/")}, nil
 	}
+	if strings.Contains(normalized, "/") {
+		org, team, _ := strings.Cut(normalized, "/")
+		if org == "" || team == "" || strings.Contains(team, "/") {
+			return ownerRef{}, fmt.Errorf("invalid owner token %q", token)
+		}
+		return ownerRef{kind: ownerTeam, value: normalized}, nil
+	}
 	return ownerRef{kind: ownerUser, value: normalized}, nil
 }
 
@@ -179,7 +190,10 @@ func (c *gotOwnersConfig) resolveOwners(owners []ownerRef) (resolvedUsers []stri
 		case ownerUser:
 			userSet[owner.value] = struct{}{}
 		case ownerTeam:
-			members, ok := c.teams[owner.value]
+			members, ok := c.orgTeams[owner.value]
+			if !ok || len(members) == 0 {
+				members, ok = c.teams[owner.value]
+			}
 			if !ok || len(members) == 0 {
 				teamSet[owner.value] = struct{}{}
 				continue
@@ -205,6 +219,22 @@ func (c *gotOwnersConfig) resolveOwners(owners []ownerRef) (resolvedUsers []stri
 	return resolvedUsers, unresolvedTeams
 }
 
+// orgTeamRefs lists the distinct @org/team owners referenced by the rules.
+func (c *gotOwnersConfig) orgTeamRefs() []string {
+	seen := make(map[string]bool)
+	var refs []string
+	for _, rule := range c.rules {
+		for _, owner := range rule.owners {
+			if owner.kind == ownerTeam && strings.Contains(owner.value, "/") && !seen[owner.value] {
+				seen[owner.value] = true
+				refs = append(refs, owner.value)
+			}
+		}
+	}
+	sort.Strings(refs)
+	return refs
+}
+
 func selectorMatches(selector string, ch ownerEntityChange) bool {
 	selector = strings.TrimSpace(selector)
 	if selector == "" {
@@ -36,6 +36,36 @@ func:ProcessOrder @team/backend
 	}
 }
 
+func TestGotOwnersOrgTeamsFallBackToFileTeams(t *testing.T) {
+	cfg, err := parseGotOwners([]byte(`
+team acme/web @dave
+func:ProcessOrder @acme/core @acme/web @acme/ghost
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := cfg.orgTeamRefs(); !reflect.DeepEqual(refs, []string{"acme/core", "acme/ghost", "acme/web"}) {
+		t.Fatalf("unexpected org team refs %v", refs)
+	}
+	cfg.orgTeams = map[string][]string{"acme/core": {"alice", "bob"}}
+
+	owners := cfg.ownersForChange(ownerEntityChange{Path: "main.go", Name: "ProcessOrder", DeclKind: "function_definition"})
+	users, unresolved := cfg.resolveOwners(owners)
+	if want := []string{"alice", "bob", "dave"}; !reflect.DeepEqual(users, want) {
+		t.Fatalf("unexpected users: got %v want %v", users, want)
+	}
+	if want := []string{"acme/ghost"}; !reflect.DeepEqual(unresolved, want) {
+		t.Fatalf("unexpected unresolved teams: got %v want %v", unresolved, want)
+	}
+	if got := formatTeamRefs(append(unresolved, "backend")); got != "@acme/ghost, @team/backend" {
+		t.Fatalf("formatTeamRefs = %q", got)
+	}
+
+	if _, err := parseGotOwners([]byte("* @acme/core/extra\n")); err == nil {
+		t.Fatal("expected nested team path to be rejected")
+	}
+}
+
 func TestSelectorMatchesPathAndKinds(t *testing.T) {
 	funcChange := ownerEntityChange{
 		Path:     "pkg/order/main.go",
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+var ErrInvalidGPGKey = errors.New("invalid OpenPGP public key")
+
+// GPGKeyService manages the OpenPGP public keys users upload to have their
+// commit and tag signatures verified.
+type GPGKeyService struct {
+	db database.DB
+}
+
+func NewGPGKeyService(db database.DB) *GPGKeyService {
+	return &GPGKeyService{db: db}
+}
+
+// Add parses an armored public key and stores it, with its subkeys, for the
+// user.
+func (s *GPGKeyService) Add(ctx context.Context, userID int64, armored string) (*models.GPGKey, error) {
+	key, err := ParseGPGPublicKey(armored)
+	if err != nil {
+		return nil, err
+	}
+	key.UserID = userID
+	if err := s.db.CreateGPGKey(ctx, key); err != nil {
+		return nil, err
+	}
+	if err := s.db.DeleteCommitVerificationsByKeyIDs(ctx, gpgKeyIDs(key)); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *GPGKeyService) List(ctx context.Context, userID int64) ([]models.GPGKey, error) {
+	keys, err := s.db.ListGPGKeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		keys[i].Emails = splitGPGEmails(keys[i].EmailsCSV)
+	}
+	return keys, nil
+}
+
+func (s *GPGKeyService) Delete(ctx context.Context, userID, id int64) error {
+	keys, err := s.db.ListGPGKeys(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.db.DeleteGPGKey(ctx, id, userID); err != nil {
+		return err
+	}
+	for i := range keys {
+		if keys[i].ID == id {
+			return s.db.DeleteCommitVerificationsByKeyIDs(ctx, gpgKeyIDs(&keys[i]))
+		}
+	}
+	return nil
+}
+
+// gpgKeyIDs returns the IDs of a key and its subkeys, under which cached
+// commit verifications are recorded.
+func gpgKeyIDs(key *models.GPGKey) []string {
+	ids := []string{key.KeyID}
+	for _, sub := range key.Subkeys {
+		ids = append(ids, sub.KeyID)
+	}
+	return ids
+}
+
+// ParseGPGPublicKey parses a single armored OpenPGP public key. Key IDs and
+// fingerprints are upper-case hex; expiry comes from the self-signatures.
+func ParseGPGPublicKey(armored string) (*models.GPGKey, error) {
+	armored = strings.TrimSpace(armored)
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armored))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGPGKey, err)
+	}
+	if len(entities) != 1 {
+		return nil, fmt.Errorf("%w: expected exactly one key, got %d", ErrInvalidGPGKey, len(entities))
+	}
+	entity := entities[0]
+	if entity.PrivateKey != nil {
+		return nil, fmt.Errorf("%w: private keys are not accepted", ErrInvalidGPGKey)
+	}
+
+	key := &models.GPGKey{
+		KeyID:       gpgKeyID(entity.PrimaryKey.KeyId),
+		Fingerprint: fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint),
+		PublicKey:   armored,
+	}
+	seen := make(map[string]bool)
+	for _, ident := range entity.Identities {
+		if ident.UserId == nil || ident.UserId.Email == "" || seen[strings.ToLower(ident.UserId.Email)] {
+			continue
+		}
+		seen[strings.ToLower(ident.UserId.Email)] = true
+		key.Emails = append(key.Emails, ident.UserId.Email)
+	}
+	sort.Strings(key.Emails)
+	key.EmailsCSV = strings.Join(key.Emails, ",")
+	if ident := primaryGPGIdentity(entity); ident != nil && ident.SelfSignature != nil {
+		key.ExpiresAt = gpgKeyExpiry(entity.PrimaryKey.CreationTime, ident.SelfSignature.KeyLifetimeSecs)
+	}
+	for _, sub := range entity.Subkeys {
+		subkey := models.GPGSubkey{
+			KeyID:       gpgKeyID(sub.PublicKey.KeyId),
+			Fingerprint: fmt.Sprintf("%X", sub.PublicKey.Fingerprint),
+		}
+		if sub.Sig != nil {
+			subkey.ExpiresAt = gpgKeyExpiry(sub.PublicKey.CreationTime, sub.Sig.KeyLifetimeSecs)
+		}
+		key.Subkeys = append(key.Subkeys, subkey)
+	}
+	return key, nil
+}
+
+// primaryGPGIdentity returns the identity flagged as primary, or the first
+// by name when none is.
+func primaryGPGIdentity(entity *openpgp.Entity) *openpgp.Identity {
+	names := make([]string, 0, len(entity.Identities))
+	for name, ident := range entity.Identities {
+		if ident.SelfSignature != nil && ident.SelfSignature.IsPrimaryId != nil && *ident.SelfSignature.IsPrimaryId {
+			return ident
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return entity.Identities[names[0]]
+}
+
+func gpgKeyID(id uint64) string {
+	return fmt.Sprintf("%016X", id)
+}
+
+func gpgKeyExpiry(created time.Time, lifetimeSecs *uint32) *time.Time {
+	if lifetimeSecs == nil || *lifetimeSecs == 0 {
+		return nil
+	}
+	expires := created.Add(time.Duration(*lifetimeSecs) * time.Second).UTC()
+	return &expires
+}
+
+func splitGPGEmails(csv string) []string {
+	if csv == "" {
+		return nil
+	}
+	return strings.Split(csv, ",")
+}
+
+// verifyPGPSignature checks an armored detached OpenPGP signature against
+// each candidate payload in turn. A signature made after the signing key or
+// subkey expired reports expired_key even when it is cryptographically valid.
+func verifyPGPSignature(ctx context.Context, db database.DB, armoredSig string, payloads ...[]byte) (SignatureVerification, error) {
+	v := SignatureVerification{Status: models.SignatureStatusBadSignature, Type: SignatureTypeGPG}
+	issuer, signedAt, ok := parsePGPSignature(armoredSig)
+	if !ok {
+		return v, nil
+	}
+	v.KeyID = gpgKeyID(issuer)
+
+	key, err := db.GetGPGKeyByKeyID(ctx, v.KeyID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			v.Status = models.SignatureStatusUnknownKey
+			return v, nil
+		}
+		return v, err
+	}
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key.PublicKey))
+	if err != nil {
+		v.Status = models.SignatureStatusUnknownKey
+		return v, nil
+	}
+
+	valid := false
+	for _, payload := range payloads {
+		if payload == nil {
+			continue
+		}
+		if _, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(payload), strings.NewReader(armoredSig)); err == nil {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return v, nil
+	}
+
+	v.Status = models.SignatureStatusVerified
+	if gpgKeyExpiredAt(key, v.KeyID, signedAt) {
+		v.Status = models.SignatureStatusExpiredKey
+	}
+	v.Fingerprint = gpgSigningFingerprint(key, v.KeyID)
+	v.SignerID = key.UserID
+	if user, err := db.GetUserByID(ctx, key.UserID); err == nil {
+		v.Signer = user.Username
+	}
+	return v, nil
+}
+
+// parsePGPSignature returns the issuer key ID and creation time of an
+// armored signature.
+func parsePGPSignature(armoredSig string) (issuer uint64, created time.Time, ok bool) {
+	block, err := armor.Decode(strings.NewReader(armoredSig))
+	if err != nil || block.Type != openpgp.SignatureType {
+		return 0, time.Time{}, false
+	}
+	p, err := packet.NewReader(block.Body).Next()
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	switch sig := p.(type) {
+	case *packet.Signature:
+		if sig.IssuerKeyId == nil {
+			return 0, time.Time{}, false
+		}
+		return *sig.IssuerKeyId, sig.CreationTime, true
+	case *packet.SignatureV3:
+		return sig.IssuerKeyId, sig.CreationTime, true
+	}
+	return 0, time.Time{}, false
+}
+
+// gpgSigningFingerprint returns the fingerprint of the primary key or subkey
+// with the given key ID.
+func gpgSigningFingerprint(key *models.GPGKey, keyID string) string {
+	for _, sub := range key.Subkeys {
+		if sub.KeyID == keyID {
+			return sub.Fingerprint
+		}
+	}
+	return key.Fingerprint
+}
+
+func gpgKeyExpiredAt(key *models.GPGKey, keyID string, at time.Time) bool {
+	if key.ExpiresAt != nil && !at.Before(*key.ExpiresAt) {
+		return true
+	}
+	for _, sub := range key.Subkeys {
+		if sub.KeyID == keyID && sub.ExpiresAt != nil && !at.Before(*sub.ExpiresAt) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odvcencio/got/pkg/object"
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/gitinterop"
+	"github.com/odvcencio/gothub/internal/models"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestBrowseServiceVerifiesGPGSignedGitCommit(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	db, err := database.OpenSQLite(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := db.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	repoSvc := NewRepoService(db, filepath.Join(tmpDir, "repos"))
+	repo, err := repoSvc.Create(ctx, user.ID, "repo", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := repoSvc.OpenStore(ctx, "alice", "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entity, armoredKey := generateTestGPGEntity(t)
+
+	// Simulate a commit pushed through git: its tree has a git hash mapping
+	// and the gpgsig covers the git form of the commit.
+	blobHash, err := store.Objects.WriteBlob(&object.Blob{Data: []byte("package main\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	treeHash, err := store.Objects.WriteTree(&object.TreeObj{Entries: []object.TreeEntry{{Name: "main.go", BlobHash: blobHash}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetHashMapping(ctx, &models.HashMapping{
+		RepoID: repo.ID, GitHash: strings.Repeat("1", 40), GotHash: string(treeHash), ObjectType: "tree",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	commit := &object.CommitObj{
+		TreeHash:           treeHash,
+		Author:             "Alice <alice@example.com>",
+		Timestamp:          1700000000,
+		AuthorTimezone:     "+0000",
+		Committer:          "Alice <alice@example.com>",
+		CommitterTimestamp: 1700000000,
+		CommitterTimezone:  "+0000",
+		Message:            "signed\n",
+	}
+	payload, ok := gitinterop.CommitSigningPayload(ctx, store.Objects, db, repo.ID, commit)
+	if !ok {
+		t.Fatal("expected git signing payload")
+	}
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, entity, bytes.NewReader(payload), nil); err != nil {
+		t.Fatal(err)
+	}
+	commit.Signature = sig.String()
+	commitHash, err := store.Objects.WriteCommit(commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := *commit
+	tampered.Message = "tampered\n"
+	tamperedHash, err := store.Objects.WriteCommit(&tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	browse := NewBrowseService(repoSvc)
+	expectStatus := func(hash object.Hash, want string) *CommitInfo {
+		t.Helper()
+		info, err := browse.GetCommit(ctx, "alice", "repo", string(hash))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Verification.Status != want || info.Verification.Type != SignatureTypeGPG {
+			t.Fatalf("expected %s gpg verification, got %+v", want, info.Verification)
+		}
+		if info.Verified != (want == models.SignatureStatusVerified) {
+			t.Fatalf("verified flag disagrees with status %s", want)
+		}
+		return info
+	}
+
+	expectStatus(commitHash, models.SignatureStatusUnknownKey)
+
+	gpgSvc := NewGPGKeyService(db)
+	key, err := ParseGPGPublicKey(armoredKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := time.Now().Add(-time.Hour)
+	key.UserID = user.ID
+	key.ExpiresAt = &expired
+	if err := db.CreateGPGKey(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteCommitVerificationsByKeyIDs(ctx, gpgKeyIDs(key)); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(commitHash, models.SignatureStatusExpiredKey)
+	if err := gpgSvc.Delete(ctx, user.ID, key.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := gpgSvc.Add(ctx, user.ID, armoredKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added.Subkeys) != 1 || len(added.KeyID) != 16 || len(added.Fingerprint) != 40 {
+		t.Fatalf("unexpected parsed key %+v", added)
+	}
+	keys, err := gpgSvc.List(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || len(keys[0].Emails) != 1 || keys[0].Emails[0] != "alice@example.com" {
+		t.Fatalf("unexpected listed keys %+v", keys)
+	}
+
+	info := expectStatus(commitHash, models.SignatureStatusVerified)
+	if info.Signer != "alice" || info.Verification.SignerID != user.ID || info.Verification.KeyID != added.KeyID || info.Verification.Fingerprint != added.Fingerprint {
+		t.Fatalf("expected signature by alice, got %+v", info.Verification)
+	}
+	expectStatus(tamperedHash, models.SignatureStatusBadSignature)
+}
+
+func TestParseGPGPublicKeyRejectsInvalidKeys(t *testing.T) {
+	for _, input := range []string{"", "not a key", "-----BEGIN PGP PUBLIC KEY BLOCK-----\n\n-----END PGP PUBLIC KEY BLOCK-----"} {
+		if _, err := ParseGPGPublicKey(input); err == nil {
+			t.Fatalf("expected %q to be rejected", input)
+		}
+	}
+}
+
+func generateTestGPGEntity(t *testing.T) (*openpgp.Entity, string) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("Alice", "", "alice@example.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return entity, buf.String()
+}
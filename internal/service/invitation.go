@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvitationExpired  = errors.New("invitation has expired")
+	ErrInvalidInvitation  = errors.New("invalid invitation")
+	ErrInviteeNotFound    = errors.New("user not found")
+	ErrAlreadyMember      = errors.New("user already has access")
+)
+
+// invitationTTL is how long an invitation can be accepted.
+const invitationTTL = 7 * 24 * time.Hour
+
+// InvitationService invites users, by username or email address, to
+// collaborate on a repository or join an org. Access is granted only once
+// the invitee accepts.
+type InvitationService struct {
+	db        database.DB
+	notifySvc *NotificationService
+	mailSvc   *MailService
+	audit     *AuditService
+	now       func() time.Time
+}
+
+func NewInvitationService(db database.DB) *InvitationService {
+	return &InvitationService{db: db, now: time.Now}
+}
+
+// SetNotificationService notifies invitees who have an account.
+func (s *InvitationService) SetNotificationService(notifySvc *NotificationService) {
+	s.notifySvc = notifySvc
+}
+
+// SetMailService emails invitations to addresses without an account.
+func (s *InvitationService) SetMailService(mailSvc *MailService) {
+	s.mailSvc = mailSvc
+}
+
+// SetAuditService records invitations and the access granted when they are
+// accepted.
+func (s *InvitationService) SetAuditService(audit *AuditService) {
+	s.audit = audit
+}
+
+// InviteToRepo invites the user named username, or the owner of email, to
+// collaborate on repo with role. Exactly one of username and email is set.
+func (s *InvitationService) InviteToRepo(ctx context.Context, repo *models.Repository, inviterID int64, username, email, role string) (*models.Invitation, error) {
+	inv := &models.Invitation{RepoID: &repo.ID, InviterID: inviterID, Role: role}
+	return s.invite(ctx, inv, username, email)
+}
+
+// InviteToOrg invites the user named username, or the owner of email, to
+// join org with role. Exactly one of username and email is set.
+func (s *InvitationService) InviteToOrg(ctx context.Context, org *models.Org, inviterID int64, username, email, role string) (*models.Invitation, error) {
+	inv := &models.Invitation{OrgID: &org.ID, InviterID: inviterID, Role: role}
+	return s.invite(ctx, inv, username, email)
+}
+
+func (s *InvitationService) invite(ctx context.Context, inv *models.Invitation, username, email string) (*models.Invitation, error) {
+	username = strings.TrimSpace(username)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if (username == "") == (email == "") {
+		return nil, fmt.Errorf("%w: give either a username or an email", ErrInvalidInvitation)
+	}
+	var invitee *models.User
+	var err error
+	if username != "" {
+		if invitee, err = s.db.GetUserByUsername(ctx, username); errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInviteeNotFound
+		}
+	} else {
+		if addr, perr := mail.ParseAddress(email); perr != nil || addr.Address != email {
+			return nil, fmt.Errorf("%w: invalid email address", ErrInvalidInvitation)
+		}
+		// An address that belongs to an account is invited as that account,
+		// but only once the account has proven it owns the address. Anyone
+		// can register with an unverified address, so otherwise the
+		// invitation goes to the address itself.
+		if invitee, err = s.db.GetUserByEmail(ctx, email); errors.Is(err, sql.ErrNoRows) {
+			invitee, err = nil, nil
+		} else if err == nil {
+			var verified bool
+			if verified, err = s.db.HasVerifiedEmail(ctx, invitee.ID); err == nil && !verified {
+				invitee = nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now().UTC()
+	inv.CreatedAt = now
+	inv.ExpiresAt = now.Add(invitationTTL)
+	var token string
+	if invitee != nil {
+		if has, err := s.hasAccess(ctx, inv, invitee.ID); err != nil {
+			return nil, err
+		} else if has {
+			return nil, ErrAlreadyMember
+		}
+		inv.InviteeID = &invitee.ID
+	} else {
+		inv.Email = email
+		if token, err = newInvitationToken(); err != nil {
+			return nil, err
+		}
+		inv.TokenHash = hashInvitationToken(token)
+	}
+	// A new invitation replaces any pending one for the same person.
+	pending, err := s.listForTarget(ctx, inv)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pending {
+		if (invitee != nil && p.InviteeID != nil && *p.InviteeID == invitee.ID) || (invitee == nil && p.Email == email) {
+			if err := s.Delete(ctx, &p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := s.db.CreateInvitation(ctx, inv); err != nil {
+		return nil, err
+	}
+	created, err := s.get(ctx, inv.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.recordAudit(ctx, created, AuditRepoInvitationCreate, AuditOrgInvitationCreate, inviteeLabel(created), nil, created)
+
+	if invitee != nil {
+		if s.notifySvc != nil {
+			if err := s.notifySvc.NotifyInvitation(ctx, created); err != nil {
+				slog.Error("notify invitation", "error", err, "invitation_id", created.ID)
+			}
+		}
+	} else if s.mailSvc != nil {
+		if err := s.mailSvc.SendInvitation(ctx, created, invitationKind(created), token); err != nil {
+			return nil, err
+		}
+	}
+	return created, nil
+}
+
+// Get returns an invitation with its target filled in.
+func (s *InvitationService) Get(ctx context.Context, id int64) (*models.Invitation, error) {
+	return s.get(ctx, id)
+}
+
+// GetByToken returns the pending email invitation that token accepts.
+func (s *InvitationService) GetByToken(ctx context.Context, token string) (*models.Invitation, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, ErrInvitationNotFound
+	}
+	inv, err := s.db.GetInvitationByTokenHash(ctx, hashInvitationToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !s.now().Before(inv.ExpiresAt) {
+		return nil, ErrInvitationExpired
+	}
+	if err := s.fillTarget(ctx, inv); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func (s *InvitationService) ListForRepo(ctx context.Context, repoID int64) ([]models.Invitation, error) {
+	invs, err := s.db.ListRepoInvitations(ctx, repoID, s.now().UTC())
+	return s.fillTargets(ctx, invs, err)
+}
+
+func (s *InvitationService) ListForOrg(ctx context.Context, orgID int64) ([]models.Invitation, error) {
+	invs, err := s.db.ListOrgInvitations(ctx, orgID, s.now().UTC())
+	return s.fillTargets(ctx, invs, err)
+}
+
+// ListForUser returns the pending invitations addressed to userID.
+func (s *InvitationService) ListForUser(ctx context.Context, userID int64) ([]models.Invitation, error) {
+	invs, err := s.db.ListUserInvitations(ctx, userID, s.now().UTC())
+	return s.fillTargets(ctx, invs, err)
+}
+
+// Accept grants the invitation's access to userID and deletes it. Callers
+// check that userID may accept it: the invitee of an account invitation, or
+// whoever holds the token of an email invitation.
+func (s *InvitationService) Accept(ctx context.Context, inv *models.Invitation, userID int64) error {
+	if !s.now().Before(inv.ExpiresAt) {
+		return ErrInvitationExpired
+	}
+	if has, err := s.hasAccess(ctx, inv, userID); err != nil {
+		return err
+	} else if !has {
+		if inv.RepoID != nil {
+			err = s.db.AddCollaborator(ctx, &models.Collaborator{RepoID: *inv.RepoID, UserID: userID, Role: inv.Role})
+		} else {
+			err = s.db.AddOrgMember(ctx, &models.OrgMember{OrgID: *inv.OrgID, UserID: userID, Role: inv.Role})
+		}
+		if err != nil {
+			return err
+		}
+		if s.audit != nil {
+			user, err := s.db.GetUserByID(ctx, userID)
+			if err != nil {
+				return err
+			}
+			s.recordAudit(ctx, inv, AuditRepoCollaboratorAdd, AuditOrgMemberAdd, user.Username, nil, map[string]string{"role": inv.Role})
+		}
+	}
+	return s.Delete(ctx, inv)
+}
+
+// Delete removes an invitation, whether the invitee declined it or an
+// admin revoked it, along with the invitee's notification about it.
+func (s *InvitationService) Delete(ctx context.Context, inv *models.Invitation) error {
+	if err := s.db.DeleteInvitation(ctx, inv.ID); err != nil {
+		return err
+	}
+	if s.notifySvc != nil {
+		return s.notifySvc.WithdrawInvitation(ctx, inv)
+	}
+	return nil
+}
+
+// hasAccess reports whether userID already holds what inv offers: any
+// collaborator role or ownership for a repository, membership for an org.
+func (s *InvitationService) hasAccess(ctx context.Context, inv *models.Invitation, userID int64) (bool, error) {
+	var err error
+	if inv.RepoID != nil {
+		var repo *models.Repository
+		if repo, err = s.db.GetRepositoryByID(ctx, *inv.RepoID); err != nil {
+			return false, err
+		}
+		if repo.OwnerUserID != nil && *repo.OwnerUserID == userID {
+			return true, nil
+		}
+		_, err = s.db.GetCollaborator(ctx, *inv.RepoID, userID)
+	} else {
+		_, err = s.db.GetOrgMember(ctx, *inv.OrgID, userID)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *InvitationService) listForTarget(ctx context.Context, inv *models.Invitation) ([]models.Invitation, error) {
+	if inv.RepoID != nil {
+		return s.db.ListRepoInvitations(ctx, *inv.RepoID, s.now().UTC())
+	}
+	return s.db.ListOrgInvitations(ctx, *inv.OrgID, s.now().UTC())
+}
+
+func (s *InvitationService) get(ctx context.Context, id int64) (*models.Invitation, error) {
+	inv, err := s.db.GetInvitation(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.fillTarget(ctx, inv); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func (s *InvitationService) fillTargets(ctx context.Context, invs []models.Invitation, err error) ([]models.Invitation, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i := range invs {
+		if err := s.fillTarget(ctx, &invs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return invs, nil
+}
+
+func (s *InvitationService) fillTarget(ctx context.Context, inv *models.Invitation) error {
+	if inv.OrgID != nil {
+		org, err := s.db.GetOrgByID(ctx, *inv.OrgID)
+		if err != nil {
+			return err
+		}
+		inv.Target = org.Name
+		return nil
+	}
+	repo, err := s.db.GetRepositoryByID(ctx, *inv.RepoID)
+	if err != nil {
+		return err
+	}
+	inv.Target = repo.OwnerName + "/" + repo.Name
+	return nil
+}
+
+// recordAudit records a change to inv's repository with repoAction, or to
+// its org with orgAction.
+func (s *InvitationService) recordAudit(ctx context.Context, inv *models.Invitation, repoAction, orgAction, detail string, before, after any) {
+	if inv.RepoID != nil {
+		s.audit.RecordRepoID(ctx, *inv.RepoID, repoAction, detail, before, after)
+		return
+	}
+	s.audit.RecordOrgID(ctx, *inv.OrgID, orgAction, detail, before, after)
+}
+
+func inviteeLabel(inv *models.Invitation) string {
+	if inv.InviteeName != "" {
+		return inv.InviteeName
+	}
+	return inv.Email
+}
+
+func invitationKind(inv *models.Invitation) string {
+	if inv.OrgID != nil {
+		return "organization"
+	}
+	return "repository"
+}
+
+func newInvitationToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
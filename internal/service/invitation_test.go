@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+func TestInvitationLifecycle(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	users := map[string]*models.User{}
+	for _, name := range []string{"alice", "bob"} {
+		u := &models.User{Username: name, Email: name + "@example.com", PasswordHash: "x"}
+		if err := db.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+		users[name] = u
+	}
+	alice, bob := users["alice"], users["bob"]
+	repo := &models.Repository{OwnerUserID: &alice.ID, Name: "repo", DefaultBranch: "main", StoragePath: "alice/repo"}
+	if err := db.CreateRepository(ctx, repo); err != nil {
+		t.Fatal(err)
+	}
+	acme := &models.Org{Name: "acme"}
+	if err := db.CreateOrg(ctx, acme); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewInvitationService(db)
+	svc.now = func() time.Time { return now }
+	notifySvc := NewNotificationService(db)
+	svc.SetNotificationService(notifySvc)
+
+	if _, err := svc.InviteToRepo(ctx, repo, alice.ID, "alice", "", "write"); !errors.Is(err, ErrAlreadyMember) {
+		t.Fatalf("expected owner invite to be rejected, got %v", err)
+	}
+	if _, err := svc.InviteToRepo(ctx, repo, alice.ID, "nobody", "", "write"); !errors.Is(err, ErrInviteeNotFound) {
+		t.Fatalf("expected unknown user, got %v", err)
+	}
+	if _, err := svc.InviteToRepo(ctx, repo, alice.ID, "bob", "bob@example.com", "write"); !errors.Is(err, ErrInvalidInvitation) {
+		t.Fatalf("expected username and email to be exclusive, got %v", err)
+	}
+
+	// Until bob's account proves it owns the address, an invitation to the
+	// address goes to the address rather than to the account.
+	unverified, err := svc.InviteToRepo(ctx, repo, alice.ID, "", "bob@example.com", "write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unverified.InviteeID != nil || unverified.Email != "bob@example.com" || unverified.TokenHash == "" {
+		t.Fatalf("expected an address invitation for an unverified account, got %+v", unverified)
+	}
+	if err := svc.Delete(ctx, unverified); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateMagicLinkToken(ctx, &models.MagicLinkToken{UserID: bob.ID, TokenHash: "bob-token", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ConsumeMagicLinkToken(ctx, "bob-token", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Inviting again replaces the pending invitation.
+	if _, err := svc.InviteToRepo(ctx, repo, alice.ID, "bob", "", "read"); err != nil {
+		t.Fatal(err)
+	}
+	inv, err := svc.InviteToRepo(ctx, repo, alice.ID, "", "BOB@example.com", "write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.InviteeID == nil || *inv.InviteeID != bob.ID || inv.Email != "" || inv.Target != "alice/repo" || inv.InviterName != "alice" {
+		t.Fatalf("expected an account invitation for bob, got %+v", inv)
+	}
+	pending, err := svc.ListForUser(ctx, bob.ID)
+	if err != nil || len(pending) != 1 || pending[0].Role != "write" {
+		t.Fatalf("ListForUser = %+v %v", pending, err)
+	}
+	notes, err := db.ListNotifications(ctx, bob.ID, false)
+	if err != nil || len(notes) != 1 || notes[0].Type != "invitation" {
+		t.Fatalf("expected one invitation notification, got %+v %v", notes, err)
+	}
+	if _, err := db.GetCollaborator(ctx, repo.ID, bob.ID); err == nil {
+		t.Fatal("expected no access before accepting")
+	}
+	if err := svc.Accept(ctx, inv, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := db.GetCollaborator(ctx, repo.ID, bob.ID); err != nil || c.Role != "write" {
+		t.Fatalf("expected write collaborator, got %+v %v", c, err)
+	}
+	if _, err := svc.Get(ctx, inv.ID); !errors.Is(err, ErrInvitationNotFound) {
+		t.Fatalf("expected accepted invitation to be gone, got %v", err)
+	}
+	if notes, _ := db.ListNotifications(ctx, bob.ID, false); len(notes) != 0 {
+		t.Fatalf("expected the invitation notification to be withdrawn, got %+v", notes)
+	}
+
+	// Email invitations for addresses without an account carry a token and
+	// expire.
+	orgInv, err := svc.InviteToOrg(ctx, acme, alice.ID, "", "carol@example.com", "member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orgInv.InviteeID != nil || orgInv.Email != "carol@example.com" || orgInv.TokenHash == "" {
+		t.Fatalf("expected an email invitation, got %+v", orgInv)
+	}
+	if pending, _ := svc.ListForOrg(ctx, acme.ID); len(pending) != 1 {
+		t.Fatalf("expected one pending org invitation, got %d", len(pending))
+	}
+	if _, err := svc.GetByToken(ctx, "wrong"); !errors.Is(err, ErrInvitationNotFound) {
+		t.Fatalf("expected unknown token, got %v", err)
+	}
+	now = now.Add(invitationTTL)
+	if err := svc.Accept(ctx, orgInv, bob.ID); !errors.Is(err, ErrInvitationExpired) {
+		t.Fatalf("expected expired invitation, got %v", err)
+	}
+	if pending, _ := svc.ListForOrg(ctx, acme.ID); len(pending) != 0 {
+		t.Fatalf("expected expired invitations to be hidden, got %d", len(pending))
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+// LinkEntities attaches an issue to each entity stable ID. Every ID must
+// already be known to the repository's entity lineage; linking is idempotent.
+func (s *IssueService) LinkEntities(ctx context.Context, issue *models.Issue, actorID int64, stableIDs []string) ([]models.IssueEntityLink, error) {
+	var ids []string
+	seen := make(map[string]bool, len(stableIDs))
+	for _, id := range stableIDs {
+		id = strings.TrimSpace(id)
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("stable_ids is required")
+	}
+	for _, id := range ids {
+		if _, err := s.db.GetEntityIdentity(ctx, issue.RepoID, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("%w: %s", ErrEntityNotFound, id)
+			}
+			return nil, err
+		}
+	}
+	for _, id := range ids {
+		link := &models.IssueEntityLink{
+			RepoID:    issue.RepoID,
+			IssueID:   issue.ID,
+			StableID:  id,
+			CreatorID: actorID,
+		}
+		if err := s.db.AddIssueEntityLink(ctx, link); err != nil {
+			return nil, err
+		}
+	}
+	return s.db.ListIssueEntityLinks(ctx, issue.ID)
+}
+
+func (s *IssueService) UnlinkEntity(ctx context.Context, issueID int64, stableID string) error {
+	return s.db.DeleteIssueEntityLink(ctx, issueID, strings.TrimSpace(stableID))
+}
+
+func (s *IssueService) ListEntityLinks(ctx context.Context, issueID int64) ([]models.IssueEntityLink, error) {
+	return s.db.ListIssueEntityLinks(ctx, issueID)
+}
+
+// ListOpenIssuesForEntities returns links from open issues to any of the
+// given stable IDs.
+func (s *IssueService) ListOpenIssuesForEntities(ctx context.Context, repoID int64, stableIDs []string) ([]models.IssueEntityLink, error) {
+	return s.db.ListOpenIssueEntityLinks(ctx, repoID, stableIDs)
+}
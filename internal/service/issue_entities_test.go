@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+func TestAnnotateEntityStableIDsSurfacesLinkedIssues(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	db, err := database.OpenSQLite(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := db.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	repo := &models.Repository{
+		OwnerUserID:   &user.ID,
+		Name:          "repo",
+		DefaultBranch: "main",
+		StoragePath:   filepath.Join(tmpDir, "repo"),
+	}
+	if err := db.CreateRepository(ctx, repo); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lineage is seeded directly so both commits count as already indexed.
+	versions := []models.EntityVersion{
+		{StableID: "ent-process", CommitHash: "base", Path: "main.go", EntityHash: "h1", Name: "ProcessOrder", DeclKind: "function_declaration"},
+		{StableID: "ent-process", CommitHash: "head", Path: "main.go", EntityHash: "h2", Name: "ProcessOrder", DeclKind: "function_declaration"},
+		{StableID: "ent-removed", CommitHash: "base", Path: "old.go", EntityHash: "h3", Name: "Legacy", DeclKind: "function_declaration"},
+	}
+	for _, v := range versions {
+		v.RepoID = repo.ID
+		if err := db.UpsertEntityIdentity(ctx, &models.EntityIdentity{RepoID: repo.ID, StableID: v.StableID, Name: v.Name, DeclKind: v.DeclKind, FirstSeenCommit: "base", LastSeenCommit: v.CommitHash}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.SetEntityVersion(ctx, &v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	issueSvc := NewIssueService(db)
+	open, err := issueSvc.Create(ctx, repo.ID, user.ID, "ProcessOrder rounds wrong", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed, err := issueSvc.Create(ctx, repo.ID, user.ID, "Legacy path is slow", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issueSvc.LinkEntities(ctx, open, user.ID, []string{"ent-process", " ent-process "}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issueSvc.LinkEntities(ctx, closed, user.ID, []string{"ent-removed"}); err != nil {
+		t.Fatal(err)
+	}
+	closed.State = models.IssueStateClosed
+	if err := issueSvc.Update(ctx, closed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issueSvc.LinkEntities(ctx, open, user.ID, []string{"ent-missing"}); err == nil {
+		t.Fatal("expected unknown stable ID to be rejected")
+	}
+
+	prSvc := NewPRService(db, nil, nil)
+	prSvc.SetLineageService(NewEntityLineageService(db))
+	files := []FileDiffResponse{
+		{Path: "main.go", Changes: []EntityChangeInfo{{
+			Type:   "modified",
+			Before: &EntityInfo{Name: "ProcessOrder", DeclKind: "function_declaration"},
+			After:  &EntityInfo{Name: "ProcessOrder", DeclKind: "function_declaration"},
+		}}},
+		{Path: "old.go", Changes: []EntityChangeInfo{{
+			Type:   "removed",
+			Before: &EntityInfo{Name: "Legacy", DeclKind: "function_declaration"},
+		}}},
+	}
+	ids := prSvc.annotateEntityStableIDs(ctx, repo.ID, nil, "base", "head", files)
+	if want := []string{"ent-process", "ent-removed"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("stable IDs = %v, want %v", ids, want)
+	}
+	if files[0].Changes[0].StableID != "ent-process" || files[1].Changes[0].StableID != "ent-removed" {
+		t.Fatalf("unexpected annotated changes: %+v", files)
+	}
+
+	links, err := issueSvc.ListOpenIssuesForEntities(ctx, repo.ID, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].IssueNumber != open.Number || links[0].EntityName != "ProcessOrder" {
+		t.Fatalf("expected only the open linked issue, got %+v", links)
+	}
+}
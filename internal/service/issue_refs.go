@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/odvcencio/got/pkg/object"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+// maxLinkedCommits bounds how far back a single push or merge is scanned for
+// issue references in commit messages.
+const maxLinkedCommits = 250
+
+var (
+	closingIssueRefPattern = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?)\s*:?\s+#(\d+)\b`)
+	plainIssueRefPattern   = regexp.MustCompile(`(?:^|[^\w#/&])#(\d+)\b`)
+)
+
+type issueRefMatch struct {
+	Number  int
+	Closing bool
+}
+
+// parseIssueReferences extracts same-repository issue references (#N) from
+// text, flagging those preceded by a closing keyword. Results are ordered by
+// issue number and deduplicated; a closing mention wins over a plain one.
+func parseIssueReferences(text string) []issueRefMatch {
+	byNumber := make(map[int]bool)
+	for _, m := range closingIssueRefPattern.FindAllStringSubmatch(text, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+			byNumber[n] = true
+		}
+	}
+	for _, m := range plainIssueRefPattern.FindAllStringSubmatch(text, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+			if _, ok := byNumber[n]; !ok {
+				byNumber[n] = false
+			}
+		}
+	}
+	matches := make([]issueRefMatch, 0, len(byNumber))
+	for n, closing := range byNumber {
+		matches = append(matches, issueRefMatch{Number: n, Closing: closing})
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Number < matches[j].Number })
+	return matches
+}
+
+// LinkReferences records a cross-reference from source to every issue in the
+// repository mentioned in text. It returns the open issues that text asks to
+// close. Closing keywords only count for pull request and commit sources.
+func (s *IssueService) LinkReferences(ctx context.Context, repoID int64, source models.IssueReference, text string) ([]*models.Issue, error) {
+	var closable []*models.Issue
+	for _, m := range parseIssueReferences(text) {
+		issue, err := s.db.GetIssue(ctx, repoID, m.Number)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return nil, err
+		}
+		if source.SourceType == models.IssueReferenceSourceIssue && source.SourceID == issue.ID {
+			continue
+		}
+		closing := m.Closing && source.SourceType != models.IssueReferenceSourceIssue
+		ref := source
+		ref.RepoID = repoID
+		ref.IssueID = issue.ID
+		ref.Closing = closing
+		if err := s.db.UpsertIssueReference(ctx, &ref); err != nil {
+			return nil, err
+		}
+		if closing && issue.State == models.IssueStateOpen {
+			closable = append(closable, issue)
+		}
+	}
+	return closable, nil
+}
+
+// LinkCommitReferences records references from the messages of commits
+// reachable from head but not from any of the known heads, scanning at most
+// maxLinkedCommits of them. Commits already reachable from a known head were
+// linked when they landed, so an old closing keyword there cannot close an
+// issue that has since been reopened. It returns the open issues the new
+// messages ask to close.
+func (s *IssueService) LinkCommitReferences(ctx context.Context, repoID, actorID int64, store *object.Store, known []object.Hash, head object.Hash) ([]*models.Issue, error) {
+	seen, err := reachableCommits(store, known)
+	if err != nil {
+		return nil, err
+	}
+	var closable []*models.Issue
+	queue := []object.Hash{head}
+	for scanned := 0; len(queue) > 0 && scanned < maxLinkedCommits; {
+		h := queue[0]
+		queue = queue[1:]
+		if h == "" || seen[h] {
+			continue
+		}
+		seen[h] = true
+		scanned++
+		commit, err := store.ReadCommit(h)
+		if err != nil {
+			continue
+		}
+		issues, err := s.LinkReferences(ctx, repoID, models.IssueReference{
+			SourceType: models.IssueReferenceSourceCommit,
+			CommitHash: string(h),
+			ActorID:    actorID,
+		}, commit.Message)
+		if err != nil {
+			return nil, err
+		}
+		closable = append(closable, issues...)
+		queue = append(queue, commit.Parents...)
+	}
+	return closable, nil
+}
+
+// reachableCommits returns every commit reachable from heads.
+func reachableCommits(store *object.Store, heads []object.Hash) (map[object.Hash]bool, error) {
+	reachable := make(map[object.Hash]bool)
+	queue := append([]object.Hash(nil), heads...)
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+		if h == "" || reachable[h] {
+			continue
+		}
+		if len(reachable) >= maxMergeBaseTraversalSteps {
+			return nil, fmt.Errorf("reachable commits: traversal exceeded maximum steps (%d)", maxMergeBaseTraversalSteps)
+		}
+		reachable[h] = true
+		commit, err := store.ReadCommit(h)
+		if err != nil {
+			return nil, fmt.Errorf("read commit %s: %w", h, err)
+		}
+		queue = append(queue, commit.Parents...)
+	}
+	return reachable, nil
+}
+
+// CloseIssues closes each open issue once and returns the issues whose state
+// changed.
+func (s *IssueService) CloseIssues(ctx context.Context, issues []*models.Issue) ([]*models.Issue, error) {
+	var closed []*models.Issue
+	seen := make(map[int64]bool, len(issues))
+	for _, issue := range issues {
+		if issue == nil || seen[issue.ID] || issue.State != models.IssueStateOpen {
+			continue
+		}
+		seen[issue.ID] = true
+		now := time.Now()
+		issue.State = models.IssueStateClosed
+		issue.ClosedAt = &now
+		if err := s.db.UpdateIssue(ctx, issue); err != nil {
+			return closed, err
+		}
+		closed = append(closed, issue)
+	}
+	return closed, nil
+}
+
+func (s *IssueService) ListReferences(ctx context.Context, issueID int64, page, perPage int) ([]models.IssueReference, error) {
+	limit, offset := normalizePage(page, perPage, 50, 200)
+	return s.db.ListIssueReferencesPage(ctx, issueID, limit, offset)
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIssueReferences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []issueRefMatch
+	}{
+		{
+			name: "closing keywords",
+			text: "Fixes #1, closes #2 and Resolved: #3",
+			want: []issueRefMatch{{Number: 1, Closing: true}, {Number: 2, Closing: true}, {Number: 3, Closing: true}},
+		},
+		{
+			name: "plain mentions",
+			text: "see #4\n#5 is related",
+			want: []issueRefMatch{{Number: 4}, {Number: 5}},
+		},
+		{
+			name: "closing wins over plain mention",
+			text: "relates to #7; fix #7",
+			want: []issueRefMatch{{Number: 7, Closing: true}},
+		},
+		{
+			name: "ignores anchors and non-references",
+			text: "docs/page#8 a#9 ##10 #0 prefix #x",
+			want: []issueRefMatch{},
+		},
+		{
+			name: "keyword must precede reference",
+			text: "prefix#11 fixed the suffix #12",
+			want: []issueRefMatch{{Number: 12}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseIssueReferences(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseIssueReferences(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+var ErrInvalidIssueSearch = errors.New("invalid search query")
+
+// ParseIssueSearchQuery parses GitHub-style search syntax such as
+//
+//	is:open author:alice in:title "panic in merge" sort:updated-desc
+//
+// Bare words and quoted phrases become terms that must all match. Words with
+// an unrecognized qualifier prefix are searched as text. Issues have no
+// labels yet, so label: qualifiers are recorded in Ignored and do not filter.
+func ParseIssueSearchQuery(raw string) (models.IssueSearchQuery, error) {
+	var q models.IssueSearchQuery
+	sortSet := false
+	for _, tok := range tokenizeIssueSearch(raw) {
+		if tok.quoted {
+			q.Terms = appendIssueSearchTerm(q.Terms, tok.text)
+			continue
+		}
+		key, value, ok := strings.Cut(tok.text, ":")
+		if !ok || value == "" {
+			q.Terms = appendIssueSearchTerm(q.Terms, tok.text)
+			continue
+		}
+		value = strings.ToLower(value)
+		switch strings.ToLower(key) {
+		case "is", "type", "state":
+			if err := applyIssueSearchIs(&q, strings.ToLower(key), value); err != nil {
+				return q, err
+			}
+		case "author":
+			q.AuthorName = strings.TrimPrefix(tok.text[len(key)+1:], "@")
+		case "in":
+			for _, field := range strings.Split(value, ",") {
+				switch field {
+				case "title", "body", "comments":
+					q.Fields = append(q.Fields, field)
+				default:
+					return q, fmt.Errorf("%w: in must be title, body or comments", ErrInvalidIssueSearch)
+				}
+			}
+		case "sort":
+			field, dir, _ := strings.Cut(value, "-")
+			switch field {
+			case models.IssueSearchSortBest, models.IssueSearchSortCreated, models.IssueSearchSortUpdated, models.IssueSearchSortComments:
+				q.Sort = field
+			default:
+				return q, fmt.Errorf("%w: sort must be best, created, updated or comments", ErrInvalidIssueSearch)
+			}
+			switch dir {
+			case "", "desc":
+				q.Ascending = false
+			case "asc":
+				q.Ascending = true
+			default:
+				return q, fmt.Errorf("%w: sort direction must be asc or desc", ErrInvalidIssueSearch)
+			}
+			sortSet = true
+		case "label":
+			q.Ignored = append(q.Ignored, tok.text)
+		default:
+			q.Terms = appendIssueSearchTerm(q.Terms, tok.text)
+		}
+	}
+	if q.State == models.PullRequestStateMerged {
+		if q.Kind == models.IssueSearchKindIssue {
+			return q, fmt.Errorf("%w: issues cannot be merged", ErrInvalidIssueSearch)
+		}
+		q.Kind = models.IssueSearchKindPullRequest
+	}
+	if !sortSet {
+		q.Sort = models.IssueSearchSortCreated
+		if len(q.Terms) > 0 {
+			q.Sort = models.IssueSearchSortBest
+		}
+	}
+	return q, nil
+}
+
+func applyIssueSearchIs(q *models.IssueSearchQuery, key, value string) error {
+	switch value {
+	case models.IssueStateOpen, models.IssueStateClosed, models.PullRequestStateMerged:
+		if key != "type" {
+			q.State = value
+			return nil
+		}
+	case "issue":
+		if key != "state" {
+			q.Kind = models.IssueSearchKindIssue
+			return nil
+		}
+	case "pr", "pull_request", "pull-request":
+		if key != "state" {
+			q.Kind = models.IssueSearchKindPullRequest
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: unknown %s value %q", ErrInvalidIssueSearch, key, value)
+}
+
+type issueSearchToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeIssueSearch splits raw on whitespace, keeping double-quoted
+// phrases together. An unterminated quote runs to the end of the input.
+func tokenizeIssueSearch(raw string) []issueSearchToken {
+	var tokens []issueSearchToken
+	var cur strings.Builder
+	inQuote := false
+	flush := func(quoted bool) {
+		if text := strings.TrimSpace(cur.String()); text != "" {
+			tokens = append(tokens, issueSearchToken{text: text, quoted: quoted})
+		}
+		cur.Reset()
+	}
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			flush(inQuote)
+			inQuote = !inQuote
+		case unicode.IsSpace(r) && !inQuote:
+			flush(false)
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	flush(inQuote)
+	return tokens
+}
+
+// appendIssueSearchTerm adds term unless it has no letters or digits, which
+// neither full-text backend can match.
+func appendIssueSearchTerm(terms []string, term string) []string {
+	for _, r := range term {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return append(terms, term)
+		}
+	}
+	return terms
+}
+
+// Search runs a parsed search query against a repository's issues and pull
+// requests. It also returns the qualifiers that were ignored. Parse failures
+// wrap ErrInvalidIssueSearch.
+func (s *IssueService) Search(ctx context.Context, repoID int64, raw string, page, perPage int) ([]models.IssueSearchResult, []string, error) {
+	q, err := ParseIssueSearchQuery(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	q.RepoID = repoID
+	limit, offset := normalizePage(page, perPage, 30, 100)
+	results, err := s.db.SearchIssues(ctx, q, limit, offset)
+	return results, q.Ignored, err
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+func TestParseIssueSearchQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    models.IssueSearchQuery
+		wantErr bool
+	}{
+		{
+			name: "qualifiers and phrase",
+			raw:  `is:open author:Alice "panic in merge" sort:updated`,
+			want: models.IssueSearchQuery{State: "open", AuthorName: "Alice", Terms: []string{"panic in merge"}, Sort: models.IssueSearchSortUpdated},
+		},
+		{
+			name: "terms default to best match",
+			raw:  "nil   pointer",
+			want: models.IssueSearchQuery{Terms: []string{"nil", "pointer"}, Sort: models.IssueSearchSortBest},
+		},
+		{
+			name: "no terms default to created",
+			raw:  "is:pr is:closed",
+			want: models.IssueSearchQuery{Kind: models.IssueSearchKindPullRequest, State: "closed", Sort: models.IssueSearchSortCreated},
+		},
+		{
+			name: "merged implies pull requests",
+			raw:  "is:merged sort:comments-asc",
+			want: models.IssueSearchQuery{Kind: models.IssueSearchKindPullRequest, State: "merged", Sort: models.IssueSearchSortComments, Ascending: true},
+		},
+		{
+			name: "fields and unknown qualifiers",
+			raw:  "in:title,comments milestone:v1 @@@",
+			want: models.IssueSearchQuery{Fields: []string{"title", "comments"}, Terms: []string{"milestone:v1"}, Sort: models.IssueSearchSortBest},
+		},
+		{
+			name: "labels are ignored",
+			raw:  "label:bug crash",
+			want: models.IssueSearchQuery{Terms: []string{"crash"}, Ignored: []string{"label:bug"}, Sort: models.IssueSearchSortBest},
+		},
+		{name: "bad sort", raw: "sort:stars", wantErr: true},
+		{name: "merged issue", raw: "is:issue is:merged", wantErr: true},
+		{name: "bad state", raw: "state:issue", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseIssueSearchQuery(tt.raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidIssueSearch) {
+					t.Fatalf("ParseIssueSearchQuery(%q) error = %v, want ErrInvalidIssueSearch", tt.raw, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseIssueSearchQuery(%q): %v", tt.raw, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ParseIssueSearchQuery(%q) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/database"
+	gomail "github.com/odvcencio/gothub/internal/mail"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+// Failed sends back off exponentially from mailRetryDelay up to
+// mailMaxRetryDelay. A claimed message that is never completed, say because
+// the process died mid-send, is retried once mailSendLease has passed.
+const (
+	mailRetryDelay     = 30 * time.Second
+	mailMaxRetryDelay  = time.Hour
+	mailMaxAttempts    = 8
+	mailSendLease      = 5 * time.Minute
+	defaultMailFrom    = "gothub <noreply@localhost>"
+	replyTokenMACBytes = 12
+)
+
+var ErrInvalidReplyToken = errors.New("invalid reply token")
+
+// MailOptions configures addresses and links in outbound email.
+type MailOptions struct {
+	From string
+	// BaseURL is the public web origin used for links, e.g.
+	// https://gothub.example.com.
+	BaseURL string
+	// ReplyDomain receives replies to notification emails at
+	// reply+<token>@ReplyDomain. Empty disables reply addresses.
+	ReplyDomain string
+	// ReplySecret signs reply tokens. Empty uses a random per-process key,
+	// which is only suitable without a reply domain.
+	ReplySecret []byte
+}
+
+// MailService renders outbound email and queues it for delivery through a
+// gomail.Sender.
+type MailService struct {
+	db     database.DB
+	sender gomail.Sender
+	opts   MailOptions
+}
+
+func NewMailService(db database.DB, sender gomail.Sender, opts MailOptions) *MailService {
+	if strings.TrimSpace(opts.From) == "" {
+		opts.From = defaultMailFrom
+	}
+	opts.BaseURL = strings.TrimRight(strings.TrimSpace(opts.BaseURL), "/")
+	opts.ReplyDomain = strings.TrimSpace(opts.ReplyDomain)
+	if len(opts.ReplySecret) == 0 {
+		opts.ReplySecret = make([]byte, 32)
+		_, _ = rand.Read(opts.ReplySecret)
+	}
+	return &MailService{db: db, sender: sender, opts: opts}
+}
+
+// Enqueue persists msg in the send queue. From and Date default to the
+// service's sender address and the current time.
+func (s *MailService) Enqueue(ctx context.Context, msg *gomail.Message) error {
+	if msg.From == "" {
+		msg.From = s.opts.From
+	}
+	if msg.Date.IsZero() {
+		msg.Date = time.Now().UTC()
+	}
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	recipient, _ := msg.Recipient()
+	return s.db.EnqueueOutboundEmail(ctx, &models.OutboundEmail{
+		Recipient:   recipient,
+		Subject:     msg.Subject,
+		Message:     string(data),
+		MaxAttempts: mailMaxAttempts,
+	})
+}
+
+// SendMagicLink queues a sign-in email carrying token.
+func (s *MailService) SendMagicLink(ctx context.Context, user *models.User, token string, expiresAt time.Time) error {
+	subject, body, err := gomail.Render(gomail.TemplateMagicLink, gomail.MagicLinkData{
+		Username:  user.Username,
+		Link:      s.link("/login?magic_token=" + token),
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	return s.Enqueue(ctx, &gomail.Message{
+		To:      formatAddress(user.Username, user.Email),
+		Subject: subject,
+		Text:    body,
+	})
+}
+
+// SendInvitation queues an invitation to an address without an account.
+// The link carries token, which accepts the invitation.
+func (s *MailService) SendInvitation(ctx context.Context, inv *models.Invitation, kind, token string) error {
+	subject, body, err := gomail.Render(gomail.TemplateInvitation, gomail.InvitationData{
+		Inviter:   inv.InviterName,
+		Kind:      kind,
+		Target:    inv.Target,
+		Role:      inv.Role,
+		Link:      s.link("/invitations/accept?token=" + token),
+		ExpiresAt: inv.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	return s.Enqueue(ctx, &gomail.Message{
+		To:      inv.Email,
+		Subject: subject,
+		Text:    body,
+	})
+}
+
+// SendNotification queues an email copy of n for user. Notifications about
+// an issue or pull request share a thread root Message-ID so that mail
+// clients group them, and carry a signed per-user reply address when a
+// reply domain is configured.
+func (s *MailService) SendNotification(ctx context.Context, user *models.User, n *models.Notification) error {
+	if strings.TrimSpace(user.Email) == "" {
+		return nil
+	}
+	threadType, threadID := notificationThreadRef(n)
+	canReply := threadType != "" && s.opts.ReplyDomain != ""
+	subject, body, err := gomail.Render(gomail.TemplateNotification, gomail.NotificationData{
+		Username: user.Username,
+		Title:    n.Title,
+		Body:     n.Body,
+		Reason:   strings.ReplaceAll(n.Reason, "_", " "),
+		Link:     s.link(n.ResourcePath),
+		CanReply: canReply,
+	})
+	if err != nil {
+		return err
+	}
+	msg := &gomail.Message{
+		To:      formatAddress(user.Username, user.Email),
+		Subject: subject,
+		Text:    body,
+		Headers: map[string]string{"X-Gothub-Reason": n.Reason},
+	}
+	if threadType != "" {
+		root := s.threadMessageID(threadType, threadID)
+		msg.MessageID = s.messageID(fmt.Sprintf("%s-%d.%d", threadType, threadID, n.ID))
+		msg.InReplyTo = root
+		msg.References = []string{root}
+	}
+	if canReply {
+		msg.ReplyTo = s.ReplyAddress(user.ID, threadType, threadID)
+	}
+	return s.Enqueue(ctx, msg)
+}
+
+// SendDigest queues a notification digest for user. Links in data may be
+// paths; they are made absolute here.
+func (s *MailService) SendDigest(ctx context.Context, user *models.User, data gomail.DigestData) error {
+	if strings.TrimSpace(user.Email) == "" {
+		return nil
+	}
+	data.Username = user.Username
+	data.Link = s.link(data.Link)
+	data.SettingsLink = s.link(data.SettingsLink)
+	for i := range data.Repos {
+		for j := range data.Repos[i].Threads {
+			data.Repos[i].Threads[j].Link = s.link(data.Repos[i].Threads[j].Link)
+		}
+	}
+	subject, body, err := gomail.Render(gomail.TemplateDigest, data)
+	if err != nil {
+		return err
+	}
+	return s.Enqueue(ctx, &gomail.Message{
+		To:      formatAddress(user.Username, user.Email),
+		Subject: subject,
+		Text:    body,
+		Headers: map[string]string{"X-Gothub-Reason": "digest"},
+	})
+}
+
+// ReplyAddress returns the address that accepts email replies from userID to
+// the given issue or pull request.
+func (s *MailService) ReplyAddress(userID int64, threadType string, threadID int64) string {
+	return "reply+" + s.ReplyToken(userID, threadType, threadID) + "@" + s.opts.ReplyDomain
+}
+
+// ReplyToken encodes the replying user and thread with an HMAC so that
+// reply addresses cannot be forged or retargeted.
+func (s *MailService) ReplyToken(userID int64, threadType string, threadID int64) string {
+	payload := make([]byte, 0, 17)
+	payload = binary.AppendUvarint(payload, uint64(userID))
+	payload = append(payload, replyThreadCode(threadType))
+	payload = binary.AppendUvarint(payload, uint64(threadID))
+	payload = append(payload, s.replyMAC(payload)...)
+	return strings.ToLower(base32NoPad.EncodeToString(payload))
+}
+
+// ParseReplyToken verifies a token made by ReplyToken and returns what it
+// names.
+func (s *MailService) ParseReplyToken(token string) (userID int64, threadType string, threadID int64, err error) {
+	raw, err := base32NoPad.DecodeString(strings.ToUpper(strings.TrimSpace(token)))
+	if err != nil || len(raw) <= replyTokenMACBytes {
+		return 0, "", 0, ErrInvalidReplyToken
+	}
+	payload, sum := raw[:len(raw)-replyTokenMACBytes], raw[len(raw)-replyTokenMACBytes:]
+	if !hmac.Equal(sum, s.replyMAC(payload)) {
+		return 0, "", 0, ErrInvalidReplyToken
+	}
+	uid, n := binary.Uvarint(payload)
+	if n <= 0 || n >= len(payload) {
+		return 0, "", 0, ErrInvalidReplyToken
+	}
+	threadType = replyThreadType(payload[n])
+	tid, m := binary.Uvarint(payload[n+1:])
+	if m <= 0 || n+1+m != len(payload) || threadType == "" {
+		return 0, "", 0, ErrInvalidReplyToken
+	}
+	return int64(uid), threadType, int64(tid), nil
+}
+
+// ParseReplyAddress verifies a reply+<token>@ReplyDomain address made by
+// ReplyAddress. Other addresses return ErrInvalidReplyToken.
+func (s *MailService) ParseReplyAddress(address string) (userID int64, threadType string, threadID int64, err error) {
+	local, domain, ok := strings.Cut(strings.TrimSpace(address), "@")
+	if !ok || s.opts.ReplyDomain == "" || !strings.EqualFold(domain, s.opts.ReplyDomain) {
+		return 0, "", 0, ErrInvalidReplyToken
+	}
+	token, ok := strings.CutPrefix(strings.ToLower(local), "reply+")
+	if !ok {
+		return 0, "", 0, ErrInvalidReplyToken
+	}
+	return s.ParseReplyToken(token)
+}
+
+// replyMAC namespaces its input so that MACs made with the same key for
+// another purpose are never valid reply tokens.
+func (s *MailService) replyMAC(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.opts.ReplySecret)
+	mac.Write([]byte("gothub-mail-reply:"))
+	mac.Write(payload)
+	return mac.Sum(nil)[:replyTokenMACBytes]
+}
+
+// ProcessNext sends the next due message, if any, and reports whether one
+// was claimed. Send failures are recorded on the message and retried with
+// backoff until its attempts run out.
+func (s *MailService) ProcessNext(ctx context.Context) (bool, error) {
+	now := time.Now().UTC()
+	email, err := s.db.ClaimOutboundEmail(ctx, now, now.Add(mailSendLease))
+	if err != nil || email == nil {
+		return false, err
+	}
+	var msg gomail.Message
+	if err := json.Unmarshal([]byte(email.Message), &msg); err != nil {
+		return true, s.db.CompleteOutboundEmail(ctx, email.ID, models.OutboundEmailFailed, "decode message: "+err.Error())
+	}
+	sendErr := s.sender.Send(ctx, &msg)
+	if sendErr == nil {
+		return true, s.db.CompleteOutboundEmail(ctx, email.ID, models.OutboundEmailSent, "")
+	}
+	message := clipText(sendErr.Error(), 500)
+	if email.MaxAttempts > 0 && email.AttemptCount >= email.MaxAttempts {
+		return true, s.db.CompleteOutboundEmail(ctx, email.ID, models.OutboundEmailFailed, message)
+	}
+	return true, s.db.RequeueOutboundEmail(ctx, email.ID, message, now.Add(mailBackoff(email.AttemptCount)))
+}
+
+func mailBackoff(attempt int) time.Duration {
+	delay := mailRetryDelay
+	for i := 1; i < attempt && delay < mailMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, mailMaxRetryDelay)
+}
+
+func (s *MailService) link(path string) string {
+	if path == "" {
+		path = "/"
+	}
+	return s.opts.BaseURL + path
+}
+
+// threadMessageID is the Message-ID every notification about a thread
+// replies to. No message is ever sent with it.
+func (s *MailService) threadMessageID(threadType string, threadID int64) string {
+	return s.messageID(fmt.Sprintf("%s-%d", threadType, threadID))
+}
+
+func (s *MailService) messageID(local string) string {
+	domain := s.opts.ReplyDomain
+	if domain == "" {
+		domain = "gothub.localhost"
+		if addr, err := mail.ParseAddress(s.opts.From); err == nil {
+			if _, d, ok := strings.Cut(addr.Address, "@"); ok && d != "" {
+				domain = d
+			}
+		}
+	}
+	return "<" + local + "@" + domain + ">"
+}
+
+func notificationThreadRef(n *models.Notification) (string, int64) {
+	switch {
+	case n.IssueID != nil:
+		return models.ThreadTypeIssue, *n.IssueID
+	case n.PRID != nil:
+		return models.ThreadTypePullRequest, *n.PRID
+	}
+	return "", 0
+}
+
+// Reply tokens use unpadded base32 so that they survive mail systems that
+// lowercase the local part of an address.
+var base32NoPad = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func replyThreadCode(threadType string) byte {
+	if threadType == models.ThreadTypePullRequest {
+		return 'p'
+	}
+	return 'i'
+}
+
+func replyThreadType(code byte) string {
+	switch code {
+	case 'i':
+		return models.ThreadTypeIssue
+	case 'p':
+		return models.ThreadTypePullRequest
+	}
+	return ""
+}
+
+func formatAddress(name, email string) string {
+	return (&mail.Address{Name: name, Address: email}).String()
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/mail"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+type recordingSender struct {
+	fail int
+	sent []*mail.Message
+}
+
+func (s *recordingSender) Send(ctx context.Context, msg *mail.Message) error {
+	if s.fail > 0 {
+		s.fail--
+		return errors.New("relay unavailable")
+	}
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func TestMailServiceReplyTokenRoundTrip(t *testing.T) {
+	svc := NewMailService(nil, nil, MailOptions{ReplyDomain: "reply.example.com", ReplySecret: []byte("secret")})
+
+	token := svc.ReplyToken(42, models.ThreadTypePullRequest, 9001)
+	if token != strings.ToLower(token) {
+		t.Fatalf("reply token should be lowercase, got %q", token)
+	}
+	userID, threadType, threadID, err := svc.ParseReplyToken(strings.ToUpper(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != 42 || threadType != models.ThreadTypePullRequest || threadID != 9001 {
+		t.Fatalf("unexpected token contents: %d %s %d", userID, threadType, threadID)
+	}
+	if got := svc.ReplyAddress(42, models.ThreadTypePullRequest, 9001); got != "reply+"+token+"@reply.example.com" {
+		t.Fatalf("unexpected reply address %q", got)
+	}
+	if userID, _, _, err := svc.ParseReplyAddress("REPLY+" + strings.ToUpper(token) + "@Reply.Example.com"); err != nil || userID != 42 {
+		t.Fatalf("expected reply address to parse case-insensitively: %d %v", userID, err)
+	}
+	if _, _, _, err := svc.ParseReplyAddress("reply+" + token + "@elsewhere.example.com"); !errors.Is(err, ErrInvalidReplyToken) {
+		t.Fatalf("expected foreign reply domain to be rejected, got %v", err)
+	}
+
+	tampered := []byte(token)
+	tampered[0] ^= 1
+	if _, _, _, err := svc.ParseReplyToken(string(tampered)); !errors.Is(err, ErrInvalidReplyToken) {
+		t.Fatalf("expected tampered token to be rejected, got %v", err)
+	}
+	other := NewMailService(nil, nil, MailOptions{ReplySecret: []byte("other")})
+	if _, _, _, err := other.ParseReplyToken(token); !errors.Is(err, ErrInvalidReplyToken) {
+		t.Fatalf("expected token signed with another secret to be rejected, got %v", err)
+	}
+}
+
+func TestMailServiceRetriesFailedSends(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	sender := &recordingSender{fail: 1}
+	svc := NewMailService(db, sender, MailOptions{From: "gothub <noreply@example.com>", BaseURL: "https://gothub.test/"})
+	user := &models.User{ID: 1, Username: "alice", Email: "alice@example.com"}
+	if err := svc.SendMagicLink(ctx, user, "tok", time.Now().Add(15*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := svc.ProcessNext(ctx)
+	if err != nil || !claimed {
+		t.Fatalf("first attempt: claimed=%v err=%v", claimed, err)
+	}
+	if len(sender.sent) != 0 {
+		t.Fatal("failed send should not be recorded")
+	}
+	// The retry is scheduled with backoff, so nothing is due yet.
+	if claimed, err := svc.ProcessNext(ctx); err != nil || claimed {
+		t.Fatalf("expected no due message during backoff: claimed=%v err=%v", claimed, err)
+	}
+	// Pull the retry forward instead of waiting out the backoff.
+	if err := db.RequeueOutboundEmail(ctx, 1, "relay unavailable", time.Now().UTC().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := svc.ProcessNext(ctx); err != nil || !claimed {
+		t.Fatalf("retry: claimed=%v err=%v", claimed, err)
+	}
+	if len(sender.sent) != 1 {
+		t.Fatalf("expected message to be sent on retry, got %d", len(sender.sent))
+	}
+	msg := sender.sent[0]
+	if msg.To != `"alice" <alice@example.com>` || !strings.Contains(msg.Text, "https://gothub.test/login?magic_token=tok") {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+	if claimed, err := svc.ProcessNext(ctx); err != nil || claimed {
+		t.Fatalf("expected queue to be empty: claimed=%v err=%v", claimed, err)
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	mentionPattern    = regexp.MustCompile(`(?:^|[^\w@/.\x60-])@([A-Za-z0-9][A-Za-z0-9_.-]*)(?:/([A-Za-z0-9][A-Za-z0-9_.-]*))?`)
+	fencedCodePattern = regexp.MustCompile("(?s)```.*?(?:```|$)")
+	inlineCodePattern = regexp.MustCompile("`[^`\n]*`")
+)
+
+type mention struct {
+	Name string // username, or org name for team mentions
+	Team string // team slug for @org/team mentions
+}
+
+// parseMentions extracts @user and @org/team mentions from markdown text,
+// ignoring code spans and fenced code blocks. Results are sorted and
+// deduplicated case-insensitively.
+func parseMentions(text string) []mention {
+	text = fencedCodePattern.ReplaceAllString(text, " ")
+	text = inlineCodePattern.ReplaceAllString(text, " ")
+	seen := make(map[string]bool)
+	var mentions []mention
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := strings.TrimRight(m[1], ".-")
+		team := strings.TrimRight(m[2], ".-")
+		if name == "" {
+			continue
+		}
+		key := strings.ToLower(name + "/" + team)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		mentions = append(mentions, mention{Name: name, Team: team})
+	}
+	sort.Slice(mentions, func(i, j int) bool {
+		a, b := strings.ToLower(mentions[i].Name), strings.ToLower(mentions[j].Name)
+		if a != b {
+			return a < b
+		}
+		return strings.ToLower(mentions[i].Team) < strings.ToLower(mentions[j].Team)
+	})
+	return mentions
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []mention
+	}{
+		{name: "users and punctuation", text: "cc @bob, @Alice.\n@carol-", want: []mention{{Name: "Alice"}, {Name: "bob"}, {Name: "carol"}}},
+		{name: "teams", text: "(@acme/core) please review", want: []mention{{Name: "acme", Team: "core"}}},
+		{name: "duplicates", text: "@bob @BOB @bob", want: []mention{{Name: "bob"}}},
+		{name: "emails and paths", text: "mail alice@example.com or see docs/@bob", want: nil},
+		{name: "code", text: "use `@bob` and\n```\n@carol\n```\nthen @dave", want: []mention{{Name: "dave"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseMentions(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseMentions(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifyIssueCommentMentionsAndSubscribes(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	db, err := database.OpenSQLite(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	users := make(map[string]*models.User)
+	for _, name := range []string{"alice", "bob", "mallory"} {
+		u := &models.User{Username: name, Email: name + "@example.com", PasswordHash: "x"}
+		if err := db.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+		users[name] = u
+	}
+	alice, bob, mallory := users["alice"], users["bob"], users["mallory"]
+	repo := &models.Repository{
+		OwnerUserID:   &alice.ID,
+		OwnerName:     "alice",
+		Name:          "repo",
+		IsPrivate:     true,
+		DefaultBranch: "main",
+		StoragePath:   filepath.Join(tmpDir, "repo"),
+	}
+	if err := db.CreateRepository(ctx, repo); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddCollaborator(ctx, &models.Collaborator{RepoID: repo.ID, UserID: bob.ID, Role: "read"}); err != nil {
+		t.Fatal(err)
+	}
+
+	issue, err := NewIssueService(db).Create(ctx, repo.ID, alice.ID, "Crash on start", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifySvc := NewNotificationService(db)
+	comment := &models.IssueComment{IssueID: issue.ID, AuthorID: alice.ID, Body: "@bob @mallory @alice can you look?"}
+	if err := notifySvc.NotifyIssueComment(ctx, repo, issue, comment, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	types := func(userID int64) []string {
+		t.Helper()
+		notifications, err := db.ListNotifications(ctx, userID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, n := range notifications {
+			out = append(out, n.Type)
+		}
+		return out
+	}
+	if got := types(bob.ID); !reflect.DeepEqual(got, []string{"issue.mention"}) {
+		t.Fatalf("bob notifications = %v, want [issue.mention]", got)
+	}
+	if got := types(mallory.ID); len(got) != 0 {
+		t.Fatalf("outsider without access should not be notified, got %v", got)
+	}
+	if got := types(alice.ID); len(got) != 0 {
+		t.Fatalf("actor should not be notified, got %v", got)
+	}
+
+	// Bob is now subscribed and hears about later comments on the thread.
+	followUp := &models.IssueComment{IssueID: issue.ID, AuthorID: alice.ID, Body: "Fixed in main."}
+	if err := notifySvc.NotifyIssueComment(ctx, repo, issue, followUp, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	got := types(bob.ID)
+	sort.Strings(got)
+	if want := []string{"issue.comment", "issue.mention"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("bob notifications after follow-up = %v, want %v", got, want)
+	}
+}
@@ -2,79 +2,208 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/odvcencio/gothub/internal/database"
 	"github.com/odvcencio/gothub/internal/models"
 )
 
+// RepoAccessChecker reports whether a user may read (or write) a repository.
+type RepoAccessChecker func(ctx context.Context, repo *models.Repository, userID int64, write bool) (bool, error)
+
+// TeamMemberResolver returns the user IDs of an organization team's members.
+type TeamMemberResolver func(ctx context.Context, org, team string) ([]int64, error)
+
 type NotificationService struct {
-	db database.DB
+	db           database.DB
+	accessCheck  RepoAccessChecker
+	teamResolver TeamMemberResolver
+	mailSvc      *MailService
 }
 
 func NewNotificationService(db database.DB) *NotificationService {
 	return &NotificationService{db: db}
 }
 
-func (s *NotificationService) NotifyPullRequestOpened(ctx context.Context, repo *models.Repository, pr *models.PullRequest, actorID int64) error {
-	recipients, err := s.repoMaintainerIDs(ctx, repo)
+// SetRepoAccessChecker overrides how mention and subscriber recipients are
+// checked for read access to private repositories.
+func (s *NotificationService) SetRepoAccessChecker(check RepoAccessChecker) {
+	s.accessCheck = check
+}
+
+// SetTeamMemberResolver enables @org/team mentions. Without a resolver team
+// mentions are ignored.
+func (s *NotificationService) SetTeamMemberResolver(resolve TeamMemberResolver) {
+	s.teamResolver = resolve
+}
+
+// SetMailService emails a copy of each notification to its recipient.
+func (s *NotificationService) SetMailService(mailSvc *MailService) {
+	s.mailSvc = mailSvc
+}
+
+// deliver stores n and, when mail is configured, queues its email copy.
+// Users on a daily or weekly digest get it with their next digest instead.
+func (s *NotificationService) deliver(ctx context.Context, n *models.Notification) error {
+	if err := s.db.CreateNotification(ctx, n); err != nil {
+		return err
+	}
+	if s.mailSvc == nil {
+		return nil
+	}
+	settings, err := s.GetNotificationSettings(ctx, n.UserID)
 	if err != nil {
 		return err
 	}
-	repoID := repo.ID
+	if settings.EmailFrequency != models.EmailFrequencyInstant {
+		return nil
+	}
+	user, err := s.db.GetUserByID(ctx, n.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if err := s.mailSvc.SendNotification(ctx, user, n); err != nil {
+		return err
+	}
+	return s.db.MarkNotificationsEmailed(ctx, n.UserID, []int64{n.ID}, time.Now().UTC())
+}
+
+// notificationThread is the issue or pull request a notification is about.
+type notificationThread struct {
+	typ   string // models.ThreadTypeIssue or models.ThreadTypePullRequest
+	label string // "issue #3" or "PR #3"
+	path  string
+	prID  *int64
+	issID *int64
+	id    int64
+}
+
+func issueThread(repo *models.Repository, issue *models.Issue) notificationThread {
+	issueID := issue.ID
+	return notificationThread{
+		typ:   models.ThreadTypeIssue,
+		label: fmt.Sprintf("issue #%d", issue.Number),
+		path:  fmt.Sprintf("/%s/%s/issues/%d", repo.OwnerName, repo.Name, issue.Number),
+		issID: &issueID,
+		id:    issue.ID,
+	}
+}
+
+func pullRequestThread(repo *models.Repository, pr *models.PullRequest) notificationThread {
 	prID := pr.ID
-	return s.notify(ctx, recipients, actorID,
-		"pull_request.opened",
-		fmt.Sprintf("Pull request #%d opened in %s/%s", pr.Number, repo.OwnerName, repo.Name),
-		clipText(pr.Title, 240),
-		fmt.Sprintf("/%s/%s/pulls/%d", repo.OwnerName, repo.Name, pr.Number),
-		&repoID, &prID, nil,
-	)
+	return notificationThread{
+		typ:   models.ThreadTypePullRequest,
+		label: fmt.Sprintf("PR #%d", pr.Number),
+		path:  fmt.Sprintf("/%s/%s/pulls/%d", repo.OwnerName, repo.Name, pr.Number),
+		prID:  &prID,
+		id:    pr.ID,
+	}
+}
+
+func (s *NotificationService) NotifyPullRequestOpened(ctx context.Context, repo *models.Repository, pr *models.PullRequest, actorID int64) error {
+	maintainers, err := s.repoMaintainerIDs(ctx, repo)
+	if err != nil {
+		return err
+	}
+	return s.notifyThread(ctx, repo, actorID, threadEvent{
+		thread:      pullRequestThread(repo, pr),
+		typ:         "pull_request.opened",
+		title:       fmt.Sprintf("Pull request #%d opened in %s/%s", pr.Number, repo.OwnerName, repo.Name),
+		body:        clipText(pr.Title, 240),
+		mentionText: pr.Body,
+		maintainers: maintainers,
+		authorID:    pr.AuthorID,
+		broadcast:   true,
+	})
 }
 
 func (s *NotificationService) NotifyPullRequestComment(ctx context.Context, repo *models.Repository, pr *models.PullRequest, comment *models.PRComment, actorID int64) error {
-	repoID := repo.ID
-	prID := pr.ID
-	return s.notify(ctx, []int64{pr.AuthorID}, actorID,
-		"pull_request.comment",
-		fmt.Sprintf("New comment on PR #%d in %s/%s", pr.Number, repo.OwnerName, repo.Name),
-		clipText(comment.Body, 240),
-		fmt.Sprintf("/%s/%s/pulls/%d", repo.OwnerName, repo.Name, pr.Number),
-		&repoID, &prID, nil,
-	)
+	return s.notifyThread(ctx, repo, actorID, threadEvent{
+		thread:      pullRequestThread(repo, pr),
+		typ:         "pull_request.comment",
+		title:       fmt.Sprintf("New comment on PR #%d in %s/%s", pr.Number, repo.OwnerName, repo.Name),
+		body:        clipText(comment.Body, 240),
+		mentionText: comment.Body,
+		authorID:    pr.AuthorID,
+		participant: true,
+		broadcast:   true,
+	})
 }
 
 func (s *NotificationService) NotifyPullRequestReview(ctx context.Context, repo *models.Repository, pr *models.PullRequest, review *models.PRReview, actorID int64) error {
-	repoID := repo.ID
-	prID := pr.ID
 	body := strings.TrimSpace(review.State)
 	if review.Body != "" {
 		body = body + ": " + review.Body
 	}
-	return s.notify(ctx, []int64{pr.AuthorID}, actorID,
-		"pull_request.review",
-		fmt.Sprintf("New review on PR #%d in %s/%s", pr.Number, repo.OwnerName, repo.Name),
-		clipText(body, 240),
-		fmt.Sprintf("/%s/%s/pulls/%d", repo.OwnerName, repo.Name, pr.Number),
-		&repoID, &prID, nil,
-	)
+	return s.notifyThread(ctx, repo, actorID, threadEvent{
+		thread:      pullRequestThread(repo, pr),
+		typ:         "pull_request.review",
+		title:       fmt.Sprintf("New review on PR #%d in %s/%s", pr.Number, repo.OwnerName, repo.Name),
+		body:        clipText(body, 240),
+		mentionText: review.Body,
+		authorID:    pr.AuthorID,
+		participant: true,
+		broadcast:   true,
+	})
+}
+
+// NotifyReviewRequested subscribes each reviewer to the pull request and
+// notifies them with reason review_requested. Reviewers who cannot read the
+// repository are skipped.
+func (s *NotificationService) NotifyReviewRequested(ctx context.Context, repo *models.Repository, pr *models.PullRequest, reviewerIDs []int64, actorID int64) error {
+	thread := pullRequestThread(repo, pr)
+	var requested []int64
+	for _, userID := range reviewerIDs {
+		ok, err := s.canRead(ctx, repo, userID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := s.db.SetThreadSubscription(ctx, &models.ThreadSubscription{
+			UserID:     userID,
+			RepoID:     repo.ID,
+			ThreadType: thread.typ,
+			ThreadID:   thread.id,
+			Reason:     models.SubscriptionReasonReviewRequested,
+			Subscribed: true,
+		}); err != nil {
+			return err
+		}
+		requested = append(requested, userID)
+	}
+	return s.notifyThread(ctx, repo, actorID, threadEvent{
+		thread:    thread,
+		typ:       "pull_request.review_requested",
+		title:     fmt.Sprintf("Review requested on PR #%d in %s/%s", pr.Number, repo.OwnerName, repo.Name),
+		body:      clipText(pr.Title, 240),
+		requested: requested,
+	})
 }
 
 func (s *NotificationService) NotifyIssueOpened(ctx context.Context, repo *models.Repository, issue *models.Issue, actorID int64) error {
-	recipients, err := s.repoMaintainerIDs(ctx, repo)
+	maintainers, err := s.repoMaintainerIDs(ctx, repo)
 	if err != nil {
 		return err
 	}
-	repoID := repo.ID
-	issueID := issue.ID
-	return s.notify(ctx, recipients, actorID,
-		"issue.opened",
-		fmt.Sprintf("Issue #%d opened in %s/%s", issue.Number, repo.OwnerName, repo.Name),
-		clipText(issue.Title, 240),
-		fmt.Sprintf("/%s/%s/issues/%d", repo.OwnerName, repo.Name, issue.Number),
-		&repoID, nil, &issueID,
-	)
+	return s.notifyThread(ctx, repo, actorID, threadEvent{
+		thread:      issueThread(repo, issue),
+		typ:         "issue.opened",
+		title:       fmt.Sprintf("Issue #%d opened in %s/%s", issue.Number, repo.OwnerName, repo.Name),
+		body:        clipText(issue.Title, 240),
+		mentionText: issue.Body,
+		maintainers: maintainers,
+		authorID:    issue.AuthorID,
+		broadcast:   true,
+	})
 }
 
 func (s *NotificationService) NotifyIssueComment(ctx context.Context, repo *models.Repository, issue *models.Issue, comment *models.IssueComment, actorID int64) error {
@@ -82,16 +211,390 @@ func (s *NotificationService) NotifyIssueComment(ctx context.Context, repo *mode
 	if err != nil {
 		return err
 	}
-	recipients := append(maintainers, issue.AuthorID)
+	return s.notifyThread(ctx, repo, actorID, threadEvent{
+		thread:      issueThread(repo, issue),
+		typ:         "issue.comment",
+		title:       fmt.Sprintf("New comment on issue #%d in %s/%s", issue.Number, repo.OwnerName, repo.Name),
+		body:        clipText(comment.Body, 240),
+		mentionText: comment.Body,
+		maintainers: maintainers,
+		authorID:    issue.AuthorID,
+		participant: true,
+		broadcast:   true,
+	})
+}
+
+func (s *NotificationService) NotifyIssueClosed(ctx context.Context, repo *models.Repository, issue *models.Issue, actorID int64) error {
+	maintainers, err := s.repoMaintainerIDs(ctx, repo)
+	if err != nil {
+		return err
+	}
+	return s.notifyThread(ctx, repo, actorID, threadEvent{
+		thread:      issueThread(repo, issue),
+		typ:         "issue.closed",
+		title:       fmt.Sprintf("Issue #%d closed in %s/%s", issue.Number, repo.OwnerName, repo.Name),
+		body:        clipText(issue.Title, 240),
+		maintainers: maintainers,
+		authorID:    issue.AuthorID,
+		broadcast:   true,
+	})
+}
+
+// threadEvent describes one notification-worthy change to a thread.
+type threadEvent struct {
+	thread           notificationThread
+	typ, title, body string
+	// mentionText is scanned for @mentions.
+	mentionText string
+	// maintainers hear about the event as implicit repo watchers unless they
+	// chose a watch level of participating or ignore.
+	maintainers []int64
+	authorID    int64
+	// requested users are notified with reason review_requested.
+	requested []int64
+	// participant subscribes the actor to the thread.
+	participant bool
+	// broadcast includes thread subscribers and users watching all activity.
+	broadcast bool
+}
+
+type notificationRecipient struct {
+	reason string
+	// participating is set when the user is involved in the thread itself
+	// rather than only watching the repository.
+	participating bool
+}
+
+var notificationReasonRank = map[string]int{
+	models.NotificationReasonSubscribed:      1,
+	models.NotificationReasonAuthor:          2,
+	models.NotificationReasonReviewRequested: 3,
+	models.NotificationReasonMention:         4,
+}
+
+// notifyThread computes the recipients of an event and creates their
+// notifications. Candidates come from the event (maintainers, thread author,
+// requested reviewers), thread subscriptions, repo watchers and @mentions.
+// Users ignoring the repository are never notified; users who unsubscribed
+// from the thread are only notified when mentioned; users watching at the
+// participating level only hear about threads they are involved in.
+func (s *NotificationService) notifyThread(ctx context.Context, repo *models.Repository, actorID int64, ev threadEvent) error {
+	var order []int64
+	recipients := make(map[int64]*notificationRecipient)
+	add := func(userID int64, reason string, participating bool) {
+		if userID <= 0 || userID == actorID {
+			return
+		}
+		r, ok := recipients[userID]
+		if !ok {
+			r = &notificationRecipient{reason: reason}
+			recipients[userID] = r
+			order = append(order, userID)
+		} else if notificationReasonRank[reason] > notificationReasonRank[r.reason] {
+			r.reason = reason
+		}
+		r.participating = r.participating || participating
+	}
+
+	thread := ev.thread
+	if ev.participant && actorID > 0 {
+		if err := s.db.EnsureThreadSubscription(ctx, &models.ThreadSubscription{
+			UserID:     actorID,
+			RepoID:     repo.ID,
+			ThreadType: thread.typ,
+			ThreadID:   thread.id,
+			Reason:     models.SubscriptionReasonComment,
+			Subscribed: true,
+		}); err != nil {
+			return err
+		}
+	}
+
+	mentioned, err := s.mentionedUserIDs(ctx, repo, ev.mentionText, actorID)
+	if err != nil {
+		return err
+	}
+	for _, userID := range mentioned {
+		if err := s.db.EnsureThreadSubscription(ctx, &models.ThreadSubscription{
+			UserID:     userID,
+			RepoID:     repo.ID,
+			ThreadType: thread.typ,
+			ThreadID:   thread.id,
+			Reason:     models.SubscriptionReasonMention,
+			Subscribed: true,
+		}); err != nil {
+			return err
+		}
+		add(userID, models.NotificationReasonMention, true)
+	}
+	for _, userID := range ev.requested {
+		add(userID, models.NotificationReasonReviewRequested, true)
+	}
+
+	unsubscribed := make(map[int64]bool)
+	if ev.broadcast {
+		for _, userID := range ev.maintainers {
+			add(userID, models.NotificationReasonSubscribed, false)
+		}
+		add(ev.authorID, models.NotificationReasonAuthor, true)
+		subs, err := s.db.ListThreadSubscriptions(ctx, thread.typ, thread.id)
+		if err != nil {
+			return err
+		}
+		for _, sub := range subs {
+			switch {
+			case !sub.Subscribed:
+				unsubscribed[sub.UserID] = true
+			case sub.Reason == models.SubscriptionReasonReviewRequested:
+				add(sub.UserID, models.NotificationReasonReviewRequested, true)
+			default:
+				add(sub.UserID, models.NotificationReasonSubscribed, true)
+			}
+		}
+	}
+
+	watches, err := s.db.ListRepoWatches(ctx, repo.ID)
+	if err != nil {
+		return err
+	}
+	levels := make(map[int64]string, len(watches))
+	for _, w := range watches {
+		levels[w.UserID] = w.Level
+		if ev.broadcast && w.Level == models.WatchLevelAll {
+			add(w.UserID, models.NotificationReasonSubscribed, false)
+		}
+	}
+
 	repoID := repo.ID
-	issueID := issue.ID
-	return s.notify(ctx, recipients, actorID,
-		"issue.comment",
-		fmt.Sprintf("New comment on issue #%d in %s/%s", issue.Number, repo.OwnerName, repo.Name),
-		clipText(comment.Body, 240),
-		fmt.Sprintf("/%s/%s/issues/%d", repo.OwnerName, repo.Name, issue.Number),
-		&repoID, nil, &issueID,
-	)
+	for _, userID := range order {
+		r := recipients[userID]
+		switch {
+		case levels[userID] == models.WatchLevelIgnore:
+			continue
+		case unsubscribed[userID] && r.reason != models.NotificationReasonMention:
+			continue
+		case !r.participating && levels[userID] == models.WatchLevelParticipating:
+			continue
+		}
+		ok, err := s.canRead(ctx, repo, userID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		n := &models.Notification{
+			UserID:       userID,
+			ActorID:      actorID,
+			Type:         ev.typ,
+			Title:        ev.title,
+			Body:         ev.body,
+			ResourcePath: thread.path,
+			RepoID:       &repoID,
+			PRID:         thread.prID,
+			IssueID:      thread.issID,
+			Reason:       r.reason,
+		}
+		if r.reason == models.NotificationReasonMention {
+			n.Type = thread.typ + ".mention"
+			n.Title = fmt.Sprintf("You were mentioned in %s in %s/%s", thread.label, repo.OwnerName, repo.Name)
+			n.Body = clipText(ev.mentionText, 240)
+		}
+		if err := s.deliver(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mentionedUserIDs resolves @user and @org/team mentions in text to users
+// who can read repo, excluding the actor.
+func (s *NotificationService) mentionedUserIDs(ctx context.Context, repo *models.Repository, text string, actorID int64) ([]int64, error) {
+	var candidates []int64
+	for _, m := range parseMentions(text) {
+		if m.Team != "" {
+			if s.teamResolver == nil {
+				continue
+			}
+			members, err := s.teamResolver(ctx, m.Name, m.Team)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					continue
+				}
+				return nil, err
+			}
+			candidates = append(candidates, members...)
+			continue
+		}
+		user, err := s.db.GetUserByUsername(ctx, m.Name)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return nil, err
+		}
+		candidates = append(candidates, user.ID)
+	}
+	var ids []int64
+	seen := make(map[int64]bool, len(candidates))
+	for _, userID := range candidates {
+		if userID == actorID || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		ok, err := s.canRead(ctx, repo, userID)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ids = append(ids, userID)
+		}
+	}
+	return ids, nil
+}
+
+func (s *NotificationService) canRead(ctx context.Context, repo *models.Repository, userID int64) (bool, error) {
+	if !repo.IsPrivate {
+		return true, nil
+	}
+	if s.accessCheck != nil {
+		return s.accessCheck(ctx, repo, userID, false)
+	}
+	if repo.OwnerUserID != nil && *repo.OwnerUserID == userID {
+		return true, nil
+	}
+	if repo.OwnerOrgID != nil {
+		if _, err := s.db.GetOrgMember(ctx, *repo.OwnerOrgID, userID); err == nil {
+			return true, nil
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return false, err
+		}
+	}
+	if _, err := s.db.GetCollaborator(ctx, repo.ID, userID); err == nil {
+		return true, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	return false, nil
+}
+
+// NotifyWebhookDisabled tells repository admins, or org owners for org
+// webhooks, that a webhook was disabled after failing continuously.
+func (s *NotificationService) NotifyWebhookDisabled(ctx context.Context, hook *models.Webhook, reason string) error {
+	var adminIDs []int64
+	var repoID *int64
+	var scope, path string
+	if hook.OrgID != 0 {
+		org, err := s.db.GetOrgByID(ctx, hook.OrgID)
+		if err != nil {
+			return err
+		}
+		if adminIDs, err = s.orgOwnerIDs(ctx, org.ID); err != nil {
+			return err
+		}
+		scope = "org " + org.Name
+	} else {
+		repo, err := s.db.GetRepositoryByID(ctx, hook.RepoID)
+		if err != nil {
+			return err
+		}
+		if adminIDs, err = s.repoAdminIDs(ctx, repo); err != nil {
+			return err
+		}
+		repoID = &repo.ID
+		scope = repo.OwnerName + "/" + repo.Name
+		path = fmt.Sprintf("/%s/%s/settings", repo.OwnerName, repo.Name)
+	}
+	seen := make(map[int64]bool, len(adminIDs))
+	for _, userID := range adminIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		n := &models.Notification{
+			UserID:       userID,
+			ActorID:      userID,
+			Type:         "webhook.disabled",
+			Title:        fmt.Sprintf("Webhook %d in %s was disabled", hook.ID, scope),
+			Body:         clipText(hook.URL+": "+reason, 240),
+			ResourcePath: path,
+			RepoID:       repoID,
+		}
+		if err := s.deliver(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NotifyInvitation tells an invitee with an account about a pending
+// invitation. Email-only invitations are mailed by the InvitationService.
+func (s *NotificationService) NotifyInvitation(ctx context.Context, inv *models.Invitation) error {
+	if inv.InviteeID == nil {
+		return nil
+	}
+	return s.deliver(ctx, &models.Notification{
+		UserID:       *inv.InviteeID,
+		ActorID:      inv.InviterID,
+		Type:         "invitation",
+		Title:        fmt.Sprintf("%s invited you to join %s", inv.InviterName, inv.Target),
+		Body:         fmt.Sprintf("Role: %s. The invitation expires on %s.", inv.Role, inv.ExpiresAt.Format("January 2, 2006")),
+		ResourcePath: invitationPath(inv),
+		RepoID:       inv.RepoID,
+		Reason:       "invitation",
+	})
+}
+
+// WithdrawInvitation removes the notification about an invitation that was
+// accepted, declined, revoked or replaced.
+func (s *NotificationService) WithdrawInvitation(ctx context.Context, inv *models.Invitation) error {
+	if inv.InviteeID == nil {
+		return nil
+	}
+	return s.db.DeleteNotificationsForResource(ctx, *inv.InviteeID, invitationPath(inv))
+}
+
+func invitationPath(inv *models.Invitation) string {
+	return fmt.Sprintf("/invitations/%d", inv.ID)
+}
+
+// repoAdminIDs returns the owner, org owners and admin collaborators of repo.
+func (s *NotificationService) repoAdminIDs(ctx context.Context, repo *models.Repository) ([]int64, error) {
+	var ids []int64
+	if repo.OwnerUserID != nil {
+		ids = append(ids, *repo.OwnerUserID)
+	}
+	if repo.OwnerOrgID != nil {
+		owners, err := s.orgOwnerIDs(ctx, *repo.OwnerOrgID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, owners...)
+	}
+	collaborators, err := s.db.ListCollaborators(ctx, repo.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range collaborators {
+		if strings.EqualFold(strings.TrimSpace(c.Role), "admin") {
+			ids = append(ids, c.UserID)
+		}
+	}
+	return ids, nil
+}
+
+func (s *NotificationService) orgOwnerIDs(ctx context.Context, orgID int64) ([]int64, error) {
+	members, err := s.db.ListOrgMembers(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, m := range members {
+		if strings.EqualFold(strings.TrimSpace(m.Role), "owner") {
+			ids = append(ids, m.UserID)
+		}
+	}
+	return ids, nil
 }
 
 func (s *NotificationService) repoMaintainerIDs(ctx context.Context, repo *models.Repository) ([]int64, error) {
@@ -121,31 +624,6 @@ func (s *NotificationService) repoMaintainerIDs(ctx context.Context, repo *model
 	return ids, nil
 }
 
-func (s *NotificationService) notify(ctx context.Context, recipients []int64, actorID int64, typ, title, body, path string, repoID, prID, issueID *int64) error {
-	seen := make(map[int64]bool, len(recipients))
-	for _, userID := range recipients {
-		if userID <= 0 || userID == actorID || seen[userID] {
-			continue
-		}
-		seen[userID] = true
-		n := &models.Notification{
-			UserID:       userID,
-			ActorID:      actorID,
-			Type:         typ,
-			Title:        title,
-			Body:         body,
-			ResourcePath: path,
-			RepoID:       repoID,
-			PRID:         prID,
-			IssueID:      issueID,
-		}
-		if err := s.db.CreateNotification(ctx, n); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func clipText(s string, max int) string {
 	s = strings.TrimSpace(s)
 	if len(s) <= max {
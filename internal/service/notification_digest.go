@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	gomail "github.com/odvcencio/gothub/internal/mail"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+// digestMaxNotifications bounds one digest. Anything beyond it stays
+// unemailed and goes out with the next period's digest.
+const digestMaxNotifications = 500
+
+var ErrInvalidEmailFrequency = errors.New("email frequency must be instant, daily or weekly")
+
+// GetNotificationSettings returns userID's notification settings, defaulting
+// to instant email when none are stored.
+func (s *NotificationService) GetNotificationSettings(ctx context.Context, userID int64) (*models.NotificationSettings, error) {
+	settings, err := s.db.GetNotificationSettings(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.NotificationSettings{UserID: userID, EmailFrequency: models.EmailFrequencyInstant}, nil
+	}
+	return settings, err
+}
+
+// SetEmailFrequency chooses between instant notification email and a daily
+// or weekly digest.
+func (s *NotificationService) SetEmailFrequency(ctx context.Context, userID int64, frequency string) (*models.NotificationSettings, error) {
+	frequency = strings.ToLower(strings.TrimSpace(frequency))
+	switch frequency {
+	case models.EmailFrequencyInstant, models.EmailFrequencyDaily, models.EmailFrequencyWeekly:
+	default:
+		return nil, ErrInvalidEmailFrequency
+	}
+	if err := s.db.UpsertNotificationSettings(ctx, &models.NotificationSettings{UserID: userID, EmailFrequency: frequency}); err != nil {
+		return nil, err
+	}
+	return s.db.GetNotificationSettings(ctx, userID)
+}
+
+// SendDueDigests queues a digest for every daily user who has not had one
+// this UTC day and every weekly user who has not had one this ISO week, and
+// returns how many were sent. Users with nothing to report are marked done
+// for the period without an email.
+func (s *NotificationService) SendDueDigests(ctx context.Context, now time.Time) (int, error) {
+	if s.mailSvc == nil {
+		return 0, nil
+	}
+	now = now.UTC()
+	sent := 0
+	for _, frequency := range []string{models.EmailFrequencyDaily, models.EmailFrequencyWeekly} {
+		recipients, err := s.db.ListDigestRecipients(ctx, frequency, digestPeriodStart(frequency, now))
+		if err != nil {
+			return sent, err
+		}
+		for _, recipient := range recipients {
+			if err := ctx.Err(); err != nil {
+				return sent, err
+			}
+			ok, err := s.sendDigest(ctx, recipient.UserID, frequency, now)
+			if err != nil {
+				return sent, fmt.Errorf("digest for user %d: %w", recipient.UserID, err)
+			}
+			if ok {
+				sent++
+			}
+		}
+	}
+	return sent, nil
+}
+
+func (s *NotificationService) sendDigest(ctx context.Context, userID int64, frequency string, now time.Time) (bool, error) {
+	notifications, err := s.db.ListUnemailedNotifications(ctx, userID, digestMaxNotifications)
+	if err != nil {
+		return false, err
+	}
+	awaitingReview, err := s.db.CountPRsAwaitingReview(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	failingChecks, err := s.db.CountPRsWithFailingChecks(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if len(notifications) == 0 && awaitingReview == 0 && failingChecks == 0 {
+		return false, s.db.SetNotificationDigestSent(ctx, userID, now)
+	}
+	user, err := s.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	data := buildDigest(notifications)
+	data.Period = frequency
+	data.AwaitingReview = awaitingReview
+	data.FailingChecks = failingChecks
+	data.Link = "/notifications"
+	data.SettingsLink = "/settings"
+	if err := s.mailSvc.SendDigest(ctx, user, data); err != nil {
+		return false, err
+	}
+	ids := make([]int64, 0, len(notifications))
+	for _, n := range notifications {
+		ids = append(ids, n.ID)
+	}
+	if err := s.db.MarkNotificationsEmailed(ctx, userID, ids, now); err != nil {
+		return false, err
+	}
+	return true, s.db.SetNotificationDigestSent(ctx, userID, now)
+}
+
+// digestPeriodStart is the start of the UTC day or ISO week containing now.
+// Users whose last digest predates it are due.
+func digestPeriodStart(frequency string, now time.Time) time.Time {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if frequency != models.EmailFrequencyWeekly {
+		return day
+	}
+	sinceMonday := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -sinceMonday)
+}
+
+// buildDigest groups notifications, oldest first, by repository and thread.
+// Repositories and threads keep the order in which they first appear.
+func buildDigest(notifications []models.Notification) gomail.DigestData {
+	data := gomail.DigestData{Unread: len(notifications)}
+	repoIndex := map[string]int{}
+	threadIndex := map[string]int{}
+	for _, n := range notifications {
+		repoName := digestRepoName(n.ResourcePath)
+		ri, ok := repoIndex[repoName]
+		if !ok {
+			ri = len(data.Repos)
+			repoIndex[repoName] = ri
+			data.Repos = append(data.Repos, gomail.DigestRepo{Name: repoName})
+		}
+		key := repoName + "\x00" + digestThreadKey(&n)
+		ti, ok := threadIndex[key]
+		if !ok {
+			ti = len(data.Repos[ri].Threads)
+			threadIndex[key] = ti
+			data.Repos[ri].Threads = append(data.Repos[ri].Threads, gomail.DigestThread{Link: n.ResourcePath})
+		}
+		thread := &data.Repos[ri].Threads[ti]
+		thread.Title = n.Title
+		thread.Updates++
+	}
+	return data
+}
+
+func digestThreadKey(n *models.Notification) string {
+	if threadType, threadID := notificationThreadRef(n); threadType != "" {
+		return fmt.Sprintf("%s:%d", threadType, threadID)
+	}
+	return n.ResourcePath
+}
+
+// digestRepoName takes "owner/repo" from a resource path such as
+// /owner/repo/issues/3.
+func digestRepoName(path string) string {
+	parts := strings.SplitN(strings.Trim(path, "/"), "/", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "Other"
+	}
+	return parts[0] + "/" + parts[1]
+}
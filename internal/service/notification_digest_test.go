@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+func TestNotificationDigestGroupsAndMarksDelivered(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", PasswordHash: "x"}
+	for _, u := range []*models.User{alice, bob} {
+		if err := db.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo := &models.Repository{OwnerUserID: &bob.ID, Name: "repo", DefaultBranch: "main", StoragePath: "pending"}
+	if err := db.CreateRepository(ctx, repo); err != nil {
+		t.Fatal(err)
+	}
+	bobsPR := &models.PullRequest{RepoID: repo.ID, Title: "Speed up", State: "open", AuthorID: bob.ID, SourceBranch: "fast", TargetBranch: "main"}
+	alicesPR := &models.PullRequest{RepoID: repo.ID, Title: "Fix crash", State: "open", AuthorID: alice.ID, SourceBranch: "fix", TargetBranch: "main"}
+	for _, pr := range []*models.PullRequest{bobsPR, alicesPR} {
+		if err := db.CreatePullRequest(ctx, pr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetThreadSubscription(ctx, &models.ThreadSubscription{
+		UserID: alice.ID, RepoID: repo.ID, ThreadType: models.ThreadTypePullRequest, ThreadID: bobsPR.ID,
+		Reason: models.SubscriptionReasonReviewRequested, Subscribed: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpsertPRCheckRun(ctx, &models.PRCheckRun{PRID: alicesPR.ID, Name: "ci", Status: "completed", Conclusion: "failure"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sender := &recordingSender{}
+	mailSvc := NewMailService(db, sender, MailOptions{BaseURL: "https://gothub.test"})
+	notifySvc := NewNotificationService(db)
+	notifySvc.SetMailService(mailSvc)
+	if _, err := notifySvc.SetEmailFrequency(ctx, alice.ID, "hourly"); err != ErrInvalidEmailFrequency {
+		t.Fatalf("expected invalid frequency to be rejected, got %v", err)
+	}
+	if _, err := notifySvc.SetEmailFrequency(ctx, alice.ID, models.EmailFrequencyDaily); err != nil {
+		t.Fatal(err)
+	}
+
+	prID := bobsPR.ID
+	for i := 0; i < 3; i++ {
+		if err := notifySvc.deliver(ctx, &models.Notification{
+			UserID: alice.ID, ActorID: bob.ID, Type: "pull_request.comment",
+			Title:        "New comment on PR #1 in bob/repo",
+			ResourcePath: "/bob/repo/pulls/1", RepoID: &repo.ID, PRID: &prID,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if claimed, err := mailSvc.ProcessNext(ctx); err != nil || claimed {
+		t.Fatalf("daily digest users should not get instant email: claimed=%v err=%v", claimed, err)
+	}
+
+	now := time.Date(2026, 3, 4, 9, 0, 0, 0, time.UTC)
+	sent, err := notifySvc.SendDueDigests(ctx, now)
+	if err != nil || sent != 1 {
+		t.Fatalf("SendDueDigests = %d, %v", sent, err)
+	}
+	if claimed, err := mailSvc.ProcessNext(ctx); err != nil || !claimed {
+		t.Fatalf("expected digest to be queued: claimed=%v err=%v", claimed, err)
+	}
+	msg := sender.sent[0]
+	for _, want := range []string{
+		"bob/repo",
+		"New comment on PR #1 in bob/repo (3 updates)",
+		"https://gothub.test/bob/repo/pulls/1",
+		"1 pull request is waiting for your review.",
+		"1 of your pull requests has failing checks.",
+	} {
+		if !strings.Contains(msg.Text, want) {
+			t.Fatalf("digest missing %q:\n%s", want, msg.Text)
+		}
+	}
+	if msg.Subject != "Your daily gothub digest: 3 unread" {
+		t.Fatalf("unexpected subject %q", msg.Subject)
+	}
+	if pending, err := db.ListUnemailedNotifications(ctx, alice.ID, 10); err != nil || len(pending) != 0 {
+		t.Fatalf("expected digest items to be marked delivered, got %d (%v)", len(pending), err)
+	}
+
+	// Already sent today; due again tomorrow.
+	if sent, err := notifySvc.SendDueDigests(ctx, now.Add(6*time.Hour)); err != nil || sent != 0 {
+		t.Fatalf("expected no second digest the same day: %d, %v", sent, err)
+	}
+	if err := db.CreatePRReview(ctx, &models.PRReview{PRID: bobsPR.ID, AuthorID: alice.ID, State: "approved"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.CountPRsAwaitingReview(ctx, alice.ID); err != nil || n != 0 {
+		t.Fatalf("expected review to clear the request, got %d (%v)", n, err)
+	}
+	if sent, err := notifySvc.SendDueDigests(ctx, now.Add(24*time.Hour)); err != nil || sent != 1 {
+		t.Fatalf("expected next day's digest for the failing checks: %d, %v", sent, err)
+	}
+}
+
+func TestDigestPeriodStart(t *testing.T) {
+	wed := time.Date(2026, 3, 4, 17, 30, 0, 0, time.UTC)
+	if got := digestPeriodStart(models.EmailFrequencyDaily, wed); !got.Equal(time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("daily period start = %v", got)
+	}
+	if got := digestPeriodStart(models.EmailFrequencyWeekly, wed); !got.Equal(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("weekly period start = %v", got)
+	}
+	sun := time.Date(2026, 3, 8, 1, 0, 0, 0, time.UTC)
+	if got := digestPeriodStart(models.EmailFrequencyWeekly, sun); !got.Equal(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("weekly period start on Sunday = %v", got)
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+var ErrInvalidWatchLevel = errors.New("watch level must be all, participating or ignore")
+
+// RepoWatch returns the user's watch level for a repository. Users who never
+// chose a level are reported as participating.
+func (s *NotificationService) RepoWatch(ctx context.Context, userID, repoID int64) (*models.RepoWatch, error) {
+	w, err := s.db.GetRepoWatch(ctx, userID, repoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.RepoWatch{UserID: userID, RepoID: repoID, Level: models.WatchLevelParticipating}, nil
+	}
+	return w, err
+}
+
+func (s *NotificationService) WatchRepo(ctx context.Context, userID, repoID int64, level string) (*models.RepoWatch, error) {
+	level = strings.ToLower(strings.TrimSpace(level))
+	switch level {
+	case models.WatchLevelAll, models.WatchLevelParticipating, models.WatchLevelIgnore:
+	default:
+		return nil, ErrInvalidWatchLevel
+	}
+	w := &models.RepoWatch{UserID: userID, RepoID: repoID, Level: level}
+	if err := s.db.SetRepoWatch(ctx, w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// UnwatchRepo resets the user's watch level to the default.
+func (s *NotificationService) UnwatchRepo(ctx context.Context, userID, repoID int64) error {
+	return s.db.DeleteRepoWatch(ctx, userID, repoID)
+}
+
+// ThreadSubscription returns the user's subscription to an issue or pull
+// request. Users without one are reported as unsubscribed.
+func (s *NotificationService) ThreadSubscription(ctx context.Context, userID, repoID int64, threadType string, threadID int64) (*models.ThreadSubscription, error) {
+	sub, err := s.db.GetThreadSubscription(ctx, userID, threadType, threadID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.ThreadSubscription{UserID: userID, RepoID: repoID, ThreadType: threadType, ThreadID: threadID}, nil
+	}
+	return sub, err
+}
+
+// SetThreadSubscription explicitly subscribes or unsubscribes a user from an
+// issue or pull request. An explicit unsubscribe suppresses everything but
+// direct mentions on that thread.
+func (s *NotificationService) SetThreadSubscription(ctx context.Context, userID, repoID int64, threadType string, threadID int64, subscribed bool) (*models.ThreadSubscription, error) {
+	switch threadType {
+	case models.ThreadTypeIssue, models.ThreadTypePullRequest:
+	default:
+		return nil, fmt.Errorf("unknown thread type %q", threadType)
+	}
+	sub := &models.ThreadSubscription{
+		UserID:     userID,
+		RepoID:     repoID,
+		ThreadType: threadType,
+		ThreadID:   threadID,
+		Reason:     models.SubscriptionReasonManual,
+		Subscribed: subscribed,
+	}
+	if err := s.db.SetThreadSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
@@ -0,0 +1,464 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+// Prefixes tell OAuth credentials apart from session JWTs and personal
+// access tokens. Only access tokens are accepted as bearer credentials.
+const (
+	OAuthAccessTokenPrefix  = "gpo_"
+	OAuthRefreshTokenPrefix = "gpr_"
+	oauthClientIDPrefix     = "gpc_"
+	oauthClientSecretPrefix = "gps_"
+)
+
+const (
+	oauthCodeTTL         = 10 * time.Minute
+	oauthAccessTokenTTL  = time.Hour
+	oauthRefreshTokenTTL = 30 * 24 * time.Hour
+	maxOAuthRedirectURIs = 10
+)
+
+var (
+	ErrOAuthAppNotFound      = errors.New("oauth app not found")
+	ErrInvalidOAuthApp       = errors.New("invalid oauth app")
+	ErrInvalidRedirectURI    = errors.New("invalid redirect uri")
+	ErrInvalidOAuthClient    = errors.New("invalid client credentials")
+	ErrInvalidOAuthGrant     = errors.New("invalid or expired grant")
+	ErrInvalidOAuthToken     = errors.New("invalid oauth token")
+	ErrUnsupportedPKCEMethod = errors.New("code_challenge_method must be S256")
+)
+
+// OAuthTokenGrant is the token endpoint response (RFC 6749 section 5.1).
+type OAuthTokenGrant struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// OAuthService runs gothub's OAuth2 authorization server: app registration,
+// the authorization code grant with optional PKCE, refresh token rotation
+// and revocation.
+type OAuthService struct {
+	db  database.DB
+	now func() time.Time
+}
+
+func NewOAuthService(db database.DB) *OAuthService {
+	return &OAuthService{db: db, now: func() time.Time { return time.Now().UTC() }}
+}
+
+// CreateApp registers an app and returns it with its client secret, which
+// is not stored and cannot be recovered later.
+func (s *OAuthService) CreateApp(ctx context.Context, ownerID int64, name, homepageURL string, redirectURIs []string) (*models.OAuthApp, string, error) {
+	app := &models.OAuthApp{OwnerID: ownerID}
+	if err := applyOAuthAppFields(app, name, homepageURL, redirectURIs); err != nil {
+		return nil, "", err
+	}
+	clientID, err := randomOAuthValue(oauthClientIDPrefix, 10)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomOAuthValue(oauthClientSecretPrefix, 32)
+	if err != nil {
+		return nil, "", err
+	}
+	app.ClientID = clientID
+	app.ClientSecretHash = hashAccessToken(secret)
+	if err := s.db.CreateOAuthApp(ctx, app); err != nil {
+		return nil, "", err
+	}
+	expandOAuthApp(app)
+	return app, secret, nil
+}
+
+func (s *OAuthService) ListApps(ctx context.Context, ownerID int64) ([]models.OAuthApp, error) {
+	apps, err := s.db.ListOAuthApps(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range apps {
+		expandOAuthApp(&apps[i])
+	}
+	return apps, nil
+}
+
+// GetApp returns one of the owner's apps.
+func (s *OAuthService) GetApp(ctx context.Context, ownerID, id int64) (*models.OAuthApp, error) {
+	app, err := s.db.GetOAuthApp(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && app.OwnerID != ownerID) {
+		return nil, ErrOAuthAppNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	expandOAuthApp(app)
+	return app, nil
+}
+
+func (s *OAuthService) UpdateApp(ctx context.Context, ownerID, id int64, name, homepageURL string, redirectURIs []string) (*models.OAuthApp, error) {
+	app, err := s.GetApp(ctx, ownerID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyOAuthAppFields(app, name, homepageURL, redirectURIs); err != nil {
+		return nil, err
+	}
+	if err := s.db.UpdateOAuthApp(ctx, app); err != nil {
+		return nil, err
+	}
+	expandOAuthApp(app)
+	return app, nil
+}
+
+// ResetSecret replaces the app's client secret. Issued tokens stay valid.
+func (s *OAuthService) ResetSecret(ctx context.Context, ownerID, id int64) (*models.OAuthApp, string, error) {
+	app, err := s.GetApp(ctx, ownerID, id)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomOAuthValue(oauthClientSecretPrefix, 32)
+	if err != nil {
+		return nil, "", err
+	}
+	app.ClientSecretHash = hashAccessToken(secret)
+	if err := s.db.UpdateOAuthApp(ctx, app); err != nil {
+		return nil, "", err
+	}
+	return app, secret, nil
+}
+
+// DeleteApp removes the app along with every grant and token it holds.
+func (s *OAuthService) DeleteApp(ctx context.Context, ownerID, id int64) error {
+	if _, err := s.GetApp(ctx, ownerID, id); err != nil {
+		return err
+	}
+	return s.db.DeleteOAuthApp(ctx, id, ownerID)
+}
+
+// PrepareAuthorization validates an authorization request before the user
+// is asked to consent. An empty redirectURI selects the app's only
+// registered URI; an empty scope asks for repo:read.
+func (s *OAuthService) PrepareAuthorization(ctx context.Context, clientID, redirectURI, scope string) (*models.OAuthApp, string, []string, error) {
+	app, err := s.db.GetOAuthAppByClientID(ctx, strings.TrimSpace(clientID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", nil, ErrOAuthAppNotFound
+	}
+	if err != nil {
+		return nil, "", nil, err
+	}
+	expandOAuthApp(app)
+	switch {
+	case redirectURI == "" && len(app.RedirectURIs) == 1:
+		redirectURI = app.RedirectURIs[0]
+	case !slices.Contains(app.RedirectURIs, redirectURI):
+		return nil, "", nil, ErrInvalidRedirectURI
+	}
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		requested = []string{auth.ScopeRepoRead}
+	}
+	scopes, err := normalizeTokenScopes(requested)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return app, redirectURI, scopes, nil
+}
+
+// Authorize records the user's consent and returns a single-use code for
+// the app to exchange at the token endpoint. The app, redirect URI and
+// scopes must come from PrepareAuthorization.
+func (s *OAuthService) Authorize(ctx context.Context, userID int64, app *models.OAuthApp, redirectURI string, scopes []string, codeChallenge, codeChallengeMethod string) (string, error) {
+	if codeChallenge != "" && codeChallengeMethod != "S256" {
+		return "", ErrUnsupportedPKCEMethod
+	}
+	code, err := randomOAuthValue("", 32)
+	if err != nil {
+		return "", err
+	}
+	scopesCSV := strings.Join(scopes, ",")
+	if err := s.db.CreateOAuthAuthorizationCode(ctx, &models.OAuthAuthorizationCode{
+		AppID:         app.ID,
+		UserID:        userID,
+		CodeHash:      hashAccessToken(code),
+		RedirectURI:   redirectURI,
+		ScopesCSV:     scopesCSV,
+		CodeChallenge: codeChallenge,
+		ExpiresAt:     s.now().Add(oauthCodeTTL),
+	}); err != nil {
+		return "", err
+	}
+	if err := s.db.UpsertOAuthAuthorization(ctx, &models.OAuthAuthorization{AppID: app.ID, UserID: userID, ScopesCSV: scopesCSV}); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Exchange trades an authorization code for tokens.
+func (s *OAuthService) Exchange(ctx context.Context, clientID, clientSecret, code, redirectURI, codeVerifier string) (*OAuthTokenGrant, error) {
+	app, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	grant, err := s.db.ConsumeOAuthAuthorizationCode(ctx, hashAccessToken(code), s.now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidOAuthGrant
+	}
+	if err != nil {
+		return nil, err
+	}
+	if grant.AppID != app.ID || grant.RedirectURI != redirectURI {
+		return nil, ErrInvalidOAuthGrant
+	}
+	if grant.CodeChallenge != "" {
+		sum := sha256.Sum256([]byte(codeVerifier))
+		if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(grant.CodeChallenge)) != 1 {
+			return nil, ErrInvalidOAuthGrant
+		}
+	}
+	return s.issueTokens(ctx, app.ID, grant.UserID, grant.ScopesCSV)
+}
+
+// Refresh rotates a refresh token: the presented pair is revoked and a new
+// one with the same scopes is issued.
+func (s *OAuthService) Refresh(ctx context.Context, clientID, clientSecret, refreshToken string) (*OAuthTokenGrant, error) {
+	app, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.db.GetOAuthTokenByRefreshHash(ctx, hashAccessToken(refreshToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidOAuthGrant
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if token.AppID != app.ID || token.RevokedAt != nil || now.After(token.RefreshExpiresAt) {
+		return nil, ErrInvalidOAuthGrant
+	}
+	revoked, err := s.db.RevokeOAuthToken(ctx, token.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !revoked {
+		// Lost a race with another refresh of the same token.
+		return nil, ErrInvalidOAuthGrant
+	}
+	return s.issueTokens(ctx, app.ID, token.UserID, token.ScopesCSV)
+}
+
+// RevokeToken revokes the pair that token (access or refresh) belongs to,
+// if the client owns it. Unknown tokens are not an error (RFC 7009).
+func (s *OAuthService) RevokeToken(ctx context.Context, clientID, clientSecret, token string) error {
+	app, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+	lookup := s.db.GetOAuthTokenByAccessHash
+	if strings.HasPrefix(token, OAuthRefreshTokenPrefix) {
+		lookup = s.db.GetOAuthTokenByRefreshHash
+	}
+	t, err := lookup(ctx, hashAccessToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if t.AppID != app.ID {
+		return nil
+	}
+	_, err = s.db.RevokeOAuthToken(ctx, t.ID, s.now())
+	return err
+}
+
+// Authenticate resolves an access token into scoped claims, rejecting
+// unknown, revoked and expired tokens, and records its use.
+func (s *OAuthService) Authenticate(ctx context.Context, plain string) (*auth.Claims, error) {
+	token, err := s.db.GetOAuthTokenByAccessHash(ctx, hashAccessToken(plain))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidOAuthToken
+		}
+		return nil, err
+	}
+	now := s.now()
+	if token.RevokedAt != nil || now.After(token.AccessExpiresAt) {
+		return nil, ErrInvalidOAuthToken
+	}
+	user, err := s.db.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidOAuthToken
+		}
+		return nil, err
+	}
+	if user.SuspendedAt != nil {
+		return nil, ErrInvalidOAuthToken
+	}
+	_ = s.db.TouchOAuthTokenUsed(ctx, token.ID, now)
+
+	return &auth.Claims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Scopes:   splitScopes(token.ScopesCSV),
+	}, nil
+}
+
+// ListAuthorizations returns the apps the user has granted access to.
+func (s *OAuthService) ListAuthorizations(ctx context.Context, userID int64) ([]models.OAuthAuthorization, error) {
+	auths, err := s.db.ListOAuthAuthorizations(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range auths {
+		auths[i].Scopes = splitScopes(auths[i].ScopesCSV)
+	}
+	return auths, nil
+}
+
+// RevokeAuthorization withdraws the user's grant to the app and revokes
+// its tokens.
+func (s *OAuthService) RevokeAuthorization(ctx context.Context, userID, appID int64) error {
+	return s.db.DeleteOAuthAuthorization(ctx, appID, userID)
+}
+
+func (s *OAuthService) authenticateClient(ctx context.Context, clientID, clientSecret string) (*models.OAuthApp, error) {
+	app, err := s.db.GetOAuthAppByClientID(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidOAuthClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAccessToken(clientSecret)), []byte(app.ClientSecretHash)) != 1 {
+		return nil, ErrInvalidOAuthClient
+	}
+	return app, nil
+}
+
+func (s *OAuthService) issueTokens(ctx context.Context, appID, userID int64, scopesCSV string) (*OAuthTokenGrant, error) {
+	access, err := randomOAuthValue(OAuthAccessTokenPrefix, 32)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := randomOAuthValue(OAuthRefreshTokenPrefix, 32)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if err := s.db.CreateOAuthToken(ctx, &models.OAuthToken{
+		AppID:            appID,
+		UserID:           userID,
+		AccessTokenHash:  hashAccessToken(access),
+		RefreshTokenHash: hashAccessToken(refresh),
+		ScopesCSV:        scopesCSV,
+		AccessExpiresAt:  now.Add(oauthAccessTokenTTL),
+		RefreshExpiresAt: now.Add(oauthRefreshTokenTTL),
+	}); err != nil {
+		return nil, err
+	}
+	return &OAuthTokenGrant{
+		AccessToken:  access,
+		TokenType:    "bearer",
+		ExpiresIn:    int(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: refresh,
+		Scope:        strings.Join(splitScopes(scopesCSV), " "),
+	}, nil
+}
+
+func applyOAuthAppFields(app *models.OAuthApp, name, homepageURL string, redirectURIs []string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidOAuthApp)
+	}
+	homepageURL = strings.TrimSpace(homepageURL)
+	if homepageURL != "" {
+		u, err := url.Parse(homepageURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("%w: homepage_url must be an http(s) URL", ErrInvalidOAuthApp)
+		}
+	}
+	if len(redirectURIs) == 0 || len(redirectURIs) > maxOAuthRedirectURIs {
+		return fmt.Errorf("%w: between 1 and %d redirect uris are required", ErrInvalidRedirectURI, maxOAuthRedirectURIs)
+	}
+	uris := make([]string, 0, len(redirectURIs))
+	for _, raw := range redirectURIs {
+		raw = strings.TrimSpace(raw)
+		if err := validateRedirectURI(raw); err != nil {
+			return err
+		}
+		if !slices.Contains(uris, raw) {
+			uris = append(uris, raw)
+		}
+	}
+	app.Name = name
+	app.HomepageURL = homepageURL
+	app.RedirectURIsCSV = strings.Join(uris, ",")
+	return nil
+}
+
+// validateRedirectURI accepts https URLs, and http only on loopback hosts
+// for apps running on the user's machine.
+func validateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Fragment != "" || strings.Contains(raw, ",") {
+		return fmt.Errorf("%w: %q", ErrInvalidRedirectURI, raw)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q must use https (http is allowed for localhost)", ErrInvalidRedirectURI, raw)
+}
+
+func expandOAuthApp(app *models.OAuthApp) {
+	app.RedirectURIs = []string{}
+	if app.RedirectURIsCSV != "" {
+		app.RedirectURIs = strings.Split(app.RedirectURIsCSV, ",")
+	}
+}
+
+func splitScopes(csv string) []string {
+	if csv == "" {
+		return []string{}
+	}
+	return strings.Split(csv, ",")
+}
+
+func randomOAuthValue(prefix string, size int) (string, error) {
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	if prefix == oauthClientIDPrefix {
+		return prefix + hex.EncodeToString(raw), nil
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	dev := &models.User{Username: "dev", Email: "dev@example.com", PasswordHash: "x"}
+	alice := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	for _, u := range []*models.User{dev, alice} {
+		if err := db.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewOAuthService(db)
+	svc.now = func() time.Time { return now }
+
+	if _, _, err := svc.CreateApp(ctx, dev.ID, "bot", "", []string{"http://bot.example.com/cb"}); !errors.Is(err, ErrInvalidRedirectURI) {
+		t.Fatalf("expected plain http redirect to be rejected, got %v", err)
+	}
+	app, secret, err := svc.CreateApp(ctx, dev.ID, "bot", "https://bot.example.com", []string{"https://bot.example.com/cb", "http://127.0.0.1:8080/cb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetApp(ctx, alice.ID, app.ID); !errors.Is(err, ErrOAuthAppNotFound) {
+		t.Fatalf("expected other users not to see the app, got %v", err)
+	}
+
+	if _, _, _, err := svc.PrepareAuthorization(ctx, app.ClientID, "https://evil.example.com/cb", ""); !errors.Is(err, ErrInvalidRedirectURI) {
+		t.Fatalf("expected unregistered redirect to be rejected, got %v", err)
+	}
+	if _, _, _, err := svc.PrepareAuthorization(ctx, app.ClientID, "", ""); !errors.Is(err, ErrInvalidRedirectURI) {
+		t.Fatalf("expected redirect to be required with several registered, got %v", err)
+	}
+	if _, _, _, err := svc.PrepareAuthorization(ctx, app.ClientID, "https://bot.example.com/cb", "repo:read sudo"); !errors.Is(err, ErrInvalidTokenScope) {
+		t.Fatalf("expected unknown scope to be rejected, got %v", err)
+	}
+	got, redirect, scopes, err := svc.PrepareAuthorization(ctx, app.ClientID, "https://bot.example.com/cb", "issues repo:read")
+	if err != nil || got.ID != app.ID || !slices.Equal(scopes, []string{"issues", "repo:read"}) {
+		t.Fatalf("PrepareAuthorization = %+v %v %v", got, scopes, err)
+	}
+
+	verifier := "a-very-long-pkce-verifier-for-the-test-0123456789"
+	sum := sha256.Sum256([]byte(verifier))
+	code, err := svc.Authorize(ctx, alice.ID, got, redirect, scopes, base64.RawURLEncoding.EncodeToString(sum[:]), "S256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Exchange(ctx, app.ClientID, "wrong", code, redirect, verifier); !errors.Is(err, ErrInvalidOAuthClient) {
+		t.Fatalf("expected bad secret to be rejected, got %v", err)
+	}
+	if _, err := svc.Exchange(ctx, app.ClientID, secret, code, redirect, "wrong-verifier"); !errors.Is(err, ErrInvalidOAuthGrant) {
+		t.Fatalf("expected bad verifier to be rejected, got %v", err)
+	}
+	// The failed attempt used up the code.
+	code, err = svc.Authorize(ctx, alice.ID, got, redirect, scopes, base64.RawURLEncoding.EncodeToString(sum[:]), "S256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grant, err := svc.Exchange(ctx, app.ClientID, secret, code, redirect, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grant.Scope != "issues repo:read" || grant.TokenType != "bearer" {
+		t.Fatalf("unexpected grant %+v", grant)
+	}
+	if _, err := svc.Exchange(ctx, app.ClientID, secret, code, redirect, verifier); !errors.Is(err, ErrInvalidOAuthGrant) {
+		t.Fatalf("expected code replay to be rejected, got %v", err)
+	}
+
+	claims, err := svc.Authenticate(ctx, grant.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != alice.ID || !claims.HasScope(auth.ScopeIssues) || claims.HasScope(auth.ScopeRepoWrite) {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+	if _, err := svc.Authenticate(ctx, grant.RefreshToken); !errors.Is(err, ErrInvalidOAuthToken) {
+		t.Fatalf("expected refresh token not to authenticate, got %v", err)
+	}
+
+	// Refreshing rotates the pair.
+	refreshed, err := svc.Refresh(ctx, app.ClientID, secret, grant.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Authenticate(ctx, grant.AccessToken); !errors.Is(err, ErrInvalidOAuthToken) {
+		t.Fatalf("expected rotated access token to be revoked, got %v", err)
+	}
+	if _, err := svc.Refresh(ctx, app.ClientID, secret, grant.RefreshToken); !errors.Is(err, ErrInvalidOAuthGrant) {
+		t.Fatalf("expected used refresh token to be rejected, got %v", err)
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err := svc.Authenticate(ctx, refreshed.AccessToken); !errors.Is(err, ErrInvalidOAuthToken) {
+		t.Fatalf("expected expired access token to be rejected, got %v", err)
+	}
+	refreshed, err = svc.Refresh(ctx, app.ClientID, secret, refreshed.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auths, err := svc.ListAuthorizations(ctx, alice.ID)
+	if err != nil || len(auths) != 1 || auths[0].AppID != app.ID || auths[0].AppName != "bot" {
+		t.Fatalf("unexpected authorizations %+v %v", auths, err)
+	}
+	if err := svc.RevokeAuthorization(ctx, alice.ID, app.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Authenticate(ctx, refreshed.AccessToken); !errors.Is(err, ErrInvalidOAuthToken) {
+		t.Fatalf("expected revoked app's token to be rejected, got %v", err)
+	}
+	if _, err := svc.Refresh(ctx, app.ClientID, secret, refreshed.RefreshToken); !errors.Is(err, ErrInvalidOAuthGrant) {
+		t.Fatalf("expected revoked app's refresh token to be rejected, got %v", err)
+	}
+	if auths, _ := svc.ListAuthorizations(ctx, alice.ID); len(auths) != 0 {
+		t.Fatalf("expected no authorizations, got %+v", auths)
+	}
+}
@@ -41,10 +41,19 @@ func (s *PRService) UpsertBranchProtectionRule(ctx context.Context, rule *models
 	if rule.RequiredApprovals <= 0 {
 		rule.RequiredApprovals = 1
 	}
+	before, err := s.GetBranchProtectionRule(ctx, rule.RepoID, rule.Branch)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
 	if err := s.db.UpsertBranchProtectionRule(ctx, rule); err != nil {
 		return err
 	}
 	rule.RequiredChecks = parseChecksCSV(rule.RequiredChecksCSV)
+	if before == nil {
+		s.audit.RecordRepoID(ctx, rule.RepoID, AuditBranchProtectionCreate, rule.Branch, nil, rule)
+	} else {
+		s.audit.RecordRepoID(ctx, rule.RepoID, AuditBranchProtectionUpdate, rule.Branch, before, rule)
+	}
 	return nil
 }
 
@@ -58,7 +67,17 @@ func (s *PRService) GetBranchProtectionRule(ctx context.Context, repoID int64, b
 }
 
 func (s *PRService) DeleteBranchProtectionRule(ctx context.Context, repoID int64, branch string) error {
-	return s.db.DeleteBranchProtectionRule(ctx, repoID, branch)
+	before, err := s.GetBranchProtectionRule(ctx, repoID, branch)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err := s.db.DeleteBranchProtectionRule(ctx, repoID, branch); err != nil {
+		return err
+	}
+	if before != nil {
+		s.audit.RecordRepoID(ctx, repoID, AuditBranchProtectionDelete, branch, before, nil)
+	}
+	return nil
 }
 
 func (s *PRService) UpsertPRCheckRun(ctx context.Context, run *models.PRCheckRun) error {
@@ -105,7 +124,7 @@ func (s *PRService) EvaluateBranchUpdateGate(ctx context.Context, repoID int64,
 		reasons = append(reasons, "direct pushes are blocked on this protected branch; open a pull request")
 	}
 	if rule.RequireSignedCommits {
-		signedReasons, err := s.evaluateSignedCommitRange(ctx, store, newHead, oldHead)
+		signedReasons, err := s.evaluateSignedCommitRange(ctx, store, repoID, newHead, oldHead)
 		if err != nil {
 			return nil, err
 		}
@@ -219,6 +238,9 @@ func (s *PRService) evaluateEntityOwnerApprovals(ctx context.Context, repoID int
 	if len(changes) == 0 {
 		return nil, nil, nil
 	}
+	if err := s.loadOrgTeamOwners(ctx, cfg); err != nil {
+		return nil, nil, err
+	}
 
 	approvedUsers := make(map[string]bool, len(reviews))
 	for authorID, review := range latestReviewsByAuthor(reviews) {
@@ -292,6 +314,29 @@ func (s *PRService) evaluateEntityOwnerApprovals(ctx context.Context, repoID int
 	return reasons, approvals, nil
 }
 
+// loadOrgTeamOwners looks up the members of the org teams cfg references.
+// Teams that do not exist are left to in-file definitions.
+func (s *PRService) loadOrgTeamOwners(ctx context.Context, cfg *gotOwnersConfig) error {
+	if s.teamSvc == nil {
+		return nil
+	}
+	for _, ref := range cfg.orgTeamRefs() {
+		org, team, _ := strings.Cut(ref, "/")
+		members, ok, err := s.teamSvc.MemberUsernames(ctx, org, team)
+		if err != nil {
+			return fmt.Errorf("resolve team @%s: %w", ref, err)
+		}
+		if !ok {
+			continue
+		}
+		if cfg.orgTeams == nil {
+			cfg.orgTeams = make(map[string][]string)
+		}
+		cfg.orgTeams[ref] = members
+	}
+	return nil
+}
+
 func (s *PRService) evaluateLintPass(ctx context.Context, repoID int64, pr *models.PullRequest) ([]string, error) {
 	store, err := s.repoSvc.OpenStoreByID(ctx, repoID)
 	if err != nil {
@@ -498,10 +543,10 @@ func (s *PRService) evaluateSignedCommits(ctx context.Context, repoID int64, pr
 		return nil, fmt.Errorf("resolve target branch %q: %w", pr.TargetBranch, err)
 	}
 
-	return s.evaluateSignedCommitRange(ctx, store, sourceHead, targetHead)
+	return s.evaluateSignedCommitRange(ctx, store, repoID, sourceHead, targetHead)
 }
 
-func (s *PRService) evaluateSignedCommitRange(ctx context.Context, store *gotstore.RepoStore, sourceHead, targetHead object.Hash) ([]string, error) {
+func (s *PRService) evaluateSignedCommitRange(ctx context.Context, store *gotstore.RepoStore, repoID int64, sourceHead, targetHead object.Hash) ([]string, error) {
 	commitHashes, err := sourceOnlyCommits(store.Objects, sourceHead, targetHead)
 	if err != nil {
 		return nil, err
@@ -516,14 +561,14 @@ func (s *PRService) evaluateSignedCommitRange(ctx context.Context, store *gotsto
 		if err != nil {
 			return nil, fmt.Errorf("read commit %q: %w", string(h), err)
 		}
-		verified, _, err := verifyCommitSignature(ctx, s.db, commit)
+		v, err := s.repoSvc.verifyCommit(ctx, store.Objects, repoID, h, commit)
 		if err != nil {
 			return nil, fmt.Errorf("verify commit %q signature: %w", string(h), err)
 		}
-		if verified {
+		if v.Verified() {
 			continue
 		}
-		reasons = append(reasons, fmt.Sprintf("commit %s is not signed or signature is unverified", shortHash(h)))
+		reasons = append(reasons, fmt.Sprintf("commit %s is not signed or signature is unverified (%s)", shortHash(h), v.Status))
 	}
 	sort.Strings(reasons)
 	return reasons, nil
@@ -755,7 +800,11 @@ func formatTeamRefs(teams []string) string {
 	}
 	refs := make([]string, len(teams))
 	for i, t := range teams {
-		refs[i] = "@team/" + t
+		if strings.Contains(t, "/") {
+			refs[i] = "@" + t
+		} else {
+			refs[i] = "@team/" + t
+		}
 	}
 	return strings.Join(refs, ", ")
 }
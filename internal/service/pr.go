@@ -168,6 +168,8 @@ type PRService struct {
 	browseSvc    *BrowseService
 	codeIntelSvc *CodeIntelService
 	lineageSvc   *EntityLineageService
+	teamSvc      *TeamService
+	audit        *AuditService
 
 	mergePreviewMu     sync.RWMutex
 	mergePreviewCache  map[string]*mergePreviewCacheEntry
@@ -183,6 +185,16 @@ func NewPRService(db database.DB, repoSvc *RepoService, browseSvc *BrowseService
 	}
 }
 
+// SetTeamService lets .gotowners rules name org teams as @org/team.
+func (s *PRService) SetTeamService(teamSvc *TeamService) {
+	s.teamSvc = teamSvc
+}
+
+// SetAuditService records changes to branch protection rules.
+func (s *PRService) SetAuditService(audit *AuditService) {
+	s.audit = audit
+}
+
 func (s *PRService) SetCodeIntelService(codeIntelSvc *CodeIntelService) {
 	s.codeIntelSvc = codeIntelSvc
 }
@@ -284,11 +296,78 @@ func (s *PRService) Diff(ctx context.Context, owner, repo string, pr *models.Pul
 		}
 	}
 
-	return &DiffResponse{
+	resp := &DiffResponse{
 		Base:  string(tgtHash),
 		Head:  string(srcHash),
 		Files: fileDiffs,
-	}, nil
+	}
+	if stableIDs := s.annotateEntityStableIDs(ctx, pr.RepoID, store, tgtHash, srcHash, resp.Files); len(stableIDs) > 0 {
+		resp.LinkedIssues, err = s.db.ListOpenIssueEntityLinks(ctx, pr.RepoID, stableIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// LinkedIssues returns the open issues linked to entities the pull request
+// changes.
+func (s *PRService) LinkedIssues(ctx context.Context, owner, repo string, pr *models.PullRequest) ([]models.IssueEntityLink, error) {
+	resp, err := s.Diff(ctx, owner, repo, pr)
+	if err != nil {
+		return nil, err
+	}
+	return resp.LinkedIssues, nil
+}
+
+// annotateEntityStableIDs fills in lineage stable IDs for changed entities,
+// preferring the head-side identity, and returns the distinct IDs. Lineage is
+// best-effort: commits that cannot be indexed leave their entities unannotated.
+func (s *PRService) annotateEntityStableIDs(ctx context.Context, repoID int64, store *gotstore.RepoStore, baseHash, headHash object.Hash, files []FileDiffResponse) []string {
+	if s.lineageSvc == nil || len(files) == 0 {
+		return nil
+	}
+	lookup := func(commitHash object.Hash) map[string]string {
+		versions, err := s.lineageSvc.VersionsAtCommit(ctx, repoID, store, commitHash)
+		if err != nil {
+			return nil
+		}
+		byKey := make(map[string]string, len(versions))
+		for _, v := range versions {
+			if v.Name != "" {
+				byKey[entityLineageKey(v.Path, v.Name, v.DeclKind, v.Receiver)] = v.StableID
+			}
+		}
+		return byKey
+	}
+	base, head := lookup(baseHash), lookup(headHash)
+
+	var ids []string
+	seen := make(map[string]bool)
+	add := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for i := range files {
+		for j := range files[i].Changes {
+			change := &files[i].Changes[j]
+			if change.Before != nil {
+				id := base[entityLineageKey(files[i].Path, change.Before.Name, change.Before.DeclKind, change.Before.Receiver)]
+				change.StableID = id
+				add(id)
+			}
+			if change.After != nil {
+				if id := head[entityLineageKey(files[i].Path, change.After.Name, change.After.DeclKind, change.After.Receiver)]; id != "" {
+					change.StableID = id
+					add(id)
+				}
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
 }
 
 // MergePreview computes a structural merge preview without committing.
@@ -500,6 +579,9 @@ func (s *PRService) Merge(ctx context.Context, owner, repo string, pr *models.Pu
 		Timestamp: time.Now().Unix(),
 		Message:   fmt.Sprintf("Merge pull request #%d: %s", pr.Number, pr.Title),
 	}
+	if err := s.repoSvc.signServerCommit(mergeCommit); err != nil {
+		return "", err
+	}
 	mergeCommitHash, err := store.Objects.WriteCommit(mergeCommit)
 	if err != nil {
 		return "", fmt.Errorf("write merge commit: %w", err)
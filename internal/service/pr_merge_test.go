@@ -61,6 +61,41 @@ func TestPRMergeReturnsStructuredConflictAndPreservesTargetRef(t *testing.T) {
 	}
 }
 
+func TestPRMergeSignsMergeCommitWithServerKey(t *testing.T) {
+	ctx, prSvc, store, repo := setupPRMergeTestService(t)
+
+	_, signer, err := generateTestSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prSvc.repoSvc.SetServerSigner(NewServerSigner(signer))
+
+	base := writeMainCommit(t, store, "package main\n\nfunc A() int { return 0 }\n", nil, "base", 1700000000)
+	featureHead := writeMainCommit(t, store, "package main\n\nfunc A() int { return 2 }\n", []object.Hash{base}, "feature", 1700000020)
+	if err := store.Refs.Set("heads/main", base); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Refs.Set("heads/feature", featureHead); err != nil {
+		t.Fatal(err)
+	}
+	pr := &models.PullRequest{RepoID: repo.ID, Number: 1, Title: "sign", AuthorID: *repo.OwnerUserID, SourceBranch: "feature", TargetBranch: "main"}
+	if err := prSvc.db.CreatePullRequest(ctx, pr); err != nil {
+		t.Fatal(err)
+	}
+
+	mergeHash, err := prSvc.Merge(ctx, "alice", "repo", pr, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := NewBrowseService(prSvc.repoSvc).GetCommit(ctx, "alice", "repo", string(mergeHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Verified || !info.Verification.SignedByServer || info.Signer != ServerSignerName {
+		t.Fatalf("expected merge commit signed by the server, got %+v", info.Verification)
+	}
+}
+
 func TestUpdateTargetBranchRefReportsCASMismatch(t *testing.T) {
 	_, _, store, _ := setupPRMergeTestService(t)
 
@@ -20,10 +20,17 @@ import (
 
 var validRepoName = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
 
+var (
+	ErrRepoOwnerNotFound = errors.New("no user or organization with that name")
+	ErrRepoNameTaken     = errors.New("the new owner already has a repository with that name")
+)
+
 type RepoService struct {
 	db              database.DB
 	storagePath     string // root path for all repo storage
 	copyDirectoryFn func(src, dst string) error
+	serverSigner    *ServerSigner
+	audit           *AuditService
 }
 
 func NewRepoService(db database.DB, storagePath string) *RepoService {
@@ -34,6 +41,22 @@ func NewRepoService(db database.DB, storagePath string) *RepoService {
 	}
 }
 
+// SetServerSigner makes the server sign the commits it creates, and trust
+// signatures made with the same key.
+func (s *RepoService) SetServerSigner(signer *ServerSigner) {
+	s.serverSigner = signer
+}
+
+// SetAuditService records repository deletions and access changes.
+func (s *RepoService) SetAuditService(audit *AuditService) {
+	s.audit = audit
+}
+
+// ServerSigner returns the configured server signing key, or nil.
+func (s *RepoService) ServerSigner() *ServerSigner {
+	return s.serverSigner
+}
+
 func (s *RepoService) Create(ctx context.Context, ownerID int64, name, description string, isPrivate bool) (*models.Repository, error) {
 	if !validRepoName.MatchString(name) {
 		return nil, fmt.Errorf("invalid repository name: %q", name)
@@ -172,7 +195,93 @@ func (s *RepoService) ListForksPage(ctx context.Context, parentRepoID int64, pag
 }
 
 func (s *RepoService) Delete(ctx context.Context, id int64) error {
-	return s.db.DeleteRepository(ctx, id)
+	repo, err := s.db.GetRepositoryByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.db.DeleteRepository(ctx, id); err != nil {
+		return err
+	}
+	s.audit.RecordRepo(ctx, repo, AuditRepoDelete, "", repo, nil)
+	return nil
+}
+
+// Transfer moves repo to the user or org named newOwner. Issues, pull
+// requests, collaborators and stored history move with it.
+func (s *RepoService) Transfer(ctx context.Context, repo *models.Repository, newOwner string) (*models.Repository, error) {
+	var ownerUserID, ownerOrgID *int64
+	if user, err := s.db.GetUserByUsername(ctx, newOwner); err == nil {
+		ownerUserID = &user.ID
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	} else if org, err := s.db.GetOrg(ctx, newOwner); err == nil {
+		ownerOrgID = &org.ID
+	} else if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRepoOwnerNotFound
+	} else {
+		return nil, err
+	}
+	if existing, err := s.db.GetRepository(ctx, newOwner, repo.Name); err == nil {
+		if existing.ID == repo.ID {
+			return existing, nil
+		}
+		return nil, ErrRepoNameTaken
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err := s.db.TransferRepository(ctx, repo.ID, ownerUserID, ownerOrgID); err != nil {
+		return nil, err
+	}
+	moved, err := s.db.GetRepositoryByID(ctx, repo.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.audit.RecordRepo(ctx, moved, AuditRepoTransfer, "", map[string]string{"owner": repo.OwnerName}, map[string]string{"owner": moved.OwnerName})
+	return moved, nil
+}
+
+func (s *RepoService) RemoveCollaborator(ctx context.Context, repo *models.Repository, user *models.User) error {
+	collab, err := s.db.GetCollaborator(ctx, repo.ID, user.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.db.RemoveCollaborator(ctx, repo.ID, user.ID); err != nil {
+		return err
+	}
+	s.audit.RecordRepo(ctx, repo, AuditRepoCollaboratorRemove, user.Username, map[string]string{"role": collab.Role}, nil)
+	return nil
+}
+
+func (s *RepoService) CreateRunnerToken(ctx context.Context, repo *models.Repository, token *models.RepoRunnerToken) error {
+	if err := s.db.CreateRepoRunnerToken(ctx, token); err != nil {
+		return err
+	}
+	s.audit.RecordRepo(ctx, repo, AuditRunnerTokenCreate, fmt.Sprintf("runner_token/%d", token.ID), nil, token)
+	return nil
+}
+
+func (s *RepoService) DeleteRunnerToken(ctx context.Context, repo *models.Repository, tokenID int64) error {
+	if err := s.db.DeleteRepoRunnerToken(ctx, repo.ID, tokenID); err != nil {
+		return err
+	}
+	s.audit.RecordRepo(ctx, repo, AuditRunnerTokenDelete, fmt.Sprintf("runner_token/%d", tokenID), nil, nil)
+	return nil
+}
+
+func (s *RepoService) CreateDeployKey(ctx context.Context, repo *models.Repository, key *models.RepoDeployKey) error {
+	if err := s.db.CreateRepoDeployKey(ctx, key); err != nil {
+		return err
+	}
+	s.audit.RecordRepo(ctx, repo, AuditDeployKeyCreate, fmt.Sprintf("deploy_key/%d", key.ID), nil, key)
+	return nil
+}
+
+func (s *RepoService) DeleteDeployKey(ctx context.Context, repo *models.Repository, keyID int64) error {
+	if err := s.db.DeleteRepoDeployKey(ctx, repo.ID, keyID); err != nil {
+		return err
+	}
+	s.audit.RecordRepo(ctx, repo, AuditDeployKeyDelete, fmt.Sprintf("deploy_key/%d", keyID), nil, nil)
+	return nil
 }
 
 // OpenStore opens the object store for a repository.
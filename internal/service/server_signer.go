@@ -0,0 +1,83 @@
+package service
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/odvcencio/got/pkg/object"
+	"golang.org/x/crypto/ssh"
+)
+
+// ServerSignerName is reported as the signer of commits signed with the
+// server key.
+const ServerSignerName = "gothub"
+
+// ServerSigner signs the commits gothub creates itself, such as pull request
+// merge commits, so that they satisfy RequireSignedCommits downstream.
+type ServerSigner struct {
+	signer ssh.Signer
+}
+
+func NewServerSigner(signer ssh.Signer) *ServerSigner {
+	return &ServerSigner{signer: signer}
+}
+
+// LoadServerSigner reads an unencrypted SSH private key from path.
+func LoadServerSigner(path string) (*ServerSigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read signing key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse signing key: %w", err)
+	}
+	return NewServerSigner(signer), nil
+}
+
+// SignCommit sets commit.Signature to a got-native SSH signature over the
+// commit.
+func (s *ServerSigner) SignCommit(commit *object.CommitObj) error {
+	sig, err := s.signer.Sign(rand.Reader, commitSigningPayloadForVerification(commit))
+	if err != nil {
+		return fmt.Errorf("sign commit: %w", err)
+	}
+	commit.Signature = fmt.Sprintf("sshsig-v1:%s:%s:%s",
+		sig.Format,
+		base64.StdEncoding.EncodeToString(s.signer.PublicKey().Marshal()),
+		base64.StdEncoding.EncodeToString(sig.Blob))
+	return nil
+}
+
+// PublicKey returns the server key in authorized_keys format.
+func (s *ServerSigner) PublicKey() string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(s.signer.PublicKey())))
+}
+
+func (s *ServerSigner) KeyType() string {
+	return s.signer.PublicKey().Type()
+}
+
+// Fingerprint returns the key's MD5 fingerprint, in the same form as user
+// SSH keys.
+func (s *ServerSigner) Fingerprint() string {
+	return fmt.Sprintf("%x", md5.Sum(s.signer.PublicKey().Marshal()))
+}
+
+// signServerCommit signs a commit created by the server when a signing key
+// is configured.
+func (s *RepoService) signServerCommit(commit *object.CommitObj) error {
+	if s.serverSigner == nil {
+		return nil
+	}
+	return s.serverSigner.SignCommit(commit)
+}
+
+func (s *ServerSigner) owns(pubKey ssh.PublicKey) bool {
+	return s != nil && bytes.Equal(s.signer.PublicKey().Marshal(), pubKey.Marshal())
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+// sessionTouchInterval limits how often a session's last-seen time is
+// written, so that authenticated requests do not each cost a DB write.
+const sessionTouchInterval = time.Minute
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionService manages the server-side sessions behind login JWTs. It
+// implements auth.SessionStore.
+type SessionService struct {
+	db database.DB
+}
+
+func NewSessionService(db database.DB) *SessionService {
+	return &SessionService{db: db}
+}
+
+// Create starts a session for the user that lasts for ttl.
+func (s *SessionService) Create(ctx context.Context, userID int64, userAgent, ip string, ttl time.Duration) (*models.UserSession, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	session := &models.UserSession{
+		ID:        hex.EncodeToString(raw),
+		UserID:    userID,
+		UserAgent: userAgent,
+		IPAddress: ip,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	}
+	if err := s.db.CreateUserSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Rotate replaces a session with a fresh one, as done on token refresh.
+func (s *SessionService) Rotate(ctx context.Context, userID int64, oldID, userAgent, ip string, ttl time.Duration) (*models.UserSession, error) {
+	if err := s.ValidateSession(ctx, oldID, userID); err != nil {
+		return nil, err
+	}
+	session, err := s.Create(ctx, userID, userAgent, ip, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.RevokeUserSession(ctx, oldID, userID); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *SessionService) ValidateSession(ctx context.Context, sessionID string, userID int64) error {
+	session, err := s.db.GetUserSession(ctx, sessionID)
+	if err != nil {
+		return ErrSessionNotFound
+	}
+	now := time.Now().UTC()
+	if session.UserID != userID || session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+		return ErrSessionNotFound
+	}
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		_ = s.db.TouchUserSession(ctx, sessionID, now)
+	}
+	return nil
+}
+
+// List returns the user's active sessions, flagging currentID.
+func (s *SessionService) List(ctx context.Context, userID int64, currentID string) ([]models.UserSession, error) {
+	sessions, err := s.db.ListActiveUserSessions(ctx, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+func (s *SessionService) Revoke(ctx context.Context, userID int64, sessionID string) error {
+	return s.db.RevokeUserSession(ctx, sessionID, userID)
+}
+
+// RevokeAll signs the user out everywhere except keepID, which may be empty.
+// Credential changes such as removing a passkey call it so that a stolen
+// session does not outlive the credential that created it. Accounts have no
+// usable password, so there is no password change path calling it yet; one
+// added later must.
+func (s *SessionService) RevokeAll(ctx context.Context, userID int64, keepID string) error {
+	return s.db.RevokeUserSessions(ctx, userID, keepID)
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrInvalidSSHKey   = errors.New("invalid SSH public key")
+	ErrSSHKeyDeployKey = errors.New("key already in use as a deploy key")
+)
+
+// SSHKeyService manages the SSH public keys users authenticate with and sign
+// commits with. Cached commit verifications are recorded under the key's
+// fingerprint, so every change to a key goes through here to drop them.
+type SSHKeyService struct {
+	db database.DB
+}
+
+func NewSSHKeyService(db database.DB) *SSHKeyService {
+	return &SSHKeyService{db: db}
+}
+
+// Add parses an authorized_keys line and stores it for the user.
+func (s *SSHKeyService) Add(ctx context.Context, userID int64, name, publicKey string) (*models.SSHKey, error) {
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return nil, ErrInvalidSSHKey
+	}
+	fp := fmt.Sprintf("%x", md5.Sum(pubKey.Marshal()))
+	if _, err := s.db.GetRepoDeployKeyByFingerprint(ctx, fp); err == nil {
+		return nil, ErrSSHKeyDeployKey
+	}
+	key := &models.SSHKey{
+		UserID:      userID,
+		Name:        name,
+		Fingerprint: fp,
+		PublicKey:   publicKey,
+		KeyType:     pubKey.Type(),
+	}
+	if err := s.db.CreateSSHKey(ctx, key); err != nil {
+		return nil, err
+	}
+	// Commits signed with this key may have been cached as unknown_key.
+	if err := s.db.DeleteCommitVerificationsByKeyIDs(ctx, []string{fp}); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *SSHKeyService) List(ctx context.Context, userID int64) ([]models.SSHKey, error) {
+	return s.db.ListSSHKeys(ctx, userID)
+}
+
+func (s *SSHKeyService) Delete(ctx context.Context, userID, id int64) error {
+	keys, err := s.db.ListSSHKeys(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.db.DeleteSSHKey(ctx, id, userID); err != nil {
+		return err
+	}
+	for i := range keys {
+		if keys[i].ID == id {
+			return s.db.DeleteCommitVerificationsByKeyIDs(ctx, []string{keys[i].Fingerprint})
+		}
+	}
+	return nil
+}
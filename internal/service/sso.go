@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+	"github.com/odvcencio/gothub/internal/oidc"
+)
+
+// ssoStateTTL is how long a user has to finish signing in at the provider.
+// Provisioned usernames are cut to maxUsernameLength.
+const (
+	ssoStateTTL       = 10 * time.Minute
+	maxUsernameLength = 39
+)
+
+var (
+	ErrSSOProviderNotFound = errors.New("unknown sign-in provider")
+	ErrSSOInvalidState     = errors.New("invalid or expired sign-in attempt")
+	// ErrSSOEmailConflict means the provider's email belongs to an existing
+	// account that cannot be linked automatically because one side has not
+	// verified it.
+	ErrSSOEmailConflict = errors.New("an account with this email already exists; sign in to it another way")
+	ErrSSOEmailRequired = errors.New("sign-in provider did not share an email address")
+)
+
+// SSOGroupMapping grants membership of Org with Role to users whose ID
+// token lists Group.
+type SSOGroupMapping struct {
+	Group string
+	Org   string
+	Role  string // "member" or "owner"
+}
+
+// SSOProvider is an OpenID Connect provider together with its group to org
+// mappings.
+type SSOProvider struct {
+	*oidc.Provider
+	GroupMappings []SSOGroupMapping
+}
+
+// SSOProviderInfo is what clients need to offer a provider on the sign-in
+// page.
+type SSOProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+// SSOService signs users in through OpenID Connect providers, provisioning
+// accounts on first sign-in and keeping mapped org memberships in line with
+// the provider's group claims.
+type SSOService struct {
+	db        database.DB
+	providers map[string]*SSOProvider
+	order     []string
+}
+
+func NewSSOService(db database.DB) *SSOService {
+	return &SSOService{db: db, providers: map[string]*SSOProvider{}}
+}
+
+// AddProvider registers p under its name, replacing any provider with the
+// same name.
+func (s *SSOService) AddProvider(p *SSOProvider) {
+	if _, ok := s.providers[p.Name()]; !ok {
+		s.order = append(s.order, p.Name())
+	}
+	s.providers[p.Name()] = p
+}
+
+// Providers lists the configured providers in registration order.
+func (s *SSOService) Providers() []SSOProviderInfo {
+	out := make([]SSOProviderInfo, 0, len(s.order))
+	for _, name := range s.order {
+		out = append(out, SSOProviderInfo{Name: name, DisplayName: s.providers[name].DisplayName()})
+	}
+	return out
+}
+
+// Begin starts a sign-in with providerName and returns the provider URL to
+// send the browser to. The provider redirects back to redirectURI.
+func (s *SSOService) Begin(ctx context.Context, providerName, redirectURI string) (string, error) {
+	provider, ok := s.providers[strings.ToLower(providerName)]
+	if !ok {
+		return "", ErrSSOProviderNotFound
+	}
+	state, err := oidc.RandomToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidc.RandomToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", err
+	}
+	authURL, err := provider.AuthCodeURL(ctx, redirectURI, state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.CreateOIDCAuthState(ctx, &models.OIDCAuthState{
+		State:        state,
+		Provider:     provider.Name(),
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().UTC().Add(ssoStateTTL),
+	}); err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// Complete finishes a sign-in from the provider's redirect. It returns the
+// linked user, linking an existing account by verified email or creating
+// one on first sign-in.
+func (s *SSOService) Complete(ctx context.Context, state, code, redirectURI string) (*models.User, error) {
+	now := time.Now().UTC()
+	st, err := s.db.ConsumeOIDCAuthState(ctx, strings.TrimSpace(state), now)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSSOInvalidState
+	}
+	if err != nil {
+		return nil, err
+	}
+	provider, ok := s.providers[st.Provider]
+	if !ok {
+		return nil, ErrSSOProviderNotFound
+	}
+	rawIDToken, err := provider.Exchange(ctx, redirectURI, code, st.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := provider.VerifyIDToken(ctx, rawIDToken, st.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.resolveUser(ctx, provider.Name(), claims, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.syncGroupMemberships(ctx, provider, user.ID, claims.Groups); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ListIdentities returns the provider accounts linked to userID.
+func (s *SSOService) ListIdentities(ctx context.Context, userID int64) ([]models.UserIdentity, error) {
+	return s.db.ListUserIdentities(ctx, userID)
+}
+
+func (s *SSOService) resolveUser(ctx context.Context, provider string, claims *oidc.Claims, now time.Time) (*models.User, error) {
+	identity, err := s.db.GetUserIdentity(ctx, provider, claims.Subject)
+	if err == nil {
+		if err := s.db.TouchUserIdentity(ctx, identity.ID, claims.Email, now); err != nil {
+			return nil, err
+		}
+		return s.db.GetUserByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	email := strings.TrimSpace(claims.Email)
+	var user *models.User
+	if email != "" {
+		existing, err := s.db.GetUserByEmail(ctx, email)
+		switch {
+		case err == nil:
+			// Both sides must have verified the address, or whoever
+			// registered it first could take over the other's account.
+			verified := false
+			if claims.EmailVerified {
+				if verified, err = s.db.HasVerifiedEmail(ctx, existing.ID); err != nil {
+					return nil, err
+				}
+			}
+			if !verified {
+				return nil, ErrSSOEmailConflict
+			}
+			user = existing
+		case !errors.Is(err, sql.ErrNoRows):
+			return nil, err
+		}
+	}
+	if user == nil {
+		if user, err = s.provisionUser(ctx, claims, email); err != nil {
+			return nil, err
+		}
+	}
+	identity = &models.UserIdentity{UserID: user.ID, Provider: provider, Subject: claims.Subject, Email: email}
+	if err := s.db.CreateUserIdentity(ctx, identity); err != nil {
+		return nil, err
+	}
+	if err := s.db.TouchUserIdentity(ctx, identity.ID, email, now); err != nil {
+		return nil, err
+	}
+	slog.Info("sso identity linked", "user_id", user.ID, "provider", provider)
+	return user, nil
+}
+
+// provisionUser creates an account for a first-time sign-in, picking a free
+// username based on the provider's preferred username or the email.
+func (s *SSOService) provisionUser(ctx context.Context, claims *oidc.Claims, email string) (*models.User, error) {
+	if email == "" {
+		return nil, ErrSSOEmailRequired
+	}
+	base := sanitizeUsername(claims.PreferredUsername)
+	if base == "" {
+		local, _, _ := strings.Cut(email, "@")
+		base = sanitizeUsername(local)
+	}
+	if base == "" {
+		base = "user"
+	}
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			suffix := fmt.Sprintf("-%d", i)
+			candidate = strings.TrimRight(base[:min(len(base), maxUsernameLength-len(suffix))], "-") + suffix
+		}
+		if _, err := s.db.GetUserByUsername(ctx, candidate); err == nil {
+			continue
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		// SSO accounts have no password; "!" never matches a bcrypt hash.
+		user := &models.User{Username: candidate, Email: email, PasswordHash: "!"}
+		if err := s.db.CreateUser(ctx, user); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	return nil, fmt.Errorf("no free username for %q", base)
+}
+
+// syncGroupMemberships makes the user's membership of every mapped org
+// match their groups: mapped groups grant the highest mapped role, and
+// members of a mapped org who are no longer in any of its groups are
+// removed. Owners are never demoted or removed by a sync.
+func (s *SSOService) syncGroupMemberships(ctx context.Context, provider *SSOProvider, userID int64, groups []string) error {
+	if len(provider.GroupMappings) == 0 {
+		return nil
+	}
+	want := map[string]string{}
+	for _, m := range provider.GroupMappings {
+		if _, seen := want[m.Org]; !seen {
+			want[m.Org] = ""
+		}
+		if slices.Contains(groups, m.Group) && want[m.Org] != "owner" {
+			want[m.Org] = m.Role
+		}
+	}
+	orgNames := make([]string, 0, len(want))
+	for name := range want {
+		orgNames = append(orgNames, name)
+	}
+	sort.Strings(orgNames)
+	for _, name := range orgNames {
+		org, err := s.db.GetOrg(ctx, name)
+		if errors.Is(err, sql.ErrNoRows) {
+			slog.Warn("sso group mapping names a missing org", "provider", provider.Name(), "org", name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		current, err := s.db.GetOrgMember(ctx, org.ID, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			current = nil
+		} else if err != nil {
+			return err
+		}
+		role := want[name]
+		switch {
+		case current != nil && current.Role == "owner":
+		case role == "" && current != nil:
+			if err := s.db.RemoveOrgMember(ctx, org.ID, userID); err != nil {
+				return err
+			}
+		case role != "" && (current == nil || current.Role != role):
+			if err := s.db.AddOrgMember(ctx, &models.OrgMember{OrgID: org.ID, UserID: userID, Role: role}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sanitizeUsername lowercases name and replaces anything outside
+// [a-z0-9-] with dashes.
+func sanitizeUsername(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('-')
+		}
+	}
+	out := strings.Trim(b.String(), "-")
+	for strings.Contains(out, "--") {
+		out = strings.ReplaceAll(out, "--", "-")
+	}
+	if len(out) > maxUsernameLength {
+		out = strings.TrimRight(out[:maxUsernameLength], "-")
+	}
+	return out
+}
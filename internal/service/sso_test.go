@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+	"github.com/odvcencio/gothub/internal/oidc"
+	"github.com/odvcencio/gothub/internal/oidc/oidctest"
+)
+
+func TestSSOProvisionLinkAndGroupSync(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	idp := oidctest.NewServer("gothub", "s3cret")
+	defer idp.Close()
+	provider, err := oidc.NewProvider(oidc.Config{Name: "corp", Issuer: idp.URL, ClientID: "gothub", ClientSecret: "s3cret"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewSSOService(db)
+	svc.AddProvider(&SSOProvider{Provider: provider, GroupMappings: []SSOGroupMapping{
+		{Group: "eng", Org: "acme", Role: "member"},
+		{Group: "eng-leads", Org: "acme", Role: "owner"},
+		{Group: "ops", Org: "missing", Role: "member"},
+	}})
+	if got := svc.Providers(); len(got) != 1 || got[0].Name != "corp" {
+		t.Fatalf("unexpected providers %+v", got)
+	}
+	acme := &models.Org{Name: "acme"}
+	if err := db.CreateOrg(ctx, acme); err != nil {
+		t.Fatal(err)
+	}
+
+	const redirect = "https://gothub.test/login/oidc/callback"
+	login := func(u oidctest.User) (*models.User, error) {
+		t.Helper()
+		idp.SetUser(u)
+		authURL, err := svc.Begin(ctx, "corp", redirect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, state, err := idp.Authorize(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return svc.Complete(ctx, state, code, redirect)
+	}
+	role := func(userID int64) string {
+		t.Helper()
+		m, err := db.GetOrgMember(ctx, acme.ID, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ""
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m.Role
+	}
+
+	// First sign-in provisions an account and applies group mappings.
+	alice, err := login(oidctest.User{Subject: "a-1", Email: "alice@corp.test", EmailVerified: true, PreferredUsername: "Alice.Smith", Groups: []string{"eng", "ops"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Username != "alice-smith" || alice.Email != "alice@corp.test" {
+		t.Fatalf("unexpected provisioned user %+v", alice)
+	}
+	if got := role(alice.ID); got != "member" {
+		t.Fatalf("expected eng to grant membership, got %q", got)
+	}
+	again, err := login(oidctest.User{Subject: "a-1", Email: "alice@corp.test", EmailVerified: true, Groups: []string{"eng", "eng-leads"}})
+	if err != nil || again.ID != alice.ID {
+		t.Fatalf("expected the same account on return, got %+v %v", again, err)
+	}
+	if got := role(alice.ID); got != "owner" {
+		t.Fatalf("expected eng-leads to grant ownership, got %q", got)
+	}
+
+	// Leaving the groups removes members but never owners.
+	carl, err := login(oidctest.User{Subject: "c-1", Email: "carl@corp.test", EmailVerified: true, Groups: []string{"eng"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := login(oidctest.User{Subject: "c-1", Email: "carl@corp.test", EmailVerified: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := role(carl.ID); got != "" {
+		t.Fatalf("expected membership to be removed, got %q", got)
+	}
+	if _, err := login(oidctest.User{Subject: "a-1", Email: "alice@corp.test", EmailVerified: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := role(alice.ID); got != "owner" {
+		t.Fatalf("expected owner to be kept, got %q", got)
+	}
+
+	// Existing accounts link by email only when both sides verified it.
+	bob := &models.User{Username: "bob", Email: "bob@corp.test", PasswordHash: "x"}
+	if err := db.CreateUser(ctx, bob); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := login(oidctest.User{Subject: "b-1", Email: "bob@corp.test", EmailVerified: true}); !errors.Is(err, ErrSSOEmailConflict) {
+		t.Fatalf("expected unverified local email to block linking, got %v", err)
+	}
+	if err := db.CreateMagicLinkToken(ctx, &models.MagicLinkToken{UserID: bob.ID, TokenHash: "bob-token", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ConsumeMagicLinkToken(ctx, "bob-token", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := login(oidctest.User{Subject: "b-1", Email: "bob@corp.test", EmailVerified: false}); !errors.Is(err, ErrSSOEmailConflict) {
+		t.Fatalf("expected unverified provider email to block linking, got %v", err)
+	}
+	linked, err := login(oidctest.User{Subject: "b-1", Email: "bob@corp.test", EmailVerified: true, PreferredUsername: "bob"})
+	if err != nil || linked.ID != bob.ID {
+		t.Fatalf("expected link to bob, got %+v %v", linked, err)
+	}
+	if ids, err := svc.ListIdentities(ctx, bob.ID); err != nil || len(ids) != 1 || ids[0].Subject != "b-1" || ids[0].LastLoginAt == nil {
+		t.Fatalf("unexpected identities %+v %v", ids, err)
+	}
+
+	// A taken preferred username gets a suffix.
+	other, err := login(oidctest.User{Subject: "b-2", Email: "bob@other.test", EmailVerified: true, PreferredUsername: "bob"})
+	if err != nil || other.Username != "bob-2" {
+		t.Fatalf("expected bob-2, got %+v %v", other, err)
+	}
+
+	// States are single use.
+	authURL, err := svc.Begin(ctx, "corp", redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state, err := idp.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Complete(ctx, state, code, redirect); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Complete(ctx, state, code, redirect); !errors.Is(err, ErrSSOInvalidState) {
+		t.Fatalf("expected replayed state to fail, got %v", err)
+	}
+	if _, err := svc.Begin(ctx, "nope", redirect); !errors.Is(err, ErrSSOProviderNotFound) {
+		t.Fatalf("expected unknown provider, got %v", err)
+	}
+}
+
+func TestSanitizeUsername(t *testing.T) {
+	for in, want := range map[string]string{
+		"Alice.Smith":     "alice-smith",
+		"  --bob__jones ": "bob-jones",
+		"日本":              "",
+	} {
+		if got := sanitizeUsername(in); got != want {
+			t.Fatalf("sanitizeUsername(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+var (
+	ErrTeamNotFound          = errors.New("team not found")
+	ErrTeamExists            = errors.New("a team with that name already exists")
+	ErrInvalidTeam           = errors.New("invalid team")
+	ErrNotOrgMember          = errors.New("user is not a member of the organization")
+	ErrInvalidRepoPermission = errors.New("permission must be one of read, write, admin")
+)
+
+const maxTeamNameLength = 64
+
+var teamNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+
+// repoPermissionRank orders repository permissions so the strongest of
+// several grants wins.
+var repoPermissionRank = map[string]int{"read": 1, "write": 2, "admin": 3}
+
+// TeamService manages org teams, their nesting, members and repository
+// grants.
+type TeamService struct {
+	db    database.DB
+	now   func() time.Time
+	audit *AuditService
+}
+
+func NewTeamService(db database.DB) *TeamService {
+	return &TeamService{db: db, now: time.Now}
+}
+
+// Create adds a team to an org, optionally nested under the parent team
+// named parent.
+func (s *TeamService) Create(ctx context.Context, orgID int64, name, description, parent string) (*models.Team, error) {
+	name, err := normalizeTeamName(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.db.GetTeam(ctx, orgID, name); err == nil {
+		return nil, ErrTeamExists
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	team := &models.Team{
+		OrgID:       orgID,
+		Name:        name,
+		Description: strings.TrimSpace(description),
+		CreatedAt:   s.now().UTC(),
+	}
+	if parent != "" {
+		p, err := s.Get(ctx, orgID, parent)
+		if err != nil {
+			return nil, err
+		}
+		team.ParentID = &p.ID
+	}
+	if err := s.db.CreateTeam(ctx, team); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+func (s *TeamService) Get(ctx context.Context, orgID int64, name string) (*models.Team, error) {
+	team, err := s.db.GetTeam(ctx, orgID, strings.ToLower(strings.TrimSpace(name)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTeamNotFound
+	}
+	return team, err
+}
+
+func (s *TeamService) List(ctx context.Context, orgID int64) ([]models.Team, error) {
+	return s.db.ListTeams(ctx, orgID)
+}
+
+// Update renames, describes or moves a team. Nil arguments are left
+// unchanged; an empty parent makes the team top-level.
+func (s *TeamService) Update(ctx context.Context, team *models.Team, name, description, parent *string) (*models.Team, error) {
+	updated := *team
+	if name != nil {
+		n, err := normalizeTeamName(*name)
+		if err != nil {
+			return nil, err
+		}
+		if n != team.Name {
+			if _, err := s.db.GetTeam(ctx, team.OrgID, n); err == nil {
+				return nil, ErrTeamExists
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return nil, err
+			}
+		}
+		updated.Name = n
+	}
+	if description != nil {
+		updated.Description = strings.TrimSpace(*description)
+	}
+	if parent != nil {
+		updated.ParentID = nil
+		if *parent != "" {
+			p, err := s.Get(ctx, team.OrgID, *parent)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.checkNoCycle(ctx, team.ID, p); err != nil {
+				return nil, err
+			}
+			updated.ParentID = &p.ID
+		}
+	}
+	if err := s.db.UpdateTeam(ctx, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// checkNoCycle rejects making parent, or one of its ancestors, a child of
+// the team with teamID.
+func (s *TeamService) checkNoCycle(ctx context.Context, teamID int64, parent *models.Team) error {
+	for t := parent; ; {
+		if t.ID == teamID {
+			return fmt.Errorf("%w: a team cannot be nested under itself or its descendants", ErrInvalidTeam)
+		}
+		if t.ParentID == nil {
+			return nil
+		}
+		next, err := s.db.GetTeamByID(ctx, *t.ParentID)
+		if err != nil {
+			return err
+		}
+		t = next
+	}
+}
+
+// Delete removes a team. Its child teams move up to its parent.
+func (s *TeamService) Delete(ctx context.Context, team *models.Team) error {
+	return s.db.DeleteTeam(ctx, team.OrgID, team.ID)
+}
+
+// AddMember adds an org member to a team.
+func (s *TeamService) AddMember(ctx context.Context, team *models.Team, userID int64) error {
+	if _, err := s.db.GetOrgMember(ctx, team.OrgID, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotOrgMember
+		}
+		return err
+	}
+	return s.db.AddTeamMember(ctx, team.ID, userID)
+}
+
+func (s *TeamService) RemoveMember(ctx context.Context, team *models.Team, userID int64) error {
+	return s.db.RemoveTeamMember(ctx, team.ID, userID)
+}
+
+// Members lists the users added to the team itself, not its child teams.
+func (s *TeamService) Members(ctx context.Context, team *models.Team) ([]models.TeamMember, error) {
+	return s.db.ListTeamMembers(ctx, team.ID)
+}
+
+// SetRepoPermission grants a team read, write or admin on one of its org's
+// repositories, replacing any earlier grant.
+func (s *TeamService) SetRepoPermission(ctx context.Context, team *models.Team, repo *models.Repository, permission string) error {
+	permission = strings.ToLower(strings.TrimSpace(permission))
+	if _, ok := repoPermissionRank[permission]; !ok {
+		return ErrInvalidRepoPermission
+	}
+	if repo.OwnerOrgID == nil || *repo.OwnerOrgID != team.OrgID {
+		return fmt.Errorf("%w: repository belongs to another owner", ErrInvalidTeam)
+	}
+	if err := s.db.SetTeamRepo(ctx, &models.TeamRepo{TeamID: team.ID, RepoID: repo.ID, Permission: permission}); err != nil {
+		return err
+	}
+	s.audit.RecordRepo(ctx, repo, AuditTeamRepoPermissionSet, "team/"+team.Name, nil, map[string]string{"permission": permission})
+	return nil
+}
+
+func (s *TeamService) RemoveRepo(ctx context.Context, team *models.Team, repoID int64) error {
+	if err := s.db.RemoveTeamRepo(ctx, team.ID, repoID); err != nil {
+		return err
+	}
+	s.audit.RecordRepoID(ctx, repoID, AuditTeamRepoPermissionClear, "team/"+team.Name, nil, nil)
+	return nil
+}
+
+// SetAuditService records team permission grants on repositories.
+func (s *TeamService) SetAuditService(audit *AuditService) {
+	s.audit = audit
+}
+
+func (s *TeamService) Repos(ctx context.Context, team *models.Team) ([]models.TeamRepo, error) {
+	return s.db.ListTeamRepos(ctx, team.ID)
+}
+
+// RepoPermission returns the strongest permission the user's teams, or the
+// parents of those teams, grant on a repository, or "" if none do.
+func (s *TeamService) RepoPermission(ctx context.Context, repoID, userID int64) (string, error) {
+	perms, err := s.db.ListUserTeamRepoPermissions(ctx, repoID, userID)
+	if err != nil {
+		return "", err
+	}
+	best := ""
+	for _, p := range perms {
+		if repoPermissionRank[p] > repoPermissionRank[best] {
+			best = p
+		}
+	}
+	return best, nil
+}
+
+// ResolveMemberIDs returns the members of @org/team, including members of
+// its child teams. It returns sql.ErrNoRows when the org or team does not
+// exist, so it can serve as a TeamMemberResolver.
+func (s *TeamService) ResolveMemberIDs(ctx context.Context, org, team string) ([]int64, error) {
+	members, err := s.nestedMembers(ctx, org, team)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(members))
+	for i, m := range members {
+		ids[i] = m.UserID
+	}
+	return ids, nil
+}
+
+// MemberUsernames returns the lowercased usernames of @org/team's members,
+// including members of its child teams. ok is false when the org or team
+// does not exist.
+func (s *TeamService) MemberUsernames(ctx context.Context, org, team string) (usernames []string, ok bool, err error) {
+	members, err := s.nestedMembers(ctx, org, team)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	usernames = make([]string, len(members))
+	for i, m := range members {
+		usernames[i] = strings.ToLower(m.Username)
+	}
+	return usernames, true, nil
+}
+
+func (s *TeamService) nestedMembers(ctx context.Context, orgName, teamName string) ([]models.TeamMember, error) {
+	org, err := s.db.GetOrg(ctx, orgName)
+	if err != nil {
+		return nil, err
+	}
+	team, err := s.db.GetTeam(ctx, org.ID, strings.ToLower(teamName))
+	if err != nil {
+		return nil, err
+	}
+	return s.db.ListNestedTeamMembers(ctx, team.ID)
+}
+
+func normalizeTeamName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "", fmt.Errorf("%w: name is required", ErrInvalidTeam)
+	}
+	if len(name) > maxTeamNameLength || !teamNamePattern.MatchString(name) {
+		return "", fmt.Errorf("%w: name may contain only letters, digits, '.', '_' and '-'", ErrInvalidTeam)
+	}
+	return name, nil
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+func TestTeamNestingAndRepoPermissions(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	acme := &models.Org{Name: "acme"}
+	if err := db.CreateOrg(ctx, acme); err != nil {
+		t.Fatal(err)
+	}
+	users := map[string]*models.User{}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		u := &models.User{Username: name, Email: name + "@example.com", PasswordHash: "x"}
+		if err := db.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+		users[name] = u
+	}
+	for _, name := range []string{"alice", "bob"} {
+		if err := db.AddOrgMember(ctx, &models.OrgMember{OrgID: acme.ID, UserID: users[name].ID, Role: "member"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo := &models.Repository{OwnerOrgID: &acme.ID, Name: "api", DefaultBranch: "main", StoragePath: "acme/api"}
+	if err := db.CreateRepository(ctx, repo); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewTeamService(db)
+	if _, err := svc.Create(ctx, acme.ID, "Bad Name", "", ""); !errors.Is(err, ErrInvalidTeam) {
+		t.Fatalf("expected invalid name, got %v", err)
+	}
+	eng, err := svc.Create(ctx, acme.ID, "Eng", "Engineering", "")
+	if err != nil || eng.Name != "eng" {
+		t.Fatalf("Create = %+v %v", eng, err)
+	}
+	if _, err := svc.Create(ctx, acme.ID, "eng", "", ""); !errors.Is(err, ErrTeamExists) {
+		t.Fatalf("expected duplicate team, got %v", err)
+	}
+	backend, err := svc.Create(ctx, acme.ID, "backend", "", "eng")
+	if err != nil || backend.ParentID == nil || *backend.ParentID != eng.ID {
+		t.Fatalf("Create child = %+v %v", backend, err)
+	}
+	parent := "backend"
+	if _, err := svc.Update(ctx, eng, nil, nil, &parent); !errors.Is(err, ErrInvalidTeam) {
+		t.Fatalf("expected nesting cycle to be rejected, got %v", err)
+	}
+
+	if err := svc.AddMember(ctx, backend, users["carol"].ID); !errors.Is(err, ErrNotOrgMember) {
+		t.Fatalf("expected non-member to be rejected, got %v", err)
+	}
+	if err := svc.AddMember(ctx, backend, users["alice"].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.AddMember(ctx, eng, users["bob"].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// A parent team's grant reaches members of its child teams.
+	if err := svc.SetRepoPermission(ctx, eng, repo, "read"); err != nil {
+		t.Fatal(err)
+	}
+	if perm, err := svc.RepoPermission(ctx, repo.ID, users["alice"].ID); err != nil || perm != "read" {
+		t.Fatalf("expected inherited read, got %q %v", perm, err)
+	}
+	if err := svc.SetRepoPermission(ctx, backend, repo, "write"); err != nil {
+		t.Fatal(err)
+	}
+	if perm, _ := svc.RepoPermission(ctx, repo.ID, users["alice"].ID); perm != "write" {
+		t.Fatalf("expected the strongest grant to win, got %q", perm)
+	}
+	if perm, _ := svc.RepoPermission(ctx, repo.ID, users["bob"].ID); perm != "read" {
+		t.Fatalf("expected child grants not to reach parent members, got %q", perm)
+	}
+	if err := svc.SetRepoPermission(ctx, eng, repo, "owner"); !errors.Is(err, ErrInvalidRepoPermission) {
+		t.Fatalf("expected invalid permission, got %v", err)
+	}
+
+	// A parent team's members include its child teams' members.
+	ids, err := svc.ResolveMemberIDs(ctx, "acme", "Eng")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(ids)
+	if want := []int64{users["alice"].ID, users["bob"].ID}; !slices.Equal(ids, want) {
+		t.Fatalf("ResolveMemberIDs = %v, want %v", ids, want)
+	}
+	if _, err := svc.ResolveMemberIDs(ctx, "acme", "nope"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected unknown team to be sql.ErrNoRows, got %v", err)
+	}
+	if names, ok, err := svc.MemberUsernames(ctx, "acme", "backend"); err != nil || !ok || !slices.Equal(names, []string{"alice"}) {
+		t.Fatalf("MemberUsernames = %v %v %v", names, ok, err)
+	}
+
+	// Leaving the org drops team memberships; deleting a team moves its
+	// children up.
+	if err := db.RemoveOrgMember(ctx, acme.ID, users["alice"].ID); err != nil {
+		t.Fatal(err)
+	}
+	if perm, _ := svc.RepoPermission(ctx, repo.ID, users["alice"].ID); perm != "" {
+		t.Fatalf("expected no grant after leaving the org, got %q", perm)
+	}
+	sub, err := svc.Create(ctx, acme.ID, "db", "", "backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Delete(ctx, backend); err != nil {
+		t.Fatal(err)
+	}
+	moved, err := svc.Get(ctx, acme.ID, "db")
+	if err != nil || moved.ID != sub.ID || moved.ParentID == nil || *moved.ParentID != eng.ID {
+		t.Fatalf("expected db to move under eng, got %+v %v", moved, err)
+	}
+}
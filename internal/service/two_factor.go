@@ -0,0 +1,330 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+// A sign-in that passed its first factor waits on a two-factor challenge for
+// twoFactorChallengeTTL. Each wrong code replaces the challenge until
+// twoFactorMaxAttempts is reached and the sign-in has to start over.
+const (
+	twoFactorChallengeTTL  = 5 * time.Minute
+	twoFactorMaxAttempts   = 5
+	twoFactorChallengeFlow = "two_factor"
+	recoveryCodeCount      = 10
+	totpIssuer             = "gothub"
+)
+
+var (
+	ErrInvalidTwoFactorCode   = errors.New("invalid two-factor code")
+	ErrTOTPAlreadyEnabled     = errors.New("authenticator app is already enabled")
+	ErrTOTPNotEnabled         = errors.New("authenticator app is not enabled")
+	ErrTOTPNotPending         = errors.New("no authenticator app enrollment is pending")
+	ErrTwoFactorRequiredByOrg = errors.New("an organization you belong to requires two-factor authentication")
+	ErrTwoFactorChallenge     = errors.New("invalid or expired two-factor challenge")
+)
+
+// TOTPEnrollment is what an authenticator app needs to start generating
+// codes. URI is usually shown as a QR code.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"provisioning_uri"`
+}
+
+// TwoFactorService manages TOTP enrollment, recovery codes and the challenge
+// step between a first factor and session issuance.
+type TwoFactorService struct {
+	db  database.DB
+	now func() time.Time
+}
+
+func NewTwoFactorService(db database.DB) *TwoFactorService {
+	return &TwoFactorService{db: db, now: func() time.Time { return time.Now().UTC() }}
+}
+
+// Status reports which second factors user has.
+func (s *TwoFactorService) Status(ctx context.Context, userID int64) (*models.TwoFactorStatus, error) {
+	status := &models.TwoFactorStatus{}
+	enabled, err := s.TOTPEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	status.TOTPEnabled = enabled
+	if status.PasskeyEnabled, err = s.db.HasWebAuthnCredential(ctx, userID); err != nil {
+		return nil, err
+	}
+	if enabled {
+		if status.RecoveryCodesRemaining, err = s.db.CountRecoveryCodes(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// TOTPEnabled reports whether userID has a confirmed authenticator app.
+func (s *TwoFactorService) TOTPEnabled(ctx context.Context, userID int64) (bool, error) {
+	totp, err := s.db.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return totp.ConfirmedAt != nil, nil
+}
+
+// HasStrongFactor reports whether userID satisfies an org's two-factor
+// requirement: a confirmed authenticator app or a registered passkey.
+func (s *TwoFactorService) HasStrongFactor(ctx context.Context, userID int64) (bool, error) {
+	enabled, err := s.TOTPEnabled(ctx, userID)
+	if err != nil || enabled {
+		return enabled, err
+	}
+	return s.db.HasWebAuthnCredential(ctx, userID)
+}
+
+// BeginTOTPEnrollment generates a new secret for user. It does not protect
+// sign-ins until confirmed with ConfirmTOTPEnrollment; starting again
+// replaces an unconfirmed secret.
+func (s *TwoFactorService) BeginTOTPEnrollment(ctx context.Context, user *models.User) (*TOTPEnrollment, error) {
+	enabled, err := s.TOTPEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.UpsertUserTOTP(ctx, &models.UserTOTP{UserID: user.ID, Secret: secret}); err != nil {
+		return nil, err
+	}
+	account := user.Email
+	if strings.TrimSpace(account) == "" {
+		account = user.Username
+	}
+	return &TOTPEnrollment{Secret: secret, URI: auth.TOTPProvisioningURI(totpIssuer, account, secret)}, nil
+}
+
+// ConfirmTOTPEnrollment enables the pending secret once the user proves
+// their app produces valid codes, and returns a fresh set of recovery codes.
+// The codes are only stored hashed, so this is the one time they are shown.
+func (s *TwoFactorService) ConfirmTOTPEnrollment(ctx context.Context, userID int64, code string) ([]string, error) {
+	totp, err := s.db.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTOTPNotPending
+	}
+	if err != nil {
+		return nil, err
+	}
+	if totp.ConfirmedAt != nil {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	now := s.now()
+	step, ok := auth.ValidateTOTP(totp.Secret, code, now, totp.LastUsedStep)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	if err := s.db.ConfirmUserTOTP(ctx, userID, step, now); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTOTPAlreadyEnabled
+		}
+		return nil, err
+	}
+	return s.replaceRecoveryCodes(ctx, userID)
+}
+
+// Verify checks a code from the user's authenticator app or one of their
+// unused recovery codes, consuming whichever matched.
+func (s *TwoFactorService) Verify(ctx context.Context, userID int64, code string) error {
+	totp, err := s.db.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && totp.ConfirmedAt == nil) {
+		return ErrTOTPNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	if step, ok := auth.ValidateTOTP(totp.Secret, code, now, totp.LastUsedStep); ok {
+		// Two requests racing with the same code: only one advances the step.
+		advanced, err := s.db.AdvanceUserTOTPStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if !advanced {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return ErrInvalidTwoFactorCode
+	}
+	if err := s.db.ConsumeRecoveryCode(ctx, userID, hashRecoveryCode(normalized), now); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidTwoFactorCode
+		}
+		return err
+	}
+	return nil
+}
+
+// DisableTOTP removes the authenticator app and recovery codes after
+// checking a current code. It refuses when an org the user belongs to
+// requires two-factor and no passkey would remain.
+func (s *TwoFactorService) DisableTOTP(ctx context.Context, userID int64, code string) error {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+	hasPasskey, err := s.db.HasWebAuthnCredential(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !hasPasskey {
+		required, err := s.RequiredByOrg(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if required {
+			return ErrTwoFactorRequiredByOrg
+		}
+	}
+	return s.db.DeleteUserTOTP(ctx, userID)
+}
+
+// RegenerateRecoveryCodes invalidates the user's recovery codes and returns
+// a new set, after checking a current code.
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	return s.replaceRecoveryCodes(ctx, userID)
+}
+
+// RequiredByOrg reports whether any org userID belongs to requires
+// two-factor authentication.
+func (s *TwoFactorService) RequiredByOrg(ctx context.Context, userID int64) (bool, error) {
+	orgs, err := s.db.ListUserOrgs(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, org := range orgs {
+		if org.RequireTwoFactor {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type twoFactorChallengeData struct {
+	Attempts int `json:"attempts"`
+}
+
+// CreateChallenge starts the second step of a sign-in for userID and returns
+// the challenge ID the client presents with its code.
+func (s *TwoFactorService) CreateChallenge(ctx context.Context, userID int64) (string, error) {
+	return s.createChallenge(ctx, userID, 0)
+}
+
+// VerifyChallenge consumes challengeID and checks code for the user it was
+// issued to. On a wrong code it returns ErrInvalidTwoFactorCode along with a
+// replacement challenge ID, or an empty ID once attempts are exhausted.
+func (s *TwoFactorService) VerifyChallenge(ctx context.Context, challengeID, code string) (userID int64, retryChallenge string, err error) {
+	session, err := s.db.ConsumeWebAuthnSession(ctx, strings.TrimSpace(challengeID), twoFactorChallengeFlow, s.now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, "", ErrTwoFactorChallenge
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	var data twoFactorChallengeData
+	_ = json.Unmarshal([]byte(session.DataJSON), &data)
+	err = s.Verify(ctx, session.UserID, code)
+	if err == nil {
+		return session.UserID, "", nil
+	}
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		return 0, "", err
+	}
+	if data.Attempts+1 >= twoFactorMaxAttempts {
+		return 0, "", ErrInvalidTwoFactorCode
+	}
+	retryChallenge, cerr := s.createChallenge(ctx, session.UserID, data.Attempts+1)
+	if cerr != nil {
+		return 0, "", cerr
+	}
+	return 0, retryChallenge, ErrInvalidTwoFactorCode
+}
+
+func (s *TwoFactorService) createChallenge(ctx context.Context, userID int64, attempts int) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(twoFactorChallengeData{Attempts: attempts})
+	if err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(raw)
+	if err := s.db.CreateWebAuthnSession(ctx, &models.WebAuthnSession{
+		ID:        id,
+		UserID:    userID,
+		Flow:      twoFactorChallengeFlow,
+		DataJSON:  string(data),
+		ExpiresAt: s.now().Add(twoFactorChallengeTTL),
+	}); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (s *TwoFactorService) replaceRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(raw)
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	if err := s.db.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode accepts codes with or without the dash and in either
+// case, as users tend to retype them.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	if len(code) != 10 {
+		return ""
+	}
+	if _, err := hex.DecodeString(code); err != nil {
+		return ""
+	}
+	return code
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/auth"
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+func TestTwoFactorEnrollVerifyAndRecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	alice := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := db.CreateUser(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 3, 4, 9, 0, 0, 0, time.UTC)
+	svc := NewTwoFactorService(db)
+	svc.now = func() time.Time { return now }
+	codeAt := func(secret string, at time.Time) string {
+		t.Helper()
+		code, err := auth.TOTPCode(secret, auth.TOTPStep(at))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	enrollment, err := svc.BeginTOTPEnrollment(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enabled, _ := svc.TOTPEnabled(ctx, alice.ID); enabled {
+		t.Fatal("unconfirmed enrollment must not enable TOTP")
+	}
+	if _, err := svc.ConfirmTOTPEnrollment(ctx, alice.ID, "000000"); err != ErrInvalidTwoFactorCode {
+		t.Fatalf("expected wrong confirmation code to fail, got %v", err)
+	}
+	recovery, err := svc.ConfirmTOTPEnrollment(ctx, alice.ID, codeAt(enrollment.Secret, now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recovery) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d", recoveryCodeCount, len(recovery))
+	}
+	if _, err := svc.BeginTOTPEnrollment(ctx, alice); err != ErrTOTPAlreadyEnabled {
+		t.Fatalf("expected re-enrollment to be refused, got %v", err)
+	}
+
+	// The confirmation code's step is spent; the next step's code works once.
+	if err := svc.Verify(ctx, alice.ID, codeAt(enrollment.Secret, now)); err != ErrInvalidTwoFactorCode {
+		t.Fatalf("expected replayed code to fail, got %v", err)
+	}
+	now = now.Add(auth.TOTPPeriod)
+	next := codeAt(enrollment.Secret, now)
+	if err := svc.Verify(ctx, alice.ID, next); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Verify(ctx, alice.ID, next); err != ErrInvalidTwoFactorCode {
+		t.Fatalf("expected second use of a code to fail, got %v", err)
+	}
+
+	// Recovery codes work once each, with or without the dash.
+	if err := svc.Verify(ctx, alice.ID, recovery[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Verify(ctx, alice.ID, recovery[0]); err != ErrInvalidTwoFactorCode {
+		t.Fatalf("expected used recovery code to fail, got %v", err)
+	}
+	undashed := recovery[1][:5] + recovery[1][6:]
+	if err := svc.Verify(ctx, alice.ID, undashed); err != nil {
+		t.Fatal(err)
+	}
+	status, err := svc.Status(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.TOTPEnabled || status.PasskeyEnabled || status.RecoveryCodesRemaining != recoveryCodeCount-2 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// A challenge allows a limited number of wrong codes, each replacing it.
+	challenge, err := svc.CreateChallenge(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < twoFactorMaxAttempts; i++ {
+		_, retry, err := svc.VerifyChallenge(ctx, challenge, "000000")
+		if err != ErrInvalidTwoFactorCode || retry == "" {
+			t.Fatalf("attempt %d: expected a retry challenge, got %q %v", i, retry, err)
+		}
+		if _, _, err := svc.VerifyChallenge(ctx, challenge, "000000"); err != ErrTwoFactorChallenge {
+			t.Fatalf("attempt %d: expected old challenge to be spent, got %v", i, err)
+		}
+		challenge = retry
+	}
+	if _, retry, err := svc.VerifyChallenge(ctx, challenge, "000000"); err != ErrInvalidTwoFactorCode || retry != "" {
+		t.Fatalf("expected attempts to run out, got %q %v", retry, err)
+	}
+	challenge, err = svc.CreateChallenge(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID, _, err := svc.VerifyChallenge(ctx, challenge, recovery[2]); err != nil || userID != alice.ID {
+		t.Fatalf("VerifyChallenge = %d, %v", userID, err)
+	}
+
+	// An org requirement keeps TOTP on unless a passkey takes over.
+	org := &models.Org{Name: "acme"}
+	if err := db.CreateOrg(ctx, org); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddOrgMember(ctx, &models.OrgMember{OrgID: org.ID, UserID: alice.ID, Role: "owner"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetOrgRequireTwoFactor(ctx, org.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.DisableTOTP(ctx, alice.ID, recovery[3]); err != ErrTwoFactorRequiredByOrg {
+		t.Fatalf("expected org policy to block disabling, got %v", err)
+	}
+	if err := db.SetOrgRequireTwoFactor(ctx, org.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.DisableTOTP(ctx, alice.ID, recovery[4]); err != nil {
+		t.Fatal(err)
+	}
+	if strong, err := svc.HasStrongFactor(ctx, alice.ID); err != nil || strong {
+		t.Fatalf("expected no strong factor after disabling, got %v %v", strong, err)
+	}
+	if n, err := db.CountRecoveryCodes(ctx, alice.ID); err != nil || n != 0 {
+		t.Fatalf("expected recovery codes to be removed, got %d %v", n, err)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,8 +25,12 @@ import (
 )
 
 type WebhookService struct {
-	db     database.DB
-	client *http.Client
+	db               database.DB
+	client           *http.Client
+	queue            WebhookDeliveryQueue
+	notifySvc        *NotificationService
+	autoDisableAfter time.Duration
+	audit            *AuditService
 }
 
 func NewWebhookService(db database.DB) *WebhookService {
@@ -34,30 +39,124 @@ func NewWebhookService(db database.DB) *WebhookService {
 		client: &http.Client{
 			Timeout: 5 * time.Second,
 		},
+		autoDisableAfter: defaultWebhookAutoDisableAfter,
 	}
 }
 
+// maxWebhookSecretRotationWindow bounds how long a replaced secret may keep
+// signing deliveries.
+const maxWebhookSecretRotationWindow = 7 * 24 * time.Hour
+
+// WebhookUpdate holds the settings a webhook update may change. Nil fields
+// are left unchanged.
+type WebhookUpdate struct {
+	URL    *string
+	Events []string
+	Active *bool
+	Secret *string
+	// SecretRotationWindow keeps the replaced secret signing deliveries for
+	// this long after Secret changes. Zero drops it immediately.
+	SecretRotationWindow time.Duration
+	TimestampedSignature *bool
+}
+
 func (s *WebhookService) CreateWebhook(ctx context.Context, hook *models.Webhook) error {
-	hook.URL = strings.TrimSpace(hook.URL)
-	if hook.URL == "" {
-		return fmt.Errorf("url is required")
+	var err error
+	if hook.URL, err = normalizeWebhookURL(hook.URL); err != nil {
+		return err
 	}
-	u, err := url.Parse(hook.URL)
-	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
-		return fmt.Errorf("url must be a valid HTTP or HTTPS URL")
+	if err := setWebhookEvents(hook, hook.Events); err != nil {
+		return err
 	}
-	hook.Events = normalizeWebhookEvents(hook.Events)
-	hook.EventsCSV = strings.Join(hook.Events, ",")
-	if hook.EventsCSV == "" {
-		hook.EventsCSV = "*"
+	if hook.OrgID != 0 {
+		err = s.db.CreateOrgWebhook(ctx, hook)
+	} else {
+		err = s.db.CreateWebhook(ctx, hook)
 	}
-	if err := s.db.CreateWebhook(ctx, hook); err != nil {
+	if err != nil {
 		return err
 	}
 	hook.Events = parseWebhookEvents(hook.EventsCSV)
+	s.recordAudit(ctx, hook, AuditWebhookCreate, nil, hook)
+	return nil
+}
+
+// UpdateWebhook applies update to hook, which must have been loaded with
+// GetWebhook or GetOrgWebhook. Changing the secret with a rotation window
+// keeps the old secret signing deliveries until the window closes.
+// Reactivating a hook clears its failure and disable state.
+func (s *WebhookService) UpdateWebhook(ctx context.Context, hook *models.Webhook, update WebhookUpdate) error {
+	before := *hook
+	if update.URL != nil {
+		u, err := normalizeWebhookURL(*update.URL)
+		if err != nil {
+			return err
+		}
+		hook.URL = u
+	}
+	if update.Events != nil {
+		if err := setWebhookEvents(hook, update.Events); err != nil {
+			return err
+		}
+	}
+	if update.SecretRotationWindow < 0 || update.SecretRotationWindow > maxWebhookSecretRotationWindow {
+		return fmt.Errorf("secret rotation window must be between 0 and %s", maxWebhookSecretRotationWindow)
+	}
+	if update.Secret != nil && *update.Secret != hook.Secret {
+		hook.PreviousSecret = ""
+		hook.PreviousSecretExpiresAt = nil
+		if update.SecretRotationWindow > 0 && hook.Secret != "" && *update.Secret != "" {
+			expiresAt := time.Now().UTC().Add(update.SecretRotationWindow)
+			hook.PreviousSecret = hook.Secret
+			hook.PreviousSecretExpiresAt = &expiresAt
+		}
+		hook.Secret = *update.Secret
+	}
+	if update.TimestampedSignature != nil {
+		hook.TimestampedSignature = *update.TimestampedSignature
+	}
+	if update.Active != nil {
+		if *update.Active && !hook.Active {
+			hook.FailingSince = nil
+			hook.DisabledAt = nil
+			hook.DisabledReason = ""
+		}
+		hook.Active = *update.Active
+	}
+
+	var err error
+	if hook.OrgID != 0 {
+		err = s.db.UpdateOrgWebhook(ctx, hook)
+	} else {
+		err = s.db.UpdateWebhook(ctx, hook)
+	}
+	if err != nil {
+		return err
+	}
+	hook.Events = parseWebhookEvents(hook.EventsCSV)
+	action := AuditWebhookUpdate
+	if hook.Secret != before.Secret {
+		action = AuditWebhookSecretRotate
+	}
+	s.recordAudit(ctx, hook, action, &before, hook)
 	return nil
 }
 
+// SetAuditService records webhook changes, including secret rotations.
+func (s *WebhookService) SetAuditService(audit *AuditService) {
+	s.audit = audit
+}
+
+// recordAudit records a change to hook in its repository's or org's log.
+func (s *WebhookService) recordAudit(ctx context.Context, hook *models.Webhook, action string, before, after any) {
+	detail := fmt.Sprintf("webhook/%d", hook.ID)
+	if hook.OrgID != 0 {
+		s.audit.RecordOrgID(ctx, hook.OrgID, action, detail, before, after)
+		return
+	}
+	s.audit.RecordRepoID(ctx, hook.RepoID, action, detail, before, after)
+}
+
 func (s *WebhookService) GetWebhook(ctx context.Context, repoID, webhookID int64) (*models.Webhook, error) {
 	hook, err := s.db.GetWebhook(ctx, repoID, webhookID)
 	if err != nil {
@@ -91,7 +190,11 @@ func (s *WebhookService) ListWebhooksPage(ctx context.Context, repoID int64, pag
 }
 
 func (s *WebhookService) DeleteWebhook(ctx context.Context, repoID, webhookID int64) error {
-	return s.db.DeleteWebhook(ctx, repoID, webhookID)
+	if err := s.db.DeleteWebhook(ctx, repoID, webhookID); err != nil {
+		return err
+	}
+	s.recordAudit(ctx, &models.Webhook{ID: webhookID, RepoID: repoID}, AuditWebhookDelete, nil, nil)
+	return nil
 }
 
 func (s *WebhookService) ListWebhookDeliveries(ctx context.Context, repoID, webhookID int64) ([]models.WebhookDelivery, error) {
@@ -112,7 +215,7 @@ func (s *WebhookService) Redeliver(ctx context.Context, repoID, webhookID, deliv
 	if err != nil {
 		return nil, err
 	}
-	return s.deliverWithRetry(ctx, hook, prev.Event, []byte(prev.RequestBody), &prev.ID)
+	return s.deliverWithRetry(ctx, hook, prev.RepoID, prev.Event, []byte(prev.RequestBody), &prev.ID)
 }
 
 func (s *WebhookService) PingWebhook(ctx context.Context, repoID, webhookID int64) (*models.WebhookDelivery, error) {
@@ -128,45 +231,42 @@ func (s *WebhookService) PingWebhook(ctx context.Context, repoID, webhookID int6
 		"emitted_at": time.Now().UTC().Format(time.RFC3339),
 	}
 	body, _ := json.Marshal(payload)
-	return s.deliverWithRetry(ctx, hook, "ping", body, nil)
+	return s.deliverWithRetry(ctx, hook, repoID, models.WebhookEventPing, body, nil)
 }
 
 func (s *WebhookService) EmitPullRequestEvent(ctx context.Context, repoID int64, action string, pr *models.PullRequest) error {
-	payload := map[string]any{
-		"action": action,
-		"number": pr.Number,
-		"pull_request": map[string]any{
-			"id":            pr.ID,
-			"number":        pr.Number,
-			"title":         pr.Title,
-			"body":          pr.Body,
-			"state":         pr.State,
-			"author_id":     pr.AuthorID,
-			"author_name":   pr.AuthorName,
-			"source_branch": pr.SourceBranch,
-			"target_branch": pr.TargetBranch,
-			"merge_commit":  pr.MergeCommit,
-			"merge_method":  pr.MergeMethod,
-			"created_at":    pr.CreatedAt,
-			"merged_at":     pr.MergedAt,
-		},
-		"entities_changed":  []map[string]string{},
-		"entities_added":    0,
-		"entities_removed":  0,
-		"entities_modified": 0,
+	repo, err := s.db.GetRepositoryByID(ctx, repoID)
+	if err != nil {
+		return err
 	}
+	payload := s.eventPayload(ctx, repo, action)
+	payload["number"] = pr.Number
+	payload["pull_request"] = map[string]any{
+		"id":            pr.ID,
+		"number":        pr.Number,
+		"title":         pr.Title,
+		"body":          pr.Body,
+		"state":         pr.State,
+		"author_id":     pr.AuthorID,
+		"author_name":   pr.AuthorName,
+		"source_branch": pr.SourceBranch,
+		"target_branch": pr.TargetBranch,
+		"merge_commit":  pr.MergeCommit,
+		"merge_method":  pr.MergeMethod,
+		"created_at":    pr.CreatedAt,
+		"merged_at":     pr.MergedAt,
+	}
+	payload["entities_changed"] = []map[string]string{}
+	payload["entities_added"] = 0
+	payload["entities_removed"] = 0
+	payload["entities_modified"] = 0
 	if summary, err := s.computePREntityChanges(ctx, repoID, pr); err == nil {
 		payload["entities_changed"] = summary.Changes
 		payload["entities_added"] = summary.Added
 		payload["entities_removed"] = summary.Removed
 		payload["entities_modified"] = summary.Modified
 	}
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return err
-	}
-	_, err = s.emitRepoEvent(ctx, repoID, "pull_request", body)
-	return err
+	return s.emit(ctx, repo, models.WebhookEventPullRequest, payload)
 }
 
 type prEntityChangeSummary struct {
@@ -286,29 +386,44 @@ func (s *WebhookService) computePREntityChanges(ctx context.Context, repoID int6
 }
 
 func (s *WebhookService) EmitIssueEvent(ctx context.Context, repoID int64, action string, number int, title, body, state string) error {
-	payload := map[string]any{
-		"action": action,
+	repo, err := s.db.GetRepositoryByID(ctx, repoID)
+	if err != nil {
+		return err
+	}
+	payload := s.eventPayload(ctx, repo, action)
+	payload["number"] = number
+	payload["issue"] = map[string]any{
 		"number": number,
-		"issue": map[string]any{
-			"number": number,
-			"title":  title,
-			"body":   body,
-			"state":  state,
-		},
+		"title":  title,
+		"body":   body,
+		"state":  state,
 	}
-	data, err := json.Marshal(payload)
+	return s.emit(ctx, repo, models.WebhookEventIssues, payload)
+}
+
+func (s *WebhookService) emit(ctx context.Context, repo *models.Repository, event string, payload map[string]any) error {
+	body, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
-	_, err = s.emitRepoEvent(ctx, repoID, "issues", data)
+	_, err = s.emitRepoEvent(ctx, repo, event, body)
 	return err
 }
 
-func (s *WebhookService) emitRepoEvent(ctx context.Context, repoID int64, event string, body []byte) ([]*models.WebhookDelivery, error) {
-	hooks, err := s.db.ListWebhooks(ctx, repoID)
+// emitRepoEvent delivers body to the repository's hooks and to the hooks of
+// the org that owns it, through the delivery queue when one is set.
+func (s *WebhookService) emitRepoEvent(ctx context.Context, repo *models.Repository, event string, body []byte) ([]*models.WebhookDelivery, error) {
+	hooks, err := s.db.ListWebhooks(ctx, repo.ID)
 	if err != nil {
 		return nil, err
 	}
+	if repo.OwnerOrgID != nil {
+		orgHooks, err := s.db.ListOrgWebhooks(ctx, *repo.OwnerOrgID)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, orgHooks...)
+	}
 	var deliveries []*models.WebhookDelivery
 	for i := range hooks {
 		h := hooks[i]
@@ -318,7 +433,13 @@ func (s *WebhookService) emitRepoEvent(ctx context.Context, repoID int64, event
 		if !webhookEventMatches(h.EventsCSV, event) {
 			continue
 		}
-		d, err := s.deliverWithRetry(ctx, &h, event, body, nil)
+		if s.queue != nil {
+			if err := s.enqueueDelivery(ctx, &h, repo.ID, event, body); err != nil {
+				return deliveries, err
+			}
+			continue
+		}
+		d, err := s.deliverWithRetry(ctx, &h, repo.ID, event, body, nil)
 		if err != nil {
 			// Keep dispatching to other webhooks.
 			continue
@@ -328,64 +449,18 @@ func (s *WebhookService) emitRepoEvent(ctx context.Context, repoID int64, event
 	return deliveries, nil
 }
 
-func (s *WebhookService) deliverWithRetry(ctx context.Context, hook *models.Webhook, event string, body []byte, redeliveryOf *int64) (*models.WebhookDelivery, error) {
+func (s *WebhookService) deliverWithRetry(ctx context.Context, hook *models.Webhook, repoID int64, event string, body []byte, redeliveryOf *int64) (*models.WebhookDelivery, error) {
 	const maxAttempts = 3
 	deliveryUID := randomDeliveryUID()
 	var last *models.WebhookDelivery
 
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		start := time.Now()
-		statusCode := 0
-		respBody := ""
-		errText := ""
-		success := false
-
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+		delivery, err := s.deliverOnce(ctx, hook, repoID, event, deliveryUID, attempt, body, redeliveryOf)
 		if err != nil {
-			errText = err.Error()
-		} else {
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("User-Agent", "gothub-webhook/1.0")
-			req.Header.Set("X-Gothub-Event", event)
-			req.Header.Set("X-Gothub-Delivery", deliveryUID)
-			if hook.Secret != "" {
-				req.Header.Set("X-Hub-Signature-256", signBody(hook.Secret, body))
-			}
-
-			resp, err := s.client.Do(req)
-			if err != nil {
-				errText = err.Error()
-			} else {
-				statusCode = resp.StatusCode
-				respBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 32*1024))
-				resp.Body.Close()
-				respBody = string(respBytes)
-				success = statusCode >= 200 && statusCode < 300
-				if !success && errText == "" {
-					errText = fmt.Sprintf("unexpected status code %d", statusCode)
-				}
-			}
-		}
-
-		delivery := &models.WebhookDelivery{
-			RepoID:         hook.RepoID,
-			WebhookID:      hook.ID,
-			Event:          event,
-			DeliveryUID:    deliveryUID,
-			Attempt:        attempt,
-			StatusCode:     statusCode,
-			Success:        success,
-			Error:          errText,
-			RequestBody:    string(body),
-			ResponseBody:   respBody,
-			DurationMS:     time.Since(start).Milliseconds(),
-			RedeliveryOfID: redeliveryOf,
-		}
-		if err := s.db.CreateWebhookDelivery(ctx, delivery); err != nil {
 			return nil, err
 		}
 		last = delivery
-		if success {
+		if delivery.Success {
 			return delivery, nil
 		}
 		if attempt < maxAttempts {
@@ -399,6 +474,95 @@ func (s *WebhookService) deliverWithRetry(ctx context.Context, hook *models.Webh
 	return last, fmt.Errorf("delivery failed after retries: %s", last.Error)
 }
 
+// deliverOnce posts body to the hook and records the attempt against the
+// repository the event came from. Only failures to record the delivery are
+// returned as errors.
+func (s *WebhookService) deliverOnce(ctx context.Context, hook *models.Webhook, repoID int64, event, deliveryUID string, attempt int, body []byte, redeliveryOf *int64) (*models.WebhookDelivery, error) {
+	start := time.Now()
+	statusCode := 0
+	respBody := ""
+	errText := ""
+	success := false
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		errText = err.Error()
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "gothub-webhook/1.0")
+		req.Header.Set("X-Gothub-Event", event)
+		req.Header.Set("X-Gothub-Delivery", deliveryUID)
+		req.Header.Set("X-Gothub-Event-Version", strconv.Itoa(webhookSchemaVersion(event)))
+		setWebhookSignatures(req.Header, hook, body, time.Now())
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			errText = err.Error()
+		} else {
+			statusCode = resp.StatusCode
+			respBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 32*1024))
+			resp.Body.Close()
+			respBody = string(respBytes)
+			success = statusCode >= 200 && statusCode < 300
+			if !success && errText == "" {
+				errText = fmt.Sprintf("unexpected status code %d", statusCode)
+			}
+		}
+	}
+
+	delivery := &models.WebhookDelivery{
+		RepoID:         repoID,
+		OrgID:          hook.OrgID,
+		WebhookID:      hook.ID,
+		Event:          event,
+		DeliveryUID:    deliveryUID,
+		Attempt:        attempt,
+		StatusCode:     statusCode,
+		Success:        success,
+		Error:          errText,
+		RequestBody:    string(body),
+		ResponseBody:   respBody,
+		DurationMS:     time.Since(start).Milliseconds(),
+		RedeliveryOfID: redeliveryOf,
+	}
+	if hook.OrgID != 0 {
+		err = s.db.CreateOrgWebhookDelivery(ctx, delivery)
+	} else {
+		err = s.db.CreateWebhookDelivery(ctx, delivery)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func normalizeWebhookURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("url is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("url must be a valid HTTP or HTTPS URL")
+	}
+	return raw, nil
+}
+
+func setWebhookEvents(hook *models.Webhook, events []string) error {
+	events = normalizeWebhookEvents(events)
+	for _, e := range events {
+		if e != "*" && !isWebhookEvent(e) {
+			return fmt.Errorf("%w: %s", ErrUnknownWebhookEvent, e)
+		}
+	}
+	hook.Events = events
+	hook.EventsCSV = strings.Join(events, ",")
+	if hook.EventsCSV == "" {
+		hook.EventsCSV = "*"
+	}
+	return nil
+}
+
 func normalizeWebhookEvents(events []string) []string {
 	if len(events) == 0 {
 		return []string{"*"}
@@ -426,9 +590,14 @@ func parseWebhookEvents(csv string) []string {
 	return normalizeWebhookEvents(strings.Split(csv, ","))
 }
 
+// webhookEventMatches reports whether a hook subscribed to eventsCSV should
+// receive event. Only catalog events are ever delivered.
 func webhookEventMatches(eventsCSV, event string) bool {
-	events := parseWebhookEvents(eventsCSV)
 	event = strings.TrimSpace(strings.ToLower(event))
+	if !isWebhookEvent(event) {
+		return false
+	}
+	events := parseWebhookEvents(eventsCSV)
 	for _, e := range events {
 		if e == "*" || e == event {
 			return true
@@ -437,12 +606,48 @@ func webhookEventMatches(eventsCSV, event string) bool {
 	return false
 }
 
+// setWebhookSignatures signs body with the hook's secret. While a rotated
+// secret is still within its window, deliveries carry a signature for it too.
+// Hooks with timestamped signatures also get X-Gothub-Signature, which signs
+// "<unix time>.<body>" so receivers can reject replayed deliveries.
+func setWebhookSignatures(h http.Header, hook *models.Webhook, body []byte, now time.Time) {
+	if hook.Secret == "" {
+		return
+	}
+	secrets := []string{hook.Secret}
+	if hook.PreviousSecret != "" && hook.PreviousSecretExpiresAt != nil && now.Before(*hook.PreviousSecretExpiresAt) {
+		secrets = append(secrets, hook.PreviousSecret)
+	}
+	h.Set("X-Hub-Signature-256", signBody(secrets[0], body))
+	if len(secrets) > 1 {
+		h.Set("X-Hub-Signature-256-Previous", signBody(secrets[1], body))
+	}
+	if hook.TimestampedSignature {
+		h.Set("X-Gothub-Signature", signTimestamped(secrets, body, now))
+	}
+}
+
 func signBody(secret string, body []byte) string {
 	m := hmac.New(sha256.New, []byte(secret))
 	m.Write(body)
 	return "sha256=" + hex.EncodeToString(m.Sum(nil))
 }
 
+// signTimestamped formats "t=<unix>,v1=<hex>[,v1=<hex>...]", one v1 per
+// secret.
+func signTimestamped(secrets []string, body []byte, now time.Time) string {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	parts := []string{"t=" + ts}
+	for _, secret := range secrets {
+		m := hmac.New(sha256.New, []byte(secret))
+		m.Write([]byte(ts))
+		m.Write([]byte("."))
+		m.Write(body)
+		parts = append(parts, "v1="+hex.EncodeToString(m.Sum(nil)))
+	}
+	return strings.Join(parts, ",")
+}
+
 func randomDeliveryUID() string {
 	var b [12]byte
 	if _, err := rand.Read(b[:]); err != nil {
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+const defaultWebhookAutoDisableAfter = 72 * time.Hour
+
+// WebhookDeliveryQueue persists webhook deliveries for background workers.
+type WebhookDeliveryQueue interface {
+	Enqueue(ctx context.Context, job *models.IndexingJob) (*models.IndexingJob, error)
+}
+
+// webhookDeliveryPayload is the queued job payload for one delivery.
+type webhookDeliveryPayload struct {
+	WebhookID int64           `json:"webhook_id"`
+	OrgID     int64           `json:"org_id,omitempty"` // set for org webhooks
+	Event     string          `json:"event"`
+	Body      json.RawMessage `json:"body"`
+	TenantID  string          `json:"tenant_id,omitempty"`
+}
+
+// SetDeliveryQueue makes event deliveries durable: each matching hook gets a
+// queued job that ProcessDeliveryJob runs. Without a queue, deliveries are
+// attempted inline.
+func (s *WebhookService) SetDeliveryQueue(queue WebhookDeliveryQueue) {
+	s.queue = queue
+}
+
+// SetAutoDisableAfter sets how long a hook may fail every delivery before it
+// is disabled. Zero or negative restores the default of three days.
+func (s *WebhookService) SetAutoDisableAfter(d time.Duration) {
+	if d <= 0 {
+		d = defaultWebhookAutoDisableAfter
+	}
+	s.autoDisableAfter = d
+}
+
+// SetNotificationService enables notifying repository admins when a hook is
+// auto-disabled.
+func (s *WebhookService) SetNotificationService(notifySvc *NotificationService) {
+	s.notifySvc = notifySvc
+}
+
+func (s *WebhookService) enqueueDelivery(ctx context.Context, hook *models.Webhook, repoID int64, event string, body []byte) error {
+	payload := webhookDeliveryPayload{WebhookID: hook.ID, OrgID: hook.OrgID, Event: event, Body: body}
+	if tenantID, ok := database.TenantIDFromContext(ctx); ok {
+		payload.TenantID = tenantID
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("webhook:%d", hook.ID)
+	if hook.OrgID != 0 {
+		key = fmt.Sprintf("org-webhook:%d", hook.ID)
+	}
+	_, err = s.queue.Enqueue(ctx, &models.IndexingJob{
+		RepoID:         repoID,
+		CommitHash:     randomDeliveryUID(),
+		ConcurrencyKey: key,
+		Payload:        string(data),
+	})
+	return err
+}
+
+// ProcessDeliveryJob makes one delivery attempt for a queued job. A returned
+// error asks the queue to retry with backoff. Deliveries to deleted or
+// inactive hooks are dropped.
+func (s *WebhookService) ProcessDeliveryJob(ctx context.Context, job *models.IndexingJob) error {
+	if job == nil {
+		return fmt.Errorf("webhook delivery job is nil")
+	}
+	if job.JobType != models.IndexJobTypeWebhookDelivery {
+		return fmt.Errorf("unsupported job type %q", job.JobType)
+	}
+	var payload webhookDeliveryPayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return fmt.Errorf("decode webhook delivery payload: %w", err)
+	}
+	ctx = database.WithTenantID(ctx, payload.TenantID)
+
+	var hook *models.Webhook
+	var err error
+	if payload.OrgID != 0 {
+		hook, err = s.db.GetOrgWebhook(ctx, payload.OrgID, payload.WebhookID)
+	} else {
+		hook, err = s.db.GetWebhook(ctx, job.RepoID, payload.WebhookID)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if !hook.Active {
+		return nil
+	}
+
+	delivery, err := s.deliverOnce(ctx, hook, job.RepoID, payload.Event, job.CommitHash, job.AttemptCount, payload.Body, nil)
+	if err != nil {
+		return err
+	}
+	if delivery.Success {
+		if hook.OrgID != 0 {
+			return s.db.ClearOrgWebhookFailure(ctx, hook.OrgID, hook.ID)
+		}
+		return s.db.ClearWebhookFailure(ctx, hook.RepoID, hook.ID)
+	}
+	var failingSince time.Time
+	if hook.OrgID != 0 {
+		failingSince, err = s.db.RecordOrgWebhookFailure(ctx, hook.OrgID, hook.ID)
+	} else {
+		failingSince, err = s.db.RecordWebhookFailure(ctx, hook.RepoID, hook.ID)
+	}
+	if err != nil {
+		return err
+	}
+	if time.Since(failingSince) >= s.autoDisableAfter {
+		return s.disableFailingHook(ctx, hook, failingSince)
+	}
+	return fmt.Errorf("webhook delivery failed: %s", delivery.Error)
+}
+
+func (s *WebhookService) disableFailingHook(ctx context.Context, hook *models.Webhook, failingSince time.Time) error {
+	reason := fmt.Sprintf("deliveries failed continuously since %s", failingSince.UTC().Format(time.RFC3339))
+	var err error
+	if hook.OrgID != 0 {
+		err = s.db.DisableOrgWebhook(ctx, hook.OrgID, hook.ID, reason)
+	} else {
+		err = s.db.DisableWebhook(ctx, hook.RepoID, hook.ID, reason)
+	}
+	if err != nil {
+		return err
+	}
+	if s.notifySvc == nil {
+		return nil
+	}
+	return s.notifySvc.NotifyWebhookDisabled(ctx, hook, reason)
+}
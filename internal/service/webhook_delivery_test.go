@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/jobs"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+func TestWebhookDeliveryQueueAutoDisablesFailingHook(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	db, err := database.OpenSQLite(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	users := map[string]*models.User{}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		u := &models.User{Username: name, Email: name + "@example.com", PasswordHash: "x"}
+		if err := db.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+		users[name] = u
+	}
+	repo := &models.Repository{OwnerUserID: &users["alice"].ID, Name: "repo", DefaultBranch: "main", StoragePath: "pending"}
+	if err := db.CreateRepository(ctx, repo); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddCollaborator(ctx, &models.Collaborator{RepoID: repo.ID, UserID: users["bob"].ID, Role: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddCollaborator(ctx, &models.Collaborator{RepoID: repo.ID, UserID: users["carol"].ID, Role: "write"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var hits atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	queue := jobs.NewQueue(db, jobs.QueueOptions{
+		JobType:       models.IndexJobTypeWebhookDelivery,
+		RetryDelay:    time.Millisecond,
+		MaxRetryDelay: 4 * time.Millisecond,
+		MaxAttempts:   5,
+	})
+	svc := NewWebhookService(db)
+	svc.SetDeliveryQueue(queue)
+	svc.SetNotificationService(NewNotificationService(db))
+
+	hook := &models.Webhook{RepoID: repo.ID, URL: receiver.URL, Events: []string{"issues"}, Active: true}
+	if err := svc.CreateWebhook(ctx, hook); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.EmitIssueEvent(ctx, repo.ID, models.WebhookActionOpened, 1, "first", "", models.IssueStateOpen); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.EmitIssueEvent(ctx, repo.ID, models.WebhookActionOpened, 2, "second", "", models.IssueStateOpen); err != nil {
+		t.Fatal(err)
+	}
+	if hits.Load() != 0 {
+		t.Fatal("expected deliveries to be queued, not sent inline")
+	}
+
+	first, err := queue.Claim(ctx)
+	if err != nil || first == nil {
+		t.Fatalf("claim first delivery: job=%v err=%v", first, err)
+	}
+	if err := svc.ProcessDeliveryJob(ctx, first); err == nil {
+		t.Fatal("expected failed delivery to be retried")
+	}
+	if err := queue.RetryOrFail(ctx, first, err); err != nil {
+		t.Fatal(err)
+	}
+	got, err := svc.GetWebhook(ctx, repo.ID, hook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Active || got.FailingSince == nil {
+		t.Fatalf("expected active hook marked failing, got %+v", got)
+	}
+
+	// The retry is claimed before the second event, and once the hook has
+	// been failing long enough it is disabled.
+	time.Sleep(5 * time.Millisecond)
+	retry, err := queue.Claim(ctx)
+	if err != nil || retry == nil {
+		t.Fatalf("claim retry: job=%v err=%v", retry, err)
+	}
+	if retry.ID != first.ID || retry.AttemptCount != 2 {
+		t.Fatalf("expected retry of job %d, got %+v", first.ID, retry)
+	}
+	svc.SetAutoDisableAfter(time.Nanosecond)
+	if err := svc.ProcessDeliveryJob(ctx, retry); err != nil {
+		t.Fatalf("expected disabling delivery to complete, got %v", err)
+	}
+	if err := queue.Complete(ctx, retry.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, err = svc.GetWebhook(ctx, repo.ID, hook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Active || got.DisabledAt == nil || got.DisabledReason == "" || got.FailingSince != nil {
+		t.Fatalf("expected disabled hook, got %+v", got)
+	}
+
+	for name, want := range map[string]int{"alice": 1, "bob": 1, "carol": 0} {
+		notes, err := db.ListNotificationsPage(ctx, users[name].ID, false, "", 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(notes) != want {
+			t.Fatalf("%s: expected %d notifications, got %+v", name, want, notes)
+		}
+		if want > 0 && notes[0].Type != "webhook.disabled" {
+			t.Fatalf("%s: unexpected notification %+v", name, notes[0])
+		}
+	}
+
+	second, err := queue.Claim(ctx)
+	if err != nil || second == nil {
+		t.Fatalf("claim second delivery: job=%v err=%v", second, err)
+	}
+	if err := svc.ProcessDeliveryJob(ctx, second); err != nil {
+		t.Fatalf("expected delivery to disabled hook to be dropped, got %v", err)
+	}
+	deliveries, err := svc.ListWebhookDeliveries(ctx, repo.ID, hook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 || hits.Load() != 2 {
+		t.Fatalf("expected 2 recorded attempts, got %d rows and %d hits", len(deliveries), hits.Load())
+	}
+	if deliveries[0].DeliveryUID != deliveries[1].DeliveryUID {
+		t.Fatalf("expected retries to share a delivery UID, got %+v", deliveries)
+	}
+}
+
+func TestRepositoryDeletedWebhookIsQueued(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	org := &models.Org{Name: "acme"}
+	if err := db.CreateOrg(ctx, org); err != nil {
+		t.Fatal(err)
+	}
+	repo := &models.Repository{OwnerOrgID: &org.ID, Name: "repo", DefaultBranch: "main", StoragePath: "pending"}
+	if err := db.CreateRepository(ctx, repo); err != nil {
+		t.Fatal(err)
+	}
+
+	var hits atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	queue := jobs.NewQueue(db, jobs.QueueOptions{JobType: models.IndexJobTypeWebhookDelivery})
+	svc := NewWebhookService(db)
+	svc.SetDeliveryQueue(queue)
+	hook := &models.Webhook{OrgID: org.ID, URL: receiver.URL, Events: []string{"repository"}, Active: true}
+	if err := svc.CreateWebhook(ctx, hook); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteRepository(ctx, repo.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.EmitRepositoryEvent(ctx, repo, models.WebhookActionDeleted, nil); err != nil {
+		t.Fatal(err)
+	}
+	if hits.Load() != 0 {
+		t.Fatal("expected the deleted event to be queued, not sent inline")
+	}
+	job, err := queue.Claim(ctx)
+	if err != nil || job == nil {
+		t.Fatalf("claim deleted event: job=%v err=%v", job, err)
+	}
+	if err := svc.ProcessDeliveryJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := svc.ListOrgWebhookDeliveriesPage(ctx, org.ID, hook.ID, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits.Load() != 1 || len(deliveries) != 1 || !deliveries[0].Success || deliveries[0].RepoID != repo.ID {
+		t.Fatalf("expected one successful delivery for the deleted repo, got %d hits and %+v", hits.Load(), deliveries)
+	}
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+var ErrUnknownWebhookEvent = errors.New("unknown webhook event")
+
+// webhookEventCatalog lists every event a webhook can subscribe to. Bump an
+// event's SchemaVersion whenever its payload changes incompatibly and
+// document the change in docs/webhooks.md.
+var webhookEventCatalog = []models.WebhookEventSpec{
+	{Name: models.WebhookEventPing, SchemaVersion: 1, Description: "Sent when a webhook is pinged."},
+	{Name: models.WebhookEventPullRequest, SchemaVersion: 1, Actions: []string{models.WebhookActionOpened, models.WebhookActionMerged}, Description: "Pull request activity."},
+	{Name: models.WebhookEventPullRequestReview, SchemaVersion: 1, Actions: []string{models.WebhookActionSubmitted}, Description: "A pull request review was submitted."},
+	{Name: models.WebhookEventPullRequestReviewComment, SchemaVersion: 1, Actions: []string{models.WebhookActionCreated}, Description: "A comment was left on a file or entity in a pull request diff."},
+	{Name: models.WebhookEventIssues, SchemaVersion: 1, Actions: []string{models.WebhookActionOpened, models.WebhookActionEdited, models.WebhookActionClosed, models.WebhookActionReopened}, Description: "Issue activity."},
+	{Name: models.WebhookEventIssueComment, SchemaVersion: 1, Actions: []string{models.WebhookActionCreated}, Description: "A comment was left on an issue or on a pull request conversation."},
+	{Name: models.WebhookEventCheckRun, SchemaVersion: 1, Actions: []string{models.WebhookActionCreated, models.WebhookActionCompleted}, Description: "A check run on a pull request was reported."},
+	{Name: models.WebhookEventBranchProtectionRule, SchemaVersion: 1, Actions: []string{models.WebhookActionCreated, models.WebhookActionEdited, models.WebhookActionDeleted}, Description: "Branch protection rule changes."},
+	{Name: models.WebhookEventRepository, SchemaVersion: 1, Actions: []string{models.WebhookActionCreated, models.WebhookActionDeleted, models.WebhookActionForked}, Description: "Repository lifecycle. Only org webhooks see created and deleted."},
+	{Name: models.WebhookEventStar, SchemaVersion: 1, Actions: []string{models.WebhookActionCreated, models.WebhookActionDeleted}, Description: "A repository was starred or unstarred."},
+	{Name: models.WebhookEventMember, SchemaVersion: 1, Actions: []string{models.WebhookActionAdded, models.WebhookActionRemoved}, Description: "A collaborator was added to or removed from a repository."},
+}
+
+// WebhookEvents returns the webhook event catalog.
+func WebhookEvents() []models.WebhookEventSpec {
+	return append([]models.WebhookEventSpec(nil), webhookEventCatalog...)
+}
+
+func isWebhookEvent(name string) bool {
+	return webhookSchemaVersion(name) > 0
+}
+
+func webhookSchemaVersion(name string) int {
+	for _, spec := range webhookEventCatalog {
+		if spec.Name == name {
+			return spec.SchemaVersion
+		}
+	}
+	return 0
+}
+
+// eventPayload starts a payload with the fields every repository event
+// carries: action, repository and, for org-owned repositories, organization.
+func (s *WebhookService) eventPayload(ctx context.Context, repo *models.Repository, action string) map[string]any {
+	payload := map[string]any{
+		"repository": map[string]any{
+			"id":             repo.ID,
+			"name":           repo.Name,
+			"full_name":      repo.OwnerName + "/" + repo.Name,
+			"owner":          repo.OwnerName,
+			"private":        repo.IsPrivate,
+			"default_branch": repo.DefaultBranch,
+		},
+	}
+	if action != "" {
+		payload["action"] = action
+	}
+	if repo.OwnerOrgID != nil {
+		org := map[string]any{"id": *repo.OwnerOrgID}
+		if o, err := s.db.GetOrgByID(ctx, *repo.OwnerOrgID); err == nil {
+			org["name"] = o.Name
+		}
+		payload["organization"] = org
+	}
+	return payload
+}
+
+func webhookUserPayload(id int64, username string) map[string]any {
+	return map[string]any{"id": id, "username": username}
+}
+
+func webhookPullRequestSummary(pr *models.PullRequest) map[string]any {
+	return map[string]any{
+		"id":            pr.ID,
+		"number":        pr.Number,
+		"title":         pr.Title,
+		"state":         pr.State,
+		"source_branch": pr.SourceBranch,
+		"target_branch": pr.TargetBranch,
+	}
+}
+
+func (s *WebhookService) EmitPullRequestReviewEvent(ctx context.Context, repoID int64, pr *models.PullRequest, review *models.PRReview) error {
+	repo, err := s.db.GetRepositoryByID(ctx, repoID)
+	if err != nil {
+		return err
+	}
+	payload := s.eventPayload(ctx, repo, models.WebhookActionSubmitted)
+	payload["pull_request"] = webhookPullRequestSummary(pr)
+	payload["review"] = map[string]any{
+		"id":          review.ID,
+		"state":       review.State,
+		"body":        review.Body,
+		"commit_hash": review.CommitHash,
+		"user":        webhookUserPayload(review.AuthorID, review.AuthorName),
+		"created_at":  review.CreatedAt,
+	}
+	return s.emit(ctx, repo, models.WebhookEventPullRequestReview, payload)
+}
+
+// EmitPullRequestCommentEvent sends pull_request_review_comment for comments
+// anchored to a file or entity, and issue_comment for conversation comments.
+func (s *WebhookService) EmitPullRequestCommentEvent(ctx context.Context, repoID int64, pr *models.PullRequest, comment *models.PRComment) error {
+	repo, err := s.db.GetRepositoryByID(ctx, repoID)
+	if err != nil {
+		return err
+	}
+	payload := s.eventPayload(ctx, repo, models.WebhookActionCreated)
+	body := map[string]any{
+		"id":         comment.ID,
+		"body":       comment.Body,
+		"user":       webhookUserPayload(comment.AuthorID, comment.AuthorName),
+		"created_at": comment.CreatedAt,
+	}
+	payload["comment"] = body
+	if comment.FilePath == "" && comment.EntityKey == "" {
+		payload["issue"] = map[string]any{
+			"number":       pr.Number,
+			"title":        pr.Title,
+			"state":        pr.State,
+			"pull_request": true,
+		}
+		return s.emit(ctx, repo, models.WebhookEventIssueComment, payload)
+	}
+	body["path"] = comment.FilePath
+	body["entity_key"] = comment.EntityKey
+	body["entity_stable_id"] = comment.EntityStableID
+	body["line"] = comment.LineNumber
+	body["commit_hash"] = comment.CommitHash
+	payload["pull_request"] = webhookPullRequestSummary(pr)
+	return s.emit(ctx, repo, models.WebhookEventPullRequestReviewComment, payload)
+}
+
+func (s *WebhookService) EmitIssueCommentEvent(ctx context.Context, repoID int64, issue *models.Issue, comment *models.IssueComment) error {
+	repo, err := s.db.GetRepositoryByID(ctx, repoID)
+	if err != nil {
+		return err
+	}
+	payload := s.eventPayload(ctx, repo, models.WebhookActionCreated)
+	payload["issue"] = map[string]any{
+		"number":       issue.Number,
+		"title":        issue.Title,
+		"state":        issue.State,
+		"pull_request": false,
+	}
+	payload["comment"] = map[string]any{
+		"id":         comment.ID,
+		"body":       comment.Body,
+		"user":       webhookUserPayload(comment.AuthorID, comment.AuthorName),
+		"created_at": comment.CreatedAt,
+	}
+	return s.emit(ctx, repo, models.WebhookEventIssueComment, payload)
+}
+
+// EmitCheckRunEvent reports a check run as completed once it has a
+// completed status, and as created otherwise.
+func (s *WebhookService) EmitCheckRunEvent(ctx context.Context, repoID int64, pr *models.PullRequest, run *models.PRCheckRun) error {
+	repo, err := s.db.GetRepositoryByID(ctx, repoID)
+	if err != nil {
+		return err
+	}
+	action := models.WebhookActionCreated
+	if run.Status == "completed" {
+		action = models.WebhookActionCompleted
+	}
+	payload := s.eventPayload(ctx, repo, action)
+	payload["pull_request"] = webhookPullRequestSummary(pr)
+	payload["check_run"] = map[string]any{
+		"id":          run.ID,
+		"name":        run.Name,
+		"status":      run.Status,
+		"conclusion":  run.Conclusion,
+		"details_url": run.DetailsURL,
+		"external_id": run.ExternalID,
+		"head_commit": run.HeadCommit,
+		"updated_at":  run.UpdatedAt,
+	}
+	return s.emit(ctx, repo, models.WebhookEventCheckRun, payload)
+}
+
+func (s *WebhookService) EmitBranchProtectionRuleEvent(ctx context.Context, repoID int64, action string, rule *models.BranchProtectionRule) error {
+	repo, err := s.db.GetRepositoryByID(ctx, repoID)
+	if err != nil {
+		return err
+	}
+	payload := s.eventPayload(ctx, repo, action)
+	payload["rule"] = rule
+	return s.emit(ctx, repo, models.WebhookEventBranchProtectionRule, payload)
+}
+
+// EmitRepositoryEvent sends a repository event. For forked, repo is the
+// source repository and forkee the new fork. Deleted events are sent after
+// the repository row is gone, so only org webhooks receive them.
+func (s *WebhookService) EmitRepositoryEvent(ctx context.Context, repo *models.Repository, action string, forkee *models.Repository) error {
+	payload := s.eventPayload(ctx, repo, action)
+	if forkee != nil {
+		payload["forkee"] = map[string]any{
+			"id":        forkee.ID,
+			"name":      forkee.Name,
+			"full_name": forkee.OwnerName + "/" + forkee.Name,
+			"owner":     forkee.OwnerName,
+			"private":   forkee.IsPrivate,
+		}
+	}
+	return s.emit(ctx, repo, models.WebhookEventRepository, payload)
+}
+
+func (s *WebhookService) EmitStarEvent(ctx context.Context, repoID int64, action string, userID int64, username string) error {
+	repo, err := s.db.GetRepositoryByID(ctx, repoID)
+	if err != nil {
+		return err
+	}
+	payload := s.eventPayload(ctx, repo, action)
+	payload["user"] = webhookUserPayload(userID, username)
+	return s.emit(ctx, repo, models.WebhookEventStar, payload)
+}
+
+func (s *WebhookService) EmitMemberEvent(ctx context.Context, repoID int64, action string, userID int64, username, role string) error {
+	repo, err := s.db.GetRepositoryByID(ctx, repoID)
+	if err != nil {
+		return err
+	}
+	payload := s.eventPayload(ctx, repo, action)
+	member := webhookUserPayload(userID, username)
+	if role != "" {
+		member["role"] = role
+	}
+	payload["member"] = member
+	return s.emit(ctx, repo, models.WebhookEventMember, payload)
+}
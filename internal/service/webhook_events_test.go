@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/odvcencio/gothub/internal/database"
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+type recordedWebhook struct {
+	Event   string
+	Version string
+	Body    map[string]any
+}
+
+func TestOrgWebhooksReceiveEventsForOrgRepos(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	db, err := database.OpenSQLite(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := db.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	org := &models.Org{Name: "acme"}
+	if err := db.CreateOrg(ctx, org); err != nil {
+		t.Fatal(err)
+	}
+	repo := &models.Repository{OwnerOrgID: &org.ID, Name: "repo", DefaultBranch: "main", StoragePath: "pending"}
+	if err := db.CreateRepository(ctx, repo); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	received := map[string][]recordedWebhook{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		_ = json.Unmarshal(data, &body)
+		mu.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], recordedWebhook{
+			Event:   r.Header.Get("X-Gothub-Event"),
+			Version: r.Header.Get("X-Gothub-Event-Version"),
+			Body:    body,
+		})
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	svc := NewWebhookService(db)
+	if err := svc.CreateWebhook(ctx, &models.Webhook{OrgID: org.ID, URL: receiver.URL + "/org", Events: []string{"nope"}, Active: true}); !errors.Is(err, ErrUnknownWebhookEvent) {
+		t.Fatalf("expected unknown event to be rejected, got %v", err)
+	}
+	orgHook := &models.Webhook{OrgID: org.ID, URL: receiver.URL + "/org", Events: []string{"star", "repository"}, Active: true}
+	if err := svc.CreateWebhook(ctx, orgHook); err != nil {
+		t.Fatal(err)
+	}
+	repoHook := &models.Webhook{RepoID: repo.ID, URL: receiver.URL + "/repo", Events: []string{"issues", "star"}, Active: true}
+	if err := svc.CreateWebhook(ctx, repoHook); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.EmitStarEvent(ctx, repo.ID, models.WebhookActionCreated, user.ID, user.Username); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.EmitIssueEvent(ctx, repo.ID, models.WebhookActionOpened, 1, "bug", "", models.IssueStateOpen); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteRepository(ctx, repo.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.EmitRepositoryEvent(ctx, repo, models.WebhookActionDeleted, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	orgGot, repoGot := received["/org"], received["/repo"]
+	if len(orgGot) != 2 || orgGot[0].Event != "star" || orgGot[1].Event != "repository" {
+		t.Fatalf("unexpected org deliveries: %+v", orgGot)
+	}
+	if len(repoGot) != 2 || repoGot[0].Event != "star" || repoGot[1].Event != "issues" {
+		t.Fatalf("unexpected repo deliveries: %+v", repoGot)
+	}
+	if orgGot[0].Version != "1" || orgGot[0].Body["action"] != "created" {
+		t.Fatalf("unexpected star delivery: %+v", orgGot[0])
+	}
+	if o, _ := orgGot[0].Body["organization"].(map[string]any); o["name"] != "acme" {
+		t.Fatalf("expected organization block, got %+v", orgGot[0].Body)
+	}
+	if orgGot[1].Body["action"] != "deleted" {
+		t.Fatalf("unexpected repository delivery: %+v", orgGot[1])
+	}
+
+	deliveries, err := svc.ListOrgWebhookDeliveriesPage(ctx, org.ID, orgHook.ID, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 || deliveries[0].OrgID != org.ID || deliveries[0].RepoID != repo.ID {
+		t.Fatalf("unexpected org deliveries: %+v", deliveries)
+	}
+}
+
+func TestWebhookEventMatchesCatalog(t *testing.T) {
+	cases := []struct {
+		csv, event string
+		want       bool
+	}{
+		{"*", "check_run", true},
+		{"", "member", true},
+		{"issues,star", "star", true},
+		{"issues", "issue_comment", false},
+		{"*", "not_an_event", false},
+	}
+	for _, tc := range cases {
+		if got := webhookEventMatches(tc.csv, tc.event); got != tc.want {
+			t.Errorf("webhookEventMatches(%q, %q) = %v, want %v", tc.csv, tc.event, got, tc.want)
+		}
+	}
+}
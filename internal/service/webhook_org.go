@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/odvcencio/gothub/internal/models"
+)
+
+// Org webhooks fire for events in every repository the org owns. They are
+// created through CreateWebhook with OrgID set.
+
+func (s *WebhookService) GetOrgWebhook(ctx context.Context, orgID, webhookID int64) (*models.Webhook, error) {
+	hook, err := s.db.GetOrgWebhook(ctx, orgID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	hook.Events = parseWebhookEvents(hook.EventsCSV)
+	return hook, nil
+}
+
+func (s *WebhookService) ListOrgWebhooksPage(ctx context.Context, orgID int64, page, perPage int) ([]models.Webhook, error) {
+	limit, offset := normalizePage(page, perPage, 50, 200)
+	hooks, err := s.db.ListOrgWebhooksPage(ctx, orgID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hooks {
+		hooks[i].Events = parseWebhookEvents(hooks[i].EventsCSV)
+	}
+	return hooks, nil
+}
+
+func (s *WebhookService) DeleteOrgWebhook(ctx context.Context, orgID, webhookID int64) error {
+	if err := s.db.DeleteOrgWebhook(ctx, orgID, webhookID); err != nil {
+		return err
+	}
+	s.recordAudit(ctx, &models.Webhook{ID: webhookID, OrgID: orgID}, AuditWebhookDelete, nil, nil)
+	return nil
+}
+
+func (s *WebhookService) ListOrgWebhookDeliveriesPage(ctx context.Context, orgID, webhookID int64, page, perPage int) ([]models.WebhookDelivery, error) {
+	limit, offset := normalizePage(page, perPage, 50, 200)
+	return s.db.ListOrgWebhookDeliveriesPage(ctx, orgID, webhookID, limit, offset)
+}
+
+func (s *WebhookService) RedeliverOrg(ctx context.Context, orgID, webhookID, deliveryID int64) (*models.WebhookDelivery, error) {
+	hook, err := s.db.GetOrgWebhook(ctx, orgID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	prev, err := s.db.GetOrgWebhookDelivery(ctx, orgID, webhookID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	return s.deliverWithRetry(ctx, hook, prev.RepoID, prev.Event, []byte(prev.RequestBody), &prev.ID)
+}
+
+func (s *WebhookService) PingOrgWebhook(ctx context.Context, orgID, webhookID int64) (*models.WebhookDelivery, error) {
+	hook, err := s.db.GetOrgWebhook(ctx, orgID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	payload := map[string]any{
+		"zen":        "Keep it logically awesome.",
+		"hook_id":    hook.ID,
+		"org_id":     orgID,
+		"active":     hook.Active,
+		"emitted_at": time.Now().UTC().Format(time.RFC3339),
+	}
+	body, _ := json.Marshal(payload)
+	return s.deliverWithRetry(ctx, hook, 0, models.WebhookEventPing, body, nil)
+}